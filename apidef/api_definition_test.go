@@ -22,3 +22,119 @@ func TestSchema(t *testing.T) {
 		}
 	}
 }
+
+func TestValidate(t *testing.T) {
+	spec := DummyAPI()
+	if err := spec.Validate(); err != nil {
+		t.Fatal("Valid definition should pass", err)
+	}
+
+	spec.Proxy.TargetURL = "not a url"
+	spec.AllowedIPs = []string{"127.0.0.1", "10.0.0.0/8", "localhost"}
+	spec.GeoIPAccess.Blocked = []string{"FR", "US-CA", "France"}
+	spec.VersionDefinition.Location = "body"
+	spec.VersionData.NotVersioned = false
+	spec.VersionData.DefaultVersion = "v2"
+	spec.JWTSigningMethod = "none"
+	spec.JWTIssuers = []JWTIssuer{
+		{Issuer: "https://idp.example.com", Source: "https://idp.example.com/jwks"},
+		{Issuer: "https://idp.example.com", CertificateID: "cert", SigningMethod: "none"},
+		{Issuer: "https://other.example.com"},
+	}
+	spec.GRPC.Methods = map[string]GRPCMethodMeta{"helloworld.Greeter/*": {}, "SayHello": {}}
+	spec.VersionCutover = VersionCutoverMeta{Enabled: true, Version: "v3", At: "now"}
+
+	version := spec.VersionData.Versions["Default"]
+	version.Expires = "tomorrow"
+	version.ExtendedPaths.Ignored = []EndPointMeta{{Path: "/users/("}}
+	version.ExtendedPaths.URLRewrite = []URLRewriteMeta{{Path: "/rewrite", MatchPattern: "[a-"}}
+	version.ExtendedPaths.Transform = []TemplateMeta{{
+		Path: "/transform",
+		TemplateData: TemplateData{
+			Mode:       UseOperations,
+			Operations: []TransformOperation{{Op: "add", Path: "a", Value: 1}, {Op: "rename", Path: "b", To: "c.d"}},
+		},
+	}}
+	spec.VersionData.Versions["Default"] = version
+
+	err := spec.Validate()
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatal("Validation errors should be returned", err)
+	}
+
+	expected := []string{
+		"proxy.target_url",
+		"jwt_signing_method",
+		"jwt_issuers[1].issuer",
+		"jwt_issuers[1].signing_method",
+		"jwt_issuers[2]",
+		"allowed_ips",
+		"geo_ip_access.blocked",
+		"definition.location",
+		"grpc.methods",
+		"version_data.default_version",
+		"version_cutover.version",
+		"version_cutover.at",
+		"version_data.versions.Default.expires",
+		"version_data.versions.Default.extended_paths.ignored[0].path",
+		"version_data.versions.Default.extended_paths.url_rewrites[0].match_pattern",
+		"version_data.versions.Default.extended_paths.transform[0].template_data.operations[1].to",
+	}
+	fields := map[string]bool{}
+	for _, err := range errs {
+		fields[err.Field] = true
+	}
+	for _, field := range expected {
+		if !fields[field] {
+			t.Error("Field should be reported", field, errs)
+		}
+	}
+	if len(errs) != len(expected) {
+		t.Error("Only invalid fields should be reported", errs)
+	}
+}
+
+func TestValidateLayer4(t *testing.T) {
+	spec := DummyAPI()
+	spec.Protocol = ProtocolTCP
+	spec.Proxy.TargetURL = "http://localhost:5432"
+	spec.VersionData.Versions = nil
+
+	errs, ok := spec.Validate().(ValidationErrors)
+	if !ok || len(errs) != 2 || errs[0].Field != "listen_port" || errs[1].Field != "proxy.target_url" {
+		t.Fatal("Listen port and upstream URL should be reported", errs)
+	}
+
+	spec.ListenPort = 5432
+	spec.Proxy.TargetURL = "tls://db.internal:5432"
+	if err := spec.Validate(); err != nil {
+		t.Error("Valid layer 4 API should pass", err)
+	}
+}
+
+func TestValidateTransport(t *testing.T) {
+	spec := DummyAPI()
+	spec.Proxy.TargetURL = "http://localhost:50051"
+	spec.GRPC.Enabled = true
+	spec.Proxy.Transport.ProxyURL = "http://proxy:3128"
+	spec.Proxy.Transport.MaxConnsPerHost = 10
+	spec.Proxy.Transport.ALPN = []string{"http/1.1"}
+
+	errs, ok := spec.Validate().(ValidationErrors)
+	if !ok || len(errs) != 3 || errs[0].Field != "proxy.transport.proxy_url" || errs[1].Field != "proxy.transport" || errs[2].Field != "proxy.transport.alpn" {
+		t.Fatal("Proxy, pool and ALPN settings should be reported", errs)
+	}
+
+	// Over TLS, gRPC goes through the proxy and the connection pool
+	spec.Proxy.TargetURL = "https://localhost:50051"
+	spec.Proxy.Transport.ALPN = []string{"h2"}
+	if err := spec.Validate(); err != nil {
+		t.Error("Valid gRPC API should pass", err)
+	}
+
+	spec.GRPC.Enabled = false
+	if errs, ok := spec.Validate().(ValidationErrors); !ok || len(errs) != 1 || errs[0].Field != "proxy.transport.alpn" {
+		t.Error("h2 offered without HTTP/2 should be reported", errs)
+	}
+}
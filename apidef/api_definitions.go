@@ -36,8 +36,9 @@ const (
 	NoAction EndpointMethodAction = "no_action"
 	Reply    EndpointMethodAction = "reply"
 
-	UseBlob TemplateMode = "blob"
-	UseFile TemplateMode = "file"
+	UseBlob       TemplateMode = "blob"
+	UseFile       TemplateMode = "file"
+	UseOperations TemplateMode = "operations"
 
 	RequestXML  RequestInputType = "xml"
 	RequestJSON RequestInputType = "json"
@@ -64,6 +65,7 @@ const (
 	JWTClaim      AuthTypeEnum = "jwt_claim"
 	OIDCUser      AuthTypeEnum = "oidc_user"
 	OAuthKey      AuthTypeEnum = "oauth_key"
+	ClientCert    AuthTypeEnum = "client_certificate"
 	UnsetAuth     AuthTypeEnum = ""
 
 	// For routing triggers
@@ -72,6 +74,13 @@ const (
 	Ignore RoutingTriggerOnType = ""
 )
 
+// Protocols of layer 4 APIs, which proxy connections accepted on ListenPort
+// instead of HTTP requests.
+const (
+	ProtocolTCP = "tcp"
+	ProtocolTLS = "tls"
+)
+
 type EndpointMethodMeta struct {
 	Action  EndpointMethodAction `bson:"action" json:"action"`
 	Code    int                  `bson:"code" json:"code"`
@@ -88,15 +97,49 @@ type CacheMeta struct {
 	Method        string `bson:"method" json:"method"`
 	Path          string `bson:"path" json:"path"`
 	CacheKeyRegex string `bson:"cache_key_regex" json:"cache_key_regex"`
+	// CacheKeyTemplate overrides the cache key template of the API for the
+	// endpoint.
+	CacheKeyTemplate string `bson:"cache_key_template" json:"cache_key_template,omitempty"`
 }
 
 type RequestInputType string
 
 type TemplateData struct {
-	Input          RequestInputType `bson:"input_type" json:"input_type"`
-	Mode           TemplateMode     `bson:"template_mode" json:"template_mode"`
-	EnableSession  bool             `bson:"enable_session" json:"enable_session"`
-	TemplateSource string           `bson:"template_source" json:"template_source"`
+	Input          RequestInputType     `bson:"input_type" json:"input_type"`
+	Mode           TemplateMode         `bson:"template_mode" json:"template_mode"`
+	EnableSession  bool                 `bson:"enable_session" json:"enable_session"`
+	TemplateSource string               `bson:"template_source" json:"template_source"`
+	Streaming      bool                 `bson:"streaming" json:"streaming"`
+	StreamPath     string               `bson:"stream_path" json:"stream_path"`
+	Operations     []TransformOperation `bson:"operations" json:"operations,omitempty"`
+}
+
+// TransformOperation is a step of a declarative JSON transform, used instead
+// of a template in the operations mode. Paths are dot separated object keys
+// and array indexes. Op is one of:
+//
+//   - add: sets Value at Path
+//   - copy: sets the value at From at Path
+//   - move: moves the value at From to Path
+//   - rename: renames the last key of Path to To
+//   - remove: removes the value at Path
+//
+// Operations only apply to bodies matching If, when set.
+type TransformOperation struct {
+	Op    string              `bson:"op" json:"op"`
+	Path  string              `bson:"path" json:"path"`
+	From  string              `bson:"from" json:"from,omitempty"`
+	To    string              `bson:"to" json:"to,omitempty"`
+	Value interface{}         `bson:"value" json:"value,omitempty"`
+	If    *TransformCondition `bson:"if" json:"if,omitempty"`
+}
+
+// TransformCondition matches bodies by the value at Path: equal to Equals
+// when set, present or not as set by Exists.
+type TransformCondition struct {
+	Path   string      `bson:"path" json:"path"`
+	Equals interface{} `bson:"equals" json:"equals,omitempty"`
+	Exists *bool       `bson:"exists" json:"exists,omitempty"`
 }
 
 type TemplateMeta struct {
@@ -111,6 +154,43 @@ type TransformJQMeta struct {
 	Method string `bson:"method" json:"method"`
 }
 
+// XMLConversionMeta converts the JSON request bodies of an endpoint to XML,
+// for upstreams which only speak XML like SOAP services, and their XML
+// responses back to JSON. Attributes and the text of elements with attributes
+// are mapped to object keys with the attribute prefix and the text key, "-"
+// and "#text" by default.
+type XMLConversionMeta struct {
+	Path            string `bson:"path" json:"path"`
+	Method          string `bson:"method" json:"method"`
+	RootElement     string `bson:"root_element" json:"root_element"`
+	AttributePrefix string `bson:"attribute_prefix" json:"attribute_prefix"`
+	TextKey         string `bson:"text_key" json:"text_key"`
+	SOAPEnvelope    bool   `bson:"soap_envelope" json:"soap_envelope"`
+	SOAPAction      string `bson:"soap_action" json:"soap_action"`
+}
+
+// MockResponseMeta answers the requests to an endpoint with a mock response
+// instead of proxying them, for consumers to build against an API before its
+// upstream exists. The body is Example, or is generated from Schema, a JSON
+// Schema carrying the definitions or components its references point to, as
+// imported from OpenAPI documents.
+type MockResponseMeta struct {
+	Path   string `bson:"path" json:"path"`
+	Method string `bson:"method" json:"method"`
+	// Code defaults to 200.
+	Code    int                    `bson:"code" json:"code"`
+	Headers map[string]string      `bson:"headers" json:"headers"`
+	Example interface{}            `bson:"example" json:"example"`
+	Schema  map[string]interface{} `bson:"schema" json:"schema"`
+	// Template renders the body as a Go template of the request, with its
+	// Method, Path, Params of the path, Query, Headers and JSON Body.
+	Template bool `bson:"template" json:"template"`
+	// Latency delays responses by that many milliseconds, and by up to
+	// LatencyJitter more at random.
+	Latency       int64 `bson:"latency" json:"latency"`
+	LatencyJitter int64 `bson:"latency_jitter" json:"latency_jitter"`
+}
+
 type HeaderInjectionMeta struct {
 	DeleteHeaders []string          `bson:"delete_headers" json:"delete_headers"`
 	AddHeaders    map[string]string `bson:"add_headers" json:"add_headers"`
@@ -141,12 +221,45 @@ type RequestSizeMeta struct {
 	SizeLimit int64  `bson:"size_limit" json:"size_limit"`
 }
 
+// RateLimitMeta limits requests to the endpoint, per key, or for all requests
+// of keyless APIs. Endpoints are counted apart from each other and from the
+// limits of keys. 0 means no limit.
+type RateLimitMeta struct {
+	Path             string  `bson:"path" json:"path"`
+	Method           string  `bson:"method" json:"method"`
+	Rate             float64 `bson:"rate" json:"rate"`
+	Per              float64 `bson:"per" json:"per"`
+	QuotaMax         int64   `bson:"quota_max" json:"quota_max"`
+	QuotaRenewalRate int64   `bson:"quota_renewal_rate" json:"quota_renewal_rate"`
+}
+
 type CircuitBreakerMeta struct {
-	Path                 string  `bson:"path" json:"path"`
-	Method               string  `bson:"method" json:"method"`
-	ThresholdPercent     float64 `bson:"threshold_percent" json:"threshold_percent"`
-	Samples              int64   `bson:"samples" json:"samples"`
-	ReturnToServiceAfter int     `bson:"return_to_service_after" json:"return_to_service_after"`
+	Path   string `bson:"path" json:"path"`
+	Method string `bson:"method" json:"method"`
+	// ThresholdPercent is the fraction of failed requests in the window, from
+	// 0 to 1, which trips the breaker once it has seen Samples requests.
+	ThresholdPercent float64 `bson:"threshold_percent" json:"threshold_percent"`
+	Samples          int64   `bson:"samples" json:"samples"`
+	// ReturnToServiceAfter is how many seconds the breaker stays open before
+	// letting probe requests through.
+	ReturnToServiceAfter int `bson:"return_to_service_after" json:"return_to_service_after"`
+	// WindowSize is how many seconds of requests the breaker looks back at,
+	// 10 by default.
+	WindowSize int64 `bson:"window_size" json:"window_size,omitempty"`
+	// ConsecutiveFailures trips the breaker after as many failures in a row.
+	ConsecutiveFailures int64 `bson:"consecutive_failures" json:"consecutive_failures,omitempty"`
+	// LatencyThreshold trips the breaker once the LatencyPercentile of the
+	// response times in the window exceeds it, in milliseconds.
+	LatencyThreshold int64 `bson:"latency_threshold" json:"latency_threshold,omitempty"`
+	// LatencyPercentile is a fraction, 0.99 by default for the 99th
+	// percentile.
+	LatencyPercentile float64 `bson:"latency_percentile" json:"latency_percentile,omitempty"`
+	// HalfOpenProbes is how many probe requests must succeed to close the
+	// breaker again, 1 by default.
+	HalfOpenProbes int64 `bson:"half_open_probes" json:"half_open_probes,omitempty"`
+	// PerHost keeps a breaker per upstream host, so that one failing host of
+	// a load balanced API does not take the others out of service.
+	PerHost bool `bson:"per_host" json:"per_host,omitempty"`
 }
 
 type StringRegexMap struct {
@@ -205,6 +318,26 @@ type ValidatePathMeta struct {
 	ErrorResponseCode int `bson:"error_response_code" json:"error_response_code"`
 }
 
+// openAPIFormat checks the formats OpenAPI documents give to values, which
+// JSON Schema doesn't define. Formats of numbers and binary data only
+// annotate them.
+type openAPIFormat string
+
+func (f openAPIFormat) IsFormat(input string) bool {
+	if f == "byte" {
+		_, err := base64.StdEncoding.DecodeString(input)
+		return err == nil
+	}
+	return true
+}
+
+func init() {
+	// Let ValidateJSON load the schemas of imported OpenAPI documents
+	for _, format := range []openAPIFormat{"int32", "int64", "float", "double", "byte", "binary", "password"} {
+		gojsonschema.FormatCheckers.Add(string(format), format)
+	}
+}
+
 type ExtendedPathsSet struct {
 	Ignored                 []EndPointMeta        `bson:"ignored" json:"ignored,omitempty"`
 	WhiteList               []EndPointMeta        `bson:"white_list" json:"white_list,omitempty"`
@@ -227,6 +360,20 @@ type ExtendedPathsSet struct {
 	DoNotTrackEndpoints     []TrackEndpointMeta   `bson:"do_not_track_endpoints" json:"do_not_track_endpoints,omitempty"`
 	ValidateJSON            []ValidatePathMeta    `bson:"validate_json" json:"validate_json,omitempty"`
 	Internal                []InternalMeta        `bson:"internal" json:"internal"`
+	RateLimit               []RateLimitMeta       `bson:"rate_limit" json:"rate_limit,omitempty"`
+	ConvertXML              []XMLConversionMeta   `bson:"convert_xml" json:"convert_xml,omitempty"`
+	MockResponse            []MockResponseMeta    `bson:"mock_response" json:"mock_response,omitempty"`
+}
+
+// VersionCutoverMeta switches the default version of an API to Version at
+// a scheduled time, for blue/green deployments. The switch can be rolled
+// back to the default version through the API of the gateway.
+type VersionCutoverMeta struct {
+	Enabled bool   `bson:"enabled" json:"enabled"`
+	Version string `bson:"version" json:"version"`
+	// At is the UTC time of the switch, in the format of version expiry
+	// dates, "2006-01-02 15:04".
+	At string `bson:"at" json:"at"`
 }
 
 type VersionInfo struct {
@@ -244,6 +391,33 @@ type VersionInfo struct {
 	GlobalHeadersRemove []string          `bson:"global_headers_remove" json:"global_headers_remove"`
 	GlobalSizeLimit     int64             `bson:"global_size_limit" json:"global_size_limit"`
 	OverrideTarget      string            `bson:"override_target" json:"override_target"`
+	// LoadBalancing balances requests to the version over its own targets,
+	// instead of those of the API.
+	LoadBalancing LoadBalancingMeta `bson:"load_balancing" json:"load_balancing"`
+	Canary        CanaryMeta        `bson:"canary" json:"canary"`
+}
+
+// CanaryMeta sends the requests to a version matching its rules, and a share
+// of the others, to an alternate upstream. Requests are tagged in analytics
+// with the variant they were sent to, as "variant-<name>": Name, "canary" by
+// default, or "stable".
+type CanaryMeta struct {
+	Enabled   bool   `bson:"enabled" json:"enabled"`
+	Name      string `bson:"name" json:"name"`
+	TargetURL string `bson:"target_url" json:"target_url"`
+	// Percentage of the requests sent to the canary, sticking to it by key,
+	// or by IP address for keyless requests.
+	Percentage float64 `bson:"percentage" json:"percentage"`
+	// Header sends requests with it set to one of HeaderValues, or to
+	// anything if there are none.
+	Header       string   `bson:"header" json:"header"`
+	HeaderValues []string `bson:"header_values" json:"header_values"`
+	// Claim sends requests with a JWT claim set to one of ClaimValues, or
+	// to anything if there are none. It needs context variables enabled.
+	Claim       string   `bson:"claim" json:"claim"`
+	ClaimValues []string `bson:"claim_values" json:"claim_values"`
+	// KeyTags sends the requests of keys with any of them.
+	KeyTags []string `bson:"key_tags" json:"key_tags"`
 }
 
 type AuthProviderMeta struct {
@@ -298,6 +472,16 @@ type CacheOptions struct {
 	CacheOnlyResponseCodes     []int  `bson:"cache_response_codes" json:"cache_response_codes"`
 	EnableUpstreamCacheControl bool   `bson:"enable_upstream_cache_control" json:"enable_upstream_cache_control"`
 	CacheControlTTLHeader      string `bson:"cache_control_ttl_header" json:"cache_control_ttl_header"`
+	// CacheKeyTemplate renders what tells requests apart in the cache, from
+	// their Method, Path, Query, Headers, Token and the Claims of their JWT,
+	// instead of their key and URL.
+	CacheKeyTemplate string `bson:"cache_key_template" json:"cache_key_template,omitempty"`
+	// HonorCacheControl follows the Cache-Control and Vary headers of
+	// responses, and requests asking not to be served from the cache.
+	HonorCacheControl bool `bson:"honor_cache_control" json:"honor_cache_control"`
+	// StaleWhileRevalidate is how many seconds expired responses are still
+	// served for while they are refreshed in the background.
+	StaleWhileRevalidate int64 `bson:"stale_while_revalidate" json:"stale_while_revalidate"`
 }
 
 type ResponseProcessor struct {
@@ -323,8 +507,81 @@ type ServiceDiscoveryConfiguration struct {
 	UseTargetList       bool   `bson:"use_target_list" json:"use_target_list"`
 	CacheTimeout        int64  `bson:"cache_timeout" json:"cache_timeout"`
 	EndpointReturnsList bool   `bson:"endpoint_returns_list" json:"endpoint_returns_list"`
+	// WeightDataPath and PriorityDataPath are paths of the weight and
+	// priority of each target, like PortDataPath.
+	WeightDataPath   string `bson:"weight_data_path" json:"weight_data_path"`
+	PriorityDataPath string `bson:"priority_data_path" json:"priority_data_path"`
+	// Provider watches a service registry for the targets, instead of
+	// polling QueryEndpoint: "kubernetes", "consul", "eureka" or "dns_srv".
+	Provider   string                  `bson:"provider" json:"provider"`
+	Kubernetes KubernetesDiscoveryMeta `bson:"kubernetes" json:"kubernetes"`
+	Consul     ConsulDiscoveryMeta     `bson:"consul" json:"consul"`
+	Eureka     EurekaDiscoveryMeta     `bson:"eureka" json:"eureka"`
+	DNSSRV     DNSSRVDiscoveryMeta     `bson:"dns_srv" json:"dns_srv"`
 }
 
+// KubernetesDiscoveryMeta selects the endpoints of the targets in a
+// Kubernetes cluster, watching EndpointSlices, or Endpoints if UseEndpoints is
+// set. Only ready endpoints are targets.
+type KubernetesDiscoveryMeta struct {
+	// APIServer defaults to the cluster the gateway runs in, authenticating
+	// with its service account.
+	APIServer string `bson:"api_server" json:"api_server"`
+	// Namespace defaults to the namespace of the gateway, or "default".
+	Namespace string `bson:"namespace" json:"namespace"`
+	// Service and LabelSelector select the endpoints, of all the services
+	// matching LabelSelector if Service is empty.
+	Service       string `bson:"service" json:"service"`
+	LabelSelector string `bson:"label_selector" json:"label_selector"`
+	// PortName is the port of the targets, the first one by default.
+	PortName     string `bson:"port_name" json:"port_name"`
+	Scheme       string `bson:"scheme" json:"scheme"` // "http" by default
+	UseEndpoints bool   `bson:"use_endpoints" json:"use_endpoints"`
+}
+
+// ConsulDiscoveryMeta selects the instances of a service registered in
+// Consul, watched with blocking queries. Only instances passing all their
+// health checks are targets, weighted by their passing weight.
+type ConsulDiscoveryMeta struct {
+	Address    string `bson:"address" json:"address"` // "http://127.0.0.1:8500" by default
+	Service    string `bson:"service" json:"service"`
+	Tag        string `bson:"tag" json:"tag"`
+	Datacenter string `bson:"datacenter" json:"datacenter"`
+	Token      string `bson:"token" json:"token"`
+	Scheme     string `bson:"scheme" json:"scheme"` // "http" by default
+}
+
+// EurekaDiscoveryMeta selects the instances of an application registered in
+// Eureka that are up, fetched again every RefreshInterval seconds, 30 by
+// default. Instances are weighted by their "weight" metadata, if any.
+type EurekaDiscoveryMeta struct {
+	Address         string `bson:"address" json:"address"` // "http://127.0.0.1:8761/eureka" by default
+	App             string `bson:"app" json:"app"`
+	RefreshInterval int64  `bson:"refresh_interval" json:"refresh_interval"`
+	// UseHostName targets the host names of instances instead of their IP
+	// addresses, and UseSecurePort their secure port over https.
+	UseHostName   bool `bson:"use_host_name" json:"use_host_name"`
+	UseSecurePort bool `bson:"use_secure_port" json:"use_secure_port"`
+}
+
+// DNSSRVDiscoveryMeta looks the targets up in the SRV records of Name, like
+// "_http._tcp.web.example.com", again once their TTL expires. The weights and
+// priorities of the records are those of the targets.
+type DNSSRVDiscoveryMeta struct {
+	Name string `bson:"name" json:"name"`
+	// Nameserver is the "host:port" of the server to ask, the first one of
+	// /etc/resolv.conf by default.
+	Nameserver string `bson:"nameserver" json:"nameserver"`
+	Scheme     string `bson:"scheme" json:"scheme"` // "http" by default
+}
+
+const (
+	ServiceDiscoveryKubernetes = "kubernetes"
+	ServiceDiscoveryConsul     = "consul"
+	ServiceDiscoveryEureka     = "eureka"
+	ServiceDiscoveryDNSSRV     = "dns_srv"
+)
+
 type OIDProviderConfig struct {
 	Issuer    string            `bson:"issuer" json:"issuer"`
 	ClientIDs map[string]string `bson:"client_ids" json:"client_ids"`
@@ -333,6 +590,16 @@ type OIDProviderConfig struct {
 type OpenIDOptions struct {
 	Providers         []OIDProviderConfig `bson:"providers" json:"providers"`
 	SegregateByClient bool                `bson:"segregate_by_client" json:"segregate_by_client"`
+	// JWKSRefreshInterval is how often, in seconds, the discovery document
+	// and signing keys of the providers are fetched again. Keys are otherwise
+	// only fetched again when a token is signed with an unknown one.
+	JWKSRefreshInterval int64 `bson:"jwks_refresh_interval" json:"jwks_refresh_interval"`
+	// NonceHeader names the header, or else cookie, holding the nonce the
+	// client sent in its authentication request, which the ID token must carry.
+	NonceHeader string `bson:"nonce_header" json:"nonce_header"`
+	// AccessTokenHeader names the header holding the access token issued with
+	// the ID token. When sent, it must match the at_hash claim.
+	AccessTokenHeader string `bson:"access_token_header" json:"access_token_header"`
 }
 
 // APIDefinition represents the configuration for a single proxied API and it's versions.
@@ -362,33 +629,38 @@ type APIDefinition struct {
 		BodyUserRegexp     string `bson:"body_user_regexp" json:"body_user_regexp"`
 		BodyPasswordRegexp string `bson:"body_password_regexp" json:"body_password_regexp"`
 	} `bson:"basic_auth" json:"basic_auth"`
-	UseMutualTLSAuth           bool                 `bson:"use_mutual_tls_auth" json:"use_mutual_tls_auth"`
-	ClientCertificates         []string             `bson:"client_certificates" json:"client_certificates"`
-	UpstreamCertificates       map[string]string    `bson:"upstream_certificates" json:"upstream_certificates"`
-	PinnedPublicKeys           map[string]string    `bson:"pinned_public_keys" json:"pinned_public_keys"`
-	EnableJWT                  bool                 `bson:"enable_jwt" json:"enable_jwt"`
-	UseStandardAuth            bool                 `bson:"use_standard_auth" json:"use_standard_auth"`
-	UseGoPluginAuth            bool                 `bson:"use_go_plugin_auth" json:"use_go_plugin_auth"`
-	EnableCoProcessAuth        bool                 `bson:"enable_coprocess_auth" json:"enable_coprocess_auth"`
-	JWTSigningMethod           string               `bson:"jwt_signing_method" json:"jwt_signing_method"`
-	JWTSource                  string               `bson:"jwt_source" json:"jwt_source"`
-	JWTIdentityBaseField       string               `bson:"jwt_identit_base_field" json:"jwt_identity_base_field"`
-	JWTClientIDBaseField       string               `bson:"jwt_client_base_field" json:"jwt_client_base_field"`
-	JWTPolicyFieldName         string               `bson:"jwt_policy_field_name" json:"jwt_policy_field_name"`
-	JWTDefaultPolicies         []string             `bson:"jwt_default_policies" json:"jwt_default_policies"`
-	JWTIssuedAtValidationSkew  uint64               `bson:"jwt_issued_at_validation_skew" json:"jwt_issued_at_validation_skew"`
-	JWTExpiresAtValidationSkew uint64               `bson:"jwt_expires_at_validation_skew" json:"jwt_expires_at_validation_skew"`
-	JWTNotBeforeValidationSkew uint64               `bson:"jwt_not_before_validation_skew" json:"jwt_not_before_validation_skew"`
-	JWTSkipKid                 bool                 `bson:"jwt_skip_kid" json:"jwt_skip_kid"`
-	JWTScopeToPolicyMapping    map[string]string    `bson:"jwt_scope_to_policy_mapping" json:"jwt_scope_to_policy_mapping"`
-	JWTScopeClaimName          string               `bson:"jwt_scope_claim_name" json:"jwt_scope_claim_name"`
-	NotificationsDetails       NotificationsManager `bson:"notifications" json:"notifications"`
-	EnableSignatureChecking    bool                 `bson:"enable_signature_checking" json:"enable_signature_checking"`
-	HmacAllowedClockSkew       float64              `bson:"hmac_allowed_clock_skew" json:"hmac_allowed_clock_skew"`
-	HmacAllowedAlgorithms      []string             `bson:"hmac_allowed_algorithms" json:"hmac_allowed_algorithms"`
-	RequestSigning             RequestSigningMeta   `bson:"request_signing" json:"request_signing"`
-	BaseIdentityProvidedBy     AuthTypeEnum         `bson:"base_identity_provided_by" json:"base_identity_provided_by"`
-	VersionDefinition          struct {
+	UseMutualTLSAuth            bool                      `bson:"use_mutual_tls_auth" json:"use_mutual_tls_auth"`
+	ClientCertificates          []string                  `bson:"client_certificates" json:"client_certificates"`
+	ClientCertificateValidation CertificateValidationMeta `bson:"client_certificate_validation" json:"client_certificate_validation"`
+	ForwardClientCertificate    ForwardedCertMeta         `bson:"forward_client_certificate" json:"forward_client_certificate"`
+	CertificateBoundTokens      bool                      `bson:"certificate_bound_tokens" json:"certificate_bound_tokens"`
+	TLSPolicy                   TLSPolicyMeta             `bson:"tls_policy" json:"tls_policy"`
+	UpstreamCertificates        map[string]string         `bson:"upstream_certificates" json:"upstream_certificates"`
+	PinnedPublicKeys            map[string]string         `bson:"pinned_public_keys" json:"pinned_public_keys"`
+	EnableJWT                   bool                      `bson:"enable_jwt" json:"enable_jwt"`
+	UseStandardAuth             bool                      `bson:"use_standard_auth" json:"use_standard_auth"`
+	UseGoPluginAuth             bool                      `bson:"use_go_plugin_auth" json:"use_go_plugin_auth"`
+	EnableCoProcessAuth         bool                      `bson:"enable_coprocess_auth" json:"enable_coprocess_auth"`
+	JWTSigningMethod            string                    `bson:"jwt_signing_method" json:"jwt_signing_method"`
+	JWTSource                   string                    `bson:"jwt_source" json:"jwt_source"`
+	JWTIdentityBaseField        string                    `bson:"jwt_identit_base_field" json:"jwt_identity_base_field"`
+	JWTClientIDBaseField        string                    `bson:"jwt_client_base_field" json:"jwt_client_base_field"`
+	JWTPolicyFieldName          string                    `bson:"jwt_policy_field_name" json:"jwt_policy_field_name"`
+	JWTDefaultPolicies          []string                  `bson:"jwt_default_policies" json:"jwt_default_policies"`
+	JWTIssuedAtValidationSkew   uint64                    `bson:"jwt_issued_at_validation_skew" json:"jwt_issued_at_validation_skew"`
+	JWTExpiresAtValidationSkew  uint64                    `bson:"jwt_expires_at_validation_skew" json:"jwt_expires_at_validation_skew"`
+	JWTNotBeforeValidationSkew  uint64                    `bson:"jwt_not_before_validation_skew" json:"jwt_not_before_validation_skew"`
+	JWTSkipKid                  bool                      `bson:"jwt_skip_kid" json:"jwt_skip_kid"`
+	JWTScopeToPolicyMapping     map[string]string         `bson:"jwt_scope_to_policy_mapping" json:"jwt_scope_to_policy_mapping"`
+	JWTScopeClaimName           string                    `bson:"jwt_scope_claim_name" json:"jwt_scope_claim_name"`
+	JWTIssuers                  []JWTIssuer               `bson:"jwt_issuers" json:"jwt_issuers"`
+	NotificationsDetails        NotificationsManager      `bson:"notifications" json:"notifications"`
+	EnableSignatureChecking     bool                      `bson:"enable_signature_checking" json:"enable_signature_checking"`
+	HmacAllowedClockSkew        float64                   `bson:"hmac_allowed_clock_skew" json:"hmac_allowed_clock_skew"`
+	HmacAllowedAlgorithms       []string                  `bson:"hmac_allowed_algorithms" json:"hmac_allowed_algorithms"`
+	RequestSigning              RequestSigningMeta        `bson:"request_signing" json:"request_signing"`
+	BaseIdentityProvidedBy      AuthTypeEnum              `bson:"base_identity_provided_by" json:"base_identity_provided_by"`
+	VersionDefinition           struct {
 		Location  string `bson:"location" json:"location"`
 		Key       string `bson:"key" json:"key"`
 		StripPath bool   `bson:"strip_path" json:"strip_path"`
@@ -398,7 +670,8 @@ type APIDefinition struct {
 		DefaultVersion string                 `bson:"default_version" json:"default_version"`
 		Versions       map[string]VersionInfo `bson:"versions" json:"versions"`
 	} `bson:"version_data" json:"version_data"`
-	UptimeTests struct {
+	VersionCutover VersionCutoverMeta `bson:"version_cutover" json:"version_cutover"`
+	UptimeTests    struct {
 		CheckList []HostCheckObject `bson:"check_list" json:"check_list"`
 		Config    struct {
 			ExpireUptimeAnalyticsAfter int64                         `bson:"expire_utime_after" json:"expire_utime_after"` // must have an expireAt TTL index set (http://docs.mongodb.org/manual/tutorial/expire-data/)
@@ -417,13 +690,48 @@ type APIDefinition struct {
 		StructuredTargetList        *HostList                     `bson:"-" json:"-"`
 		CheckHostAgainstUptimeTests bool                          `bson:"check_host_against_uptime_tests" json:"check_host_against_uptime_tests"`
 		ServiceDiscovery            ServiceDiscoveryConfiguration `bson:"service_discovery" json:"service_discovery"`
+		Hedging                     HedgingMeta                   `bson:"hedging" json:"hedging"`
+		Retry                       RetryMeta                     `bson:"retry" json:"retry"`
+		Mirror                      MirrorMeta                    `bson:"mirror" json:"mirror"`
+		LoadBalancing               LoadBalancingMeta             `bson:"load_balancing" json:"load_balancing"`
+		HealthCheck                 UpstreamHealthCheckMeta       `bson:"health_check" json:"health_check"`
 		Transport                   struct {
 			SSLInsecureSkipVerify bool     `bson:"ssl_insecure_skip_verify" json:"ssl_insecure_skip_verify"`
 			SSLCipherSuites       []string `bson:"ssl_ciphers" json:"ssl_ciphers"`
 			SSLMinVersion         uint16   `bson:"ssl_min_version" json:"ssl_min_version"`
 			ProxyURL              string   `bson:"proxy_url" json:"proxy_url"`
+			// The connection pool settings override the global ones when
+			// set. Timeouts are in seconds.
+			MaxIdleConns        int   `bson:"max_idle_conns" json:"max_idle_conns"`
+			MaxIdleConnsPerHost int   `bson:"max_idle_conns_per_host" json:"max_idle_conns_per_host"`
+			MaxConnsPerHost     int   `bson:"max_conns_per_host" json:"max_conns_per_host"`
+			IdleConnTimeout     int64 `bson:"idle_conn_timeout" json:"idle_conn_timeout"`
+			TLSHandshakeTimeout int64 `bson:"tls_handshake_timeout" json:"tls_handshake_timeout"` // 10 by default
+			DisableKeepAlives   bool  `bson:"disable_keep_alives" json:"disable_keep_alives"`
+			// EnableHTTP2 negotiates HTTP/2 with https upstreams, which
+			// HTTP2PriorKnowledge speaks without negotiating, and in
+			// cleartext (h2c) to http upstreams.
+			EnableHTTP2         bool `bson:"enable_http2" json:"enable_http2"`
+			HTTP2PriorKnowledge bool `bson:"http2_prior_knowledge" json:"http2_prior_knowledge"`
+			// ALPN is the protocols offered to https upstreams, in order of
+			// preference. By default "h2" is offered when HTTP/2 is enabled,
+			// and "http/1.1". "h2" should be offered if and only if HTTP/2
+			// is enabled for the API. HTTP/2 prior knowledge and cleartext
+			// gRPC don't support ProxyURL nor the connection pool settings.
+			ALPN []string `bson:"alpn" json:"alpn"`
+			// HTTP2MaxHeaderListSize is the largest response headers taken
+			// over HTTP/2 spoken with prior knowledge, 10MB by default.
+			// Flow-control windows can't be tuned, the vendored HTTP/2
+			// client always uses 4MB per stream and 1GB per connection.
+			HTTP2MaxHeaderListSize uint32 `bson:"http2_max_header_list_size" json:"http2_max_header_list_size"`
+			// IsolateUpstreams gives each upstream host a transport, and so
+			// a connection pool, of its own.
+			IsolateUpstreams bool `bson:"isolate_upstreams" json:"isolate_upstreams"`
 		} `bson:"transport" json:"transport"`
 	} `bson:"proxy" json:"proxy"`
+	GraphQL                   GraphQLMeta            `bson:"graphql" json:"graphql"`
+	GRPC                      GRPCMeta               `bson:"grpc" json:"grpc"`
+	WebSocket                 WebSocketMeta          `bson:"websocket" json:"websocket"`
 	DisableRateLimit          bool                   `bson:"disable_rate_limit" json:"disable_rate_limit"`
 	DisableQuota              bool                   `bson:"disable_quota" json:"disable_quota"`
 	CustomMiddleware          MiddlewareSection      `bson:"custom_middleware" json:"custom_middleware"`
@@ -440,6 +748,9 @@ type APIDefinition struct {
 	AllowedIPs                []string               `mapstructure:"allowed_ips" bson:"allowed_ips" json:"allowed_ips"`
 	EnableIpBlacklisting      bool                   `mapstructure:"enable_ip_blacklisting" bson:"enable_ip_blacklisting" json:"enable_ip_blacklisting"`
 	BlacklistedIPs            []string               `mapstructure:"blacklisted_ips" bson:"blacklisted_ips" json:"blacklisted_ips"`
+	AllowedIPLists            []string               `mapstructure:"allowed_ip_lists" bson:"allowed_ip_lists" json:"allowed_ip_lists"`
+	BlacklistedIPLists        []string               `mapstructure:"blacklisted_ip_lists" bson:"blacklisted_ip_lists" json:"blacklisted_ip_lists"`
+	GeoIPAccess               GeoIPAccess            `bson:"geo_ip_access" json:"geo_ip_access"`
 	DontSetQuotasOnCreate     bool                   `mapstructure:"dont_set_quota_on_create" bson:"dont_set_quota_on_create" json:"dont_set_quota_on_create"`
 	ExpireAnalyticsAfter      int64                  `mapstructure:"expire_analytics_after" bson:"expire_analytics_after" json:"expire_analytics_after"` // must have an expireAt TTL index set (http://docs.mongodb.org/manual/tutorial/expire-data/)
 	ResponseProcessors        []ResponseProcessor    `bson:"response_processors" json:"response_processors"`
@@ -455,6 +766,8 @@ type APIDefinition struct {
 		Debug              bool     `bson:"debug" json:"debug"`
 	} `bson:"CORS" json:"CORS"`
 	Domain            string                 `bson:"domain" json:"domain"`
+	Protocol          string                 `bson:"protocol" json:"protocol"`
+	ListenPort        int                    `bson:"listen_port" json:"listen_port"`
 	Certificates      []string               `bson:"certificates" json:"certificates"`
 	DoNotTrack        bool                   `bson:"do_not_track" json:"do_not_track"`
 	Tags              []string               `bson:"tags" json:"tags"`
@@ -462,7 +775,10 @@ type APIDefinition struct {
 	ConfigData        map[string]interface{} `bson:"config_data" json:"config_data"`
 	TagHeaders        []string               `bson:"tag_headers" json:"tag_headers"`
 	GlobalRateLimit   GlobalRateLimit        `bson:"global_rate_limit" json:"global_rate_limit"`
+	ConcurrencyLimit  ConcurrencyLimit       `bson:"concurrency_limit" json:"concurrency_limit"`
+	DPoP              DPoPMeta               `bson:"dpop" json:"dpop"`
 	StripAuthData     bool                   `bson:"strip_auth_data" json:"strip_auth_data"`
+	Maintenance       MaintenanceMeta        `bson:"maintenance" json:"maintenance"`
 }
 
 type Auth struct {
@@ -485,9 +801,88 @@ type SignatureConfig struct {
 	ErrorMessage     string `mapstructure:"error_message" bson:"error_message" json:"error_message"`
 }
 
+// JWTIssuer is an issuer of JWTs trusted by an API, matched by the iss claim.
+// Its keys are found in Source, a JWKS URL or base64 encoded secret or key as
+// of jwt_source, or in the certificate store by CertificateID. Its tokens
+// must be meant for one of Audiences, if set. Other fields map claims to
+// policies as the jwt_ fields of the API definition do.
+type JWTIssuer struct {
+	Issuer               string            `bson:"issuer" json:"issuer"`
+	Source               string            `bson:"source" json:"source"`
+	CertificateID        string            `bson:"certificate_id" json:"certificate_id"`
+	SigningMethod        string            `bson:"signing_method" json:"signing_method"`
+	Audiences            []string          `bson:"audiences" json:"audiences"`
+	IdentityBaseField    string            `bson:"identity_base_field" json:"identity_base_field"`
+	ClientIDBaseField    string            `bson:"client_base_field" json:"client_base_field"`
+	PolicyFieldName      string            `bson:"policy_field_name" json:"policy_field_name"`
+	DefaultPolicies      []string          `bson:"default_policies" json:"default_policies"`
+	ScopeClaimName       string            `bson:"scope_claim_name" json:"scope_claim_name"`
+	ScopeToPolicyMapping map[string]string `bson:"scope_to_policy_mapping" json:"scope_to_policy_mapping"`
+}
+
 type GlobalRateLimit struct {
-	Rate float64 `bson:"rate" json:"rate"`
-	Per  float64 `bson:"per" json:"per"`
+	Rate      float64 `bson:"rate" json:"rate"`
+	Per       float64 `bson:"per" json:"per"`
+	QueueSize int     `bson:"queue_size" json:"queue_size"`
+	MaxWait   float64 `bson:"max_wait" json:"max_wait"`
+}
+
+// MaintenanceMeta answers all requests to an API with a fixed response while
+// it is in maintenance, instead of proxying them. It can also be toggled
+// through the API of the gateway, without reloading.
+type MaintenanceMeta struct {
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// StatusCode defaults to 503.
+	StatusCode int               `bson:"status_code" json:"status_code"`
+	Body       string            `bson:"body" json:"body"`
+	Headers    map[string]string `bson:"headers" json:"headers"`
+	// RetryAfter, in seconds, is sent as the Retry-After header if set.
+	RetryAfter int64 `bson:"retry_after" json:"retry_after"`
+}
+
+// ConcurrencyLimit caps the requests to an API in flight at once on each
+// gateway. Requests over it wait in a queue of QueueSize for up to MaxWait
+// seconds, or are rejected when there's no queue.
+type ConcurrencyLimit struct {
+	MaxRequests int     `bson:"max_requests" json:"max_requests"`
+	QueueSize   int     `bson:"queue_size" json:"queue_size"`
+	MaxWait     float64 `bson:"max_wait" json:"max_wait"`
+	// Adaptive limits the requests to each upstream host by how well it
+	// copes with them.
+	Adaptive AdaptiveConcurrencyMeta `bson:"adaptive" json:"adaptive"`
+}
+
+// AdaptiveConcurrencyMeta limits the requests in flight to each upstream
+// host, shedding the excess with a 503. The limit grows by one while the
+// upstream keeps up with it, and is cut by Backoff when its latency or error
+// rate climbs.
+type AdaptiveConcurrencyMeta struct {
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// InitialLimit defaults to 20, MinLimit to 1 and MaxLimit to 1000.
+	InitialLimit int64 `bson:"initial_limit" json:"initial_limit"`
+	MinLimit     int64 `bson:"min_limit" json:"min_limit"`
+	MaxLimit     int64 `bson:"max_limit" json:"max_limit"`
+	// LatencyThreshold is the average response time, in milliseconds, above
+	// which the limit is cut.
+	LatencyThreshold int64 `bson:"latency_threshold" json:"latency_threshold"`
+	// ErrorRateThreshold is the fraction of 5xx responses and failed
+	// requests, from 0 to 1, above which the limit is cut. It defaults to 0.1.
+	ErrorRateThreshold float64 `bson:"error_rate_threshold" json:"error_rate_threshold"`
+	// Backoff is what the limit is multiplied by when cut, 0.9 by default.
+	Backoff float64 `bson:"backoff" json:"backoff"`
+	// RetryAfter is the Retry-After sent with shed requests, in seconds, 1 by
+	// default.
+	RetryAfter int64 `bson:"retry_after" json:"retry_after"`
+}
+
+// DPoPMeta configures proof of possession of tokens with DPoP proofs, as of
+// RFC 9449. Tokens bound to a key are only accepted along with a proof signed
+// by it, and Required rejects requests without proof altogether. Proofs are
+// accepted for ProofLifetime seconds after they were created.
+type DPoPMeta struct {
+	Enabled       bool  `bson:"enabled" json:"enabled"`
+	Required      bool  `bson:"required" json:"required"`
+	ProofLifetime int64 `bson:"proof_lifetime" json:"proof_lifetime"`
 }
 
 type BundleManifest struct {
@@ -504,6 +899,221 @@ type RequestSigningMeta struct {
 	Algorithm string `bson:"algorithm" json:"algorithm"`
 }
 
+// CertificateValidationMeta configures how mutual TLS client certificates
+// are checked. By default only certificates listed in ClientCertificates are allowed.
+type CertificateValidationMeta struct {
+	VerifyChain          bool     `bson:"verify_chain" json:"verify_chain"`
+	Intermediates        []string `bson:"intermediates" json:"intermediates"`
+	UsePeerIntermediates bool     `bson:"use_peer_intermediates" json:"use_peer_intermediates"`
+	CheckExpiry          bool     `bson:"check_expiry" json:"check_expiry"`
+	SkipKeyUsageCheck    bool     `bson:"skip_key_usage_check" json:"skip_key_usage_check"`
+	// SubjectRules allow only certificates matching any of the rules.
+	SubjectRules []CertificateSubjectRule `bson:"subject_rules" json:"subject_rules"`
+	// SPIFFEIDs allow SPIFFE SVIDs of the gateway trust domain with matching
+	// IDs or trust domains.
+	SPIFFEIDs []string `bson:"spiffe_ids" json:"spiffe_ids"`
+	// SessionMapping authenticates validated client certificates with the
+	// keys created for them, so rate limits, quotas and policies of the key
+	// apply to the client.
+	SessionMapping bool `bson:"session_mapping" json:"session_mapping"`
+}
+
+// HedgingMeta sends a second attempt of GET and HEAD requests, to another
+// target of load balanced APIs, once the upstream takes longer to answer than
+// the Percentile of its recent response times. Whichever answers first is
+// used, and the other attempt is cancelled.
+type HedgingMeta struct {
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// Percentile is a fraction, 0.95 by default.
+	Percentile float64 `bson:"percentile" json:"percentile"`
+	// MinDelay is the least time to wait for before hedging, in
+	// milliseconds. It is also the delay until enough response times are
+	// known; without it, requests are not hedged until then.
+	MinDelay int64 `bson:"min_delay" json:"min_delay"`
+}
+
+const (
+	LoadBalancingRoundRobin       = "round_robin"
+	LoadBalancingWeighted         = "weighted"
+	LoadBalancingLeastConnections = "least_connections"
+	LoadBalancingConsistentHash   = "consistent_hash"
+)
+
+// LoadBalancingMeta configures how a target is picked for each request to
+// load balanced APIs.
+type LoadBalancingMeta struct {
+	// Strategy is "round_robin" (default), "weighted" for a weighted round
+	// robin, "least_connections" for the target with the fewest requests
+	// in flight relative to its weight, or "consistent_hash" for sticky
+	// targets picked by hashing requests onto a ring of the targets.
+	Strategy string `bson:"strategy" json:"strategy"`
+	// HashOn is what requests are hashed by with the consistent hash
+	// strategy: "ip" (default) for the client IP, "key" for the API key, or
+	// "header" or "cookie" for the one named HashKey. Requests without it
+	// are balanced by round robin.
+	HashOn  string `bson:"hash_on" json:"hash_on"`
+	HashKey string `bson:"hash_key" json:"hash_key"`
+	// Targets replace the target_list when set, with weights and
+	// priorities.
+	Targets []LoadBalancingTarget `bson:"targets" json:"targets"`
+}
+
+// LoadBalancingTarget is a target with a weight, 1 by default. Targets of the
+// lowest priority are used first, the others are failover tiers used once
+// all targets of lower priorities are down.
+type LoadBalancingTarget struct {
+	URL      string `bson:"url" json:"url"`
+	Weight   int    `bson:"weight" json:"weight"`
+	Priority int    `bson:"priority" json:"priority"`
+}
+
+// UpstreamHealthCheckMeta probes each load balanced target of the API,
+// ejecting it from the balancer after UnhealthyThreshold failed probes in a
+// row, and admitting it back after HealthyThreshold successful ones.
+type UpstreamHealthCheckMeta struct {
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// Type is "http" (default) to request Path of the target, or "tcp" to
+	// only connect to it.
+	Type string `bson:"type" json:"type"`
+	Path string `bson:"path" json:"path"`
+	// StatusCodes are the healthy statuses of HTTP probes, any under 400 by
+	// default.
+	StatusCodes []int `bson:"status_codes" json:"status_codes"`
+	// Interval between probes and Timeout of each are in seconds, 10 and 5
+	// by default.
+	Interval int64 `bson:"interval" json:"interval"`
+	Timeout  int64 `bson:"timeout" json:"timeout"`
+	// HealthyThreshold is 2, and UnhealthyThreshold 3, by default.
+	HealthyThreshold   int `bson:"healthy_threshold" json:"healthy_threshold"`
+	UnhealthyThreshold int `bson:"unhealthy_threshold" json:"unhealthy_threshold"`
+}
+
+// RetryMeta retries requests the upstream failed to answer, waiting for an
+// exponential backoff with jitter between attempts. Requests are retried on
+// the listed status codes and errors if their method is idempotent, and only
+// on connection failures otherwise.
+type RetryMeta struct {
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// Attempts is how many times a request may be retried, 1 by default.
+	Attempts int `bson:"attempts" json:"attempts"`
+	// Backoff is the delay before the first retry, in milliseconds, 25 by
+	// default. It doubles with each retry, up to MaxBackoff, 1000 by default.
+	Backoff    int64 `bson:"backoff" json:"backoff"`
+	MaxBackoff int64 `bson:"max_backoff" json:"max_backoff"`
+	// StatusCodes are retried, 502, 503 and 504 by default.
+	StatusCodes []int `bson:"status_codes" json:"status_codes"`
+	// Errors are the kinds of errors retried: "connect", "reset" and
+	// "timeout". Connection failures and resets are retried by default.
+	Errors []string `bson:"errors" json:"errors"`
+	// PerTryTimeout cancels each attempt after it, in milliseconds.
+	PerTryTimeout int64           `bson:"per_try_timeout" json:"per_try_timeout"`
+	Budget        RetryBudgetMeta `bson:"budget" json:"budget"`
+}
+
+// RetryBudgetMeta caps retries so they can not amplify an outage: over a
+// rolling window of 10 seconds, retries may not exceed Ratio of the requests
+// proxied, nor MinPerSecond retries per second if more.
+type RetryBudgetMeta struct {
+	// Ratio is a fraction, 0.2 by default.
+	Ratio        float64 `bson:"ratio" json:"ratio"`
+	MinPerSecond int     `bson:"min_per_second" json:"min_per_second"`
+}
+
+// MirrorMeta copies a share of the requests to a shadow upstream, in the
+// background. Its responses are discarded, and recorded in analytics with
+// Tag, "mirror" by default.
+type MirrorMeta struct {
+	Enabled   bool   `bson:"enabled" json:"enabled"`
+	TargetURL string `bson:"target_url" json:"target_url"`
+	// Percentage of the requests mirrored, all of them by default.
+	Percentage float64 `bson:"percentage" json:"percentage"`
+	// Timeout of the mirrored requests, in seconds, 10 by default.
+	Timeout int64  `bson:"timeout" json:"timeout"`
+	Tag     string `bson:"tag" json:"tag"`
+}
+
+// ForwardedCertMeta configures X-Forwarded-Client-Cert header sent to the
+// upstream, in the format used by Envoy, with details of the client
+// certificate the gateway terminated mutual TLS with.
+type ForwardedCertMeta struct {
+	Enabled bool `bson:"enabled" json:"enabled"`
+	// Mode is "sanitize_set" (default) to replace the header sent by the
+	// client, or "append_forward" to append to it, when the gateway is behind
+	// a trusted proxy setting the header.
+	Mode string `bson:"mode" json:"mode"`
+	// Details are parts included besides the certificate hash: "subject",
+	// "uri", "dns", "cert" and "chain".
+	Details []string `bson:"details" json:"details"`
+}
+
+// TLSPolicyMeta restricts TLS parameters negotiated with clients. Zero values
+// keep the listener defaults.
+type TLSPolicyMeta struct {
+	MinVersion uint16   `bson:"min_version" json:"min_version"`
+	MaxVersion uint16   `bson:"max_version" json:"max_version"`
+	Ciphers    []string `bson:"ssl_ciphers" json:"ssl_ciphers"`
+	// Curves are key exchange curves in order of preference: "X25519",
+	// "P-256", "P-384" and "P-521".
+	Curves []string `bson:"curves" json:"curves"`
+	// ALPNProtocols are application protocols offered to clients, e.g. "h2"
+	// and "http/1.1".
+	ALPNProtocols []string `bson:"alpn_protocols" json:"alpn_protocols"`
+}
+
+// GraphQLMeta enables checks of GraphQL queries sent to the API. Limits apply
+// to keys without their own GraphQL limits, 0 means no limit.
+type GraphQLMeta struct {
+	Enabled       bool `bson:"enabled" json:"enabled"`
+	MaxDepth      int  `bson:"max_depth" json:"max_depth"`
+	MaxComplexity int  `bson:"max_complexity" json:"max_complexity"`
+	MaxAliases    int  `bson:"max_aliases" json:"max_aliases"`
+}
+
+// GeoIPAccess allows and blocks requests by their location in the GeoIP
+// database. Locations are ISO country codes, like "US", or ISO region codes,
+// like "US-CA". Requests from blocked locations are denied, as are requests
+// from any other location than allowed ones when some are.
+type GeoIPAccess struct {
+	Enabled bool     `bson:"enabled" json:"enabled"`
+	Allowed []string `bson:"allowed" json:"allowed"`
+	Blocked []string `bson:"blocked" json:"blocked"`
+}
+
+// GRPCMeta enables proxying of gRPC calls only. Methods holds limits of
+// methods, keyed by "package.Service/Method", or "package.Service/*" for all
+// methods of a service.
+type GRPCMeta struct {
+	Enabled bool                      `bson:"enabled" json:"enabled"`
+	Methods map[string]GRPCMethodMeta `bson:"methods" json:"methods"`
+}
+
+// GRPCMethodMeta limits calls of a gRPC method, per key. 0 means no limit.
+type GRPCMethodMeta struct {
+	Rate             float64 `bson:"rate" json:"rate"`
+	Per              float64 `bson:"per" json:"per"`
+	QuotaMax         int64   `bson:"quota_max" json:"quota_max"`
+	QuotaRenewalRate int64   `bson:"quota_renewal_rate" json:"quota_renewal_rate"`
+}
+
+// WebSocketMeta limits messages sent by clients over WebSocket connections.
+// MaxMessageSize is in bytes and IdleTimeout in seconds, 0 means no limit.
+// With CountMessagesInQuota every message counts against the key quota, as
+// requests do.
+type WebSocketMeta struct {
+	MaxMessageSize       int64 `bson:"max_message_size" json:"max_message_size"`
+	IdleTimeout          int   `bson:"idle_timeout" json:"idle_timeout"`
+	CountMessagesInQuota bool  `bson:"count_messages_in_quota" json:"count_messages_in_quota"`
+}
+
+// CertificateSubjectRule matches client certificate subject fields and
+// subject alternative names. Values may contain * wildcards.
+type CertificateSubjectRule struct {
+	CommonName         string `bson:"common_name" json:"common_name"`
+	Organization       string `bson:"organization" json:"organization"`
+	OrganizationalUnit string `bson:"organizational_unit" json:"organizational_unit"`
+	SAN                string `bson:"san" json:"san"`
+}
+
 // Clean will URL encode map[string]struct variables for saving
 func (a *APIDefinition) EncodeForDB() {
 	newVersion := make(map[string]VersionInfo)
@@ -5,9 +5,17 @@ import (
 	"sync"
 )
 
+// HostWeight is the weight and priority of a host of a HostList, as
+// configured by LoadBalancingTarget.
+type HostWeight struct {
+	Weight   int
+	Priority int
+}
+
 type HostList struct {
-	hMutex sync.RWMutex
-	hosts  []string
+	hMutex  sync.RWMutex
+	hosts   []string
+	weights []HostWeight
 }
 
 func NewHostList() *HostList {
@@ -22,11 +30,52 @@ func NewHostListFromList(newList []string) *HostList {
 	return hl
 }
 
+// NewHostListFromTargets returns the list of the URLs of targets, with their
+// weights and priorities.
+func NewHostListFromTargets(targets []LoadBalancingTarget) *HostList {
+	hosts := make([]string, len(targets))
+	weights := make([]HostWeight, len(targets))
+	for i, target := range targets {
+		hosts[i] = target.URL
+		weights[i] = HostWeight{Weight: target.Weight, Priority: target.Priority}
+	}
+	hl := NewHostListFromList(hosts)
+	hl.SetWeights(weights)
+	return hl
+}
+
 func (h *HostList) Set(newList []string) {
 	h.hMutex.Lock()
 	defer h.hMutex.Unlock()
 
 	h.hosts = newList
+	h.weights = nil
+}
+
+// SetWeights sets the weights of the hosts, in the same order.
+func (h *HostList) SetWeights(weights []HostWeight) {
+	h.hMutex.Lock()
+	defer h.hMutex.Unlock()
+
+	h.weights = weights
+}
+
+// Weighted returns the hosts and their weights. Weights default to 1, and
+// priorities to 0.
+func (h *HostList) Weighted() ([]string, []HostWeight) {
+	h.hMutex.RLock()
+	defer h.hMutex.RUnlock()
+
+	weights := make([]HostWeight, len(h.hosts))
+	for i := range weights {
+		if i < len(h.weights) {
+			weights[i] = h.weights[i]
+		}
+		if weights[i].Weight <= 0 {
+			weights[i].Weight = 1
+		}
+	}
+	return h.hosts, weights
 }
 
 func (h *HostList) All() []string {
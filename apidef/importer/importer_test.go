@@ -2,7 +2,12 @@ package importer
 
 import (
 	"bytes"
+	"encoding/json"
 	"testing"
+
+	"github.com/TykTechnologies/gojsonschema"
+
+	"github.com/TykTechnologies/tyk/apidef"
 )
 
 func TestToAPIDefinition_Swagger(t *testing.T) {
@@ -41,8 +46,207 @@ func TestToAPIDefinition_Swagger(t *testing.T) {
 		t.Fatalf("Expected 3 endpoints, found %v\n", len(v.ExtendedPaths.TrackEndpoints))
 	}
 
+	testValidateJSON(t, v.ExtendedPaths.ValidateJSON, "/pets", `{"id": 1, "name": "Rex"}`, `{"id": "1"}`)
+}
+
+func TestToAPIDefinition_OpenAPI(t *testing.T) {
+	imp, err := GetImporterForSource(SwaggerSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := imp.LoadFrom(bytes.NewBufferString(petstoreOpenAPIJSON)); err != nil {
+		t.Fatal(err)
+	}
+
+	def, err := imp.ToAPIDefinition("testOrg", "http://test.com", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := def.VersionData.Versions["1.0.0"]
+	if len(v.ExtendedPaths.TrackEndpoints) != 2 {
+		t.Fatalf("Expected 2 endpoints, found %v", len(v.ExtendedPaths.TrackEndpoints))
+	}
+
+	testValidateJSON(t, v.ExtendedPaths.ValidateJSON, "/pets/{petId}", `{"name": "Rex", "tags": ["dog"]}`, `{"tags": [1]}`)
 }
 
+func TestToAPIDefinition_Security(t *testing.T) {
+	for scheme, check := range map[string]func(def *apidef.APIDefinition) bool{
+		`{"type": "apiKey", "in": "query", "name": "key"}`: func(def *apidef.APIDefinition) bool {
+			return def.UseStandardAuth && def.Auth.UseParam && def.Auth.ParamName == "key"
+		},
+		`{"type": "http", "scheme": "Basic"}`: func(def *apidef.APIDefinition) bool {
+			return def.UseBasicAuth
+		},
+		`{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"}`: func(def *apidef.APIDefinition) bool {
+			return def.EnableJWT
+		},
+		`{"type": "oauth2"}`: func(def *apidef.APIDefinition) bool {
+			return def.UseKeylessAccess
+		},
+	} {
+		imp := &SwaggerAST{}
+		doc := `{
+			"info": {"version": "1"},
+			"paths": {"/": {"get": {"operationId": "get"}}},
+			"security": [{"auth": []}],
+			"components": {"securitySchemes": {"auth": ` + scheme + `}}
+		}`
+		if err := imp.LoadFrom(bytes.NewBufferString(doc)); err != nil {
+			t.Fatal(err)
+		}
+		def, err := imp.ToAPIDefinition("testOrg", "", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !check(def) || def.UseKeylessAccess != (scheme == `{"type": "oauth2"}`) {
+			t.Errorf("Unexpected auth for scheme %s", scheme)
+		}
+	}
+}
+
+func TestToAPIDefinition_Mock(t *testing.T) {
+	imp := &SwaggerAST{}
+	doc := `{
+		"openapi": "3.0.0",
+		"info": {"version": "1"},
+		"paths": {
+			"/pets": {
+				"get": {"responses": {
+					"200": {"content": {
+						"text/plain": {"example": "Rex"},
+						"application/json": {"examples": {
+							"one": {"value": [{"name": "Rex"}]},
+							"two": {"value": []}
+						}}
+					}},
+					"default": {"description": "Error"}
+				}},
+				"post": {"responses": {
+					"201": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Pet"}}}},
+					"400": {"description": "Invalid pet"}
+				}}
+			}
+		},
+		"components": {"schemas": {"Pet": {"type": "object"}}}
+	}`
+	if err := imp.LoadFrom(bytes.NewBufferString(doc)); err != nil {
+		t.Fatal(err)
+	}
+	def, err := imp.ToAPIDefinition("testOrg", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mocks := map[string]apidef.MockResponseMeta{}
+	for _, mock := range def.VersionData.Versions["1"].ExtendedPaths.MockResponse {
+		mocks[mock.Method] = mock
+	}
+	if len(mocks) != 2 {
+		t.Fatalf("Expected both operations to be mocked, got %+v", mocks)
+	}
+
+	get := mocks["GET"]
+	if get.Code != 200 || get.Headers["Content-Type"] != "application/json" {
+		t.Errorf("Expected the JSON 200 response to be mocked, got %+v", get)
+	}
+	if example, _ := json.Marshal(get.Example); string(example) != `[{"name":"Rex"}]` {
+		t.Errorf("Expected the first example, got %s", example)
+	}
+
+	post := mocks["POST"]
+	if post.Code != 201 || post.Example != nil || post.Schema["$ref"] != "#/components/schemas/Pet" || post.Schema["components"] == nil {
+		t.Errorf("Expected the 201 response to be mocked from its schema, got %+v", post)
+	}
+}
+
+// testValidateJSON checks that an operation validates request bodies against
+// its schema, references included.
+func testValidateJSON(t *testing.T, paths []apidef.ValidatePathMeta, path, valid, invalid string) {
+	t.Helper()
+
+	if len(paths) != 1 || paths[0].Path != path || paths[0].Method != "POST" {
+		t.Fatalf("Expected the request body of POST %s to be validated, got %+v", path, paths)
+	}
+
+	schema := gojsonschema.NewGoLoader(paths[0].Schema)
+	result, err := gojsonschema.Validate(schema, gojsonschema.NewStringLoader(valid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Valid() {
+		t.Errorf("Expected %s to be valid, got %v", valid, result.Errors())
+	}
+
+	result, err = gojsonschema.Validate(schema, gojsonschema.NewStringLoader(invalid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Valid() {
+		t.Errorf("Expected %s to be invalid", invalid)
+	}
+}
+
+var petstoreOpenAPIJSON = `{
+  "openapi": "3.0.0",
+  "info": {
+    "version": "1.0.0",
+    "title": "Swagger Petstore"
+  },
+  "paths": {
+    "/pets/{petId}": {
+      "get": {
+        "operationId": "showPetById",
+        "responses": {
+          "200": {
+            "description": "Expected response to a valid request"
+          }
+        }
+      },
+      "post": {
+        "operationId": "updatePet",
+        "requestBody": {
+          "content": {
+            "application/json": {
+              "schema": {
+                "$ref": "#/components/schemas/NewPet"
+              }
+            }
+          }
+        },
+        "responses": {
+          "200": {
+            "description": "Updated pet"
+          }
+        }
+      }
+    }
+  },
+  "components": {
+    "schemas": {
+      "NewPet": {
+        "type": "object",
+        "required": ["name"],
+        "properties": {
+          "name": {
+            "type": "string"
+          },
+          "tags": {
+            "$ref": "#/components/schemas/Tags"
+          }
+        }
+      },
+      "Tags": {
+        "type": "array",
+        "items": {
+          "type": "string"
+        }
+      }
+    }
+  }
+}`
+
 var petstoreJSON string = `{
   "swagger": "2.0",
   "info": {
@@ -108,6 +312,16 @@ var petstoreJSON string = `{
         "tags": [
           "pets"
         ],
+        "parameters": [
+          {
+            "name": "pet",
+            "in": "body",
+            "required": true,
+            "schema": {
+              "$ref": "#/definitions/Pet"
+            }
+          }
+        ],
         "responses": {
           "201": {
             "description": "Null response"
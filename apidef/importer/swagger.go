@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 
 	uuid "github.com/satori/go.uuid"
@@ -26,18 +29,67 @@ type DefinitionObjectAST struct {
 
 type ResponseCodeObjectAST struct {
 	Description string `json:"description"`
-	Schema      struct {
-		Items map[string]interface{} `json:"items"`
-		Type  string                 `json:"type"`
-	} `json:"schema"`
+	// Schema and Examples, by media type, are those of Swagger 2.0 documents
+	Schema   map[string]interface{} `json:"schema"`
+	Examples map[string]interface{} `json:"examples"`
+	// Content is that of OpenAPI 3 documents, by media type
+	Content map[string]MediaTypeObjectAST `json:"content"`
+}
+
+// MediaTypeObjectAST is the content of an OpenAPI 3 response for a media
+// type.
+type MediaTypeObjectAST struct {
+	Schema   map[string]interface{} `json:"schema"`
+	Example  interface{}            `json:"example"`
+	Examples map[string]struct {
+		Value interface{} `json:"value"`
+	} `json:"examples"`
+}
+
+// ParameterObjectAST is a parameter of an operation. Body parameters of
+// Swagger 2.0 documents carry the schema of the request body.
+type ParameterObjectAST struct {
+	Name   string                 `json:"name"`
+	In     string                 `json:"in"`
+	Schema map[string]interface{} `json:"schema"`
+}
+
+// RequestBodyObjectAST is the request body of an OpenAPI 3 operation, by
+// media type.
+type RequestBodyObjectAST struct {
+	Content map[string]struct {
+		Schema map[string]interface{} `json:"schema"`
+	} `json:"content"`
 }
 
 type PathMethodObject struct {
 	Description string                           `json:"description"`
 	OperationID string                           `json:"operationId"`
+	Parameters  []ParameterObjectAST             `json:"parameters"`
+	RequestBody RequestBodyObjectAST             `json:"requestBody"`
 	Responses   map[string]ResponseCodeObjectAST `json:"responses"`
 }
 
+// requestSchema returns the JSON Schema of the request body of an operation,
+// nil if it has none.
+func (m PathMethodObject) requestSchema() map[string]interface{} {
+	for _, param := range m.Parameters {
+		if param.In == "body" && param.Schema != nil {
+			return param.Schema
+		}
+	}
+
+	if media, ok := m.RequestBody.Content["application/json"]; ok && media.Schema != nil {
+		return media.Schema
+	}
+	for mediaType, media := range m.RequestBody.Content {
+		if strings.HasSuffix(mediaType, "+json") && media.Schema != nil {
+			return media.Schema
+		}
+	}
+	return nil
+}
+
 type PathItemObject struct {
 	Get     PathMethodObject `json:"get"`
 	Put     PathMethodObject `json:"put"`
@@ -48,11 +100,25 @@ type PathItemObject struct {
 	Head    PathMethodObject `json:"head"`
 }
 
+// SecuritySchemeAST is a security scheme of an OpenAPI 3 document, or a
+// security definition of a Swagger 2.0 document.
+type SecuritySchemeAST struct {
+	Type         string `json:"type"`
+	Name         string `json:"name"`
+	In           string `json:"in"`
+	Scheme       string `json:"scheme"`
+	BearerFormat string `json:"bearerFormat"`
+}
+
 type SwaggerAST struct {
-	BasePath    string                         `json:"basePath"`
-	Consumes    []string                       `json:"consumes"`
-	Definitions map[string]DefinitionObjectAST `json:"definitions"`
-	Host        string                         `json:"host"`
+	BasePath   string `json:"basePath"`
+	Components struct {
+		Schemas         map[string]interface{}       `json:"schemas"`
+		SecuritySchemes map[string]SecuritySchemeAST `json:"securitySchemes"`
+	} `json:"components"`
+	Consumes    []string               `json:"consumes"`
+	Definitions map[string]interface{} `json:"definitions"`
+	Host        string                 `json:"host"`
 	Info        struct {
 		Contact struct {
 			Email string `json:"email"`
@@ -68,26 +134,49 @@ type SwaggerAST struct {
 		Title          string `json:"title"`
 		Version        string `json:"version"`
 	} `json:"info"`
-	Paths    map[string]PathItemObject `json:"paths"`
-	Produces []string                  `json:"produces"`
-	Schemes  []string                  `json:"schemes"`
-	Swagger  string                    `json:"swagger"`
+	OpenAPI             string                       `json:"openapi"`
+	Paths               map[string]PathItemObject    `json:"paths"`
+	Produces            []string                     `json:"produces"`
+	Schemes             []string                     `json:"schemes"`
+	Security            []map[string][]string        `json:"security"`
+	SecurityDefinitions map[string]SecuritySchemeAST `json:"securityDefinitions"`
+	Servers             []struct {
+		URL string `json:"url"`
+	} `json:"servers"`
+	Swagger string `json:"swagger"`
 }
 
 func (s *SwaggerAST) LoadFrom(r io.Reader) error {
 	return json.NewDecoder(r).Decode(&s)
 }
 
+// validationSchema makes the schema of a request body self-contained, with
+// the definitions or the component schemas of the document its references
+// point to.
+func (s *SwaggerAST) validationSchema(schema map[string]interface{}) map[string]interface{} {
+	validation := make(map[string]interface{}, len(schema)+2)
+	for key, value := range schema {
+		validation[key] = value
+	}
+	if len(s.Definitions) > 0 {
+		validation["definitions"] = s.Definitions
+	}
+	if len(s.Components.Schemas) > 0 {
+		validation["components"] = map[string]interface{}{"schemas": s.Components.Schemas}
+	}
+	return validation
+}
+
 func (s *SwaggerAST) ConvertIntoApiVersion(asMock bool) (apidef.VersionInfo, error) {
 	versionInfo := apidef.VersionInfo{}
 
-	if asMock {
-		return versionInfo, errors.New("Swagger mocks not supported")
-	}
-
 	versionInfo.UseExtendedPaths = true
 	versionInfo.Name = s.Info.Version
 	versionInfo.ExtendedPaths.TrackEndpoints = make([]apidef.TrackEndpointMeta, 0)
+	versionInfo.ExtendedPaths.ValidateJSON = make([]apidef.ValidatePathMeta, 0)
+	if asMock {
+		versionInfo.ExtendedPaths.MockResponse = make([]apidef.MockResponseMeta, 0)
+	}
 
 	if len(s.Paths) == 0 {
 		return versionInfo, errors.New("no paths defined in swagger file")
@@ -96,7 +185,7 @@ func (s *SwaggerAST) ConvertIntoApiVersion(asMock bool) (apidef.VersionInfo, err
 		newEndpointMeta := apidef.TrackEndpointMeta{}
 		newEndpointMeta.Path = pathName
 
-		// We just want the paths here, no mocks
+		// We just want the paths here
 		methods := map[string]PathMethodObject{
 			"GET":     pathSpec.Get,
 			"PUT":     pathSpec.Put,
@@ -108,24 +197,169 @@ func (s *SwaggerAST) ConvertIntoApiVersion(asMock bool) (apidef.VersionInfo, err
 		}
 		for methodName, m := range methods {
 			// skip methods that are not defined
-			if len(m.Responses) == 0 && m.Description == "" && m.OperationID == "" {
+			if len(m.Responses) == 0 && m.Description == "" && m.OperationID == "" && m.requestSchema() == nil {
 				continue
 			}
 
 			newEndpointMeta.Method = methodName
 			versionInfo.ExtendedPaths.TrackEndpoints = append(versionInfo.ExtendedPaths.TrackEndpoints, newEndpointMeta)
+
+			// Validate request bodies against the schema of the operation
+			if schema := m.requestSchema(); schema != nil {
+				versionInfo.ExtendedPaths.ValidateJSON = append(versionInfo.ExtendedPaths.ValidateJSON, apidef.ValidatePathMeta{
+					Path:   pathName,
+					Method: methodName,
+					Schema: s.validationSchema(schema),
+				})
+			}
+
+			if asMock {
+				versionInfo.ExtendedPaths.MockResponse = append(versionInfo.ExtendedPaths.MockResponse, s.mockResponse(pathName, methodName, m))
+			}
 		}
 	}
 
 	return versionInfo, nil
 }
 
+// mockResponse mocks an operation with its lowest 2xx response, or with its
+// default one, preferring JSON content. The body is the example of the
+// response if it has one, generated from its schema otherwise.
+func (s *SwaggerAST) mockResponse(path, method string, op PathMethodObject) apidef.MockResponseMeta {
+	mock := apidef.MockResponseMeta{Path: path, Method: method, Code: http.StatusOK}
+
+	status := ""
+	for code := range op.Responses {
+		n, err := strconv.Atoi(code)
+		if err != nil || n < 200 || n > 299 {
+			continue
+		}
+		if status == "" || n < mock.Code {
+			status, mock.Code = code, n
+		}
+	}
+	if status == "" {
+		status = "default"
+	}
+	response, ok := op.Responses[status]
+	if !ok {
+		return mock
+	}
+
+	if len(response.Content) > 0 {
+		mediaTypes := make([]string, 0, len(response.Content))
+		for mediaType := range response.Content {
+			mediaTypes = append(mediaTypes, mediaType)
+		}
+		mediaType := jsonMediaType(mediaTypes)
+		media := response.Content[mediaType]
+		mock.Headers = map[string]string{"Content-Type": mediaType}
+		mock.Example = media.Example
+		if mock.Example == nil && len(media.Examples) > 0 {
+			names := make([]string, 0, len(media.Examples))
+			for name := range media.Examples {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			mock.Example = media.Examples[names[0]].Value
+		}
+		if media.Schema != nil {
+			mock.Schema = s.validationSchema(media.Schema)
+		}
+		return mock
+	}
+
+	if len(response.Examples) > 0 {
+		mediaTypes := make([]string, 0, len(response.Examples))
+		for mediaType := range response.Examples {
+			mediaTypes = append(mediaTypes, mediaType)
+		}
+		mediaType := jsonMediaType(mediaTypes)
+		mock.Headers = map[string]string{"Content-Type": mediaType}
+		mock.Example = response.Examples[mediaType]
+	}
+	if response.Schema != nil {
+		mock.Schema = s.validationSchema(response.Schema)
+	}
+	return mock
+}
+
+// jsonMediaType returns the JSON one of mediaTypes, or the first of them if
+// none is JSON.
+func jsonMediaType(mediaTypes []string) string {
+	sort.Strings(mediaTypes)
+	for _, mediaType := range mediaTypes {
+		if mediaType == "application/json" {
+			return mediaType
+		}
+	}
+	for _, mediaType := range mediaTypes {
+		if strings.HasSuffix(mediaType, "+json") {
+			return mediaType
+		}
+	}
+	return mediaTypes[0]
+}
+
 func (s *SwaggerAST) InsertIntoAPIDefinitionAsVersion(version apidef.VersionInfo, def *apidef.APIDefinition, versionName string) error {
 	def.VersionData.NotVersioned = false
 	def.VersionData.Versions[versionName] = version
 	return nil
 }
 
+// setAuth protects an API with the first security scheme the document
+// requires which the gateway supports, keeping it keyless if none. Schemes
+// only need further settings of the API, like the source of JWT keys.
+func (s *SwaggerAST) setAuth(def *apidef.APIDefinition) {
+	schemes := s.SecurityDefinitions
+	if len(s.Components.SecuritySchemes) > 0 {
+		schemes = s.Components.SecuritySchemes
+	}
+
+	for _, requirement := range s.Security {
+		names := make([]string, 0, len(requirement))
+		for name := range requirement {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			scheme, ok := schemes[name]
+			if !ok {
+				continue
+			}
+
+			httpScheme := strings.ToLower(scheme.Scheme)
+			switch {
+			case scheme.Type == "apiKey":
+				def.UseStandardAuth = true
+				switch scheme.In {
+				case "query":
+					def.Auth.UseParam = true
+					def.Auth.ParamName = scheme.Name
+				case "cookie":
+					def.Auth.UseCookie = true
+					def.Auth.CookieName = scheme.Name
+				default:
+					def.Auth.AuthHeaderName = scheme.Name
+				}
+			case scheme.Type == "basic", scheme.Type == "http" && httpScheme == "basic":
+				def.UseBasicAuth = true
+			case scheme.Type == "http" && httpScheme == "bearer" && strings.EqualFold(scheme.BearerFormat, "JWT"):
+				def.EnableJWT = true
+			case scheme.Type == "http" && httpScheme == "bearer":
+				def.UseStandardAuth = true
+				def.Auth.AuthHeaderName = "Authorization"
+			default:
+				continue
+			}
+
+			def.UseKeylessAccess = false
+			return
+		}
+	}
+}
+
 func (s *SwaggerAST) ToAPIDefinition(orgId, upstreamURL string, as_mock bool) (*apidef.APIDefinition, error) {
 	ad := apidef.APIDefinition{
 		Name:             s.Info.Title,
@@ -140,11 +374,12 @@ func (s *SwaggerAST) ToAPIDefinition(orgId, upstreamURL string, as_mock bool) (*
 	ad.Proxy.ListenPath = "/" + ad.APIID + "/"
 	ad.Proxy.StripListenPath = true
 	ad.Proxy.TargetURL = upstreamURL
-
-	if as_mock {
-		log.Warning("Mocks not supported for Swagger definitions, ignoring option")
+	if upstreamURL == "" && len(s.Servers) > 0 {
+		ad.Proxy.TargetURL = s.Servers[0].URL
 	}
-	versionData, err := s.ConvertIntoApiVersion(false)
+	s.setAuth(&ad)
+
+	versionData, err := s.ConvertIntoApiVersion(as_mock)
 	if err != nil {
 		return nil, err
 	}
@@ -1,10 +1,12 @@
 package importer
 
 import (
+	"encoding/base64"
 	"encoding/xml"
 	"errors"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/TykTechnologies/tyk/apidef"
@@ -30,6 +32,11 @@ const (
 	NS_HTTP   = "http://schemas.xmlsoap.org/wsdl/http/"
 )
 
+const (
+	soapEnvelopeNS   = "http://schemas.xmlsoap.org/soap/envelope/"
+	soap12EnvelopeNS = "http://www.w3.org/2003/05/soap-envelope"
+)
+
 const (
 	PROT_HTTP    = "http"
 	PROT_SOAP    = "soap"
@@ -38,11 +45,19 @@ const (
 
 type WSDLDef struct {
 	Definition WSDL `xml:"http://schemas.xmlsoap.org/wsdl/ definitions"`
+	restFacade bool
+}
+
+// SetRESTFacade makes SOAP operations REST endpoints taking JSON parameters
+// instead of proxying SOAP requests as they are.
+func (def *WSDLDef) SetRESTFacade(enable bool) {
+	def.restFacade = enable
 }
 
 type WSDL struct {
-	Services []*WSDLService `xml:"http://schemas.xmlsoap.org/wsdl/ service"`
-	Bindings []*WSDLBinding `xml:"http://schemas.xmlsoap.org/wsdl/ binding"`
+	TargetNamespace string         `xml:"targetNamespace,attr"`
+	Services        []*WSDLService `xml:"http://schemas.xmlsoap.org/wsdl/ service"`
+	Bindings        []*WSDLBinding `xml:"http://schemas.xmlsoap.org/wsdl/ binding"`
 }
 
 type WSDLService struct {
@@ -72,6 +87,7 @@ type WSDLOperation struct {
 	Name             string `xml:"name,attr"`
 	Endpoint         string
 	IsUrlReplacement bool
+	SOAPAction       string
 }
 
 func (def *WSDLDef) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
@@ -218,6 +234,12 @@ func (op *WSDLOperation) UnmarshalXML(d *xml.Decoder, start xml.StartElement) er
 					case NS_SOAP, NS_SOAP12:
 						{
 							protocol = PROT_SOAP
+							for _, attr := range t.Attr {
+								if attr.Name.Local == "soapAction" {
+									op.SOAPAction = attr.Value
+									break
+								}
+							}
 							break
 						}
 					case NS_HTTP:
@@ -396,6 +418,10 @@ func (def *WSDLDef) ConvertIntoApiVersion(bool) (apidef.VersionInfo, error) {
 					} else {
 						operationUrlRewrite.MatchPattern = path
 						operationUrlRewrite.RewriteTo = port.Address.Location
+
+						if def.restFacade {
+							def.addRESTFacade(&versionInfo, binding, op, path)
+						}
 					}
 
 					versionInfo.ExtendedPaths.URLRewrite = append(versionInfo.ExtendedPaths.URLRewrite, operationUrlRewrite)
@@ -417,9 +443,77 @@ func (def *WSDLDef) ConvertIntoApiVersion(bool) (apidef.VersionInfo, error) {
 	return versionInfo, nil
 }
 
-func (def *WSDLDef) InsertIntoAPIDefinitionAsVersion(version apidef.VersionInfo, apidef *apidef.APIDefinition, versionName string) error {
-	apidef.VersionData.NotVersioned = false
-	apidef.VersionData.Versions[versionName] = version
+// addRESTFacade makes a SOAP operation an endpoint taking its parameters as
+// a JSON object, which is templated into the SOAP envelope, and answering
+// with the body of the SOAP response as JSON. Parameters are elements of the
+// target namespace, as in the wrapped document/literal style.
+func (def *WSDLDef) addRESTFacade(versionInfo *apidef.VersionInfo, binding *WSDLBinding, op *WSDLOperation, path string) {
+	envelopeNS, contentType := soapEnvelopeNS, "text/xml; charset=utf-8"
+	requestHeaders := map[string]string{"SOAPAction": strconv.Quote(op.SOAPAction)}
+	if binding.Protocol == PROT_SOAP_12 {
+		// SOAP 1.2 moved the action to the content type
+		envelopeNS = soap12EnvelopeNS
+		contentType = "application/soap+xml; charset=utf-8; action=" + strconv.Quote(op.SOAPAction)
+		requestHeaders = map[string]string{}
+	}
+	requestHeaders["Content-Type"] = contentType
+
+	var nsBuf strings.Builder
+	xml.EscapeText(&nsBuf, []byte(def.Definition.TargetNamespace))
+	envelope := `<?xml version="1.0" encoding="utf-8"?>` +
+		`<soap:Envelope xmlns:soap="` + envelopeNS + `"><soap:Body>` +
+		`<` + op.Name + ` xmlns="` + nsBuf.String() + `">` +
+		`{{range $name, $value := .}}{{xmlMarshal (dict $name $value)}}{{end}}` +
+		`</` + op.Name + `></soap:Body></soap:Envelope>`
+
+	versionInfo.ExtendedPaths.Transform = append(versionInfo.ExtendedPaths.Transform, apidef.TemplateMeta{
+		Path:   path,
+		Method: binding.Method,
+		TemplateData: apidef.TemplateData{
+			Input:          apidef.RequestJSON,
+			Mode:           apidef.UseBlob,
+			TemplateSource: base64.StdEncoding.EncodeToString([]byte(envelope)),
+		},
+	})
+	versionInfo.ExtendedPaths.TransformHeader = append(versionInfo.ExtendedPaths.TransformHeader, apidef.HeaderInjectionMeta{
+		Path:       path,
+		Method:     binding.Method,
+		AddHeaders: requestHeaders,
+	})
+
+	unwrap := `{{with .Envelope}}{{with .Body}}{{jsonMarshal .}}{{end}}{{end}}`
+	versionInfo.ExtendedPaths.TransformResponse = append(versionInfo.ExtendedPaths.TransformResponse, apidef.TemplateMeta{
+		Path:   path,
+		Method: binding.Method,
+		TemplateData: apidef.TemplateData{
+			Input:          apidef.RequestXML,
+			Mode:           apidef.UseBlob,
+			TemplateSource: base64.StdEncoding.EncodeToString([]byte(unwrap)),
+		},
+	})
+	versionInfo.ExtendedPaths.TransformResponseHeader = append(versionInfo.ExtendedPaths.TransformResponseHeader, apidef.HeaderInjectionMeta{
+		Path:       path,
+		Method:     binding.Method,
+		AddHeaders: map[string]string{"Content-Type": "application/json"},
+	})
+}
+
+func (def *WSDLDef) InsertIntoAPIDefinitionAsVersion(version apidef.VersionInfo, apiDef *apidef.APIDefinition, versionName string) error {
+	apiDef.VersionData.NotVersioned = false
+	apiDef.VersionData.Versions[versionName] = version
+
+	if len(version.ExtendedPaths.TransformResponse) > 0 {
+		// Responses of the REST facade are transformed
+		for _, name := range []string{"response_body_transform", "header_injector"} {
+			found := false
+			for _, processor := range apiDef.ResponseProcessors {
+				found = found || processor.Name == name
+			}
+			if !found {
+				apiDef.ResponseProcessors = append(apiDef.ResponseProcessors, apidef.ResponseProcessor{Name: name})
+			}
+		}
+	}
 	return nil
 }
 
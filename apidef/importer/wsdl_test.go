@@ -2,7 +2,12 @@ package importer
 
 import (
 	"bytes"
+	"encoding/base64"
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/TykTechnologies/tyk/apidef"
 )
 
 type testWSDLInput struct {
@@ -294,6 +299,70 @@ func TestToAPIDefinition_WSDL(t *testing.T) {
 	}
 }
 
+func TestToAPIDefinition_WSDLRESTFacade(t *testing.T) {
+	for _, tc := range []struct {
+		port        string
+		headers     map[string]string
+		envelopeNS  string
+		soapVersion string
+	}{
+		{
+			port: "HolidayService2Soap",
+			headers: map[string]string{
+				"Content-Type": "text/xml; charset=utf-8",
+				"SOAPAction":   `"http://www.holidaywebservice.com/HolidayService_v2/GetHolidayDate"`,
+			},
+			envelopeNS: soapEnvelopeNS,
+		},
+		{
+			port: "HolidayService2Soap12",
+			headers: map[string]string{
+				"Content-Type": `application/soap+xml; charset=utf-8; action="http://www.holidaywebservice.com/HolidayService_v2/GetHolidayDate"`,
+			},
+			envelopeNS: soap12EnvelopeNS,
+		},
+	} {
+		t.Run(tc.port, func(t *testing.T) {
+			wsdlImp := &WSDLDef{}
+			if err := wsdlImp.LoadFrom(bytes.NewBufferString(holidayService)); err != nil {
+				t.Fatal(err)
+			}
+			wsdlImp.SetServicePortMapping(map[string]string{"HolidayService2": tc.port})
+			wsdlImp.SetRESTFacade(true)
+
+			def, err := wsdlImp.ToAPIDefinition("testOrg", "http://test.com", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			v := def.VersionData.Versions["1.0.0"]
+			paths := v.ExtendedPaths
+			if len(paths.Transform) != 6 || len(paths.TransformHeader) != 6 ||
+				len(paths.TransformResponse) != 6 || len(paths.TransformResponseHeader) != 6 {
+				t.Fatalf("Expected every operation to be transformed, got %+v", paths)
+			}
+
+			for i, transform := range paths.Transform {
+				if transform.Path != "HolidayService2/GetHolidayDate" {
+					continue
+				}
+				envelope, _ := base64.StdEncoding.DecodeString(transform.TemplateData.TemplateSource)
+				if !strings.Contains(string(envelope), `<soap:Envelope xmlns:soap="`+tc.envelopeNS+`">`) ||
+					!strings.Contains(string(envelope), `<GetHolidayDate xmlns="http://www.holidaywebservice.com/HolidayService_v2/">`) {
+					t.Errorf("Unexpected envelope template %s", envelope)
+				}
+				if !reflect.DeepEqual(paths.TransformHeader[i].AddHeaders, tc.headers) {
+					t.Errorf("Expected headers %v, got %v", tc.headers, paths.TransformHeader[i].AddHeaders)
+				}
+			}
+
+			want := []apidef.ResponseProcessor{{Name: "response_body_transform"}, {Name: "header_injector"}}
+			if !reflect.DeepEqual(def.ResponseProcessors, want) {
+				t.Errorf("Expected response processors %v, got %v", want, def.ResponseProcessors)
+			}
+		})
+	}
+}
+
 var holidayService string = `
 <?xml version="1.0" encoding="UTF-8"?>
 <wsdl:definitions xmlns:tm="http://microsoft.com/wsdl/mime/textMatching/" xmlns:soapenc="http://schemas.xmlsoap.org/soap/encoding/" xmlns:mime="http://schemas.xmlsoap.org/wsdl/mime/" xmlns:tns="http://www.holidaywebservice.com/HolidayService_v2/" xmlns:soap="http://schemas.xmlsoap.org/wsdl/soap/" xmlns:s="http://www.w3.org/2001/XMLSchema" xmlns:soap12="http://schemas.xmlsoap.org/wsdl/soap12/" xmlns:http="http://schemas.xmlsoap.org/wsdl/http/" targetNamespace="http://www.holidaywebservice.com/HolidayService_v2/" xmlns:wsdl="http://schemas.xmlsoap.org/wsdl/">
@@ -114,6 +114,36 @@ const Schema = `{
         "jwt_scope_claim_name": {
             "type": "string"
         },
+        "jwt_issuers": {
+            "type": ["array", "null"],
+            "items": {
+                "type": "object",
+                "properties": {
+                    "issuer": {
+                        "type": "string"
+                    },
+                    "source": {
+                        "type": "string"
+                    },
+                    "certificate_id": {
+                        "type": "string"
+                    },
+                    "signing_method": {
+                        "type": "string"
+                    },
+                    "audiences": {
+                        "type": ["array", "null"]
+                    },
+                    "default_policies": {
+                        "type": ["array", "null"]
+                    },
+                    "scope_to_policy_mapping": {
+                        "type": ["object", "null"]
+                    }
+                },
+                "required": ["issuer"]
+            }
+        },
         "use_keyless": {
             "type": "boolean"
         },
@@ -126,6 +156,48 @@ const Schema = `{
         "client_certificates": {
             "type": ["array", "null"]
         },
+        "client_certificate_validation": {
+            "type": ["object", "null"]
+        },
+        "forward_client_certificate": {
+            "type": ["object", "null"]
+        },
+        "tls_policy": {
+            "type": ["object", "null"]
+        },
+        "graphql": {
+            "type": ["object", "null"],
+            "properties": {
+                "max_depth": {"type": "integer", "minimum": 0},
+                "max_complexity": {"type": "integer", "minimum": 0},
+                "max_aliases": {"type": "integer", "minimum": 0}
+            }
+        },
+        "websocket": {
+            "type": ["object", "null"],
+            "properties": {
+                "max_message_size": {"type": "integer", "minimum": 0},
+                "idle_timeout": {"type": "integer", "minimum": 0},
+                "count_messages_in_quota": {"type": "boolean"}
+            }
+        },
+        "grpc": {
+            "type": ["object", "null"],
+            "properties": {
+                "methods": {
+                    "type": ["object", "null"],
+                    "additionalProperties": {
+                        "type": "object",
+                        "properties": {
+                            "rate": {"type": "number", "minimum": 0},
+                            "per": {"type": "number", "minimum": 0},
+                            "quota_max": {"type": "integer"},
+                            "quota_renewal_rate": {"type": "integer"}
+                        }
+                    }
+                }
+            }
+        },
         "upstream_certificates": {
             "type": ["object", "null"]
         },
@@ -138,6 +210,26 @@ const Schema = `{
         "blacklisted_ips": {
             "type": ["array", "null"]
         },
+        "allowed_ip_lists": {
+            "type": ["array", "null"]
+        },
+        "blacklisted_ip_lists": {
+            "type": ["array", "null"]
+        },
+        "geo_ip_access": {
+            "type": ["object", "null"],
+            "properties": {
+                "enabled": {
+                    "type": "boolean"
+                },
+                "allowed": {
+                    "type": ["array", "null"]
+                },
+                "blocked": {
+                    "type": ["array", "null"]
+                }
+            }
+        },
         "enable_batch_request_support": {
             "type": "boolean"
         },
@@ -153,6 +245,9 @@ const Schema = `{
         "oauth_meta": {
             "type":["object", "null"]
         },
+        "certificate_bound_tokens": {
+            "type": "boolean"
+        },
         "cache_options": {
             "type":["object", "null"]
         },
@@ -279,6 +374,15 @@ const Schema = `{
         "domain": {
             "type": "string"
         },
+        "protocol": {
+            "type": "string",
+            "enum": ["", "http", "tcp", "tls"]
+        },
+        "listen_port": {
+            "type": "integer",
+            "minimum": 0,
+            "maximum": 65535
+        },
         "certificates": {
             "type": ["array", "null"]
         },
@@ -299,6 +403,168 @@ const Schema = `{
                 "preserve_host_header": {
                     "type": "boolean"
                 },
+                "load_balancing": {
+                    "type": ["object", "null"],
+                    "properties": {
+                        "strategy": {
+                            "type": "string",
+                            "enum": ["", "round_robin", "weighted", "least_connections", "consistent_hash"]
+                        },
+                        "hash_on": {
+                            "type": "string",
+                            "enum": ["", "ip", "key", "header", "cookie"]
+                        },
+                        "hash_key": {
+                            "type": "string"
+                        },
+                        "targets": {
+                            "type": ["array", "null"],
+                            "items": {
+                                "type": "object",
+                                "properties": {
+                                    "url": {
+                                        "type": "string"
+                                    },
+                                    "weight": {
+                                        "type": "integer",
+                                        "minimum": 0
+                                    },
+                                    "priority": {
+                                        "type": "integer"
+                                    }
+                                },
+                                "required": ["url"]
+                            }
+                        }
+                    }
+                },
+                "health_check": {
+                    "type": ["object", "null"],
+                    "properties": {
+                        "enabled": {
+                            "type": "boolean"
+                        },
+                        "type": {
+                            "type": "string",
+                            "enum": ["", "http", "tcp"]
+                        },
+                        "path": {
+                            "type": "string"
+                        },
+                        "status_codes": {
+                            "type": ["array", "null"],
+                            "items": {
+                                "type": "integer"
+                            }
+                        },
+                        "interval": {
+                            "type": "integer",
+                            "minimum": 0
+                        },
+                        "timeout": {
+                            "type": "integer",
+                            "minimum": 0
+                        },
+                        "healthy_threshold": {
+                            "type": "integer",
+                            "minimum": 0
+                        },
+                        "unhealthy_threshold": {
+                            "type": "integer",
+                            "minimum": 0
+                        }
+                    }
+                },
+                "mirror": {
+                    "type": ["object", "null"],
+                    "properties": {
+                        "enabled": {
+                            "type": "boolean"
+                        },
+                        "target_url": {
+                            "type": "string"
+                        },
+                        "percentage": {
+                            "type": "number",
+                            "minimum": 0,
+                            "maximum": 100
+                        },
+                        "timeout": {
+                            "type": "integer",
+                            "minimum": 0
+                        },
+                        "tag": {
+                            "type": "string"
+                        }
+                    }
+                },
+                "retry": {
+                    "type": ["object", "null"],
+                    "properties": {
+                        "enabled": {
+                            "type": "boolean"
+                        },
+                        "attempts": {
+                            "type": "integer",
+                            "minimum": 0
+                        },
+                        "backoff": {
+                            "type": "integer",
+                            "minimum": 0
+                        },
+                        "max_backoff": {
+                            "type": "integer",
+                            "minimum": 0
+                        },
+                        "status_codes": {
+                            "type": ["array", "null"],
+                            "items": {
+                                "type": "integer"
+                            }
+                        },
+                        "errors": {
+                            "type": ["array", "null"],
+                            "items": {
+                                "type": "string",
+                                "enum": ["connect", "reset", "timeout"]
+                            }
+                        },
+                        "per_try_timeout": {
+                            "type": "integer",
+                            "minimum": 0
+                        },
+                        "budget": {
+                            "type": ["object", "null"],
+                            "properties": {
+                                "ratio": {
+                                    "type": "number",
+                                    "minimum": 0
+                                },
+                                "min_per_second": {
+                                    "type": "integer",
+                                    "minimum": 0
+                                }
+                            }
+                        }
+                    }
+                },
+                "hedging": {
+                    "type": ["object", "null"],
+                    "properties": {
+                        "enabled": {
+                            "type": "boolean"
+                        },
+                        "percentile": {
+                            "type": "number",
+                            "minimum": 0,
+                            "maximum": 1
+                        },
+                        "min_delay": {
+                            "type": "integer",
+                            "minimum": 0
+                        }
+                    }
+                },
                 "transport": {
                     "type": ["object", "null"],
                     "properties": {
@@ -310,6 +576,48 @@ const Schema = `{
                         },
                         "proxy_url": {
                             "type": "string"
+                        },
+                        "max_idle_conns": {
+                            "type": "integer",
+                            "minimum": 0
+                        },
+                        "max_idle_conns_per_host": {
+                            "type": "integer",
+                            "minimum": 0
+                        },
+                        "max_conns_per_host": {
+                            "type": "integer",
+                            "minimum": 0
+                        },
+                        "idle_conn_timeout": {
+                            "type": "integer",
+                            "minimum": 0
+                        },
+                        "tls_handshake_timeout": {
+                            "type": "integer",
+                            "minimum": 0
+                        },
+                        "disable_keep_alives": {
+                            "type": "boolean"
+                        },
+                        "enable_http2": {
+                            "type": "boolean"
+                        },
+                        "http2_prior_knowledge": {
+                            "type": "boolean"
+                        },
+                        "alpn": {
+                            "type": ["array", "null"],
+                            "items": {
+                                "type": "string"
+                            }
+                        },
+                        "http2_max_header_list_size": {
+                            "type": "integer",
+                            "minimum": 0
+                        },
+                        "isolate_upstreams": {
+                            "type": "boolean"
                         }
                     }
                 }
@@ -350,6 +658,84 @@ const Schema = `{
                                     "type": "string",
                                     "id": "http://jsonschema.net/version_data/versions/versionInfoProperty/name"
                                 },
+                                "load_balancing": {
+                                    "type": ["object", "null"],
+                                    "properties": {
+                                        "strategy": {
+                                            "type": "string",
+                                            "enum": ["", "round_robin", "weighted", "least_connections", "consistent_hash"]
+                                        },
+                                        "hash_on": {
+                                            "type": "string",
+                                            "enum": ["", "ip", "key", "header", "cookie"]
+                                        },
+                                        "hash_key": {
+                                            "type": "string"
+                                        },
+                                        "targets": {
+                                            "type": ["array", "null"],
+                                            "items": {
+                                                "type": "object",
+                                                "properties": {
+                                                    "url": {
+                                                        "type": "string"
+                                                    },
+                                                    "weight": {
+                                                        "type": "integer",
+                                                        "minimum": 0
+                                                    },
+                                                    "priority": {
+                                                        "type": "integer"
+                                                    }
+                                                },
+                                                "required": ["url"]
+                                            }
+                                        }
+                                    }
+                                },
+                                "canary": {
+                                    "type": ["object", "null"],
+                                    "properties": {
+                                        "enabled": {
+                                            "type": "boolean"
+                                        },
+                                        "name": {
+                                            "type": "string"
+                                        },
+                                        "target_url": {
+                                            "type": "string"
+                                        },
+                                        "percentage": {
+                                            "type": "number",
+                                            "minimum": 0,
+                                            "maximum": 100
+                                        },
+                                        "header": {
+                                            "type": "string"
+                                        },
+                                        "header_values": {
+                                            "type": ["array", "null"],
+                                            "items": {
+                                                "type": "string"
+                                            }
+                                        },
+                                        "claim": {
+                                            "type": "string"
+                                        },
+                                        "claim_values": {
+                                            "type": ["array", "null"],
+                                            "items": {
+                                                "type": "string"
+                                            }
+                                        },
+                                        "key_tags": {
+                                            "type": ["array", "null"],
+                                            "items": {
+                                                "type": "string"
+                                            }
+                                        }
+                                    }
+                                },
                                 "paths": {
                                     "type": ["object", "null"],
                                     "id": "http://jsonschema.net/version_data/versions/versionInfoProperty/paths",
@@ -381,6 +767,20 @@ const Schema = `{
                 "versions"
             ]
         },
+        "version_cutover": {
+            "type": ["object", "null"],
+            "properties": {
+                "enabled": {
+                    "type": "boolean"
+                },
+                "version": {
+                    "type": "string"
+                },
+                "at": {
+                    "type": "string"
+                }
+            }
+        },
         "config_data": {
             "type": ["object", "null"]
         },
@@ -392,6 +792,109 @@ const Schema = `{
                 },
                 "per": {
                     "type": "number"
+                },
+                "queue_size": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "max_wait": {
+                    "type": "number",
+                    "minimum": 0
+                }
+            }
+        },
+        "maintenance": {
+            "type": ["object", "null"],
+            "properties": {
+                "enabled": {
+                    "type": "boolean"
+                },
+                "status_code": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "body": {
+                    "type": "string"
+                },
+                "headers": {
+                    "type": ["object", "null"],
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "retry_after": {
+                    "type": "integer",
+                    "minimum": 0
+                }
+            }
+        },
+        "concurrency_limit": {
+            "type": ["object", "null"],
+            "properties": {
+                "max_requests": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "queue_size": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "max_wait": {
+                    "type": "number",
+                    "minimum": 0
+                },
+                "adaptive": {
+                    "type": ["object", "null"],
+                    "properties": {
+                        "enabled": {
+                            "type": "boolean"
+                        },
+                        "initial_limit": {
+                            "type": "integer",
+                            "minimum": 0
+                        },
+                        "min_limit": {
+                            "type": "integer",
+                            "minimum": 0
+                        },
+                        "max_limit": {
+                            "type": "integer",
+                            "minimum": 0
+                        },
+                        "latency_threshold": {
+                            "type": "integer",
+                            "minimum": 0
+                        },
+                        "error_rate_threshold": {
+                            "type": "number",
+                            "minimum": 0,
+                            "maximum": 1
+                        },
+                        "backoff": {
+                            "type": "number",
+                            "minimum": 0,
+                            "maximum": 1
+                        },
+                        "retry_after": {
+                            "type": "integer",
+                            "minimum": 0
+                        }
+                    }
+                }
+            }
+        },
+        "dpop": {
+            "type": ["object", "null"],
+            "properties": {
+                "enabled": {
+                    "type": "boolean"
+                },
+                "required": {
+                    "type": "boolean"
+                },
+                "proof_lifetime": {
+                    "type": "integer",
+                    "minimum": 0
                 }
             }
         },
@@ -0,0 +1,375 @@
+package apidef
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/gojsonschema"
+)
+
+// ValidationError is a problem with a field of an API definition. Field is
+// the JSON path of the field.
+type ValidationError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationErrors are all problems found in an API definition.
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+var (
+	schemaOnce     sync.Once
+	compiledSchema *gojsonschema.Schema
+	schemaErr      error
+)
+
+// pathPlaceholder matches named path segments, like {id}, which are replaced
+// with a wildcard when the path is compiled.
+var pathPlaceholder = regexp.MustCompile(`{([^}]*)}`)
+
+// geoLocation matches ISO 3166-1 country codes and ISO 3166-2 region codes.
+var geoLocation = regexp.MustCompile(`^[A-Za-z]{2}(-[A-Za-z0-9]{1,3})?$`)
+
+var (
+	versionLocations  = map[string]bool{"": true, "header": true, "url-param": true, "url": true}
+	jwtSigningMethods = map[string]bool{"": true, "hmac": true, "rsa": true, "ecdsa": true}
+)
+
+// versionExpiryFormat is the format of VersionInfo.Expires.
+const versionExpiryFormat = "2006-01-02 15:04"
+
+// Validate checks the API definition against Schema, and checks values the
+// schema can't describe: URLs, regular expressions, IP addresses and version
+// settings. It returns nil if the definition is valid.
+func (a *APIDefinition) Validate() error {
+	var errs ValidationErrors
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, ValidationError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	errs = append(errs, a.validateSchema()...)
+
+	if a.Proxy.TargetURL != "" {
+		if target, err := url.Parse(a.Proxy.TargetURL); err != nil {
+			add("proxy.target_url", "%v", err)
+		} else if target.Scheme == "" && !a.Proxy.ServiceDiscovery.UseDiscoveryService {
+			add("proxy.target_url", "should be absolute URL")
+		}
+	}
+	layer4 := a.Protocol == ProtocolTCP || a.Protocol == ProtocolTLS
+	if layer4 {
+		if a.ListenPort == 0 {
+			add("listen_port", "should be set for %s protocol", a.Protocol)
+		}
+		if target, err := url.Parse(a.Proxy.TargetURL); err == nil && target.Scheme != ProtocolTCP && target.Scheme != ProtocolTLS {
+			add("proxy.target_url", "should be tcp:// or tls:// URL for %s protocol", a.Protocol)
+		}
+	}
+	if a.Proxy.EnableLoadBalancing && len(a.Proxy.Targets) == 0 && !a.Proxy.ServiceDiscovery.UseDiscoveryService {
+		add("proxy.target_list", "should not be empty with load balancing enabled")
+	}
+
+	validateTransport(add, a)
+
+	if !jwtSigningMethods[a.JWTSigningMethod] {
+		add("jwt_signing_method", "unknown method %q, should be hmac, rsa or ecdsa", a.JWTSigningMethod)
+	}
+	issuers := make(map[string]bool)
+	for i, issuer := range a.JWTIssuers {
+		field := fmt.Sprintf("jwt_issuers[%d]", i)
+		if issuers[issuer.Issuer] {
+			add(field+".issuer", "issuer %q is listed more than once", issuer.Issuer)
+		}
+		issuers[issuer.Issuer] = true
+		if issuer.Source == "" && issuer.CertificateID == "" {
+			add(field, "source or certificate_id should be set")
+		}
+		if !jwtSigningMethods[issuer.SigningMethod] {
+			add(field+".signing_method", "unknown method %q, should be hmac, rsa or ecdsa", issuer.SigningMethod)
+		}
+	}
+
+	if a.UseBasicAuth && a.BasicAuth.ExtractFromBody {
+		validateRegexp(add, "basic_auth.body_user_regexp", a.BasicAuth.BodyUserRegexp)
+		validateRegexp(add, "basic_auth.body_password_regexp", a.BasicAuth.BodyPasswordRegexp)
+	}
+
+	validateIPs(add, "allowed_ips", a.AllowedIPs)
+	validateIPs(add, "blacklisted_ips", a.BlacklistedIPs)
+	validateGeoLocations(add, "geo_ip_access.allowed", a.GeoIPAccess.Allowed)
+	validateGeoLocations(add, "geo_ip_access.blocked", a.GeoIPAccess.Blocked)
+
+	if !versionLocations[a.VersionDefinition.Location] {
+		add("definition.location", "unknown location %q, should be header, url-param or url", a.VersionDefinition.Location)
+	}
+
+	for method := range a.GRPC.Methods {
+		if parts := strings.Split(method, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			add("grpc.methods", "%q should be package.Service/Method or package.Service/*", method)
+		}
+	}
+
+	// Layer 4 APIs proxy connections, versions don't apply
+	if len(a.VersionData.Versions) == 0 && !layer4 {
+		add("version_data.versions", "at least one version should be defined")
+	}
+	if def := a.VersionData.DefaultVersion; def != "" && !a.VersionData.NotVersioned {
+		if _, found := a.VersionData.Versions[def]; !found {
+			add("version_data.default_version", "version %q is not defined", def)
+		}
+	}
+
+	if cutover := a.VersionCutover; cutover.Enabled {
+		if _, found := a.VersionData.Versions[cutover.Version]; !found {
+			add("version_cutover.version", "version %q is not defined", cutover.Version)
+		}
+		if _, err := time.Parse(versionExpiryFormat, cutover.At); err != nil {
+			add("version_cutover.at", "should be in %q format", versionExpiryFormat)
+		}
+	}
+
+	names := make([]string, 0, len(a.VersionData.Versions))
+	for name := range a.VersionData.Versions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		version := a.VersionData.Versions[name]
+		field := "version_data.versions." + name
+
+		if version.Expires != "" && version.Expires != "-1" {
+			if _, err := time.Parse(versionExpiryFormat, version.Expires); err != nil {
+				add(field+".expires", "should be in %q format", versionExpiryFormat)
+			}
+		}
+
+		for _, path := range version.Paths.Ignored {
+			validatePath(add, field+".paths.ignored", path)
+		}
+		for _, path := range version.Paths.WhiteList {
+			validatePath(add, field+".paths.white_list", path)
+		}
+		for _, path := range version.Paths.BlackList {
+			validatePath(add, field+".paths.black_list", path)
+		}
+
+		validateExtendedPaths(add, field+".extended_paths", version.ExtendedPaths)
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+// validateSchema checks the definition, as encoded to JSON, against Schema.
+func (a *APIDefinition) validateSchema() (errs ValidationErrors) {
+	schemaOnce.Do(func() {
+		compiledSchema, schemaErr = gojsonschema.NewSchema(gojsonschema.NewStringLoader(Schema))
+	})
+	if schemaErr != nil {
+		return ValidationErrors{{Field: "(root)", Message: "Schema can't be loaded: " + schemaErr.Error()}}
+	}
+
+	data, err := json.Marshal(a)
+	if err != nil {
+		return ValidationErrors{{Field: "(root)", Message: err.Error()}}
+	}
+
+	result, err := compiledSchema.Validate(gojsonschema.NewBytesLoader(data))
+	if err != nil {
+		return ValidationErrors{{Field: "(root)", Message: err.Error()}}
+	}
+
+	for _, resultErr := range result.Errors() {
+		errs = append(errs, ValidationError{Field: resultErr.Field(), Message: resultErr.Description()})
+	}
+
+	return errs
+}
+
+type addValidationError func(field, format string, args ...interface{})
+
+// validateTransport checks that the transport settings apply to the protocol
+// spoken to the upstream. HTTP/2 spoken with prior knowledge, and cleartext
+// HTTP/2 of gRPC, don't go through proxies nor the connection pool.
+func validateTransport(add addValidationError, a *APIDefinition) {
+	conf := a.Proxy.Transport
+	http2 := conf.EnableHTTP2 || conf.HTTP2PriorKnowledge || a.GRPC.Enabled
+
+	if conf.HTTP2PriorKnowledge || (a.GRPC.Enabled && a.hasCleartextTarget()) {
+		if conf.ProxyURL != "" {
+			add("proxy.transport.proxy_url", "is not supported with HTTP/2 prior knowledge or cleartext gRPC")
+		}
+		if conf.MaxIdleConns > 0 || conf.MaxIdleConnsPerHost > 0 || conf.MaxConnsPerHost > 0 || conf.IdleConnTimeout > 0 || conf.DisableKeepAlives {
+			add("proxy.transport", "connection pool settings are not supported with HTTP/2 prior knowledge or cleartext gRPC")
+		}
+	}
+
+	if len(conf.ALPN) > 0 {
+		offersH2 := false
+		for _, proto := range conf.ALPN {
+			offersH2 = offersH2 || proto == "h2"
+		}
+		switch {
+		case offersH2 && !http2:
+			add("proxy.transport.alpn", "h2 should only be offered with enable_http2, http2_prior_knowledge or gRPC")
+		case !offersH2 && (conf.HTTP2PriorKnowledge || a.GRPC.Enabled):
+			add("proxy.transport.alpn", "h2 should be offered with http2_prior_knowledge or gRPC")
+		}
+	}
+}
+
+// hasCleartextTarget tells whether any upstream of the API is an http URL.
+func (a *APIDefinition) hasCleartextTarget() bool {
+	for _, target := range append([]string{a.Proxy.TargetURL}, a.Proxy.Targets...) {
+		if u, err := url.Parse(target); err == nil && u.Scheme == "http" {
+			return true
+		}
+	}
+	return false
+}
+
+func validateRegexp(add addValidationError, field, pattern string) {
+	if _, err := regexp.Compile(pattern); err != nil {
+		add(field, "invalid regular expression %q: %v", pattern, err)
+	}
+}
+
+// validatePath checks that the path compiles to regular expression as
+// endpoint paths do.
+func validatePath(add addValidationError, field, path string) {
+	if _, err := regexp.Compile(pathPlaceholder.ReplaceAllString(path, `([^/]*)`)); err != nil {
+		add(field, "path %q is not a valid regular expression: %v", path, err)
+	}
+}
+
+func validateIPs(add addValidationError, field string, ips []string) {
+	for _, ip := range ips {
+		if net.ParseIP(ip) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(ip); err != nil {
+			add(field, "%q is not an IP address or CIDR range", ip)
+		}
+	}
+}
+
+func validateGeoLocations(add addValidationError, field string, locations []string) {
+	for _, location := range locations {
+		if !geoLocation.MatchString(location) {
+			add(field, "%q is not an ISO country or region code", location)
+		}
+	}
+}
+
+// validateExtendedPaths checks paths of all endpoint settings, and patterns
+// of URL rewrites.
+func validateExtendedPaths(add addValidationError, field string, paths ExtendedPathsSet) {
+	for _, path := range paths.Cached {
+		validatePath(add, field+".cache", path)
+	}
+
+	// Endpoint settings are slices of structs with Path field
+	set := reflect.ValueOf(paths)
+	for i := 0; i < set.NumField(); i++ {
+		list := set.Field(i)
+		if list.Kind() != reflect.Slice || list.Type().Elem().Kind() != reflect.Struct {
+			continue
+		}
+
+		name := strings.Split(set.Type().Field(i).Tag.Get("json"), ",")[0]
+		for j := 0; j < list.Len(); j++ {
+			if path := list.Index(j).FieldByName("Path"); path.IsValid() && path.Kind() == reflect.String {
+				validatePath(add, fmt.Sprintf("%s.%s[%d].path", field, name, j), path.String())
+			}
+		}
+	}
+
+	for i, rewrite := range paths.URLRewrite {
+		rewriteField := fmt.Sprintf("%s.url_rewrites[%d]", field, i)
+		validateRegexp(add, rewriteField+".match_pattern", rewrite.MatchPattern)
+
+		for j, trigger := range rewrite.Triggers {
+			triggerField := fmt.Sprintf("%s.triggers[%d].options", rewriteField, j)
+			opts := trigger.Options
+
+			for kind, matches := range map[string]map[string]StringRegexMap{
+				"header_matches":          opts.HeaderMatches,
+				"query_val_matches":       opts.QueryValMatches,
+				"path_part_matches":       opts.PathPartMatches,
+				"session_meta_matches":    opts.SessionMetaMatches,
+				"request_context_matches": opts.RequestContextMatches,
+			} {
+				for key, match := range matches {
+					validateRegexp(add, triggerField+"."+kind+"."+key+".match_rx", match.MatchPattern)
+				}
+			}
+			validateRegexp(add, triggerField+".payload_matches.match_rx", opts.PayloadMatches.MatchPattern)
+		}
+	}
+
+	for kind, transforms := range map[string][]TemplateMeta{
+		"transform":          paths.Transform,
+		"transform_response": paths.TransformResponse,
+	} {
+		for i, transform := range transforms {
+			validateTransformOperations(add, fmt.Sprintf("%s.%s[%d].template_data", field, kind, i), transform.TemplateData)
+		}
+	}
+}
+
+// validateTransformOperations checks the operations of declarative JSON
+// transforms.
+func validateTransformOperations(add addValidationError, field string, data TemplateData) {
+	if data.Mode != UseOperations {
+		return
+	}
+	if data.Input == RequestXML {
+		add(field+".input_type", "operations only transform JSON bodies")
+	}
+
+	for i, op := range data.Operations {
+		opField := fmt.Sprintf("%s.operations[%d]", field, i)
+		switch op.Op {
+		case "add", "remove":
+		case "copy", "move":
+			if op.From == "" {
+				add(opField+".from", "%s needs a path to take the value from", op.Op)
+			}
+		case "rename":
+			if op.To == "" || strings.Contains(op.To, ".") {
+				add(opField+".to", "rename needs a key to rename to")
+			}
+		default:
+			add(opField+".op", "unknown operation %q", op.Op)
+			continue
+		}
+		if op.Path == "" {
+			add(opField+".path", "path can't be empty")
+		}
+	}
+}
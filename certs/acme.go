@@ -0,0 +1,230 @@
+package certs
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	cache "github.com/pmylund/go-cache"
+)
+
+const (
+	acmeHostPrefix = "acme-host-"
+
+	defaultACMERenewBefore   = 30 * 24 * time.Hour
+	defaultACMECheckInterval = 12 * time.Hour
+)
+
+// ACMEProvider obtains certificates from an ACME certificate authority.
+// letsencrypt.Manager satisfies this interface.
+type ACMEProvider interface {
+	Cert(host string) (*tls.Certificate, error)
+}
+
+// ACMEManager requests certificates for a set of hosts from an ACME provider,
+// stores them through CertificateManager.Add and keeps them renewed.
+// Stored certificates are addressed by the same SHA256 IDs as any other
+// certificate, so they can be passed to List and friends.
+type ACMEManager struct {
+	manager  *CertificateManager
+	provider ACMEProvider
+	orgID    string
+
+	// RenewBefore is how long before NotAfter a certificate gets renewed.
+	RenewBefore time.Duration
+
+	mu   sync.RWMutex
+	stop chan struct{}
+}
+
+func NewACMEManager(manager *CertificateManager, provider ACMEProvider, orgID string) *ACMEManager {
+	return &ACMEManager{
+		manager:     manager,
+		provider:    provider,
+		orgID:       orgID,
+		RenewBefore: defaultACMERenewBefore,
+	}
+}
+
+func encodeTLSCertificate(cert *tls.Certificate) ([]byte, error) {
+	var buf bytes.Buffer
+
+	for _, der := range cert.Certificate {
+		if err := pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+			return nil, err
+		}
+	}
+
+	if cert.PrivateKey != nil {
+		keyDer, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := pem.Encode(&buf, &pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Obtain requests a certificate for the host, stores it and returns its ID.
+// A certificate previously stored for the same host is removed if it differs.
+func (a *ACMEManager) Obtain(host string) (string, error) {
+	host = strings.ToLower(host)
+
+	cert, err := a.provider.Cert(host)
+	if err != nil {
+		a.manager.logger.Error("ACME: failed to obtain certificate for ", host, ": ", err)
+		return "", err
+	}
+
+	if len(cert.Certificate) == 0 {
+		return "", errors.New("ACME provider returned empty certificate for " + host)
+	}
+
+	certID := a.orgID + HexSHA256(cert.Certificate[0])
+
+	if existing, err := a.manager.GetRaw(certID); err != nil || existing == "" {
+		certPEM, err := encodeTLSCertificate(cert)
+		if err != nil {
+			a.manager.logger.Error("ACME: failed to encode certificate for ", host, ": ", err)
+			return "", err
+		}
+
+		if _, err := a.manager.Add(certPEM, a.orgID); err != nil {
+			return "", err
+		}
+	}
+
+	oldID := a.CertID(host)
+	if err := a.manager.storage.SetKey(acmeHostPrefix+host, certID, 0); err != nil {
+		a.manager.logger.Error("ACME: failed to store certificate mapping for ", host, ": ", err)
+		return "", err
+	}
+	a.manager.cache.Delete(missingCachePrefix + acmeHostPrefix + host)
+	a.manager.cache.Set(acmeHostPrefix+host, certID, cache.DefaultExpiration)
+
+	if oldID != "" && oldID != certID {
+		a.manager.logger.Info("ACME: certificate for ", host, " renewed, removing ", oldID)
+		a.manager.Delete(oldID)
+	}
+
+	return certID, nil
+}
+
+// CertID returns ID of the stored certificate for the host, or empty string.
+// IDs are cached for the default cache expiration only, so that certificates
+// renewed by other gateways are picked up.
+func (a *ACMEManager) CertID(host string) string {
+	host = strings.ToLower(host)
+	key := acmeHostPrefix + host
+
+	if certID, found := a.manager.cache.Get(key); found {
+		return certID.(string)
+	}
+
+	// Hosts without certificates are remembered as certificates are, for
+	// TLS handshakes with them not to reach storage each time
+	if a.manager.isMissing(key) {
+		return ""
+	}
+
+	certID, err := a.manager.storage.GetKey(key)
+	if err != nil {
+		if a.manager.confirmsMissing(err) {
+			a.manager.cacheMissing(key)
+		}
+		return ""
+	}
+
+	a.manager.cache.Set(key, certID, cache.DefaultExpiration)
+
+	return certID
+}
+
+// CertIDs returns IDs of the stored certificates for the given hosts,
+// skipping hosts without a certificate.
+func (a *ACMEManager) CertIDs(hosts []string) (out []string) {
+	for _, host := range hosts {
+		if certID := a.CertID(host); certID != "" {
+			out = append(out, certID)
+		}
+	}
+
+	return out
+}
+
+func (a *ACMEManager) needsRenewal(host string) bool {
+	certID := a.CertID(host)
+	if certID == "" {
+		return true
+	}
+
+	certs := a.manager.List([]string{certID}, CertificatePrivate)
+	if len(certs) == 0 || certs[0] == nil {
+		return true
+	}
+
+	return time.Now().Add(a.RenewBefore).After(certs[0].Leaf.NotAfter)
+}
+
+// Renew obtains certificates for hosts which do not have one yet,
+// or whose certificate expires within RenewBefore.
+func (a *ACMEManager) Renew(hosts []string) {
+	for _, host := range hosts {
+		if !a.needsRenewal(host) {
+			continue
+		}
+
+		a.Obtain(host)
+	}
+}
+
+// Start runs Renew for the hosts immediately and then on every interval
+// until Stop is called.
+func (a *ACMEManager) Start(hosts []string, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultACMECheckInterval
+	}
+
+	a.mu.Lock()
+	if a.stop != nil {
+		a.mu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	a.stop = stop
+	a.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			a.Renew(hosts)
+
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func (a *ACMEManager) Stop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.stop != nil {
+		close(a.stop)
+		a.stop = nil
+	}
+}
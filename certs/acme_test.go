@@ -0,0 +1,142 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"testing"
+	"time"
+)
+
+type dummyACMEProvider struct {
+	certs map[string]*tls.Certificate
+	calls int
+}
+
+func (p *dummyACMEProvider) Cert(host string) (*tls.Certificate, error) {
+	p.calls++
+
+	cert, ok := p.certs[host]
+	if !ok {
+		return nil, errors.New("unknown host")
+	}
+
+	return cert, nil
+}
+
+func genTLSCertificate(tmpl *x509.Certificate) *tls.Certificate {
+	certPem, keyPem := genCertificate(tmpl)
+	cert, _ := tls.X509KeyPair(certPem, keyPem)
+	cert.Leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+
+	return &cert
+}
+
+func TestACMEManager(t *testing.T) {
+	m := newManager()
+
+	provider := &dummyACMEProvider{certs: map[string]*tls.Certificate{
+		"example.com": genTLSCertificate(&x509.Certificate{
+			Subject:  pkix.Name{CommonName: "example.com"},
+			DNSNames: []string{"example.com"},
+		}),
+	}}
+
+	acme := NewACMEManager(m, provider, "")
+
+	t.Run("Obtain", func(t *testing.T) {
+		certID, err := acme.Obtain("Example.com")
+		if err != nil {
+			t.Fatal("Should obtain certificate", err)
+		}
+
+		if certID != HexSHA256(provider.certs["example.com"].Certificate[0]) {
+			t.Error("Wrong certificate ID", certID)
+		}
+
+		if acme.CertID("example.com") != certID {
+			t.Error("Certificate should be mapped to the host")
+		}
+
+		certs := m.List([]string{certID}, CertificatePrivate)
+		if len(certs) != 1 || leafSubjectName(certs[0]) != "example.com" {
+			t.Error("Stored certificate should be listed with private key")
+		}
+	})
+
+	t.Run("Unknown host", func(t *testing.T) {
+		if _, err := acme.Obtain("unknown.com"); err == nil {
+			t.Error("Should fail for unknown host")
+		}
+
+		if acme.CertID("unknown.com") != "" {
+			t.Error("Unknown host should not have certificate")
+		}
+
+		// Certificate stored by another gateway is found once the miss expires
+		m.storage.SetKey(acmeHostPrefix+"unknown.com", "other", 0)
+		if acme.CertID("unknown.com") != "" {
+			t.Error("Missing certificate of the host should be cached")
+		}
+		m.cache.Delete(missingCachePrefix + acmeHostPrefix + "unknown.com")
+		if acme.CertID("unknown.com") != "other" {
+			t.Error("Certificate of the host should be found after the cached miss")
+		}
+		m.storage.DeleteKey(acmeHostPrefix + "unknown.com")
+		m.cache.Delete(acmeHostPrefix + "unknown.com")
+	})
+
+	t.Run("Renewed by another gateway", func(t *testing.T) {
+		certID := acme.CertID("example.com")
+		m.storage.SetKey(acmeHostPrefix+"example.com", "renewed", 0)
+		defer m.storage.SetKey(acmeHostPrefix+"example.com", certID, 0)
+
+		if acme.CertID("example.com") != certID {
+			t.Error("Certificate of the host should be cached")
+		}
+
+		// Cached IDs expire, for renewals to be picked up
+		el := m.cache.items[acmeHostPrefix+"example.com"]
+		el.Value.(*lruEntry).expires = time.Now().Add(-time.Second)
+		if acme.CertID("example.com") != "renewed" {
+			t.Error("Renewed certificate of the host should be found once the cached ID expires")
+		}
+		m.cache.Delete(acmeHostPrefix + "example.com")
+	})
+
+	t.Run("Renew skips valid certificates", func(t *testing.T) {
+		provider.calls = 0
+		acme.RenewBefore = time.Minute
+		acme.Renew([]string{"example.com"})
+
+		if provider.calls != 0 {
+			t.Error("Should not renew valid certificate")
+		}
+	})
+
+	t.Run("Renew expiring certificates", func(t *testing.T) {
+		oldID := acme.CertID("example.com")
+		provider.certs["example.com"] = genTLSCertificate(&x509.Certificate{
+			Subject:  pkix.Name{CommonName: "example.com"},
+			DNSNames: []string{"example.com"},
+		})
+
+		// genCertificate issues certificates valid for an hour
+		acme.RenewBefore = 2 * time.Hour
+		acme.Renew([]string{"example.com"})
+
+		newID := acme.CertID("example.com")
+		if newID == oldID {
+			t.Fatal("Certificate should be renewed")
+		}
+
+		if raw, _ := m.GetRaw(oldID); raw != "" {
+			t.Error("Old certificate should be removed")
+		}
+
+		if ids := acme.CertIDs([]string{"example.com", "unknown.com"}); len(ids) != 1 || ids[0] != newID {
+			t.Error("Should return IDs only for hosts with certificates", ids)
+		}
+	})
+}
@@ -0,0 +1,268 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/syslog"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Audited actions
+const (
+	AuditAdd              = "add"
+	AuditDelete           = "delete"
+	AuditRestore          = "restore"
+	AuditRead             = "read"
+	AuditValidationFailed = "validation_failed"
+)
+
+// AuditEvent records a certificate operation.
+type AuditEvent struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	CertID string    `json:"cert_id,omitempty"`
+	// Actor is who performed the operation, e.g. API caller address, or the
+	// client for validation failures. Empty for internal operations.
+	Actor string `json:"actor,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// AuditSink receives audit events.
+type AuditSink interface {
+	Audit(event *AuditEvent) error
+}
+
+// AddAuditSink starts sending audit events to the sink.
+func (c *CertificateManager) AddAuditSink(sink AuditSink) {
+	c.mu.Lock()
+	c.auditSinks = append(c.auditSinks, sink)
+	c.mu.Unlock()
+}
+
+func (c *CertificateManager) audit(action, certID, actor string, err error) {
+	c.mu.RLock()
+	sinks := c.auditSinks
+	c.mu.RUnlock()
+
+	if len(sinks) == 0 {
+		return
+	}
+
+	event := &AuditEvent{
+		Time:   time.Now().UTC(),
+		Action: action,
+		CertID: certID,
+		Actor:  actor,
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	for _, sink := range sinks {
+		if err := sink.Audit(event); err != nil {
+			c.logger.Error("Can't write certificate audit event: ", err)
+		}
+	}
+}
+
+// AuditedCertificates performs certificate operations on behalf of the actor,
+// who is recorded in audit events.
+type AuditedCertificates struct {
+	manager *CertificateManager
+	actor   string
+}
+
+// AuditedBy returns operations audited as performed by the actor.
+func (c *CertificateManager) AuditedBy(actor string) *AuditedCertificates {
+	return &AuditedCertificates{manager: c, actor: actor}
+}
+
+func (a *AuditedCertificates) Add(certData []byte, orgID string) (string, error) {
+	return a.AddContext(context.Background(), certData, orgID)
+}
+
+func (a *AuditedCertificates) AddContext(ctx context.Context, certData []byte, orgID string) (string, error) {
+	certID, certChainPEM, err := a.manager.encode(certData, orgID)
+	if err == nil {
+		_, err = a.manager.store(ctx, certID, certChainPEM)
+	}
+
+	a.manager.audit(AuditAdd, certID, a.actor, err)
+	if err != nil {
+		return "", err
+	}
+
+	return certID, nil
+}
+
+func (a *AuditedCertificates) AddWithPassphrase(certData []byte, passphrase, orgID string) (string, error) {
+	certID, certChainPEM, err := a.manager.encodeWithPassphrase(certData, passphrase, orgID)
+	if err == nil {
+		if raw, _ := a.manager.storage.GetKey("raw-" + certID); raw != "" {
+			err = &CertificateError{CertID: certID, Err: ErrCertExists}
+		}
+	}
+	// Passphrase is stored first, so the key is never loaded without it
+	if err == nil {
+		err = a.manager.storePassphrase(certID, passphrase)
+	}
+	if err == nil {
+		_, err = a.manager.store(context.Background(), certID, certChainPEM)
+	}
+
+	a.manager.audit(AuditAdd, certID, a.actor, err)
+	if err != nil {
+		return "", err
+	}
+
+	return certID, nil
+}
+
+func (a *AuditedCertificates) Delete(certID string) {
+	a.DeleteContext(context.Background(), certID)
+}
+
+func (a *AuditedCertificates) DeleteContext(ctx context.Context, certID string) error {
+	err := a.manager.delete(ctx, certID)
+	a.manager.audit(AuditDelete, certID, a.actor, err)
+	return err
+}
+
+// Restore brings back a soft deleted certificate.
+func (a *AuditedCertificates) Restore(certID string) error {
+	err := a.manager.restore(certID)
+	a.manager.audit(AuditRestore, certID, a.actor, err)
+	return err
+}
+
+func (a *AuditedCertificates) DeleteUnused(certID string) error {
+	if usages := a.manager.Usages(certID); len(usages) > 0 {
+		return &CertificateError{CertID: certID, Err: ErrCertInUse}
+	}
+
+	a.Delete(certID)
+	return nil
+}
+
+func (a *AuditedCertificates) GetRaw(certID string) (string, error) {
+	return a.GetRawContext(context.Background(), certID)
+}
+
+func (a *AuditedCertificates) GetRawContext(ctx context.Context, certID string) (string, error) {
+	raw, err := a.manager.getKey(ctx, "raw-"+certID)
+	a.manager.audit(AuditRead, certID, a.actor, err)
+	return raw, err
+}
+
+// FileAuditSink appends audit events to the file as JSON lines.
+type FileAuditSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewFileAuditSink(path string) (*FileAuditSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileAuditSink{file: file}, nil
+}
+
+func (s *FileAuditSink) Audit(event *AuditEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.file.Write(append(data, '\n'))
+	return err
+}
+
+func (s *FileAuditSink) Close() error {
+	return s.file.Close()
+}
+
+// SyslogAuditSink sends audit events as JSON to syslog with the auth
+// facility. Empty network and address use the local syslog.
+type SyslogAuditSink struct {
+	writer *syslog.Writer
+}
+
+func NewSyslogAuditSink(network, address, tag string) (*SyslogAuditSink, error) {
+	writer, err := syslog.Dial(network, address, syslog.LOG_AUTH|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SyslogAuditSink{writer: writer}, nil
+}
+
+func (s *SyslogAuditSink) Audit(event *AuditEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if event.Action == AuditValidationFailed {
+		return s.writer.Warning(string(data))
+	}
+
+	return s.writer.Info(string(data))
+}
+
+// WebhookAuditSink posts audit events as JSON to the URL. Events are sent in
+// background, so slow webhooks don't delay certificate operations.
+type WebhookAuditSink struct {
+	url    string
+	client *http.Client
+	errors func(error)
+}
+
+// NewWebhookAuditSink creates webhook sink, reporting delivery failures to
+// onError if set.
+func NewWebhookAuditSink(url string, onError func(error)) *WebhookAuditSink {
+	return &WebhookAuditSink{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+		errors: onError,
+	}
+}
+
+func (s *WebhookAuditSink) Audit(event *AuditEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		if err := s.send(data); err != nil && s.errors != nil {
+			s.errors(err)
+		}
+	}()
+
+	return nil
+}
+
+func (s *WebhookAuditSink) send(data []byte) error {
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return errors.New("Audit webhook returned status " + strconv.Itoa(resp.StatusCode))
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memoryAuditSink struct {
+	mu     sync.Mutex
+	events []AuditEvent
+}
+
+func (s *memoryAuditSink) Audit(event *AuditEvent) error {
+	s.mu.Lock()
+	s.events = append(s.events, *event)
+	s.mu.Unlock()
+	return nil
+}
+
+func TestAudit(t *testing.T) {
+	m := newManager()
+	sink := &memoryAuditSink{}
+	m.AddAuditSink(sink)
+
+	certPem, _ := genCertificateFromCommonName("audited")
+	certID, _ := m.AuditedBy("admin").Add(certPem, "")
+	m.AuditedBy("admin").Add(certPem, "")
+	m.GetRaw(certID)
+
+	clientPem, _ := genCertificateFromCommonName("client")
+	block, _ := pem.Decode(clientPem)
+	client, _ := x509.ParseCertificate(block.Bytes)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{client}}
+	if err := m.ValidateRequestCertificate([]string{certID}, r); err == nil {
+		t.Fatal("Client certificate should not be allowed")
+	}
+
+	m.AuditedBy("admin").Delete(certID)
+
+	p12Data, _ := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(pkcs12Bundle), ""))
+	m.AuditedBy("admin").AddPKCS12(p12Data, "test", "")
+	m.AuditedBy("admin").AddPKCS12(p12Data, "wrong", "")
+
+	expected := []AuditEvent{
+		{Action: AuditAdd, CertID: certID, Actor: "admin"},
+		{Action: AuditAdd, CertID: certID, Actor: "admin", Error: "Certificate with " + certID + " id already exists"},
+		{Action: AuditRead, CertID: certID},
+		{Action: AuditValidationFailed, CertID: HexSHA256(client.Raw), Actor: "10.0.0.1:1234", Error: "Certificate with SHA256 " + HexSHA256(client.Raw) + " not allowed"},
+		{Action: AuditDelete, CertID: certID, Actor: "admin"},
+		{Action: AuditAdd, CertID: pkcs12LeafID, Actor: "admin"},
+		{Action: AuditAdd, Actor: "admin", Error: "Failed to decode PKCS#12 bundle: pkcs12: decryption password incorrect"},
+	}
+
+	if len(sink.events) != len(expected) {
+		t.Fatal("Wrong number of events", sink.events)
+	}
+
+	for i, event := range sink.events {
+		if event.Time.IsZero() {
+			t.Error("Event time should be set", i)
+		}
+
+		event.Time = time.Time{}
+		if event != expected[i] {
+			t.Errorf("Event %d should be %+v, got %+v", i, expected[i], event)
+		}
+	}
+
+	t.Run("File sink", func(t *testing.T) {
+		dir, _ := ioutil.TempDir("", "audit")
+		defer os.RemoveAll(dir)
+
+		sink, err := NewFileAuditSink(filepath.Join(dir, "audit.log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sink.Audit(&AuditEvent{Action: AuditAdd, CertID: "first"})
+		sink.Audit(&AuditEvent{Action: AuditDelete, CertID: "second"})
+		sink.Close()
+
+		data, _ := ioutil.ReadFile(filepath.Join(dir, "audit.log"))
+		decoder := json.NewDecoder(strings.NewReader(string(data)))
+
+		var event AuditEvent
+		if decoder.Decode(&event); event.CertID != "first" {
+			t.Error("First event should be written", string(data))
+		}
+		if decoder.Decode(&event); event.CertID != "second" || event.Action != AuditDelete {
+			t.Error("Second event should be appended", string(data))
+		}
+	})
+
+	t.Run("Webhook sink", func(t *testing.T) {
+		received := make(chan AuditEvent, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var event AuditEvent
+			json.NewDecoder(r.Body).Decode(&event)
+			received <- event
+		}))
+		defer server.Close()
+
+		sink := NewWebhookAuditSink(server.URL, func(err error) {
+			t.Error(err)
+		})
+		sink.Audit(&AuditEvent{Action: AuditRead, CertID: "cert", Actor: "admin"})
+
+		select {
+		case event := <-received:
+			if event.CertID != "cert" || event.Actor != "admin" {
+				t.Error("Wrong event received", event)
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("Event should be posted")
+		}
+	})
+}
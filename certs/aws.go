@@ -0,0 +1,280 @@
+package certs
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// AWSCredentials are used to sign AWS API requests. Empty credentials are
+// read from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// AWSSource fetches certificates from AWS Certificate Manager by ARN, and
+// loads AWS KMS keys as private keys.
+//
+// ACM does not export private keys, so certificate referenced as
+// "<acm arn>?key=<kms arn>" is returned with the KMS key used for signing.
+// KMS key ARNs can be used with AddWithKeyURI too, once LoadKey is registered
+// as KeyLoader for the "arn" scheme.
+type AWSSource struct {
+	credentials AWSCredentials
+	client      *http.Client
+
+	// endpoint returns API URL for the service and region, overridden in tests
+	endpoint func(service, region string) string
+	now      func() time.Time
+}
+
+func NewAWSSource(credentials AWSCredentials) *AWSSource {
+	if credentials.AccessKeyID == "" {
+		credentials = AWSCredentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+	}
+
+	return &AWSSource{
+		credentials: credentials,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		endpoint: func(service, region string) string {
+			return "https://" + service + "." + region + ".amazonaws.com/"
+		},
+		now: time.Now,
+	}
+}
+
+type awsARN struct {
+	service string
+	region  string
+}
+
+func parseARN(arn string) (*awsARN, error) {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" || parts[2] == "" || parts[3] == "" {
+		return nil, errors.New("Malformed ARN: " + arn)
+	}
+
+	return &awsARN{service: parts[2], region: parts[3]}, nil
+}
+
+func (s *AWSSource) Match(ref string) bool {
+	arn, err := parseARN(ref)
+	return err == nil && arn.service == "acm"
+}
+
+func (s *AWSSource) Fetch(ref string) ([]byte, error) {
+	certARN := ref
+	var keyARN string
+	if i := strings.Index(ref, "?key="); i != -1 {
+		certARN, keyARN = ref[:i], ref[i+len("?key="):]
+	}
+
+	arn, err := parseARN(certARN)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Certificate      string
+		CertificateChain string
+	}
+
+	err = s.call("acm", arn.region, "CertificateManager.GetCertificate", map[string]string{"CertificateArn": certARN}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	data := []byte(resp.Certificate + "\n" + resp.CertificateChain)
+	if keyARN != "" {
+		data = append(data, '\n')
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: keyURIBlock, Bytes: []byte(keyARN)})...)
+	}
+
+	return data, nil
+}
+
+// LoadKey is a KeyLoader for KMS key ARNs.
+func (s *AWSSource) LoadKey(uri string, publicKey crypto.PublicKey) (crypto.Signer, error) {
+	arn, err := parseARN(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if arn.service != "kms" {
+		return nil, errors.New("Not a KMS key ARN: " + uri)
+	}
+
+	switch publicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, errors.New("Unsupported KMS key type")
+	}
+
+	return &kmsSigner{source: s, keyARN: uri, region: arn.region, publicKey: publicKey}, nil
+}
+
+// call makes AWS JSON protocol request signed with Signature Version 4.
+func (s *AWSSource) call(service, region, target string, body, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", s.endpoint(service, region), bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+	s.sign(req, payload, service, region)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var awsErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(respBody, &awsErr)
+		return errors.New("AWS " + service + " error " + resp.Status + ": " + awsErr.Type + " " + awsErr.Message)
+	}
+
+	return json.Unmarshal(respBody, out)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func (s *AWSSource) sign(req *http.Request, payload []byte, service, region string) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if s.credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.credentials.SessionToken)
+	}
+
+	signedHeaders := []string{"content-type", "host", "x-amz-date", "x-amz-target"}
+	if s.credentials.SessionToken != "" {
+		signedHeaders = append(signedHeaders, "x-amz-security-token")
+	}
+
+	var canonicalHeaders strings.Builder
+	for _, h := range signedHeaders {
+		value := req.Header.Get(h)
+		if h == "host" {
+			value = req.URL.Host
+		}
+		canonicalHeaders.WriteString(h + ":" + strings.TrimSpace(value) + "\n")
+	}
+
+	payloadHash := sha256.Sum256(payload)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		"/",
+		"",
+		canonicalHeaders.String(),
+		strings.Join(signedHeaders, ";"),
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.credentials.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.credentials.AccessKeyID+"/"+scope+
+		", SignedHeaders="+strings.Join(signedHeaders, ";")+", Signature="+signature)
+}
+
+// kmsSigner signs digests with asymmetric AWS KMS key.
+type kmsSigner struct {
+	source    *AWSSource
+	keyARN    string
+	region    string
+	publicKey crypto.PublicKey
+}
+
+func (k *kmsSigner) Public() crypto.PublicKey {
+	return k.publicKey
+}
+
+var kmsHashNames = map[crypto.Hash]string{
+	crypto.SHA256: "SHA_256",
+	crypto.SHA384: "SHA_384",
+	crypto.SHA512: "SHA_512",
+}
+
+func (k *kmsSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hashName, ok := kmsHashNames[opts.HashFunc()]
+	if !ok {
+		return nil, errors.New("Unsupported hash for KMS signing")
+	}
+
+	var algorithm string
+	switch k.publicKey.(type) {
+	case *rsa.PublicKey:
+		if _, ok := opts.(*rsa.PSSOptions); ok {
+			algorithm = "RSASSA_PSS_" + hashName
+		} else {
+			algorithm = "RSASSA_PKCS1_V1_5_" + hashName
+		}
+	case *ecdsa.PublicKey:
+		algorithm = "ECDSA_" + hashName
+	}
+
+	var resp struct {
+		Signature string
+	}
+
+	err := k.source.call("kms", k.region, "TrentService.Sign", map[string]string{
+		"KeyId":            k.keyARN,
+		"Message":          base64.StdEncoding.EncodeToString(digest),
+		"MessageType":      "DIGEST",
+		"SigningAlgorithm": algorithm,
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	// KMS returns ECDSA signatures ASN.1 encoded, as crypto.Signer expects
+	return base64.StdEncoding.DecodeString(resp.Signature)
+}
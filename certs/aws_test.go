@@ -0,0 +1,100 @@
+package certs
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAWSSource(t *testing.T) {
+	certPem, keyPem := genCertificateFromCommonName("aws")
+	keyBlock, _ := pem.Decode(keyPem)
+	key, _ := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+
+	const (
+		certARN = "arn:aws:acm:eu-west-1:123456789012:certificate/1234"
+		keyARN  = "arn:aws:kms:eu-west-1:123456789012:key/5678"
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=key-id/20200102/eu-west-1/") ||
+			!strings.Contains(auth, "SignedHeaders=content-type;host;x-amz-date;x-amz-target, Signature=") {
+			t.Error("Request should be signed", auth)
+		}
+
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+
+		switch r.Header.Get("X-Amz-Target") {
+		case "CertificateManager.GetCertificate":
+			if body["CertificateArn"] != certARN {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"__type":"ResourceNotFoundException","message":"not found"}`))
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"Certificate": string(certPem)})
+		case "TrentService.Sign":
+			if body["KeyId"] != keyARN || body["SigningAlgorithm"] != "RSASSA_PKCS1_V1_5_SHA_256" || body["MessageType"] != "DIGEST" {
+				t.Error("Wrong sign request", body)
+			}
+			digest, _ := base64.StdEncoding.DecodeString(body["Message"])
+			signature, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest)
+			json.NewEncoder(w).Encode(map[string]string{"Signature": base64.StdEncoding.EncodeToString(signature)})
+		}
+	}))
+	defer server.Close()
+
+	source := NewAWSSource(AWSCredentials{AccessKeyID: "key-id", SecretAccessKey: "secret"})
+	source.endpoint = func(service, region string) string { return server.URL }
+	source.now = func() time.Time { return time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC) }
+	RegisterKeyLoader("arn", source.LoadKey)
+
+	m := newManager()
+	m.AddSource(source)
+
+	if source.Match("arn:aws:kms:eu-west-1:123456789012:key/5678") || source.Match("cert.pem") {
+		t.Error("Should match only ACM ARNs")
+	}
+
+	t.Run("Public certificate", func(t *testing.T) {
+		certs := m.List([]string{certARN}, CertificatePublic)
+		if len(certs) != 1 || certs[0] == nil || leafSubjectName(certs[0]) != "aws" {
+			t.Error("Should fetch certificate from ACM")
+		}
+	})
+
+	t.Run("Certificate with KMS key", func(t *testing.T) {
+		certs := m.List([]string{certARN + "?key=" + keyARN}, CertificatePrivate)
+		if len(certs) != 1 || certs[0] == nil {
+			t.Fatal("Should fetch certificate with private key")
+		}
+
+		digest := sha256.Sum256([]byte("data"))
+		signature, err := certs[0].PrivateKey.(crypto.Signer).Sign(rand.Reader, digest[:], crypto.SHA256)
+		if err != nil {
+			t.Fatal("Should sign with KMS", err)
+		}
+
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+			t.Error("Signature should be valid", err)
+		}
+	})
+
+	t.Run("Unknown certificate", func(t *testing.T) {
+		certs := m.List([]string{"arn:aws:acm:eu-west-1:123456789012:certificate/unknown"}, CertificateAny)
+		if len(certs) != 1 || certs[0] != nil {
+			t.Error("Should not return unknown certificate")
+		}
+	})
+}
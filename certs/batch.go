@@ -0,0 +1,87 @@
+package certs
+
+import (
+	"bytes"
+	"encoding/pem"
+	"strings"
+)
+
+// BatchResult is the result of adding a single certificate with AddBatch.
+type BatchResult struct {
+	CertID string `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// SplitPEMBundle splits PEM data with multiple certificates into entries
+// accepted by Add. Private key is kept together with the certificates
+// preceding it, or with the next certificate if it comes first. Other
+// certificates and public keys become separate entries.
+func SplitPEMBundle(data []byte) (entries [][]byte) {
+	var pending [][]byte
+	var pendingKey []byte
+
+	flush := func() {
+		entries = append(entries, pending...)
+		pending = nil
+	}
+
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		encoded := pem.EncodeToMemory(block)
+
+		switch {
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			if len(pending) == 0 {
+				pendingKey = encoded
+				continue
+			}
+
+			entries = append(entries, append(bytes.Join(pending, nil), encoded...))
+			pending = nil
+		case block.Type == "CERTIFICATE":
+			if pendingKey != nil {
+				entries = append(entries, append(encoded, pendingKey...))
+				pendingKey = nil
+				continue
+			}
+
+			pending = append(pending, encoded)
+		default:
+			flush()
+			entries = append(entries, encoded)
+		}
+	}
+
+	flush()
+
+	return entries
+}
+
+// AddBatch adds each of the given certificates, and returns result for every
+// one of them in the same order. Failure to add one certificate does not stop
+// adding the rest.
+func (c *CertificateManager) AddBatch(certsData [][]byte, orgID string) []BatchResult {
+	return c.AuditedBy("").AddBatch(certsData, orgID)
+}
+
+func (a *AuditedCertificates) AddBatch(certsData [][]byte, orgID string) []BatchResult {
+	results := make([]BatchResult, len(certsData))
+
+	for i, certData := range certsData {
+		certID, err := a.Add(certData, orgID)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+
+		results[i].CertID = certID
+	}
+
+	return results
+}
@@ -0,0 +1,62 @@
+package certs
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSplitPEMBundle(t *testing.T) {
+	certA, keyA := genCertificateFromCommonName("a")
+	certB, keyB := genCertificateFromCommonName("b")
+	certC, _ := genCertificateFromCommonName("c")
+
+	tests := []struct {
+		name   string
+		bundle [][]byte
+		expect [][]byte
+	}{
+		{"Certificates", [][]byte{certA, certB}, [][]byte{certA, certB}},
+		{"Key after certificate", [][]byte{certA, keyA, certC}, [][]byte{append(certA, keyA...), certC}},
+		{"Key before certificate", [][]byte{keyB, certB, certC}, [][]byte{append(certB, keyB...), certC}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			entries := SplitPEMBundle(bytes.Join(tc.bundle, nil))
+			if len(entries) != len(tc.expect) {
+				t.Fatal("Wrong number of entries", len(entries))
+			}
+
+			for i := range entries {
+				if !bytes.Equal(entries[i], tc.expect[i]) {
+					t.Error("Wrong entry", i, string(entries[i]))
+				}
+			}
+		})
+	}
+}
+
+func TestAddBatch(t *testing.T) {
+	m := newManager()
+
+	certA, keyA := genCertificateFromCommonName("a")
+	certB, _ := genCertificateFromCommonName("b")
+	existingID, _ := m.Add(certB, "")
+
+	results := m.AddBatch([][]byte{append(certA, keyA...), certB, []byte("invalid")}, "")
+	if len(results) != 3 {
+		t.Fatal("Should return result for every certificate", results)
+	}
+
+	if results[0].CertID == "" || results[0].Error != "" {
+		t.Error("Should add certificate", results[0])
+	}
+
+	if results[1].Error == "" || results[1].CertID != "" {
+		t.Error("Should fail on existing certificate", existingID, results[1])
+	}
+
+	if results[2].Error == "" {
+		t.Error("Should fail on invalid certificate")
+	}
+}
@@ -0,0 +1,116 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"strings"
+)
+
+// BundleFormat is the encoding of certificate bundles returned by GetBundle.
+type BundleFormat string
+
+const (
+	// BundlePEM is the certificate chain followed by the private key.
+	BundlePEM BundleFormat = "pem"
+	// BundleDER is the concatenated DER encoded certificate chain.
+	BundleDER BundleFormat = "der"
+	// BundlePKCS7 is a certificates-only PKCS#7 SignedData structure (.p7b).
+	BundlePKCS7 BundleFormat = "pkcs7"
+)
+
+var (
+	oidPKCS7Data       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidPKCS7SignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+)
+
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"optional"`
+}
+
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms []asn1.RawValue `asn1:"set"`
+	ContentInfo      pkcs7ContentInfo
+	Certificates     asn1.RawValue   `asn1:"optional"`
+	SignerInfos      []asn1.RawValue `asn1:"set"`
+}
+
+// GetBundle returns the stored certificate chain in the format, from the leaf
+// to the intermediates. Only PEM bundles include the decrypted private key,
+// unless excludeKey is set. References to keys kept in HSM are never
+// included.
+func (c *CertificateManager) GetBundle(certID string, format BundleFormat, excludeKey bool) ([]byte, error) {
+	raw, err := c.GetRaw(certID)
+	if err != nil || raw == "" {
+		return nil, &CertificateError{CertID: certID, Err: ErrCertNotFound}
+	}
+
+	passphrase, err := c.keyPassphrase(context.Background(), certID)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks, err := parsePEM([]byte(raw), c.secret, passphrase)
+	if err != nil {
+		c.logger.Error("Can't decrypt certificate ", certID, " for bundle: ", err)
+		return nil, err
+	}
+
+	var pemData bytes.Buffer
+	var chain [][]byte
+	for _, block := range blocks {
+		switch {
+		case block.Type == keyURIBlock:
+			continue
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			if excludeKey {
+				continue
+			}
+		case block.Type == "CERTIFICATE":
+			chain = append(chain, block.Bytes)
+		}
+
+		pem.Encode(&pemData, &pem.Block{Type: block.Type, Bytes: block.Bytes})
+	}
+
+	if format == BundlePEM {
+		return pemData.Bytes(), nil
+	}
+
+	if len(chain) == 0 {
+		return nil, errors.New("Certificate with " + certID + " id has no certificates to bundle")
+	}
+
+	switch format {
+	case BundleDER:
+		return bytes.Join(chain, nil), nil
+	case BundlePKCS7:
+		return encodePKCS7(chain)
+	}
+
+	return nil, errors.New("Unsupported bundle format: " + string(format))
+}
+
+// encodePKCS7 encodes DER certificates as degenerate PKCS#7 SignedData with
+// no content and signers.
+func encodePKCS7(chain [][]byte) ([]byte, error) {
+	signedData, err := asn1.Marshal(pkcs7SignedData{
+		Version:     1,
+		ContentInfo: pkcs7ContentInfo{ContentType: oidPKCS7Data},
+		// [0] IMPLICIT SET OF Certificate
+		Certificates: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: bytes.Join(chain, nil)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(pkcs7ContentInfo{
+		ContentType: oidPKCS7SignedData,
+		// [0] EXPLICIT content
+		Content: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedData},
+	})
+}
@@ -0,0 +1,824 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: certificates.proto
+
+package certspb
+
+import (
+	context "context"
+	fmt "fmt"
+	math "math"
+
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type AddRequest struct {
+	Pem                  []byte   `protobuf:"bytes,1,opt,name=pem,proto3" json:"pem,omitempty"`
+	OrgId                string   `protobuf:"bytes,2,opt,name=org_id,json=orgId,proto3" json:"org_id,omitempty"`
+	Passphrase           string   `protobuf:"bytes,3,opt,name=passphrase,proto3" json:"passphrase,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *AddRequest) Reset()         { *m = AddRequest{} }
+func (m *AddRequest) String() string { return proto.CompactTextString(m) }
+func (*AddRequest) ProtoMessage()    {}
+func (*AddRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_6d4cfe162e62df58, []int{0}
+}
+
+func (m *AddRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AddRequest.Unmarshal(m, b)
+}
+func (m *AddRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AddRequest.Marshal(b, m, deterministic)
+}
+func (m *AddRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AddRequest.Merge(m, src)
+}
+func (m *AddRequest) XXX_Size() int {
+	return xxx_messageInfo_AddRequest.Size(m)
+}
+func (m *AddRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_AddRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AddRequest proto.InternalMessageInfo
+
+func (m *AddRequest) GetPem() []byte {
+	if m != nil {
+		return m.Pem
+	}
+	return nil
+}
+
+func (m *AddRequest) GetOrgId() string {
+	if m != nil {
+		return m.OrgId
+	}
+	return ""
+}
+
+func (m *AddRequest) GetPassphrase() string {
+	if m != nil {
+		return m.Passphrase
+	}
+	return ""
+}
+
+type AddReply struct {
+	Id                   string   `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *AddReply) Reset()         { *m = AddReply{} }
+func (m *AddReply) String() string { return proto.CompactTextString(m) }
+func (*AddReply) ProtoMessage()    {}
+func (*AddReply) Descriptor() ([]byte, []int) {
+	return fileDescriptor_6d4cfe162e62df58, []int{1}
+}
+
+func (m *AddReply) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AddReply.Unmarshal(m, b)
+}
+func (m *AddReply) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AddReply.Marshal(b, m, deterministic)
+}
+func (m *AddReply) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AddReply.Merge(m, src)
+}
+func (m *AddReply) XXX_Size() int {
+	return xxx_messageInfo_AddReply.Size(m)
+}
+func (m *AddReply) XXX_DiscardUnknown() {
+	xxx_messageInfo_AddReply.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AddReply proto.InternalMessageInfo
+
+func (m *AddReply) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+type ListRequest struct {
+	OrgId                string   `protobuf:"bytes,1,opt,name=org_id,json=orgId,proto3" json:"org_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListRequest) Reset()         { *m = ListRequest{} }
+func (m *ListRequest) String() string { return proto.CompactTextString(m) }
+func (*ListRequest) ProtoMessage()    {}
+func (*ListRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_6d4cfe162e62df58, []int{2}
+}
+
+func (m *ListRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListRequest.Unmarshal(m, b)
+}
+func (m *ListRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListRequest.Marshal(b, m, deterministic)
+}
+func (m *ListRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListRequest.Merge(m, src)
+}
+func (m *ListRequest) XXX_Size() int {
+	return xxx_messageInfo_ListRequest.Size(m)
+}
+func (m *ListRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListRequest proto.InternalMessageInfo
+
+func (m *ListRequest) GetOrgId() string {
+	if m != nil {
+		return m.OrgId
+	}
+	return ""
+}
+
+type ListReply struct {
+	Ids                  []string `protobuf:"bytes,1,rep,name=ids,proto3" json:"ids,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListReply) Reset()         { *m = ListReply{} }
+func (m *ListReply) String() string { return proto.CompactTextString(m) }
+func (*ListReply) ProtoMessage()    {}
+func (*ListReply) Descriptor() ([]byte, []int) {
+	return fileDescriptor_6d4cfe162e62df58, []int{3}
+}
+
+func (m *ListReply) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListReply.Unmarshal(m, b)
+}
+func (m *ListReply) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListReply.Marshal(b, m, deterministic)
+}
+func (m *ListReply) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListReply.Merge(m, src)
+}
+func (m *ListReply) XXX_Size() int {
+	return xxx_messageInfo_ListReply.Size(m)
+}
+func (m *ListReply) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListReply.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListReply proto.InternalMessageInfo
+
+func (m *ListReply) GetIds() []string {
+	if m != nil {
+		return m.Ids
+	}
+	return nil
+}
+
+type DeleteRequest struct {
+	Id                   string   `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	OrgId                string   `protobuf:"bytes,2,opt,name=org_id,json=orgId,proto3" json:"org_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DeleteRequest) Reset()         { *m = DeleteRequest{} }
+func (m *DeleteRequest) String() string { return proto.CompactTextString(m) }
+func (*DeleteRequest) ProtoMessage()    {}
+func (*DeleteRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_6d4cfe162e62df58, []int{4}
+}
+
+func (m *DeleteRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DeleteRequest.Unmarshal(m, b)
+}
+func (m *DeleteRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DeleteRequest.Marshal(b, m, deterministic)
+}
+func (m *DeleteRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DeleteRequest.Merge(m, src)
+}
+func (m *DeleteRequest) XXX_Size() int {
+	return xxx_messageInfo_DeleteRequest.Size(m)
+}
+func (m *DeleteRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_DeleteRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DeleteRequest proto.InternalMessageInfo
+
+func (m *DeleteRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *DeleteRequest) GetOrgId() string {
+	if m != nil {
+		return m.OrgId
+	}
+	return ""
+}
+
+type DeleteReply struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DeleteReply) Reset()         { *m = DeleteReply{} }
+func (m *DeleteReply) String() string { return proto.CompactTextString(m) }
+func (*DeleteReply) ProtoMessage()    {}
+func (*DeleteReply) Descriptor() ([]byte, []int) {
+	return fileDescriptor_6d4cfe162e62df58, []int{5}
+}
+
+func (m *DeleteReply) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DeleteReply.Unmarshal(m, b)
+}
+func (m *DeleteReply) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DeleteReply.Marshal(b, m, deterministic)
+}
+func (m *DeleteReply) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DeleteReply.Merge(m, src)
+}
+func (m *DeleteReply) XXX_Size() int {
+	return xxx_messageInfo_DeleteReply.Size(m)
+}
+func (m *DeleteReply) XXX_DiscardUnknown() {
+	xxx_messageInfo_DeleteReply.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DeleteReply proto.InternalMessageInfo
+
+type MetaRequest struct {
+	Ids                  []string `protobuf:"bytes,1,rep,name=ids,proto3" json:"ids,omitempty"`
+	OrgId                string   `protobuf:"bytes,2,opt,name=org_id,json=orgId,proto3" json:"org_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *MetaRequest) Reset()         { *m = MetaRequest{} }
+func (m *MetaRequest) String() string { return proto.CompactTextString(m) }
+func (*MetaRequest) ProtoMessage()    {}
+func (*MetaRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_6d4cfe162e62df58, []int{6}
+}
+
+func (m *MetaRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_MetaRequest.Unmarshal(m, b)
+}
+func (m *MetaRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_MetaRequest.Marshal(b, m, deterministic)
+}
+func (m *MetaRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MetaRequest.Merge(m, src)
+}
+func (m *MetaRequest) XXX_Size() int {
+	return xxx_messageInfo_MetaRequest.Size(m)
+}
+func (m *MetaRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_MetaRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MetaRequest proto.InternalMessageInfo
+
+func (m *MetaRequest) GetIds() []string {
+	if m != nil {
+		return m.Ids
+	}
+	return nil
+}
+
+func (m *MetaRequest) GetOrgId() string {
+	if m != nil {
+		return m.OrgId
+	}
+	return ""
+}
+
+type CertificateMeta struct {
+	Id                   string   `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Fingerprint          string   `protobuf:"bytes,2,opt,name=fingerprint,proto3" json:"fingerprint,omitempty"`
+	HasPrivate           bool     `protobuf:"varint,3,opt,name=has_private,json=hasPrivate,proto3" json:"has_private,omitempty"`
+	Issuer               string   `protobuf:"bytes,4,opt,name=issuer,proto3" json:"issuer,omitempty"`
+	Subject              string   `protobuf:"bytes,5,opt,name=subject,proto3" json:"subject,omitempty"`
+	NotBefore            int64    `protobuf:"varint,6,opt,name=not_before,json=notBefore,proto3" json:"not_before,omitempty"`
+	NotAfter             int64    `protobuf:"varint,7,opt,name=not_after,json=notAfter,proto3" json:"not_after,omitempty"`
+	DnsNames             []string `protobuf:"bytes,8,rep,name=dns_names,json=dnsNames,proto3" json:"dns_names,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *CertificateMeta) Reset()         { *m = CertificateMeta{} }
+func (m *CertificateMeta) String() string { return proto.CompactTextString(m) }
+func (*CertificateMeta) ProtoMessage()    {}
+func (*CertificateMeta) Descriptor() ([]byte, []int) {
+	return fileDescriptor_6d4cfe162e62df58, []int{7}
+}
+
+func (m *CertificateMeta) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CertificateMeta.Unmarshal(m, b)
+}
+func (m *CertificateMeta) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CertificateMeta.Marshal(b, m, deterministic)
+}
+func (m *CertificateMeta) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CertificateMeta.Merge(m, src)
+}
+func (m *CertificateMeta) XXX_Size() int {
+	return xxx_messageInfo_CertificateMeta.Size(m)
+}
+func (m *CertificateMeta) XXX_DiscardUnknown() {
+	xxx_messageInfo_CertificateMeta.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CertificateMeta proto.InternalMessageInfo
+
+func (m *CertificateMeta) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *CertificateMeta) GetFingerprint() string {
+	if m != nil {
+		return m.Fingerprint
+	}
+	return ""
+}
+
+func (m *CertificateMeta) GetHasPrivate() bool {
+	if m != nil {
+		return m.HasPrivate
+	}
+	return false
+}
+
+func (m *CertificateMeta) GetIssuer() string {
+	if m != nil {
+		return m.Issuer
+	}
+	return ""
+}
+
+func (m *CertificateMeta) GetSubject() string {
+	if m != nil {
+		return m.Subject
+	}
+	return ""
+}
+
+func (m *CertificateMeta) GetNotBefore() int64 {
+	if m != nil {
+		return m.NotBefore
+	}
+	return 0
+}
+
+func (m *CertificateMeta) GetNotAfter() int64 {
+	if m != nil {
+		return m.NotAfter
+	}
+	return 0
+}
+
+func (m *CertificateMeta) GetDnsNames() []string {
+	if m != nil {
+		return m.DnsNames
+	}
+	return nil
+}
+
+type MetaReply struct {
+	Certificates         []*CertificateMeta `protobuf:"bytes,1,rep,name=certificates,proto3" json:"certificates,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
+	XXX_unrecognized     []byte             `json:"-"`
+	XXX_sizecache        int32              `json:"-"`
+}
+
+func (m *MetaReply) Reset()         { *m = MetaReply{} }
+func (m *MetaReply) String() string { return proto.CompactTextString(m) }
+func (*MetaReply) ProtoMessage()    {}
+func (*MetaReply) Descriptor() ([]byte, []int) {
+	return fileDescriptor_6d4cfe162e62df58, []int{8}
+}
+
+func (m *MetaReply) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_MetaReply.Unmarshal(m, b)
+}
+func (m *MetaReply) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_MetaReply.Marshal(b, m, deterministic)
+}
+func (m *MetaReply) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MetaReply.Merge(m, src)
+}
+func (m *MetaReply) XXX_Size() int {
+	return xxx_messageInfo_MetaReply.Size(m)
+}
+func (m *MetaReply) XXX_DiscardUnknown() {
+	xxx_messageInfo_MetaReply.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MetaReply proto.InternalMessageInfo
+
+func (m *MetaReply) GetCertificates() []*CertificateMeta {
+	if m != nil {
+		return m.Certificates
+	}
+	return nil
+}
+
+type WatchRequest struct {
+	OrgId                string   `protobuf:"bytes,1,opt,name=org_id,json=orgId,proto3" json:"org_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *WatchRequest) Reset()         { *m = WatchRequest{} }
+func (m *WatchRequest) String() string { return proto.CompactTextString(m) }
+func (*WatchRequest) ProtoMessage()    {}
+func (*WatchRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_6d4cfe162e62df58, []int{9}
+}
+
+func (m *WatchRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_WatchRequest.Unmarshal(m, b)
+}
+func (m *WatchRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_WatchRequest.Marshal(b, m, deterministic)
+}
+func (m *WatchRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_WatchRequest.Merge(m, src)
+}
+func (m *WatchRequest) XXX_Size() int {
+	return xxx_messageInfo_WatchRequest.Size(m)
+}
+func (m *WatchRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_WatchRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_WatchRequest proto.InternalMessageInfo
+
+func (m *WatchRequest) GetOrgId() string {
+	if m != nil {
+		return m.OrgId
+	}
+	return ""
+}
+
+type ChangeEvent struct {
+	Type                 string   `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	Id                   string   `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ChangeEvent) Reset()         { *m = ChangeEvent{} }
+func (m *ChangeEvent) String() string { return proto.CompactTextString(m) }
+func (*ChangeEvent) ProtoMessage()    {}
+func (*ChangeEvent) Descriptor() ([]byte, []int) {
+	return fileDescriptor_6d4cfe162e62df58, []int{10}
+}
+
+func (m *ChangeEvent) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ChangeEvent.Unmarshal(m, b)
+}
+func (m *ChangeEvent) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ChangeEvent.Marshal(b, m, deterministic)
+}
+func (m *ChangeEvent) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ChangeEvent.Merge(m, src)
+}
+func (m *ChangeEvent) XXX_Size() int {
+	return xxx_messageInfo_ChangeEvent.Size(m)
+}
+func (m *ChangeEvent) XXX_DiscardUnknown() {
+	xxx_messageInfo_ChangeEvent.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ChangeEvent proto.InternalMessageInfo
+
+func (m *ChangeEvent) GetType() string {
+	if m != nil {
+		return m.Type
+	}
+	return ""
+}
+
+func (m *ChangeEvent) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterType((*AddRequest)(nil), "certspb.AddRequest")
+	proto.RegisterType((*AddReply)(nil), "certspb.AddReply")
+	proto.RegisterType((*ListRequest)(nil), "certspb.ListRequest")
+	proto.RegisterType((*ListReply)(nil), "certspb.ListReply")
+	proto.RegisterType((*DeleteRequest)(nil), "certspb.DeleteRequest")
+	proto.RegisterType((*DeleteReply)(nil), "certspb.DeleteReply")
+	proto.RegisterType((*MetaRequest)(nil), "certspb.MetaRequest")
+	proto.RegisterType((*CertificateMeta)(nil), "certspb.CertificateMeta")
+	proto.RegisterType((*MetaReply)(nil), "certspb.MetaReply")
+	proto.RegisterType((*WatchRequest)(nil), "certspb.WatchRequest")
+	proto.RegisterType((*ChangeEvent)(nil), "certspb.ChangeEvent")
+}
+
+func init() { proto.RegisterFile("certificates.proto", fileDescriptor_6d4cfe162e62df58) }
+
+var fileDescriptor_6d4cfe162e62df58 = []byte{
+	// 494 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0x03, 0x85, 0x53, 0x4d, 0x6f, 0xd3, 0x40,
+	0x10, 0xad, 0xe3, 0xc4, 0x71, 0xc6, 0x29, 0x1f, 0x43, 0x5b, 0xad, 0x82, 0x0a, 0xd5, 0xaa, 0x48,
+	0x9c, 0x02, 0x04, 0x09, 0x71, 0xe0, 0x52, 0x0a, 0x87, 0x4a, 0x80, 0x90, 0x25, 0xc4, 0xd1, 0xda,
+	0xc4, 0x9b, 0xc6, 0xa8, 0xb5, 0x8d, 0x77, 0x53, 0xa9, 0xbf, 0x85, 0x1f, 0xc9, 0x5f, 0x60, 0x76,
+	0xfd, 0x91, 0x4d, 0xaa, 0x8a, 0xdb, 0xce, 0x7b, 0x33, 0xf3, 0xc6, 0x2f, 0x2f, 0x80, 0x0b, 0x59,
+	0xe9, 0x6c, 0x99, 0x2d, 0x84, 0x96, 0x6a, 0x5a, 0x56, 0x85, 0x2e, 0x70, 0x68, 0x30, 0x55, 0xce,
+	0xf9, 0x0f, 0x80, 0xb3, 0x34, 0x8d, 0xe5, 0xef, 0xb5, 0x54, 0x1a, 0x1f, 0x81, 0x5f, 0xca, 0x6b,
+	0xe6, 0x9d, 0x78, 0x2f, 0xc7, 0xb1, 0x79, 0xe2, 0x21, 0x04, 0x45, 0x75, 0x99, 0x64, 0x29, 0xeb,
+	0x11, 0x38, 0x8a, 0x07, 0x54, 0x5d, 0xa4, 0xf8, 0x0c, 0xa0, 0x14, 0x4a, 0x95, 0xab, 0x4a, 0x28,
+	0xc9, 0x7c, 0x4b, 0x39, 0x08, 0x9f, 0x40, 0x68, 0xd7, 0x96, 0x57, 0xb7, 0xf8, 0x00, 0x7a, 0x34,
+	0xee, 0xd9, 0x1e, 0x7a, 0xf1, 0x53, 0x88, 0xbe, 0x64, 0x4a, 0xb7, 0x9a, 0x1b, 0x05, 0xcf, 0x51,
+	0xe0, 0xc7, 0x30, 0xaa, 0xbb, 0xcc, 0x0a, 0xba, 0x2b, 0x4b, 0x15, 0x35, 0xf8, 0xd4, 0x60, 0x9e,
+	0xfc, 0x1d, 0xec, 0x7f, 0x92, 0x57, 0x52, 0xcb, 0x76, 0xcd, 0x8e, 0xca, 0x3d, 0x87, 0xf3, 0x7d,
+	0x88, 0xda, 0x39, 0x5a, 0x4c, 0x6b, 0xa2, 0xaf, 0x52, 0x0b, 0xe7, 0xfb, 0xb7, 0x75, 0xee, 0x5b,
+	0xf3, 0xd7, 0x83, 0x87, 0xe7, 0x1b, 0x5b, 0xcd, 0x8e, 0x3b, 0x17, 0x9c, 0x40, 0xb4, 0xcc, 0xf2,
+	0x4b, 0x59, 0x95, 0x55, 0x96, 0xeb, 0x66, 0xde, 0x85, 0xf0, 0x39, 0x44, 0x2b, 0xa1, 0x12, 0x2a,
+	0x6e, 0x68, 0x89, 0xb5, 0x31, 0x8c, 0x81, 0xa0, 0xef, 0x35, 0x82, 0x47, 0x10, 0x64, 0x4a, 0xad,
+	0x65, 0xc5, 0xfa, 0x76, 0xba, 0xa9, 0x90, 0xc1, 0x50, 0xad, 0xe7, 0xbf, 0xe4, 0x42, 0xb3, 0x81,
+	0x25, 0xda, 0x12, 0x8f, 0x01, 0xf2, 0x42, 0x27, 0x73, 0xb9, 0x2c, 0x2a, 0xc9, 0x02, 0x22, 0xfd,
+	0x78, 0x44, 0xc8, 0x47, 0x0b, 0xe0, 0x53, 0x30, 0x45, 0x22, 0x96, 0x9a, 0x76, 0x0e, 0x2d, 0x1b,
+	0x12, 0x70, 0x66, 0x6a, 0x43, 0xa6, 0xb9, 0x4a, 0x72, 0x71, 0x2d, 0x15, 0x0b, 0xad, 0x07, 0x21,
+	0x01, 0xdf, 0x4c, 0xcd, 0x2f, 0x60, 0x54, 0x3b, 0x65, 0x7e, 0x8f, 0x0f, 0x30, 0x76, 0x43, 0x65,
+	0x0d, 0x8b, 0x66, 0x6c, 0xda, 0xa4, 0x6a, 0xba, 0x63, 0x4d, 0xbc, 0xd5, 0xcd, 0x5f, 0xc0, 0xf8,
+	0xa7, 0xd0, 0x8b, 0xd5, 0x7f, 0x12, 0xf0, 0x06, 0xa2, 0xf3, 0x95, 0x20, 0xb7, 0x3e, 0xdf, 0x48,
+	0x32, 0x0b, 0xa1, 0xaf, 0x6f, 0x4b, 0xd9, 0xf4, 0xd8, 0x77, 0x63, 0x79, 0xaf, 0xb5, 0x7c, 0xf6,
+	0xa7, 0x07, 0x63, 0x47, 0x5b, 0xe1, 0x2b, 0xf0, 0x29, 0x87, 0xf8, 0xa4, 0xbb, 0x6c, 0x13, 0xf6,
+	0xc9, 0xe3, 0x6d, 0xd0, 0xc4, 0x61, 0x0f, 0x67, 0xd0, 0x37, 0xb1, 0xc3, 0x83, 0x8e, 0x74, 0xb2,
+	0x3a, 0xc1, 0x1d, 0xb4, 0x9e, 0x79, 0x0f, 0x41, 0x9d, 0x29, 0x3c, 0xea, 0xf8, 0xad, 0x70, 0x4e,
+	0x0e, 0xee, 0xe0, 0x9d, 0x9a, 0x8d, 0xce, 0x86, 0x77, 0xd2, 0xe8, 0xa8, 0x75, 0xce, 0x5b, 0xb5,
+	0x81, 0x75, 0x0f, 0x0f, 0x3b, 0xda, 0x75, 0xd3, 0xd1, 0x72, 0xdc, 0xe3, 0x7b, 0xaf, 0xbd, 0x79,
+	0x60, 0xff, 0xfb, 0x6f, 0xff, 0x01, 0x7a, 0x1a, 0x51, 0x55, 0x11, 0x04, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// CertificatesClient is the client API for Certificates service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type CertificatesClient interface {
+	Add(ctx context.Context, in *AddRequest, opts ...grpc.CallOption) (*AddReply, error)
+	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListReply, error)
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteReply, error)
+	Meta(ctx context.Context, in *MetaRequest, opts ...grpc.CallOption) (*MetaReply, error)
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Certificates_WatchClient, error)
+}
+
+type certificatesClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewCertificatesClient(cc *grpc.ClientConn) CertificatesClient {
+	return &certificatesClient{cc}
+}
+
+func (c *certificatesClient) Add(ctx context.Context, in *AddRequest, opts ...grpc.CallOption) (*AddReply, error) {
+	out := new(AddReply)
+	err := c.cc.Invoke(ctx, "/certspb.Certificates/Add", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *certificatesClient) List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListReply, error) {
+	out := new(ListReply)
+	err := c.cc.Invoke(ctx, "/certspb.Certificates/List", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *certificatesClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteReply, error) {
+	out := new(DeleteReply)
+	err := c.cc.Invoke(ctx, "/certspb.Certificates/Delete", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *certificatesClient) Meta(ctx context.Context, in *MetaRequest, opts ...grpc.CallOption) (*MetaReply, error) {
+	out := new(MetaReply)
+	err := c.cc.Invoke(ctx, "/certspb.Certificates/Meta", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *certificatesClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Certificates_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Certificates_serviceDesc.Streams[0], "/certspb.Certificates/Watch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &certificatesWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Certificates_WatchClient interface {
+	Recv() (*ChangeEvent, error)
+	grpc.ClientStream
+}
+
+type certificatesWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *certificatesWatchClient) Recv() (*ChangeEvent, error) {
+	m := new(ChangeEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// CertificatesServer is the server API for Certificates service.
+type CertificatesServer interface {
+	Add(context.Context, *AddRequest) (*AddReply, error)
+	List(context.Context, *ListRequest) (*ListReply, error)
+	Delete(context.Context, *DeleteRequest) (*DeleteReply, error)
+	Meta(context.Context, *MetaRequest) (*MetaReply, error)
+	Watch(*WatchRequest, Certificates_WatchServer) error
+}
+
+func RegisterCertificatesServer(s *grpc.Server, srv CertificatesServer) {
+	s.RegisterService(&_Certificates_serviceDesc, srv)
+}
+
+func _Certificates_Add_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CertificatesServer).Add(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/certspb.Certificates/Add",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CertificatesServer).Add(ctx, req.(*AddRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Certificates_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CertificatesServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/certspb.Certificates/List",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CertificatesServer).List(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Certificates_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CertificatesServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/certspb.Certificates/Delete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CertificatesServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Certificates_Meta_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MetaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CertificatesServer).Meta(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/certspb.Certificates/Meta",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CertificatesServer).Meta(ctx, req.(*MetaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Certificates_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CertificatesServer).Watch(m, &certificatesWatchServer{stream})
+}
+
+type Certificates_WatchServer interface {
+	Send(*ChangeEvent) error
+	grpc.ServerStream
+}
+
+type certificatesWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *certificatesWatchServer) Send(m *ChangeEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _Certificates_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "certspb.Certificates",
+	HandlerType: (*CertificatesServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Add",
+			Handler:    _Certificates_Add_Handler,
+		},
+		{
+			MethodName: "List",
+			Handler:    _Certificates_List_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _Certificates_Delete_Handler,
+		},
+		{
+			MethodName: "Meta",
+			Handler:    _Certificates_Meta_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _Certificates_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "certificates.proto",
+}
@@ -0,0 +1,212 @@
+package certs
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// maxIntermediateFetches limits intermediates fetched for one chain.
+	maxIntermediateFetches = 4
+	maxIntermediateSize    = 64 << 10
+)
+
+var intermediateClient = &http.Client{Timeout: 10 * time.Second}
+
+// SetFetchIntermediates enables completing added certificate chains with
+// intermediates downloaded from Authority Information Access URLs of the
+// certificates.
+func (c *CertificateManager) SetFetchIntermediates(enabled bool) {
+	c.mu.Lock()
+	c.fetchIntermediates = enabled
+	c.mu.Unlock()
+}
+
+// normalizeChain orders certificates of a bundle from the leaf to the
+// intermediates, as TLS requires, optionally completing the chain. Bundles
+// with certificates which are not part of the leaf chain, or whose
+// signatures don't verify, are rejected. The leaf is the certificate of the
+// private key if one is given, otherwise the certificate which issued none
+// of the others.
+func (c *CertificateManager) normalizeChain(certBlocks [][]byte, key crypto.PublicKey) ([][]byte, error) {
+	if len(certBlocks) == 0 {
+		return certBlocks, nil
+	}
+
+	certs := make([]*x509.Certificate, len(certBlocks))
+	for i, certPEM := range certBlocks {
+		block, _ := pem.Decode(certPEM)
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.New("Error while parsing certificate: " + err.Error())
+		}
+		certs[i] = cert
+	}
+
+	leaf, err := findLeaf(certs, key)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := []*x509.Certificate{certs[leaf]}
+	rest := append(append([]*x509.Certificate{}, certs[:leaf]...), certs[leaf+1:]...)
+
+	for len(rest) > 0 {
+		last := chain[len(chain)-1]
+		issuer := -1
+		for i, cert := range rest {
+			if bytes.Equal(last.RawIssuer, cert.RawSubject) && last.CheckSignatureFrom(cert) == nil {
+				issuer = i
+				break
+			}
+		}
+
+		if issuer < 0 {
+			if isSelfSigned(last) {
+				return nil, errors.New("Certificate bundle contains certificates which are not part of the chain")
+			}
+			return nil, errors.New("Certificate chain doesn't verify: issuer of " + last.Subject.String() + " not found")
+		}
+
+		chain = append(chain, rest[issuer])
+		rest = append(rest[:issuer], rest[issuer+1:]...)
+	}
+
+	c.mu.RLock()
+	fetch := c.fetchIntermediates
+	c.mu.RUnlock()
+
+	if fetch {
+		chain = c.completeChain(chain)
+	}
+
+	out := make([][]byte, len(chain))
+	for i, cert := range chain {
+		out[i] = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+
+	return out, nil
+}
+
+func findLeaf(certs []*x509.Certificate, key crypto.PublicKey) (int, error) {
+	if key != nil {
+		keyDer, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			return 0, err
+		}
+
+		for i, cert := range certs {
+			if bytes.Equal(cert.RawSubjectPublicKeyInfo, keyDer) {
+				return i, nil
+			}
+		}
+
+		return 0, ErrKeyMismatch
+	}
+
+	leaf := -1
+	for i, cert := range certs {
+		issuesOther := false
+		for j, other := range certs {
+			if i != j && bytes.Equal(other.RawIssuer, cert.RawSubject) && other.CheckSignatureFrom(cert) == nil {
+				issuesOther = true
+				break
+			}
+		}
+
+		if !issuesOther {
+			if leaf >= 0 {
+				return 0, errors.New("Certificate bundle contains more than one leaf certificate")
+			}
+			leaf = i
+		}
+	}
+
+	// Every certificate issues another one only in cyclic bundles
+	if leaf < 0 {
+		return 0, errors.New("Certificate bundle has no leaf certificate")
+	}
+
+	return leaf, nil
+}
+
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) &&
+		cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+// completeChain appends intermediates missing from the chain, fetched from
+// issuer URLs. Roots are not appended, since clients should have them. Chain
+// is returned as is if an intermediate can't be fetched.
+func (c *CertificateManager) completeChain(chain []*x509.Certificate) []*x509.Certificate {
+	for i := 0; i < maxIntermediateFetches; i++ {
+		last := chain[len(chain)-1]
+		if isSelfSigned(last) || len(last.IssuingCertificateURL) == 0 {
+			break
+		}
+
+		issuer, err := fetchIssuer(last)
+		if err != nil {
+			c.logger.Warning("Can't fetch issuer of ", last.Subject.String(), ": ", err)
+			break
+		}
+
+		if isSelfSigned(issuer) {
+			break
+		}
+
+		chain = append(chain, issuer)
+	}
+
+	return chain
+}
+
+func fetchIssuer(cert *x509.Certificate) (*x509.Certificate, error) {
+	var lastErr error
+
+	for _, url := range cert.IssuingCertificateURL {
+		resp, err := intermediateClient.Get(url)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		data, err := ioutil.ReadAll(http.MaxBytesReader(nil, resp.Body, maxIntermediateSize))
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			lastErr = errors.New("Issuer URL returned status " + strconv.Itoa(resp.StatusCode))
+			continue
+		}
+
+		// Issuers are usually DER encoded, but some are served as PEM
+		if block, _ := pem.Decode(data); block != nil {
+			data = block.Bytes
+		}
+
+		issuer, err := x509.ParseCertificate(data)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if err := cert.CheckSignatureFrom(issuer); err != nil {
+			lastErr = errors.New("Fetched issuer doesn't sign the certificate")
+			continue
+		}
+
+		return issuer, nil
+	}
+
+	return nil, lastErr
+}
@@ -0,0 +1,120 @@
+package certs
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChainNormalization(t *testing.T) {
+	ca, caKey := genSignedCertificate(&x509.Certificate{
+		Subject:  pkix.Name{CommonName: "ca"},
+		IsCA:     true,
+		KeyUsage: x509.KeyUsageCertSign,
+	}, nil, nil)
+
+	var intermediateDER []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/intermediate.cer":
+			w.Write(intermediateDER)
+		case "/ca.cer":
+			w.Write(ca.Raw)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	intermediate, intermediateKey := genSignedCertificate(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "intermediate"},
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		IssuingCertificateURL: []string{server.URL + "/ca.cer"},
+	}, ca, caKey)
+	intermediateDER = intermediate.Raw
+
+	leaf, leafKey := genSignedCertificate(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "leaf"},
+		IssuingCertificateURL: []string{server.URL + "/intermediate.cer"},
+	}, intermediate, intermediateKey)
+
+	encode := func(certs ...*x509.Certificate) []byte {
+		var out []byte
+		for _, cert := range certs {
+			out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+		}
+		return out
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(leafKey)})
+
+	chainOf := func(m *CertificateManager, certID string) (names []string) {
+		certs := m.List([]string{certID}, CertificateAny)
+		if len(certs) != 1 || certs[0] == nil {
+			t.Fatal("Certificate should be loaded")
+		}
+
+		for _, der := range certs[0].Certificate {
+			cert, _ := x509.ParseCertificate(der)
+			names = append(names, cert.Subject.CommonName)
+		}
+		return names
+	}
+
+	t.Run("Out of order", func(t *testing.T) {
+		m := newManager()
+
+		certID, err := m.Add(append(encode(intermediate, leaf), keyPEM...), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if certID != HexSHA256(leaf.Raw) {
+			t.Error("Certificate ID should be the leaf fingerprint")
+		}
+		if names := chainOf(m, certID); strings.Join(names, ",") != "leaf,intermediate" {
+			t.Error("Chain should be ordered from the leaf", names)
+		}
+
+		// Without private key the leaf is found by issuers
+		m = newManager()
+		certID, err = m.Add(encode(ca, leaf, intermediate), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if names := chainOf(m, certID); strings.Join(names, ",") != "leaf,intermediate,ca" {
+			t.Error("Chain should be ordered from the leaf", names)
+		}
+	})
+
+	t.Run("Broken chain", func(t *testing.T) {
+		m := newManager()
+
+		if _, err := m.Add(append(encode(leaf, ca), keyPEM...), ""); err == nil {
+			t.Error("Chain with missing intermediate should be rejected")
+		}
+
+		other, _ := genSignedCertificate(&x509.Certificate{Subject: pkix.Name{CommonName: "other"}}, nil, nil)
+		if _, err := m.Add(encode(leaf, intermediate, other), ""); err == nil {
+			t.Error("Bundle with unrelated certificate should be rejected")
+		}
+	})
+
+	t.Run("Completion", func(t *testing.T) {
+		m := newManager()
+		m.SetFetchIntermediates(true)
+
+		certID, err := m.Add(append(encode(leaf), keyPEM...), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if names := chainOf(m, certID); strings.Join(names, ",") != "leaf,intermediate" {
+			t.Error("Missing intermediate should be fetched, without root", names)
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"time"
+)
+
+// ContextStorageHandler is implemented by storage backends which can abort
+// operations when the context is done. Operations of other backends are run
+// in background, and abandoned when the context is done.
+type ContextStorageHandler interface {
+	GetKeyContext(ctx context.Context, key string) (string, error)
+	SetKeyContext(ctx context.Context, key, value string, ttl int64) error
+	DeleteKeyContext(ctx context.Context, key string) bool
+}
+
+// withContext runs fn, returning the context error instead of waiting for it
+// once the context is done. Results of abandoned fn must not be used.
+func withContext(ctx context.Context, fn func()) error {
+	if ctx.Done() == nil {
+		fn()
+		return nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		fn()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// detachedContext keeps values of the parent context, without its deadline
+// and cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (deadline time.Time, ok bool) { return }
+func (detachedContext) Done() <-chan struct{}                   { return nil }
+func (detachedContext) Err() error                              { return nil }
+func (c detachedContext) Value(key interface{}) interface{}     { return c.parent.Value(key) }
+
+func (c *CertificateManager) getKey(ctx context.Context, key string) (string, error) {
+	if storage, ok := c.storage.(ContextStorageHandler); ok {
+		return storage.GetKeyContext(ctx, key)
+	}
+
+	var val string
+	var err error
+	if ctxErr := withContext(ctx, func() { val, err = c.storage.GetKey(key) }); ctxErr != nil {
+		return "", ctxErr
+	}
+
+	return val, err
+}
+
+func (c *CertificateManager) setKey(ctx context.Context, key, value string, ttl int64) error {
+	if storage, ok := c.storage.(ContextStorageHandler); ok {
+		return storage.SetKeyContext(ctx, key, value, ttl)
+	}
+
+	var err error
+	if ctxErr := withContext(ctx, func() { err = c.storage.SetKey(key, value, ttl) }); ctxErr != nil {
+		return ctxErr
+	}
+
+	return err
+}
+
+func (c *CertificateManager) deleteKey(ctx context.Context, key string) error {
+	if storage, ok := c.storage.(ContextStorageHandler); ok {
+		storage.DeleteKeyContext(ctx, key)
+		return ctx.Err()
+	}
+
+	return withContext(ctx, func() { c.storage.DeleteKey(key) })
+}
+
+// readFile is ioutil.ReadFile giving up when the context is done.
+func readFile(ctx context.Context, path string) ([]byte, error) {
+	var data []byte
+	var err error
+	if ctxErr := withContext(ctx, func() { data, err = ioutil.ReadFile(path) }); ctxErr != nil {
+		return nil, ctxErr
+	}
+
+	return data, err
+}
+
+// fetchSource fetches the certificate from the source, giving up when the
+// context is done.
+func fetchSource(ctx context.Context, source CertificateSource, id string) ([]byte, error) {
+	var data []byte
+	var err error
+	if ctxErr := withContext(ctx, func() { data, err = source.Fetch(id) }); ctxErr != nil {
+		return nil, ctxErr
+	}
+
+	return data, err
+}
+
+// ListContext is List which gives up when the context is done, returning the
+// context error.
+func (c *CertificateManager) ListContext(ctx context.Context, certIDs []string, mode CertificateType) ([]*tls.Certificate, error) {
+	return c.list(ctx, certIDs, mode, true)
+}
+
+// AddContext is Add which gives up when the context is done. The certificate
+// may still be stored if the context is done during the write.
+func (c *CertificateManager) AddContext(ctx context.Context, certData []byte, orgID string) (string, error) {
+	return c.AuditedBy("").AddContext(ctx, certData, orgID)
+}
+
+// DeleteContext is Delete which gives up when the context is done.
+func (c *CertificateManager) DeleteContext(ctx context.Context, certID string) error {
+	return c.AuditedBy("").DeleteContext(ctx, certID)
+}
+
+// GetRawContext is GetRaw which gives up when the context is done.
+func (c *CertificateManager) GetRawContext(ctx context.Context, certID string) (string, error) {
+	return c.AuditedBy("").GetRawContext(ctx, certID)
+}
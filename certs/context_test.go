@@ -0,0 +1,181 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowStorage blocks reads until released.
+type slowStorage struct {
+	*dummyStorage
+	release chan struct{}
+}
+
+func (s *slowStorage) GetKey(key string) (string, error) {
+	<-s.release
+	return s.dummyStorage.GetKey(key)
+}
+
+// contextStorage records contexts passed to the storage.
+type contextStorage struct {
+	*dummyStorage
+	contexts []context.Context
+}
+
+func (s *contextStorage) GetKeyContext(ctx context.Context, key string) (string, error) {
+	s.contexts = append(s.contexts, ctx)
+	return s.GetKey(key)
+}
+
+func (s *contextStorage) SetKeyContext(ctx context.Context, key, value string, ttl int64) error {
+	s.contexts = append(s.contexts, ctx)
+	return s.SetKey(key, value, ttl)
+}
+
+func (s *contextStorage) DeleteKeyContext(ctx context.Context, key string) bool {
+	s.contexts = append(s.contexts, ctx)
+	return s.DeleteKey(key)
+}
+
+func TestContext(t *testing.T) {
+	certPem, _ := genCertificateFromCommonName("context")
+
+	t.Run("Slow storage", func(t *testing.T) {
+		storage := &slowStorage{dummyStorage: newDummyStorage(), release: make(chan struct{})}
+		defer close(storage.release)
+
+		m := NewCertificateManager(storage, "test", nil)
+		certID := HexSHA256([]byte("context"))
+		storage.dummyStorage.SetKey("raw-"+certID, string(certPem), 0)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		certs, err := m.ListContext(ctx, []string{certID}, CertificateAny)
+		if !errors.Is(err, context.DeadlineExceeded) || certs != nil {
+			t.Error("Slow storage read should be given up", certs, err)
+		}
+		if time.Since(start) > time.Second {
+			t.Error("List should return after the deadline")
+		}
+
+		if _, err := m.GetRawContext(ctx, certID); !errors.Is(err, context.DeadlineExceeded) {
+			t.Error("Slow raw read should be given up", err)
+		}
+
+		if _, err := m.AddContext(ctx, certPem, ""); !errors.Is(err, context.DeadlineExceeded) {
+			t.Error("Add should be given up", err)
+		}
+	})
+
+	t.Run("Context storage", func(t *testing.T) {
+		storage := &contextStorage{dummyStorage: newDummyStorage()}
+		m := NewCertificateManager(storage, "test", nil)
+
+		type key struct{}
+		ctx := context.WithValue(context.Background(), key{}, "value")
+
+		certID, err := m.AddContext(ctx, certPem, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var certs []*tls.Certificate
+		if certs, err = m.ListContext(ctx, []string{certID}, CertificateAny); err != nil || len(certs) != 1 || certs[0] == nil {
+			t.Fatal("Certificate should be listed", certs, err)
+		}
+
+		if err := m.DeleteContext(ctx, certID); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(storage.contexts) == 0 {
+			t.Fatal("Context should be passed to the storage")
+		}
+		for _, c := range storage.contexts {
+			if c.Value(key{}) != "value" {
+				t.Error("Storage should receive the caller context")
+			}
+		}
+	})
+
+	t.Run("File", func(t *testing.T) {
+		m := newManager()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if _, err := m.ListContext(ctx, []string{"testdata/missing.pem"}, CertificateAny); !errors.Is(err, context.Canceled) {
+			t.Error("File read should not start with cancelled context", err)
+		}
+	})
+}
+
+func TestSharedLoad(t *testing.T) {
+	storage := &slowStorage{dummyStorage: newDummyStorage(), release: make(chan struct{})}
+	m := NewCertificateManager(storage, "test", nil)
+
+	certPem, _ := genCertificateFromCommonName("shared")
+	certID := HexSHA256([]byte("shared"))
+	storage.dummyStorage.SetKey("raw-"+certID, string(certPem), 0)
+
+	var wg sync.WaitGroup
+	var loaded int64
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if certs := m.List([]string{certID}, CertificateAny); len(certs) == 1 && certs[0] != nil {
+				atomic.AddInt64(&loaded, 1)
+			}
+		}()
+	}
+
+	// Storage is read for the certificate and its key passphrase
+	storage.release <- struct{}{}
+	storage.release <- struct{}{}
+	wg.Wait()
+
+	if loaded != 10 {
+		t.Error("Certificate should be loaded for every caller, got", loaded)
+	}
+
+	select {
+	case storage.release <- struct{}{}:
+		t.Error("Certificate should be read from storage once")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	t.Run("Caller gives up", func(t *testing.T) {
+		otherPem, _ := genCertificateFromCommonName("other")
+		otherID := HexSHA256([]byte("other"))
+		storage.dummyStorage.SetKey("raw-"+otherID, string(otherPem), 0)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if _, err := m.ListContext(ctx, []string{otherID}, CertificateAny); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatal("Caller should give up", err)
+		}
+
+		storage.release <- struct{}{}
+		storage.release <- struct{}{}
+
+		// Abandoned load completes in background
+		deadline := time.Now().Add(time.Second)
+		for {
+			if _, found := m.cache.Get(otherID); found {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("Abandoned load should be cached")
+			}
+			time.Sleep(time.Millisecond)
+		}
+	})
+}
@@ -0,0 +1,243 @@
+package certs
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	crlPrefix = "crl-"
+
+	defaultCRLRefreshInterval = time.Hour
+)
+
+// RevocationChecker reports whether a certificate has been revoked. Issuer is
+// nil if the issuing certificate is not known.
+type RevocationChecker interface {
+	IsRevoked(cert, issuer *x509.Certificate) (bool, error)
+}
+
+// CRLManager keeps certificate revocation lists uploaded to storage or loaded
+// from URLs, and checks certificates against them.
+type CRLManager struct {
+	storage StorageHandler
+	logger  *logrus.Entry
+	client  *http.Client
+
+	sources []string
+
+	mu    sync.RWMutex
+	lists map[string]*pkix.CertificateList
+	stop  chan struct{}
+}
+
+// NewCRLManager creates CRL manager which uses all stored CRLs, and CRLs
+// downloaded from the given http(s) URLs of CRL distribution points.
+func NewCRLManager(storage StorageHandler, sources []string, logger *logrus.Logger) *CRLManager {
+	if logger == nil {
+		logger = logrus.New()
+	}
+
+	return &CRLManager{
+		storage: storage,
+		logger:  logger.WithFields(logrus.Fields{"prefix": "crl"}),
+		client:  &http.Client{Timeout: 30 * time.Second},
+		sources: sources,
+		lists:   make(map[string]*pkix.CertificateList),
+	}
+}
+
+func isURL(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Add stores PEM or DER encoded CRL and returns its ID.
+func (m *CRLManager) Add(data []byte) (string, error) {
+	crl, err := x509.ParseCRL(data)
+	if err != nil {
+		err = errors.New("Error while parsing CRL: " + err.Error())
+		m.logger.Error(err)
+		return "", err
+	}
+
+	der := data
+	if block, _ := pem.Decode(data); block != nil {
+		der = block.Bytes
+	}
+
+	crlID := HexSHA256(der)
+	if err := m.storage.SetKey(crlPrefix+crlID, string(data), 0); err != nil {
+		m.logger.Error(err)
+		return "", err
+	}
+
+	m.mu.Lock()
+	m.lists[crlID] = crl
+	m.mu.Unlock()
+
+	return crlID, nil
+}
+
+// Delete removes stored CRL and stops using it.
+func (m *CRLManager) Delete(crlID string) {
+	m.storage.DeleteKey(crlPrefix + crlID)
+
+	m.mu.Lock()
+	delete(m.lists, crlID)
+	m.mu.Unlock()
+}
+
+func (m *CRLManager) load(source string) ([]byte, error) {
+	if !isURL(source) {
+		val, err := m.storage.GetKey(crlPrefix + source)
+		return []byte(val), err
+	}
+
+	resp, err := m.client.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("Unexpected response status: " + resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// ListAllIds returns IDs of all stored CRLs.
+func (m *CRLManager) ListAllIds() (out []string) {
+	for _, key := range m.storage.GetKeys(crlPrefix + "*") {
+		out = append(out, strings.TrimPrefix(key, crlPrefix))
+	}
+
+	return out
+}
+
+// Refresh reloads stored CRLs and CRL URLs. Previously loaded list is kept if
+// source can't be loaded.
+func (m *CRLManager) Refresh() {
+	stored := m.ListAllIds()
+	sources := append(stored, m.sources...)
+
+	m.mu.Lock()
+	// Forget deleted CRLs
+	for source := range m.lists {
+		if !isURL(source) && !containsString(stored, source) {
+			delete(m.lists, source)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, source := range sources {
+		data, err := m.load(source)
+		if err != nil {
+			m.logger.Error("Can't load CRL ", source, ": ", err)
+			continue
+		}
+
+		crl, err := x509.ParseCRL(data)
+		if err != nil {
+			m.logger.Error("Can't parse CRL ", source, ": ", err)
+			continue
+		}
+
+		if crl.HasExpired(time.Now()) {
+			m.logger.Warning("CRL ", source, " is outdated, next update was due ", crl.TBSCertList.NextUpdate)
+		}
+
+		m.mu.Lock()
+		m.lists[source] = crl
+		m.mu.Unlock()
+	}
+}
+
+// IsRevoked checks if certificate serial number is listed in one of the CRLs
+// issued by the certificate issuer. If issuer is known, CRL signature is
+// verified as well.
+func (m *CRLManager) IsRevoked(cert, issuer *x509.Certificate) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, crl := range m.lists {
+		var issuerName pkix.Name
+		issuerName.FillFromRDNSequence(&crl.TBSCertList.Issuer)
+		if issuerName.String() != cert.Issuer.String() {
+			continue
+		}
+
+		if issuer != nil && issuer.CheckCRLSignature(crl) != nil {
+			continue
+		}
+
+		for _, revoked := range crl.TBSCertList.RevokedCertificates {
+			if revoked.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// Start loads CRLs and keeps refreshing them on every interval until Stop is called.
+func (m *CRLManager) Start(interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultCRLRefreshInterval
+	}
+
+	m.mu.Lock()
+	if m.stop != nil {
+		m.mu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	m.stop = stop
+	m.mu.Unlock()
+
+	m.Refresh()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				m.Refresh()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func (m *CRLManager) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+}
@@ -0,0 +1,90 @@
+package certs
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCRLManager(t *testing.T) {
+	m := newManager()
+	crls := NewCRLManager(m.storage, nil, nil)
+	m.AddRevocationChecker(crls)
+
+	ca, caKey := genSignedCertificate(&x509.Certificate{
+		Subject:  pkix.Name{CommonName: "ca"},
+		IsCA:     true,
+		KeyUsage: x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}, nil, nil)
+	client, _ := genSignedCertificate(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "client"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+	revoked, _ := genSignedCertificate(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "revoked"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+
+	crlDER, _ := ca.CreateCRL(rand.Reader, caKey, []pkix.RevokedCertificate{
+		{SerialNumber: revoked.SerialNumber, RevocationTime: time.Now()},
+	}, time.Now(), time.Now().Add(time.Hour))
+
+	caID, _ := m.Add(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}), "")
+
+	validate := func(cert *x509.Certificate) error {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+		return m.ValidateRequestCertificateWithOptions([]string{caID}, r, ValidationOptions{VerifyChain: true})
+	}
+
+	if err := validate(revoked); err != nil {
+		t.Fatal("Should be valid before CRL is added", err)
+	}
+
+	if _, err := crls.Add([]byte("invalid")); err == nil {
+		t.Error("Should fail on invalid CRL")
+	}
+
+	crlID, err := crls.Add(pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crlDER}))
+	if err != nil {
+		t.Fatal("Should add CRL", err)
+	}
+
+	if crlID != HexSHA256(crlDER) {
+		t.Error("Wrong CRL ID", crlID)
+	}
+
+	if err := validate(revoked); err == nil {
+		t.Error("Revoked certificate should be rejected")
+	}
+
+	if err := validate(client); err != nil {
+		t.Error("Not revoked certificate should be valid", err)
+	}
+
+	t.Run("Refresh", func(t *testing.T) {
+		reloaded := NewCRLManager(m.storage, nil, nil)
+		reloaded.Refresh()
+
+		if ok, _ := reloaded.IsRevoked(revoked, ca); !ok {
+			t.Error("Stored CRL should be loaded")
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		crls.Delete(crlID)
+
+		if ids := crls.ListAllIds(); len(ids) != 0 {
+			t.Error("CRL should be removed", ids)
+		}
+
+		if err := validate(revoked); err != nil {
+			t.Error("Should be valid after CRL is removed", err)
+		}
+	})
+}
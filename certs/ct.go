@@ -0,0 +1,330 @@
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"strconv"
+)
+
+// oidSCTList is the X.509 extension with embedded signed certificate
+// timestamps, RFC 6962 section 3.3.
+var oidSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// CTPolicy configures certificate transparency checks of added certificates.
+// Only certificates chaining to publicly trusted roots are checked, since
+// private CAs don't log to CT logs.
+type CTPolicy struct {
+	// Enforce rejects certificates failing the check, otherwise only a
+	// warning is logged.
+	Enforce bool
+	// MinSCTs is the number of valid SCTs required, 1 by default.
+	MinSCTs int
+	// Logs are public keys of trusted CT logs. SCTs of unknown logs are
+	// ignored. Without logs, SCTs are counted but their signatures are not
+	// verified.
+	Logs []crypto.PublicKey
+	// Roots are used to detect publicly trusted certificates, system roots
+	// by default.
+	Roots *x509.CertPool
+}
+
+// SetCTPolicy enables certificate transparency checks in Add. Nil policy
+// disables them.
+func (c *CertificateManager) SetCTPolicy(policy *CTPolicy) error {
+	var logs map[[32]byte]crypto.PublicKey
+	if policy != nil {
+		logs = map[[32]byte]crypto.PublicKey{}
+		for _, key := range policy.Logs {
+			der, err := x509.MarshalPKIXPublicKey(key)
+			if err != nil {
+				return err
+			}
+			logs[sha256.Sum256(der)] = key
+		}
+	}
+
+	c.mu.Lock()
+	c.ctPolicy = policy
+	c.ctLogs = logs
+	c.mu.Unlock()
+
+	return nil
+}
+
+// decodeChain parses PEM encoded certificates, up to the first malformed one.
+func decodeChain(certBlocks [][]byte) (chain []*x509.Certificate) {
+	for _, certPEM := range certBlocks {
+		block, _ := pem.Decode(certPEM)
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			break
+		}
+		chain = append(chain, cert)
+	}
+
+	return chain
+}
+
+// checkCT verifies SCTs of the leaf certificate, if it is publicly trusted.
+func (c *CertificateManager) checkCT(chain []*x509.Certificate) error {
+	c.mu.RLock()
+	policy, logs := c.ctPolicy, c.ctLogs
+	c.mu.RUnlock()
+
+	if policy == nil || len(chain) == 0 {
+		return nil
+	}
+
+	leaf := chain[0]
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	verified, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         policy.Roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil || len(verified[0]) < 2 {
+		// Not publicly trusted
+		return nil
+	}
+
+	minSCTs := policy.MinSCTs
+	if minSCTs <= 0 {
+		minSCTs = 1
+	}
+
+	valid := countValidSCTs(leaf, verified[0][1], logs)
+	if valid >= minSCTs {
+		return nil
+	}
+
+	err = errors.New("Certificate " + HexSHA256(leaf.Raw) + " has " + strconv.Itoa(valid) +
+		" valid SCTs, " + strconv.Itoa(minSCTs) + " required by certificate transparency policy")
+	if !policy.Enforce {
+		c.logger.Warning(err)
+		return nil
+	}
+
+	c.logger.Error(err)
+	return err
+}
+
+// signedCertificateTimestamp is SCT version 1, RFC 6962 section 3.2.
+type signedCertificateTimestamp struct {
+	logID      [32]byte
+	timestamp  uint64
+	extensions []byte
+	hashAlg    uint8
+	sigAlg     uint8
+	signature  []byte
+}
+
+// readVector reads TLS vector with the length prefix of n bytes.
+func readVector(data []byte, n int) (vector, rest []byte, err error) {
+	if len(data) < n {
+		return nil, nil, errors.New("Truncated SCT data")
+	}
+
+	var length int
+	for _, b := range data[:n] {
+		length = length<<8 | int(b)
+	}
+	data = data[n:]
+
+	if len(data) < length {
+		return nil, nil, errors.New("Truncated SCT data")
+	}
+
+	return data[:length], data[length:], nil
+}
+
+func parseSCTList(cert *x509.Certificate) ([]signedCertificateTimestamp, error) {
+	var raw []byte
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidSCTList) {
+			if _, err := asn1.Unmarshal(ext.Value, &raw); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if raw == nil {
+		return nil, nil
+	}
+
+	list, _, err := readVector(raw, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	var scts []signedCertificateTimestamp
+	for len(list) > 0 {
+		var data []byte
+		if data, list, err = readVector(list, 2); err != nil {
+			return nil, err
+		}
+
+		// version 1 is encoded as 0
+		if len(data) < 1+32+8 || data[0] != 0 {
+			continue
+		}
+
+		var sct signedCertificateTimestamp
+		copy(sct.logID[:], data[1:33])
+		sct.timestamp = binary.BigEndian.Uint64(data[33:41])
+
+		rest := data[41:]
+		if sct.extensions, rest, err = readVector(rest, 2); err != nil {
+			return nil, err
+		}
+
+		if len(rest) < 2 {
+			return nil, errors.New("Truncated SCT data")
+		}
+		sct.hashAlg, sct.sigAlg = rest[0], rest[1]
+
+		if sct.signature, _, err = readVector(rest[2:], 2); err != nil {
+			return nil, err
+		}
+
+		scts = append(scts, sct)
+	}
+
+	return scts, nil
+}
+
+// precertTBS returns TBS certificate without the SCT list extension, as it
+// was signed by CT logs.
+func precertTBS(cert *x509.Certificate) ([]byte, error) {
+	var tbs asn1.RawValue
+	if _, err := asn1.Unmarshal(cert.RawTBSCertificate, &tbs); err != nil {
+		return nil, err
+	}
+
+	var fields []byte
+	rest := tbs.Bytes
+	for len(rest) > 0 {
+		var field asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &field); err != nil {
+			return nil, err
+		}
+
+		// extensions [3] EXPLICIT
+		if field.Class == asn1.ClassContextSpecific && field.Tag == 3 {
+			var exts []pkix.Extension
+			if _, err := asn1.Unmarshal(field.Bytes, &exts); err != nil {
+				return nil, err
+			}
+
+			var kept []pkix.Extension
+			for _, ext := range exts {
+				if !ext.Id.Equal(oidSCTList) {
+					kept = append(kept, ext)
+				}
+			}
+
+			extsDER, err := asn1.Marshal(kept)
+			if err != nil {
+				return nil, err
+			}
+
+			field = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 3, IsCompound: true, Bytes: extsDER}
+			if field.FullBytes, err = asn1.Marshal(field); err != nil {
+				return nil, err
+			}
+		}
+
+		fields = append(fields, field.FullBytes...)
+	}
+
+	return asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSequence, IsCompound: true, Bytes: fields})
+}
+
+func appendUint(b []byte, v uint64, n int) []byte {
+	for i := n - 1; i >= 0; i-- {
+		b = append(b, byte(v>>(8*uint(i))))
+	}
+	return b
+}
+
+// verifySCT checks SCT signature over the precertificate entry, RFC 6962
+// section 3.2.
+func verifySCT(sct signedCertificateTimestamp, tbs []byte, issuer *x509.Certificate, key crypto.PublicKey) error {
+	// Only SHA256 is allowed by RFC 6962
+	if sct.hashAlg != 4 {
+		return errors.New("Unsupported SCT hash algorithm")
+	}
+
+	issuerKeyHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+
+	signed := []byte{0, 0} // version v1, certificate_timestamp
+	signed = appendUint(signed, sct.timestamp, 8)
+	signed = appendUint(signed, 1, 2) // precert_entry
+	signed = append(signed, issuerKeyHash[:]...)
+	signed = appendUint(signed, uint64(len(tbs)), 3)
+	signed = append(signed, tbs...)
+	signed = appendUint(signed, uint64(len(sct.extensions)), 2)
+	signed = append(signed, sct.extensions...)
+
+	digest := sha256.Sum256(signed)
+
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		if sct.sigAlg != 3 || !ecdsa.VerifyASN1(key, digest[:], sct.signature) {
+			return errors.New("Invalid SCT signature")
+		}
+	case *rsa.PublicKey:
+		if sct.sigAlg != 1 {
+			return errors.New("Invalid SCT signature")
+		}
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sct.signature)
+	default:
+		return errors.New("Unsupported CT log key")
+	}
+
+	return nil
+}
+
+// countValidSCTs returns the number of SCTs from distinct known logs with
+// valid signatures, or of all SCTs if no logs are known.
+func countValidSCTs(cert, issuer *x509.Certificate, logs map[[32]byte]crypto.PublicKey) int {
+	scts, err := parseSCTList(cert)
+	if err != nil || len(scts) == 0 {
+		return 0
+	}
+
+	if len(logs) == 0 {
+		return len(scts)
+	}
+
+	tbs, err := precertTBS(cert)
+	if err != nil {
+		return 0
+	}
+
+	seen := map[[32]byte]bool{}
+	for _, sct := range scts {
+		key, ok := logs[sct.logID]
+		if !ok || seen[sct.logID] {
+			continue
+		}
+
+		if verifySCT(sct, tbs, issuer, key) == nil {
+			seen[sct.logID] = true
+		}
+	}
+
+	return len(seen)
+}
@@ -0,0 +1,122 @@
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// genSCT signs precertificate entry of the TBS certificate like a CT log.
+func genSCT(logKey *ecdsa.PrivateKey, tbs []byte, issuer *x509.Certificate) []byte {
+	logDER, _ := x509.MarshalPKIXPublicKey(&logKey.PublicKey)
+	logID := sha256.Sum256(logDER)
+
+	sct := signedCertificateTimestamp{logID: logID, timestamp: uint64(time.Now().Unix() * 1000), hashAlg: 4, sigAlg: 3}
+
+	issuerKeyHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+	signed := []byte{0, 0}
+	signed = appendUint(signed, sct.timestamp, 8)
+	signed = appendUint(signed, 1, 2)
+	signed = append(signed, issuerKeyHash[:]...)
+	signed = appendUint(signed, uint64(len(tbs)), 3)
+	signed = append(signed, tbs...)
+	signed = appendUint(signed, 0, 2)
+	digest := sha256.Sum256(signed)
+	sct.signature, _ = ecdsa.SignASN1(rand.Reader, logKey, digest[:])
+
+	data := []byte{0}
+	data = append(data, sct.logID[:]...)
+	data = appendUint(data, sct.timestamp, 8)
+	data = appendUint(data, 0, 2)
+	data = append(data, sct.hashAlg, sct.sigAlg)
+	data = appendUint(data, uint64(len(sct.signature)), 2)
+	data = append(data, sct.signature...)
+
+	list := appendUint(nil, uint64(len(data)), 2)
+	list = append(list, data...)
+	list = append(appendUint(nil, uint64(len(list)), 2), list...)
+
+	value, _ := asn1.Marshal(list)
+	return value
+}
+
+func TestCertificateTransparency(t *testing.T) {
+	rootKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Public Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	rootDER, _ := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	root, _ := x509.ParseCertificate(rootDER)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+
+	logKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherLogKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	genLeaf := func(cn string, logKey *ecdsa.PrivateKey) []byte {
+		leafKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(time.Now().UnixNano()),
+			Subject:      pkix.Name{CommonName: cn},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+
+		if logKey != nil {
+			precertDER, _ := x509.CreateCertificate(rand.Reader, template, root, &leafKey.PublicKey, rootKey)
+			precert, _ := x509.ParseCertificate(precertDER)
+			template.ExtraExtensions = []pkix.Extension{{Id: oidSCTList, Value: genSCT(logKey, precert.RawTBSCertificate, root)}}
+		}
+
+		der, _ := x509.CreateCertificate(rand.Reader, template, root, &leafKey.PublicKey, rootKey)
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	}
+
+	logged := genLeaf("logged", logKey)
+	notLogged := genLeaf("not logged", nil)
+	unknownLog := genLeaf("unknown log", otherLogKey)
+	private, _ := genCertificateFromCommonName("private")
+
+	m := newManager()
+	if err := m.SetCTPolicy(&CTPolicy{Enforce: true, Logs: []crypto.PublicKey{&logKey.PublicKey}, Roots: roots}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Add(logged, ""); err != nil {
+		t.Error("Certificate with valid SCT should be added", err)
+	}
+
+	if _, err := m.Add(notLogged, ""); err == nil {
+		t.Error("Certificate without SCTs should be rejected")
+	}
+
+	if _, err := m.Add(unknownLog, ""); err == nil {
+		t.Error("Certificate with SCT of unknown log should be rejected")
+	}
+
+	if _, err := m.Add(private, ""); err != nil {
+		t.Error("Privately issued certificate should not be checked", err)
+	}
+
+	m.SetCTPolicy(&CTPolicy{Logs: []crypto.PublicKey{&logKey.PublicKey}, Roots: roots})
+	if _, err := m.Add(notLogged, ""); err != nil {
+		t.Error("Policy should only warn if not enforced", err)
+	}
+}
@@ -0,0 +1,264 @@
+package certs
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	envelopeVersion = 1
+	// envelopeHeader marks PEM blocks encrypted with the key envelope, instead
+	// of the legacy RFC 1423 encryption.
+	envelopeHeader = "Tyk-Envelope"
+	envelopeCipher = "AES-256-GCM,scrypt"
+
+	// scrypt parameters recommended for interactive logins in 2017
+	scryptN       = 1 << 15
+	scryptR       = 8
+	scryptP       = 1
+	scryptSaltLen = 16
+)
+
+// KeyEncryption is the encryption of private keys and key URIs in storage.
+type KeyEncryption string
+
+const (
+	// KeyEncryptionGCM is AES-256-GCM with the key derived from the secret
+	// with scrypt. Keys encrypted the legacy way are migrated when loaded.
+	KeyEncryptionGCM KeyEncryption = "aes-gcm"
+	// KeyEncryptionLegacy is PEM encryption with AES-256-CBC, which gateways
+	// of previous versions can decrypt.
+	KeyEncryptionLegacy KeyEncryption = "legacy"
+)
+
+var (
+	// envelopeSalt is used for the keys encrypted by this process, so the
+	// secret is derived once. Salt is stored in every envelope.
+	envelopeSalt     []byte
+	envelopeSaltOnce sync.Once
+
+	envelopeAEADsMu sync.Mutex
+	envelopeAEADs   = map[[32]byte]cipher.AEAD{}
+)
+
+func passphraseAEAD(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// cachedAEAD is passphraseAEAD remembering derived keys, since scrypt is
+// intentionally slow.
+func cachedAEAD(secret string, salt []byte) (cipher.AEAD, error) {
+	cacheKey := sha256.Sum256(append(append([]byte(secret), 0), salt...))
+
+	envelopeAEADsMu.Lock()
+	defer envelopeAEADsMu.Unlock()
+
+	if aead, ok := envelopeAEADs[cacheKey]; ok {
+		return aead, nil
+	}
+
+	aead, err := passphraseAEAD(secret, salt)
+	if err != nil {
+		return nil, err
+	}
+	envelopeAEADs[cacheKey] = aead
+
+	return aead, nil
+}
+
+// sealEnvelope encrypts data, and returns version byte, salt, nonce and the
+// ciphertext. Version is authenticated as well.
+func sealEnvelope(aead cipher.AEAD, salt, data []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	header := append(append([]byte{envelopeVersion}, salt...), nonce...)
+	return aead.Seal(header, nonce, data, header[:1]), nil
+}
+
+// openEnvelope decrypts data sealed with the key, which newAEAD derives from
+// the salt.
+func openEnvelope(sealed []byte, newAEAD func(salt []byte) (cipher.AEAD, error)) ([]byte, error) {
+	if len(sealed) < 1+scryptSaltLen || sealed[0] != envelopeVersion {
+		return nil, errors.New("Unsupported envelope version")
+	}
+
+	aead, err := newAEAD(sealed[1 : 1+scryptSaltLen])
+	if err != nil {
+		return nil, err
+	}
+
+	rest := sealed[1+scryptSaltLen:]
+	if len(rest) < aead.NonceSize() {
+		return nil, errors.New("Encrypted data is truncated")
+	}
+
+	return aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], sealed[:1])
+}
+
+// sealWithPassphrase encrypts data with AES-256-GCM, using key derived from
+// the passphrase with scrypt and random salt.
+func sealWithPassphrase(data []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, scryptSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := passphraseAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	return sealEnvelope(aead, salt, data)
+}
+
+func openWithPassphrase(sealed []byte, passphrase string) ([]byte, error) {
+	data, err := openEnvelope(sealed, func(salt []byte) (cipher.AEAD, error) {
+		return passphraseAEAD(passphrase, salt)
+	})
+	if err != nil {
+		return nil, errors.New("Can't decrypt archive, wrong passphrase or corrupted data")
+	}
+
+	return data, nil
+}
+
+// encryptPEMBlock encrypts data of the PEM block with the secret, using the
+// key envelope or the legacy PEM encryption.
+func encryptPEMBlock(blockType string, data []byte, secret string, encryption KeyEncryption) (*pem.Block, error) {
+	if encryption == KeyEncryptionLegacy {
+		return x509.EncryptPEMBlock(rand.Reader, "ENCRYPTED "+blockType, data, []byte(secret), x509.PEMCipherAES256)
+	}
+
+	envelopeSaltOnce.Do(func() {
+		envelopeSalt = make([]byte, scryptSaltLen)
+		rand.Read(envelopeSalt)
+	})
+
+	aead, err := cachedAEAD(secret, envelopeSalt)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := sealEnvelope(aead, envelopeSalt, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pem.Block{
+		Type:    "ENCRYPTED " + blockType,
+		Headers: map[string]string{envelopeHeader: envelopeCipher},
+		Bytes:   sealed,
+	}, nil
+}
+
+// decryptPEMBlock decrypts block encrypted by encryptPEMBlock, in place.
+func decryptPEMBlock(block *pem.Block, secret string) error {
+	var err error
+
+	if isPKCS8EncryptedBlock(block) {
+		block.Bytes, err = decryptPKCS8(block.Bytes, secret)
+	} else if block.Headers[envelopeHeader] != "" {
+		block.Bytes, err = openEnvelope(block.Bytes, func(salt []byte) (cipher.AEAD, error) {
+			return cachedAEAD(secret, salt)
+		})
+		if err != nil {
+			err = errors.New("Can't decrypt " + block.Type + ": " + err.Error())
+		}
+	} else {
+		block.Bytes, err = x509.DecryptPEMBlock(block, []byte(secret))
+	}
+
+	block.Headers = nil
+	block.Type = strings.Replace(block.Type, "ENCRYPTED ", "", 1)
+
+	return err
+}
+
+func isEncryptedPEMBlock(block *pem.Block) bool {
+	return block.Headers[envelopeHeader] != "" || isPKCS8EncryptedBlock(block) || x509.IsEncryptedPEMBlock(block)
+}
+
+// SetKeyEncryption sets encryption of private keys added from now on, the key
+// envelope by default.
+func (c *CertificateManager) SetKeyEncryption(encryption KeyEncryption) {
+	c.mu.Lock()
+	c.keyEncryption = encryption
+	c.mu.Unlock()
+}
+
+func (c *CertificateManager) encryptPEMBlock(blockType string, data []byte) (*pem.Block, error) {
+	c.mu.RLock()
+	encryption := c.keyEncryption
+	c.mu.RUnlock()
+
+	return encryptPEMBlock(blockType, data, c.secret, encryption)
+}
+
+// migrateKeys re-encrypts legacy encrypted blocks of the stored certificate
+// with the key envelope, unless legacy encryption is configured.
+func (c *CertificateManager) migrateKeys(certID string, raw []byte) []byte {
+	c.mu.RLock()
+	encryption := c.keyEncryption
+	c.mu.RUnlock()
+
+	if encryption == KeyEncryptionLegacy || !strings.Contains(string(raw), "DEK-Info") {
+		return raw
+	}
+
+	var migrated []byte
+	rest := raw
+	for {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+
+		if x509.IsEncryptedPEMBlock(block) {
+			if err := decryptPEMBlock(block, c.secret); err != nil {
+				c.logger.Error("Can't migrate private key of ", certID, ": ", err)
+				return raw
+			}
+
+			var err error
+			if block, err = c.encryptPEMBlock(block.Type, block.Bytes); err != nil {
+				c.logger.Error("Can't migrate private key of ", certID, ": ", err)
+				return raw
+			}
+		}
+
+		if len(migrated) > 0 {
+			migrated = append(migrated, '\n')
+		}
+		migrated = append(migrated, pem.EncodeToMemory(block)...)
+	}
+
+	if err := c.storage.SetKey("raw-"+certID, string(migrated), 0); err != nil {
+		c.logger.Error("Can't store migrated private key of ", certID, ": ", err)
+		return raw
+	}
+
+	c.logger.Info("Migrated private key encryption of ", certID)
+	return migrated
+}
@@ -0,0 +1,63 @@
+package certs
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKeyEncryption(t *testing.T) {
+	storage := newDummyStorage()
+	m := NewCertificateManager(storage, "test", nil)
+
+	certPem, keyPem := genCertificateFromCommonName("envelope")
+	certID, err := m.Add(append(certPem, keyPem...), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw := storage.data["raw-"+certID]
+	if !strings.Contains(raw, envelopeHeader) || strings.Contains(raw, "DEK-Info") {
+		t.Fatal("Private key should be encrypted with key envelope", raw)
+	}
+
+	if _, err := ParsePEMCertificate([]byte(raw), "other"); err == nil {
+		t.Error("Private key should not be decrypted with another secret")
+	}
+
+	m.SetKeyEncryption(KeyEncryptionLegacy)
+	legacyPem, legacyKey := genCertificateFromCommonName("legacy")
+	legacyID, _ := m.Add(append(legacyPem, legacyKey...), "")
+
+	if raw := storage.data["raw-"+legacyID]; !strings.Contains(raw, "DEK-Info") {
+		t.Fatal("Private key should be encrypted the legacy way", raw)
+	}
+
+	if certs := m.List([]string{legacyID}, CertificatePrivate); len(certs) != 1 || certs[0] == nil {
+		t.Fatal("Legacy encrypted key should be loaded")
+	}
+
+	if raw := storage.data["raw-"+legacyID]; !strings.Contains(raw, "DEK-Info") {
+		t.Error("Key should not be migrated with legacy encryption")
+	}
+
+	m.SetKeyEncryption(KeyEncryptionGCM)
+	m.cache.Flush()
+
+	certs := m.List([]string{legacyID, certID}, CertificatePrivate)
+	if len(certs) != 2 || certs[0] == nil || certs[1] == nil {
+		t.Fatal("Certificates should be loaded")
+	}
+
+	if leafSubjectName(certs[0]) != "legacy" {
+		t.Error("Wrong certificate loaded", leafSubjectName(certs[0]))
+	}
+
+	if raw := storage.data["raw-"+legacyID]; !strings.Contains(raw, envelopeHeader) || strings.Contains(raw, "DEK-Info") {
+		t.Error("Legacy encrypted key should be migrated on read", raw)
+	}
+
+	m.cache.Flush()
+	if certs := m.List([]string{legacyID}, CertificatePrivate); len(certs) != 1 || certs[0] == nil {
+		t.Error("Migrated key should be loaded")
+	}
+}
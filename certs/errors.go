@@ -0,0 +1,39 @@
+package certs
+
+import "errors"
+
+// Errors returned by certificate operations, usually wrapped in
+// CertificateError or with details, so they should be checked with
+// errors.Is.
+var (
+	ErrCertExists         = errors.New("Certificate already exists")
+	ErrCertNotFound       = errors.New("Certificate not found")
+	ErrCertInUse          = errors.New("Certificate is still in use")
+	ErrKeyMismatch        = errors.New("tls: private key does not match public key")
+	ErrUnsupportedKeyType = errors.New("Unsupported key type")
+)
+
+// certErrorReasons describe errors in CertificateError messages.
+var certErrorReasons = map[error]string{
+	ErrCertExists:   "already exists",
+	ErrCertNotFound: "not found",
+	ErrCertInUse:    "is still in use",
+}
+
+// CertificateError is an error of an operation on the certificate.
+type CertificateError struct {
+	CertID string
+	Err    error
+}
+
+func (e *CertificateError) Error() string {
+	if reason, found := certErrorReasons[e.Err]; found {
+		return "Certificate with " + e.CertID + " id " + reason
+	}
+
+	return "Certificate with " + e.CertID + " id: " + e.Err.Error()
+}
+
+func (e *CertificateError) Unwrap() error {
+	return e.Err
+}
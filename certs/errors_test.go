@@ -0,0 +1,40 @@
+package certs
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCertificateErrors(t *testing.T) {
+	m := newManager()
+
+	certPem, _ := genCertificateFromCommonName("errors")
+	certID, _ := m.Add(certPem, "")
+
+	_, err := m.Add(certPem, "")
+	if !errors.Is(err, ErrCertExists) {
+		t.Error("Duplicate should be reported with ErrCertExists", err)
+	}
+
+	var certErr *CertificateError
+	if !errors.As(err, &certErr) || certErr.CertID != certID {
+		t.Error("Error should contain the certificate ID", err)
+	}
+
+	if err := m.Replace("missing", certPem); !errors.Is(err, ErrCertNotFound) {
+		t.Error("Replacing missing certificate should be reported with ErrCertNotFound", err)
+	}
+
+	if err := m.ForOrg("5e9d9544a1dcd60001d0ed20").Delete(certID); !errors.Is(err, ErrCertNotFound) {
+		t.Error("Certificate of other organisation should be reported with ErrCertNotFound", err)
+	}
+
+	_, otherKey := genCertificateFromCommonName("other")
+	if _, err := m.Add(append(certPem, otherKey...), ""); !errors.Is(err, ErrKeyMismatch) {
+		t.Error("Foreign private key should be reported with ErrKeyMismatch", err)
+	}
+
+	if _, err := m.GenerateSelfSigned(GenerateOptions{CommonName: "dsa", KeyType: "dsa"}, ""); !errors.Is(err, ErrUnsupportedKeyType) {
+		t.Error("Unknown key type should be reported with ErrUnsupportedKeyType", err)
+	}
+}
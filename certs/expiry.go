@@ -0,0 +1,158 @@
+package certs
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const defaultExpiryCheckInterval = time.Hour
+
+// DefaultExpiryThresholds are used by ExpiryWatcher when no thresholds are given.
+var DefaultExpiryThresholds = []time.Duration{
+	30 * 24 * time.Hour,
+	7 * 24 * time.Hour,
+	24 * time.Hour,
+}
+
+// ExpiryHandler is called by ExpiryWatcher when a certificate crosses one of
+// the thresholds. Threshold is zero when the certificate has already expired.
+type ExpiryHandler func(meta *CertificateMeta, threshold time.Duration)
+
+// ExpiryWatcher periodically scans stored certificates and notifies
+// handlers when their NotAfter comes within one of the configured thresholds.
+// Each handler is notified once per certificate and threshold.
+type ExpiryWatcher struct {
+	manager    *CertificateManager
+	thresholds []time.Duration
+	now        func() time.Time
+
+	mu       sync.Mutex
+	handlers []ExpiryHandler
+	notified map[string]time.Duration
+	stop     chan struct{}
+}
+
+func NewExpiryWatcher(manager *CertificateManager, thresholds []time.Duration) *ExpiryWatcher {
+	if len(thresholds) == 0 {
+		thresholds = DefaultExpiryThresholds
+	}
+
+	sorted := make([]time.Duration, len(thresholds))
+	copy(sorted, thresholds)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return &ExpiryWatcher{
+		manager:    manager,
+		thresholds: sorted,
+		now:        time.Now,
+		notified:   make(map[string]time.Duration),
+	}
+}
+
+// AddHandler registers a callback fired for expiring certificates.
+func (w *ExpiryWatcher) AddHandler(h ExpiryHandler) {
+	w.mu.Lock()
+	w.handlers = append(w.handlers, h)
+	w.mu.Unlock()
+}
+
+// threshold returns the smallest threshold the remaining validity falls into.
+func (w *ExpiryWatcher) threshold(remaining time.Duration) (time.Duration, bool) {
+	if remaining <= 0 {
+		return 0, true
+	}
+
+	for _, t := range w.thresholds {
+		if remaining <= t {
+			return t, true
+		}
+	}
+
+	return 0, false
+}
+
+// Check scans all stored certificates once and fires handlers.
+func (w *ExpiryWatcher) Check() {
+	certIDs := w.manager.ListAllIds("")
+	now := w.now()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	seen := make(map[string]bool, len(certIDs))
+
+	for i, cert := range w.manager.List(certIDs, CertificateAny) {
+		// Public keys have no validity period
+		if cert == nil || cert.Leaf.NotAfter.IsZero() {
+			continue
+		}
+
+		certID := certIDs[i]
+		seen[certID] = true
+
+		threshold, ok := w.threshold(cert.Leaf.NotAfter.Sub(now))
+		if !ok {
+			delete(w.notified, certID)
+			continue
+		}
+
+		if last, found := w.notified[certID]; found && last <= threshold {
+			continue
+		}
+		w.notified[certID] = threshold
+
+		meta := ExtractCertificateMeta(cert, certID)
+		for _, h := range w.handlers {
+			h(meta, threshold)
+		}
+	}
+
+	// Forget removed certificates
+	for certID := range w.notified {
+		if !seen[certID] {
+			delete(w.notified, certID)
+		}
+	}
+}
+
+// Start runs Check on every interval until Stop is called.
+func (w *ExpiryWatcher) Start(interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultExpiryCheckInterval
+	}
+
+	w.mu.Lock()
+	if w.stop != nil {
+		w.mu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	w.stop = stop
+	w.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			w.Check()
+
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func (w *ExpiryWatcher) Stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.stop != nil {
+		close(w.stop)
+		w.stop = nil
+	}
+}
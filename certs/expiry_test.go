@@ -0,0 +1,55 @@
+package certs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpiryWatcher(t *testing.T) {
+	m := newManager()
+
+	// genCertificate issues certificates valid for an hour
+	certPem, _ := genCertificateFromCommonName("expiring")
+	certID, _ := m.Add(certPem, "")
+
+	watcher := NewExpiryWatcher(m, []time.Duration{30 * time.Minute, 2 * time.Hour})
+
+	now := time.Now()
+	watcher.now = func() time.Time { return now }
+
+	var fired []time.Duration
+	watcher.AddHandler(func(meta *CertificateMeta, threshold time.Duration) {
+		if meta.ID != certID {
+			t.Error("Wrong certificate", meta.ID)
+		}
+		fired = append(fired, threshold)
+	})
+
+	steps := []struct {
+		name   string
+		shift  time.Duration
+		expect []time.Duration
+	}{
+		{"First threshold", 0, []time.Duration{2 * time.Hour}},
+		{"Notify only once", 0, []time.Duration{2 * time.Hour}},
+		{"Second threshold", 45 * time.Minute, []time.Duration{2 * time.Hour, 30 * time.Minute}},
+		{"Expired", time.Hour, []time.Duration{2 * time.Hour, 30 * time.Minute, 0}},
+	}
+
+	for _, s := range steps {
+		t.Run(s.name, func(t *testing.T) {
+			now = now.Add(s.shift)
+			watcher.Check()
+
+			if len(fired) != len(s.expect) {
+				t.Fatal("Wrong number of notifications", fired)
+			}
+
+			for i := range s.expect {
+				if fired[i] != s.expect[i] {
+					t.Error("Wrong threshold", fired[i], s.expect[i])
+				}
+			}
+		})
+	}
+}
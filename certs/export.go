@@ -0,0 +1,174 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	archiveBlock   = "TYK CERTIFICATE ARCHIVE"
+	archiveVersion = 1
+)
+
+// archiveEntry is a certificate with decrypted private key, as stored in the
+// export archive.
+type archiveEntry struct {
+	ID   string            `json:"id"`
+	PEM  string            `json:"pem"`
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+type archive struct {
+	Version      int            `json:"version"`
+	Created      time.Time      `json:"created"`
+	Certificates []archiveEntry `json:"certificates"`
+}
+
+// Export returns an archive of all certificates of the organisation, with
+// their private keys and tags, encrypted with the passphrase. Private keys are
+// decrypted with the manager secret, so the archive can be imported by a
+// gateway configured with another secret.
+func (c *CertificateManager) Export(orgID, passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, errors.New("Passphrase is required to export certificates")
+	}
+
+	arch := archive{Version: archiveVersion, Created: time.Now().UTC()}
+
+	for _, id := range c.listOrgIds(orgID) {
+		raw, err := c.GetRaw(id)
+		if err != nil {
+			continue
+		}
+
+		passphrase, err := c.keyPassphrase(context.Background(), id)
+		if err != nil {
+			c.logger.Error("Can't decrypt private key passphrase of ", id, " for export: ", err)
+			return nil, err
+		}
+
+		blocks, err := parsePEM([]byte(raw), c.secret, passphrase)
+		if err != nil {
+			c.logger.Error("Can't decrypt certificate ", id, " for export: ", err)
+			return nil, err
+		}
+
+		var buf bytes.Buffer
+		for _, block := range blocks {
+			pem.Encode(&buf, block)
+		}
+
+		arch.Certificates = append(arch.Certificates, archiveEntry{
+			ID:   id,
+			PEM:  buf.String(),
+			Tags: c.Tags(id),
+		})
+	}
+
+	data, err := json.Marshal(arch)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := sealWithPassphrase(data, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: archiveBlock, Bytes: sealed}), nil
+}
+
+// Import adds certificates from an archive created by Export, and returns
+// result for every one of them in archive order. Certificates keep their IDs,
+// and existing ones are not overwritten. With dryRun certificates are only
+// validated, and nothing is stored.
+func (c *CertificateManager) Import(data []byte, passphrase string, dryRun bool) ([]BatchResult, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != archiveBlock {
+		return nil, errors.New("Certificate archive should be PEM encoded")
+	}
+
+	plain, err := openWithPassphrase(block.Bytes, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	var arch archive
+	if err := json.Unmarshal(plain, &arch); err != nil {
+		return nil, errors.New("Malformed certificate archive: " + err.Error())
+	}
+
+	results := make([]BatchResult, len(arch.Certificates))
+	for i, entry := range arch.Certificates {
+		if err := c.importEntry(entry, dryRun); err != nil {
+			results[i].Error = entry.ID + ": " + err.Error()
+			continue
+		}
+
+		results[i].CertID = entry.ID
+	}
+
+	return results, nil
+}
+
+func (c *CertificateManager) importEntry(entry archiveEntry, dryRun bool) error {
+	if len(entry.ID) < sha256HexLength {
+		return errors.New("Malformed certificate ID")
+	}
+	orgID := entry.ID[:len(entry.ID)-sha256HexLength]
+
+	// Key URI is not accepted by encode, and is stored separately
+	var certData []byte
+	var keyURI string
+	rest := []byte(entry.PEM)
+	for {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+
+		if block.Type == keyURIBlock {
+			keyURI = string(block.Bytes)
+			continue
+		}
+		certData = append(certData, pem.EncodeToMemory(block)...)
+	}
+
+	certID, certChainPEM, err := c.encode(certData, orgID)
+	if err != nil {
+		return err
+	}
+
+	if certID != entry.ID {
+		return errors.New("Certificate doesn't match its ID")
+	}
+
+	if raw, err := c.storage.GetKey("raw-" + certID); err == nil && raw != "" {
+		return &CertificateError{CertID: certID, Err: ErrCertExists}
+	}
+
+	if keyURI != "" && (!strings.Contains(keyURI, ":") || bytes.Contains(certChainPEM, []byte("PRIVATE KEY"))) {
+		return errors.New("Invalid private key URI")
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	if keyURI != "" {
+		_, err = c.AddWithKeyURI(certData, keyURI, orgID)
+	} else {
+		_, err = c.store(context.Background(), certID, certChainPEM)
+		c.audit(AuditAdd, certID, "", err)
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.SetTags(certID, entry.Tags)
+}
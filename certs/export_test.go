@@ -0,0 +1,72 @@
+package certs
+
+import (
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+	source := newManager()
+
+	certPem, keyPem := genCertificateFromCommonName("private")
+	privateID, _ := source.Add(append(certPem, keyPem...), "abcd")
+	source.SetTags(privateID, map[string]string{"env": "prod"})
+
+	publicPem, _ := genCertificateFromCommonName("public")
+	publicID, _ := source.Add(publicPem, "abcd")
+
+	otherPem, _ := genCertificateFromCommonName("other")
+	source.Add(otherPem, "beef")
+
+	if _, err := source.Export("abcd", ""); err == nil {
+		t.Error("Passphrase should be required")
+	}
+
+	archive, err := source.Export("abcd", "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Target environment uses another secret
+	target := NewCertificateManager(newDummyStorage(), "other secret", nil)
+
+	if _, err := target.Import(archive, "wrong", false); err == nil {
+		t.Error("Wrong passphrase should be rejected")
+	}
+
+	results, err := target.Import(archive, "passphrase", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 2 || results[0].Error != "" || results[1].Error != "" {
+		t.Fatal("Organisation certificates should pass validation", results)
+	}
+
+	if len(target.ListAllIds("")) != 0 {
+		t.Fatal("Dry run should not store certificates")
+	}
+
+	if _, err := target.Import(archive, "passphrase", false); err != nil {
+		t.Fatal(err)
+	}
+
+	imported := target.List([]string{privateID}, CertificatePrivate)
+	if len(imported) != 1 || imported[0] == nil || leafSubjectName(imported[0]) != "private" {
+		t.Fatal("Certificate with private key should be imported")
+	}
+
+	if tags := target.Tags(privateID); tags["env"] != "prod" {
+		t.Error("Tags should be imported", tags)
+	}
+
+	if imported := target.List([]string{publicID}, CertificatePublic); len(imported) != 1 || imported[0] == nil {
+		t.Error("Public certificate should be imported")
+	}
+
+	results, _ = target.Import(archive, "passphrase", true)
+	for _, result := range results {
+		if result.Error == "" {
+			t.Error("Existing certificates should be reported", result)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package certs
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// StartFileWatch starts watching certificates loaded from files, and drops
+// them from cache when the file changes, so certificates rotated on disk,
+// e.g. by certbot, are picked up on next use. Directories are watched
+// instead of files, since rotation usually replaces the file or the symlink
+// pointing to it.
+func (c *CertificateManager) StartFileWatch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	if c.fileWatcher != nil {
+		c.mu.Unlock()
+		watcher.Close()
+		return nil
+	}
+	c.fileWatcher = watcher
+	c.watchedDirs = map[string]struct{}{}
+	for path := range c.watchedFiles {
+		c.watchDir(filepath.Dir(path))
+	}
+	c.mu.Unlock()
+
+	go c.fileWatchLoop(watcher)
+
+	return nil
+}
+
+// StopFileWatch stops watching certificate files.
+func (c *CertificateManager) StopFileWatch() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.fileWatcher == nil {
+		return
+	}
+
+	c.fileWatcher.Close()
+	c.fileWatcher = nil
+	c.watchedDirs = nil
+}
+
+func (c *CertificateManager) fileWatchLoop(watcher *fsnotify.Watcher) {
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+
+			c.mu.RLock()
+			ids := c.watchedFiles[filepath.Clean(event.Name)]
+			certIDs := make([]string, 0, len(ids))
+			for id := range ids {
+				certIDs = append(certIDs, id)
+			}
+			c.mu.RUnlock()
+
+			for _, id := range certIDs {
+				c.logger.Info("Certificate file changed, reloading: ", id)
+				c.Invalidate(id)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			c.logger.Error("Certificate file watch error: ", err)
+		}
+	}
+}
+
+// trackFile records the certificate file, and the file it links to, so
+// changes of either invalidate the certificate.
+func (c *CertificateManager) trackFile(id string) {
+	file := strings.TrimPrefix(id, fileScheme)
+	paths := []string{filepath.Clean(file)}
+	if abs, err := filepath.Abs(file); err == nil && abs != paths[0] {
+		paths = append(paths, abs)
+	}
+	if target, err := filepath.EvalSymlinks(file); err == nil {
+		if abs, err := filepath.Abs(target); err == nil && abs != paths[len(paths)-1] {
+			paths = append(paths, abs)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.watchedFiles == nil {
+		c.watchedFiles = map[string]map[string]struct{}{}
+	}
+
+	for _, path := range paths {
+		if c.watchedFiles[path] == nil {
+			c.watchedFiles[path] = map[string]struct{}{}
+		}
+		c.watchedFiles[path][id] = struct{}{}
+
+		if c.fileWatcher != nil {
+			c.watchDir(filepath.Dir(path))
+		}
+	}
+}
+
+// watchDir adds the directory to the running watcher, c.mu should be locked.
+func (c *CertificateManager) watchDir(dir string) {
+	if _, found := c.watchedDirs[dir]; found {
+		return
+	}
+
+	if err := c.fileWatcher.Add(dir); err != nil {
+		c.logger.Error("Can't watch certificate directory ", dir, ": ", err)
+		return
+	}
+	c.watchedDirs[dir] = struct{}{}
+}
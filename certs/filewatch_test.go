@@ -0,0 +1,76 @@
+package certs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileWatch(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "certwatch")
+	defer os.RemoveAll(dir)
+
+	m := newManager()
+	if err := m.StartFileWatch(); err != nil {
+		t.Fatal(err)
+	}
+	defer m.StopFileWatch()
+
+	// Files are replaced through a symlink, the way certbot rotates them
+	path := filepath.Join(dir, "cert.pem")
+	writeLinked := func(name, commonName string) {
+		certPem, _ := genCertificateFromCommonName(commonName)
+		ioutil.WriteFile(filepath.Join(dir, name), certPem, 0600)
+		os.Remove(path + ".tmp")
+		os.Symlink(name, path+".tmp")
+		os.Rename(path+".tmp", path)
+	}
+
+	writeLinked("cert1.pem", "first")
+	if certs := m.List([]string{path}, CertificatePublic); len(certs) != 1 || leafSubjectName(certs[0]) != "first" {
+		t.Fatal("Certificate file should be loaded")
+	}
+
+	writeLinked("cert2.pem", "second")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		certs := m.List([]string{path}, CertificatePublic)
+		if len(certs) == 1 && leafSubjectName(certs[0]) == "second" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Rotated certificate file should be reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Files loaded before watch started are watched too
+	m.StopFileWatch()
+	m.FlushCache()
+	other := filepath.Join(dir, "other.pem")
+	certPem, _ := genCertificateFromCommonName("before")
+	ioutil.WriteFile(other, certPem, 0600)
+	m.List([]string{other}, CertificatePublic)
+
+	if err := m.StartFileWatch(); err != nil {
+		t.Fatal(err)
+	}
+
+	certPem, _ = genCertificateFromCommonName("after")
+	ioutil.WriteFile(other, certPem, 0600)
+
+	deadline = time.Now().Add(5 * time.Second)
+	for {
+		certs := m.List([]string{other}, CertificatePublic)
+		if len(certs) == 1 && leafSubjectName(certs[0]) == "after" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Changed certificate file should be reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
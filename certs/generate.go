@@ -0,0 +1,256 @@
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"strconv"
+	"time"
+)
+
+// sha256HexLength is the length of hex encoded SHA256 part of IDs
+const sha256HexLength = 64
+
+// GenerateOptions describes the key and subject of generated self signed
+// certificates and certificate signing requests.
+type GenerateOptions struct {
+	CommonName   string   `json:"common_name"`
+	Organization []string `json:"organization"`
+	DNSNames     []string `json:"dns_names"`
+	IPAddresses  []string `json:"ip_addresses"`
+	// KeyType is "rsa" (default), "ecdsa" or "ed25519".
+	KeyType string `json:"key_type"`
+	// KeySize is RSA key size in bits, 2048 by default, or ECDSA curve
+	// size: 256 (default), 384 or 521.
+	KeySize int `json:"key_size"`
+	// ValidDays is how long self signed certificate is valid, 365 by default.
+	ValidDays int `json:"valid_days"`
+}
+
+func (o *GenerateOptions) subject() (pkix.Name, []net.IP, error) {
+	if o.CommonName == "" && len(o.DNSNames) == 0 && len(o.IPAddresses) == 0 {
+		return pkix.Name{}, nil, errors.New("Common name or subject alternative names are required")
+	}
+
+	var ips []net.IP
+	for _, value := range o.IPAddresses {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return pkix.Name{}, nil, errors.New("Invalid IP address: " + value)
+		}
+		ips = append(ips, ip)
+	}
+
+	return pkix.Name{CommonName: o.CommonName, Organization: o.Organization}, ips, nil
+}
+
+func generateKey(keyType string, size int) (crypto.Signer, error) {
+	switch keyType {
+	case "", "rsa":
+		if size == 0 {
+			size = 2048
+		}
+		if size < 2048 {
+			return nil, errors.New("RSA key size should be at least 2048 bits")
+		}
+		return rsa.GenerateKey(rand.Reader, size)
+	case "ecdsa":
+		var curve elliptic.Curve
+		switch size {
+		case 0, 256:
+			curve = elliptic.P256()
+		case 384:
+			curve = elliptic.P384()
+		case 521:
+			curve = elliptic.P521()
+		default:
+			return nil, errors.New("Unsupported ECDSA curve size: " + strconv.Itoa(size))
+		}
+		return ecdsa.GenerateKey(curve, rand.Reader)
+	case "ed25519":
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedKeyType, keyType)
+	}
+}
+
+func encodeKey(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// GenerateSelfSigned creates a new key with self signed certificate, and
+// stores them the same way as Add does.
+func (c *CertificateManager) GenerateSelfSigned(opts GenerateOptions, orgID string) (string, error) {
+	subject, ips, err := opts.subject()
+	if err != nil {
+		return "", err
+	}
+
+	key, err := generateKey(opts.KeyType, opts.KeySize)
+	if err != nil {
+		return "", err
+	}
+
+	validDays := opts.ValidDays
+	if validDays <= 0 {
+		validDays = 365
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", err
+	}
+
+	keyUsage := x509.KeyUsageDigitalSignature
+	if _, ok := key.(*rsa.PrivateKey); ok {
+		keyUsage |= x509.KeyUsageKeyEncipherment
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               subject,
+		DNSNames:              opts.DNSNames,
+		IPAddresses:           ips,
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().AddDate(0, 0, validDays),
+		KeyUsage:              keyUsage,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		c.logger.Error("Failed to create certificate: ", err)
+		return "", err
+	}
+
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return c.Add(append(certPEM, keyPEM...), orgID)
+}
+
+// GenerateCSR creates a new key with certificate signing request. The key is
+// kept encrypted until the signed certificate is added with AddSignedCSR.
+// Returns the request ID and PEM encoded request.
+func (c *CertificateManager) GenerateCSR(opts GenerateOptions, orgID string) (string, []byte, error) {
+	subject, ips, err := opts.subject()
+	if err != nil {
+		return "", nil, err
+	}
+
+	key, err := generateKey(opts.KeyType, opts.KeySize)
+	if err != nil {
+		return "", nil, err
+	}
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:     subject,
+		DNSNames:    opts.DNSNames,
+		IPAddresses: ips,
+	}, key)
+	if err != nil {
+		c.logger.Error("Failed to create certificate request: ", err)
+		return "", nil, err
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", nil, err
+	}
+
+	encryptedKey, err := c.encryptPEMBlock("PRIVATE KEY", keyDER)
+	if err != nil {
+		c.logger.Error("Failed to encode private key", err)
+		return "", nil, err
+	}
+
+	csrID := orgID + HexSHA256(der)
+	csrPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+
+	if err := c.storage.SetKey("csr-"+csrID, string(csrPEM)+string(pem.EncodeToMemory(encryptedKey)), 0); err != nil {
+		c.logger.Error(err)
+		return "", nil, err
+	}
+
+	return csrID, csrPEM, nil
+}
+
+func (c *CertificateManager) loadCSR(csrID string) (csrPEM, keyPEM []byte, err error) {
+	data, err := c.storage.GetKey("csr-" + csrID)
+	if err != nil || data == "" {
+		return nil, nil, errors.New("Certificate request with " + csrID + " id not found")
+	}
+
+	blocks, err := ParsePEM([]byte(data), c.secret)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, block := range blocks {
+		switch block.Type {
+		case "CERTIFICATE REQUEST":
+			csrPEM = pem.EncodeToMemory(block)
+		case "PRIVATE KEY":
+			keyPEM = pem.EncodeToMemory(block)
+		}
+	}
+
+	if csrPEM == nil || keyPEM == nil {
+		return nil, nil, errors.New("Malformed certificate request " + csrID)
+	}
+
+	return csrPEM, keyPEM, nil
+}
+
+// GetCSR returns PEM encoded certificate signing request.
+func (c *CertificateManager) GetCSR(csrID string) ([]byte, error) {
+	csrPEM, _, err := c.loadCSR(csrID)
+	return csrPEM, err
+}
+
+// AddSignedCSR stores the certificate issued for the request together with
+// the request key, and removes the request.
+func (c *CertificateManager) AddSignedCSR(csrID string, certData []byte) (string, error) {
+	return c.AuditedBy("").AddSignedCSR(csrID, certData)
+}
+
+func (a *AuditedCertificates) AddSignedCSR(csrID string, certData []byte) (string, error) {
+	c := a.manager
+	_, keyPEM, err := c.loadCSR(csrID)
+	if err != nil {
+		c.logger.Error(err)
+		return "", err
+	}
+
+	// Request IDs are prefixed with organisation, like certificate IDs
+	orgID := csrID[:len(csrID)-sha256HexLength]
+
+	data := append(append([]byte{}, certData...), '\n')
+	certID, err := a.Add(append(data, keyPEM...), orgID)
+	if err != nil {
+		return "", err
+	}
+
+	c.storage.DeleteKey("csr-" + csrID)
+	return certID, nil
+}
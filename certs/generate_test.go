@@ -0,0 +1,112 @@
+package certs
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestGenerateSelfSigned(t *testing.T) {
+	m := newManager()
+
+	tests := []struct {
+		name    string
+		opts    GenerateOptions
+		isValid bool
+	}{
+		{"RSA", GenerateOptions{CommonName: "rsa", DNSNames: []string{"rsa.example.com"}, IPAddresses: []string{"10.0.0.1"}}, true},
+		{"ECDSA", GenerateOptions{CommonName: "ecdsa", KeyType: "ecdsa", KeySize: 384}, true},
+		{"Ed25519", GenerateOptions{CommonName: "ed25519", KeyType: "ed25519"}, true},
+		{"No subject", GenerateOptions{}, false},
+		{"Weak RSA key", GenerateOptions{CommonName: "weak", KeySize: 1024}, false},
+		{"Unknown key type", GenerateOptions{CommonName: "dsa", KeyType: "dsa"}, false},
+		{"Invalid IP", GenerateOptions{CommonName: "ip", IPAddresses: []string{"host"}}, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			certID, err := m.GenerateSelfSigned(tc.opts, "")
+			if !tc.isValid {
+				if err == nil {
+					t.Error("Should fail")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			certs := m.List([]string{certID}, CertificatePrivate)
+			if len(certs) != 1 || certs[0] == nil {
+				t.Fatal("Generated certificate should be stored with private key")
+			}
+
+			leaf := certs[0].Leaf
+			if leaf.Subject.CommonName != tc.opts.CommonName || len(leaf.DNSNames) != len(tc.opts.DNSNames) || len(leaf.IPAddresses) != len(tc.opts.IPAddresses) {
+				t.Error("Wrong certificate subject", leaf.Subject, leaf.DNSNames, leaf.IPAddresses)
+			}
+		})
+	}
+}
+
+func TestGenerateCSR(t *testing.T) {
+	m := newManager()
+
+	csrID, csrPEM, err := m.GenerateCSR(GenerateOptions{CommonName: "client", DNSNames: []string{"client.example.com"}}, "abcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stored, err := m.GetCSR(csrID); err != nil || string(stored) != string(csrPEM) {
+		t.Error("Certificate request should be stored", err)
+	}
+
+	block, _ := pem.Decode(csrPEM)
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil || csr.CheckSignature() != nil {
+		t.Fatal("Should return valid certificate request", err)
+	}
+
+	// Sign the request with a test CA
+	caPem, caKeyPem := genCertificateFromCommonName("ca")
+	caBlock, _ := pem.Decode(caPem)
+	ca, _ := x509.ParseCertificate(caBlock.Bytes)
+	caKeyBlock, _ := pem.Decode(caKeyPem)
+	caKey, _ := x509.ParsePKCS1PrivateKey(caKeyBlock.Bytes)
+
+	serialNumber, _ := rand.Int(rand.Reader, big.NewInt(1000))
+	der, _ := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      csr.Subject,
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}, ca, csr.PublicKey, caKey)
+	signedPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	if _, err := m.AddSignedCSR(csrID, caPem); err == nil {
+		t.Error("Should not accept certificate for another key")
+	}
+
+	certID, err := m.AddSignedCSR(csrID, signedPem)
+	if err != nil {
+		t.Fatal("Should add signed certificate", err)
+	}
+
+	if certID[:4] != "abcd" {
+		t.Error("Certificate should belong to the request organisation", certID)
+	}
+
+	certs := m.List([]string{certID}, CertificatePrivate)
+	if len(certs) != 1 || certs[0] == nil || leafSubjectName(certs[0]) != "client" {
+		t.Error("Signed certificate should be stored with the request key")
+	}
+
+	if _, err := m.GetCSR(csrID); err == nil {
+		t.Error("Completed request should be removed")
+	}
+}
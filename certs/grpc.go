@@ -0,0 +1,159 @@
+package certs
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/TykTechnologies/tyk/certs/certspb"
+)
+
+// GRPCService serves certificate management over gRPC, for control planes
+// managing certificates without the HTTP control API. Clients authenticate
+// with the token in "authorization" metadata.
+type GRPCService struct {
+	manager *CertificateManager
+	token   string
+}
+
+func NewGRPCService(manager *CertificateManager, token string) *GRPCService {
+	return &GRPCService{manager: manager, token: token}
+}
+
+// NewServer creates gRPC server with the service registered, which rejects
+// unauthenticated calls.
+func (s *GRPCService) NewServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := s.authenticate(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := s.authenticate(stream.Context()); err != nil {
+				return err
+			}
+			return handler(srv, stream)
+		}),
+	)
+
+	server := grpc.NewServer(opts...)
+	certspb.RegisterCertificatesServer(server, s)
+
+	return server
+}
+
+func (s *GRPCService) authenticate(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("authorization"); s.token != "" && len(values) == 1 &&
+		subtle.ConstantTimeCompare([]byte(values[0]), []byte(s.token)) == 1 {
+		return nil
+	}
+
+	return status.Error(codes.Unauthenticated, "Authorization failed")
+}
+
+// grpcCode maps certificate errors to gRPC status codes.
+func grpcCode(err error) codes.Code {
+	switch {
+	case errors.Is(err, ErrCertExists):
+		return codes.AlreadyExists
+	case errors.Is(err, ErrCertNotFound):
+		return codes.NotFound
+	case errors.Is(err, ErrCertInUse):
+		return codes.FailedPrecondition
+	default:
+		return codes.InvalidArgument
+	}
+}
+
+func (s *GRPCService) Add(_ context.Context, req *certspb.AddRequest) (*certspb.AddReply, error) {
+	var certID string
+	var err error
+	if req.Passphrase != "" {
+		certID, err = s.manager.AuditedBy("grpc").AddWithPassphrase(req.Pem, req.Passphrase, req.OrgId)
+	} else {
+		certID, err = s.manager.AuditedBy("grpc").Add(req.Pem, req.OrgId)
+	}
+	if err != nil {
+		return nil, status.Error(grpcCode(err), err.Error())
+	}
+
+	return &certspb.AddReply{Id: certID}, nil
+}
+
+func (s *GRPCService) List(_ context.Context, req *certspb.ListRequest) (*certspb.ListReply, error) {
+	return &certspb.ListReply{Ids: s.manager.listOrgIds(req.OrgId)}, nil
+}
+
+func (s *GRPCService) Delete(_ context.Context, req *certspb.DeleteRequest) (*certspb.DeleteReply, error) {
+	if raw, err := s.manager.storage.GetKey("raw-" + req.Id); err != nil || raw == "" || !s.owned(req.OrgId, req.Id) {
+		err := &CertificateError{CertID: req.Id, Err: ErrCertNotFound}
+		return nil, status.Error(grpcCode(err), err.Error())
+	}
+
+	s.manager.AuditedBy("grpc").Delete(req.Id)
+
+	return &certspb.DeleteReply{}, nil
+}
+
+func (s *GRPCService) Meta(_ context.Context, req *certspb.MetaRequest) (*certspb.MetaReply, error) {
+	reply := &certspb.MetaReply{}
+
+	for _, certID := range req.Ids {
+		if !s.owned(req.OrgId, certID) {
+			continue
+		}
+
+		certs := s.manager.List([]string{certID}, CertificateAny)
+		if len(certs) != 1 || certs[0] == nil {
+			continue
+		}
+
+		meta := ExtractCertificateMeta(certs[0], certID)
+		reply.Certificates = append(reply.Certificates, &certspb.CertificateMeta{
+			Id:          meta.ID,
+			Fingerprint: meta.Fingerprint,
+			HasPrivate:  meta.HasPrivateKey,
+			Issuer:      meta.Issuer.String(),
+			Subject:     meta.Subject.String(),
+			NotBefore:   meta.NotBefore.Unix(),
+			NotAfter:    meta.NotAfter.Unix(),
+			DnsNames:    meta.DNSNames,
+		})
+	}
+
+	return reply, nil
+}
+
+// Watch streams certificate changes until the client disconnects.
+func (s *GRPCService) Watch(req *certspb.WatchRequest, stream certspb.Certificates_WatchServer) error {
+	changes, stop := s.manager.Watch()
+	defer stop()
+
+	for {
+		select {
+		case change := <-changes:
+			if !s.owned(req.OrgId, change.CertID) {
+				continue
+			}
+
+			if err := stream.Send(&certspb.ChangeEvent{Type: change.Type, Id: change.CertID}); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// owned checks that the certificate belongs to the organisation, if set.
+func (s *GRPCService) owned(orgID, certID string) bool {
+	return orgID == "" || s.manager.ForOrg(orgID).Owns(certID)
+}
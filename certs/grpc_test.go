@@ -0,0 +1,91 @@
+package certs
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/TykTechnologies/tyk/certs/certspb"
+)
+
+func TestGRPCService(t *testing.T) {
+	m := newManager()
+
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	server := NewGRPCService(m, "token").NewServer()
+	go server.Serve(ln)
+	defer server.Stop()
+
+	conn, err := grpc.Dial(ln.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := certspb.NewCertificatesClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := client.List(ctx, &certspb.ListRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Fatal("Call without token should be rejected", err)
+	}
+
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "token")
+
+	watch, err := client.Watch(ctx, &certspb.WatchRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Watch is subscribed once the stream is established
+	for i := 0; i < 50; i++ {
+		m.mu.RLock()
+		watching := len(m.watchers) > 0
+		m.mu.RUnlock()
+
+		if watching {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	certPem, _ := genCertificateFromCommonName("grpc")
+	added, err := client.Add(ctx, &certspb.AddRequest{Pem: certPem})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := client.List(ctx, &certspb.ListRequest{})
+	if err != nil || len(list.Ids) != 1 || list.Ids[0] != added.Id {
+		t.Fatal("Added certificate should be listed", list, err)
+	}
+
+	meta, err := client.Meta(ctx, &certspb.MetaRequest{Ids: []string{added.Id}})
+	if err != nil || len(meta.Certificates) != 1 || meta.Certificates[0].Subject != "CN=grpc" || meta.Certificates[0].HasPrivate {
+		t.Fatal("Wrong certificate meta", meta, err)
+	}
+
+	if _, err := client.Delete(ctx, &certspb.DeleteRequest{Id: added.Id, OrgId: "abcd"}); status.Code(err) != codes.NotFound {
+		t.Error("Certificate of another organisation should not be deleted", err)
+	}
+
+	if _, err := client.Delete(ctx, &certspb.DeleteRequest{Id: added.Id}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{ChangeAdded, ChangeDeleted} {
+		event, err := watch.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if event.Type != expected || event.Id != added.Id {
+			t.Error("Wrong change event", event)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/pem"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// keyURIBlock is the PEM block type used to store reference to a private key
+// held outside of the storage, encrypted the same way as private keys.
+const keyURIBlock = "KEY URI"
+
+// KeyLoader returns signer for the private key referenced by URI. Public key
+// is the one of the certificate the key belongs to.
+type KeyLoader func(uri string, publicKey crypto.PublicKey) (crypto.Signer, error)
+
+var (
+	keyLoadersMu sync.RWMutex
+	keyLoaders   = map[string]KeyLoader{}
+)
+
+// RegisterKeyLoader registers loader for private key URIs with the scheme,
+// e.g. "pkcs11".
+func RegisterKeyLoader(scheme string, loader KeyLoader) {
+	keyLoadersMu.Lock()
+	keyLoaders[scheme] = loader
+	keyLoadersMu.Unlock()
+}
+
+func loadExternalKey(uri string, publicKey crypto.PublicKey) (crypto.Signer, error) {
+	scheme := strings.SplitN(uri, ":", 2)[0]
+
+	keyLoadersMu.RLock()
+	loader, ok := keyLoaders[scheme]
+	keyLoadersMu.RUnlock()
+
+	if !ok {
+		return nil, errors.New("No loader registered for " + scheme + " private keys")
+	}
+
+	return loader(uri, publicKey)
+}
+
+// AddWithKeyURI stores the certificate with a reference to its private key,
+// instead of the key itself. The key is loaded with the loader registered for
+// the URI scheme when the certificate is listed, so for PKCS#11 URIs the key
+// material never leaves the HSM.
+func (c *CertificateManager) AddWithKeyURI(certData []byte, keyURI, orgID string) (string, error) {
+	return c.AuditedBy("").AddWithKeyURI(certData, keyURI, orgID)
+}
+
+func (a *AuditedCertificates) AddWithKeyURI(certData []byte, keyURI, orgID string) (string, error) {
+	certID, err := a.manager.addWithKeyURI(certData, keyURI, orgID)
+	a.manager.audit(AuditAdd, certID, a.actor, err)
+	if err != nil {
+		return "", err
+	}
+
+	return certID, nil
+}
+
+func (c *CertificateManager) addWithKeyURI(certData []byte, keyURI, orgID string) (string, error) {
+	if _, err := url.Parse(keyURI); err != nil || !strings.Contains(keyURI, ":") {
+		err := errors.New("Invalid private key URI: " + keyURI)
+		c.logger.Error(err)
+		return "", err
+	}
+
+	certID, certChainPEM, err := c.encode(certData, orgID)
+	if err != nil {
+		return "", err
+	}
+
+	if bytes.Contains(certChainPEM, []byte("PRIVATE KEY")) {
+		err := errors.New("Private key can't be combined with private key URI")
+		c.logger.Error(err)
+		return certID, err
+	}
+
+	// URI may contain token PIN
+	encryptedURIBlock, err := c.encryptPEMBlock(keyURIBlock, []byte(keyURI))
+	if err != nil {
+		c.logger.Error("Failed to encode private key URI", err)
+		return certID, err
+	}
+
+	certChainPEM = append(certChainPEM, []byte("\n")...)
+	certChainPEM = append(certChainPEM, pem.EncodeToMemory(encryptedURIBlock)...)
+
+	_, err = c.store(context.Background(), certID, certChainPEM)
+	return certID, err
+}
+
+// PKCS11URI is a parsed RFC 7512 PKCS#11 URI identifying a private key.
+type PKCS11URI struct {
+	// ModulePath is the PKCS#11 library to load, from "module-path" query attribute.
+	ModulePath string
+	Token      string
+	Slot       int
+	HasSlot    bool
+	Object     string
+	ID         []byte
+	// PIN is the user PIN, from "pin-value" query attribute.
+	PIN string
+}
+
+// ParsePKCS11URI parses PKCS#11 URI, e.g.
+// pkcs11:token=gateway;object=server-key?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-value=1234
+func ParsePKCS11URI(uri string) (*PKCS11URI, error) {
+	if !strings.HasPrefix(uri, "pkcs11:") {
+		return nil, errors.New("PKCS#11 URI should start with pkcs11:")
+	}
+
+	path := strings.TrimPrefix(uri, "pkcs11:")
+	var query string
+	if i := strings.Index(path, "?"); i != -1 {
+		path, query = path[:i], path[i+1:]
+	}
+
+	var result PKCS11URI
+
+	for _, attr := range strings.Split(path, ";") {
+		if attr == "" {
+			continue
+		}
+
+		kv := strings.SplitN(attr, "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.New("Malformed PKCS#11 URI attribute: " + attr)
+		}
+
+		value, err := url.PathUnescape(kv[1])
+		if err != nil {
+			return nil, err
+		}
+
+		switch kv[0] {
+		case "token":
+			result.Token = value
+		case "object":
+			result.Object = value
+		case "id":
+			result.ID = []byte(value)
+		case "slot-id":
+			if result.Slot, err = strconv.Atoi(value); err != nil {
+				return nil, errors.New("Malformed PKCS#11 slot-id: " + value)
+			}
+			result.HasSlot = true
+		case "type":
+			if value != "private" {
+				return nil, errors.New("PKCS#11 URI should reference private key")
+			}
+		}
+	}
+
+	for _, attr := range strings.Split(query, "&") {
+		kv := strings.SplitN(attr, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		value, err := url.QueryUnescape(kv[1])
+		if err != nil {
+			return nil, err
+		}
+
+		switch kv[0] {
+		case "module-path":
+			result.ModulePath = value
+		case "pin-value":
+			result.PIN = value
+		}
+	}
+
+	if result.ModulePath == "" {
+		return nil, errors.New("PKCS#11 URI should specify module-path")
+	}
+
+	if result.Object == "" && len(result.ID) == 0 {
+		return nil, errors.New("PKCS#11 URI should specify object or id")
+	}
+
+	return &result, nil
+}
@@ -0,0 +1,105 @@
+package certs
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+)
+
+func TestParsePKCS11URI(t *testing.T) {
+	tests := []struct {
+		name   string
+		uri    string
+		expect *PKCS11URI
+	}{
+		{"Token and object", "pkcs11:token=gateway;object=server%20key;type=private?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-value=1234",
+			&PKCS11URI{ModulePath: "/usr/lib/softhsm/libsofthsm2.so", Token: "gateway", Object: "server key", PIN: "1234"}},
+		{"Slot and id", "pkcs11:slot-id=2;id=%01%02?module-path=/lib/p11.so",
+			&PKCS11URI{ModulePath: "/lib/p11.so", Slot: 2, HasSlot: true, ID: []byte{1, 2}}},
+		{"Wrong scheme", "file:key.pem", nil},
+		{"No module", "pkcs11:object=key", nil},
+		{"No object", "pkcs11:token=gateway?module-path=/lib/p11.so", nil},
+		{"Public key", "pkcs11:object=key;type=public?module-path=/lib/p11.so", nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			uri, err := ParsePKCS11URI(tc.uri)
+			if tc.expect == nil {
+				if err == nil {
+					t.Error("Should fail")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if uri.ModulePath != tc.expect.ModulePath || uri.Token != tc.expect.Token || uri.Object != tc.expect.Object ||
+				uri.PIN != tc.expect.PIN || uri.Slot != tc.expect.Slot || uri.HasSlot != tc.expect.HasSlot || string(uri.ID) != string(tc.expect.ID) {
+				t.Errorf("Wrong URI: %+v", uri)
+			}
+		})
+	}
+}
+
+func TestAddWithKeyURI(t *testing.T) {
+	m := newManager()
+
+	certPem, keyPem := genCertificateFromCommonName("hsm")
+	keyBlock, _ := pem.Decode(keyPem)
+	key, _ := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+
+	var loadedURI string
+	RegisterKeyLoader("test", func(uri string, publicKey crypto.PublicKey) (crypto.Signer, error) {
+		loadedURI = uri
+		if publicKey.(*rsa.PublicKey).N.Cmp(key.N) != 0 {
+			return nil, errors.New("wrong public key")
+		}
+		return key, nil
+	})
+
+	if _, err := m.AddWithKeyURI(append(certPem, keyPem...), "test:key", ""); err == nil {
+		t.Error("Should not accept private key together with key URI")
+	}
+
+	if _, err := m.AddWithKeyURI(certPem, "key", ""); err == nil {
+		t.Error("Should not accept invalid URI")
+	}
+
+	certID, err := m.AddWithKeyURI(certPem, "test:key?pin-value=1234", "")
+	if err != nil {
+		t.Fatal("Should add certificate", err)
+	}
+
+	raw, _ := m.GetRaw(certID)
+	if block, _ := pem.Decode([]byte(raw[len(certPem):])); block == nil || block.Type != "ENCRYPTED "+keyURIBlock {
+		t.Error("Key URI should be stored encrypted")
+	}
+
+	certs := m.List([]string{certID}, CertificatePrivate)
+	if len(certs) != 1 || certs[0] == nil {
+		t.Fatal("Certificate should be listed with private key")
+	}
+
+	if loadedURI != "test:key?pin-value=1234" {
+		t.Error("Key should be loaded by URI", loadedURI)
+	}
+
+	if _, ok := certs[0].PrivateKey.(crypto.Signer); !ok {
+		t.Error("Private key should be crypto.Signer")
+	}
+
+	t.Run("Unknown scheme", func(t *testing.T) {
+		certPem, _ := genCertificateFromCommonName("unknown")
+		certID, _ := m.AddWithKeyURI(certPem, "unknown:key", "")
+
+		if certs := m.List([]string{certID}, CertificateAny); len(certs) != 1 || certs[0] != nil {
+			t.Error("Certificate with unknown key loader should not be loaded")
+		}
+	})
+}
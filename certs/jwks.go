@@ -0,0 +1,227 @@
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// JSONWebKey is a public key in RFC 7517 format.
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	// Kid is the SHA256 fingerprint of the certificate or public key, the
+	// same as the certificate ID without organisation prefix.
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+
+	// RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// Elliptic curve and Ed25519 keys
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+
+	// Certificate chain, only set for certificates
+	X5c     []string `json:"x5c,omitempty"`
+	X5tS256 string   `json:"x5t#S256,omitempty"`
+}
+
+// JSONWebKeySet is a JWKS document.
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JWKS returns public keys of the certificates as JWKS document. Certificates
+// which can't be loaded or have unsupported key types are skipped.
+func (c *CertificateManager) JWKS(certIDs []string) *JSONWebKeySet {
+	set := &JSONWebKeySet{Keys: []JSONWebKey{}}
+
+	for _, id := range certIDs {
+		certs := c.List([]string{id}, CertificateAny)
+		if len(certs) == 0 || certs[0] == nil {
+			continue
+		}
+
+		key, err := NewJSONWebKey(certs[0])
+		if err != nil {
+			c.logger.Warning("Can't publish certificate ", id, " as JWK: ", err)
+			continue
+		}
+
+		set.Keys = append(set.Keys, *key)
+	}
+
+	return set
+}
+
+// NewJSONWebKey converts public key of the certificate to JWK.
+func NewJSONWebKey(cert *tls.Certificate) (*JSONWebKey, error) {
+	if len(cert.Certificate) == 0 {
+		return nil, errors.New("Certificate is empty")
+	}
+
+	key := &JSONWebKey{
+		Kid: HexSHA256(cert.Certificate[0]),
+		Use: "sig",
+	}
+
+	var publicKey interface{}
+	if cert.Leaf != nil && cert.Leaf.PublicKey != nil {
+		publicKey = cert.Leaf.PublicKey
+
+		for _, der := range cert.Certificate {
+			key.X5c = append(key.X5c, base64.StdEncoding.EncodeToString(der))
+		}
+		sum := sha256.Sum256(cert.Certificate[0])
+		key.X5tS256 = base64.RawURLEncoding.EncodeToString(sum[:])
+	} else {
+		// Stored public keys have only the PKIX encoded key
+		var err error
+		if publicKey, err = x509.ParsePKIXPublicKey(cert.Certificate[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	switch pub := publicKey.(type) {
+	case *rsa.PublicKey:
+		key.Kty = "RSA"
+		key.Alg = "RS256"
+		key.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		key.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+
+		key.Kty = "EC"
+		switch pub.Curve {
+		case elliptic.P256():
+			key.Crv, key.Alg = "P-256", "ES256"
+		case elliptic.P384():
+			key.Crv, key.Alg = "P-384", "ES384"
+		case elliptic.P521():
+			key.Crv, key.Alg = "P-521", "ES512"
+		default:
+			return nil, errors.New("Unsupported elliptic curve " + pub.Curve.Params().Name)
+		}
+		key.X = base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+		key.Y = base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		key.Kty = "OKP"
+		key.Crv = "Ed25519"
+		key.Alg = "EdDSA"
+		key.X = base64.RawURLEncoding.EncodeToString(pub)
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKeyType, pub)
+	}
+
+	return key, nil
+}
+
+// PublicKey converts the JWK to public key. Certificate from the x5c chain is
+// used for keys without key parameters.
+func (k *JSONWebKey) PublicKey() (crypto.PublicKey, error) {
+	decode := func(value string) ([]byte, error) {
+		data, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil || len(data) == 0 {
+			return nil, errors.New("Malformed JWK parameter")
+		}
+		return data, nil
+	}
+
+	switch {
+	case k.Kty == "RSA" && k.N != "":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("RSA public exponent is too large")
+		}
+
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case k.Kty == "EC" && k.X != "":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.New("Unsupported elliptic curve " + k.Crv)
+		}
+
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("EC public key is not on the curve")
+		}
+		return pub, nil
+	case k.Kty == "OKP" && k.Crv == "Ed25519":
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("Malformed Ed25519 public key")
+		}
+		return ed25519.PublicKey(x), nil
+	case len(k.X5c) > 0:
+		der, err := base64.StdEncoding.DecodeString(k.X5c[0])
+		if err != nil {
+			return nil, err
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedKeyType, k.Kty)
+}
+
+// Thumbprint returns the SHA-256 thumbprint of the key as of RFC 7638,
+// base64url encoded.
+func (k *JSONWebKey) Thumbprint() (string, error) {
+	// Only the required members, in lexicographic order
+	var input string
+	switch k.Kty {
+	case "RSA":
+		input = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, k.E, k.N)
+	case "EC":
+		input = fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`, k.Crv, k.X, k.Y)
+	case "OKP":
+		input = fmt.Sprintf(`{"crv":%q,"kty":"OKP","x":%q}`, k.Crv, k.X)
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedKeyType, k.Kty)
+	}
+
+	sum := sha256.Sum256([]byte(input))
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,331 @@
+package certs
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// jwksURLTag and jwksKidTag are certificate tags of public keys imported
+	// from a JWKS, used to restore imported keys after restart.
+	jwksURLTag = "jwks-url"
+	jwksKidTag = "jwks-kid"
+
+	defaultJWKSInterval  = 5 * time.Minute
+	defaultJWKSRetention = time.Hour
+	// jwksMinRefreshInterval limits refreshes triggered by unknown key IDs,
+	// so tokens with random key IDs can't flood the identity provider.
+	jwksMinRefreshInterval = 10 * time.Second
+)
+
+// retiredJWK is a key removed from the JWKS, kept until tokens signed with it
+// expire.
+type retiredJWK struct {
+	certID string
+	since  time.Time
+}
+
+// JWKSImport polls a remote JWKS, e.g. of an identity provider, and stores its
+// keys as public keys with fingerprint IDs. When the identity provider rotates
+// keys, a token with a new key ID triggers refresh ahead of the next poll, and
+// removed keys are kept for the retention period.
+type JWKSImport struct {
+	manager    *CertificateManager
+	client     *http.Client
+	url        string
+	orgID      string
+	interval   time.Duration
+	retention  time.Duration
+	minRefresh time.Duration
+
+	mu        sync.Mutex
+	etag      string
+	lastFetch time.Time
+	keys      map[string]string
+	retired   map[string]retiredJWK
+	stop      chan struct{}
+}
+
+// ImportJWKS registers the JWKS URL. Keys are stored for the organisation,
+// and polled on every interval once started. Keys removed from the JWKS are
+// deleted after retention. Registering the same URL again returns the
+// existing import.
+func (c *CertificateManager) ImportJWKS(url, orgID string, interval, retention time.Duration) *JWKSImport {
+	if interval <= 0 {
+		interval = defaultJWKSInterval
+	}
+	if retention <= 0 {
+		retention = defaultJWKSRetention
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if j, found := c.jwksImports[url]; found {
+		return j
+	}
+
+	j := &JWKSImport{
+		manager:    c,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		url:        url,
+		orgID:      orgID,
+		interval:   interval,
+		retention:  retention,
+		minRefresh: jwksMinRefreshInterval,
+		keys:       map[string]string{},
+		retired:    map[string]retiredJWK{},
+	}
+
+	if c.jwksImports == nil {
+		c.jwksImports = map[string]*JWKSImport{}
+	}
+	c.jwksImports[url] = j
+
+	return j
+}
+
+// JWKSImport returns the import registered for the URL, or nil.
+func (c *CertificateManager) JWKSImport(url string) *JWKSImport {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.jwksImports[url]
+}
+
+// Start restores keys imported before restart, and polls the JWKS in
+// background.
+func (j *JWKSImport) Start() {
+	j.mu.Lock()
+	if j.stop != nil {
+		j.mu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	j.stop = stop
+
+	for _, certID := range j.manager.ListByTag(jwksURLTag, j.url) {
+		if kid := j.manager.Tags(certID)[jwksKidTag]; kid != "" {
+			j.keys[kid] = certID
+		}
+	}
+	j.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+
+		for {
+			if err := j.Refresh(); err != nil {
+				j.manager.logger.Error("Can't refresh JWKS ", j.url, ": ", err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func (j *JWKSImport) Stop() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.stop != nil {
+		close(j.stop)
+		j.stop = nil
+	}
+}
+
+// CertID returns ID of the stored public key with the key ID, refreshing the
+// JWKS if the key ID is unknown.
+func (j *JWKSImport) CertID(kid string) (string, bool) {
+	if certID, found := j.lookup(kid); found {
+		return certID, true
+	}
+
+	j.mu.Lock()
+	recent := time.Since(j.lastFetch) < j.minRefresh
+	j.mu.Unlock()
+
+	if recent {
+		return "", false
+	}
+
+	if err := j.Refresh(); err != nil {
+		j.manager.logger.Error("Can't refresh JWKS ", j.url, ": ", err)
+		return "", false
+	}
+
+	return j.lookup(kid)
+}
+
+// PublicKeyPEM returns PEM encoded public key with the key ID.
+func (j *JWKSImport) PublicKeyPEM(kid string) ([]byte, error) {
+	certID, found := j.CertID(kid)
+	if !found {
+		return nil, errors.New("No matching KID could be found")
+	}
+
+	raw, err := j.manager.storage.GetKey("raw-" + certID)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(raw), nil
+}
+
+func (j *JWKSImport) lookup(kid string) (string, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if certID, found := j.keys[kid]; found {
+		return certID, true
+	}
+
+	retired, found := j.retired[kid]
+	return retired.certID, found
+}
+
+// Refresh fetches the JWKS, stores new keys, and retires removed ones.
+func (j *JWKSImport) Refresh() error {
+	j.mu.Lock()
+	etag := j.etag
+	j.lastFetch = time.Now()
+	j.mu.Unlock()
+
+	req, err := http.NewRequest("GET", j.url, nil)
+	if err != nil {
+		return err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		j.expireRetired()
+		return nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("JWKS returned status " + strconv.Itoa(resp.StatusCode))
+	}
+
+	var set JSONWebKeySet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return err
+	}
+
+	keys := map[string]string{}
+	for i := range set.Keys {
+		key := &set.Keys[i]
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+
+		certID, err := j.store(key)
+		if err != nil {
+			j.manager.logger.Warning("Can't import key ", key.Kid, " of JWKS ", j.url, ": ", err)
+			continue
+		}
+		keys[key.Kid] = certID
+	}
+
+	now := time.Now()
+
+	j.mu.Lock()
+	for kid, certID := range j.keys {
+		if keys[kid] != certID {
+			j.retired[kid] = retiredJWK{certID: certID, since: now}
+		}
+	}
+	for kid := range keys {
+		delete(j.retired, kid)
+	}
+	j.keys = keys
+	j.etag = resp.Header.Get("ETag")
+	j.mu.Unlock()
+
+	j.expireRetired()
+
+	return nil
+}
+
+// store adds the key as public key, unless it's already stored.
+func (j *JWKSImport) store(key *JSONWebKey) (string, error) {
+	publicKey, err := key.PublicKey()
+	if err != nil {
+		return "", err
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	certID := j.orgID + HexSHA256(der)
+	if raw, _ := j.manager.storage.GetKey("raw-" + certID); raw != "" {
+		return certID, nil
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	if _, err := j.manager.AuditedBy("jwks").Add(keyPEM, j.orgID); err != nil {
+		return "", err
+	}
+
+	tags := j.manager.Tags(certID)
+	if tags == nil {
+		tags = map[string]string{}
+	}
+	tags[jwksURLTag] = j.url
+	tags[jwksKidTag] = key.Kid
+	j.manager.SetTags(certID, tags)
+
+	j.manager.logger.Info("Imported key ", key.Kid, " of JWKS ", j.url, " as ", certID)
+
+	return certID, nil
+}
+
+// expireRetired deletes retired keys after the retention period, unless the
+// key is back in the JWKS or referenced elsewhere.
+func (j *JWKSImport) expireRetired() {
+	j.mu.Lock()
+	var expired []string
+	for kid, retired := range j.retired {
+		if time.Since(retired.since) < j.retention {
+			continue
+		}
+		delete(j.retired, kid)
+
+		current := false
+		for _, certID := range j.keys {
+			current = current || certID == retired.certID
+		}
+		if !current {
+			expired = append(expired, retired.certID)
+		}
+	}
+	j.mu.Unlock()
+
+	for _, certID := range expired {
+		if err := j.manager.AuditedBy("jwks").DeleteUnused(certID); err != nil {
+			j.manager.logger.Warning("Keeping retired JWKS key ", certID, ": ", err)
+			continue
+		}
+		j.manager.logger.Info("Removed retired key ", certID, " of JWKS ", j.url)
+	}
+}
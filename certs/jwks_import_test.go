@@ -0,0 +1,145 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestJWKSImport(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rotatedKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	jwk := func(kid string, pub interface{}) JSONWebKey {
+		der, _ := x509.MarshalPKIXPublicKey(pub)
+		key, err := NewJSONWebKey(&tls.Certificate{Certificate: [][]byte{der}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		key.Kid = kid
+		return *key
+	}
+
+	var mu sync.Mutex
+	var requests int
+	set := JSONWebKeySet{Keys: []JSONWebKey{jwk("rsa", &rsaKey.PublicKey), jwk("ec", &ecKey.PublicKey)}}
+	version := 1
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		requests++
+		etag := `"` + strconv.Itoa(version) + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		json.NewEncoder(w).Encode(set)
+	}))
+	defer server.Close()
+
+	m := newManager()
+	j := m.ImportJWKS(server.URL, "", time.Hour, time.Hour)
+	j.minRefresh = 0
+
+	if m.ImportJWKS(server.URL, "", 0, 0) != j || m.JWKSImport(server.URL) != j {
+		t.Fatal("Import should be registered once")
+	}
+
+	if err := j.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	rsaID, found := j.CertID("rsa")
+	rsaDer, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if !found || rsaID != HexSHA256(rsaDer) {
+		t.Fatal("Imported key should be stored by fingerprint", rsaID)
+	}
+
+	if fingerprints := m.ListPublicKeys([]string{rsaID}); len(fingerprints) != 1 || fingerprints[0] != rsaID {
+		t.Error("Imported key should be listed", fingerprints)
+	}
+
+	keyPEM, err := j.PublicKeyPEM("ec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParsePEMCertificate(keyPEM, ""); err != nil {
+		t.Error("PEM public key should be returned", err)
+	}
+
+	t.Run("Not modified", func(t *testing.T) {
+		if err := j.Refresh(); err != nil {
+			t.Fatal(err)
+		}
+		if _, found := j.CertID("rsa"); !found {
+			t.Error("Keys should be kept")
+		}
+	})
+
+	t.Run("Rollover", func(t *testing.T) {
+		mu.Lock()
+		set = JSONWebKeySet{Keys: []JSONWebKey{jwk("rotated", &rotatedKey.PublicKey), jwk("ec", &ecKey.PublicKey)}}
+		version++
+		mu.Unlock()
+
+		// Unknown key ID triggers refresh
+		if _, found := j.CertID("rotated"); !found {
+			t.Fatal("Rotated key should be fetched")
+		}
+
+		if id, found := j.CertID("rsa"); !found || id != rsaID {
+			t.Error("Removed key should be kept for retention")
+		}
+
+		j.retention = 0
+		j.Refresh()
+
+		if _, found := j.CertID("rsa"); found {
+			t.Error("Removed key should expire")
+		}
+		if raw, _ := m.GetRaw(rsaID); raw != "" {
+			t.Error("Expired key should be deleted")
+		}
+	})
+
+	t.Run("Refresh limit", func(t *testing.T) {
+		j.minRefresh = time.Hour
+
+		mu.Lock()
+		before := requests
+		mu.Unlock()
+
+		j.CertID("unknown")
+		j.CertID("unknown")
+
+		mu.Lock()
+		defer mu.Unlock()
+		if requests != before {
+			t.Error("Unknown key IDs should not refresh JWKS too often")
+		}
+	})
+
+	t.Run("Restore", func(t *testing.T) {
+		restored := NewCertificateManager(m.storage, "test", nil).ImportJWKS(server.URL, "", time.Hour, time.Hour)
+		restored.Start()
+		defer restored.Stop()
+
+		if _, found := restored.lookup("rotated"); !found {
+			t.Error("Imported keys should be restored from tags")
+		}
+	})
+}
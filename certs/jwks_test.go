@@ -0,0 +1,89 @@
+package certs
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+)
+
+func TestJWKS(t *testing.T) {
+	m := newManager()
+	orgID := "5e9d9544a1dcd60001d0ed20"
+
+	rsaID, _ := m.GenerateSelfSigned(GenerateOptions{CommonName: "rsa"}, orgID)
+	ecID, _ := m.GenerateSelfSigned(GenerateOptions{CommonName: "ec", KeyType: "ecdsa", KeySize: 521}, orgID)
+	edID, _ := m.GenerateSelfSigned(GenerateOptions{CommonName: "ed", KeyType: "ed25519"}, orgID)
+
+	priv, _ := rsa.GenerateKey(rand.Reader, 2048)
+	pubDer, _ := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	pubID, err := m.Add(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDer}), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := m.JWKS([]string{rsaID, ecID, "missing", edID, pubID})
+	if len(set.Keys) != 4 {
+		t.Fatal("Missing certificates should be skipped", set.Keys)
+	}
+
+	rsaKey, ecKey, edKey, pubKey := set.Keys[0], set.Keys[1], set.Keys[2], set.Keys[3]
+
+	if rsaKey.Kty != "RSA" || rsaKey.Alg != "RS256" || rsaKey.Kid != rsaID[len(orgID):] {
+		t.Error("Wrong RSA key", rsaKey)
+	}
+	if len(rsaKey.X5c) != 1 || rsaKey.X5tS256 == "" {
+		t.Error("Certificate chain should be included", rsaKey)
+	}
+
+	der, _ := base64.StdEncoding.DecodeString(rsaKey.X5c[0])
+	cert, _ := x509.ParseCertificate(der)
+	n, _ := base64.RawURLEncoding.DecodeString(rsaKey.N)
+	if cert == nil || cert.PublicKey.(*rsa.PublicKey).N.Cmp(new(big.Int).SetBytes(n)) != 0 {
+		t.Error("RSA modulus should match the certificate")
+	}
+
+	x, _ := base64.RawURLEncoding.DecodeString(ecKey.X)
+	if ecKey.Kty != "EC" || ecKey.Crv != "P-521" || ecKey.Alg != "ES512" || len(x) != 66 {
+		t.Error("Wrong EC key", ecKey)
+	}
+
+	if edKey.Kty != "OKP" || edKey.Crv != "Ed25519" || len(edKey.X) != base64.RawURLEncoding.EncodedLen(ed25519.PublicKeySize) {
+		t.Error("Wrong Ed25519 key", edKey)
+	}
+
+	if pubKey.Kty != "RSA" || pubKey.Kid != pubID || pubKey.X5c != nil {
+		t.Error("Wrong public key", pubKey)
+	}
+
+	e, _ := base64.RawURLEncoding.DecodeString(pubKey.E)
+	if int(new(big.Int).SetBytes(e).Int64()) != priv.E {
+		t.Error("Wrong public exponent", pubKey.E)
+	}
+}
+
+func TestJWKThumbprint(t *testing.T) {
+	// Example of RFC 7638, section 3.1
+	key := JSONWebKey{
+		Kty: "RSA",
+		N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E:   "AQAB",
+		Alg: "RS256",
+		Kid: "2011-04-29",
+	}
+	thumbprint, err := key.Thumbprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if thumbprint != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Error("Wrong thumbprint", thumbprint)
+	}
+
+	if _, err := (&JSONWebKey{Kty: "oct"}).Thumbprint(); err == nil {
+		t.Error("Symmetric keys are not supported")
+	}
+}
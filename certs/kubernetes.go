@@ -0,0 +1,519 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	kubernetesTLSSecret = "kubernetes.io/tls"
+	// kubernetesSecretTag is the certificate tag with "namespace/name" of the
+	// secret the certificate is synced from.
+	kubernetesSecretTag = "kubernetes-secret"
+	// kubernetesCertLabel marks secrets written back from the certificate
+	// storage, which are not synced in again.
+	kubernetesCertLabel = "tyk.io/certificate-id"
+
+	kubernetesServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount/"
+	kubernetesRetryInterval     = 5 * time.Second
+)
+
+type kubernetesMeta struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace,omitempty"`
+	ResourceVersion string            `json:"resourceVersion,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+}
+
+type kubernetesSecret struct {
+	APIVersion string            `json:"apiVersion,omitempty"`
+	Kind       string            `json:"kind,omitempty"`
+	Metadata   kubernetesMeta    `json:"metadata"`
+	Type       string            `json:"type"`
+	Data       map[string][]byte `json:"data"`
+}
+
+func (s *kubernetesSecret) key() string {
+	return s.Metadata.Namespace + "/" + s.Metadata.Name
+}
+
+type kubernetesSecretList struct {
+	Metadata kubernetesMeta     `json:"metadata"`
+	Items    []kubernetesSecret `json:"items"`
+}
+
+type kubernetesWatchEvent struct {
+	Type   string           `json:"type"`
+	Object kubernetesSecret `json:"object"`
+}
+
+// KubernetesSync mirrors kubernetes.io/tls secrets of the namespaces into the
+// certificate storage, e.g. to use certificates issued by cert-manager.
+// Certificate ID of a secret stays the same when the secret is renewed, so
+// APIs referencing it keep working. Optionally certificates with private keys
+// added to the storage are written back as secrets to one namespace.
+type KubernetesSync struct {
+	manager    *CertificateManager
+	client     *http.Client
+	apiURL     string
+	token      string
+	namespaces []string
+	writeBack  string
+
+	mu      sync.Mutex
+	secrets map[string]string
+	stop    chan struct{}
+}
+
+// NewKubernetesSync creates sync using the in-cluster service account. Empty
+// writeBack namespace disables writing certificates back.
+func NewKubernetesSync(manager *CertificateManager, namespaces []string, writeBack string) (*KubernetesSync, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("Kubernetes sync should run in a cluster")
+	}
+
+	token, err := ioutil.ReadFile(kubernetesServiceAccountDir + "token")
+	if err != nil {
+		return nil, err
+	}
+
+	caPEM, err := ioutil.ReadFile(kubernetesServiceAccountDir + "ca.crt")
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(caPEM)
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+
+	return newKubernetesSync(manager, client, "https://"+host+":"+port, string(bytes.TrimSpace(token)), namespaces, writeBack), nil
+}
+
+func newKubernetesSync(manager *CertificateManager, client *http.Client, apiURL, token string, namespaces []string, writeBack string) *KubernetesSync {
+	return &KubernetesSync{
+		manager:    manager,
+		client:     client,
+		apiURL:     apiURL,
+		token:      token,
+		namespaces: namespaces,
+		writeBack:  writeBack,
+		secrets:    map[string]string{},
+	}
+}
+
+// Start syncs and watches secrets of every namespace in background.
+func (k *KubernetesSync) Start() {
+	k.mu.Lock()
+	if k.stop != nil {
+		k.mu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	k.stop = stop
+
+	// Restore secrets synced before restart
+	for _, certID := range k.manager.ListAllIds("") {
+		if key := k.manager.Tags(certID)[kubernetesSecretTag]; key != "" {
+			k.secrets[key] = certID
+		}
+	}
+	k.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	for _, namespace := range k.namespaces {
+		go k.watchNamespace(ctx, namespace)
+	}
+
+	if k.writeBack != "" {
+		changes, stopWatch := k.manager.Watch()
+		go func() {
+			<-stop
+			stopWatch()
+		}()
+		go k.writeBackLoop(changes)
+	}
+}
+
+func (k *KubernetesSync) Stop() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.stop != nil {
+		close(k.stop)
+		k.stop = nil
+	}
+}
+
+func (k *KubernetesSync) watchNamespace(ctx context.Context, namespace string) {
+	for ctx.Err() == nil {
+		version, err := k.syncNamespace(ctx, namespace)
+		if err == nil {
+			err = k.watch(ctx, namespace, version)
+		}
+
+		if err != nil && ctx.Err() == nil {
+			k.manager.logger.Error("Kubernetes secrets sync of ", namespace, " failed: ", err)
+		}
+
+		select {
+		case <-time.After(kubernetesRetryInterval):
+		case <-ctx.Done():
+		}
+	}
+}
+
+// syncNamespace syncs all secrets of the namespace, and returns resource
+// version to watch from.
+func (k *KubernetesSync) syncNamespace(ctx context.Context, namespace string) (string, error) {
+	resp, err := k.do(ctx, "GET", k.secretsPath(namespace)+"?fieldSelector="+url.QueryEscape("type="+kubernetesTLSSecret), nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var list kubernetesSecretList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return "", err
+	}
+
+	listed := map[string]bool{}
+	for i := range list.Items {
+		secret := &list.Items[i]
+		secret.Metadata.Namespace = namespace
+		listed[secret.key()] = true
+		k.syncSecret(secret)
+	}
+
+	// Secrets removed while not watching
+	k.mu.Lock()
+	var removed []string
+	for key := range k.secrets {
+		if strings.HasPrefix(key, namespace+"/") && !listed[key] {
+			removed = append(removed, key)
+		}
+	}
+	k.mu.Unlock()
+
+	for _, key := range removed {
+		k.removeSecret(key)
+	}
+
+	return list.Metadata.ResourceVersion, nil
+}
+
+func (k *KubernetesSync) watch(ctx context.Context, namespace, version string) error {
+	query := "?watch=true&resourceVersion=" + url.QueryEscape(version) +
+		"&fieldSelector=" + url.QueryEscape("type="+kubernetesTLSSecret)
+
+	resp, err := k.do(ctx, "GET", k.secretsPath(namespace)+query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event kubernetesWatchEvent
+		if err := decoder.Decode(&event); err != nil {
+			return err
+		}
+
+		event.Object.Metadata.Namespace = namespace
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			k.syncSecret(&event.Object)
+		case "DELETED":
+			k.removeSecret(event.Object.key())
+		case "ERROR":
+			// Resource version is too old, list again
+			return errors.New("Watch expired")
+		}
+	}
+}
+
+// syncSecret adds certificate of the secret, or replaces the certificate
+// synced from the secret before.
+func (k *KubernetesSync) syncSecret(secret *kubernetesSecret) {
+	if secret.Type != kubernetesTLSSecret || secret.Metadata.Labels[kubernetesCertLabel] != "" {
+		return
+	}
+
+	certData := append(append([]byte{}, secret.Data["tls.crt"]...), '\n')
+	certData = append(certData, secret.Data["tls.key"]...)
+
+	key := secret.key()
+
+	k.mu.Lock()
+	certID, synced := k.secrets[key]
+	k.mu.Unlock()
+
+	if synced {
+		if k.sameCertificate(certID, secret.Data["tls.crt"]) {
+			return
+		}
+
+		if err := k.manager.Replace(certID, certData); err != nil {
+			k.manager.logger.Error("Can't update certificate from secret ", key, ": ", err)
+			return
+		}
+		k.manager.logger.Info("Updated certificate ", certID, " from secret ", key)
+		return
+	}
+
+	newID, _, err := k.manager.encode(certData, "")
+	if err != nil {
+		k.manager.logger.Error("Can't sync certificate from secret ", key, ": ", err)
+		return
+	}
+
+	// Secret is recorded before adding, so the certificate is not written back
+	k.mu.Lock()
+	k.secrets[key] = newID
+	k.mu.Unlock()
+
+	if _, err := k.manager.Add(certData, ""); err != nil {
+		k.manager.logger.Debug("Certificate of secret ", key, " is already stored: ", err)
+	}
+
+	tags := k.manager.Tags(newID)
+	if tags == nil {
+		tags = map[string]string{}
+	}
+	tags[kubernetesSecretTag] = key
+	k.manager.SetTags(newID, tags)
+
+	k.manager.logger.Info("Added certificate ", newID, " from secret ", key)
+}
+
+func (k *KubernetesSync) sameCertificate(certID string, certPEM []byte) bool {
+	block, _ := pem.Decode(certPEM)
+	certs := k.manager.List([]string{certID}, CertificateAny)
+
+	return block != nil && len(certs) == 1 && certs[0] != nil &&
+		HexSHA256(block.Bytes) == string(certs[0].Leaf.Extensions[0].Value)
+}
+
+// removeSecret removes certificate of the removed secret, unless it's used.
+func (k *KubernetesSync) removeSecret(key string) {
+	k.mu.Lock()
+	certID, ok := k.secrets[key]
+	delete(k.secrets, key)
+	k.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	if err := k.manager.DeleteUnused(certID); err != nil {
+		k.manager.logger.Warning("Keeping certificate of removed secret ", key, ": ", err)
+		return
+	}
+
+	k.manager.logger.Info("Removed certificate ", certID, " of removed secret ", key)
+}
+
+func (k *KubernetesSync) writeBackLoop(changes <-chan CertificateChange) {
+	for change := range changes {
+		if k.fromSecret(change.CertID) {
+			continue
+		}
+
+		var err error
+		if change.Type == ChangeDeleted {
+			err = k.deleteSecret(change.CertID)
+		} else {
+			err = k.writeSecret(change.CertID)
+		}
+
+		if err != nil {
+			k.manager.logger.Error("Can't write certificate ", change.CertID, " back to Kubernetes: ", err)
+		}
+	}
+}
+
+func (k *KubernetesSync) fromSecret(certID string) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for _, id := range k.secrets {
+		if id == certID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeSecret creates or updates secret with the certificate, if it has a
+// private key.
+func (k *KubernetesSync) writeSecret(certID string) error {
+	raw, err := k.manager.storage.GetKey("raw-" + certID)
+	if err != nil || raw == "" {
+		return nil
+	}
+
+	passphrase, err := k.manager.keyPassphrase(context.Background(), certID)
+	if err != nil {
+		return err
+	}
+
+	blocks, err := parsePEM([]byte(raw), k.manager.secret, passphrase)
+	if err != nil {
+		return err
+	}
+
+	var certPEM, keyPEM []byte
+	for _, block := range blocks {
+		switch block.Type {
+		case "CERTIFICATE":
+			certPEM = append(certPEM, pem.EncodeToMemory(block)...)
+		case "PRIVATE KEY":
+			key, err := parsePrivateKey(block.Bytes)
+			if err != nil {
+				return err
+			}
+			der, err := x509.MarshalPKCS8PrivateKey(key)
+			if err != nil {
+				return err
+			}
+			keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		}
+	}
+
+	if len(certPEM) == 0 || len(keyPEM) == 0 {
+		return nil
+	}
+
+	secret := kubernetesSecret{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata: kubernetesMeta{
+			Name:   k.secretName(certID),
+			Labels: map[string]string{kubernetesCertLabel: certID},
+		},
+		Type: kubernetesTLSSecret,
+		Data: map[string][]byte{"tls.crt": certPEM, "tls.key": keyPEM},
+	}
+
+	body, _ := json.Marshal(secret)
+	resp, err := k.do(context.Background(), "POST", k.secretsPath(k.writeBack), body)
+	if resp != nil && resp.StatusCode == http.StatusConflict {
+		resp.Body.Close()
+		resp, err = k.do(context.Background(), "PUT", k.secretsPath(k.writeBack)+"/"+secret.Metadata.Name, body)
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+func (k *KubernetesSync) deleteSecret(certID string) error {
+	resp, err := k.do(context.Background(), "DELETE", k.secretsPath(k.writeBack)+"/"+k.secretName(certID), nil)
+	if resp != nil {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// kubernetesScheme prefixes "namespace/name" of secrets used as certificate
+// references.
+const kubernetesScheme = "k8s://"
+
+// Match reports references to TLS secrets, e.g. "k8s://default/web-tls", so
+// the sync can be used as certificate source for secrets of any namespace.
+func (k *KubernetesSync) Match(ref string) bool {
+	return strings.HasPrefix(ref, kubernetesScheme)
+}
+
+// Fetch reads the certificate and private key of the secret.
+func (k *KubernetesSync) Fetch(ref string) ([]byte, error) {
+	parts := strings.SplitN(strings.TrimPrefix(ref, kubernetesScheme), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, errors.New("Kubernetes secret reference should be k8s://namespace/name")
+	}
+
+	resp, err := k.do(context.Background(), "GET", k.secretsPath(parts[0])+"/"+url.PathEscape(parts[1]), nil)
+	if err != nil {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var secret kubernetesSecret
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, err
+	}
+
+	if secret.Type != kubernetesTLSSecret {
+		return nil, errors.New("Kubernetes secret " + parts[0] + "/" + parts[1] + " is not a TLS secret")
+	}
+
+	certData := append(append([]byte{}, secret.Data["tls.crt"]...), '\n')
+	return append(certData, secret.Data["tls.key"]...), nil
+}
+
+func (k *KubernetesSync) secretName(certID string) string {
+	return "tyk-" + certID
+}
+
+func (k *KubernetesSync) secretsPath(namespace string) string {
+	return "/api/v1/namespaces/" + url.PathEscape(namespace) + "/secrets"
+}
+
+// do sends API request, and returns error for unsuccessful responses. For
+// conflicts and missing resources response is returned as well.
+func (k *KubernetesSync) do(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, k.apiURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+k.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		err := errors.New("Kubernetes API returned status " + strconv.Itoa(resp.StatusCode))
+		if resp.StatusCode == http.StatusConflict || resp.StatusCode == http.StatusNotFound {
+			return resp, err
+		}
+		resp.Body.Close()
+		return nil, err
+	}
+
+	return resp, nil
+}
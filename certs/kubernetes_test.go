@@ -0,0 +1,168 @@
+package certs
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKubernetesSync(t *testing.T) {
+	m := newManager()
+
+	genSecret := func(name, cn string) kubernetesSecret {
+		certPem, keyPem := genCertificate(&x509.Certificate{Subject: pkix.Name{CommonName: cn}})
+		return kubernetesSecret{
+			Metadata: kubernetesMeta{Name: name},
+			Type:     kubernetesTLSSecret,
+			Data:     map[string][]byte{"tls.crt": certPem, "tls.key": keyPem},
+		}
+	}
+
+	existing := genSecret("existing", "existing")
+	renewed := genSecret("existing", "renewed")
+	added := genSecret("added", "added")
+
+	var mu sync.Mutex
+	written := map[string]kubernetesSecret{}
+
+	events := make(chan kubernetesWatchEvent)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/api/v1/namespaces/gateway/secrets":
+			var secret kubernetesSecret
+			json.NewDecoder(r.Body).Decode(&secret)
+			mu.Lock()
+			written[secret.Metadata.Name] = secret
+			mu.Unlock()
+		case r.URL.Path != "/api/v1/namespaces/default/secrets":
+			w.WriteHeader(http.StatusNotFound)
+		case r.URL.Query().Get("watch") == "":
+			json.NewEncoder(w).Encode(kubernetesSecretList{
+				Metadata: kubernetesMeta{ResourceVersion: "1"},
+				Items:    []kubernetesSecret{existing},
+			})
+		default:
+			w.(http.Flusher).Flush()
+			for {
+				select {
+				case event := <-events:
+					json.NewEncoder(w).Encode(event)
+					w.(http.Flusher).Flush()
+				case <-r.Context().Done():
+					return
+				}
+			}
+		}
+	}))
+	defer api.Close()
+
+	k8sSync := newKubernetesSync(m, api.Client(), api.URL, "token", []string{"default"}, "gateway")
+	k8sSync.Start()
+	defer k8sSync.Stop()
+
+	waitFor := func(what string, check func() bool) {
+		for i := 0; i < 100; i++ {
+			if check() {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatal(what)
+	}
+
+	subject := func(certID string) string {
+		certs := m.List([]string{certID}, CertificatePrivate)
+		if len(certs) != 1 || certs[0] == nil {
+			return ""
+		}
+		return leafSubjectName(certs[0])
+	}
+
+	var existingID string
+	waitFor("Existing secret should be synced", func() bool {
+		ids := m.ListAllIds("")
+		if len(ids) == 1 {
+			existingID = ids[0]
+		}
+		return existingID != ""
+	})
+
+	if tags := m.Tags(existingID); tags[kubernetesSecretTag] != "default/existing" {
+		t.Error("Certificate should be tagged with the secret", tags)
+	}
+
+	events <- kubernetesWatchEvent{Type: "MODIFIED", Object: renewed}
+	waitFor("Renewed secret should replace the certificate", func() bool {
+		return subject(existingID) == "renewed"
+	})
+
+	events <- kubernetesWatchEvent{Type: "ADDED", Object: added}
+	events <- kubernetesWatchEvent{Type: "DELETED", Object: existing}
+	waitFor("Secrets should be synced", func() bool {
+		ids := m.ListAllIds("")
+		return len(ids) == 1 && subject(ids[0]) == "added"
+	})
+
+	certPem, keyPem := genCertificateFromCommonName("gateway")
+	gatewayID, _ := m.Add(append(certPem, keyPem...), "")
+
+	waitFor("Gateway certificate should be written back", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return written["tyk-"+gatewayID].Metadata.Labels[kubernetesCertLabel] == gatewayID
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(written) != 1 {
+		t.Error("Only certificates added to the gateway should be written back", len(written))
+	}
+
+	secret := written["tyk-"+gatewayID]
+	if _, err := ParsePEMCertificate(append(secret.Data["tls.crt"], secret.Data["tls.key"]...), ""); err != nil {
+		t.Error("Written secret should contain the certificate and private key", err)
+	}
+}
+
+func TestKubernetesSource(t *testing.T) {
+	certPem, keyPem := genCertificateFromCommonName("secret")
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/namespaces/other/secrets/web-tls":
+			json.NewEncoder(w).Encode(kubernetesSecret{
+				Type: kubernetesTLSSecret,
+				Data: map[string][]byte{"tls.crt": certPem, "tls.key": keyPem},
+			})
+		case "/api/v1/namespaces/other/secrets/opaque":
+			json.NewEncoder(w).Encode(kubernetesSecret{Type: "Opaque"})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer api.Close()
+
+	m := newManager()
+	m.AddSource(newKubernetesSync(m, api.Client(), api.URL, "token", nil, ""))
+
+	certs := m.List([]string{"k8s://other/web-tls", "k8s://other/opaque", "k8s://other/missing", "k8s://invalid"}, CertificatePrivate)
+	if len(certs) != 4 || certs[0] == nil || leafSubjectName(certs[0]) != "secret" {
+		t.Fatal("Certificate should be read from the secret")
+	}
+
+	for _, cert := range certs[1:] {
+		if cert != nil {
+			t.Error("Only TLS secrets should be listed")
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package certs
+
+import (
+	"container/list"
+	"crypto/tls"
+	"sync"
+	"time"
+
+	cache "github.com/pmylund/go-cache"
+)
+
+const defaultCacheExpiration = 5 * time.Minute
+
+// lruCache is a cache of parsed certificates limited by number of entries
+// and their size, evicting least recently used entries. Expirations follow
+// go-cache: cache.DefaultExpiration and cache.NoExpiration are accepted.
+type lruCache struct {
+	mu         sync.Mutex
+	items      map[string]*list.Element
+	order      *list.List
+	maxEntries int
+	maxBytes   int64
+	bytes      int64
+	evictions  int64
+
+	// onEvict is called for entries evicted because of the limits, without
+	// the cache lock held.
+	onEvict func(key string)
+}
+
+type lruEntry struct {
+	key     string
+	value   interface{}
+	size    int64
+	expires time.Time
+}
+
+func newLRUCache() *lruCache {
+	return &lruCache{
+		items: map[string]*list.Element{},
+		order: list.New(),
+	}
+}
+
+// entrySize estimates memory used by the cached value.
+func entrySize(key string, value interface{}) int64 {
+	size := int64(len(key))
+
+	switch v := value.(type) {
+	case *tls.Certificate:
+		for _, der := range v.Certificate {
+			// Parsed leaf and key take roughly as much as the encoded certificate
+			size += 2 * int64(len(der))
+		}
+	case *ocspEntry:
+		size += int64(len(v.raw))
+	case string:
+		size += int64(len(v))
+	}
+
+	return size
+}
+
+// SetLimits sets maximum number of entries and their total size in bytes,
+// evicting entries over the new limits. 0 means no limit.
+func (l *lruCache) SetLimits(maxEntries int, maxBytes int64) {
+	l.mu.Lock()
+	l.maxEntries = maxEntries
+	l.maxBytes = maxBytes
+	evicted := l.evict()
+	l.mu.Unlock()
+
+	l.evicted(evicted)
+}
+
+func (l *lruCache) Get(key string) (interface{}, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	el, found := l.items[key]
+	if !found {
+		return nil, false
+	}
+
+	entry := el.Value.(*lruEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		l.remove(el)
+		return nil, false
+	}
+
+	l.order.MoveToFront(el)
+	return entry.value, true
+}
+
+func (l *lruCache) Set(key string, value interface{}, expiration time.Duration) {
+	entry := &lruEntry{key: key, value: value, size: entrySize(key, value)}
+	switch expiration {
+	case cache.NoExpiration:
+	case cache.DefaultExpiration:
+		entry.expires = time.Now().Add(defaultCacheExpiration)
+	default:
+		entry.expires = time.Now().Add(expiration)
+	}
+
+	l.mu.Lock()
+	if el, found := l.items[key]; found {
+		l.remove(el)
+	}
+	l.items[key] = l.order.PushFront(entry)
+	l.bytes += entry.size
+
+	// Drop expired entries not used since
+	for el := l.order.Back(); el != nil && el != l.items[key]; el = l.order.Back() {
+		if expires := el.Value.(*lruEntry).expires; expires.IsZero() || time.Now().Before(expires) {
+			break
+		}
+		l.remove(el)
+	}
+
+	evicted := l.evict()
+	l.mu.Unlock()
+
+	l.evicted(evicted)
+}
+
+func (l *lruCache) Delete(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if el, found := l.items[key]; found {
+		l.remove(el)
+	}
+}
+
+func (l *lruCache) Flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.items = map[string]*list.Element{}
+	l.order.Init()
+	l.bytes = 0
+}
+
+// Size returns number of cached entries and their estimated size.
+func (l *lruCache) Size() (entries int, bytes int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.items), l.bytes
+}
+
+// Evictions returns number of entries evicted because of the limits.
+func (l *lruCache) Evictions() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.evictions
+}
+
+func (l *lruCache) remove(el *list.Element) {
+	entry := l.order.Remove(el).(*lruEntry)
+	delete(l.items, entry.key)
+	l.bytes -= entry.size
+}
+
+// evict removes least recently used entries over the limits, keeping at least
+// the most recent one.
+func (l *lruCache) evict() (evicted []string) {
+	for l.order.Len() > 1 &&
+		(l.maxEntries > 0 && l.order.Len() > l.maxEntries || l.maxBytes > 0 && l.bytes > l.maxBytes) {
+		el := l.order.Back()
+		evicted = append(evicted, el.Value.(*lruEntry).key)
+		l.remove(el)
+		l.evictions++
+	}
+
+	return evicted
+}
+
+func (l *lruCache) evicted(keys []string) {
+	if l.onEvict == nil {
+		return
+	}
+
+	for _, key := range keys {
+		l.onEvict(key)
+	}
+}
+
+// SetCacheLimits limits the number of cached certificates and their estimated
+// size in bytes. Least recently used certificates are evicted over the
+// limits. 0 means no limit.
+func (c *CertificateManager) SetCacheLimits(maxEntries int, maxBytes int64) {
+	c.cache.SetLimits(maxEntries, maxBytes)
+}
+
+// CacheSize returns the number of cached entries and their estimated size in
+// bytes.
+func (c *CertificateManager) CacheSize() (entries int, bytes int64) {
+	return c.cache.Size()
+}
@@ -0,0 +1,116 @@
+package certs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	cache "github.com/pmylund/go-cache"
+)
+
+func TestLRUCache(t *testing.T) {
+	t.Run("Max entries", func(t *testing.T) {
+		l := newLRUCache()
+		l.SetLimits(2, 0)
+
+		l.Set("a", "1", cache.NoExpiration)
+		l.Set("b", "2", cache.NoExpiration)
+		l.Get("a")
+		l.Set("c", "3", cache.NoExpiration)
+
+		if _, found := l.Get("b"); found {
+			t.Error("Least recently used entry should be evicted")
+		}
+		for _, key := range []string{"a", "c"} {
+			if _, found := l.Get(key); !found {
+				t.Error("Entry should be kept", key)
+			}
+		}
+		if l.Evictions() != 1 {
+			t.Error("Eviction should be counted", l.Evictions())
+		}
+	})
+
+	t.Run("Max bytes", func(t *testing.T) {
+		l := newLRUCache()
+		l.Set("a", strings.Repeat("x", 99), cache.NoExpiration)
+		l.Set("b", strings.Repeat("x", 99), cache.NoExpiration)
+
+		if entries, size := l.Size(); entries != 2 || size != 200 {
+			t.Error("Size should include keys and values", entries, size)
+		}
+
+		var evicted []string
+		l.onEvict = func(key string) { evicted = append(evicted, key) }
+		l.SetLimits(0, 150)
+
+		if entries, size := l.Size(); entries != 1 || size != 100 {
+			t.Error("Entries over the limit should be evicted", entries, size)
+		}
+		if len(evicted) != 1 || evicted[0] != "a" {
+			t.Error("Evicted entries should be reported", evicted)
+		}
+
+		l.Set("c", strings.Repeat("x", 999), cache.NoExpiration)
+		if _, found := l.Get("c"); !found {
+			t.Error("Entry larger than the limit should be kept until the next one")
+		}
+	})
+
+	t.Run("Expiration", func(t *testing.T) {
+		l := newLRUCache()
+		l.Set("a", "1", time.Millisecond)
+		l.Set("b", "2", cache.DefaultExpiration)
+		time.Sleep(5 * time.Millisecond)
+
+		if _, found := l.Get("a"); found {
+			t.Error("Expired entry should not be returned")
+		}
+		if _, found := l.Get("b"); !found {
+			t.Error("Entry should expire after default expiration")
+		}
+		if l.Evictions() != 0 {
+			t.Error("Expired entries should not be counted as evictions")
+		}
+	})
+}
+
+func TestCertificateCacheLimits(t *testing.T) {
+	m := newManager()
+	m.StartRefresh(time.Hour)
+	defer m.StopRefresh()
+
+	var certIDs []string
+	for _, cn := range []string{"first", "second", "third"} {
+		certPem, _ := genCertificateFromCommonName(cn)
+		certID, _ := m.Add(certPem, "")
+		certIDs = append(certIDs, certID)
+	}
+
+	m.SetCacheLimits(2, 0)
+	m.List(certIDs, CertificateAny)
+
+	if entries, _ := m.CacheSize(); entries != 2 {
+		t.Error("Cache should be limited", entries)
+	}
+	if _, tracked := m.refreshIDs[certIDs[0]]; tracked {
+		t.Error("Evicted certificate should not be refreshed")
+	}
+
+	if certs := m.List(certIDs[:1], CertificateAny); len(certs) != 1 || certs[0] == nil {
+		t.Error("Evicted certificate should be loaded again")
+	}
+
+	if metrics := m.Metrics(); metrics.CacheEvictions != 2 {
+		t.Error("Evictions should be reported", metrics)
+	}
+
+	var buf bytes.Buffer
+	m.WritePrometheus(&buf)
+	for _, line := range []string{"tyk_certificate_cache_evictions_total 2", "tyk_certificate_cache_entries 2"} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Error("Metrics should contain", line, buf.String())
+		}
+	}
+}
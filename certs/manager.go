@@ -2,9 +2,10 @@ package certs
 
 import (
 	"bytes"
+	"context"
 	"crypto"
 	"crypto/ecdsa"
-	"crypto/rand"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/tls"
@@ -13,13 +14,18 @@ import (
 	"encoding/hex"
 	"encoding/pem"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/fsnotify/fsnotify"
 	cache "github.com/pmylund/go-cache"
+	"golang.org/x/sync/singleflight"
 )
 
 // StorageHandler is a standard interface to a storage backend,
@@ -33,10 +39,60 @@ type StorageHandler interface {
 }
 
 type CertificateManager struct {
+	// changes and metrics are updated atomically, first for 64-bit alignment
+	changes int64
+	metrics Metrics
+
 	storage StorageHandler
 	logger  *logrus.Entry
-	cache   *cache.Cache
+	cache   *lruCache
 	secret  string
+
+	revocationCheckers []RevocationChecker
+
+	mu              sync.RWMutex
+	replaceHandlers []func(certID string)
+	issuer          CertificateIssuer
+	sources         []CertificateSource
+	sourceRefs      map[string]struct{}
+	usages          map[string][]CertificateUsage
+
+	// refreshIDs are certificates kept in cache and reloaded by refresh loop
+	refreshIDs  map[string]struct{}
+	refreshStop chan struct{}
+
+	keyEncryption KeyEncryption
+	auditSinks    []AuditSink
+	watchers      map[chan CertificateChange]struct{}
+	jwksImports   map[string]*JWKSImport
+
+	fetchIntermediates bool
+	keyPolicy          *KeyPolicy
+	orgKeyPolicies     map[string]*KeyPolicy
+
+	// watchedFiles maps certificate file paths to IDs loaded from them
+	watchedFiles map[string]map[string]struct{}
+	watchedDirs  map[string]struct{}
+	fileWatcher  *fsnotify.Watcher
+
+	ctPolicy *CTPolicy
+	ctLogs   map[[32]byte]crypto.PublicKey
+
+	// negativeTTL is how long missing stored certificates are cached
+	negativeTTL time.Duration
+
+	// loads share certificate loads between concurrent cache misses
+	loads singleflight.Group
+
+	// deleteRetention enables soft delete
+	deleteRetention time.Duration
+	purgeStop       chan struct{}
+}
+
+// CertificateIssuer issues new certificates, returning PEM encoded certificate
+// chain with the private key.
+type CertificateIssuer interface {
+	Issue(commonName string) ([]byte, error)
 }
 
 func NewCertificateManager(storage StorageHandler, secret string, logger *logrus.Logger) *CertificateManager {
@@ -44,12 +100,51 @@ func NewCertificateManager(storage StorageHandler, secret string, logger *logrus
 		logger = logrus.New()
 	}
 
-	return &CertificateManager{
+	c := &CertificateManager{
 		storage: storage,
 		logger:  logger.WithFields(logrus.Fields{"prefix": "cert_storage"}),
-		cache:   cache.New(5*time.Minute, 10*time.Minute),
+		cache:   newLRUCache(),
 		secret:  secret,
+
+		negativeTTL: defaultNegativeCacheTTL,
 	}
+	// Evicted certificates are loaded on next use instead of being refreshed
+	c.cache.onEvict = c.untrackRefresh
+
+	return c
+}
+
+// AddRevocationChecker makes ValidateRequestCertificate reject client
+// certificates reported as revoked by the checker.
+func (c *CertificateManager) AddRevocationChecker(checker RevocationChecker) {
+	c.revocationCheckers = append(c.revocationCheckers, checker)
+}
+
+func (c *CertificateManager) checkRevocation(cert, issuer *x509.Certificate) error {
+	for _, checker := range c.revocationCheckers {
+		revoked, err := checker.IsRevoked(cert, issuer)
+		if err != nil {
+			c.logger.Warning("Can't check certificate revocation status: ", err)
+			continue
+		}
+
+		if revoked {
+			return errors.New("Certificate with SHA256 " + HexSHA256(cert.Raw) + " is revoked")
+		}
+	}
+
+	return nil
+}
+
+// findIssuer returns the candidate which signed the certificate.
+func findIssuer(cert *x509.Certificate, candidates []*x509.Certificate) *x509.Certificate {
+	for _, candidate := range candidates {
+		if bytes.Equal(candidate.RawSubject, cert.RawIssuer) && cert.CheckSignatureFrom(candidate) == nil {
+			return candidate
+		}
+	}
+
+	return nil
 }
 
 // Extracted from: https://golang.org/src/crypto/tls/tls.go
@@ -57,16 +152,17 @@ func NewCertificateManager(storage StorageHandler, secret string, logger *logrus
 // Attempt to parse the given private key DER block. OpenSSL 0.9.8 generates
 // PKCS#1 private keys by default, while OpenSSL 1.0.0 generates PKCS#8 keys.
 // OpenSSL ecparam generates SEC1 EC private keys for ECDSA. We try all three.
+// Ed25519 keys are only supported in PKCS#8 wrapping.
 func parsePrivateKey(der []byte) (crypto.PrivateKey, error) {
 	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
 		return key, nil
 	}
 	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
 		switch key := key.(type) {
-		case *rsa.PrivateKey, *ecdsa.PrivateKey:
+		case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
 			return key, nil
 		default:
-			return nil, errors.New("tls: found unknown private key type in PKCS#8 wrapping")
+			return nil, fmt.Errorf("%w in PKCS#8 wrapping: %T", ErrUnsupportedKeyType, key)
 		}
 	}
 
@@ -92,6 +188,12 @@ func HexSHA256(cert []byte) string {
 }
 
 func ParsePEM(data []byte, secret string) ([]*pem.Block, error) {
+	return parsePEM(data, secret, "")
+}
+
+// parsePEM decrypts PKCS#8 encrypted private keys with the passphrase, if
+// set, and other encrypted blocks with the secret.
+func parsePEM(data []byte, secret, passphrase string) ([]*pem.Block, error) {
 	var pemBlocks []*pem.Block
 
 	for {
@@ -102,13 +204,13 @@ func ParsePEM(data []byte, secret string) ([]*pem.Block, error) {
 			break
 		}
 
-		if x509.IsEncryptedPEMBlock(block) {
-			var err error
-			block.Bytes, err = x509.DecryptPEMBlock(block, []byte(secret))
-			block.Headers = nil
-			block.Type = strings.Replace(block.Type, "ENCRYPTED ", "", 1)
+		if isEncryptedPEMBlock(block) {
+			blockSecret := secret
+			if passphrase != "" && isPKCS8EncryptedBlock(block) {
+				blockSecret = passphrase
+			}
 
-			if err != nil {
+			if err := decryptPEMBlock(block, blockSecret); err != nil {
 				return nil, err
 			}
 		}
@@ -125,22 +227,33 @@ func publicKey(priv interface{}) interface{} {
 		return &k.PublicKey
 	case *ecdsa.PrivateKey:
 		return &k.PublicKey
+	case ed25519.PrivateKey:
+		return k.Public()
 	default:
 		return nil
 	}
 }
 
 func ParsePEMCertificate(data []byte, secret string) (*tls.Certificate, error) {
+	return parsePEMCertificate(data, secret, "")
+}
+
+func parsePEMCertificate(data []byte, secret, passphrase string) (*tls.Certificate, error) {
 	var cert tls.Certificate
 
-	blocks, err := ParsePEM(data, secret)
+	blocks, err := parsePEM(data, secret, passphrase)
 	if err != nil {
 		return nil, err
 	}
 
-	var certID string
+	var certID, keyURI string
 
 	for _, block := range blocks {
+		if block.Type == keyURIBlock {
+			keyURI = string(block.Bytes)
+			continue
+		}
+
 		if block.Type == "CERTIFICATE" {
 			certID = HexSHA256(block.Bytes)
 			cert.Certificate = append(cert.Certificate, block.Bytes)
@@ -174,6 +287,12 @@ func ParsePEMCertificate(data []byte, secret string) (*tls.Certificate, error) {
 		}
 	}
 
+	if keyURI != "" {
+		if cert.PrivateKey, err = loadExternalKey(keyURI, cert.Leaf.PublicKey); err != nil {
+			return nil, err
+		}
+	}
+
 	// Cache certificate fingerprint
 	cert.Leaf.Extensions = append([]pkix.Extension{{
 		Value: []byte(certID),
@@ -223,6 +342,8 @@ type CertificateMeta struct {
 	NotBefore     time.Time `json:"not_before,omitempty"`
 	NotAfter      time.Time `json:"not_after,omitempty"`
 	DNSNames      []string  `json:"dns_names,omitempty"`
+
+	Tags map[string]string `json:"tags,omitempty"`
 }
 
 func ExtractCertificateMeta(cert *tls.Certificate, certID string) *CertificateMeta {
@@ -239,52 +360,138 @@ func ExtractCertificateMeta(cert *tls.Certificate, certID string) *CertificateMe
 }
 
 func (c *CertificateManager) List(certIDs []string, mode CertificateType) (out []*tls.Certificate) {
-	var cert *tls.Certificate
-	var rawCert []byte
-	var err error
+	out, _ = c.list(context.Background(), certIDs, mode, true)
+	return out
+}
 
+// list is ListContext optionally not counted in cache metrics, for internal
+// scans.
+func (c *CertificateManager) list(ctx context.Context, certIDs []string, mode CertificateType, counted bool) (out []*tls.Certificate, err error) {
 	for _, id := range certIDs {
 		if cert, found := c.cache.Get(id); found {
+			if counted {
+				atomic.AddInt64(&c.metrics.CacheHits, 1)
+			}
 			if isCertCanBeListed(cert.(*tls.Certificate), mode) {
 				out = append(out, cert.(*tls.Certificate))
 			}
 			continue
 		}
 
-		if isSHA256(id) {
-			var val string
-			val, err = c.storage.GetKey("raw-" + id)
-			if err != nil {
-				c.logger.Warn("Can't retrieve certificate from Redis:", id, err)
-				out = append(out, nil)
-				continue
-			}
-			rawCert = []byte(val)
-		} else {
-			rawCert, err = ioutil.ReadFile(id)
-			if err != nil {
-				c.logger.Error("Error while reading certificate from file:", id, err)
-				out = append(out, nil)
-				continue
+		if c.isMissing(id) {
+			if counted {
+				atomic.AddInt64(&c.metrics.CacheHits, 1)
 			}
+			out = append(out, nil)
+			continue
 		}
 
-		cert, err = ParsePEMCertificate(rawCert, c.secret)
+		if counted {
+			atomic.AddInt64(&c.metrics.CacheMisses, 1)
+		}
+		cert, err := c.loadShared(ctx, id)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
 		if err != nil {
-			c.logger.Error("Error while parsing certificate: ", id, " ", err)
-			c.logger.Debug("Failed certificate: ", string(rawCert))
 			out = append(out, nil)
 			continue
 		}
 
-		c.cache.Set(id, cert, cache.DefaultExpiration)
-
 		if isCertCanBeListed(cert, mode) {
 			out = append(out, cert)
 		}
 	}
 
-	return out
+	return out, nil
+}
+
+// loadShared loads the certificate into cache, sharing the load between
+// concurrent callers. The load is not cancelled when callers give up, so its
+// result is cached for the next ones.
+func (c *CertificateManager) loadShared(ctx context.Context, id string) (*tls.Certificate, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	result := c.loads.DoChan(id, func() (interface{}, error) {
+		cert, err := c.load(detachedContext{ctx}, id)
+		if err != nil {
+			return nil, err
+		}
+
+		c.cache.Set(id, cert, c.cacheExpiration())
+		c.trackRefresh(id)
+
+		return cert, nil
+	})
+
+	select {
+	case res := <-result:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*tls.Certificate), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// load reads and parses certificate from storage, certificate source or file.
+func (c *CertificateManager) load(ctx context.Context, id string) (*tls.Certificate, error) {
+	var rawCert []byte
+	var passphrase string
+	var err error
+
+	if isSHA256(id) {
+		var val string
+		val, err = c.getKey(ctx, "raw-"+id)
+		if err != nil {
+			c.logger.Warn("Can't retrieve certificate from Redis:", id, err)
+			atomic.AddInt64(&c.metrics.StorageErrors, 1)
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			// Only misses confirmed by storage are cached, failures are
+			// retried on next use
+			if c.confirmsMissing(err) {
+				c.cacheMissing(id)
+			}
+			return nil, &CertificateError{CertID: id, Err: ErrCertNotFound}
+		}
+		rawCert = c.migrateKeys(id, []byte(val))
+
+		if passphrase, err = c.keyPassphrase(ctx, id); err != nil {
+			c.logger.Error("Can't retrieve private key passphrase of ", id, ": ", err)
+			return nil, err
+		}
+	} else if sources := c.sourcesFor(id); len(sources) > 0 {
+		rawCert, err = c.fetchFromSources(ctx, id, sources)
+		if err != nil {
+			c.logger.Error("Error while fetching certificate from source:", id, err)
+			atomic.AddInt64(&c.metrics.StorageErrors, 1)
+			return nil, err
+		}
+		c.trackSourceRef(id)
+	} else {
+		rawCert, err = readFile(ctx, strings.TrimPrefix(id, fileScheme))
+		if err != nil {
+			c.logger.Error("Error while reading certificate from file:", id, err)
+			atomic.AddInt64(&c.metrics.StorageErrors, 1)
+			return nil, err
+		}
+		c.trackFile(id)
+	}
+
+	cert, err := parsePEMCertificate(rawCert, c.secret, passphrase)
+	if err != nil {
+		c.logger.Error("Error while parsing certificate: ", id, " ", err)
+		c.logger.Debug("Failed certificate: ", string(rawCert))
+		atomic.AddInt64(&c.metrics.ParseFailures, 1)
+		return nil, err
+	}
+
+	return cert, nil
 }
 
 // Returns list of fingerprints
@@ -298,22 +505,31 @@ func (c *CertificateManager) ListPublicKeys(keyIDs []string) (out []string) {
 			continue
 		}
 
+		if c.isMissing(id) {
+			out = append(out, "")
+			continue
+		}
+
 		if isSHA256(id) {
 			var val string
 			val, err = c.storage.GetKey("raw-" + id)
 			if err != nil {
 				c.logger.Warn("Can't retrieve public key from Redis:", id, err)
+				if c.confirmsMissing(err) {
+					c.cacheMissing(id)
+				}
 				out = append(out, "")
 				continue
 			}
 			rawKey = []byte(val)
 		} else {
-			rawKey, err = ioutil.ReadFile(id)
+			rawKey, err = ioutil.ReadFile(strings.TrimPrefix(id, fileScheme))
 			if err != nil {
 				c.logger.Error("Error while reading public key from file:", id, err)
 				out = append(out, "")
 				continue
 			}
+			c.trackFile(id)
 		}
 
 		block, _ := pem.Decode(rawKey)
@@ -342,10 +558,12 @@ func (c *CertificateManager) ListAllIds(prefix string) (out []string) {
 }
 
 func (c *CertificateManager) GetRaw(certID string) (string, error) {
-	return c.storage.GetKey("raw-" + certID)
+	return c.AuditedBy("").GetRaw(certID)
 }
 
-func (c *CertificateManager) Add(certData []byte, orgID string) (string, error) {
+// encode validates certificate data, encrypts private key, and returns
+// certificate ID with the PEM data to store.
+func (c *CertificateManager) encode(certData []byte, orgID string) (string, []byte, error) {
 	var certBlocks [][]byte
 	var keyPEM, keyRaw []byte
 	var publicKeyPem []byte
@@ -364,7 +582,7 @@ func (c *CertificateManager) Add(certData []byte, orgID string) (string, error)
 			if len(keyRaw) > 0 {
 				err := errors.New("Found multiple private keys")
 				c.logger.Error(err)
-				return "", err
+				return "", nil, err
 			}
 
 			keyRaw = block.Bytes
@@ -378,20 +596,47 @@ func (c *CertificateManager) Add(certData []byte, orgID string) (string, error)
 		}
 	}
 
+	var keyPublic crypto.PublicKey
+	if len(keyRaw) > 0 {
+		if priv, err := parsePrivateKey(keyRaw); err == nil {
+			keyPublic = publicKey(priv)
+		}
+	}
+
+	certBlocks, err := c.normalizeChain(certBlocks, keyPublic)
+	if err != nil {
+		c.logger.Error(err)
+		return "", nil, err
+	}
+
+	var publicKeyDER []byte
+	if block, _ := pem.Decode(publicKeyPem); block != nil {
+		publicKeyDER = block.Bytes
+	}
+
+	if err := c.checkKeyPolicy(orgID, certBlocks, publicKeyDER); err != nil {
+		c.logger.Error(err)
+		return "", nil, err
+	}
+
 	certChainPEM := bytes.Join(certBlocks, []byte("\n"))
 
+	if err := c.checkCT(decodeChain(certBlocks)); err != nil {
+		return "", nil, err
+	}
+
 	if len(certChainPEM) == 0 {
 		if len(publicKeyPem) == 0 {
 			err := errors.New("Failed to decode certificate. It should be PEM encoded.")
 			c.logger.Error(err)
-			return "", err
+			return "", nil, err
 		} else {
 			certChainPEM = publicKeyPem
 		}
 	} else if len(publicKeyPem) > 0 {
 		err := errors.New("Public keys can't be combined with certificates")
 		c.logger.Error(err)
-		return "", err
+		return "", nil, err
 	}
 
 	var certID string
@@ -401,14 +646,14 @@ func (c *CertificateManager) Add(certData []byte, orgID string) (string, error)
 		cert, err := tls.X509KeyPair(certChainPEM, keyPEM)
 		if err != nil {
 			c.logger.Error(err)
-			return "", err
+			return "", nil, err
 		}
 
 		// Encrypt private key and append it to the chain
-		encryptedKeyPEMBlock, err := x509.EncryptPEMBlock(rand.Reader, "ENCRYPTED PRIVATE KEY", keyRaw, []byte(c.secret), x509.PEMCipherAES256)
+		encryptedKeyPEMBlock, err := c.encryptPEMBlock("PRIVATE KEY", keyRaw)
 		if err != nil {
 			c.logger.Error("Failed to encode private key", err)
-			return "", err
+			return "", nil, err
 		}
 
 		certChainPEM = append(certChainPEM, []byte("\n")...)
@@ -425,27 +670,143 @@ func (c *CertificateManager) Add(certData []byte, orgID string) (string, error)
 		if err != nil {
 			err := errors.New("Error while parsing certificate: " + err.Error())
 			c.logger.Error(err)
-			return "", err
+			return "", nil, err
 		}
 
 		certID = orgID + HexSHA256(cert.Raw)
 	}
 
-	if cert, err := c.storage.GetKey("raw-" + certID); err == nil && cert != "" {
-		return "", errors.New("Certificate with " + certID + " id already exists")
+	return certID, certChainPEM, nil
+}
+
+func (c *CertificateManager) Add(certData []byte, orgID string) (string, error) {
+	return c.AuditedBy("").Add(certData, orgID)
+}
+
+func (c *CertificateManager) store(ctx context.Context, certID string, certChainPEM []byte) (string, error) {
+	if cert, err := c.getKey(ctx, "raw-"+certID); err == nil && cert != "" {
+		return "", &CertificateError{CertID: certID, Err: ErrCertExists}
+	} else if ctxErr := ctx.Err(); ctxErr != nil {
+		return "", ctxErr
 	}
 
-	if err := c.storage.SetKey("raw-"+certID, string(certChainPEM), 0); err != nil {
+	if err := c.setKey(ctx, "raw-"+certID, string(certChainPEM), 0); err != nil {
 		c.logger.Error(err)
 		return "", err
 	}
+	c.cache.Delete(missingCachePrefix + certID)
+	c.changed(ChangeAdded, certID)
 
 	return certID, nil
 }
 
+// Replace stores new certificate data under the existing certificate ID, so
+// APIs and configs referencing the ID start using the new certificate without
+// being changed. Replace handlers are called once the new certificate is stored.
+func (c *CertificateManager) Replace(certID string, certData []byte) error {
+	if raw, err := c.storage.GetKey("raw-" + certID); err != nil || raw == "" {
+		err := &CertificateError{CertID: certID, Err: ErrCertNotFound}
+		c.logger.Error(err)
+		return err
+	}
+
+	// Organisation of the certificate is used for its key policy
+	var orgID string
+	if len(certID) > sha256HexLength {
+		orgID = certID[:len(certID)-sha256HexLength]
+	}
+
+	_, certChainPEM, err := c.encode(certData, orgID)
+	if err != nil {
+		return err
+	}
+
+	cert, err := ParsePEMCertificate(certChainPEM, c.secret)
+	if err != nil {
+		c.logger.Error("Error while parsing certificate: ", err)
+		return err
+	}
+
+	if err := c.storage.SetKey("raw-"+certID, string(certChainPEM), 0); err != nil {
+		c.logger.Error(err)
+		return err
+	}
+
+	c.cache.Set(certID, cert, c.cacheExpiration())
+	c.cache.Delete("pub-" + certID)
+	c.changed(ChangeUpdated, certID)
+
+	c.mu.RLock()
+	handlers := c.replaceHandlers
+	c.mu.RUnlock()
+
+	for _, h := range handlers {
+		h(certID)
+	}
+
+	return nil
+}
+
+// OnReplace registers a callback fired after a certificate is replaced.
+func (c *CertificateManager) OnReplace(h func(certID string)) {
+	c.mu.Lock()
+	c.replaceHandlers = append(c.replaceHandlers, h)
+	c.mu.Unlock()
+}
+
+// SetIssuer sets the issuer used to request new certificates with Issue.
+func (c *CertificateManager) SetIssuer(issuer CertificateIssuer) {
+	c.mu.Lock()
+	c.issuer = issuer
+	c.mu.Unlock()
+}
+
+// Issue requests a new certificate for the common name from the issuer, and
+// stores it the same way as Add does.
+func (c *CertificateManager) Issue(commonName, orgID string) (string, error) {
+	c.mu.RLock()
+	issuer := c.issuer
+	c.mu.RUnlock()
+
+	if issuer == nil {
+		return "", errors.New("Certificate issuer is not configured")
+	}
+
+	certData, err := issuer.Issue(commonName)
+	if err != nil {
+		err = errors.New("Failed to issue certificate: " + err.Error())
+		c.logger.Error(err)
+		return "", err
+	}
+
+	return c.Add(certData, orgID)
+}
+
 func (c *CertificateManager) Delete(certID string) {
-	c.storage.DeleteKey("raw-" + certID)
+	c.AuditedBy("").Delete(certID)
+}
+
+func (c *CertificateManager) delete(ctx context.Context, certID string) error {
+	if usages := c.Usages(certID); len(usages) > 0 {
+		c.logger.Warning("Removing certificate ", certID, " which is still in use: ", usages)
+	}
+
+	if c.getDeleteRetention() > 0 {
+		if err := c.softDelete(ctx, certID); err != nil {
+			return err
+		}
+	}
+
+	for _, prefix := range certificateKeys {
+		if err := c.deleteKey(ctx, prefix+certID); err != nil {
+			return err
+		}
+	}
 	c.cache.Delete(certID)
+	c.untrackRefresh(certID)
+	c.changed(ChangeDeleted, certID)
+
+	return nil
 }
 
 func (c *CertificateManager) CertPool(certIDs []string) *x509.CertPool {
@@ -460,7 +821,51 @@ func (c *CertificateManager) CertPool(certIDs []string) *x509.CertPool {
 	return pool
 }
 
+// ValidationOptions changes how ValidateRequestCertificateWithOptions checks
+// client certificates. The zero value only accepts pinned leaf certificates.
+type ValidationOptions struct {
+	// VerifyChain accepts certificates signed by one of the allowed
+	// certificates, by building the chain and verifying it with x509.Verify.
+	VerifyChain bool
+	// Intermediates are IDs of stored intermediate certificates used to build the chain.
+	Intermediates []string
+	// UsePeerIntermediates uses intermediates sent by the client to build the chain.
+	UsePeerIntermediates bool
+	// CheckExpiry rejects pinned certificates outside of their validity period.
+	// Chain verification always checks it.
+	CheckExpiry bool
+	// KeyUsages accepted by chain verification. Defaults to client authentication.
+	KeyUsages []x509.ExtKeyUsage
+	// SubjectRules further restrict allowed certificates to ones matching any
+	// of the rules. Combined with VerifyChain, they allow all certificates
+	// issued by a CA for the matching subjects.
+	SubjectRules []SubjectRule
+	// SPIFFEIDs allow SPIFFE SVIDs issued by SPIFFEBundle with matching IDs,
+	// in addition to the allowed certificates. Trust domains, like
+	// "spiffe://example.org", allow all workloads of the domain.
+	SPIFFEIDs    []string
+	SPIFFEBundle []*x509.Certificate
+}
+
 func (c *CertificateManager) ValidateRequestCertificate(certIDs []string, r *http.Request) error {
+	return c.ValidateRequestCertificateWithOptions(certIDs, r, ValidationOptions{})
+}
+
+func (c *CertificateManager) ValidateRequestCertificateWithOptions(certIDs []string, r *http.Request, opts ValidationOptions) error {
+	err := c.validateRequestCertificate(certIDs, r, opts)
+	if err != nil {
+		var certID string
+		if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+			certID = HexSHA256(r.TLS.PeerCertificates[0].Raw)
+		}
+		c.audit(AuditValidationFailed, certID, r.RemoteAddr, err)
+		atomic.AddInt64(&c.metrics.ValidationRejects, 1)
+	}
+
+	return err
+}
+
+func (c *CertificateManager) validateRequestCertificate(certIDs []string, r *http.Request, opts ValidationOptions) error {
 	if r.TLS == nil {
 		return errors.New("TLS not enabled")
 	}
@@ -472,20 +877,103 @@ func (c *CertificateManager) ValidateRequestCertificate(certIDs []string, r *htt
 	leaf := r.TLS.PeerCertificates[0]
 
 	certID := HexSHA256(leaf.Raw)
-	for _, cert := range c.List(certIDs, CertificatePublic) {
+
+	if opts.CheckExpiry {
+		if now := time.Now(); now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+			return errors.New("Certificate with SHA256 " + certID + " is expired or not yet valid")
+		}
+	}
+
+	allowed := c.List(certIDs, CertificatePublic)
+
+	if len(c.revocationCheckers) > 0 {
+		candidates := r.TLS.PeerCertificates[1:]
+		for _, cert := range append(allowed, c.List(opts.Intermediates, CertificatePublic)...) {
+			if cert != nil {
+				candidates = append(candidates, cert.Leaf)
+			}
+		}
+
+		if err := c.checkRevocation(leaf, findIssuer(leaf, candidates)); err != nil {
+			return err
+		}
+	}
+
+	if !matchSubjectRules(leaf, opts.SubjectRules) {
+		return errors.New("Certificate with SHA256 " + certID + " does not match subject rules")
+	}
+
+	if len(opts.SPIFFEIDs) > 0 {
+		err := verifySPIFFE(leaf, r.TLS.PeerCertificates[1:], opts)
+		if err == nil {
+			return nil
+		}
+		c.logger.Debug("Client certificate is not allowed SVID: ", err)
+	}
+
+	for _, cert := range allowed {
 		// Extensions[0] contains cache of certificate SHA256
 		if cert == nil || string(cert.Leaf.Extensions[0].Value) == certID {
 			return nil
 		}
 	}
 
+	if opts.VerifyChain {
+		if err := c.verifyChain(leaf, allowed, r.TLS.PeerCertificates[1:], opts); err != nil {
+			return errors.New("Certificate with SHA256 " + certID + " not allowed: " + err.Error())
+		}
+
+		return nil
+	}
+
 	return errors.New("Certificate with SHA256 " + certID + " not allowed")
 }
 
+func (c *CertificateManager) verifyChain(leaf *x509.Certificate, roots []*tls.Certificate, peerIntermediates []*x509.Certificate, opts ValidationOptions) error {
+	verifyOpts := x509.VerifyOptions{
+		Roots:         x509.NewCertPool(),
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     opts.KeyUsages,
+	}
+
+	if len(verifyOpts.KeyUsages) == 0 {
+		verifyOpts.KeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
+
+	for _, cert := range roots {
+		verifyOpts.Roots.AddCert(cert.Leaf)
+	}
+
+	for _, cert := range c.List(opts.Intermediates, CertificatePublic) {
+		if cert != nil {
+			verifyOpts.Intermediates.AddCert(cert.Leaf)
+		}
+	}
+
+	if opts.UsePeerIntermediates {
+		for _, cert := range peerIntermediates {
+			verifyOpts.Intermediates.AddCert(cert)
+		}
+	}
+
+	_, err := leaf.Verify(verifyOpts)
+	return err
+}
+
 func (c *CertificateManager) FlushCache() {
 	c.cache.Flush()
 }
 
+// Invalidate drops cached copies of the certificate, so it is loaded from
+// storage on next use. Used when the certificate is changed by another node.
+func (c *CertificateManager) Invalidate(certID string) {
+	c.cache.Delete(certID)
+	c.cache.Delete("pub-" + certID)
+	c.cache.Delete(missingCachePrefix + certID)
+	c.untrackRefresh(certID)
+	c.changed(ChangeUpdated, certID)
+}
+
 func (c *CertificateManager) flushStorage() {
 	c.storage.DeleteScanMatch("*")
 }
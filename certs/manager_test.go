@@ -2,6 +2,7 @@ package certs
 
 import (
 	"bytes"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/tls"
@@ -11,14 +12,18 @@ import (
 	"errors"
 	"io/ioutil"
 	"math/big"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
 type dummyStorage struct {
+	mu   sync.RWMutex
 	data map[string]string
 }
 
@@ -29,19 +34,34 @@ func newDummyStorage() *dummyStorage {
 }
 
 func (s *dummyStorage) GetKey(key string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	if value, ok := s.data[key]; ok {
 		return value, nil
 	}
 
-	return "", errors.New("Not found")
+	return "", errDummyNotFound
+}
+
+var errDummyNotFound = errors.New("Not found")
+
+func (s *dummyStorage) IsKeyNotFound(err error) bool {
+	return err == errDummyNotFound
 }
 
 func (s *dummyStorage) SetKey(key, value string, exp int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	s.data[key] = value
 	return nil
 }
 
 func (s *dummyStorage) DeleteKey(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if _, ok := s.data[key]; !ok {
 		return false
 	}
@@ -51,6 +71,9 @@ func (s *dummyStorage) DeleteKey(key string) bool {
 }
 
 func (s *dummyStorage) DeleteScanMatch(pattern string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if pattern == "*" {
 		s.data = make(map[string]string)
 		return true
@@ -60,12 +83,18 @@ func (s *dummyStorage) DeleteScanMatch(pattern string) bool {
 }
 
 func (s *dummyStorage) GetKeys(pattern string) (keys []string) {
-	if pattern != "*" {
+	if !strings.HasSuffix(pattern, "*") {
 		return nil
 	}
 
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	prefix := strings.TrimSuffix(pattern, "*")
 	for k := range s.data {
-		keys = append(keys, k)
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
 	}
 
 	return keys
@@ -236,3 +265,168 @@ func TestCertificateStorage(t *testing.T) {
 		}
 	})
 }
+
+func TestReplaceCertificate(t *testing.T) {
+	m := newManager()
+
+	oldPem, _ := genCertificateFromCommonName("old")
+	certID, _ := m.Add(oldPem, "")
+
+	// Populate cache
+	m.List([]string{certID}, CertificateAny)
+
+	var replaced []string
+	m.OnReplace(func(id string) {
+		replaced = append(replaced, id)
+	})
+
+	newCertPem, newKeyPem := genCertificateFromCommonName("new")
+	if err := m.Replace(certID, append(newCertPem, newKeyPem...)); err != nil {
+		t.Fatal("Should replace certificate", err)
+	}
+
+	certs := m.List([]string{certID}, CertificatePrivate)
+	if len(certs) != 1 || leafSubjectName(certs[0]) != "new" {
+		t.Error("Certificate ID should point to the new certificate")
+	}
+
+	m.cache.Flush()
+	certs = m.List([]string{certID}, CertificatePrivate)
+	if len(certs) != 1 || leafSubjectName(certs[0]) != "new" {
+		t.Error("New certificate should be stored under the old ID")
+	}
+
+	if len(replaced) != 1 || replaced[0] != certID {
+		t.Error("Replace handler should be called", replaced)
+	}
+
+	if err := m.Replace("unknown", newCertPem); err == nil {
+		t.Error("Should not replace unknown certificate")
+	}
+
+	if err := m.Replace(certID, []byte("invalid")); err == nil {
+		t.Error("Should not replace with invalid certificate")
+	}
+}
+
+func TestAddEd25519Certificate(t *testing.T) {
+	m := newManager()
+
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ed25519"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certDer, _ := x509.CreateCertificate(rand.Reader, tmpl, tmpl, pub, priv)
+	keyDer, _ := x509.MarshalPKCS8PrivateKey(priv)
+
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDer})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer})
+
+	certID, err := m.Add(append(certPem, keyPem...), "")
+	if err != nil {
+		t.Fatal("Should add Ed25519 certificate", err)
+	}
+
+	certs := m.List([]string{certID}, CertificatePrivate)
+	if len(certs) != 1 || certs[0] == nil {
+		t.Fatal("Should list Ed25519 certificate with private key")
+	}
+
+	key, ok := certs[0].PrivateKey.(ed25519.PrivateKey)
+	if !ok {
+		t.Fatalf("Wrong private key type %T", certs[0].PrivateKey)
+	}
+
+	if !bytes.Equal(publicKey(key).(ed25519.PublicKey), pub) {
+		t.Error("Public key should match certificate")
+	}
+}
+
+func genSignedCertificate(tmpl, parent *x509.Certificate, parentKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey) {
+	priv, _ := rsa.GenerateKey(rand.Reader, 1024)
+
+	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
+	tmpl.SerialNumber, _ = rand.Int(rand.Reader, serialNumberLimit)
+	tmpl.BasicConstraintsValid = true
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+
+	if parent == nil {
+		parent, parentKey = tmpl, priv
+	}
+
+	derBytes, _ := x509.CreateCertificate(rand.Reader, tmpl, parent, &priv.PublicKey, parentKey)
+	cert, _ := x509.ParseCertificate(derBytes)
+
+	return cert, priv
+}
+
+func TestValidateRequestCertificateChain(t *testing.T) {
+	m := newManager()
+
+	ca, caKey := genSignedCertificate(&x509.Certificate{
+		Subject:  pkix.Name{CommonName: "ca"},
+		IsCA:     true,
+		KeyUsage: x509.KeyUsageCertSign,
+	}, nil, nil)
+	intermediate, intermediateKey := genSignedCertificate(&x509.Certificate{
+		Subject:  pkix.Name{CommonName: "intermediate"},
+		IsCA:     true,
+		KeyUsage: x509.KeyUsageCertSign,
+	}, ca, caKey)
+	client, _ := genSignedCertificate(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "client", OrganizationalUnit: []string{"payments"}},
+		DNSNames:    []string{"client.payments.example.com"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, intermediate, intermediateKey)
+	serverOnly, _ := genSignedCertificate(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "server"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+
+	caID, _ := m.Add(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}), "")
+	intermediateID, _ := m.Add(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: intermediate.Raw}), "")
+
+	request := func(peerCerts ...*x509.Certificate) *http.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.TLS = &tls.ConnectionState{PeerCertificates: peerCerts}
+		return r
+	}
+
+	tests := []struct {
+		name  string
+		r     *http.Request
+		opts  ValidationOptions
+		valid bool
+	}{
+		{"Pinning only", request(client, intermediate), ValidationOptions{}, false},
+		{"Chain without intermediates", request(client), ValidationOptions{VerifyChain: true}, false},
+		{"Peer intermediates not allowed", request(client, intermediate), ValidationOptions{VerifyChain: true}, false},
+		{"Peer intermediates", request(client, intermediate), ValidationOptions{VerifyChain: true, UsePeerIntermediates: true}, true},
+		{"Stored intermediates", request(client), ValidationOptions{VerifyChain: true, Intermediates: []string{intermediateID}}, true},
+		{"Wrong key usage", request(serverOnly), ValidationOptions{VerifyChain: true}, false},
+		{"Any key usage", request(serverOnly), ValidationOptions{VerifyChain: true, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}, true},
+		{"Subject rule", request(client, intermediate), ValidationOptions{VerifyChain: true, UsePeerIntermediates: true,
+			SubjectRules: []SubjectRule{{OrganizationalUnit: "billing"}, {OrganizationalUnit: "payments"}}}, true},
+		{"Subject rule mismatch", request(client, intermediate), ValidationOptions{VerifyChain: true, UsePeerIntermediates: true,
+			SubjectRules: []SubjectRule{{OrganizationalUnit: "payments", CommonName: "server"}}}, false},
+		{"SAN rule", request(client, intermediate), ValidationOptions{VerifyChain: true, UsePeerIntermediates: true,
+			SubjectRules: []SubjectRule{{SAN: "*.payments.example.com"}}}, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := m.ValidateRequestCertificateWithOptions([]string{caID}, tc.r, tc.opts)
+			if tc.valid && err != nil {
+				t.Error("Should be valid", err)
+			}
+
+			if !tc.valid && err == nil {
+				t.Error("Should be rejected")
+			}
+		})
+	}
+}
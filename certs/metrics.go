@@ -0,0 +1,125 @@
+package certs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics are counters of certificate operations since the manager was
+// created.
+type Metrics struct {
+	CacheHits     int64
+	CacheMisses   int64
+	StorageErrors int64
+	ParseFailures int64
+	// ValidationRejects counts client certificates rejected by
+	// ValidateRequestCertificate.
+	ValidationRejects int64
+	// CacheEvictions counts certificates evicted from cache because of the
+	// cache limits.
+	CacheEvictions int64
+}
+
+// expiryBuckets group stored certificates by time left until expiry.
+var expiryBuckets = []struct {
+	label string
+	left  time.Duration
+}{
+	{"expired", 0},
+	{"7d", 7 * 24 * time.Hour},
+	{"30d", 30 * 24 * time.Hour},
+	{"90d", 90 * 24 * time.Hour},
+}
+
+// Metrics returns a snapshot of the counters.
+func (c *CertificateManager) Metrics() Metrics {
+	return Metrics{
+		CacheHits:         atomic.LoadInt64(&c.metrics.CacheHits),
+		CacheMisses:       atomic.LoadInt64(&c.metrics.CacheMisses),
+		StorageErrors:     atomic.LoadInt64(&c.metrics.StorageErrors),
+		ParseFailures:     atomic.LoadInt64(&c.metrics.ParseFailures),
+		ValidationRejects: atomic.LoadInt64(&c.metrics.ValidationRejects),
+		CacheEvictions:    c.cache.Evictions(),
+	}
+}
+
+// ExpiryCounts returns numbers of stored certificates by time left until
+// expiry: "expired", "7d", "30d", "90d" and "later". Each certificate is
+// counted in the first matching bucket.
+func (c *CertificateManager) ExpiryCounts() map[string]int {
+	counts := map[string]int{"later": 0}
+	for _, bucket := range expiryBuckets {
+		counts[bucket.label] = 0
+	}
+
+	now := time.Now()
+	for _, id := range c.ListAllIds("") {
+		certs, _ := c.list(context.Background(), []string{id}, CertificateAny, false)
+		if len(certs) == 0 || certs[0] == nil || certs[0].Leaf.NotAfter.IsZero() {
+			continue
+		}
+
+		label := "later"
+		left := certs[0].Leaf.NotAfter.Sub(now)
+		for _, bucket := range expiryBuckets {
+			if left <= bucket.left {
+				label = bucket.label
+				break
+			}
+		}
+		counts[label]++
+	}
+
+	return counts
+}
+
+// WritePrometheus writes the metrics, and the stored certificates by expiry,
+// in Prometheus text format.
+func (c *CertificateManager) WritePrometheus(w io.Writer) error {
+	m := c.Metrics()
+	entries, bytes := c.CacheSize()
+
+	var ratio float64
+	if lookups := m.CacheHits + m.CacheMisses; lookups > 0 {
+		ratio = float64(m.CacheHits) / float64(lookups)
+	}
+
+	metrics := []struct {
+		name, kind, help string
+		value            interface{}
+	}{
+		{"tyk_certificate_cache_hits_total", "counter", "Certificates served from cache.", m.CacheHits},
+		{"tyk_certificate_cache_misses_total", "counter", "Certificates loaded on cache miss.", m.CacheMisses},
+		{"tyk_certificate_cache_hit_ratio", "gauge", "Ratio of certificates served from cache.", ratio},
+		{"tyk_certificate_storage_errors_total", "counter", "Certificates which can't be read from storage, sources or files.", m.StorageErrors},
+		{"tyk_certificate_parse_failures_total", "counter", "Certificates which can't be parsed.", m.ParseFailures},
+		{"tyk_certificate_validation_rejects_total", "counter", "Client certificates rejected by validation.", m.ValidationRejects},
+		{"tyk_certificate_cache_evictions_total", "counter", "Certificates evicted from cache because of the cache limits.", m.CacheEvictions},
+		{"tyk_certificate_cache_entries", "gauge", "Cached certificates and public keys.", entries},
+		{"tyk_certificate_cache_bytes", "gauge", "Estimated size of cached certificates.", bytes},
+	}
+
+	for _, metric := range metrics {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n",
+			metric.name, metric.help, metric.name, metric.kind, metric.name, metric.value); err != nil {
+			return err
+		}
+	}
+
+	counts := c.ExpiryCounts()
+
+	if _, err := fmt.Fprint(w, "# HELP tyk_certificates_expiring Stored certificates by time left until expiry.\n# TYPE tyk_certificates_expiring gauge\n"); err != nil {
+		return err
+	}
+	for _, bucket := range expiryBuckets {
+		if _, err := fmt.Fprintf(w, "tyk_certificates_expiring{expires_in=%q} %d\n", bucket.label, counts[bucket.label]); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "tyk_certificates_expiring{expires_in=\"later\"} %d\n", counts["later"])
+
+	return err
+}
@@ -0,0 +1,60 @@
+package certs
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	storage := newDummyStorage()
+	m := NewCertificateManager(storage, "test", nil)
+
+	certPem, _ := genCertificateFromCommonName("metrics")
+	certID, _ := m.Add(certPem, "")
+
+	expiring, _ := genCertificateFromCommonName("expiring")
+	m.Add(expiring, "")
+
+	storage.data["raw-"+HexSHA256([]byte("broken"))] = "broken"
+
+	m.List([]string{certID}, CertificateAny)
+	m.List([]string{certID, HexSHA256([]byte("broken")), "missing.pem"}, CertificateAny)
+
+	m.ValidateRequestCertificate([]string{certID}, httptest.NewRequest("GET", "/", nil))
+
+	metrics := m.Metrics()
+	expected := Metrics{CacheHits: 1, CacheMisses: 3, StorageErrors: 1, ParseFailures: 1, ValidationRejects: 1}
+	if metrics != expected {
+		t.Errorf("Expected %+v, got %+v", expected, metrics)
+	}
+
+	storage.DeleteKey("raw-" + HexSHA256([]byte("broken")))
+
+	if counts := m.ExpiryCounts(); counts["7d"] != 2 || counts["later"] != 0 {
+		t.Error("Certificates valid for an hour should be in 7 days bucket", counts)
+	}
+
+	if m.Metrics().CacheHits != metrics.CacheHits {
+		t.Error("Expiry scan should not be counted in cache metrics")
+	}
+
+	var buf bytes.Buffer
+	if err := m.WritePrometheus(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{
+		"# TYPE tyk_certificate_cache_hits_total counter",
+		"tyk_certificate_cache_hits_total 1",
+		"tyk_certificate_cache_hit_ratio 0.25",
+		"tyk_certificate_parse_failures_total 1",
+		`tyk_certificates_expiring{expires_in="7d"} 2`,
+		`tyk_certificates_expiring{expires_in="expired"} 0`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Error("Metrics should contain", line, buf.String())
+		}
+	}
+}
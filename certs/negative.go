@@ -0,0 +1,54 @@
+package certs
+
+import "time"
+
+const (
+	missingCachePrefix      = "missing-"
+	defaultNegativeCacheTTL = 10 * time.Second
+)
+
+// SetNegativeCacheTTL sets for how long stored certificates which are not
+// found are remembered as missing, so repeated lookups of unknown IDs don't
+// reach storage. Adding the certificate drops the cached result. 0 uses the
+// default of 10 seconds, negative disables negative caching.
+func (c *CertificateManager) SetNegativeCacheTTL(ttl time.Duration) {
+	if ttl == 0 {
+		ttl = defaultNegativeCacheTTL
+	}
+
+	c.mu.Lock()
+	c.negativeTTL = ttl
+	c.mu.Unlock()
+}
+
+// MissingKeyStorageHandler is a StorageHandler which tells keys not found
+// apart from failures to read them, like outages.
+type MissingKeyStorageHandler interface {
+	StorageHandler
+	IsKeyNotFound(err error) bool
+}
+
+// confirmsMissing reports if storage failed to read a key with err because it
+// isn't stored. Storages which can't tell confirm nothing, for outages not to
+// hide stored certificates until the cached result expires.
+func (c *CertificateManager) confirmsMissing(err error) bool {
+	storage, ok := c.storage.(MissingKeyStorageHandler)
+	return ok && storage.IsKeyNotFound(err)
+}
+
+// cacheMissing remembers the stored certificate as missing.
+func (c *CertificateManager) cacheMissing(certID string) {
+	c.mu.RLock()
+	ttl := c.negativeTTL
+	c.mu.RUnlock()
+
+	if ttl > 0 {
+		c.cache.Set(missingCachePrefix+certID, true, ttl)
+	}
+}
+
+// isMissing reports if the certificate was recently not found in storage.
+func (c *CertificateManager) isMissing(certID string) bool {
+	_, found := c.cache.Get(missingCachePrefix + certID)
+	return found
+}
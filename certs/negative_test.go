@@ -0,0 +1,116 @@
+package certs
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+// countingStorage counts storage reads.
+type countingStorage struct {
+	*dummyStorage
+	reads int64
+}
+
+func (s *countingStorage) GetKey(key string) (string, error) {
+	atomic.AddInt64(&s.reads, 1)
+	return s.dummyStorage.GetKey(key)
+}
+
+// unavailableStorage fails reads while it's down, as storage does in outages.
+type unavailableStorage struct {
+	*countingStorage
+	down bool
+}
+
+func (s *unavailableStorage) GetKey(key string) (string, error) {
+	if s.down {
+		atomic.AddInt64(&s.reads, 1)
+		return "", errors.New("connection refused")
+	}
+	return s.countingStorage.GetKey(key)
+}
+
+func TestNegativeCache(t *testing.T) {
+	storage := &countingStorage{dummyStorage: newDummyStorage()}
+	m := NewCertificateManager(storage, "test", nil)
+
+	certPem, _ := genCertificateFromCommonName("negative")
+	certID := HexSHA256([]byte("negative"))
+
+	for i := 0; i < 3; i++ {
+		if certs := m.List([]string{certID}, CertificateAny); len(certs) != 1 || certs[0] != nil {
+			t.Fatal("Missing certificate should not be listed")
+		}
+	}
+	if reads := atomic.LoadInt64(&storage.reads); reads != 1 {
+		t.Error("Missing certificate should be read from storage once, got", reads)
+	}
+	if m.ListPublicKeys([]string{certID})[0] != "" {
+		t.Error("Missing public key should not be listed")
+	}
+	if reads := atomic.LoadInt64(&storage.reads); reads != 1 {
+		t.Error("Missing public key should not be read from storage, got", reads)
+	}
+
+	t.Run("Add", func(t *testing.T) {
+		storage.dummyStorage.SetKey("raw-"+certID, string(certPem), 0)
+		if certs := m.List([]string{certID}, CertificateAny); certs[0] != nil {
+			t.Error("Certificate should be remembered as missing")
+		}
+
+		m.Invalidate(certID)
+		if certs := m.List([]string{certID}, CertificateAny); certs[0] == nil {
+			t.Error("Invalidated certificate should be loaded")
+		}
+
+		m.Delete(certID)
+		m.List([]string{certID}, CertificateAny)
+
+		addedID, err := m.Add(certPem, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if certs := m.List([]string{addedID}, CertificateAny); certs[0] == nil {
+			t.Error("Added certificate should be loaded")
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		m.SetNegativeCacheTTL(-1)
+		defer m.SetNegativeCacheTTL(0)
+
+		missingID := HexSHA256([]byte("disabled"))
+		reads := atomic.LoadInt64(&storage.reads)
+		m.List([]string{missingID}, CertificateAny)
+		m.List([]string{missingID}, CertificateAny)
+
+		if got := atomic.LoadInt64(&storage.reads) - reads; got != 2 {
+			t.Error("Missing certificate should be read every time, got", got)
+		}
+	})
+
+	t.Run("Storage unavailable", func(t *testing.T) {
+		storage := &unavailableStorage{countingStorage: &countingStorage{dummyStorage: newDummyStorage()}, down: true}
+		m := NewCertificateManager(storage, "test", nil)
+
+		certPem, _ := genCertificateFromCommonName("unavailable")
+		certID := HexSHA256([]byte("unavailable"))
+		storage.dummyStorage.SetKey("raw-"+certID, string(certPem), 0)
+
+		if certs := m.List([]string{certID}, CertificateAny); certs[0] != nil {
+			t.Fatal("Certificate should not be loaded while storage is down")
+		}
+		if m.ListPublicKeys([]string{certID})[0] != "" {
+			t.Fatal("Public key should not be loaded while storage is down")
+		}
+
+		storage.down = false
+		if certs := m.List([]string{certID}, CertificateAny); certs[0] == nil {
+			t.Error("Certificate should be loaded once storage is back")
+		}
+		if m.ListPublicKeys([]string{certID})[0] == "" {
+			t.Error("Public key should be loaded once storage is back")
+		}
+	})
+}
@@ -0,0 +1,305 @@
+package certs
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	cache "github.com/pmylund/go-cache"
+	"golang.org/x/crypto/ocsp"
+)
+
+const ocspCachePrefix = "ocsp-"
+
+const (
+	defaultStapleRefreshInterval = time.Minute
+	// Responses without NextUpdate are requested again after this time
+	stapleMaxAge = time.Hour
+	// Failed requests are retried after this time, doubled on every failure
+	// up to stapleMaxBackoff
+	stapleMinBackoff = time.Minute
+	stapleMaxBackoff = time.Hour
+	// Certificates which are not served for this time stop being stapled
+	stapleUnusedTimeout = 24 * time.Hour
+)
+
+type ocspEntry struct {
+	raw      []byte
+	response *ocsp.Response
+}
+
+// stapleEntry is the OCSP response stapled to a server certificate, kept up
+// to date in background.
+type stapleEntry struct {
+	leaf, issuer *x509.Certificate
+
+	raw        []byte
+	nextUpdate time.Time
+	refreshAt  time.Time
+	failures   int
+	lastUsed   time.Time
+}
+
+// OCSPManager requests OCSP responses for server certificate stapling and for
+// checking client certificate status. Responses are kept in the certificate
+// manager cache until their NextUpdate. Stapled responses are requested in
+// background, so TLS handshakes never wait for the OCSP responder.
+type OCSPManager struct {
+	cache  *lruCache
+	logger *logrus.Entry
+	client *http.Client
+
+	mu      sync.Mutex
+	staples map[string]*stapleEntry
+	wake    chan struct{}
+	stop    chan struct{}
+}
+
+func NewOCSPManager(manager *CertificateManager) *OCSPManager {
+	return &OCSPManager{
+		cache:   manager.cache,
+		logger:  manager.logger.Logger.WithFields(logrus.Fields{"prefix": "ocsp"}),
+		client:  &http.Client{Timeout: 5 * time.Second},
+		staples: map[string]*stapleEntry{},
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// StartStapling starts requesting the responses stapled to server
+// certificates in background. Responses are refreshed halfway to their
+// NextUpdate, and new certificates are stapled as soon as they are served.
+func (m *OCSPManager) StartStapling(interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultStapleRefreshInterval
+	}
+
+	m.mu.Lock()
+	if m.stop != nil {
+		m.mu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	m.stop = stop
+	m.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-m.wake:
+			case <-stop:
+				return
+			}
+			m.RefreshStaples()
+		}
+	}()
+}
+
+// StopStapling stops background stapling. Responses already requested keep
+// being stapled until their NextUpdate.
+func (m *OCSPManager) StopStapling() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+}
+
+// RefreshStaples requests the stapled responses which are due. A failed
+// request keeps the previous response while it is valid, and is retried with
+// exponential backoff.
+func (m *OCSPManager) RefreshStaples() {
+	now := time.Now()
+
+	m.mu.Lock()
+	var due []*stapleEntry
+	for key, entry := range m.staples {
+		if now.Sub(entry.lastUsed) > stapleUnusedTimeout {
+			delete(m.staples, key)
+			continue
+		}
+		if !now.Before(entry.refreshAt) {
+			due = append(due, entry)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, entry := range due {
+		response, raw, err := m.request(entry.leaf, entry.issuer)
+
+		m.mu.Lock()
+		if err != nil {
+			entry.failures++
+			backoff := stapleMaxBackoff
+			if entry.failures < 7 {
+				backoff = stapleMinBackoff << uint(entry.failures-1)
+			}
+			entry.refreshAt = time.Now().Add(backoff)
+			m.mu.Unlock()
+
+			m.logger.Warning("Can't staple OCSP response for ", entry.leaf.Subject.CommonName, ": ", err)
+			continue
+		}
+
+		entry.raw = raw
+		entry.nextUpdate = response.NextUpdate
+		entry.failures = 0
+		if response.NextUpdate.IsZero() {
+			entry.refreshAt = time.Now().Add(stapleMaxAge)
+		} else {
+			entry.refreshAt = response.ThisUpdate.Add(response.NextUpdate.Sub(response.ThisUpdate) / 2)
+		}
+		m.mu.Unlock()
+	}
+}
+
+// Response returns OCSP response for the certificate, requesting it from the
+// first OCSP server listed in the certificate if it is not cached.
+func (m *OCSPManager) Response(cert, issuer *x509.Certificate) (*ocsp.Response, []byte, error) {
+	cacheKey := ocspCachePrefix + HexSHA256(cert.Raw)
+	if entry, found := m.cache.Get(cacheKey); found {
+		e := entry.(*ocspEntry)
+		return e.response, e.raw, nil
+	}
+
+	if len(cert.OCSPServer) == 0 {
+		return nil, nil, errors.New("Certificate does not specify OCSP server")
+	}
+
+	if issuer == nil {
+		return nil, nil, errors.New("Certificate issuer is required for OCSP request")
+	}
+
+	response, raw, err := m.request(cert, issuer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entry := &ocspEntry{raw: raw, response: response}
+	switch {
+	case response.NextUpdate.IsZero():
+		m.cache.Set(cacheKey, entry, cache.DefaultExpiration)
+	case response.NextUpdate.After(time.Now()):
+		m.cache.Set(cacheKey, entry, time.Until(response.NextUpdate))
+	default:
+		m.logger.Warning("OCSP response for ", cert.Subject.CommonName, " is outdated")
+	}
+
+	return response, raw, nil
+}
+
+// request requests OCSP response for the certificate from the first OCSP
+// server listed in it.
+func (m *OCSPManager) request(cert, issuer *x509.Certificate) (*ocsp.Response, []byte, error) {
+	req, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := m.client.Post(cert.OCSPServer[0], "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, errors.New("Unexpected OCSP response status: " + resp.Status)
+	}
+
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	response, err := ocsp.ParseResponseForCert(raw, cert, issuer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return response, raw, nil
+}
+
+// IsRevoked checks certificate status with its OCSP responder. Certificates
+// without OCSP server are treated as not revoked.
+func (m *OCSPManager) IsRevoked(cert, issuer *x509.Certificate) (bool, error) {
+	if len(cert.OCSPServer) == 0 {
+		return false, nil
+	}
+
+	response, _, err := m.Response(cert, issuer)
+	if err != nil {
+		return false, err
+	}
+
+	return response.Status == ocsp.Revoked, nil
+}
+
+// Staple returns a copy of the certificate with OCSP response attached. It
+// never requests the response itself: certificates seen for the first time
+// are stapled in background, and are returned as is until a valid response
+// is obtained.
+func (m *OCSPManager) Staple(cert *tls.Certificate) *tls.Certificate {
+	if cert == nil || len(cert.Certificate) < 2 {
+		return cert
+	}
+
+	leaf := cert.Leaf
+	if leaf == nil {
+		var err error
+		if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return cert
+		}
+	}
+
+	if len(leaf.OCSPServer) == 0 {
+		return cert
+	}
+
+	issuer, err := x509.ParseCertificate(cert.Certificate[1])
+	if err != nil {
+		return cert
+	}
+
+	now := time.Now()
+	key := HexSHA256(leaf.Raw)
+
+	m.mu.Lock()
+	entry, found := m.staples[key]
+	if !found {
+		entry = &stapleEntry{leaf: leaf, issuer: issuer}
+		m.staples[key] = entry
+	}
+	entry.lastUsed = now
+	raw := entry.raw
+	if !entry.nextUpdate.IsZero() && now.After(entry.nextUpdate) {
+		raw = nil
+	}
+	m.mu.Unlock()
+
+	if !found {
+		select {
+		case m.wake <- struct{}{}:
+		default:
+		}
+	}
+
+	if raw == nil {
+		return cert
+	}
+
+	stapled := *cert
+	stapled.OCSPStaple = raw
+
+	return &stapled
+}
@@ -0,0 +1,156 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestOCSPManager(t *testing.T) {
+	ca, caKey := genSignedCertificate(&x509.Certificate{
+		Subject:  pkix.Name{CommonName: "ca"},
+		IsCA:     true,
+		KeyUsage: x509.KeyUsageCertSign,
+	}, nil, nil)
+
+	var requests int
+	var revokedSerial string
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		body, _ := ioutil.ReadAll(r.Body)
+		req, err := ocsp.ParseRequest(body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		status := ocsp.Good
+		if req.SerialNumber.String() == revokedSerial {
+			status = ocsp.Revoked
+		}
+
+		resp, _ := ocsp.CreateResponse(ca, ca, ocsp.Response{
+			Status:       status,
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   time.Now(),
+			NextUpdate:   time.Now().Add(time.Hour),
+			RevokedAt:    time.Now(),
+		}, caKey)
+		w.Write(resp)
+	}))
+	defer responder.Close()
+
+	good, _ := genSignedCertificate(&x509.Certificate{
+		Subject:    pkix.Name{CommonName: "good"},
+		OCSPServer: []string{responder.URL},
+	}, ca, caKey)
+	revoked, _ := genSignedCertificate(&x509.Certificate{
+		Subject:    pkix.Name{CommonName: "revoked"},
+		OCSPServer: []string{responder.URL},
+	}, ca, caKey)
+	noOCSP, _ := genSignedCertificate(&x509.Certificate{
+		Subject: pkix.Name{CommonName: "no-ocsp"},
+	}, ca, caKey)
+	revokedSerial = revoked.SerialNumber.String()
+
+	m := NewOCSPManager(newManager())
+
+	tests := []struct {
+		name    string
+		cert    *x509.Certificate
+		issuer  *x509.Certificate
+		revoked bool
+		err     bool
+	}{
+		{"Unknown issuer", good, nil, false, true},
+		{"Good", good, ca, false, false},
+		{"Revoked", revoked, ca, true, false},
+		{"No OCSP server", noOCSP, ca, false, false},
+		{"Cached", good, nil, false, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			isRevoked, err := m.IsRevoked(tc.cert, tc.issuer)
+			if (err != nil) != tc.err {
+				t.Error("Unexpected error", err)
+			}
+
+			if isRevoked != tc.revoked {
+				t.Error("Wrong revocation status", isRevoked)
+			}
+		})
+	}
+
+	if requests != 2 {
+		t.Error("Responses should be cached", requests)
+	}
+
+	t.Run("Staple", func(t *testing.T) {
+		m.StartStapling(time.Hour)
+		defer m.StopStapling()
+
+		cert := &tls.Certificate{Certificate: [][]byte{good.Raw, ca.Raw}}
+
+		if len(m.Staple(cert).OCSPStaple) != 0 {
+			t.Error("OCSP response should be requested in background")
+		}
+
+		var stapled *tls.Certificate
+		for i := 0; i < 100; i++ {
+			if stapled = m.Staple(cert); len(stapled.OCSPStaple) != 0 {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if len(stapled.OCSPStaple) == 0 {
+			t.Error("OCSP response should be stapled")
+		}
+
+		if len(cert.OCSPStaple) != 0 {
+			t.Error("Original certificate should not be modified")
+		}
+
+		if m.Staple(&tls.Certificate{Certificate: [][]byte{noOCSP.Raw, ca.Raw}}).OCSPStaple != nil {
+			t.Error("Certificate without OCSP server should not be stapled")
+		}
+	})
+
+	t.Run("Staple unreachable responder", func(t *testing.T) {
+		var failed int
+		down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			failed++
+			time.Sleep(100 * time.Millisecond)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer down.Close()
+
+		unreachable, _ := genSignedCertificate(&x509.Certificate{
+			Subject:    pkix.Name{CommonName: "unreachable"},
+			OCSPServer: []string{down.URL},
+		}, ca, caKey)
+		cert := &tls.Certificate{Certificate: [][]byte{unreachable.Raw, ca.Raw}}
+
+		start := time.Now()
+		if len(m.Staple(cert).OCSPStaple) != 0 {
+			t.Error("Response should not be stapled")
+		}
+		if time.Since(start) > 50*time.Millisecond {
+			t.Error("Staple should not wait for the OCSP responder")
+		}
+
+		m.RefreshStaples()
+		m.RefreshStaples()
+		if failed != 1 {
+			t.Error("Failed requests should be retried after backoff", failed)
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package certs
+
+import (
+	"crypto/tls"
+	"strings"
+)
+
+// OrgCertificates restricts certificate operations to the certificates of
+// one organisation, so tenants can't read or remove each other's
+// certificates. Certificates of other organisations are reported as not
+// found.
+type OrgCertificates struct {
+	manager *CertificateManager
+	orgID   string
+}
+
+// ForOrg returns operations scoped to the organisation.
+func (c *CertificateManager) ForOrg(orgID string) *OrgCertificates {
+	return &OrgCertificates{manager: c, orgID: orgID}
+}
+
+// Owns checks that the certificate ID is the organisation ID followed by the
+// fingerprint. Prefix alone is not enough, as organisation IDs may be
+// prefixes of each other.
+func (o *OrgCertificates) Owns(certID string) bool {
+	return len(certID) == len(o.orgID)+sha256HexLength &&
+		strings.HasPrefix(certID, o.orgID) &&
+		isSHA256(certID[len(o.orgID):])
+}
+
+func (o *OrgCertificates) notFound(certID string) error {
+	return &CertificateError{CertID: certID, Err: ErrCertNotFound}
+}
+
+// Add stores the certificate for the organisation.
+func (o *OrgCertificates) Add(certData []byte) (string, error) {
+	return o.manager.Add(certData, o.orgID)
+}
+
+// List is CertificateManager.List returning nil for certificates of other
+// organisations.
+func (o *OrgCertificates) List(certIDs []string, mode CertificateType) []*tls.Certificate {
+	owned := make([]string, 0, len(certIDs))
+	for _, id := range certIDs {
+		if o.Owns(id) {
+			owned = append(owned, id)
+		}
+	}
+
+	listed := o.manager.List(owned, mode)
+
+	out := make([]*tls.Certificate, len(certIDs))
+	for i, id := range certIDs {
+		if len(owned) > 0 && owned[0] == id {
+			out[i], owned, listed = listed[0], owned[1:], listed[1:]
+		}
+	}
+
+	return out
+}
+
+// ListAllIds returns IDs of all certificates of the organisation.
+func (o *OrgCertificates) ListAllIds() (out []string) {
+	for _, id := range o.manager.ListAllIds(o.orgID) {
+		if o.Owns(id) {
+			out = append(out, id)
+		}
+	}
+
+	return out
+}
+
+// GetRaw returns stored certificate data.
+func (o *OrgCertificates) GetRaw(certID string) (string, error) {
+	if !o.Owns(certID) {
+		return "", o.notFound(certID)
+	}
+
+	return o.manager.GetRaw(certID)
+}
+
+// Delete removes the certificate of the organisation.
+func (o *OrgCertificates) Delete(certID string) error {
+	if raw, err := o.GetRaw(certID); err != nil || raw == "" {
+		return o.notFound(certID)
+	}
+
+	o.manager.Delete(certID)
+	return nil
+}
+
+// listOrgIds returns IDs of the organisation certificates, or of all
+// certificates for empty organisation.
+func (c *CertificateManager) listOrgIds(orgID string) []string {
+	if orgID == "" {
+		return c.ListAllIds("")
+	}
+
+	return c.ForOrg(orgID).ListAllIds()
+}
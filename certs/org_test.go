@@ -0,0 +1,51 @@
+package certs
+
+import (
+	"testing"
+)
+
+func TestOrgCertificates(t *testing.T) {
+	m := newManager()
+
+	certPem, _ := genCertificateFromCommonName("tenant")
+	certID, _ := m.Add(certPem, "ab")
+
+	// Organisation ID which is prefixed by another one
+	otherPem, _ := genCertificateFromCommonName("other tenant")
+	otherID, _ := m.Add(otherPem, "abcd")
+
+	tenant := m.ForOrg("ab")
+
+	if !tenant.Owns(certID) || tenant.Owns(otherID) || tenant.Owns("ab") {
+		t.Error("Only organisation certificates should be owned")
+	}
+
+	if ids := tenant.ListAllIds(); len(ids) != 1 || ids[0] != certID {
+		t.Error("Only organisation certificates should be listed", ids)
+	}
+
+	certs := tenant.List([]string{otherID, certID}, CertificateAny)
+	if len(certs) != 2 || certs[0] != nil || certs[1] == nil {
+		t.Error("Certificates of other organisations should not be loaded", certs)
+	}
+
+	if _, err := tenant.GetRaw(otherID); err == nil {
+		t.Error("Certificate of other organisation should not be read")
+	}
+
+	if err := tenant.Delete(otherID); err == nil {
+		t.Error("Certificate of other organisation should not be deleted")
+	}
+
+	if raw, _ := m.GetRaw(otherID); raw == "" {
+		t.Error("Certificate of other organisation should be kept")
+	}
+
+	if err := tenant.Delete(certID); err != nil {
+		t.Error("Organisation certificate should be deleted", err)
+	}
+
+	if page := m.ListPage("ab", "", 0); len(page.Certs) != 0 {
+		t.Error("Certificates of other organisations should not be paged", page.Certs)
+	}
+}
@@ -0,0 +1,54 @@
+package certs
+
+import (
+	"sort"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// CertificatePage is a page of stored certificates returned by ListPage.
+type CertificatePage struct {
+	Certs []*CertificateMeta `json:"certs"`
+	// NextCursor requests the next page, and is empty on the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// ListPage returns meta information of stored certificates of the
+// organisation, ordered by certificate ID. The cursor is empty for the first
+// page, and NextCursor of the previous page afterwards. Certificates which
+// can't be loaded are skipped.
+func (c *CertificateManager) ListPage(orgID, cursor string, pageSize int) *CertificatePage {
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	certIDs := c.listOrgIds(orgID)
+	sort.Strings(certIDs)
+
+	// Cursor is the last ID of the previous page, so removed certificates
+	// don't shift the following pages
+	start := sort.Search(len(certIDs), func(i int) bool {
+		return certIDs[i] > cursor
+	})
+	certIDs = certIDs[start:]
+
+	page := &CertificatePage{Certs: []*CertificateMeta{}}
+	if len(certIDs) > pageSize {
+		certIDs = certIDs[:pageSize]
+		page.NextCursor = certIDs[pageSize-1]
+	}
+
+	for i, cert := range c.List(certIDs, CertificateAny) {
+		if cert != nil {
+			page.Certs = append(page.Certs, c.CertificateMeta(cert, certIDs[i]))
+		}
+	}
+
+	return page
+}
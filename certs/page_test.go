@@ -0,0 +1,58 @@
+package certs
+
+import (
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestListPage(t *testing.T) {
+	m := newManager()
+
+	// Organisation IDs are hex encoded, like certificate fingerprints
+	var certIDs []string
+	for i := 0; i < 5; i++ {
+		certPem, _ := genCertificateFromCommonName("cert" + strconv.Itoa(i))
+		certID, _ := m.Add(certPem, "abcd")
+		certIDs = append(certIDs, certID)
+	}
+	sort.Strings(certIDs)
+
+	otherPem, _ := genCertificateFromCommonName("other")
+	m.Add(otherPem, "beef")
+
+	var listed []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("Pagination should end")
+		}
+
+		page := m.ListPage("abcd", cursor, 2)
+		for _, meta := range page.Certs {
+			if meta.Subject.CommonName == "" {
+				t.Error("Meta should be filled", meta.ID)
+			}
+			listed = append(listed, meta.ID)
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	if len(listed) != len(certIDs) {
+		t.Fatal("All organisation certificates should be listed", listed)
+	}
+
+	for i := range certIDs {
+		if listed[i] != certIDs[i] {
+			t.Error("Certificates should be ordered by ID", listed)
+		}
+	}
+
+	if page := m.ListPage("dead", "", 0); page.Certs == nil || len(page.Certs) != 0 || page.NextCursor != "" {
+		t.Error("Should return empty page", page)
+	}
+}
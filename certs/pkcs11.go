@@ -0,0 +1,223 @@
+// +build pkcs11
+
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"math/big"
+	"sync"
+
+	"github.com/miekg/pkcs11"
+)
+
+func init() {
+	RegisterKeyLoader("pkcs11", loadPKCS11Key)
+}
+
+var (
+	pkcs11ModulesMu sync.Mutex
+	pkcs11Modules   = map[string]*pkcs11.Ctx{}
+)
+
+// pkcs11Module loads and initialises PKCS#11 library once per process.
+func pkcs11Module(path string) (*pkcs11.Ctx, error) {
+	pkcs11ModulesMu.Lock()
+	defer pkcs11ModulesMu.Unlock()
+
+	if ctx, ok := pkcs11Modules[path]; ok {
+		return ctx, nil
+	}
+
+	ctx := pkcs11.New(path)
+	if ctx == nil {
+		return nil, errors.New("Can't load PKCS#11 module " + path)
+	}
+
+	if err := ctx.Initialize(); err != nil && err != pkcs11.Error(pkcs11.CKR_CRYPTOKI_ALREADY_INITIALIZED) {
+		ctx.Destroy()
+		return nil, err
+	}
+
+	pkcs11Modules[path] = ctx
+	return ctx, nil
+}
+
+func findPKCS11Slot(ctx *pkcs11.Ctx, uri *PKCS11URI) (uint, error) {
+	if uri.HasSlot {
+		return uint(uri.Slot), nil
+	}
+
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, slot := range slots {
+		info, err := ctx.GetTokenInfo(slot)
+		if err != nil {
+			continue
+		}
+
+		if uri.Token == "" || info.Label == uri.Token {
+			return slot, nil
+		}
+	}
+
+	return 0, errors.New("PKCS#11 token not found: " + uri.Token)
+}
+
+func loadPKCS11Key(rawURI string, publicKey crypto.PublicKey) (crypto.Signer, error) {
+	uri, err := ParsePKCS11URI(rawURI)
+	if err != nil {
+		return nil, err
+	}
+
+	switch publicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+	default:
+		return nil, errors.New("Unsupported PKCS#11 key type")
+	}
+
+	ctx, err := pkcs11Module(uri.ModulePath)
+	if err != nil {
+		return nil, err
+	}
+
+	slot, err := findPKCS11Slot(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return nil, err
+	}
+
+	if uri.PIN != "" {
+		if err := ctx.Login(session, pkcs11.CKU_USER, uri.PIN); err != nil && err != pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN) {
+			ctx.CloseSession(session)
+			return nil, err
+		}
+	}
+
+	template := []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY)}
+	if uri.Object != "" {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_LABEL, uri.Object))
+	}
+	if len(uri.ID) > 0 {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_ID, uri.ID))
+	}
+
+	if err := ctx.FindObjectsInit(session, template); err != nil {
+		ctx.CloseSession(session)
+		return nil, err
+	}
+	objects, _, err := ctx.FindObjects(session, 1)
+	ctx.FindObjectsFinal(session)
+
+	if err != nil {
+		ctx.CloseSession(session)
+		return nil, err
+	}
+
+	if len(objects) == 0 {
+		ctx.CloseSession(session)
+		return nil, errors.New("PKCS#11 private key not found")
+	}
+
+	return &pkcs11Signer{
+		ctx:       ctx,
+		session:   session,
+		key:       objects[0],
+		publicKey: publicKey,
+	}, nil
+}
+
+// pkcs11Signer signs with a private key held by PKCS#11 token.
+type pkcs11Signer struct {
+	ctx       *pkcs11.Ctx
+	session   pkcs11.SessionHandle
+	key       pkcs11.ObjectHandle
+	publicKey crypto.PublicKey
+
+	// Session can run only one operation at a time
+	mu sync.Mutex
+}
+
+func (s *pkcs11Signer) Public() crypto.PublicKey {
+	return s.publicKey
+}
+
+// DigestInfo prefixes for PKCS#1 v1.5 signatures, from crypto/rsa
+var pkcs1HashPrefixes = map[crypto.Hash][]byte{
+	crypto.SHA1:   {0x30, 0x21, 0x30, 0x09, 0x06, 0x05, 0x2b, 0x0e, 0x03, 0x02, 0x1a, 0x05, 0x00, 0x04, 0x14},
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+var pssMechanisms = map[crypto.Hash][2]uint{
+	crypto.SHA256: {pkcs11.CKM_SHA256, pkcs11.CKG_MGF1_SHA256},
+	crypto.SHA384: {pkcs11.CKM_SHA384, pkcs11.CKG_MGF1_SHA384},
+	crypto.SHA512: {pkcs11.CKM_SHA512, pkcs11.CKG_MGF1_SHA512},
+}
+
+func (s *pkcs11Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	var mechanism *pkcs11.Mechanism
+	data := digest
+
+	switch s.publicKey.(type) {
+	case *rsa.PublicKey:
+		if pssOpts, ok := opts.(*rsa.PSSOptions); ok {
+			params, ok := pssMechanisms[opts.HashFunc()]
+			if !ok {
+				return nil, errors.New("Unsupported hash for RSA-PSS")
+			}
+
+			saltLength := pssOpts.SaltLength
+			if saltLength == rsa.PSSSaltLengthEqualsHash || saltLength == rsa.PSSSaltLengthAuto {
+				saltLength = opts.HashFunc().Size()
+			}
+
+			mechanism = pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS_PSS, pkcs11.NewPSSParams(params[0], params[1], uint(saltLength)))
+		} else {
+			prefix, ok := pkcs1HashPrefixes[opts.HashFunc()]
+			if !ok {
+				return nil, errors.New("Unsupported hash for RSA PKCS#1 v1.5")
+			}
+
+			data = append(append([]byte{}, prefix...), digest...)
+			mechanism = pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil)
+		}
+	case *ecdsa.PublicKey:
+		mechanism = pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.ctx.SignInit(s.session, []*pkcs11.Mechanism{mechanism}, s.key); err != nil {
+		return nil, err
+	}
+
+	signature, err := s.ctx.Sign(s.session, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := s.publicKey.(*ecdsa.PublicKey); ok {
+		// PKCS#11 returns raw r || s, while crypto.Signer should return ASN.1
+		half := len(signature) / 2
+		return asn1.Marshal(struct{ R, S *big.Int }{
+			new(big.Int).SetBytes(signature[:half]),
+			new(big.Int).SetBytes(signature[half:]),
+		})
+	}
+
+	return signature, nil
+}
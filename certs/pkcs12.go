@@ -0,0 +1,62 @@
+package certs
+
+import (
+	"encoding/pem"
+	"errors"
+	"sort"
+
+	"golang.org/x/crypto/pkcs12"
+)
+
+// PKCS12ToPEM converts a PKCS#12 (.p12/.pfx) bundle into PEM encoded
+// certificate chain and private key, in the form accepted by Add.
+// The certificate matching the private key is placed first.
+func PKCS12ToPEM(data []byte, passphrase string) ([]byte, error) {
+	blocks, err := pkcs12.ToPEM(data, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	var keyID string
+	for _, block := range blocks {
+		if block.Type == "PRIVATE KEY" {
+			keyID = block.Headers["localKeyId"]
+		}
+	}
+
+	sort.SliceStable(blocks, func(i, j int) bool {
+		return keyID != "" && blocks[i].Type == "CERTIFICATE" &&
+			blocks[i].Headers["localKeyId"] == keyID && blocks[j].Headers["localKeyId"] != keyID
+	})
+
+	var out []byte
+	for _, block := range blocks {
+		// Drop PKCS#12 bag attributes, they are not part of the stored PEM
+		block.Headers = nil
+		out = append(out, pem.EncodeToMemory(block)...)
+	}
+
+	if len(out) == 0 {
+		return nil, errors.New("PKCS#12 bundle is empty")
+	}
+
+	return out, nil
+}
+
+// AddPKCS12 stores the certificate chain and private key from a PKCS#12 bundle,
+// the same way Add does for PEM data.
+func (c *CertificateManager) AddPKCS12(data []byte, passphrase, orgID string) (string, error) {
+	return c.AuditedBy("").AddPKCS12(data, passphrase, orgID)
+}
+
+func (a *AuditedCertificates) AddPKCS12(data []byte, passphrase, orgID string) (string, error) {
+	certData, err := PKCS12ToPEM(data, passphrase)
+	if err != nil {
+		err = errors.New("Failed to decode PKCS#12 bundle: " + err.Error())
+		a.manager.logger.Error(err)
+		a.manager.audit(AuditAdd, "", a.actor, err)
+		return "", err
+	}
+
+	return a.Add(certData, orgID)
+}
@@ -0,0 +1,74 @@
+package certs
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+// Generated with openssl pkcs12 -export -legacy, contains leaf certificate
+// "p12-leaf" signed by "p12-ca", leaf private key and CA certificate.
+// Passphrase is "test".
+const pkcs12Bundle = `
+	MIIEygIBAzCCBJAGCSqGSIb3DQEHAaCCBIEEggR9MIIEeTCCA28GCSqGSIb3DQEHBqCCA2Aw
+	ggNcAgEAMIIDVQYJKoZIhvcNAQcBMBwGCiqGSIb3DQEMAQYwDgQI3rMplSeDCesCAggAgIID
+	KILGPjsMkB3w/tJPyw5dMPFvT+7c8drqSZ0hqHe8/mHun7Mlxr2Pi1IkouFtGnNr0y1cV5e3
+	Ub1l9Iq+OPXDZlIZBCNE1nTvdLwDtcClM9hp4U377HJIkHnF3t0cUhZmLuh62Mo9zTUef+C3
+	kVtWB1g80Qo4QncZiLVXCIvCTvY9ypg0ED1Ts4FkpQfaltgiYmCmAyq9XVUTEmi2I/G99F6v
+	QW1t1pA23EjGFlGwf5U7I8M0sFXiQQ8el/OIA4zXYHNI8pGhK/we6lCEwcUanp3MmVlSntak
+	BsrRtl6EEvDutkCgB/ulaK88Vcx2NP0vKas7CSMDADlEXrBh/CzGbuayiAUuMXCKnSeKwxID
+	JJ2n34V6MJZpQEM9Z95KsYvw4+s/NextO/p9cGH5kH+1l4dZ7CZGEgyokvKy4r989/K1JDSP
+	Um6MRNjunq1dcwlxgvS1FjoLwo5JP+b/pIKKu6zFTfk8ehvEi5E1MVNWPBQWCZ6uIrcMblO6
+	pVyCDExXZd/FLeAmh+3QCWAAca7Bo1AfwKbjkpP08GYdAXvkc7JLRVAuDoCd2/vUyh8X3O1F
+	kFAQx7QZOufDSp1KYube4EjcSAcmq6uPJfliDSDKyDgLh+46eHUk8rnAHPK7ZYPPTBj0Ew0q
+	kJwAe4aCQuKK6GdviHfyr7svYKZUbch5F9qFEQqfB5GgLd9l2DxpYpJ67U7/ramSZ3GfkPs/
+	XgwO1kz5TmD+auXGSSNHcSk53ElrKePSlGrbzEhBNW4MrW5CUkytUhvWr1qY02vjJRQaHFG8
+	ctdzhBHarU0vc/73Y5l80FiG2V0Tx6EQr+d9JLYgoIzr8EHK2r/YDO32Zk+hxOgGHBmaR67l
+	ZM3t5W3xpoIyiHGrbkFceH27n3lgutp4kOeqSHsnON5GRC52UdyiE5wrt+iEmA8FGzAIhncl
+	v8u655EwjXfamlyyPtmzzxDSaCA7/1I9qzAwJCb76ZPjmnxFixPI336Bhyq78/hWIkJDbJjO
+	/8+3gLBhQ9mhKKSlUG8gfj3jdA8UcfMXz6OkJyFqXxWPOh1p0QplPh8DOycFyg9qV0vVF3Uw
+	ggECBgkqhkiG9w0BBwGggfQEgfEwge4wgesGCyqGSIb3DQEMCgECoIG0MIGxMBwGCiqGSIb3
+	DQEMAQMwDgQIIK2qO0LszwECAggABIGQ2VjBT3CyBvo/XVJv9GOhCDd/V0xxFJsLE7x9W1hn
+	w/+xWrpnhN1YLZ24aXoJ51krCOm8pPrB+YsDvYpiGFwzXwUkMIh7LoLYClWk1iH7HhF54DlG
+	jQufHz0JZJC+o6eWMo2tl07U/u/lapOWONUpRf7LiBYQdXvfngt8iGEzwPpV/FmlN+kFKPcj
+	lNjqYrjHMSUwIwYJKoZIhvcNAQkVMRYEFAQrAVwr6Ss9jRu40edy1NSU0pOUMDEwITAJBgUr
+	DgMCGgUABBSezttjGfFgMXgvjTjFCNm7DyYf3gQICAuips+yP7YCAggA
+`
+
+const pkcs12LeafID = "693770d2ee5e40305f4eb8ac3171d048e5393ccb187bdb2cefa492e48d255a96"
+
+func TestAddPKCS12(t *testing.T) {
+	m := newManager()
+
+	data, _ := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(pkcs12Bundle), ""))
+
+	t.Run("Wrong passphrase", func(t *testing.T) {
+		if _, err := m.AddPKCS12(data, "wrong", ""); err == nil {
+			t.Error("Should fail with wrong passphrase")
+		}
+	})
+
+	t.Run("Valid bundle", func(t *testing.T) {
+		certID, err := m.AddPKCS12(data, "test", "")
+		if err != nil {
+			t.Fatal("Should add PKCS#12 bundle", err)
+		}
+
+		if certID != pkcs12LeafID {
+			t.Error("Certificate ID should be leaf fingerprint", certID)
+		}
+
+		certs := m.List([]string{certID}, CertificatePrivate)
+		if len(certs) != 1 || certs[0] == nil {
+			t.Fatal("Should list certificate with private key")
+		}
+
+		if leafSubjectName(certs[0]) != "p12-leaf" {
+			t.Error("Wrong leaf certificate", leafSubjectName(certs[0]))
+		}
+
+		if len(certs[0].Certificate) != 2 {
+			t.Error("Should store CA certificate as part of the chain", len(certs[0].Certificate))
+		}
+	})
+}
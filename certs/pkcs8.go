@@ -0,0 +1,272 @@
+package certs
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"hash"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// passphraseBlock is the PEM block type used to store per-certificate private
+// key passphrase, encrypted with the secret.
+const passphraseBlock = "KEY PASSPHRASE"
+
+var (
+	oidPBES2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidScrypt = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11591, 4, 11}
+
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+
+	oidAES128CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// encryptedPrivateKeyInfo is PKCS#8 EncryptedPrivateKeyInfo, RFC 5958.
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// pbes2Params is PBES2-params, RFC 8018.
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// scryptParams is scrypt-params, RFC 7914.
+type scryptParams struct {
+	Salt                     []byte
+	CostParameter            int
+	BlockSize                int
+	ParallelizationParameter int
+	KeyLength                int `asn1:"optional"`
+}
+
+// isPKCS8EncryptedBlock checks if the block is PKCS#8 EncryptedPrivateKeyInfo.
+// Private keys encrypted with the secret have the same block type, but have
+// encryption headers.
+func isPKCS8EncryptedBlock(block *pem.Block) bool {
+	return block.Type == "ENCRYPTED PRIVATE KEY" && len(block.Headers) == 0
+}
+
+// decryptPKCS8 decrypts PKCS#8 EncryptedPrivateKeyInfo encrypted with PBES2,
+// which OpenSSL uses by default, with PBKDF2 or scrypt, and AES-CBC.
+func decryptPKCS8(der []byte, passphrase string) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, errors.New("Malformed encrypted private key: " + err.Error())
+	}
+
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, errors.New("Only PBES2 encrypted private keys are supported")
+	}
+
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, errors.New("Malformed PBES2 parameters: " + err.Error())
+	}
+
+	var keyLen int
+	switch enc := params.EncryptionScheme.Algorithm; {
+	case enc.Equal(oidAES128CBC):
+		keyLen = 16
+	case enc.Equal(oidAES192CBC):
+		keyLen = 24
+	case enc.Equal(oidAES256CBC):
+		keyLen = 32
+	default:
+		return nil, errors.New("Unsupported private key cipher " + enc.String())
+	}
+
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil || len(iv) != aes.BlockSize {
+		return nil, errors.New("Malformed private key cipher IV")
+	}
+
+	key, err := pbes2Key(params.KeyDerivationFunc, passphrase, keyLen)
+	if err != nil {
+		return nil, err
+	}
+
+	data := info.EncryptedData
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, errors.New("Malformed encrypted private key data")
+	}
+
+	block, _ := aes.NewCipher(key)
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+
+	// Wrong passphrase most likely results in a bad padding, and otherwise
+	// in data which isn't a private key
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, errors.New("Can't decrypt private key, wrong passphrase")
+	}
+	for _, b := range plain[len(plain)-padding:] {
+		if int(b) != padding {
+			return nil, errors.New("Can't decrypt private key, wrong passphrase")
+		}
+	}
+
+	plain = plain[:len(plain)-padding]
+	var privateKeyInfo struct {
+		Version    int
+		Algorithm  pkix.AlgorithmIdentifier
+		PrivateKey []byte
+	}
+	if rest, err := asn1.Unmarshal(plain, &privateKeyInfo); err != nil || len(rest) != 0 {
+		return nil, errors.New("Can't decrypt private key, wrong passphrase")
+	}
+
+	return plain, nil
+}
+
+func pbes2Key(kdf pkix.AlgorithmIdentifier, passphrase string, keyLen int) ([]byte, error) {
+	switch {
+	case kdf.Algorithm.Equal(oidPBKDF2):
+		var params pbkdf2Params
+		if _, err := asn1.Unmarshal(kdf.Parameters.FullBytes, &params); err != nil {
+			return nil, errors.New("Malformed PBKDF2 parameters: " + err.Error())
+		}
+
+		var prf func() hash.Hash
+		switch alg := params.PRF.Algorithm; {
+		case len(alg) == 0 || alg.Equal(oidHMACWithSHA1):
+			prf = sha1.New
+		case alg.Equal(oidHMACWithSHA256):
+			prf = sha256.New
+		case alg.Equal(oidHMACWithSHA512):
+			prf = sha512.New
+		default:
+			return nil, errors.New("Unsupported PBKDF2 function " + alg.String())
+		}
+
+		return pbkdf2.Key([]byte(passphrase), params.Salt, params.IterationCount, keyLen, prf), nil
+	case kdf.Algorithm.Equal(oidScrypt):
+		var params scryptParams
+		if _, err := asn1.Unmarshal(kdf.Parameters.FullBytes, &params); err != nil {
+			return nil, errors.New("Malformed scrypt parameters: " + err.Error())
+		}
+
+		return scrypt.Key([]byte(passphrase), params.Salt, params.CostParameter, params.BlockSize, params.ParallelizationParameter, keyLen)
+	}
+
+	return nil, errors.New("Unsupported key derivation function " + kdf.Algorithm.String())
+}
+
+// AddWithPassphrase stores the certificate with PKCS#8 encrypted private key
+// as is, and stores the key passphrase separately, encrypted with the secret.
+func (c *CertificateManager) AddWithPassphrase(certData []byte, passphrase, orgID string) (string, error) {
+	return c.AuditedBy("").AddWithPassphrase(certData, passphrase, orgID)
+}
+
+// encodeWithPassphrase is encode for certificates with PKCS#8 encrypted
+// private keys, which are validated decrypted, but stored encrypted.
+func (c *CertificateManager) encodeWithPassphrase(certData []byte, passphrase, orgID string) (string, []byte, error) {
+	if passphrase == "" {
+		return "", nil, errors.New("Private key passphrase is required")
+	}
+
+	var plain, encryptedKey []byte
+	rest := certData
+	for {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+
+		if isPKCS8EncryptedBlock(block) {
+			keyRaw, err := decryptPKCS8(block.Bytes, passphrase)
+			if err != nil {
+				c.logger.Error(err)
+				return "", nil, err
+			}
+
+			encryptedKey = pem.EncodeToMemory(block)
+			block = &pem.Block{Type: "PRIVATE KEY", Bytes: keyRaw}
+		}
+
+		plain = append(plain, pem.EncodeToMemory(block)...)
+	}
+
+	if len(encryptedKey) == 0 {
+		err := errors.New("Certificate should have PKCS#8 encrypted private key")
+		c.logger.Error(err)
+		return "", nil, err
+	}
+
+	certID, certChainPEM, err := c.encode(plain, orgID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Replace private key encrypted with the secret by the original one
+	var out []byte
+	rest = certChainPEM
+	for {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+
+		if isEncryptedPEMBlock(block) {
+			continue
+		}
+		out = append(out, pem.EncodeToMemory(block)...)
+	}
+
+	return certID, append(out, encryptedKey...), nil
+}
+
+func (c *CertificateManager) storePassphrase(certID, passphrase string) error {
+	block, err := c.encryptPEMBlock(passphraseBlock, []byte(passphrase))
+	if err != nil {
+		return err
+	}
+
+	return c.storage.SetKey("passphrase-"+certID, string(pem.EncodeToMemory(block)), 0)
+}
+
+// keyPassphrase returns private key passphrase of the certificate, if any.
+func (c *CertificateManager) keyPassphrase(ctx context.Context, certID string) (string, error) {
+	raw, err := c.getKey(ctx, "passphrase-"+certID)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return "", ctxErr
+	}
+	if err != nil || raw == "" {
+		return "", nil
+	}
+
+	block, _ := pem.Decode([]byte(raw))
+	if block == nil {
+		return "", errors.New("Stored private key passphrase is malformed")
+	}
+
+	if err := decryptPEMBlock(block, c.secret); err != nil {
+		return "", err
+	}
+
+	return string(block.Bytes), nil
+}
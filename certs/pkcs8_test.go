@@ -0,0 +1,122 @@
+package certs
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// encryptPKCS8 encrypts PKCS#8 private key the way OpenSSL does by default.
+func encryptPKCS8(keyPem []byte, passphrase string) []byte {
+	block, _ := pem.Decode(keyPem)
+	key, _ := parsePrivateKey(block.Bytes)
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+
+	salt, iv := make([]byte, 8), make([]byte, aes.BlockSize)
+	rand.Read(salt)
+	rand.Read(iv)
+
+	padding := aes.BlockSize - len(der)%aes.BlockSize
+	for i := 0; i < padding; i++ {
+		der = append(der, byte(padding))
+	}
+
+	aesBlock, _ := aes.NewCipher(pbkdf2.Key([]byte(passphrase), salt, 2048, 32, sha256.New))
+	cipher.NewCBCEncrypter(aesBlock, iv).CryptBlocks(der, der)
+
+	prf := pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue}
+	kdfParams, _ := asn1.Marshal(pbkdf2Params{Salt: salt, IterationCount: 2048, PRF: prf})
+	ivParams, _ := asn1.Marshal(iv)
+	params, _ := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdfParams}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParams}},
+	})
+
+	encrypted, _ := asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}},
+		EncryptedData: der,
+	})
+
+	return pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: encrypted})
+}
+
+func TestAddWithPassphrase(t *testing.T) {
+	storage := newDummyStorage()
+	m := NewCertificateManager(storage, "secret", nil)
+
+	certPem, keyPem := genCertificateFromCommonName("pkcs8")
+	certData := append(certPem, encryptPKCS8(keyPem, "passphrase")...)
+
+	if _, err := m.Add(certData, ""); err == nil {
+		t.Error("Encrypted private key should not be added without passphrase")
+	}
+
+	if _, err := m.AddWithPassphrase(certData, "wrong", ""); err == nil {
+		t.Error("Encrypted private key should not be added with wrong passphrase")
+	}
+
+	certID, err := m.AddWithPassphrase(certData, "passphrase", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if raw := storage.data["raw-"+certID]; !strings.Contains(raw, "ENCRYPTED PRIVATE KEY") || strings.Contains(raw, envelopeHeader) {
+		t.Error("Private key should be stored encrypted with the passphrase", raw)
+	}
+
+	if raw := storage.data["passphrase-"+certID]; !strings.Contains(raw, envelopeHeader) {
+		t.Error("Passphrase should be stored encrypted with the secret", raw)
+	}
+
+	certs := m.List([]string{certID}, CertificatePrivate)
+	if len(certs) != 1 || certs[0] == nil || leafSubjectName(certs[0]) != "pkcs8" {
+		t.Fatal("Certificate with encrypted private key should be loaded")
+	}
+
+	t.Run("Secret rotation", func(t *testing.T) {
+		if _, err := m.RotateSecret("secret", "new", nil); err != nil {
+			t.Fatal(err)
+		}
+
+		if certs := m.List([]string{certID}, CertificatePrivate); len(certs) != 1 || certs[0] == nil {
+			t.Error("Certificate should be loaded after secret rotation")
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		m.Delete(certID)
+		if _, ok := storage.data["passphrase-"+certID]; ok {
+			t.Error("Passphrase should be removed with the certificate")
+		}
+	})
+}
+
+func TestParsePEMEncryptedPKCS8(t *testing.T) {
+	_, keyPem := genCertificateFromCommonName("pkcs8")
+
+	blocks, err := ParsePEM(encryptPKCS8(keyPem, "secret"), "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if blocks[0].Type != "PRIVATE KEY" {
+		t.Error("Wrong block type", blocks[0].Type)
+	}
+
+	if _, err := parsePrivateKey(blocks[0].Bytes); err != nil {
+		t.Error("Decrypted private key should be parsed", err)
+	}
+
+	if _, err := ParsePEM(encryptPKCS8(keyPem, "secret"), "other"); err == nil {
+		t.Error("Private key should not be decrypted with another secret")
+	}
+}
@@ -0,0 +1,118 @@
+package certs
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// KeyPolicy restricts certificates and public keys accepted by Add, to keep
+// weak key material out of the storage. Zero values disable the checks.
+type KeyPolicy struct {
+	// MinRSABits is the minimal size of RSA keys in the chain.
+	MinRSABits int
+	// RejectSHA1 rejects certificates signed with SHA-1. Self signed roots are
+	// allowed, since their signatures are not verified.
+	RejectSHA1 bool
+	// RejectExpired rejects certificates whose leaf is expired or not yet
+	// valid.
+	RejectExpired bool
+	// MaxValidityDays is the longest allowed leaf validity period.
+	MaxValidityDays int
+}
+
+// SetKeyPolicy sets the policy checked by Add. Nil policy disables checks.
+func (c *CertificateManager) SetKeyPolicy(policy *KeyPolicy) {
+	c.mu.Lock()
+	c.keyPolicy = policy
+	c.mu.Unlock()
+}
+
+// SetOrgKeyPolicy overrides the policy for certificates of the organisation.
+// Nil policy removes the override.
+func (c *CertificateManager) SetOrgKeyPolicy(orgID string, policy *KeyPolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if policy == nil {
+		delete(c.orgKeyPolicies, orgID)
+		return
+	}
+
+	if c.orgKeyPolicies == nil {
+		c.orgKeyPolicies = map[string]*KeyPolicy{}
+	}
+	c.orgKeyPolicies[orgID] = policy
+}
+
+func (c *CertificateManager) keyPolicyFor(orgID string) *KeyPolicy {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if policy, found := c.orgKeyPolicies[orgID]; found {
+		return policy
+	}
+
+	return c.keyPolicy
+}
+
+// CheckChain checks the certificate chain, ordered from the leaf.
+func (p *KeyPolicy) CheckChain(chain []*x509.Certificate) error {
+	for i, cert := range chain {
+		if err := p.CheckPublicKey(cert.PublicKey); err != nil {
+			return errors.New(cert.Subject.String() + ": " + err.Error())
+		}
+
+		if p.RejectSHA1 && !isSelfSigned(cert) {
+			switch cert.SignatureAlgorithm {
+			case x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+				return errors.New(cert.Subject.String() + ": SHA-1 signatures are not allowed")
+			}
+		}
+
+		if i > 0 {
+			continue
+		}
+
+		if now := time.Now(); p.RejectExpired && (now.After(cert.NotAfter) || now.Before(cert.NotBefore)) {
+			return errors.New("Certificate is expired or not yet valid")
+		}
+
+		if p.MaxValidityDays > 0 && cert.NotAfter.Sub(cert.NotBefore) > time.Duration(p.MaxValidityDays)*24*time.Hour {
+			return errors.New("Certificate validity is longer than " + strconv.Itoa(p.MaxValidityDays) + " days")
+		}
+	}
+
+	return nil
+}
+
+// CheckPublicKey checks the key size.
+func (p *KeyPolicy) CheckPublicKey(key interface{}) error {
+	if rsaKey, ok := key.(*rsa.PublicKey); ok && rsaKey.N.BitLen() < p.MinRSABits {
+		return errors.New("RSA keys should have at least " + strconv.Itoa(p.MinRSABits) + " bits")
+	}
+
+	return nil
+}
+
+// checkKeyPolicy checks certificate blocks, or the public key if there are no
+// certificates, against the policy of the organisation.
+func (c *CertificateManager) checkKeyPolicy(orgID string, certBlocks [][]byte, publicKeyDER []byte) error {
+	policy := c.keyPolicyFor(orgID)
+	if policy == nil {
+		return nil
+	}
+
+	if len(certBlocks) > 0 {
+		return policy.CheckChain(decodeChain(certBlocks))
+	}
+
+	key, err := x509.ParsePKIXPublicKey(publicKeyDER)
+	if err != nil {
+		return err
+	}
+
+	return policy.CheckPublicKey(key)
+}
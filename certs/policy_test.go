@@ -0,0 +1,113 @@
+package certs
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestKeyPolicy(t *testing.T) {
+	m := newManager()
+
+	genWith := func(bits int, sigAlg x509.SignatureAlgorithm, notBefore, notAfter time.Time) []byte {
+		priv, _ := rsa.GenerateKey(rand.Reader, bits)
+		ca, caKey := genSignedCertificate(&x509.Certificate{
+			Subject:  pkix.Name{CommonName: "ca"},
+			IsCA:     true,
+			KeyUsage: x509.KeyUsageCertSign,
+		}, nil, nil)
+
+		tmpl := &x509.Certificate{
+			SerialNumber:       big.NewInt(1),
+			Subject:            pkix.Name{CommonName: "leaf"},
+			NotBefore:          notBefore,
+			NotAfter:           notAfter,
+			SignatureAlgorithm: sigAlg,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &priv.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	}
+
+	now := time.Now()
+	valid := genWith(2048, x509.SHA256WithRSA, now.Add(-time.Hour), now.Add(30*24*time.Hour))
+
+	m.SetKeyPolicy(&KeyPolicy{MinRSABits: 2048, RejectSHA1: true, RejectExpired: true, MaxValidityDays: 90})
+
+	cases := []struct {
+		name string
+		cert []byte
+		ok   bool
+	}{
+		{"Valid", valid, true},
+		{"Weak RSA", genWith(512, x509.SHA256WithRSA, now.Add(-time.Hour), now.Add(time.Hour)), false},
+		{"Expired", genWith(2048, x509.SHA256WithRSA, now.Add(-2*time.Hour), now.Add(-time.Hour)), false},
+		{"Long validity", genWith(2048, x509.SHA256WithRSA, now, now.Add(365*24*time.Hour)), false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := m.Add(tc.cert, "")
+			if tc.ok && err != nil {
+				t.Error("Certificate should be allowed", err)
+			}
+			if !tc.ok && err == nil {
+				t.Error("Certificate should be rejected")
+			}
+		})
+	}
+
+	t.Run("Weak public key", func(t *testing.T) {
+		priv, _ := rsa.GenerateKey(rand.Reader, 512)
+		der, _ := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+		if _, err := m.Add(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), ""); err == nil {
+			t.Error("Weak public key should be rejected")
+		}
+	})
+
+	t.Run("SHA-1", func(t *testing.T) {
+		// SHA-1 certificates can't be signed anymore, so the chain is built
+		// as it would be parsed
+		policy := &KeyPolicy{RejectSHA1: true}
+		ca, _ := genSignedCertificate(&x509.Certificate{
+			Subject:  pkix.Name{CommonName: "ca"},
+			IsCA:     true,
+			KeyUsage: x509.KeyUsageCertSign,
+		}, nil, nil)
+		leaf := &x509.Certificate{
+			Subject:            pkix.Name{CommonName: "sha1"},
+			SignatureAlgorithm: x509.SHA1WithRSA,
+			RawIssuer:          ca.RawSubject,
+		}
+
+		if err := policy.CheckChain([]*x509.Certificate{leaf, ca}); err == nil {
+			t.Error("SHA-1 signed certificate should be rejected")
+		}
+		if err := policy.CheckChain([]*x509.Certificate{ca}); err != nil {
+			t.Error("Self signed root should be allowed", err)
+		}
+	})
+
+	t.Run("Organisation override", func(t *testing.T) {
+		orgID := "5e9d9544a1dcd60001d0ed21"
+		m.SetOrgKeyPolicy(orgID, &KeyPolicy{})
+
+		weak := genWith(512, x509.SHA256WithRSA, now.Add(-time.Hour), now.Add(time.Hour))
+		if _, err := m.Add(weak, orgID); err != nil {
+			t.Error("Organisation policy should override the default", err)
+		}
+
+		m.SetOrgKeyPolicy(orgID, nil)
+		if _, err := m.Add(genWith(512, x509.SHA256WithRSA, now.Add(-time.Hour), now.Add(time.Hour)), orgID); err == nil {
+			t.Error("Default policy should apply after override is removed")
+		}
+	})
+}
@@ -0,0 +1,141 @@
+package certs
+
+import (
+	"context"
+	"time"
+
+	cache "github.com/pmylund/go-cache"
+)
+
+const defaultCacheRefreshInterval = time.Minute
+
+// StartRefresh switches the manager to asynchronous cache refresh. Loaded
+// certificates stay in cache and are reloaded in background on every
+// interval, so List does not read storage for known certificates. If storage
+// is unavailable, the last successfully loaded certificates keep being used.
+func (c *CertificateManager) StartRefresh(interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultCacheRefreshInterval
+	}
+
+	c.mu.Lock()
+	if c.refreshStop != nil {
+		c.mu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	c.refreshStop = stop
+	if c.refreshIDs == nil {
+		c.refreshIDs = map[string]struct{}{}
+	}
+	c.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				c.Refresh()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopRefresh stops background refresh. Cached certificates expire as usual
+// after that.
+func (c *CertificateManager) StopRefresh() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.refreshStop == nil {
+		return
+	}
+
+	close(c.refreshStop)
+	c.refreshStop = nil
+
+	for id := range c.refreshIDs {
+		if cert, found := c.cache.Get(id); found {
+			c.cache.Set(id, cert, cache.DefaultExpiration)
+		}
+	}
+	c.refreshIDs = nil
+}
+
+// Preload loads certificates into cache ahead of the first request using them.
+func (c *CertificateManager) Preload(certIDs []string) {
+	c.PreloadContext(context.Background(), certIDs)
+}
+
+// PreloadContext is Preload which gives up when the context is done. Preloads
+// are not counted in cache metrics.
+func (c *CertificateManager) PreloadContext(ctx context.Context, certIDs []string) error {
+	var missing []string
+	for _, id := range certIDs {
+		if _, found := c.cache.Get(id); !found {
+			missing = append(missing, id)
+		}
+	}
+
+	_, err := c.list(ctx, missing, CertificateAny, false)
+	return err
+}
+
+// Refresh reloads certificates kept in cache by asynchronous refresh. A
+// certificate which can't be loaded is left in cache as is.
+func (c *CertificateManager) Refresh() {
+	c.mu.RLock()
+	ids := make([]string, 0, len(c.refreshIDs))
+	for id := range c.refreshIDs {
+		ids = append(ids, id)
+	}
+	c.mu.RUnlock()
+
+	for _, id := range ids {
+		cert, err := c.load(context.Background(), id)
+		if err != nil {
+			c.logger.Warning("Can't refresh certificate ", id, ", using last loaded version")
+			continue
+		}
+
+		c.mu.RLock()
+		_, tracked := c.refreshIDs[id]
+		c.mu.RUnlock()
+
+		// Certificate could be deleted while it was loading
+		if tracked {
+			c.cache.Set(id, cert, cache.NoExpiration)
+		}
+	}
+}
+
+func (c *CertificateManager) cacheExpiration() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.refreshStop != nil {
+		return cache.NoExpiration
+	}
+
+	return cache.DefaultExpiration
+}
+
+func (c *CertificateManager) trackRefresh(certID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.refreshIDs != nil {
+		c.refreshIDs[certID] = struct{}{}
+	}
+}
+
+func (c *CertificateManager) untrackRefresh(certID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.refreshIDs, certID)
+}
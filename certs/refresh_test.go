@@ -0,0 +1,88 @@
+package certs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCacheRefresh(t *testing.T) {
+	storage := newDummyStorage()
+	m := NewCertificateManager(storage, "test", nil)
+
+	m.StartRefresh(time.Hour)
+	defer m.StopRefresh()
+
+	certPem, _ := genCertificateFromCommonName("refresh")
+	certID, _ := m.Add(certPem, "")
+
+	m.Preload([]string{certID})
+	if _, found := m.cache.Get(certID); !found {
+		t.Fatal("Preloaded certificate should be cached")
+	}
+
+	if _, tracked := m.refreshIDs[certID]; !tracked {
+		t.Fatal("Preloaded certificate should be refreshed")
+	}
+
+	t.Run("Storage failure", func(t *testing.T) {
+		raw := storage.data["raw-"+certID]
+		delete(storage.data, "raw-"+certID)
+		defer func() { storage.data["raw-"+certID] = raw }()
+
+		m.Refresh()
+
+		certs := m.List([]string{certID}, CertificatePublic)
+		if len(certs) != 1 || leafSubjectName(certs[0]) != "refresh" {
+			t.Error("Last loaded certificate should be used")
+		}
+	})
+
+	t.Run("Storage update", func(t *testing.T) {
+		newPem, _ := genCertificateFromCommonName("updated")
+		storage.data["raw-"+certID] = string(newPem)
+
+		m.Refresh()
+
+		certs := m.List([]string{certID}, CertificatePublic)
+		if len(certs) != 1 || leafSubjectName(certs[0]) != "updated" {
+			t.Error("Certificate should be reloaded from storage")
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		m.Delete(certID)
+		m.Refresh()
+
+		if certs := m.List([]string{certID}, CertificateAny); len(certs) != 1 || certs[0] != nil {
+			t.Error("Deleted certificate should not be refreshed")
+		}
+	})
+}
+
+func TestPreload(t *testing.T) {
+	m := newManager()
+
+	certPem, _ := genCertificateFromCommonName("preload")
+	certID, _ := m.Add(certPem, "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := m.PreloadContext(ctx, []string{certID}); !errors.Is(err, context.Canceled) {
+		t.Error("Preload should not start with cancelled context", err)
+	}
+	if _, found := m.cache.Get(certID); found {
+		t.Error("Certificate should not be cached")
+	}
+
+	if err := m.PreloadContext(context.Background(), []string{certID}); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := m.cache.Get(certID); !found {
+		t.Error("Preloaded certificate should be cached")
+	}
+	if metrics := m.Metrics(); metrics.CacheMisses != 0 || metrics.CacheHits != 0 {
+		t.Error("Preload should not be counted in cache metrics", metrics)
+	}
+}
@@ -0,0 +1,162 @@
+package certs
+
+import (
+	"encoding/pem"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// rotateBatchSize is the number of entries re-encrypted between progress
+// reports.
+const rotateBatchSize = 100
+
+// RotationProgress reports progress of RotateSecret.
+type RotationProgress struct {
+	Total   int `json:"total"`
+	Rotated int `json:"rotated"`
+	// Skipped entries have no encrypted keys, or are already encrypted with
+	// the new secret, e.g. by an interrupted rotation.
+	Skipped int `json:"skipped"`
+	// Failed entries can't be decrypted with either secret.
+	Failed []string `json:"failed,omitempty"`
+}
+
+// Done returns the number of processed entries.
+func (p RotationProgress) Done() int {
+	return p.Rotated + p.Skipped + len(p.Failed)
+}
+
+// RotateSecret re-encrypts private keys of all stored certificates and
+// certificate requests, and private key passphrases, with the new secret, and starts using it. Entries are
+// processed in batches, and progress is called after each one. Rotation can
+// be safely repeated if interrupted.
+func (c *CertificateManager) RotateSecret(oldSecret, newSecret string, progress func(RotationProgress)) (RotationProgress, error) {
+	var result RotationProgress
+
+	if newSecret == "" || newSecret == oldSecret {
+		return result, errors.New("New secret should be set, and differ from the old one")
+	}
+
+	var keys []string
+	for _, id := range c.ListAllIds("") {
+		keys = append(keys, "raw-"+id)
+	}
+	keys = append(keys, c.storage.GetKeys("csr-*")...)
+	keys = append(keys, c.storage.GetKeys("passphrase-*")...)
+	// Soft deleted certificates should stay restorable
+	keys = append(keys, c.storage.GetKeys(deletedPrefix+"raw-*")...)
+	keys = append(keys, c.storage.GetKeys(deletedPrefix+"passphrase-*")...)
+	result.Total = len(keys)
+
+	c.mu.RLock()
+	encryption := c.keyEncryption
+	c.mu.RUnlock()
+
+	for start := 0; start < len(keys); start += rotateBatchSize {
+		end := start + rotateBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		for _, key := range keys[start:end] {
+			rotated, err := c.rotateEntry(key, oldSecret, newSecret, encryption)
+			switch {
+			case err != nil:
+				c.logger.Error("Can't rotate secret of ", key, ": ", err)
+				result.Failed = append(result.Failed, key)
+			case rotated:
+				result.Rotated++
+			default:
+				result.Skipped++
+			}
+		}
+
+		c.logger.Info("Rotated secret of ", result.Done(), " of ", result.Total, " certificates")
+		if progress != nil {
+			progress(result)
+		}
+	}
+
+	c.mu.Lock()
+	c.secret = newSecret
+	c.mu.Unlock()
+	c.cache.Flush()
+
+	if len(result.Failed) > 0 {
+		return result, errors.New("Failed to rotate secret of " + strconv.Itoa(len(result.Failed)) + " entries")
+	}
+
+	return result, nil
+}
+
+// rotateEntry re-encrypts the stored entry, and reports if it was changed.
+func (c *CertificateManager) rotateEntry(key, oldSecret, newSecret string, encryption KeyEncryption) (bool, error) {
+	raw, err := c.storage.GetKey(key)
+	if err != nil {
+		return false, err
+	}
+
+	var out []byte
+	var rotated bool
+
+	rest := []byte(raw)
+	for {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+
+		// PKCS#8 encrypted keys are encrypted with their own passphrase
+		if isEncryptedPEMBlock(block) && !isPKCS8EncryptedBlock(block) {
+			encrypted, plain := *block, *block
+
+			if err := decryptRotatedBlock(&plain, oldSecret); err == nil {
+				if block, err = encryptPEMBlock(plain.Type, plain.Bytes, newSecret, encryption); err != nil {
+					return false, err
+				}
+				rotated = true
+			} else if decryptRotatedBlock(&encrypted, newSecret) != nil {
+				// Entries encrypted with the new secret are left by an
+				// interrupted rotation
+				return false, err
+			}
+		}
+
+		if len(out) > 0 {
+			out = append(out, '\n')
+		}
+		out = append(out, pem.EncodeToMemory(block)...)
+	}
+
+	if !rotated {
+		return false, nil
+	}
+
+	return true, c.storage.SetKey(key, string(out), 0)
+}
+
+// decryptRotatedBlock decrypts the block, and checks that decrypted data is
+// valid, since legacy PEM encryption can't always detect a wrong secret.
+func decryptRotatedBlock(block *pem.Block, secret string) error {
+	if err := decryptPEMBlock(block, secret); err != nil {
+		return err
+	}
+
+	if block.Type == passphraseBlock {
+		return nil
+	}
+
+	if block.Type == keyURIBlock {
+		if !strings.Contains(string(block.Bytes), ":") {
+			return errors.New("Decrypted private key URI is malformed")
+		}
+		return nil
+	}
+
+	if _, err := parsePrivateKey(block.Bytes); err != nil {
+		return errors.New("Decrypted private key is malformed")
+	}
+
+	return nil
+}
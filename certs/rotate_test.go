@@ -0,0 +1,78 @@
+package certs
+
+import (
+	"testing"
+)
+
+func TestRotateSecret(t *testing.T) {
+	storage := newDummyStorage()
+	m := NewCertificateManager(storage, "old", nil)
+
+	var certIDs []string
+	for _, cn := range []string{"first", "second"} {
+		certPem, keyPem := genCertificateFromCommonName(cn)
+		certID, _ := m.Add(append(certPem, keyPem...), "")
+		certIDs = append(certIDs, certID)
+	}
+
+	m.SetKeyEncryption(KeyEncryptionLegacy)
+	legacyPem, legacyKey := genCertificateFromCommonName("legacy")
+	legacyID, _ := m.Add(append(legacyPem, legacyKey...), "")
+	certIDs = append(certIDs, legacyID)
+	m.SetKeyEncryption(KeyEncryptionGCM)
+
+	publicPem, _ := genCertificateFromCommonName("public")
+	publicID, _ := m.Add(publicPem, "")
+
+	csrID, _, err := m.GenerateCSR(GenerateOptions{CommonName: "csr"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.RotateSecret("old", "old", nil); err == nil {
+		t.Error("Secret should be changed")
+	}
+
+	// Simulate interrupted rotation
+	if _, err := m.rotateEntry("raw-"+certIDs[0], "old", "new", KeyEncryptionGCM); err != nil {
+		t.Fatal(err)
+	}
+
+	var reports []RotationProgress
+	result, err := m.RotateSecret("old", "new", func(p RotationProgress) {
+		reports = append(reports, p)
+	})
+	if err != nil {
+		t.Fatal(err, result)
+	}
+
+	if result.Total != 5 || result.Rotated != 3 || result.Skipped != 2 {
+		t.Error("Wrong rotation result", result)
+	}
+
+	if len(reports) != 1 || reports[0].Done() != 5 {
+		t.Error("Progress should be reported", reports)
+	}
+
+	certs := m.List(append(certIDs, publicID), CertificateAny)
+	for i, cert := range certs {
+		if cert == nil {
+			t.Fatal("Certificate should be loaded with new secret", i)
+		}
+	}
+
+	for _, certID := range certIDs {
+		if _, err := ParsePEMCertificate([]byte(storage.data["raw-"+certID]), "new"); err != nil {
+			t.Error("Key should be encrypted with new secret", certID, err)
+		}
+	}
+
+	if _, err := m.GetCSR(csrID); err != nil {
+		t.Error("Certificate request should be rotated", err)
+	}
+
+	// Entries which can't be decrypted are reported
+	if result, err := m.RotateSecret("unknown", "other", nil); err == nil || len(result.Failed) != 4 {
+		t.Error("Failed entries should be reported", result)
+	}
+}
@@ -0,0 +1,129 @@
+package certs
+
+import (
+	"crypto/tls"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxSNIMatches limits cached server names, since clients choose them.
+const maxSNIMatches = 10000
+
+// CertificateSelector picks server certificates from all stored certificates
+// with private keys, by matching SNI against their DNS names, including
+// wildcard names. Index of names is rebuilt when stored certificates change,
+// so new certificates are served without restart.
+type CertificateSelector struct {
+	manager   *CertificateManager
+	defaultID string
+
+	mu      sync.Mutex
+	version int64
+	names   map[string][]string
+	expiry  map[string]time.Time
+	matches map[string]string
+}
+
+// NewCertificateSelector creates selector falling back to the default
+// certificate, if set, for unknown server names.
+func NewCertificateSelector(manager *CertificateManager, defaultID string) *CertificateSelector {
+	return &CertificateSelector{manager: manager, defaultID: defaultID}
+}
+
+// GetCertificate is tls.Config.GetCertificate callback. Nil certificate is
+// returned if no certificate matches and there is no default, so TLS falls
+// back to the config certificates.
+func (s *CertificateSelector) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certID := s.Match(hello.ServerName)
+	if certID == "" {
+		certID = s.defaultID
+	}
+
+	if certID == "" {
+		return nil, nil
+	}
+
+	if certs := s.manager.List([]string{certID}, CertificatePrivate); len(certs) == 1 && certs[0] != nil {
+		return certs[0], nil
+	}
+
+	return nil, nil
+}
+
+// Match returns ID of the certificate for the server name, or empty string.
+// Exact names are preferred to wildcards, and certificates expiring later
+// are preferred otherwise.
+func (s *CertificateSelector) Match(serverName string) string {
+	name := strings.ToLower(strings.TrimSuffix(serverName, "."))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if version := atomic.LoadInt64(&s.manager.changes); s.names == nil || version != s.version {
+		s.build()
+		s.version = version
+	}
+
+	if certID, ok := s.matches[name]; ok {
+		return certID
+	}
+
+	certID := s.latest(s.names[name])
+	if certID == "" {
+		if i := strings.IndexByte(name, '.'); i > 0 {
+			certID = s.latest(s.names["*"+name[i:]])
+		}
+	}
+
+	if len(s.matches) >= maxSNIMatches {
+		s.matches = map[string]string{}
+	}
+	s.matches[name] = certID
+
+	return certID
+}
+
+func (s *CertificateSelector) latest(certIDs []string) (latest string) {
+	for _, certID := range certIDs {
+		if latest == "" || s.expiry[certID].After(s.expiry[latest]) {
+			latest = certID
+		}
+	}
+
+	return latest
+}
+
+// build indexes DNS names of valid stored certificates.
+func (s *CertificateSelector) build() {
+	s.names = map[string][]string{}
+	s.expiry = map[string]time.Time{}
+	s.matches = map[string]string{}
+
+	now := time.Now()
+
+	for _, certID := range s.manager.ListAllIds("") {
+		// List skips certificates of other types, so IDs are listed one by one
+		certs := s.manager.List([]string{certID}, CertificatePrivate)
+		if len(certs) != 1 || certs[0] == nil {
+			continue
+		}
+
+		cert := certs[0]
+		if now.Before(cert.Leaf.NotBefore) || now.After(cert.Leaf.NotAfter) {
+			continue
+		}
+
+		names := cert.Leaf.DNSNames
+		if len(names) == 0 && cert.Leaf.Subject.CommonName != "" {
+			names = []string{cert.Leaf.Subject.CommonName}
+		}
+
+		for _, name := range names {
+			name = strings.ToLower(name)
+			s.names[name] = append(s.names[name], certID)
+		}
+		s.expiry[certID] = cert.Leaf.NotAfter
+	}
+}
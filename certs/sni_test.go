@@ -0,0 +1,71 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+)
+
+func TestCertificateSelector(t *testing.T) {
+	m := newManager()
+
+	add := func(cn string, names ...string) string {
+		certPem, keyPem := genCertificate(&x509.Certificate{Subject: pkix.Name{CommonName: cn}, DNSNames: names})
+		certID, err := m.Add(append(certPem, keyPem...), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return certID
+	}
+
+	wildcardID := add("wildcard", "*.example.com")
+	exactID := add("exact", "api.example.com")
+	cnID := add("cn.example.com")
+
+	certPem, _ := genCertificateFromCommonName("public.example.org")
+	m.Add(certPem, "")
+
+	selector := NewCertificateSelector(m, cnID)
+
+	for _, tc := range []struct {
+		serverName string
+		certID     string
+	}{
+		{"api.example.com", exactID},
+		{"API.example.com.", exactID},
+		{"www.example.com", wildcardID},
+		{"example.com", ""},
+		{"a.b.example.com", ""},
+		{"cn.example.com", cnID},
+		{"public.example.org", ""},
+	} {
+		if certID := selector.Match(tc.serverName); certID != tc.certID {
+			t.Errorf("%s should match %q, got %q", tc.serverName, tc.certID, certID)
+		}
+	}
+
+	cert, err := selector.GetCertificate(&tls.ClientHelloInfo{ServerName: "unknown.org"})
+	if err != nil || cert == nil || leafSubjectName(cert) != "cn.example.com" {
+		t.Error("Default certificate should be served for unknown names", err)
+	}
+
+	t.Run("Index is updated on changes", func(t *testing.T) {
+		newID := add("new", "new.example.org")
+		if certID := selector.Match("new.example.org"); certID != newID {
+			t.Error("Added certificate should be matched", certID)
+		}
+
+		m.Delete(exactID)
+		if certID := selector.Match("api.example.com"); certID != wildcardID {
+			t.Error("Wildcard should be matched after exact certificate removal", certID)
+		}
+	})
+
+	t.Run("No default certificate", func(t *testing.T) {
+		cert, err := NewCertificateSelector(m, "").GetCertificate(&tls.ClientHelloInfo{ServerName: "unknown.org"})
+		if cert != nil || err != nil {
+			t.Error("No certificate should be returned, so TLS falls back to config certificates")
+		}
+	})
+}
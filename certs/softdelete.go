@@ -0,0 +1,199 @@
+package certs
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	deletedPrefix   = "deleted-"
+	deletedAtPrefix = "deleted-at-"
+
+	defaultPurgeInterval = time.Hour
+)
+
+// certificateKeys are storage key prefixes of certificate data, moved aside
+// by soft delete.
+var certificateKeys = []string{"raw-", "tags-", "passphrase-"}
+
+// DeletedCertificate is a soft deleted certificate which can be restored.
+type DeletedCertificate struct {
+	ID        string    `json:"id"`
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+// SetDeleteRetention enables soft delete. Deleted certificates are kept for
+// the retention period, and can be brought back with Restore until they are
+// purged. 0 disables soft delete, and certificates are removed immediately.
+func (c *CertificateManager) SetDeleteRetention(retention time.Duration) {
+	c.mu.Lock()
+	c.deleteRetention = retention
+	c.mu.Unlock()
+}
+
+func (c *CertificateManager) getDeleteRetention() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.deleteRetention
+}
+
+// softDelete keeps copies of the certificate data under deleted- keys, before
+// the certificate is removed.
+func (c *CertificateManager) softDelete(ctx context.Context, certID string) error {
+	if raw, err := c.getKey(ctx, "raw-"+certID); err != nil || raw == "" {
+		return ctx.Err()
+	}
+
+	for _, prefix := range certificateKeys {
+		val, err := c.getKey(ctx, prefix+certID)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil || val == "" {
+			continue
+		}
+
+		if err := c.setKey(ctx, deletedPrefix+prefix+certID, val, 0); err != nil {
+			return err
+		}
+	}
+
+	return c.setKey(ctx, deletedAtPrefix+certID, time.Now().UTC().Format(time.RFC3339), 0)
+}
+
+// Restore brings back a soft deleted certificate, which is not purged yet.
+func (c *CertificateManager) Restore(certID string) error {
+	return c.AuditedBy("").Restore(certID)
+}
+
+func (c *CertificateManager) restore(certID string) error {
+	raw, err := c.storage.GetKey(deletedPrefix + "raw-" + certID)
+	if err != nil || raw == "" {
+		return &CertificateError{CertID: certID, Err: ErrCertNotFound}
+	}
+
+	// Certificate could be added again after it was deleted
+	if existing, err := c.storage.GetKey("raw-" + certID); err == nil && existing != "" {
+		return &CertificateError{CertID: certID, Err: ErrCertExists}
+	}
+
+	for _, prefix := range certificateKeys {
+		val, err := c.storage.GetKey(deletedPrefix + prefix + certID)
+		if err != nil || val == "" {
+			continue
+		}
+
+		if err := c.storage.SetKey(prefix+certID, val, 0); err != nil {
+			return err
+		}
+	}
+
+	c.purge(certID)
+	c.cache.Delete(missingCachePrefix + certID)
+	c.changed(ChangeAdded, certID)
+
+	return nil
+}
+
+// ListDeleted returns soft deleted certificates of the organisation, or of
+// all organisations if orgID is empty, ordered by deletion time.
+func (c *CertificateManager) ListDeleted(orgID string) []DeletedCertificate {
+	retention := c.getDeleteRetention()
+
+	var deleted []DeletedCertificate
+	for _, key := range c.storage.GetKeys(deletedAtPrefix + orgID + "*") {
+		certID := strings.TrimPrefix(key, deletedAtPrefix)
+
+		val, err := c.storage.GetKey(key)
+		if err != nil {
+			continue
+		}
+
+		deletedAt, err := time.Parse(time.RFC3339, val)
+		if err != nil {
+			c.logger.Warning("Malformed deletion time of certificate ", certID, ": ", val)
+			continue
+		}
+
+		deleted = append(deleted, DeletedCertificate{
+			ID:        certID,
+			DeletedAt: deletedAt,
+			PurgeAt:   deletedAt.Add(retention),
+		})
+	}
+
+	sort.Slice(deleted, func(i, j int) bool {
+		return deleted[i].DeletedAt.Before(deleted[j].DeletedAt)
+	})
+
+	return deleted
+}
+
+// Purge permanently removes soft deleted certificates kept longer than the
+// retention period, and returns their IDs.
+func (c *CertificateManager) Purge() (purged []string) {
+	now := time.Now()
+	for _, cert := range c.ListDeleted("") {
+		if now.Before(cert.PurgeAt) {
+			continue
+		}
+
+		c.purge(cert.ID)
+		c.logger.Info("Purged deleted certificate ", cert.ID)
+		purged = append(purged, cert.ID)
+	}
+
+	return purged
+}
+
+func (c *CertificateManager) purge(certID string) {
+	for _, prefix := range certificateKeys {
+		c.storage.DeleteKey(deletedPrefix + prefix + certID)
+	}
+	c.storage.DeleteKey(deletedAtPrefix + certID)
+}
+
+// StartPurge runs Purge on every interval, until StopPurge is called.
+func (c *CertificateManager) StartPurge(interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultPurgeInterval
+	}
+
+	c.mu.Lock()
+	if c.purgeStop != nil {
+		c.mu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	c.purgeStop = stop
+	c.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				c.Purge()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopPurge stops the purge loop.
+func (c *CertificateManager) StopPurge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.purgeStop != nil {
+		close(c.purgeStop)
+		c.purgeStop = nil
+	}
+}
@@ -0,0 +1,84 @@
+package certs
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSoftDelete(t *testing.T) {
+	storage := newDummyStorage()
+	m := NewCertificateManager(storage, "test", nil)
+	m.SetDeleteRetention(time.Hour)
+
+	certPem, _ := genCertificateFromCommonName("soft")
+	certID, _ := m.Add(certPem, "feed")
+	m.SetTags(certID, map[string]string{"env": "prod"})
+
+	m.Delete(certID)
+	if certs := m.List([]string{certID}, CertificateAny); certs[0] != nil {
+		t.Fatal("Deleted certificate should not be listed")
+	}
+
+	deleted := m.ListDeleted("feed")
+	if len(deleted) != 1 || deleted[0].ID != certID || deleted[0].PurgeAt.Sub(deleted[0].DeletedAt) != time.Hour {
+		t.Fatal("Deleted certificate should be listed as deleted", deleted)
+	}
+	if deleted := m.ListDeleted("beef"); len(deleted) != 0 {
+		t.Error("Certificates of other organisations should not be listed", deleted)
+	}
+
+	if err := m.Restore(certID); err != nil {
+		t.Fatal(err)
+	}
+	if certs := m.List([]string{certID}, CertificateAny); certs[0] == nil {
+		t.Error("Restored certificate should be listed")
+	}
+	if tags := m.Tags(certID); tags["env"] != "prod" {
+		t.Error("Tags should be restored", tags)
+	}
+	if len(m.ListDeleted("")) != 0 {
+		t.Error("Restored certificate should not be listed as deleted")
+	}
+	if err := m.Restore(certID); !errors.Is(err, ErrCertNotFound) {
+		t.Error("Restored certificate can't be restored again", err)
+	}
+
+	t.Run("Added again", func(t *testing.T) {
+		m.Delete(certID)
+		m.Add(certPem, "feed")
+
+		if err := m.Restore(certID); !errors.Is(err, ErrCertExists) {
+			t.Error("Restore should not overwrite certificate", err)
+		}
+	})
+
+	t.Run("Purge", func(t *testing.T) {
+		m.Delete(certID)
+
+		if purged := m.Purge(); len(purged) != 0 {
+			t.Error("Certificate should be kept for the retention period", purged)
+		}
+
+		m.SetDeleteRetention(time.Nanosecond)
+		if purged := m.Purge(); len(purged) != 1 || purged[0] != certID {
+			t.Error("Certificate should be purged after the retention period", purged)
+		}
+		if err := m.Restore(certID); !errors.Is(err, ErrCertNotFound) {
+			t.Error("Purged certificate can't be restored", err)
+		}
+		if len(storage.data) != 0 {
+			t.Error("Purge should remove all data", storage.data)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		m.SetDeleteRetention(0)
+		certID, _ := m.Add(certPem, "feed")
+		m.Delete(certID)
+
+		if err := m.Restore(certID); !errors.Is(err, ErrCertNotFound) {
+			t.Error("Certificate should be removed immediately", err)
+		}
+	})
+}
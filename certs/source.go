@@ -0,0 +1,111 @@
+package certs
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// CertificateSource provides certificates addressed by references other than
+// stored certificate IDs, e.g. cloud provider resource names. List tries
+// sources matching the reference in order, falling back to the next one when
+// the fetch fails. References not matched by any source are stored
+// certificate IDs or file paths.
+type CertificateSource interface {
+	// Match reports if the source handles the reference.
+	Match(ref string) bool
+	// Fetch returns PEM encoded certificate chain. Private key can be included
+	// either as PEM block, or as KEY URI block resolved by registered KeyLoader.
+	Fetch(ref string) ([]byte, error)
+}
+
+// fileScheme prefixes file paths, e.g. "file:///etc/tyk/cert.pem". Paths
+// without it are used as well.
+const fileScheme = "file://"
+
+var (
+	schemeSourcesMu sync.RWMutex
+	schemeSources   = map[string]CertificateSource{}
+)
+
+// RegisterSource registers source for references with the scheme, e.g.
+// "vault" for "vault://pki/issue/web", in every certificate manager. Sources
+// of the manager are tried first. Used by plugins adding new backends.
+func RegisterSource(scheme string, source CertificateSource) {
+	schemeSourcesMu.Lock()
+	schemeSources[scheme] = source
+	schemeSourcesMu.Unlock()
+}
+
+// AddSource registers certificate source.
+func (c *CertificateManager) AddSource(source CertificateSource) {
+	c.mu.Lock()
+	c.sources = append(c.sources, source)
+	c.mu.Unlock()
+}
+
+// sourcesFor returns sources matching the reference in order they are tried.
+func (c *CertificateManager) sourcesFor(ref string) (out []CertificateSource) {
+	c.mu.RLock()
+	for _, source := range c.sources {
+		if source.Match(ref) {
+			out = append(out, source)
+		}
+	}
+	c.mu.RUnlock()
+
+	if i := strings.Index(ref, "://"); i > 0 {
+		schemeSourcesMu.RLock()
+		source, ok := schemeSources[ref[:i]]
+		schemeSourcesMu.RUnlock()
+
+		if ok && source.Match(ref) {
+			out = append(out, source)
+		}
+	}
+
+	return out
+}
+
+// fetchFromSources fetches the reference from the first source which
+// succeeds. Error of the last source is returned if all fail.
+func (c *CertificateManager) fetchFromSources(ctx context.Context, ref string, sources []CertificateSource) (rawCert []byte, err error) {
+	for i, source := range sources {
+		if rawCert, err = fetchSource(ctx, source, ref); err == nil || ctx.Err() != nil {
+			return rawCert, err
+		}
+
+		if i < len(sources)-1 {
+			c.logger.Warning("Can't fetch certificate ", ref, " from source, trying next one: ", err)
+		}
+	}
+
+	return nil, err
+}
+
+func (c *CertificateManager) trackSourceRef(ref string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.sourceRefs == nil {
+		c.sourceRefs = map[string]struct{}{}
+	}
+	c.sourceRefs[ref] = struct{}{}
+}
+
+// InvalidateSource drops cached certificates fetched from the source, so they
+// are fetched again on next use. Used when the source rotates certificates.
+func (c *CertificateManager) InvalidateSource(source CertificateSource) {
+	c.mu.RLock()
+	var refs []string
+	for ref := range c.sourceRefs {
+		if source.Match(ref) {
+			refs = append(refs, ref)
+		}
+	}
+	c.mu.RUnlock()
+
+	for _, ref := range refs {
+		c.Invalidate(ref)
+	}
+}
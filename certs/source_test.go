@@ -0,0 +1,80 @@
+package certs
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type staticSource struct {
+	prefix string
+	data   []byte
+	err    error
+	calls  int
+}
+
+func (s *staticSource) Match(ref string) bool {
+	return len(ref) >= len(s.prefix) && ref[:len(s.prefix)] == s.prefix
+}
+
+func (s *staticSource) Fetch(ref string) ([]byte, error) {
+	s.calls++
+	return s.data, s.err
+}
+
+func TestCertificateSources(t *testing.T) {
+	certPem, keyPem := genCertificateFromCommonName("source")
+
+	t.Run("Fallback", func(t *testing.T) {
+		failing := &staticSource{prefix: "test://", err: errors.New("unavailable")}
+		working := &staticSource{prefix: "test://", data: append(certPem, keyPem...)}
+		unused := &staticSource{prefix: "test://", err: errors.New("unused")}
+
+		m := newManager()
+		m.AddSource(failing)
+		m.AddSource(working)
+		m.AddSource(unused)
+
+		certs := m.List([]string{"test://cert"}, CertificatePrivate)
+		if len(certs) != 1 || certs[0] == nil || leafSubjectName(certs[0]) != "source" {
+			t.Fatal("Certificate should be fetched from the next source")
+		}
+
+		if failing.calls != 1 || working.calls != 1 || unused.calls != 0 {
+			t.Error("Sources should be tried in order until one succeeds", failing.calls, working.calls, unused.calls)
+		}
+	})
+
+	t.Run("Registered scheme", func(t *testing.T) {
+		RegisterSource("plugin", &staticSource{prefix: "plugin://", data: certPem})
+
+		managerSource := &staticSource{prefix: "plugin://own", data: certPem}
+		m := newManager()
+		m.AddSource(managerSource)
+
+		certs := m.List([]string{"plugin://cert", "plugin://own"}, CertificatePublic)
+		if len(certs) != 2 || certs[0] == nil || certs[1] == nil {
+			t.Fatal("Certificates should be fetched from registered source")
+		}
+
+		if managerSource.calls != 1 {
+			t.Error("Sources of the manager should be tried first")
+		}
+	})
+
+	t.Run("File scheme", func(t *testing.T) {
+		dir, _ := ioutil.TempDir("", "certs")
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "cert.pem")
+		ioutil.WriteFile(path, certPem, 0600)
+
+		m := newManager()
+		certs := m.List([]string{"file://" + path}, CertificatePublic)
+		if len(certs) != 1 || certs[0] == nil || leafSubjectName(certs[0]) != "source" {
+			t.Error("Certificate should be read from the file")
+		}
+	})
+}
@@ -0,0 +1,331 @@
+package certs
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Messages of the SPIFFE Workload API, from workload.proto. Only X.509 SVID
+// fields used by the gateway are declared.
+type x509SVIDRequest struct{}
+
+func (m *x509SVIDRequest) Reset()         { *m = x509SVIDRequest{} }
+func (m *x509SVIDRequest) String() string { return proto.CompactTextString(m) }
+func (*x509SVIDRequest) ProtoMessage()    {}
+
+type x509SVIDResponse struct {
+	Svids []*x509SVID `protobuf:"bytes,1,rep,name=svids,proto3"`
+}
+
+func (m *x509SVIDResponse) Reset()         { *m = x509SVIDResponse{} }
+func (m *x509SVIDResponse) String() string { return proto.CompactTextString(m) }
+func (*x509SVIDResponse) ProtoMessage()    {}
+
+type x509SVID struct {
+	SpiffeId    string `protobuf:"bytes,1,opt,name=spiffe_id,json=spiffeId,proto3"`
+	X509Svid    []byte `protobuf:"bytes,2,opt,name=x509_svid,json=x509Svid,proto3"`
+	X509SvidKey []byte `protobuf:"bytes,3,opt,name=x509_svid_key,json=x509SvidKey,proto3"`
+	Bundle      []byte `protobuf:"bytes,4,opt,name=bundle,proto3"`
+}
+
+func (m *x509SVID) Reset()         { *m = x509SVID{} }
+func (m *x509SVID) String() string { return proto.CompactTextString(m) }
+func (*x509SVID) ProtoMessage()    {}
+
+const (
+	spiffeFetchX509SVID   = "/SpiffeWorkloadAPI/FetchX509SVID"
+	spiffeSecurityHeader  = "workload.spiffe.io"
+	spiffeMaxRetryBackoff = 30 * time.Second
+)
+
+// svid is X.509 SVID with PEM encoded chain and private key.
+type svid struct {
+	id  string
+	pem []byte
+}
+
+// SPIFFESource fetches X.509 SVIDs and trust bundle from SPIFFE Workload API,
+// and keeps them updated as the agent rotates them.
+//
+// SVIDs are referenced as "spiffe" for the default SVID of the workload, or by
+// SPIFFE ID.
+type SPIFFESource struct {
+	socketPath string
+	logger     *logrus.Entry
+
+	mu       sync.RWMutex
+	svids    []svid
+	bundle   []*x509.Certificate
+	handlers []func()
+	cancel   context.CancelFunc
+}
+
+// NewSPIFFESource creates source using Workload API at the unix socket. Empty
+// path is read from SPIFFE_ENDPOINT_SOCKET.
+func NewSPIFFESource(socketPath string, logger *logrus.Logger) *SPIFFESource {
+	if socketPath == "" {
+		socketPath = os.Getenv("SPIFFE_ENDPOINT_SOCKET")
+	}
+
+	if logger == nil {
+		logger = logrus.New()
+	}
+
+	return &SPIFFESource{
+		socketPath: strings.TrimPrefix(socketPath, "unix://"),
+		logger:     logger.WithFields(logrus.Fields{"prefix": "spiffe"}),
+	}
+}
+
+func (s *SPIFFESource) Match(ref string) bool {
+	return ref == "spiffe" || strings.HasPrefix(ref, "spiffe://")
+}
+
+func (s *SPIFFESource) Fetch(ref string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for i, svid := range s.svids {
+		// The first SVID is the default one
+		if (ref == "spiffe" && i == 0) || svid.id == ref {
+			return svid.pem, nil
+		}
+	}
+
+	return nil, errors.New("SVID not found: " + ref)
+}
+
+// Bundle returns the trust bundle certificates of the workload trust domain.
+func (s *SPIFFESource) Bundle() []*x509.Certificate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.bundle
+}
+
+// OnUpdate registers handler called when SVIDs are rotated.
+func (s *SPIFFESource) OnUpdate(handler func()) {
+	s.mu.Lock()
+	s.handlers = append(s.handlers, handler)
+	s.mu.Unlock()
+}
+
+// Start keeps streaming SVID updates from Workload API until Stop is
+// called, reconnecting on errors.
+func (s *SPIFFESource) Start() {
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	go func() {
+		backoff := time.Second
+		for {
+			err := s.watch(ctx, func() { backoff = time.Second })
+			if ctx.Err() != nil {
+				return
+			}
+
+			s.logger.Warning("Workload API stream failed, reconnecting in ", backoff, ": ", err)
+
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return
+			}
+
+			if backoff *= 2; backoff > spiffeMaxRetryBackoff {
+				backoff = spiffeMaxRetryBackoff
+			}
+		}
+	}()
+}
+
+func (s *SPIFFESource) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+}
+
+func (s *SPIFFESource) watch(ctx context.Context, received func()) error {
+	conn, err := grpc.Dial(s.socketPath,
+		grpc.WithInsecure(),
+		grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
+			return net.DialTimeout("unix", addr, timeout)
+		}),
+	)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx = metadata.AppendToOutgoingContext(ctx, spiffeSecurityHeader, "true")
+	stream, err := grpc.NewClientStream(ctx, &grpc.StreamDesc{StreamName: "FetchX509SVID", ServerStreams: true}, conn, spiffeFetchX509SVID)
+	if err != nil {
+		return err
+	}
+
+	if err := stream.SendMsg(&x509SVIDRequest{}); err != nil {
+		return err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+
+	for {
+		resp := &x509SVIDResponse{}
+		if err := stream.RecvMsg(resp); err != nil {
+			return err
+		}
+
+		if err := s.update(resp); err != nil {
+			s.logger.Error("Can't use SVIDs from Workload API: ", err)
+			continue
+		}
+		received()
+	}
+}
+
+func (s *SPIFFESource) update(resp *x509SVIDResponse) error {
+	if len(resp.Svids) == 0 {
+		return errors.New("no SVIDs received")
+	}
+
+	var svids []svid
+	var bundle []*x509.Certificate
+
+	for i, item := range resp.Svids {
+		chain, err := x509.ParseCertificates(item.X509Svid)
+		if err != nil || len(chain) == 0 {
+			return errors.New("malformed SVID " + item.SpiffeId)
+		}
+
+		if _, err := x509.ParsePKCS8PrivateKey(item.X509SvidKey); err != nil {
+			return errors.New("malformed SVID key " + item.SpiffeId)
+		}
+
+		var data []byte
+		for _, cert := range chain {
+			data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+		}
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: item.X509SvidKey})...)
+
+		svids = append(svids, svid{id: item.SpiffeId, pem: data})
+
+		// Bundle of the default SVID trust domain
+		if i == 0 {
+			if bundle, err = x509.ParseCertificates(item.Bundle); err != nil {
+				return errors.New("malformed trust bundle of " + item.SpiffeId)
+			}
+		}
+	}
+
+	s.mu.Lock()
+	s.svids = svids
+	s.bundle = bundle
+	handlers := s.handlers
+	s.mu.Unlock()
+
+	s.logger.Info("Received SVIDs: ", len(svids))
+
+	for _, handler := range handlers {
+		handler()
+	}
+
+	return nil
+}
+
+// SPIFFEID returns the SPIFFE ID of X.509 SVID, which is its only URI SAN.
+func SPIFFEID(cert *x509.Certificate) (*url.URL, error) {
+	if len(cert.URIs) != 1 || cert.URIs[0].Scheme != "spiffe" || cert.URIs[0].Host == "" {
+		return nil, errors.New("Certificate is not a SPIFFE SVID")
+	}
+
+	if cert.IsCA {
+		return nil, errors.New("SVID should not be a CA certificate")
+	}
+
+	return cert.URIs[0], nil
+}
+
+// matchSPIFFEID checks the ID against allowed trust domains, like
+// "spiffe://example.org", and IDs, which may contain * wildcards.
+func matchSPIFFEID(id *url.URL, allowed []string) bool {
+	for _, pattern := range allowed {
+		if !strings.HasPrefix(pattern, "spiffe://") {
+			pattern = "spiffe://" + pattern
+		}
+
+		patternURL, err := url.Parse(pattern)
+		if err != nil {
+			continue
+		}
+
+		if patternURL.Path == "" || patternURL.Path == "/" {
+			if strings.EqualFold(patternURL.Host, id.Host) {
+				return true
+			}
+			continue
+		}
+
+		if wildcardMatch(pattern, id.String()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// verifySPIFFE checks that the client SVID is issued by the trust bundle,
+// and its SPIFFE ID is allowed.
+func verifySPIFFE(leaf *x509.Certificate, peerIntermediates []*x509.Certificate, opts ValidationOptions) error {
+	id, err := SPIFFEID(leaf)
+	if err != nil {
+		return err
+	}
+
+	if !matchSPIFFEID(id, opts.SPIFFEIDs) {
+		return errors.New("SPIFFE ID " + id.String() + " is not allowed")
+	}
+
+	verifyOpts := x509.VerifyOptions{
+		Roots:         x509.NewCertPool(),
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	for _, cert := range opts.SPIFFEBundle {
+		verifyOpts.Roots.AddCert(cert)
+	}
+
+	for _, cert := range peerIntermediates {
+		verifyOpts.Intermediates.AddCert(cert)
+	}
+
+	if _, err := leaf.Verify(verifyOpts); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package certs
+
+import (
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func genSVID(id string, ca *x509.Certificate, caKey *rsa.PrivateKey) (*x509.Certificate, *x509SVID) {
+	uri, _ := url.Parse(id)
+	cert, key := genSignedCertificate(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "workload"},
+		URIs:        []*url.URL{uri},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(key)
+
+	return cert, &x509SVID{SpiffeId: id, X509Svid: cert.Raw, X509SvidKey: keyDER, Bundle: ca.Raw}
+}
+
+func TestSPIFFESource(t *testing.T) {
+	ca, caKey := genSignedCertificate(&x509.Certificate{
+		Subject:  pkix.Name{CommonName: "example.org"},
+		IsCA:     true,
+		KeyUsage: x509.KeyUsageCertSign,
+	}, nil, nil)
+
+	firstCert, first := genSVID("spiffe://example.org/payments", ca, caKey)
+	_, rotated := genSVID("spiffe://example.org/payments", ca, caKey)
+
+	dir, _ := ioutil.TempDir("", "spiffe")
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "agent.sock")
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotate := make(chan struct{})
+	server := grpc.NewServer()
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "SpiffeWorkloadAPI",
+		HandlerType: (*interface{})(nil),
+		Streams: []grpc.StreamDesc{{
+			StreamName:    "FetchX509SVID",
+			ServerStreams: true,
+			Handler: func(_ interface{}, stream grpc.ServerStream) error {
+				md, _ := metadata.FromIncomingContext(stream.Context())
+				if len(md[spiffeSecurityHeader]) == 0 {
+					t.Error("Security header should be sent")
+				}
+
+				if err := stream.RecvMsg(&x509SVIDRequest{}); err != nil {
+					return err
+				}
+
+				stream.SendMsg(&x509SVIDResponse{Svids: []*x509SVID{first}})
+				<-rotate
+				stream.SendMsg(&x509SVIDResponse{Svids: []*x509SVID{rotated}})
+				<-stream.Context().Done()
+				return nil
+			},
+		}},
+	}, struct{}{})
+	go server.Serve(listener)
+	defer server.Stop()
+
+	source := NewSPIFFESource("unix://"+socketPath, nil)
+	updates := make(chan struct{}, 2)
+	source.OnUpdate(func() { updates <- struct{}{} })
+	source.Start()
+	defer source.Stop()
+
+	waitUpdate := func() {
+		select {
+		case <-updates:
+		case <-time.After(5 * time.Second):
+			t.Fatal("SVIDs should be received")
+		}
+	}
+	waitUpdate()
+
+	m := newManager()
+	m.AddSource(source)
+
+	serial := func() string {
+		certs := m.List([]string{"spiffe"}, CertificatePrivate)
+		if len(certs) != 1 || certs[0] == nil {
+			t.Fatal("Default SVID should be listed with private key")
+		}
+		return certs[0].Leaf.SerialNumber.String()
+	}
+
+	if serial() != firstCert.SerialNumber.String() {
+		t.Error("Should use received SVID")
+	}
+
+	if certs := m.List([]string{"spiffe://example.org/payments"}, CertificatePrivate); len(certs) != 1 || certs[0] == nil {
+		t.Error("SVID should be listed by SPIFFE ID")
+	}
+
+	close(rotate)
+	waitUpdate()
+	m.InvalidateSource(source)
+
+	if serial() == firstCert.SerialNumber.String() {
+		t.Error("Should use rotated SVID")
+	}
+
+	t.Run("Client validation", func(t *testing.T) {
+		otherCA, otherCAKey := genSignedCertificate(&x509.Certificate{
+			Subject:  pkix.Name{CommonName: "other"},
+			IsCA:     true,
+			KeyUsage: x509.KeyUsageCertSign,
+		}, nil, nil)
+		untrusted, _ := genSVID("spiffe://example.org/payments", otherCA, otherCAKey)
+
+		request := func(cert *x509.Certificate) *http.Request {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+			return r
+		}
+
+		tests := []struct {
+			name    string
+			cert    *x509.Certificate
+			allowed []string
+			valid   bool
+		}{
+			{"Allowed ID", firstCert, []string{"spiffe://example.org/billing", "spiffe://example.org/payments"}, true},
+			{"Trust domain", firstCert, []string{"example.org"}, true},
+			{"Path wildcard", firstCert, []string{"spiffe://example.org/pay*"}, true},
+			{"Not allowed ID", firstCert, []string{"spiffe://example.org/billing/*"}, false},
+			{"Other trust domain", firstCert, []string{"spiffe://example.com"}, false},
+			{"Untrusted issuer", untrusted, []string{"example.org"}, false},
+			{"Not SVID", ca, []string{"example.org"}, false},
+		}
+
+		for _, tc := range tests {
+			t.Run(tc.name, func(t *testing.T) {
+				opts := ValidationOptions{SPIFFEIDs: tc.allowed, SPIFFEBundle: source.Bundle()}
+				err := m.ValidateRequestCertificateWithOptions(nil, request(tc.cert), opts)
+				if tc.valid && err != nil {
+					t.Error("Should be valid", err)
+				}
+
+				if !tc.valid && err == nil {
+					t.Error("Should be rejected")
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,101 @@
+package certs
+
+import (
+	"crypto/x509"
+	"strings"
+)
+
+// SubjectRule matches client certificate subject and subject alternative
+// names. All set fields should match, and values may contain * wildcards
+// matching any characters. Matching is case insensitive.
+type SubjectRule struct {
+	CommonName         string
+	Organization       string
+	OrganizationalUnit string
+	// SAN matches any DNS name, email address, URI or IP address.
+	SAN string
+}
+
+// Match checks if the certificate satisfies the rule.
+func (r *SubjectRule) Match(cert *x509.Certificate) bool {
+	if r.CommonName != "" && !wildcardMatch(r.CommonName, cert.Subject.CommonName) {
+		return false
+	}
+
+	if r.Organization != "" && !matchAny(r.Organization, cert.Subject.Organization) {
+		return false
+	}
+
+	if r.OrganizationalUnit != "" && !matchAny(r.OrganizationalUnit, cert.Subject.OrganizationalUnit) {
+		return false
+	}
+
+	if r.SAN != "" {
+		sans := append(append([]string{}, cert.DNSNames...), cert.EmailAddresses...)
+		for _, uri := range cert.URIs {
+			sans = append(sans, uri.String())
+		}
+		for _, ip := range cert.IPAddresses {
+			sans = append(sans, ip.String())
+		}
+
+		if !matchAny(r.SAN, sans) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func matchAny(pattern string, values []string) bool {
+	for _, value := range values {
+		if wildcardMatch(pattern, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// wildcardMatch reports whether value matches pattern, where * matches any
+// sequence of characters.
+func wildcardMatch(pattern, value string) bool {
+	pattern, value = strings.ToLower(pattern), strings.ToLower(value)
+
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(value, part)
+		if i == -1 {
+			return false
+		}
+		value = value[i+len(part):]
+	}
+
+	return len(value) >= len(last) && strings.HasSuffix(value, last)
+}
+
+// matchSubjectRules checks the certificate against the rules, any of which
+// should match. No rules match all certificates.
+func matchSubjectRules(cert *x509.Certificate, rules []SubjectRule) bool {
+	if len(rules) == 0 {
+		return true
+	}
+
+	for i := range rules {
+		if rules[i].Match(cert) {
+			return true
+		}
+	}
+
+	return false
+}
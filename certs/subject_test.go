@@ -0,0 +1,72 @@
+package certs
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/url"
+	"testing"
+)
+
+func TestWildcardMatch(t *testing.T) {
+	tests := []struct {
+		pattern, value string
+		match          bool
+	}{
+		{"payments", "payments", true},
+		{"payments", "Payments", true},
+		{"payments", "payments-eu", false},
+		{"*", "anything", true},
+		{"*.example.com", "api.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"api-*-eu", "api-payments-eu", true},
+		{"api-*-eu", "api-payments-us", false},
+		{"a*b*c", "abc", true},
+		{"a*b*c", "acb", false},
+		{"ab*ba", "aba", false},
+	}
+
+	for _, tc := range tests {
+		if got := wildcardMatch(tc.pattern, tc.value); got != tc.match {
+			t.Errorf("wildcardMatch(%q, %q) = %v", tc.pattern, tc.value, got)
+		}
+	}
+}
+
+func TestSubjectRule(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://example.com/payments")
+	cert := &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:         "client",
+			Organization:       []string{"Example"},
+			OrganizationalUnit: []string{"payments", "eu"},
+		},
+		EmailAddresses: []string{"client@example.com"},
+		IPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+		URIs:           []*url.URL{spiffe},
+	}
+
+	tests := []struct {
+		name  string
+		rule  SubjectRule
+		match bool
+	}{
+		{"Empty", SubjectRule{}, true},
+		{"Common name", SubjectRule{CommonName: "client"}, true},
+		{"Any OU", SubjectRule{OrganizationalUnit: "eu"}, true},
+		{"All fields", SubjectRule{CommonName: "cl*", Organization: "example", OrganizationalUnit: "payments"}, true},
+		{"One field mismatch", SubjectRule{Organization: "Other", OrganizationalUnit: "payments"}, false},
+		{"Email SAN", SubjectRule{SAN: "*@example.com"}, true},
+		{"IP SAN", SubjectRule{SAN: "10.0.0.*"}, true},
+		{"URI SAN", SubjectRule{SAN: "spiffe://example.com/*"}, true},
+		{"SAN mismatch", SubjectRule{SAN: "*.example.com"}, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.rule.Match(cert); got != tc.match {
+				t.Errorf("Match = %v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package certs
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// SetTags stores user defined tags, like environment or team, for the
+// certificate. Tags replace previously set ones.
+func (c *CertificateManager) SetTags(certID string, tags map[string]string) error {
+	if len(tags) == 0 {
+		c.storage.DeleteKey("tags-" + certID)
+		return nil
+	}
+
+	data, err := json.Marshal(tags)
+	if err != nil {
+		return err
+	}
+
+	if err := c.storage.SetKey("tags-"+certID, string(data), 0); err != nil {
+		c.logger.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// Tags returns tags set for the certificate.
+func (c *CertificateManager) Tags(certID string) map[string]string {
+	data, err := c.storage.GetKey("tags-" + certID)
+	if err != nil || data == "" {
+		return nil
+	}
+
+	var tags map[string]string
+	if err := json.Unmarshal([]byte(data), &tags); err != nil {
+		c.logger.Error("Can't decode certificate tags: ", certID, " ", err)
+		return nil
+	}
+
+	return tags
+}
+
+// CertificateMeta returns certificate meta information with its tags.
+func (c *CertificateManager) CertificateMeta(cert *tls.Certificate, certID string) *CertificateMeta {
+	meta := ExtractCertificateMeta(cert, certID)
+	meta.Tags = c.Tags(certID)
+
+	return meta
+}
+
+// CertificateQuery filters certificates in Search. Empty fields match all
+// certificates.
+type CertificateQuery struct {
+	OrgID string
+	// Tags should all be set on the certificate with the same values.
+	Tags map[string]string
+	// CommonName is matched case insensitively against subject common name.
+	CommonName string
+	// DNSName is matched case insensitively against certificate DNS names.
+	DNSName string
+	// ExpiresAfter and ExpiresBefore limit certificate NotAfter.
+	ExpiresAfter  time.Time
+	ExpiresBefore time.Time
+}
+
+func (q *CertificateQuery) match(meta *CertificateMeta) bool {
+	for key, value := range q.Tags {
+		if v, ok := meta.Tags[key]; !ok || v != value {
+			return false
+		}
+	}
+
+	if q.CommonName != "" && !strings.EqualFold(meta.Subject.CommonName, q.CommonName) {
+		return false
+	}
+
+	if q.DNSName != "" {
+		found := false
+		for _, name := range meta.DNSNames {
+			if strings.EqualFold(name, q.DNSName) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	if !q.ExpiresAfter.IsZero() && !meta.NotAfter.After(q.ExpiresAfter) {
+		return false
+	}
+
+	if !q.ExpiresBefore.IsZero() && !meta.NotAfter.Before(q.ExpiresBefore) {
+		return false
+	}
+
+	return true
+}
+
+// Search returns meta information of stored certificates matching the query.
+func (c *CertificateManager) Search(q CertificateQuery) (out []*CertificateMeta) {
+	certIDs := c.listOrgIds(q.OrgID)
+
+	for i, cert := range c.List(certIDs, CertificateAny) {
+		if cert == nil {
+			continue
+		}
+
+		meta := c.CertificateMeta(cert, certIDs[i])
+		if q.match(meta) {
+			out = append(out, meta)
+		}
+	}
+
+	return out
+}
+
+// ListByTag returns IDs of certificates with the tag set to the value.
+func (c *CertificateManager) ListByTag(key, value string) (out []string) {
+	for _, meta := range c.Search(CertificateQuery{Tags: map[string]string{key: value}}) {
+		out = append(out, meta.ID)
+	}
+
+	return out
+}
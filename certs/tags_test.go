@@ -0,0 +1,74 @@
+package certs
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+)
+
+func TestCertificateSearch(t *testing.T) {
+	m := newManager()
+
+	prodPem, _ := genCertificate(&x509.Certificate{
+		Subject:  pkix.Name{CommonName: "prod"},
+		DNSNames: []string{"api.example.com"},
+	})
+	devPem, _ := genCertificateFromCommonName("dev")
+
+	prodID, _ := m.Add(prodPem, "")
+	devID, _ := m.Add(devPem, "")
+
+	m.SetTags(prodID, map[string]string{"env": "prod", "team": "core"})
+	m.SetTags(devID, map[string]string{"env": "dev", "team": "core"})
+
+	if tags := m.Tags(prodID); tags["env"] != "prod" || tags["team"] != "core" {
+		t.Error("Tags should be stored", tags)
+	}
+
+	// genCertificate issues certificates valid for an hour
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		query  CertificateQuery
+		expect []string
+	}{
+		{"All", CertificateQuery{}, []string{prodID, devID}},
+		{"Tag", CertificateQuery{Tags: map[string]string{"env": "prod"}}, []string{prodID}},
+		{"Multiple tags", CertificateQuery{Tags: map[string]string{"env": "dev", "team": "core"}}, []string{devID}},
+		{"Unknown tag", CertificateQuery{Tags: map[string]string{"env": "test"}}, nil},
+		{"Common name", CertificateQuery{CommonName: "PROD"}, []string{prodID}},
+		{"DNS name", CertificateQuery{DNSName: "api.example.com"}, []string{prodID}},
+		{"Expires before", CertificateQuery{ExpiresBefore: now.Add(2 * time.Hour)}, []string{prodID, devID}},
+		{"Expires after", CertificateQuery{ExpiresAfter: now.Add(2 * time.Hour)}, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			found := map[string]bool{}
+			for _, meta := range m.Search(tc.query) {
+				found[meta.ID] = true
+			}
+
+			if len(found) != len(tc.expect) {
+				t.Fatal("Wrong number of certificates", found)
+			}
+
+			for _, id := range tc.expect {
+				if !found[id] {
+					t.Error("Certificate should be found", id)
+				}
+			}
+		})
+	}
+
+	if ids := m.ListByTag("team", "core"); len(ids) != 2 {
+		t.Error("Should list certificates by tag", ids)
+	}
+
+	m.Delete(prodID)
+	if tags := m.Tags(prodID); tags != nil {
+		t.Error("Tags should be removed with certificate", tags)
+	}
+}
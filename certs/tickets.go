@@ -0,0 +1,181 @@
+package certs
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	sessionTicketKeysKey   = "session-ticket-keys"
+	sessionTicketKeysBlock = "SESSION TICKET KEYS"
+
+	// maxSessionTicketKeys is the number of keys kept, so tickets issued with
+	// the previous keys can still be resumed after rotation.
+	maxSessionTicketKeys = 3
+
+	defaultTicketRotationInterval = 24 * time.Hour
+	defaultTicketCheckInterval    = time.Minute
+)
+
+type sessionTicketKey struct {
+	Key     [32]byte  `json:"key"`
+	Created time.Time `json:"created"`
+}
+
+// SessionTicketKeys keeps TLS session ticket keys in the certificate
+// storage, encrypted with the certificate secret, so all gateways sharing the
+// storage issue and accept the same tickets. Whichever gateway first finds
+// the newest key older than the rotation interval adds a new key.
+type SessionTicketKeys struct {
+	manager  *CertificateManager
+	interval time.Duration
+	now      func() time.Time
+
+	mu   sync.RWMutex
+	keys []sessionTicketKey
+	stop chan struct{}
+}
+
+// NewSessionTicketKeys creates keys rotated with the interval, daily by
+// default.
+func NewSessionTicketKeys(manager *CertificateManager, interval time.Duration) *SessionTicketKeys {
+	if interval <= 0 {
+		interval = defaultTicketRotationInterval
+	}
+
+	return &SessionTicketKeys{manager: manager, interval: interval, now: time.Now}
+}
+
+// Keys returns the current keys for tls.Config.SetSessionTicketKeys, newest
+// first. Keys are empty until loaded by Rotate.
+func (s *SessionTicketKeys) Keys() [][32]byte {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([][32]byte, len(s.keys))
+	for i, key := range s.keys {
+		keys[i] = key.Key
+	}
+
+	return keys
+}
+
+// Rotate loads stored keys, and adds a new key if the newest one is due for
+// rotation. Keys which can't be decrypted, e.g. after secret rotation, are
+// replaced.
+func (s *SessionTicketKeys) Rotate() error {
+	keys, err := s.load()
+	if err != nil {
+		s.manager.logger.Warning("Can't load session ticket keys, generating new ones: ", err)
+		keys = nil
+	}
+
+	if len(keys) == 0 || s.now().Sub(keys[0].Created) >= s.interval {
+		newKey := sessionTicketKey{Created: s.now()}
+		if _, err := rand.Read(newKey.Key[:]); err != nil {
+			return err
+		}
+
+		keys = append([]sessionTicketKey{newKey}, keys...)
+		if len(keys) > maxSessionTicketKeys {
+			keys = keys[:maxSessionTicketKeys]
+		}
+
+		if err := s.save(keys); err != nil {
+			return err
+		}
+		s.manager.logger.Info("Rotated session ticket keys")
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *SessionTicketKeys) load() ([]sessionTicketKey, error) {
+	raw, err := s.manager.storage.GetKey(sessionTicketKeysKey)
+	if err != nil || raw == "" {
+		// Keys are not generated yet
+		return nil, nil
+	}
+
+	block, _ := pem.Decode([]byte(raw))
+	if block == nil || !isEncryptedPEMBlock(block) {
+		return nil, errors.New("Stored session ticket keys are malformed")
+	}
+
+	if err := decryptPEMBlock(block, s.manager.secret); err != nil {
+		return nil, err
+	}
+
+	var keys []sessionTicketKey
+	if err := json.Unmarshal(block.Bytes, &keys); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (s *SessionTicketKeys) save(keys []sessionTicketKey) error {
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+
+	block, err := encryptPEMBlock(sessionTicketKeysBlock, data, s.manager.secret, KeyEncryptionGCM)
+	if err != nil {
+		return err
+	}
+
+	return s.manager.storage.SetKey(sessionTicketKeysKey, string(pem.EncodeToMemory(block)), 0)
+}
+
+// Start rotates keys and checks for keys rotated by other gateways every
+// check interval, every minute by default.
+func (s *SessionTicketKeys) Start(checkInterval time.Duration) {
+	if checkInterval <= 0 {
+		checkInterval = defaultTicketCheckInterval
+	}
+
+	s.mu.Lock()
+	if s.stop != nil {
+		s.mu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	s.stop = stop
+	s.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := s.Rotate(); err != nil {
+				s.manager.logger.Error("Can't rotate session ticket keys: ", err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func (s *SessionTicketKeys) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+}
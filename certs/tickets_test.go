@@ -0,0 +1,60 @@
+package certs
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionTicketKeys(t *testing.T) {
+	storage := newDummyStorage()
+	first := NewSessionTicketKeys(NewCertificateManager(storage, "secret", nil), time.Hour)
+	second := NewSessionTicketKeys(NewCertificateManager(storage, "secret", nil), time.Hour)
+
+	now := time.Now()
+	first.now = func() time.Time { return now }
+	second.now = first.now
+
+	if err := first.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	second.Rotate()
+
+	if raw := storage.data[sessionTicketKeysKey]; !strings.Contains(raw, envelopeHeader) {
+		t.Fatal("Session ticket keys should be stored encrypted", raw)
+	}
+
+	keys := first.Keys()
+	if len(keys) != 1 || second.Keys()[0] != keys[0] {
+		t.Fatal("Gateways should share session ticket keys")
+	}
+
+	// Keys are rotated by whichever gateway checks first
+	for i := 1; i <= maxSessionTicketKeys; i++ {
+		now = now.Add(time.Hour)
+		second.Rotate()
+	}
+	first.Rotate()
+
+	rotated := first.Keys()
+	if len(rotated) != maxSessionTicketKeys || rotated[0] != second.Keys()[0] {
+		t.Fatal("Rotated keys should be shared", len(rotated))
+	}
+
+	for _, key := range rotated {
+		if key == keys[0] {
+			t.Error("Oldest key should be removed")
+		}
+	}
+
+	t.Run("Keys encrypted with another secret", func(t *testing.T) {
+		other := NewSessionTicketKeys(NewCertificateManager(storage, "other", nil), time.Hour)
+		if err := other.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+
+		if keys := other.Keys(); len(keys) != 1 || keys[0] == rotated[0] {
+			t.Error("Undecryptable keys should be replaced")
+		}
+	})
+}
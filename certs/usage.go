@@ -0,0 +1,32 @@
+package certs
+
+// CertificateUsage describes a place where certificate is referenced.
+type CertificateUsage struct {
+	// Type is either "api" or "global" for gateway configuration.
+	Type string `json:"type"`
+	// ID is the API ID for API references.
+	ID string `json:"id,omitempty"`
+	// Field is the name of the API definition or configuration field.
+	Field string `json:"field"`
+}
+
+// SetUsages replaces the index of certificate references, keyed by
+// certificate ID. It should be updated whenever configuration is reloaded.
+func (c *CertificateManager) SetUsages(usages map[string][]CertificateUsage) {
+	c.mu.Lock()
+	c.usages = usages
+	c.mu.Unlock()
+}
+
+// Usages returns places where the certificate is referenced.
+func (c *CertificateManager) Usages(certID string) []CertificateUsage {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.usages[certID]
+}
+
+// DeleteUnused removes the certificate, unless it is still referenced.
+func (c *CertificateManager) DeleteUnused(certID string) error {
+	return c.AuditedBy("").DeleteUnused(certID)
+}
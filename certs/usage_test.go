@@ -0,0 +1,34 @@
+package certs
+
+import "testing"
+
+func TestDeleteUnused(t *testing.T) {
+	m := newManager()
+
+	certPem, _ := genCertificateFromCommonName("used")
+	certID, _ := m.Add(certPem, "")
+
+	usage := CertificateUsage{Type: "api", ID: "api1", Field: "certificates"}
+	m.SetUsages(map[string][]CertificateUsage{certID: {usage}})
+
+	if usages := m.Usages(certID); len(usages) != 1 || usages[0] != usage {
+		t.Error("Should return certificate usages", usages)
+	}
+
+	if err := m.DeleteUnused(certID); err == nil {
+		t.Error("Should not delete certificate in use")
+	}
+
+	if raw, _ := m.GetRaw(certID); raw == "" {
+		t.Error("Certificate in use should be kept")
+	}
+
+	m.SetUsages(nil)
+	if err := m.DeleteUnused(certID); err != nil {
+		t.Error("Should delete unused certificate", err)
+	}
+
+	if raw, _ := m.GetRaw(certID); raw != "" {
+		t.Error("Certificate should be removed")
+	}
+}
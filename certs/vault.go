@@ -0,0 +1,310 @@
+package certs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+var errVaultNotFound = errors.New("Not found in Vault")
+
+// vaultClient talks to the Vault HTTP API.
+type vaultClient struct {
+	address string
+	token   string
+	client  *http.Client
+}
+
+func newVaultClient(address, token string) *vaultClient {
+	return &vaultClient{
+		address: strings.TrimSuffix(address, "/"),
+		token:   token,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (v *vaultClient) request(method, path string, body, out interface{}) error {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, v.address+"/v1/"+path, &reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errVaultNotFound
+	case resp.StatusCode >= 300:
+		var vaultErr struct {
+			Errors []string `json:"errors"`
+		}
+		json.NewDecoder(resp.Body).Decode(&vaultErr)
+		return errors.New("Vault error " + resp.Status + ": " + strings.Join(vaultErr.Errors, ", "))
+	case out != nil && resp.StatusCode != http.StatusNoContent:
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+
+	return nil
+}
+
+// VaultStorage is a StorageHandler which keeps certificates in Vault KV
+// version 2 secrets engine, as secrets under the given path.
+type VaultStorage struct {
+	client *vaultClient
+	mount  string
+	path   string
+	logger *logrus.Entry
+}
+
+func NewVaultStorage(address, token, mount, path string, logger *logrus.Logger) *VaultStorage {
+	if logger == nil {
+		logger = logrus.New()
+	}
+
+	if mount == "" {
+		mount = "secret"
+	}
+
+	return &VaultStorage{
+		client: newVaultClient(address, token),
+		mount:  strings.Trim(mount, "/"),
+		path:   strings.Trim(path, "/"),
+		logger: logger.WithFields(logrus.Fields{"prefix": "vault"}),
+	}
+}
+
+func (s *VaultStorage) secretPath(kind, key string) string {
+	if s.path == "" {
+		return s.mount + "/" + kind + "/" + key
+	}
+
+	return s.mount + "/" + kind + "/" + s.path + "/" + key
+}
+
+func (s *VaultStorage) GetKey(key string) (string, error) {
+	var resp struct {
+		Data struct {
+			Data struct {
+				Value string `json:"value"`
+			} `json:"data"`
+		} `json:"data"`
+	}
+
+	if err := s.client.request("GET", s.secretPath("data", key), nil, &resp); err != nil {
+		return "", err
+	}
+
+	return resp.Data.Data.Value, nil
+}
+
+// IsKeyNotFound reports if GetKey failed for the secret not being stored.
+func (s *VaultStorage) IsKeyNotFound(err error) bool {
+	return err == errVaultNotFound
+}
+
+// SetKey stores the value as a new secret version. Expiration is not supported.
+func (s *VaultStorage) SetKey(key, value string, exp int64) error {
+	body := map[string]interface{}{
+		"data": map[string]string{"value": value},
+	}
+
+	return s.client.request("POST", s.secretPath("data", key), body, nil)
+}
+
+// GetKeys returns keys matching the pattern. Only trailing wildcard is supported.
+func (s *VaultStorage) GetKeys(pattern string) (keys []string) {
+	var resp struct {
+		Data struct {
+			Keys []string `json:"keys"`
+		} `json:"data"`
+	}
+
+	path := s.mount + "/metadata"
+	if s.path != "" {
+		path += "/" + s.path
+	}
+
+	if err := s.client.request("GET", path+"?list=true", nil, &resp); err != nil {
+		if err != errVaultNotFound {
+			s.logger.Error("Can't list secrets: ", err)
+		}
+		return nil
+	}
+
+	prefix := strings.TrimSuffix(pattern, "*")
+	for _, key := range resp.Data.Keys {
+		// Sub-paths are not used for keys
+		if strings.HasSuffix(key, "/") {
+			continue
+		}
+
+		if key == pattern || (strings.HasSuffix(pattern, "*") && strings.HasPrefix(key, prefix)) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// DeleteKey removes the secret with all its versions.
+func (s *VaultStorage) DeleteKey(key string) bool {
+	if err := s.client.request("DELETE", s.secretPath("metadata", key), nil, nil); err != nil {
+		s.logger.Error("Can't delete secret: ", err)
+		return false
+	}
+
+	return true
+}
+
+func (s *VaultStorage) DeleteScanMatch(pattern string) bool {
+	deleted := true
+	for _, key := range s.GetKeys(pattern) {
+		deleted = s.DeleteKey(key) && deleted
+	}
+
+	return deleted
+}
+
+// VaultPKI issues certificates using Vault PKI secrets engine role.
+type VaultPKI struct {
+	client *vaultClient
+	mount  string
+	role   string
+	ttl    time.Duration
+}
+
+// NewVaultPKI creates issuer for the PKI role. Zero TTL uses the role default.
+func NewVaultPKI(address, token, mount, role string, ttl time.Duration) *VaultPKI {
+	if mount == "" {
+		mount = "pki"
+	}
+
+	return &VaultPKI{
+		client: newVaultClient(address, token),
+		mount:  strings.Trim(mount, "/"),
+		role:   role,
+		ttl:    ttl,
+	}
+}
+
+// Issue requests a new certificate and returns PEM encoded certificate chain
+// and private key.
+func (p *VaultPKI) Issue(commonName string) ([]byte, error) {
+	body := map[string]string{"common_name": commonName}
+	if p.ttl > 0 {
+		body["ttl"] = strconv.Itoa(int(p.ttl.Seconds())) + "s"
+	}
+
+	return p.client.issue(p.mount+"/issue/"+p.role, body)
+}
+
+// vaultCertificate is the certificate returned by PKI secrets engine, or
+// kept in KV secret in the same format.
+type vaultCertificate struct {
+	Certificate string   `json:"certificate"`
+	CAChain     []string `json:"ca_chain"`
+	PrivateKey  string   `json:"private_key"`
+}
+
+func (c *vaultCertificate) pem() []byte {
+	chain := append([]string{c.Certificate}, c.CAChain...)
+	if c.PrivateKey != "" {
+		chain = append(chain, c.PrivateKey)
+	}
+
+	return []byte(strings.Join(chain, "\n"))
+}
+
+// issue requests a new certificate from PKI issue endpoint, and returns PEM
+// encoded certificate chain and private key.
+func (v *vaultClient) issue(path string, body map[string]string) ([]byte, error) {
+	var resp struct {
+		Data vaultCertificate `json:"data"`
+	}
+
+	if err := v.request("POST", path, body, &resp); err != nil {
+		return nil, err
+	}
+
+	if resp.Data.Certificate == "" || resp.Data.PrivateKey == "" {
+		return nil, errors.New("Vault PKI returned empty certificate")
+	}
+
+	return resp.Data.pem(), nil
+}
+
+// vaultScheme prefixes Vault paths used as certificate references.
+const vaultScheme = "vault://"
+
+// VaultSource provides certificates referenced by Vault path, e.g.
+// "vault://pki/issue/web?common_name=example.com". Paths of PKI issue
+// endpoints issue a new certificate with the query parameters, other paths
+// are read as KV secrets with "certificate", "ca_chain" and "private_key"
+// fields.
+type VaultSource struct {
+	client *vaultClient
+}
+
+func NewVaultSource(address, token string) *VaultSource {
+	return &VaultSource{client: newVaultClient(address, token)}
+}
+
+func (s *VaultSource) Match(ref string) bool {
+	return strings.HasPrefix(ref, vaultScheme)
+}
+
+func (s *VaultSource) Fetch(ref string) ([]byte, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return nil, err
+	}
+	path := strings.Trim(u.Host+u.Path, "/")
+
+	if parts := strings.Split(path, "/"); len(parts) >= 3 && parts[len(parts)-2] == "issue" {
+		body := map[string]string{}
+		for key := range u.Query() {
+			body[key] = u.Query().Get(key)
+		}
+		return s.client.issue(path, body)
+	}
+
+	// KV version 2 secrets are nested in one more data object
+	var resp struct {
+		Data struct {
+			vaultCertificate
+			Data *vaultCertificate `json:"data"`
+		} `json:"data"`
+	}
+	if err := s.client.request("GET", path, nil, &resp); err != nil {
+		return nil, err
+	}
+
+	cert := &resp.Data.vaultCertificate
+	if resp.Data.Data != nil {
+		cert = resp.Data.Data
+	}
+	if cert.Certificate == "" {
+		return nil, errors.New("Vault secret " + path + " has no certificate")
+	}
+
+	return cert.pem(), nil
+}
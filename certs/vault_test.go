@@ -0,0 +1,189 @@
+package certs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeVault implements the subset of KV v2 and PKI API used by certs.
+func fakeVault(t *testing.T, token string, issued func(commonName string) (string, string)) *httptest.Server {
+	var mu sync.Mutex
+	secrets := map[string]string{}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != token {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string][]string{"errors": {"permission denied"}})
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		path := strings.TrimPrefix(r.URL.Path, "/v1/")
+		switch {
+		case strings.HasPrefix(path, "secret/data/tyk/"):
+			key := strings.TrimPrefix(path, "secret/data/tyk/")
+			if r.Method == "POST" {
+				var body struct {
+					Data map[string]string `json:"data"`
+				}
+				json.NewDecoder(r.Body).Decode(&body)
+				secrets[key] = body.Data["value"]
+				return
+			}
+
+			value, ok := secrets[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{"data": map[string]string{"value": value}},
+			})
+		case path == "secret/metadata/tyk" && r.URL.Query().Get("list") == "true":
+			var keys []string
+			for key := range secrets {
+				keys = append(keys, key)
+			}
+			if len(keys) == 0 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string][]string{"keys": keys},
+			})
+		case strings.HasPrefix(path, "secret/metadata/tyk/") && r.Method == "DELETE":
+			delete(secrets, strings.TrimPrefix(path, "secret/metadata/tyk/"))
+			w.WriteHeader(http.StatusNoContent)
+		case path == "pki/issue/gateway" && r.Method == "POST":
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			if body["ttl"] != "60s" {
+				t.Error("Wrong TTL", body["ttl"])
+			}
+
+			cert, key := issued(body["common_name"])
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]string{"certificate": cert, "private_key": key},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestVaultStorage(t *testing.T) {
+	vault := fakeVault(t, "token", nil)
+	defer vault.Close()
+
+	m := NewCertificateManager(NewVaultStorage(vault.URL, "token", "", "tyk", nil), "secret", nil)
+
+	if ids := m.ListAllIds(""); len(ids) != 0 {
+		t.Error("Storage should be empty", ids)
+	}
+
+	certPem, keyPem := genCertificateFromCommonName("vault")
+	certID, err := m.Add(append(certPem, keyPem...), "")
+	if err != nil {
+		t.Fatal("Should add certificate", err)
+	}
+
+	if ids := m.ListAllIds(""); len(ids) != 1 || ids[0] != certID {
+		t.Error("Should list stored certificate", ids)
+	}
+
+	m.cache.Flush()
+	certs := m.List([]string{certID}, CertificatePrivate)
+	if len(certs) != 1 || certs[0] == nil || leafSubjectName(certs[0]) != "vault" {
+		t.Error("Should load certificate from Vault")
+	}
+
+	m.Delete(certID)
+	if ids := m.ListAllIds(""); len(ids) != 0 {
+		t.Error("Certificate should be deleted", ids)
+	}
+
+	t.Run("Invalid token", func(t *testing.T) {
+		m := NewCertificateManager(NewVaultStorage(vault.URL, "invalid", "", "tyk", nil), "secret", nil)
+		if _, err := m.Add(certPem, ""); err == nil {
+			t.Error("Should fail with invalid token")
+		}
+	})
+}
+
+func TestVaultPKIIssue(t *testing.T) {
+	vault := fakeVault(t, "token", func(commonName string) (string, string) {
+		certPem, keyPem := genCertificateFromCommonName(commonName)
+		return string(certPem), string(keyPem)
+	})
+	defer vault.Close()
+
+	m := newManager()
+	if _, err := m.Issue("example.com", ""); err == nil {
+		t.Error("Should fail without issuer")
+	}
+
+	m.SetIssuer(NewVaultPKI(vault.URL, "token", "", "gateway", time.Minute))
+
+	certID, err := m.Issue("example.com", "")
+	if err != nil {
+		t.Fatal("Should issue certificate", err)
+	}
+
+	certs := m.List([]string{certID}, CertificatePrivate)
+	if len(certs) != 1 || certs[0] == nil || leafSubjectName(certs[0]) != "example.com" {
+		t.Error("Issued certificate should be stored with private key")
+	}
+}
+
+func TestVaultSource(t *testing.T) {
+	certPem, keyPem := genCertificateFromCommonName("kv")
+
+	vault := fakeVault(t, "token", func(commonName string) (string, string) {
+		certPem, keyPem := genCertificateFromCommonName(commonName)
+		return string(certPem), string(keyPem)
+	})
+	defer vault.Close()
+
+	kv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cert := map[string]string{"certificate": string(certPem), "private_key": string(keyPem)}
+		switch r.URL.Path {
+		case "/v1/kv/web":
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": cert})
+		case "/v1/secret/data/web":
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"data": cert}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer kv.Close()
+
+	m := newManager()
+	m.AddSource(NewVaultSource(vault.URL, "token"))
+
+	issuedID := "vault://pki/issue/gateway?common_name=source.example.com&ttl=60s"
+	certs := m.List([]string{issuedID}, CertificatePrivate)
+	if len(certs) != 1 || certs[0] == nil || leafSubjectName(certs[0]) != "source.example.com" {
+		t.Error("Certificate should be issued by Vault PKI")
+	}
+
+	m = newManager()
+	m.AddSource(NewVaultSource(kv.URL, "token"))
+
+	for _, ref := range []string{"vault://kv/web", "vault://secret/data/web"} {
+		certs := m.List([]string{ref}, CertificatePrivate)
+		if len(certs) != 1 || certs[0] == nil || leafSubjectName(certs[0]) != "kv" {
+			t.Error("Certificate should be read from Vault secret", ref)
+		}
+	}
+
+	if certs := m.List([]string{"vault://kv/missing"}, CertificateAny); len(certs) != 1 || certs[0] != nil {
+		t.Error("Missing secret should not be listed")
+	}
+}
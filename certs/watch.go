@@ -0,0 +1,62 @@
+package certs
+
+import (
+	"sync/atomic"
+)
+
+// watchBuffer is the number of changes buffered for a watcher, before new
+// changes are dropped.
+const watchBuffer = 100
+
+// Certificate change types
+const (
+	ChangeAdded   = "added"
+	ChangeUpdated = "updated"
+	ChangeDeleted = "deleted"
+)
+
+// CertificateChange reports a stored certificate change. Changes made by
+// other gateways are reported as updates, once their notification is
+// received.
+type CertificateChange struct {
+	Type   string `json:"type"`
+	CertID string `json:"cert_id"`
+}
+
+// Watch returns channel receiving certificate changes until stop is called.
+// Changes are dropped if the watcher falls behind.
+func (c *CertificateManager) Watch() (changes <-chan CertificateChange, stop func()) {
+	ch := make(chan CertificateChange, watchBuffer)
+
+	c.mu.Lock()
+	if c.watchers == nil {
+		c.watchers = map[chan CertificateChange]struct{}{}
+	}
+	c.watchers[ch] = struct{}{}
+	c.mu.Unlock()
+
+	return ch, func() {
+		c.mu.Lock()
+		if _, ok := c.watchers[ch]; ok {
+			delete(c.watchers, ch)
+			close(ch)
+		}
+		c.mu.Unlock()
+	}
+}
+
+// changed records change of the stored certificate, and notifies watchers.
+func (c *CertificateManager) changed(changeType, certID string) {
+	atomic.AddInt64(&c.changes, 1)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for ch := range c.watchers {
+		select {
+		case ch <- CertificateChange{Type: changeType, CertID: certID}:
+		default:
+			c.logger.Warning("Dropped certificate change of ", certID, " for slow watcher")
+		}
+	}
+}
@@ -32,6 +32,7 @@ type Importer struct {
 	bluePrintMode  *bool
 	wsdlMode       *bool
 	portNames      *string
+	restFacade     *bool
 	createAPI      *bool
 	orgID          *string
 	upstreamTarget *string
@@ -52,6 +53,7 @@ func AddTo(app *kingpin.Application) {
 	imp.bluePrintMode = cmd.Flag("blueprint", "Use BluePrint mode").Bool()
 	imp.wsdlMode = cmd.Flag("wsdl", "Use WSDL mode").Bool()
 	imp.portNames = cmd.Flag("port-names", "Specify port name of each service in the WSDL file. Input format is comma separated list of serviceName:portName").String()
+	imp.restFacade = cmd.Flag("rest-facade", "Expose SOAP operations of the WSDL file as endpoints taking and returning JSON").Bool()
 	imp.createAPI = cmd.Flag("create-api", "Creates a new API definition from the blueprint").Bool()
 	imp.orgID = cmd.Flag("org-id", "assign the API Definition to this org_id (required with create-api").String()
 	imp.upstreamTarget = cmd.Flag("upstream-target", "set the upstream target for the definition").PlaceHolder("URL").String()
@@ -248,6 +250,7 @@ func (i *Importer) handleWSDLMode() error {
 	}
 
 	w.SetServicePortMapping(serviceportMapping)
+	w.SetRESTFacade(*i.restFacade)
 
 	if *i.createAPI {
 		//Create new API
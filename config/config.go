@@ -68,6 +68,15 @@ type PoliciesConfig struct {
 	PolicyConnectionString string `json:"policy_connection_string"`
 	PolicyRecordName       string `json:"policy_record_name"`
 	AllowExplicitPolicyID  bool   `json:"allow_explicit_policy_id"`
+
+	// MergeStrategy resolves the limits which several policies of a key
+	// set: "priority" takes them from the policy of the highest priority,
+	// "most_restrictive" from the most restrictive policy. Quota rules
+	// follow the quota. Only quotas and rate limits are merged: access to an
+	// API, like its versions and allowed URLs, comes from the first policy
+	// granting it, the one of the highest priority with "priority". Keys
+	// whose policies conflict are rejected without it.
+	MergeStrategy string `json:"merge_strategy"`
 }
 
 type DBAppConfOptionsConfig struct {
@@ -163,6 +172,15 @@ type SlaveOptionsConfig struct {
 	RPCPoolSize                     int    `json:"rpc_pool_size"`
 }
 
+// KeyUsageConfig configures the tracking of when keys were last used and how
+// many requests they made, with which stale keys can be found.
+type KeyUsageConfig struct {
+	Enabled bool `json:"enabled"`
+	// FlushInterval is how often, in seconds, the usage counted by the
+	// gateway is written to storage. Defaults to 10.
+	FlushInterval int `json:"flush_interval"`
+}
+
 type LocalSessionCacheConf struct {
 	DisableCacheSessionState bool `json:"disable_cached_session_state"`
 	CachedSessionTimeout     int  `json:"cached_session_timeout"`
@@ -170,22 +188,68 @@ type LocalSessionCacheConf struct {
 }
 
 type HttpServerOptionsConfig struct {
-	OverrideDefaults       bool       `json:"override_defaults"`
-	ReadTimeout            int        `json:"read_timeout"`
-	WriteTimeout           int        `json:"write_timeout"`
-	UseSSL                 bool       `json:"use_ssl"`
-	UseLE_SSL              bool       `json:"use_ssl_le"`
-	EnableHttp2            bool       `json:"enable_http2"`
-	SSLInsecureSkipVerify  bool       `json:"ssl_insecure_skip_verify"`
-	EnableWebSockets       bool       `json:"enable_websockets"`
-	Certificates           []CertData `json:"certificates"`
-	SSLCertificates        []string   `json:"ssl_certificates"`
-	ServerName             string     `json:"server_name"`
-	MinVersion             uint16     `json:"min_version"`
-	FlushInterval          int        `json:"flush_interval"`
-	SkipURLCleaning        bool       `json:"skip_url_cleaning"`
-	SkipTargetPathEscaping bool       `json:"skip_target_path_escaping"`
-	Ciphers                []string   `json:"ssl_ciphers"`
+	OverrideDefaults       bool                      `json:"override_defaults"`
+	ReadTimeout            int                       `json:"read_timeout"`
+	WriteTimeout           int                       `json:"write_timeout"`
+	UseSSL                 bool                      `json:"use_ssl"`
+	UseLE_SSL              bool                      `json:"use_ssl_le"`
+	EnableHttp2            bool                      `json:"enable_http2"`
+	SSLInsecureSkipVerify  bool                      `json:"ssl_insecure_skip_verify"`
+	EnableWebSockets       bool                      `json:"enable_websockets"`
+	Certificates           []CertData                `json:"certificates"`
+	SSLCertificates        []string                  `json:"ssl_certificates"`
+	ServerName             string                    `json:"server_name"`
+	MinVersion             uint16                    `json:"min_version"`
+	MaxVersion             uint16                    `json:"max_version"`
+	FlushInterval          int                       `json:"flush_interval"`
+	SkipURLCleaning        bool                      `json:"skip_url_cleaning"`
+	SkipTargetPathEscaping bool                      `json:"skip_target_path_escaping"`
+	Ciphers                []string                  `json:"ssl_ciphers"`
+	Curves                 []string                  `json:"ssl_curves"`
+	TLSPolicies            []PortTLSPolicyConfig     `json:"tls_policies"`
+	ACME                   ACMEConfig                `json:"acme"`
+	DynamicCertificates    DynamicCertificatesConfig `json:"dynamic_certificates"`
+	SessionTicketKeys      SessionTicketKeysConfig   `json:"session_ticket_keys"`
+}
+
+// PortTLSPolicyConfig is TLS policy of the listener on the port, e.g. to
+// allow only TLS 1.3 on the control API port. Policies of APIs with domains
+// are applied on top of it.
+type PortTLSPolicyConfig struct {
+	Port int `json:"port"`
+	apidef.TLSPolicyMeta
+}
+
+// SessionTicketKeysConfig enables TLS session ticket keys shared by all
+// gateways through the certificate storage, so sessions can be resumed on
+// any gateway.
+type SessionTicketKeysConfig struct {
+	Enabled bool `json:"enabled"`
+	// RotationInterval is the number of seconds between key rotations.
+	RotationInterval int `json:"rotation_interval"`
+	// CheckInterval is the number of seconds between checks for keys
+	// rotated by other gateways.
+	CheckInterval int `json:"check_interval"`
+}
+
+// DynamicCertificatesConfig enables serving any stored certificate with a
+// private key, selected by SNI, without listing it in config.
+type DynamicCertificatesConfig struct {
+	Enabled bool `json:"enabled"`
+	// DefaultCertificate is the certificate ID served for unknown names.
+	DefaultCertificate string `json:"default_certificate"`
+}
+
+// ACMEConfig configures automatic provisioning of listener certificates
+// from Let's Encrypt.
+type ACMEConfig struct {
+	Enabled bool     `json:"enabled"`
+	Email   string   `json:"email"`
+	Hosts   []string `json:"hosts"`
+	// RenewBefore is the number of days before expiry to renew a certificate.
+	RenewBefore int `json:"renew_before"`
+	// CheckInterval is the number of seconds between renewal checks.
+	CheckInterval int `json:"check_interval"`
 }
 
 type AuthOverrideConf struct {
@@ -226,10 +290,249 @@ type CertificatesConfig struct {
 }
 
 type SecurityConfig struct {
-	PrivateCertificateEncodingSecret string             `json:"private_certificate_encoding_secret"`
-	ControlAPIUseMutualTLS           bool               `json:"control_api_use_mutual_tls"`
-	PinnedPublicKeys                 map[string]string  `json:"pinned_public_keys"`
-	Certificates                     CertificatesConfig `json:"certificates"`
+	PrivateCertificateEncodingSecret string                           `json:"private_certificate_encoding_secret"`
+	ControlAPIUseMutualTLS           bool                             `json:"control_api_use_mutual_tls"`
+	ControlAPICertificateValidation  apidef.CertificateValidationMeta `json:"control_api_certificate_validation"`
+	PinnedPublicKeys                 map[string]string                `json:"pinned_public_keys"`
+	Certificates                     CertificatesConfig               `json:"certificates"`
+
+	// PrivateKeyEncryption is "aes-gcm" by default, or "legacy" to keep
+	// private keys readable by gateways of previous versions.
+	PrivateKeyEncryption string `json:"private_key_encryption"`
+	// FetchIntermediates completes chains of added certificates with
+	// intermediates downloaded from the issuer URLs of the certificates.
+	FetchIntermediates bool `json:"fetch_intermediates"`
+
+	CertificateKeyPolicy CertificateKeyPolicyConfig `json:"certificate_key_policy"`
+
+	CertificateExpiryMonitor CertificateExpiryMonitorConfig `json:"certificate_expiry_monitor"`
+	CRL                      CRLConfig                      `json:"crl"`
+	OCSP                     OCSPConfig                     `json:"ocsp"`
+	CertificateStorage       CertificateStorageConfig       `json:"certificate_storage"`
+	CertificateSources       CertificateSourcesConfig       `json:"certificate_sources"`
+	CertificateCache         CertificateCacheConfig         `json:"certificate_cache"`
+	CertificateSoftDelete    CertificateSoftDeleteConfig    `json:"certificate_soft_delete"`
+	CertificateTransparency  CertificateTransparencyConfig  `json:"certificate_transparency"`
+	SPIFFE                   SPIFFEConfig                   `json:"spiffe"`
+	CertificateAudit         CertificateAuditConfig         `json:"certificate_audit"`
+	CertificateGRPC          CertificateGRPCConfig          `json:"certificate_grpc"`
+	KubernetesSecrets        KubernetesSecretsConfig        `json:"kubernetes_secrets"`
+	PublishedJWKS            PublishedJWKSConfig            `json:"published_jwks"`
+	JWKSImports              []JWKSImportConfig             `json:"jwks_imports"`
+	// CertificateOrgSecrets are secrets of organisations, by organisation
+	// ID, which let them use the certificate API for their own
+	// certificates only.
+	CertificateOrgSecrets map[string]string `json:"certificate_org_secrets"`
+}
+
+// JWKSImportConfig imports keys of a remote JWKS into the public key storage.
+// JWT APIs with the URL as JWT source validate tokens with the imported keys.
+type JWKSImportConfig struct {
+	URL   string `json:"url"`
+	OrgID string `json:"org_id"`
+	// RefreshInterval is the number of seconds between JWKS polls, 5 minutes
+	// by default.
+	RefreshInterval int `json:"refresh_interval"`
+	// Retention is the number of seconds keys removed from the JWKS are kept,
+	// 1 hour by default.
+	Retention int `json:"retention"`
+}
+
+// KeyPolicyConfig restricts certificates accepted by the certificate API.
+// Zero values disable the checks.
+type KeyPolicyConfig struct {
+	MinRSABits      int  `json:"min_rsa_bits"`
+	RejectSHA1      bool `json:"reject_sha1"`
+	RejectExpired   bool `json:"reject_expired"`
+	MaxValidityDays int  `json:"max_validity_days"`
+}
+
+// CertificateKeyPolicyConfig is the default key policy, with overrides for
+// organisations by organisation ID.
+type CertificateKeyPolicyConfig struct {
+	KeyPolicyConfig
+	Orgs map[string]KeyPolicyConfig `json:"orgs"`
+}
+
+// PublishedJWKSConfig publishes public keys of the certificates as JWKS
+// document at the path, without authentication.
+type PublishedJWKSConfig struct {
+	Path         string   `json:"path"`
+	Certificates []string `json:"certificates"`
+}
+
+// KubernetesSecretsConfig syncs kubernetes.io/tls secrets of the namespaces
+// into the certificate storage, using the in-cluster service account.
+type KubernetesSecretsConfig struct {
+	Enabled    bool     `json:"enabled"`
+	Namespaces []string `json:"namespaces"`
+	// WriteBackNamespace is the namespace where certificates with private
+	// keys added to the gateway are written as secrets. Disabled if empty.
+	WriteBackNamespace string `json:"write_back_namespace"`
+}
+
+// CertificateGRPCConfig enables certificate management over gRPC. Clients
+// authenticate with the node secret in "authorization" metadata.
+type CertificateGRPCConfig struct {
+	Enabled       bool   `json:"enabled"`
+	ListenAddress string `json:"listen_address"`
+	// ServerCertificate is the certificate ID used for TLS. Connections are
+	// not encrypted if empty.
+	ServerCertificate string `json:"server_certificate"`
+}
+
+// CertificateAuditConfig sends audit events of certificate operations and
+// client certificate validation failures to the enabled sinks.
+type CertificateAuditConfig struct {
+	// File appends events to the file as JSON lines.
+	File       string                       `json:"file"`
+	Syslog     CertificateAuditSyslogConfig `json:"syslog"`
+	WebhookURL string                       `json:"webhook_url"`
+}
+
+type CertificateAuditSyslogConfig struct {
+	Enabled bool `json:"enabled"`
+	// Network and Address of remote syslog, local syslog is used if empty.
+	Network string `json:"network"`
+	Address string `json:"address"`
+	Tag     string `json:"tag"`
+}
+
+// SPIFFEConfig enables X.509 SVIDs from SPIFFE Workload API. The default SVID
+// can be used as a certificate with "spiffe" ID, and APIs can allow client
+// SVIDs by SPIFFE ID.
+type SPIFFEConfig struct {
+	Enabled bool `json:"enabled"`
+	// WorkloadAPISocket is the Workload API unix socket, by default read from
+	// SPIFFE_ENDPOINT_SOCKET.
+	WorkloadAPISocket string `json:"workload_api_socket"`
+}
+
+// CertificateTransparencyConfig enables checking that added certificates
+// issued by publicly trusted CAs have signed certificate timestamps.
+type CertificateTransparencyConfig struct {
+	Enabled bool `json:"enabled"`
+	// Enforce rejects certificates failing the check, instead of logging a
+	// warning.
+	Enforce bool `json:"enforce"`
+	MinSCTs int  `json:"min_scts"`
+	// Logs are base64 encoded DER public keys of trusted CT logs, as
+	// published in CT log lists. SCT signatures are verified only if set.
+	Logs []string `json:"logs"`
+}
+
+// CertificateCacheConfig configures caching of loaded certificates.
+type CertificateCacheConfig struct {
+	// AsyncRefresh preloads certificates used by APIs and keeps them cached,
+	// reloading them in background instead of on request. If storage is
+	// unavailable, the last loaded certificates are used.
+	AsyncRefresh bool `json:"async_refresh"`
+	// RefreshInterval is the number of seconds between certificate reloads.
+	RefreshInterval int `json:"refresh_interval"`
+	// WatchFiles reloads certificates referenced by file path when the file
+	// changes on disk.
+	WatchFiles bool `json:"watch_files"`
+	// LoadTimeout is the number of seconds TLS handshakes wait for
+	// certificates to be loaded from storage, sources or files. Certificates
+	// not loaded in time are skipped for the handshake. 0 means no limit.
+	LoadTimeout int `json:"load_timeout"`
+	// Preload loads certificates referenced by API definitions and the
+	// gateway configuration into cache on every API reload, before the new
+	// APIs are served. On startup the gateway doesn't accept connections until
+	// the first preload is done.
+	Preload bool `json:"preload"`
+	// PreloadTimeout is the number of seconds preload may take. Certificates
+	// not loaded in time are loaded on first use. 0 means no limit.
+	PreloadTimeout int `json:"preload_timeout"`
+	// MaxEntries limits the number of cached certificates. Least recently
+	// used certificates are evicted over the limit. 0 means no limit.
+	MaxEntries int `json:"max_entries"`
+	// MaxBytes limits the estimated memory used by cached certificates.
+	// 0 means no limit.
+	MaxBytes int64 `json:"max_bytes"`
+	// NegativeTTL is the number of seconds certificate IDs not found in
+	// storage are remembered as missing, so requests referencing them don't
+	// read storage every time. 0 means 10 seconds, -1 disables it.
+	NegativeTTL int `json:"negative_ttl"`
+}
+
+// CertificateSoftDeleteConfig keeps deleted certificates for a while, so they
+// can be restored with the /tyk/certs/{certID}/restore endpoint.
+type CertificateSoftDeleteConfig struct {
+	// Retention is the number of seconds deleted certificates are kept.
+	// 0 disables soft delete.
+	Retention int `json:"retention"`
+	// PurgeInterval is the number of seconds between removals of deleted
+	// certificates kept for longer than Retention. Defaults to an hour.
+	PurgeInterval int `json:"purge_interval"`
+}
+
+// CertificateSourcesConfig enables certificates referenced by external
+// identifiers instead of stored certificate IDs.
+type CertificateSourcesConfig struct {
+	AWS AWSCertificateSourceConfig `json:"aws"`
+}
+
+// AWSCertificateSourceConfig enables ACM certificate ARNs, and KMS key ARNs as
+// private keys. Credentials default to the standard AWS environment variables.
+type AWSCertificateSourceConfig struct {
+	Enabled         bool   `json:"enabled"`
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+	SessionToken    string `json:"session_token"`
+}
+
+// CertificateStorageConfig configures where certificates are stored.
+type CertificateStorageConfig struct {
+	// Type is either "redis" (default) or "vault".
+	Type  string      `json:"type"`
+	Vault VaultConfig `json:"vault"`
+}
+
+// VaultConfig configures HashiCorp Vault access. Certificates are kept in KV
+// version 2 secrets engine, and can be issued by the PKI secrets engine. APIs
+// can also reference certificates by Vault path, e.g.
+// "vault://pki/issue/web?common_name=example.com".
+type VaultConfig struct {
+	Address string `json:"address"`
+	Token   string `json:"token"`
+	KVMount string `json:"kv_mount"`
+	KVPath  string `json:"kv_path"`
+	// PKIRole enables issuing certificates from Vault PKI with the role.
+	PKIRole  string `json:"pki_role"`
+	PKIMount string `json:"pki_mount"`
+	// PKITTL is the number of seconds issued certificates are valid for.
+	PKITTL int `json:"pki_ttl"`
+}
+
+// OCSPConfig configures usage of OCSP responders of certificate issuers.
+type OCSPConfig struct {
+	// StapleServerCertificates attaches OCSP responses to the server
+	// certificates served by the gateway.
+	StapleServerCertificates bool `json:"staple_server_certificates"`
+	// CheckClientCertificates rejects client certificates reported as revoked
+	// by their OCSP responder.
+	CheckClientCertificates bool `json:"check_client_certificates"`
+}
+
+// CRLConfig configures certificate revocation lists used to reject revoked
+// client certificates. CRLs uploaded via the /tyk/crls endpoint are always used.
+type CRLConfig struct {
+	// Sources are http(s) URLs of CRL distribution points.
+	Sources []string `json:"sources"`
+	// RefreshInterval is the number of seconds between CRL reloads.
+	RefreshInterval int `json:"refresh_interval"`
+}
+
+// CertificateExpiryMonitorConfig configures firing of CertificateExpiringSoon
+// and CertificateExpired system events for stored certificates.
+type CertificateExpiryMonitorConfig struct {
+	Enabled bool `json:"enabled"`
+	// WarningThresholds are numbers of days before expiry at which an event
+	// is fired. Defaults to 30, 7 and 1 days.
+	WarningThresholds []int `json:"warning_thresholds_days"`
+	// CheckInterval is the number of seconds between certificate scans.
+	CheckInterval int `json:"check_interval"`
 }
 
 type NewRelicConfig struct {
@@ -263,6 +566,7 @@ type Config struct {
 	HostName                  string                  `json:"hostname"`
 	ListenAddress             string                  `json:"listen_address"`
 	ListenPort                int                     `json:"listen_port"`
+	TrustedProxies            map[string][]string     `json:"trusted_proxies"`
 	ControlAPIHostname        string                  `json:"control_api_hostname"`
 	ControlAPIPort            int                     `json:"control_api_port"`
 	Secret                    string                  `json:"secret"`
@@ -281,11 +585,13 @@ type Config struct {
 	// Gateway Security Policies
 	HashKeys                bool           `json:"hash_keys"`
 	HashKeyFunction         string         `json:"hash_key_function"`
+	HashKeyVerifier         string         `json:"hash_key_verifier"`
 	EnableHashedKeysListing bool           `json:"enable_hashed_keys_listing"`
 	MinTokenLength          int            `json:"min_token_length"`
 	EnableAPISegregation    bool           `json:"enable_api_segregation"`
 	TemplatePath            string         `json:"template_path"`
 	Policies                PoliciesConfig `json:"policies"`
+	KeyUsage                KeyUsageConfig `json:"key_usage"`
 
 	// CE Configurations
 	AppPath string `json:"app_path"`
@@ -321,6 +627,10 @@ type Config struct {
 	CloseIdleConnections bool  `json:"close_idle_connections"`
 	CloseConnections     bool  `json:"close_connections"`
 	EnableCustomDomains  bool  `json:"enable_custom_domains"`
+	// MaxBufferedRequestBytes caps the size of the request bodies the node
+	// holds in memory at once. Requests which would exceed it are rejected
+	// with 503 Service Unavailable. Zero means no cap.
+	MaxBufferedRequestBytes int64 `json:"max_buffered_request_bytes"`
 	// If AllowMasterKeys is set to true, session objects (key definitions) that do not have explicit access rights set
 	// will be allowed by Tyk. This means that keys that are created have access to ALL APIs, which in many cases is
 	// unwanted behaviour unless you are sure about what you are doing.
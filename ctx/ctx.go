@@ -29,6 +29,14 @@ const (
 	ThrottleLevelLimit
 	Trace
 	CheckLoopLimits
+	UpstreamHost
+	GraphQLAnalysis
+	ConcurrencySlots
+	DPoPThumbprint
+	Retries
+	Mirrored
+	Variant
+	CertificateOrg
 )
 
 func setContext(r *http.Request, ctx context.Context) {
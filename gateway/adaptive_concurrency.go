@@ -0,0 +1,134 @@
+package gateway
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+// hostLimit is the concurrency limit of one upstream host. Samples are
+// evaluated once as many requests as the limit complete, about once per round
+// trip of the upstream.
+type hostLimit struct {
+	limit     float64
+	inFlight  int64
+	saturated bool
+	samples   int64
+	failures  int64
+	latency   time.Duration
+}
+
+// ConcurrencyLimiter adapts the requests in flight to each upstream host with
+// additive increase and multiplicative decrease, as TCP congestion control
+// does.
+type ConcurrencyLimiter struct {
+	conf apidef.AdaptiveConcurrencyMeta
+
+	mu    sync.Mutex
+	hosts map[string]*hostLimit
+}
+
+func NewConcurrencyLimiter(conf apidef.AdaptiveConcurrencyMeta) *ConcurrencyLimiter {
+	if conf.MinLimit <= 0 {
+		conf.MinLimit = 1
+	}
+	if conf.MaxLimit <= 0 {
+		conf.MaxLimit = 1000
+	}
+	if conf.InitialLimit <= 0 {
+		conf.InitialLimit = 20
+	}
+	if conf.ErrorRateThreshold <= 0 {
+		conf.ErrorRateThreshold = 0.1
+	}
+	if conf.Backoff <= 0 || conf.Backoff >= 1 {
+		conf.Backoff = 0.9
+	}
+	if conf.RetryAfter <= 0 {
+		conf.RetryAfter = 1
+	}
+	return &ConcurrencyLimiter{
+		conf:  conf,
+		hosts: make(map[string]*hostLimit),
+	}
+}
+
+func (l *ConcurrencyLimiter) host(host string) *hostLimit {
+	hl := l.hosts[host]
+	if hl == nil {
+		hl = &hostLimit{limit: l.clamp(float64(l.conf.InitialLimit))}
+		l.hosts[host] = hl
+	}
+	return hl
+}
+
+func (l *ConcurrencyLimiter) clamp(limit float64) float64 {
+	return math.Max(float64(l.conf.MinLimit), math.Min(float64(l.conf.MaxLimit), limit))
+}
+
+// Acquire tells whether a request can be sent to host. Every request it lets
+// through must be reported with Done, or Cancel if it is not sent.
+func (l *ConcurrencyLimiter) Acquire(host string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	hl := l.host(host)
+	if hl.inFlight >= int64(hl.limit) {
+		hl.saturated = true
+		return false
+	}
+	hl.inFlight++
+	return true
+}
+
+// Cancel gives back a request which was not sent.
+func (l *ConcurrencyLimiter) Cancel(host string) {
+	l.mu.Lock()
+	l.host(host).inFlight--
+	l.mu.Unlock()
+}
+
+// Done reports the outcome of a request sent to host.
+func (l *ConcurrencyLimiter) Done(host string, failed bool, latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	hl := l.host(host)
+	hl.inFlight--
+	hl.samples++
+	hl.latency += latency
+	if failed {
+		hl.failures++
+	}
+	if hl.samples < int64(hl.limit) {
+		return
+	}
+
+	errorRate := float64(hl.failures) / float64(hl.samples)
+	avgLatency := hl.latency / time.Duration(hl.samples)
+	switch {
+	case errorRate > l.conf.ErrorRateThreshold,
+		l.conf.LatencyThreshold > 0 && avgLatency > time.Duration(l.conf.LatencyThreshold)*time.Millisecond:
+		hl.limit = l.clamp(hl.limit * l.conf.Backoff)
+	case hl.saturated:
+		// The limit only grows while it holds requests back
+		hl.limit = l.clamp(hl.limit + 1)
+	}
+	log.WithField("host", host).Debug("Upstream concurrency limit: ", int64(hl.limit))
+
+	hl.samples, hl.failures, hl.latency, hl.saturated = 0, 0, 0, false
+}
+
+// Limit returns the current concurrency limit of host.
+func (l *ConcurrencyLimiter) Limit(host string) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int64(l.host(host).limit)
+}
+
+// RetryAfter is how many seconds shed requests are told to wait.
+func (l *ConcurrencyLimiter) RetryAfter() int64 {
+	return l.conf.RetryAfter
+}
@@ -0,0 +1,102 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+	l := NewConcurrencyLimiter(apidef.AdaptiveConcurrencyMeta{
+		InitialLimit:     4,
+		MaxLimit:         5,
+		LatencyThreshold: 100,
+		Backoff:          0.5,
+	})
+
+	// A saturated limit grows while the upstream keeps up
+	for i := 0; i < 4; i++ {
+		if !l.Acquire("a") {
+			t.Fatal("Expected requests under the limit to be let through")
+		}
+	}
+	if l.Acquire("a") {
+		t.Fatal("Expected requests over the limit to be shed")
+	}
+	for i := 0; i < 4; i++ {
+		l.Done("a", false, time.Millisecond)
+	}
+	if limit := l.Limit("a"); limit != 5 {
+		t.Errorf("Expected the limit to grow to 5, got %d", limit)
+	}
+
+	// Errors cut it
+	for i := 0; i < 5; i++ {
+		l.Acquire("a")
+		l.Done("a", i == 0, time.Millisecond)
+	}
+	if limit := l.Limit("a"); limit != 2 {
+		t.Errorf("Expected the limit to be cut to 2, got %d", limit)
+	}
+
+	// And so does latency
+	for i := 0; i < 2; i++ {
+		l.Acquire("a")
+		l.Done("a", false, time.Second)
+	}
+	if limit := l.Limit("a"); limit != 1 {
+		t.Errorf("Expected the limit to be cut to 1, got %d", limit)
+	}
+
+	// Hosts have their own limit
+	if limit := l.Limit("b"); limit != 4 {
+		t.Errorf("Expected other hosts to keep the initial limit, got %d", limit)
+	}
+}
+
+func TestAdaptiveConcurrency(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer upstream.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.TargetURL = upstream.URL
+		spec.ConcurrencyLimit.Adaptive = apidef.AdaptiveConcurrencyMeta{
+			Enabled:      true,
+			InitialLimit: 1,
+			RetryAfter:   2,
+		}
+	})
+
+	done := make(chan struct{})
+	go func() {
+		http.Get(ts.URL)
+		close(done)
+	}()
+
+	// Wait for the first request to hold the only slot
+	limiter := getApiSpec("test").ConcurrencyLimiter
+	for i := 0; i < 100 && limiter.Acquire(upstream.Listener.Addr().String()); i++ {
+		limiter.Cancel(upstream.Listener.Addr().String())
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ts.Run(t, test.TestCase{
+		Path: "/", Code: http.StatusServiceUnavailable, HeadersMatch: map[string]string{headers.RetryAfter: "2"},
+	})
+
+	close(release)
+	<-done
+	ts.Run(t, test.TestCase{Path: "/", Code: http.StatusOK})
+}
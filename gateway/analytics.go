@@ -44,14 +44,45 @@ type AnalyticsRecord struct {
 	Tags          []string
 	Alias         string
 	TrackPath     bool
+	GraphQL       GraphQLStats
+	GRPC          GRPCStats
+	Streamed      bool      // Server-Sent Events stream, RequestTime is its duration
+	Retries       int       // Times the request was retried upstream
 	ExpireAt      time.Time `bson:"expireAt" json:"expireAt"`
 }
 
+// GraphQLStats are details of a GraphQL operation. Fields are paths of all
+// fields selected by the operation.
+type GraphQLStats struct {
+	OperationType string
+	OperationName string
+	Depth         int
+	Complexity    int
+	Fields        []string
+}
+
+// GRPCStats are details of a gRPC call. Method is "package.Service/Method",
+// Status is the gRPC status code.
+type GRPCStats struct {
+	Service string
+	Method  string
+	Status  int
+}
+
 type GeoData struct {
+	Continent struct {
+		Code string `maxminddb:"code"`
+	} `maxminddb:"continent"`
+
 	Country struct {
 		ISOCode string `maxminddb:"iso_code"`
 	} `maxminddb:"country"`
 
+	// Subdivisions are the regions of the location, from the largest
+	Subdivisions []struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"subdivisions"`
+
 	City struct {
 		Names map[string]string `maxminddb:"names"`
 	} `maxminddb:"city"`
@@ -86,6 +117,7 @@ func (a *AnalyticsRecord) GetGeo(ipStr string) {
 		return
 	}
 
+	log.Debug("Continent: ", record.Continent.Code)
 	log.Debug("ISO Code: ", record.Country.ISOCode)
 	log.Debug("City: ", record.City.Names["en"])
 	log.Debug("Lat: ", record.Location.Latitude)
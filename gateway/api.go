@@ -49,6 +49,7 @@ import (
 	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/TykTechnologies/tyk/config"
 	"github.com/TykTechnologies/tyk/ctx"
+	"github.com/TykTechnologies/tyk/graphql"
 	"github.com/TykTechnologies/tyk/headers"
 	"github.com/TykTechnologies/tyk/storage"
 	"github.com/TykTechnologies/tyk/user"
@@ -74,6 +75,14 @@ type apiStatusMessage struct {
 	Message string `json:"message"`
 }
 
+// apiValidationError is returned for API definitions which don't pass
+// validation, with a problem per field.
+type apiValidationError struct {
+	Status  string                  `json:"status"`
+	Message string                  `json:"message"`
+	Errors  apidef.ValidationErrors `json:"errors,omitempty"`
+}
+
 func apiOk(msg string) apiStatusMessage {
 	return apiStatusMessage{"ok", msg}
 }
@@ -177,7 +186,9 @@ func checkAndApplyTrialPeriod(keyName, apiId string, newSession *user.SessionSta
 	}
 }
 
-func applyPoliciesAndSave(keyName string, session *user.SessionState, spec *APISpec, isHashed bool) error {
+// applyPoliciesAndSave saves the session, if the stored one is at version
+// unless it's negative.
+func applyPoliciesAndSave(keyName string, session *user.SessionState, spec *APISpec, isHashed bool, version int64) error {
 	// use basic middleware to apply policies to key/session (it also saves it)
 	mw := BaseMiddleware{
 		Spec: spec,
@@ -187,6 +198,9 @@ func applyPoliciesAndSave(keyName string, session *user.SessionState, spec *APIS
 	}
 
 	lifetime := session.Lifetime(spec.SessionLifetime)
+	if version >= 0 {
+		return spec.SessionManager.UpdateSessionIfVersion(keyName, session, version, lifetime, isHashed)
+	}
 	if err := spec.SessionManager.UpdateSession(keyName, session, lifetime, isHashed); err != nil {
 		return err
 	}
@@ -205,11 +219,21 @@ func resetAPILimits(accessRights map[string]user.AccessDefinition) {
 }
 
 func doAddOrUpdate(keyName string, newSession *user.SessionState, dontReset bool, isHashed bool) error {
+	return doAddOrUpdateIfVersion(keyName, newSession, dontReset, isHashed, -1)
+}
+
+// doAddOrUpdateIfVersion saves the session if the stored one is at version,
+// unless it's negative. The session is saved once per API, the first save is
+// checked against version and the next ones against the session saved.
+func doAddOrUpdateIfVersion(keyName string, newSession *user.SessionState, dontReset bool, isHashed bool, version int64) error {
 	// field last_updated plays an important role in in-mem rate limiter
 	// so update last_updated to current timestamp only if suppress_reset wasn't set to 1
 	if !dontReset {
 		newSession.LastUpdated = strconv.Itoa(int(time.Now().Unix()))
 	}
+	if !isHashed {
+		setKeyVerifier(keyName, newSession)
+	}
 
 	if len(newSession.AccessRights) > 0 {
 		// reset API-level limit to nil if any has a zero-value
@@ -241,9 +265,12 @@ func doAddOrUpdate(keyName string, newSession *user.SessionState, dontReset bool
 				}
 
 				// apply polices (if any) and save key
-				if err := applyPoliciesAndSave(keyName, newSession, apiSpec, isHashed); err != nil {
+				if err := applyPoliciesAndSave(keyName, newSession, apiSpec, isHashed, version); err != nil {
 					return err
 				}
+				if version >= 0 {
+					version = newSession.Version
+				}
 			}
 		}
 	} else {
@@ -263,9 +290,12 @@ func doAddOrUpdate(keyName string, newSession *user.SessionState, dontReset bool
 			checkAndApplyTrialPeriod(keyName, spec.APIID, newSession, isHashed)
 
 			// apply polices (if any) and save key
-			if err := applyPoliciesAndSave(keyName, newSession, spec, isHashed); err != nil {
+			if err := applyPoliciesAndSave(keyName, newSession, spec, isHashed, version); err != nil {
 				return err
 			}
+			if version >= 0 {
+				version = newSession.Version
+			}
 		}
 	}
 
@@ -300,6 +330,19 @@ func setSessionPassword(session *user.SessionState) {
 	session.BasicAuthData.Password = string(newPass)
 }
 
+// validateSession checks the settings of a session given to the API.
+func validateSession(session *user.SessionState) error {
+	if err := session.QuotaRules.Validate(); err != nil {
+		return err
+	}
+	for _, ip := range session.AllowedIPs {
+		if _, _, err := parseIPRange(ip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func getKeyDetail(key, apiID string, hashed bool) (user.SessionState, bool) {
 	sessionManager := FallbackKeySesionManager
 	if spec := getApiSpec(apiID); spec != nil {
@@ -323,6 +366,47 @@ func handleAddOrUpdate(keyName string, r *http.Request, isHashed bool) (interfac
 		return apiError("Request malformed"), http.StatusBadRequest
 	}
 
+	version, err := ifMatchVersion(r)
+	if err != nil {
+		return apiError(err.Error()), http.StatusBadRequest
+	}
+	if version != 0 {
+		newSession.Version = version
+	}
+
+	return addOrUpdateKey(keyName, newSession, r.Method, suppressReset, isHashed)
+}
+
+// sessionETag is the entity tag of the version of a session.
+func sessionETag(session user.SessionState) string {
+	return `"` + strconv.FormatInt(session.Version, 10) + `"`
+}
+
+// ifMatchVersion returns the session version the If-Match header of an
+// update expects, or 0 if there is none to check. Sessions stored before they
+// were versioned are at version 0, so they are only checked once updated.
+func ifMatchVersion(r *http.Request) (int64, error) {
+	ifMatch := strings.TrimPrefix(r.Header.Get(headers.IfMatch), "W/")
+	if ifMatch == "" || ifMatch == "*" {
+		return 0, nil
+	}
+
+	version, err := strconv.ParseInt(strings.Trim(ifMatch, `"`), 10, 64)
+	if err != nil || version < 0 {
+		return 0, errors.New("If-Match must be the ETag of the key")
+	}
+	return version, nil
+}
+
+// addOrUpdateKey adds (POST) or updates (PUT) the session of a key. Updates of
+// a session version other than the stored one are rejected, as they would undo
+// the updates since, and so are those of sessions written by another update
+// between their read and their write, on any gateway.
+func addOrUpdateKey(keyName string, newSession user.SessionState, method string, suppressReset, isHashed bool) (interface{}, int) {
+	if err := validateSession(&newSession); err != nil {
+		return apiError(err.Error()), http.StatusBadRequest
+	}
+
 	mw := BaseMiddleware{}
 	mw.ApplyPolicies(&newSession)
 
@@ -330,7 +414,7 @@ func handleAddOrUpdate(keyName string, r *http.Request, isHashed bool) (interfac
 
 	// get original session in case of update and preserve fields that SHOULD NOT be updated
 	originalKey := user.SessionState{}
-	if r.Method == http.MethodPut {
+	if method == http.MethodPut {
 		found := false
 		for apiID := range newSession.AccessRights {
 			originalKey, found = getKeyDetail(keyName, apiID, isHashed)
@@ -343,6 +427,10 @@ func handleAddOrUpdate(keyName string, r *http.Request, isHashed bool) (interfac
 			return apiError("Key is not found"), http.StatusNotFound
 		}
 
+		if newSession.Version != 0 && newSession.Version != originalKey.Version {
+			return apiError("Key was modified by another update, version is " + strconv.FormatInt(originalKey.Version, 10)), http.StatusConflict
+		}
+
 		// don't change fields related to quota and rate limiting if was passed as "suppress_reset=1"
 		if suppressReset {
 			// save existing quota_renews and last_updated if suppress_reset was passed
@@ -373,7 +461,7 @@ func handleAddOrUpdate(keyName string, r *http.Request, isHashed bool) (interfac
 	if newSession.BasicAuthData.Password != "" {
 		// If we are using a basic auth user, then we need to make the keyname explicit against the OrgId in order to differentiate it
 		// Only if it's NEW
-		switch r.Method {
+		switch method {
 		case http.MethodPost:
 			keyName = generateToken(newSession.OrgID, keyName)
 			// It's a create, so lets hash the password
@@ -389,13 +477,27 @@ func handleAddOrUpdate(keyName string, r *http.Request, isHashed bool) (interfac
 		}
 	}
 
-	if err := doAddOrUpdate(keyName, &newSession, suppressReset, isHashed); err != nil {
+	newSession.Version = originalKey.Version + 1
+
+	// The slow hash is never taken from the payload, updates by hash keep
+	// the one of the key they don't know
+	newSession.KeyVerifier = originalKey.KeyVerifier
+
+	// Updates are written if the stored session is still the one read
+	version := int64(-1)
+	if method == http.MethodPut {
+		version = originalKey.Version
+	}
+	if err := doAddOrUpdateIfVersion(keyName, &newSession, suppressReset, isHashed, version); err != nil {
+		if err == errSessionVersionConflict {
+			return apiError("Key was modified by another update"), http.StatusConflict
+		}
 		return apiError("Failed to create key, ensure security settings are correct."), http.StatusInternalServerError
 	}
 
 	action := "modified"
 	event := EventTokenUpdated
-	if r.Method == http.MethodPost {
+	if method == http.MethodPost {
 		action = "added"
 		event = EventTokenCreated
 	}
@@ -412,7 +514,7 @@ func handleAddOrUpdate(keyName string, r *http.Request, isHashed bool) (interfac
 	}
 
 	// add key hash for newly created key
-	if config.Global().HashKeys && r.Method == http.MethodPost {
+	if config.Global().HashKeys && method == http.MethodPost {
 		if isHashed {
 			response.KeyHash = keyName
 		} else {
@@ -501,6 +603,15 @@ func handleGetDetail(sessionKey, apiID string, byHash bool) (interface{}, int) {
 	mw := BaseMiddleware{Spec: spec}
 	mw.ApplyPolicies(&session)
 
+	// Quotas of calendar periods are counted per period
+	if session.QuotaRules.Reset == user.QuotaResetMonthly {
+		keyHash := sessionKey
+		if !byHash {
+			keyHash = storage.HashKey(sessionKey)
+		}
+		setPeriodQuotas(&session, keyHash, sessionManager.Store())
+	}
+
 	log.WithFields(logrus.Fields{
 		"prefix": "api",
 		"key":    obfuscateKey(sessionKey),
@@ -747,6 +858,44 @@ func handleAddOrUpdateApi(apiID string, r *http.Request) (interface{}, int) {
 		return apiError("Request APIID does not match that in Definition! For Updtae operations these must match."), http.StatusBadRequest
 	}
 
+	if obj, code := writeAPIDefinition(newDef); code != http.StatusOK {
+		return obj, code
+	}
+
+	action := "modified"
+	if r.Method == "POST" {
+		action = "added"
+	}
+
+	response := apiModifyKeySuccess{
+		Key:    newDef.APIID,
+		Status: "ok",
+		Action: action,
+	}
+
+	return response, http.StatusOK
+}
+
+// writeAPIDefinition validates an API definition and writes it to the app
+// path, replacing the file of an API with the same ID. On failure it returns
+// the response to send.
+func writeAPIDefinition(newDef *apidef.APIDefinition) (interface{}, int) {
+	if err := newDef.Validate(); err != nil {
+		log.Error("Rejected invalid API Definition: ", err)
+
+		response := apiValidationError{
+			Status:  "error",
+			Message: "Invalid API Definition",
+		}
+		if errs, ok := err.(apidef.ValidationErrors); ok {
+			response.Errors = errs
+		} else {
+			response.Message += ": " + err.Error()
+		}
+
+		return response, http.StatusBadRequest
+	}
+
 	// Create a filename
 	defFilePath := filepath.Join(config.Global().AppPath, newDef.APIID+".json")
 
@@ -768,18 +917,7 @@ func handleAddOrUpdateApi(apiID string, r *http.Request) (interface{}, int) {
 		return apiError("File object creation failed, write error"), http.StatusInternalServerError
 	}
 
-	action := "modified"
-	if r.Method == "POST" {
-		action = "added"
-	}
-
-	response := apiModifyKeySuccess{
-		Key:    newDef.APIID,
-		Status: "ok",
-		Action: action,
-	}
-
-	return response, http.StatusOK
+	return nil, http.StatusOK
 }
 
 func handleDeleteAPI(apiID string) (interface{}, int) {
@@ -862,7 +1000,7 @@ func keyHandler(w http.ResponseWriter, r *http.Request) {
 		obj, code = handleAddOrUpdate(keyName, r, isHashed)
 	case http.MethodPut:
 		obj, code = handleAddOrUpdate(keyName, r, isHashed)
-		if code != http.StatusOK && hashKeyFunction != "" {
+		if code != http.StatusOK && code != http.StatusConflict && hashKeyFunction != "" {
 			// try to use legacy key format
 			obj, code = handleAddOrUpdate(origKeyName, r, isHashed)
 		}
@@ -874,6 +1012,9 @@ func keyHandler(w http.ResponseWriter, r *http.Request) {
 				// try to use legacy key format
 				obj, code = handleGetDetail(origKeyName, apiID, isHashed)
 			}
+			if session, ok := obj.(user.SessionState); ok {
+				w.Header().Set(headers.ETag, sessionETag(session))
+			}
 		} else {
 			// Return list of keys
 			if config.Global().HashKeys {
@@ -955,8 +1096,12 @@ func handleUpdateHashedKey(keyName, apiID, policyId string) (interface{}, int) {
 	// Set the policy
 	sess.LastUpdated = strconv.Itoa(int(time.Now().Unix()))
 	sess.SetPolicies(policyId)
+	sess.Version++
 
-	err := sessionManager.UpdateSession(keyName, &sess, 0, true)
+	err := sessionManager.UpdateSessionIfVersion(keyName, &sess, sess.Version-1, 0, true)
+	if err == errSessionVersionConflict {
+		return apiError("Key was modified by another update"), http.StatusConflict
+	}
 	if err != nil {
 		log.WithFields(logrus.Fields{
 			"prefix": "api",
@@ -1193,6 +1338,19 @@ func resetHandler(fn func()) http.HandlerFunc {
 	}
 }
 
+// generateSessionKey generates the key of a new session, and its HMAC secret
+// if it signs requests.
+func generateSessionKey(session *user.SessionState) string {
+	if session.HMACEnabled {
+		session.HmacSecret = keyGen.GenerateHMACSecret()
+	}
+
+	if session.Certificate != "" {
+		return generateToken(session.OrgID, session.Certificate)
+	}
+	return keyGen.GenerateAuthKey(session.OrgID)
+}
+
 func createKeyHandler(w http.ResponseWriter, r *http.Request) {
 	newSession := new(user.SessionState)
 	if err := json.NewDecoder(r.Body).Decode(newSession); err != nil {
@@ -1204,15 +1362,16 @@ func createKeyHandler(w http.ResponseWriter, r *http.Request) {
 		doJSONWrite(w, http.StatusInternalServerError, apiError("Unmarshalling failed"))
 		return
 	}
-
-	newKey := keyGen.GenerateAuthKey(newSession.OrgID)
-	if newSession.HMACEnabled {
-		newSession.HmacSecret = keyGen.GenerateHMACSecret()
+	if err := validateSession(newSession); err != nil {
+		doJSONWrite(w, http.StatusBadRequest, apiError(err.Error()))
+		return
 	}
 
-	if newSession.Certificate != "" {
-		newKey = generateToken(newSession.OrgID, newSession.Certificate)
-	}
+	newKey := generateSessionKey(newSession)
+	newSession.Version = 1
+
+	newSession.KeyVerifier = ""
+	setKeyVerifier(newKey, newSession)
 
 	newSession.LastUpdated = strconv.Itoa(int(time.Now().Unix()))
 	newSession.DateCreated = time.Now()
@@ -1231,7 +1390,7 @@ func createKeyHandler(w http.ResponseWriter, r *http.Request) {
 					newSession.QuotaRenews = time.Now().Unix() + newSession.QuotaRenewalRate
 				}
 				// apply polices (if any) and save key
-				if err := applyPoliciesAndSave(newKey, newSession, apiSpec, false); err != nil {
+				if err := applyPoliciesAndSave(newKey, newSession, apiSpec, false, -1); err != nil {
 					doJSONWrite(w, http.StatusInternalServerError, apiError("Failed to create key - "+err.Error()))
 					return
 				}
@@ -1271,7 +1430,7 @@ func createKeyHandler(w http.ResponseWriter, r *http.Request) {
 					newSession.QuotaRenews = time.Now().Unix() + newSession.QuotaRenewalRate
 				}
 				// apply polices (if any) and save key
-				if err := applyPoliciesAndSave(newKey, newSession, spec, false); err != nil {
+				if err := applyPoliciesAndSave(newKey, newSession, spec, false, -1); err != nil {
 					doJSONWrite(w, http.StatusInternalServerError, apiError("Failed to create key - "+err.Error()))
 					return
 				}
@@ -1910,6 +2069,11 @@ func invalidateCacheHandler(w http.ResponseWriter, r *http.Request) {
 
 	keyPrefix := "cache-" + apiID
 	matchPattern := keyPrefix + "*"
+	// Cache keys end with the path of the request, after the API ID and the
+	// hex MD5 checksum of the request
+	if pattern := r.URL.Query().Get("pattern"); pattern != "" {
+		matchPattern = keyPrefix + apiID + strings.Repeat("?", 32) + pattern
+	}
 	store := storage.RedisCluster{KeyPrefix: keyPrefix, IsCache: true}
 
 	if ok := store.DeleteScanMatch(matchPattern); !ok {
@@ -2174,3 +2338,62 @@ func ctxTraceEnabled(r *http.Request) bool {
 func ctxSetTrace(r *http.Request) {
 	setCtxValue(r, ctx.Trace, true)
 }
+
+func ctxSetGraphQLAnalysis(r *http.Request, analysis *graphql.Analysis) {
+	setCtxValue(r, ctx.GraphQLAnalysis, analysis)
+}
+
+// ctxGetGraphQLStats returns stats of the GraphQL operation for analytics.
+func ctxGetGraphQLStats(r *http.Request) GraphQLStats {
+	analysis, ok := r.Context().Value(ctx.GraphQLAnalysis).(*graphql.Analysis)
+	if !ok {
+		return GraphQLStats{}
+	}
+
+	return GraphQLStats{
+		OperationType: analysis.Type,
+		OperationName: analysis.Name,
+		Depth:         analysis.Depth,
+		Complexity:    analysis.Complexity,
+		Fields:        analysis.Fields,
+	}
+}
+
+func ctxSetRetries(r *http.Request, retries int) {
+	setCtxValue(r, ctx.Retries, retries)
+}
+
+// ctxGetRetries returns how many times the request was retried upstream.
+func ctxGetRetries(r *http.Request) int {
+	retries, _ := r.Context().Value(ctx.Retries).(int)
+	return retries
+}
+
+func ctxSetVariant(r *http.Request, variant string) {
+	setCtxValue(r, ctx.Variant, variant)
+}
+
+// ctxGetVariant returns the canary variant the request was routed to, if
+// its version has a canary.
+func ctxGetVariant(r *http.Request) string {
+	variant, _ := r.Context().Value(ctx.Variant).(string)
+	return variant
+}
+
+func ctxSetCertificateOrg(r *http.Request, orgID string) {
+	setCtxValue(r, ctx.CertificateOrg, orgID)
+}
+
+// ctxGetCertificateOrg returns the organisation which made the request to
+// the certificate API with its own secret, if any.
+func ctxGetCertificateOrg(r *http.Request) string {
+	orgID, _ := r.Context().Value(ctx.CertificateOrg).(string)
+	return orgID
+}
+
+// ctxIsMirrored tells whether the request is a copy sent to the mirror of the
+// API.
+func ctxIsMirrored(r *http.Request) bool {
+	mirrored, _ := r.Context().Value(ctx.Mirrored).(bool)
+	return mirrored
+}
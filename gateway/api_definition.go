@@ -17,13 +17,14 @@ import (
 	"text/template"
 	"time"
 
+	"github.com/gocraft/health"
+	"github.com/gorilla/mux"
 	sprig "gopkg.in/Masterminds/sprig.v2"
 
 	"github.com/TykTechnologies/tyk/headers"
 	"github.com/TykTechnologies/tyk/rpc"
 
 	"github.com/Sirupsen/logrus"
-	circuit "github.com/rubyist/circuitbreaker"
 
 	"github.com/TykTechnologies/gojsonschema"
 	"github.com/TykTechnologies/tyk/apidef"
@@ -75,6 +76,10 @@ const (
 	RequestNotTracked
 	ValidateJSONRequest
 	Internal
+	EndpointRateLimited
+	XMLConverted
+	XMLConvertedResponse
+	MockResponded
 )
 
 // RequestStatus is a custom type to avoid collisions
@@ -107,6 +112,10 @@ const (
 	StatusRequestNotTracked        RequestStatus = "Request Not Tracked"
 	StatusValidateJSON             RequestStatus = "Validate JSON"
 	StatusInternal                 RequestStatus = "Internal path"
+	StatusEndpointRateLimited      RequestStatus = "Endpoint rate limited"
+	StatusXMLConverted             RequestStatus = "Converted to XML"
+	StatusXMLConvertedResponse     RequestStatus = "Converted response to JSON"
+	StatusMockResponse             RequestStatus = "Mock response"
 )
 
 // URLSpec represents a flattened specification for URLs, used to check if a proxy URL
@@ -133,21 +142,26 @@ type URLSpec struct {
 	DoNotTrackEndpoint        apidef.TrackEndpointMeta
 	ValidatePathMeta          apidef.ValidatePathMeta
 	Internal                  apidef.InternalMeta
+	RateLimit                 apidef.RateLimitMeta
+	XMLConversion             apidef.XMLConversionMeta
+	MockResponse              MockResponseSpec
 }
 
 type EndPointCacheMeta struct {
-	Method        string
-	CacheKeyRegex string
+	Method           string
+	CacheKeyRegex    string
+	CacheKeyTemplate *template.Template
 }
 
 type TransformSpec struct {
 	apidef.TemplateMeta
-	Template *template.Template
+	Template   *template.Template
+	Operations transformOperations
 }
 
 type ExtendedCircuitBreakerMeta struct {
 	apidef.CircuitBreakerMeta
-	CB *circuit.Breaker `json:"-"`
+	CB *Breaker `json:"-"`
 }
 
 // APISpec represents a path specification for an API, to avoid enumerating multiple nested lists, a single
@@ -167,13 +181,19 @@ type APISpec struct {
 	Health                   HealthChecker
 	JSVM                     JSVM
 	ResponseChain            []TykResponseHandler
-	RoundRobin               RoundRobin
+	LoadBalancer             *LoadBalancer
+	UpstreamHealth           *UpstreamHealthChecker
 	URLRewriteEnabled        bool
 	CircuitBreakerEnabled    bool
+	ConcurrencyLimiter       *ConcurrencyLimiter
 	EnforcedTimeoutEnabled   bool
 	LastGoodHostList         *apidef.HostList
 	HasRun                   bool
 	ServiceRefreshInProgress bool
+	ServiceWatcher           *ServiceWatcher
+	Mirror                   *Mirror
+	Canaries                 map[string]*Canary
+	Cutover                  *VersionCutover
 	HTTPTransport            http.RoundTripper
 	HTTPTransportCreated     time.Time
 	WSTransport              http.RoundTripper
@@ -181,7 +201,11 @@ type APISpec struct {
 	GlobalConfig             config.Config
 	OrgHasNoSession          bool
 
-	middlewareChain http.Handler
+	middlewareChain  http.Handler
+	listenPathRegexp *regexp.Regexp
+	hedgeLatency     *latencyTracker
+	retryBudget      *retryBudget
+	maintenance      atomic.Value
 
 	shouldRelease bool
 }
@@ -191,20 +215,23 @@ func (s *APISpec) Release() {
 	// mark spec as to be released
 	s.shouldRelease = true
 
-	// release circuit breaker resources
-	for _, path := range s.RxPaths {
-		for _, urlSpec := range path {
-			if urlSpec.CircuitBreaker.CB != nil {
-				// this will force CB-event reading routing to exit
-				urlSpec.CircuitBreaker.CB.Reset()
-
-				// TODO: close all circuit breaker's event receivers
-				// which should let event reading Go-routines to exit (need to change circuitbreaker package)
-			}
-		}
+	// release all other resources associated with spec
+	if s.UpstreamHealth != nil {
+		s.UpstreamHealth.Stop()
+	}
+	if s.ServiceWatcher != nil {
+		s.ServiceWatcher.Stop()
+	}
+	if s.Cutover != nil {
+		s.Cutover.Stop()
 	}
 
-	// release all other resources associated with spec
+	// Connections of the transport are not reused by the new specs
+	s.Lock()
+	if s.HTTPTransport != nil {
+		closeIdleConnections(s.HTTPTransport)
+	}
+	s.Unlock()
 }
 
 // APIDefinitionLoader will load an Api definition from a storage
@@ -252,6 +279,56 @@ func (a APIDefinitionLoader) MakeSpec(def *apidef.APIDefinition, logger *logrus.
 
 	spec.GlobalConfig = config.Global()
 
+	spec.LoadBalancer = NewLoadBalancer(def.Proxy.LoadBalancing)
+	if sd := def.Proxy.ServiceDiscovery; sd.UseDiscoveryService && sd.Provider != "" {
+		watcher, err := NewServiceWatcher(def.APIID, sd)
+		if err != nil {
+			logger.WithError(err).Error("Could not watch service discovery provider")
+		}
+		spec.ServiceWatcher = watcher
+	}
+	if def.Proxy.HealthCheck.Enabled {
+		spec.UpstreamHealth = NewUpstreamHealthChecker(spec, def.Proxy.HealthCheck)
+		spec.LoadBalancer.health = spec.UpstreamHealth
+	}
+	if def.ConcurrencyLimit.Adaptive.Enabled {
+		spec.ConcurrencyLimiter = NewConcurrencyLimiter(def.ConcurrencyLimit.Adaptive)
+	}
+	if def.Proxy.Hedging.Enabled {
+		spec.hedgeLatency = &latencyTracker{}
+	}
+	if def.Proxy.Mirror.Enabled {
+		mirror, err := NewMirror(spec)
+		if err != nil {
+			logger.WithError(err).Error("Could not parse mirror target URL")
+		}
+		spec.Mirror = mirror
+	}
+	for _, version := range def.VersionData.Versions {
+		if !version.Canary.Enabled {
+			continue
+		}
+		canary, err := NewCanary(version.Canary)
+		if err != nil {
+			logger.WithError(err).WithField("version", version.Name).Error("Could not parse canary target URL")
+			continue
+		}
+		if spec.Canaries == nil {
+			spec.Canaries = make(map[string]*Canary)
+		}
+		spec.Canaries[version.Name] = canary
+	}
+	if def.VersionCutover.Enabled {
+		cutover, err := NewVersionCutover(spec)
+		if err != nil {
+			logger.WithError(err).Error("Could not parse version cutover time")
+		}
+		spec.Cutover = cutover
+	}
+	if def.Proxy.Retry.Enabled {
+		spec.retryBudget = newRetryBudget(def.Proxy.Retry.Budget)
+	}
+
 	// Create and init the virtual Machine
 	if config.Global().EnableJSVM {
 		spec.JSVM.Init(spec, logger)
@@ -278,6 +355,16 @@ func (a APIDefinitionLoader) MakeSpec(def *apidef.APIDefinition, logger *logrus.
 		}
 	}
 
+	// Listen paths with route variables are stripped by their regexp
+	if strings.Contains(def.Proxy.ListenPath, "{") {
+		if pattern, err := new(mux.Route).PathPrefix(def.Proxy.ListenPath).GetPathRegexp(); err == nil {
+			spec.listenPathRegexp, err = regexp.Compile(pattern)
+			if err != nil {
+				logger.WithError(err).Error("Failed to compile listen path")
+			}
+		}
+	}
+
 	spec.RxPaths = make(map[string][]URLSpec, len(def.VersionData.Versions))
 	spec.WhiteListEnabled = make(map[string]bool, len(def.VersionData.Versions))
 	for _, v := range def.VersionData.Versions {
@@ -545,6 +632,13 @@ func (a APIDefinitionLoader) compileCachedPathSpec(oldpaths []string, newpaths [
 		a.generateRegex(spec.Path, &newSpec, Cached)
 		newSpec.CacheConfig.Method = spec.Method
 		newSpec.CacheConfig.CacheKeyRegex = spec.CacheKeyRegex
+		if spec.CacheKeyTemplate != "" {
+			tmpl, err := newCacheKeyTemplate(spec.CacheKeyTemplate)
+			if err != nil {
+				log.WithError(err).Error("Failed to parse cache key template of ", spec.Path)
+			}
+			newSpec.CacheConfig.CacheKeyTemplate = tmpl
+		}
 		// Extend with method actions
 		urlSpec = append(urlSpec, newSpec)
 	}
@@ -598,9 +692,12 @@ func (a APIDefinitionLoader) compileTransformPathSpec(paths []apidef.TemplateMet
 		case apidef.UseBlob:
 			log.Debug("-- Blob mode")
 			newTransformSpec.Template, err = a.loadBlobTemplate(stringSpec.TemplateData.TemplateSource)
+		case apidef.UseOperations:
+			log.Debug("-- Operations mode")
+			newTransformSpec.Operations, err = compileTransformOperations(stringSpec.TemplateData.Operations)
 		default:
 			log.Warning("[Transform Templates] No template mode defined! Found: ", stringSpec.TemplateData.Mode)
-			err = errors.New("No valid template mode defined, must be either 'file' or 'blob'")
+			err = errors.New("No valid template mode defined, must be either 'file', 'blob' or 'operations'")
 		}
 
 		if stat == Transformed {
@@ -692,6 +789,20 @@ func (a APIDefinitionLoader) compileRequestSizePathSpec(paths []apidef.RequestSi
 	return urlSpec
 }
 
+func (a APIDefinitionLoader) compileRateLimitPathSpec(paths []apidef.RateLimitMeta, stat URLStatus) []URLSpec {
+	urlSpec := []URLSpec{}
+
+	for _, stringSpec := range paths {
+		newSpec := URLSpec{}
+		a.generateRegex(stringSpec.Path, &newSpec, stat)
+		newSpec.RateLimit = stringSpec
+
+		urlSpec = append(urlSpec, newSpec)
+	}
+
+	return urlSpec
+}
+
 func (a APIDefinitionLoader) compileCircuitBreakerPathSpec(paths []apidef.CircuitBreakerMeta, stat URLStatus, apiSpec *APISpec) []URLSpec {
 	// transform an extended configuration URL into an array of URLSpecs
 	// This way we can iterate the whole array once, on match we break with status
@@ -703,59 +814,35 @@ func (a APIDefinitionLoader) compileCircuitBreakerPathSpec(paths []apidef.Circui
 		// Extend with method actions
 		newSpec.CircuitBreaker = ExtendedCircuitBreakerMeta{CircuitBreakerMeta: stringSpec}
 		log.Debug("Initialising circuit breaker for: ", stringSpec.Path)
-		newSpec.CircuitBreaker.CB = circuit.NewRateBreaker(stringSpec.ThresholdPercent, stringSpec.Samples)
-		events := newSpec.CircuitBreaker.CB.Subscribe()
-		go func(path string, spec *APISpec, breakerPtr *circuit.Breaker) {
-			timerActive := false
-			for e := range events {
-				switch e {
-				case circuit.BreakerTripped:
-					log.Warning("[PROXY] [CIRCUIT BREAKER] Breaker tripped for path: ", path)
-					log.Debug("Breaker tripped: ", e)
-					// Start a timer function
-
-					if !timerActive {
-						go func(timeout int, breaker *circuit.Breaker) {
-							log.Debug("-- Sleeping for (s): ", timeout)
-							time.Sleep(time.Duration(timeout) * time.Second)
-							log.Debug("-- Resetting breaker")
-							breaker.Reset()
-							timerActive = false
-						}(newSpec.CircuitBreaker.ReturnToServiceAfter, breakerPtr)
-						timerActive = true
-					}
-
-					if spec.Proxy.ServiceDiscovery.UseDiscoveryService {
-						if ServiceCache != nil {
-							log.Warning("[PROXY] [CIRCUIT BREAKER] Refreshing host list")
-							ServiceCache.Delete(spec.APIID)
-						}
+		path := stringSpec.Path
+		newSpec.CircuitBreaker.CB = NewBreaker(stringSpec, func(e BreakerEvent, host string) {
+			if e == BreakerTripped {
+				log.Warning("[PROXY] [CIRCUIT BREAKER] Breaker tripped for path: ", path)
+				if apiSpec.Proxy.ServiceDiscovery.UseDiscoveryService {
+					if ServiceCache != nil {
+						log.Warning("[PROXY] [CIRCUIT BREAKER] Refreshing host list")
+						ServiceCache.Delete(apiSpec.APIID)
 					}
-
-					spec.FireEvent(EventBreakerTriggered, EventCurcuitBreakerMeta{
-						EventMetaDefault: EventMetaDefault{Message: "Breaker Tripped"},
-						CircuitEvent:     e,
-						Path:             path,
-						APIID:            spec.APIID,
-					})
-
-				case circuit.BreakerReset:
-					// check if this spec is set to release resources
-					if spec.shouldRelease {
-						// time to stop this Go-routine
-						return
-					}
-
-					spec.FireEvent(EventBreakerTriggered, EventCurcuitBreakerMeta{
-						EventMetaDefault: EventMetaDefault{Message: "Breaker Reset"},
-						CircuitEvent:     e,
-						Path:             path,
-						APIID:            spec.APIID,
-					})
-
 				}
 			}
-		}(stringSpec.Path, apiSpec, newSpec.CircuitBreaker.CB)
+
+			if instrumentationEnabled {
+				instrument.NewJob("CircuitBreaker").EventKv("state_changed", health.Kvs{
+					"api_id": apiSpec.APIID,
+					"path":   path,
+					"host":   host,
+					"event":  e.String(),
+				})
+			}
+
+			apiSpec.FireEvent(EventBreakerTriggered, EventCurcuitBreakerMeta{
+				EventMetaDefault: EventMetaDefault{Message: "Breaker " + e.String()},
+				CircuitEvent:     e,
+				Path:             path,
+				APIID:            apiSpec.APIID,
+				Host:             host,
+			})
+		})
 
 		urlSpec = append(urlSpec, newSpec)
 	}
@@ -840,6 +927,37 @@ func (a APIDefinitionLoader) compileValidateJSONPathspathSpec(paths []apidef.Val
 	return urlSpec
 }
 
+func (a APIDefinitionLoader) compileXMLConversionPathSpec(paths []apidef.XMLConversionMeta, stat URLStatus) []URLSpec {
+	urlSpec := []URLSpec{}
+
+	for _, stringSpec := range paths {
+		newSpec := URLSpec{}
+		a.generateRegex(stringSpec.Path, &newSpec, stat)
+		newSpec.XMLConversion = stringSpec
+		urlSpec = append(urlSpec, newSpec)
+	}
+
+	return urlSpec
+}
+
+func (a APIDefinitionLoader) compileMockResponsePathSpec(paths []apidef.MockResponseMeta, stat URLStatus) []URLSpec {
+	urlSpec := []URLSpec{}
+
+	for _, stringSpec := range paths {
+		newSpec := URLSpec{}
+		a.generateRegex(stringSpec.Path, &newSpec, stat)
+		mock, err := newMockResponseSpec(stringSpec, newSpec.Spec, a.filterSprigFuncs())
+		if err != nil {
+			log.WithError(err).Error("Failed to load mock response of ", stringSpec.Path, ", skipping it")
+			continue
+		}
+		newSpec.MockResponse = mock
+		urlSpec = append(urlSpec, newSpec)
+	}
+
+	return urlSpec
+}
+
 func (a APIDefinitionLoader) compileUnTrackedEndpointPathspathSpec(paths []apidef.TrackEndpointMeta, stat URLStatus) []URLSpec {
 	urlSpec := []URLSpec{}
 
@@ -891,6 +1009,10 @@ func (a APIDefinitionLoader) getExtendedPathSpecs(apiVersionDef apidef.VersionIn
 	unTrackedPaths := a.compileUnTrackedEndpointPathspathSpec(apiVersionDef.ExtendedPaths.DoNotTrackEndpoints, RequestNotTracked)
 	validateJSON := a.compileValidateJSONPathspathSpec(apiVersionDef.ExtendedPaths.ValidateJSON, ValidateJSONRequest)
 	internalPaths := a.compileInternalPathspathSpec(apiVersionDef.ExtendedPaths.Internal, Internal)
+	rateLimitPaths := a.compileRateLimitPathSpec(apiVersionDef.ExtendedPaths.RateLimit, EndpointRateLimited)
+	xmlConversionPaths := a.compileXMLConversionPathSpec(apiVersionDef.ExtendedPaths.ConvertXML, XMLConverted)
+	xmlConversionResponsePaths := a.compileXMLConversionPathSpec(apiVersionDef.ExtendedPaths.ConvertXML, XMLConvertedResponse)
+	mockResponsePaths := a.compileMockResponsePathSpec(apiVersionDef.ExtendedPaths.MockResponse, MockResponded)
 
 	combinedPath := []URLSpec{}
 	combinedPath = append(combinedPath, ignoredPaths...)
@@ -913,6 +1035,10 @@ func (a APIDefinitionLoader) getExtendedPathSpecs(apiVersionDef apidef.VersionIn
 	combinedPath = append(combinedPath, unTrackedPaths...)
 	combinedPath = append(combinedPath, validateJSON...)
 	combinedPath = append(combinedPath, internalPaths...)
+	combinedPath = append(combinedPath, rateLimitPaths...)
+	combinedPath = append(combinedPath, xmlConversionPaths...)
+	combinedPath = append(combinedPath, xmlConversionResponsePaths...)
+	combinedPath = append(combinedPath, mockResponsePaths...)
 
 	return combinedPath, len(whiteListPaths) > 0
 }
@@ -971,6 +1097,14 @@ func (a *APISpec) getURLStatus(stat URLStatus) RequestStatus {
 		return StatusValidateJSON
 	case Internal:
 		return StatusInternal
+	case EndpointRateLimited:
+		return StatusEndpointRateLimited
+	case XMLConverted:
+		return StatusXMLConverted
+	case XMLConvertedResponse:
+		return StatusXMLConvertedResponse
+	case MockResponded:
+		return StatusMockResponse
 
 	default:
 		log.Error("URL Status was not one of Ignored, Blacklist or WhiteList! Blocking.")
@@ -1024,7 +1158,7 @@ func (a *APISpec) URLAllowedAndIgnored(r *http.Request, rxPaths []URLSpec, white
 			}
 		}
 
-		if v.TransformAction.Template != nil {
+		if v.TransformAction.Template != nil || v.TransformAction.Operations != nil {
 			return a.getURLStatus(v.Status), &v.TransformAction
 		}
 
@@ -1051,13 +1185,28 @@ func (a *APISpec) URLAllowedAndIgnored(r *http.Request, rxPaths []URLSpec, white
 	return StatusOk, nil
 }
 
+// StripListenPath returns the path relative to the listen path of the API,
+// which may hold route variables, e.g. "/{org}/pets/".
+func (a *APISpec) StripListenPath(path string) string {
+	if a.listenPathRegexp != nil {
+		path = a.listenPathRegexp.ReplaceAllString(path, "")
+	} else if a.Proxy.ListenPath != "/" {
+		path = strings.TrimPrefix(path, a.Proxy.ListenPath)
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
 // CheckSpecMatchesStatus checks if a url spec has a specific status
 func (a *APISpec) CheckSpecMatchesStatus(r *http.Request, rxPaths []URLSpec, mode URLStatus) (bool, interface{}) {
 	var matchPath, method string
 
 	//If url-rewrite middleware was used, call response middleware of original path and not of rewritten path
 	// context variable UrlRewritePath is set by rewrite middleware
-	if mode == TransformedJQResponse || mode == HeaderInjectedResponse || mode == TransformedResponse {
+	if mode == TransformedJQResponse || mode == HeaderInjectedResponse || mode == TransformedResponse || mode == XMLConvertedResponse {
 		matchPath = ctxGetUrlRewritePath(r)
 		method = ctxGetRequestMethod(r)
 		if matchPath == "" {
@@ -1068,12 +1217,18 @@ func (a *APISpec) CheckSpecMatchesStatus(r *http.Request, rxPaths []URLSpec, mod
 		method = r.Method
 	}
 
-	if a.Proxy.ListenPath != "/" {
-		matchPath = strings.TrimPrefix(matchPath, a.Proxy.ListenPath)
-	}
+	// Only mocks strip listen paths with route variables, other endpoints
+	// of such APIs are matched against the full path as they always were
+	if mode == MockResponded {
+		matchPath = a.StripListenPath(matchPath)
+	} else {
+		if a.Proxy.ListenPath != "/" {
+			matchPath = strings.TrimPrefix(matchPath, a.Proxy.ListenPath)
+		}
 
-	if !strings.HasPrefix(matchPath, "/") {
-		matchPath = "/" + matchPath
+		if !strings.HasPrefix(matchPath, "/") {
+			matchPath = "/" + matchPath
+		}
 	}
 
 	// Check if ignored
@@ -1156,6 +1311,18 @@ func (a *APISpec) CheckSpecMatchesStatus(r *http.Request, rxPaths []URLSpec, mod
 			if method == v.Internal.Method {
 				return true, &v.Internal
 			}
+		case EndpointRateLimited:
+			if method == v.RateLimit.Method {
+				return true, &v.RateLimit
+			}
+		case XMLConverted, XMLConvertedResponse:
+			if method == v.XMLConversion.Method {
+				return true, &v.XMLConversion
+			}
+		case MockResponded:
+			if method == v.MockResponse.Method {
+				return true, &v.MockResponse
+			}
 		}
 	}
 	return false, nil
@@ -1268,10 +1435,10 @@ func (a *APISpec) Version(r *http.Request) (*apidef.VersionInfo, []URLSpec, bool
 			// First checking for if default version is set
 			vName := a.getVersionFromRequest(r)
 			if vName == "" {
-				if a.VersionData.DefaultVersion == "" {
+				vName = a.defaultVersion()
+				if vName == "" {
 					return &version, nil, false, VersionNotFound
 				}
-				vName = a.VersionData.DefaultVersion
 				ctxSetDefaultVersion(r)
 			}
 			// Load Version Data - General
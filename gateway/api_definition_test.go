@@ -171,6 +171,30 @@ func TestWhitelist(t *testing.T) {
 	})
 }
 
+func TestEndpointsListenPathWithVariables(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		UpdateAPIVersion(spec, "v1", func(v *apidef.VersionInfo) {
+			v.UseExtendedPaths = true
+			v.ExtendedPaths.TransformHeader = []apidef.HeaderInjectionMeta{{
+				Path:       "^/acme/pets/tagged",
+				Method:     http.MethodGet,
+				AddHeaders: map[string]string{"X-Tagged": "yes"},
+			}}
+		})
+
+		spec.Proxy.ListenPath = "/{org}/pets/"
+	})
+
+	// Endpoints are matched against the full path, listen path included
+	ts.Run(t, []test.TestCase{
+		{Path: "/acme/pets/tagged", Code: http.StatusOK, BodyMatch: `"X-Tagged":"yes"`},
+		{Path: "/acme/pets/other", Code: http.StatusOK, BodyNotMatch: `X-Tagged`},
+	}...)
+}
+
 func TestBlacklist(t *testing.T) {
 	ts := StartTest()
 	defer ts.Close()
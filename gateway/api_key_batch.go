@@ -0,0 +1,206 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+// ndjsonContentType is the content type of key batches streamed as one JSON
+// entry per line, to which results are streamed back the same way.
+const ndjsonContentType = "application/x-ndjson"
+
+const (
+	keyBatchCreate = "create"
+	keyBatchUpdate = "update"
+	keyBatchDelete = "delete"
+	keyBatchRotate = "rotate"
+)
+
+// apiBatchKey is an entry of a key batch. Keys are created with their session,
+// and generated unless given. Updated keys get their session replaced.
+// Rotated keys are replaced by a generated key with the same session, and
+// stay valid for the grace period, in seconds, if any.
+type apiBatchKey struct {
+	Action        string             `json:"action"`
+	Key           string             `json:"key,omitempty"`
+	Hashed        bool               `json:"hashed,omitempty"`
+	APIID         string             `json:"api_id,omitempty"`
+	Session       *user.SessionState `json:"session,omitempty"`
+	SuppressReset bool               `json:"suppress_reset,omitempty"`
+	GracePeriod   int64              `json:"grace_period,omitempty"`
+}
+
+type apiBatchKeyResult struct {
+	Action      string `json:"action"`
+	Key         string `json:"key,omitempty"`
+	KeyHash     string `json:"key_hash,omitempty"`
+	PreviousKey string `json:"previous_key,omitempty"`
+	Status      string `json:"status"`
+	Error       string `json:"error,omitempty"`
+}
+
+type apiBatchKeys struct {
+	Results []apiBatchKeyResult `json:"results"`
+}
+
+// keyBatchHandler creates, updates, deletes and rotates keys in bulk. The
+// body is either a JSON array of entries, or entries streamed one per line,
+// which are applied as they are read. Every entry gets its own result.
+func keyBatchHandler(w http.ResponseWriter, r *http.Request) {
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get(headers.ContentType))
+	if contentType == ndjsonContentType {
+		streamKeyBatch(w, r)
+		return
+	}
+
+	var entries []apiBatchKey
+	if err := json.NewDecoder(r.Body).Decode(&entries); err != nil {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Request malformed"))
+		return
+	}
+
+	results := make([]apiBatchKeyResult, len(entries))
+	for i, entry := range entries {
+		results[i] = applyBatchKey(entry)
+	}
+	doJSONWrite(w, http.StatusOK, &apiBatchKeys{results})
+}
+
+func streamKeyBatch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(headers.ContentType, ndjsonContentType)
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	decoder := json.NewDecoder(r.Body)
+	encoder := json.NewEncoder(w)
+	for {
+		var entry apiBatchKey
+		err := decoder.Decode(&entry)
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			// The rest of the stream can't be read past a malformed entry
+			encoder.Encode(apiBatchKeyResult{Status: "error", Error: "Request malformed: " + err.Error()})
+			return
+		}
+
+		encoder.Encode(applyBatchKey(entry))
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+func applyBatchKey(entry apiBatchKey) apiBatchKeyResult {
+	result := apiBatchKeyResult{Action: entry.Action, Key: entry.Key}
+
+	var obj interface{}
+	var code int
+	var err error
+
+	switch entry.Action {
+	case keyBatchCreate:
+		if entry.Session == nil {
+			err = errors.New("session is required")
+			break
+		}
+		key := entry.Key
+		if key == "" {
+			key = generateSessionKey(entry.Session)
+		}
+		obj, code = addOrUpdateKey(key, *entry.Session, http.MethodPost, entry.SuppressReset, entry.Hashed)
+	case keyBatchUpdate:
+		if entry.Key == "" || entry.Session == nil {
+			err = errors.New("key and session are required")
+			break
+		}
+		obj, code = addOrUpdateKey(entry.Key, *entry.Session, http.MethodPut, entry.SuppressReset, entry.Hashed)
+	case keyBatchDelete:
+		if entry.Key == "" {
+			err = errors.New("key is required")
+			break
+		}
+		obj, code = deleteBatchKey(entry.Key, entry.APIID, entry.Hashed)
+	case keyBatchRotate:
+		obj, code, err = rotateKey(entry)
+		result.PreviousKey = entry.Key
+	default:
+		err = errors.New("unknown action: " + entry.Action)
+	}
+
+	// Rotated keys are reported even if the previous key couldn't be retired
+	if success, ok := obj.(apiModifyKeySuccess); ok {
+		result.Key, result.KeyHash = success.Key, success.KeyHash
+	}
+
+	switch {
+	case err != nil:
+		result.Error = err.Error()
+	case code != http.StatusOK:
+		if status, ok := obj.(apiStatusMessage); ok {
+			result.Error = status.Message
+		} else {
+			result.Error = http.StatusText(code)
+		}
+	}
+
+	result.Status = "ok"
+	if result.Error != "" {
+		result.Status = "error"
+	}
+	return result
+}
+
+func deleteBatchKey(key, apiID string, hashed bool) (interface{}, int) {
+	if hashed {
+		return handleDeleteHashedKey(key, apiID, true)
+	}
+	return handleDeleteKey(key, apiID, true)
+}
+
+// rotateKey replaces a key by a generated one with the same session. The
+// previous key is deleted, or expires after the grace period.
+func rotateKey(entry apiBatchKey) (interface{}, int, error) {
+	if entry.Key == "" {
+		return nil, 0, errors.New("key is required")
+	}
+
+	session, found := getKeyDetail(entry.Key, entry.APIID, entry.Hashed)
+	if !found {
+		return nil, 0, errors.New("key not found")
+	}
+	if session.BasicAuthData.Password != "" {
+		return nil, 0, errors.New("basic auth users can't be rotated")
+	}
+
+	newSession := session
+	newSession.KeyVerifier = ""
+	obj, code := addOrUpdateKey(generateSessionKey(&newSession), newSession, http.MethodPost, false, false)
+	if code != http.StatusOK {
+		return obj, code, nil
+	}
+
+	if entry.GracePeriod > 0 {
+		expires := time.Now().Unix() + entry.GracePeriod
+		if session.Expires <= 0 || session.Expires > expires {
+			session.Expires = expires
+		}
+		if _, code := addOrUpdateKey(entry.Key, session, http.MethodPut, true, entry.Hashed); code != http.StatusOK {
+			return obj, code, errors.New("could not set expiry of previous key")
+		}
+		return obj, code, nil
+	}
+
+	if _, code := deleteBatchKey(entry.Key, entry.APIID, entry.Hashed); code != http.StatusOK {
+		return obj, code, errors.New("could not delete previous key")
+	}
+	return obj, code, nil
+}
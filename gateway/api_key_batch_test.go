@@ -0,0 +1,137 @@
+package gateway
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestKeyBatch(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	spec := BuildAndLoadAPI(func(spec *APISpec) {
+		spec.UseKeylessAccess = false
+		spec.Proxy.ListenPath = "/"
+	})[0]
+
+	session := func() *user.SessionState {
+		s := CreateStandardSession()
+		s.AccessRights = map[string]user.AccessDefinition{spec.APIID: {APIID: spec.APIID}}
+		return s
+	}
+	batch := func(t *testing.T, entries ...apiBatchKey) []apiBatchKeyResult {
+		data, _ := json.Marshal(entries)
+		resp, _ := ts.Run(t, test.TestCase{Method: http.MethodPost, Path: "/tyk/keys/batch", Data: data, AdminAuth: true, Code: http.StatusOK})
+
+		var results apiBatchKeys
+		json.NewDecoder(resp.Body).Decode(&results)
+		if len(results.Results) != len(entries) {
+			t.Fatalf("Expected %d results, got %+v", len(entries), results)
+		}
+		return results.Results
+	}
+	authorized := func(t *testing.T, key string, code int) {
+		ts.Run(t, test.TestCase{Headers: map[string]string{"Authorization": key}, Code: code})
+	}
+
+	t.Run("Create, update and delete", func(t *testing.T) {
+		inactive := session()
+		inactive.IsInactive = true
+
+		results := batch(t,
+			apiBatchKey{Action: keyBatchCreate, Session: session()},
+			apiBatchKey{Action: keyBatchCreate, Key: "custom-batch-key", Session: session()},
+			apiBatchKey{Action: keyBatchCreate},
+			apiBatchKey{Action: "unknown"},
+		)
+		if results[0].Status != "ok" || results[0].Key == "" || results[1].Key != "custom-batch-key" {
+			t.Fatalf("Keys should be created: %+v", results)
+		}
+		if results[2].Error != "session is required" || results[3].Status != "error" {
+			t.Errorf("Invalid entries should fail on their own: %+v", results)
+		}
+		authorized(t, results[0].Key, http.StatusOK)
+		authorized(t, "custom-batch-key", http.StatusOK)
+
+		results = batch(t,
+			apiBatchKey{Action: keyBatchUpdate, Key: "custom-batch-key", Session: inactive},
+			apiBatchKey{Action: keyBatchDelete, Key: results[0].Key},
+			apiBatchKey{Action: keyBatchDelete},
+		)
+		if results[0].Status != "ok" || results[1].Status != "ok" || results[2].Error != "key is required" {
+			t.Fatalf("Unexpected results: %+v", results)
+		}
+		authorized(t, "custom-batch-key", http.StatusForbidden)
+		authorized(t, results[1].Key, http.StatusForbidden)
+	})
+
+	t.Run("Rotate", func(t *testing.T) {
+		immediate, graceful := CreateSession(func(s *user.SessionState) {
+			s.AccessRights = map[string]user.AccessDefinition{spec.APIID: {APIID: spec.APIID}}
+		}), CreateSession(func(s *user.SessionState) {
+			s.AccessRights = map[string]user.AccessDefinition{spec.APIID: {APIID: spec.APIID}}
+		})
+
+		results := batch(t,
+			apiBatchKey{Action: keyBatchRotate, Key: immediate},
+			apiBatchKey{Action: keyBatchRotate, Key: graceful, GracePeriod: 60},
+			apiBatchKey{Action: keyBatchRotate, Key: "unknown"},
+		)
+		if results[0].PreviousKey != immediate || results[0].Key == "" || results[0].Key == immediate {
+			t.Fatalf("Key should be rotated: %+v", results[0])
+		}
+		if results[2].Error != "key not found" {
+			t.Errorf("Unknown key can't be rotated: %+v", results[2])
+		}
+
+		authorized(t, results[0].Key, http.StatusOK)
+		authorized(t, immediate, http.StatusForbidden)
+		authorized(t, results[1].Key, http.StatusOK)
+		authorized(t, graceful, http.StatusOK)
+
+		previous, _ := spec.SessionManager.SessionDetail(graceful, false)
+		if expires := time.Unix(previous.Expires, 0); time.Until(expires) > time.Minute || time.Until(expires) < 0 {
+			t.Error("Previous key should expire after the grace period, expires", expires)
+		}
+	})
+
+	t.Run("Streamed", func(t *testing.T) {
+		var lines []string
+		for _, entry := range []apiBatchKey{
+			{Action: keyBatchCreate, Session: session()},
+			{Action: keyBatchCreate, Session: session()},
+		} {
+			line, _ := json.Marshal(entry)
+			lines = append(lines, string(line))
+		}
+		lines = append(lines, "{not json")
+
+		resp, _ := ts.Run(t, test.TestCase{
+			Method:    http.MethodPost,
+			Path:      "/tyk/keys/batch",
+			Data:      strings.Join(lines, "\n"),
+			Headers:   map[string]string{"Content-Type": ndjsonContentType},
+			AdminAuth: true,
+			Code:      http.StatusOK,
+		})
+
+		var results []apiBatchKeyResult
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			var result apiBatchKeyResult
+			json.Unmarshal(scanner.Bytes(), &result)
+			results = append(results, result)
+		}
+		if len(results) != 3 || results[0].Status != "ok" || results[1].Status != "ok" || results[2].Status != "error" {
+			t.Fatalf("Each streamed entry should get a result: %+v", results)
+		}
+		authorized(t, results[1].Key, http.StatusOK)
+	})
+}
@@ -159,8 +159,21 @@ func processSpec(spec *APISpec, apisByListen map[string]int,
 	// Set up LB targets:
 	if spec.Proxy.EnableLoadBalancing {
 		sl := apidef.NewHostListFromList(spec.Proxy.Targets)
+		if len(spec.Proxy.LoadBalancing.Targets) > 0 {
+			sl = apidef.NewHostListFromTargets(spec.Proxy.LoadBalancing.Targets)
+		}
 		spec.Proxy.StructuredTargetList = sl
 	}
+	if spec.ServiceWatcher != nil {
+		spec.ServiceWatcher.Start()
+	}
+	if spec.UpstreamHealth != nil {
+		spec.UpstreamHealth.Start()
+	}
+	if spec.Cutover != nil {
+		spec.Cutover.Start()
+	}
+	loadMaintenanceMode(spec)
 
 	// Initialise the auth and session managers (use Redis for now)
 	authStore := redisStore
@@ -232,7 +245,7 @@ func processSpec(spec *APISpec, apisByListen map[string]int,
 
 	enableVersionOverrides := false
 	for _, versionData := range spec.VersionData.Versions {
-		if versionData.OverrideTarget != "" {
+		if versionData.OverrideTarget != "" || len(versionData.LoadBalancing.Targets) > 0 {
 			enableVersionOverrides = true
 			break
 		}
@@ -277,6 +290,7 @@ func processSpec(spec *APISpec, apisByListen map[string]int,
 	}
 
 	handleCORS(&chainArray, spec)
+	mwAppendEnabled(&chainArray, &MaintenanceMode{BaseMiddleware: baseMid})
 
 	for _, obj := range mwPreFuncs {
 		if mwDriver == apidef.GoPluginDriver {
@@ -299,6 +313,7 @@ func processSpec(spec *APISpec, apisByListen map[string]int,
 	mwAppendEnabled(&chainArray, &RateCheckMW{BaseMiddleware: baseMid})
 	mwAppendEnabled(&chainArray, &IPWhiteListMiddleware{BaseMiddleware: baseMid})
 	mwAppendEnabled(&chainArray, &IPBlackListMiddleware{BaseMiddleware: baseMid})
+	mwAppendEnabled(&chainArray, &GeoIPAccessCheck{BaseMiddleware: baseMid})
 	mwAppendEnabled(&chainArray, &CertificateCheckMW{BaseMiddleware: baseMid})
 	mwAppendEnabled(&chainArray, &OrganizationMonitor{BaseMiddleware: baseMid})
 	mwAppendEnabled(&chainArray, &VersionCheck{BaseMiddleware: baseMid})
@@ -307,6 +322,8 @@ func processSpec(spec *APISpec, apisByListen map[string]int,
 	mwAppendEnabled(&chainArray, &TrackEndpointMiddleware{baseMid})
 
 	if !spec.UseKeylessAccess {
+		mwAppendEnabled(&chainArray, &DPoPCheck{baseMid})
+
 		// Select the keying method to use for setting session states
 		if mwAppendEnabled(&authArray, &Oauth2KeyExists{baseMid}) {
 			logger.Info("Checking security policy: OAuth")
@@ -328,6 +345,10 @@ func processSpec(spec *APISpec, apisByListen map[string]int,
 			logger.Info("Checking security policy: OpenID")
 		}
 
+		if mwAppendEnabled(&authArray, &CertificateSessionMW{BaseMiddleware: baseMid}) {
+			logger.Info("Checking security policy: Client certificate")
+		}
+
 		coprocessAuth := EnableCoProcess && mwDriver != apidef.OttoDriver && spec.EnableCoProcessAuth
 		ottoAuth := !coprocessAuth && mwDriver == apidef.OttoDriver && spec.EnableCoProcessAuth
 		gopluginAuth := !coprocessAuth && !ottoAuth && mwDriver == apidef.GoPluginDriver && spec.UseGoPluginAuth
@@ -388,14 +409,20 @@ func processSpec(spec *APISpec, apisByListen map[string]int,
 	}
 
 	mwAppendEnabled(&chainArray, &RateLimitForAPI{BaseMiddleware: baseMid})
+	mwAppendEnabled(&chainArray, &EndpointRateLimit{BaseMiddleware: baseMid})
+	mwAppendEnabled(&chainArray, &ConcurrencyLimit{BaseMiddleware: baseMid})
+	mwAppendEnabled(&chainArray, &GraphQLMiddleware{BaseMiddleware: baseMid})
+	mwAppendEnabled(&chainArray, &GRPCMiddleware{BaseMiddleware: baseMid})
 	mwAppendEnabled(&chainArray, &ValidateJSON{BaseMiddleware: baseMid})
 	mwAppendEnabled(&chainArray, &TransformMiddleware{baseMid})
 	mwAppendEnabled(&chainArray, &TransformJQMiddleware{baseMid})
+	mwAppendEnabled(&chainArray, &XMLConversionMiddleware{BaseMiddleware: baseMid})
 	mwAppendEnabled(&chainArray, &TransformHeaders{BaseMiddleware: baseMid})
 	mwAppendEnabled(&chainArray, &URLRewriteMiddleware{BaseMiddleware: baseMid})
 	mwAppendEnabled(&chainArray, &TransformMethod{BaseMiddleware: baseMid})
 	mwAppendEnabled(&chainArray, &RedisCacheMiddleware{BaseMiddleware: baseMid, CacheStore: &cacheStore})
 	mwAppendEnabled(&chainArray, &VirtualEndpoint{BaseMiddleware: baseMid})
+	mwAppendEnabled(&chainArray, &MockResponseMiddleware{BaseMiddleware: baseMid})
 	mwAppendEnabled(&chainArray, &RequestSigning{BaseMiddleware: baseMid})
 
 	for _, obj := range mwPostFuncs {
@@ -420,8 +447,9 @@ func processSpec(spec *APISpec, apisByListen map[string]int,
 
 	if !spec.UseKeylessAccess {
 		var simpleArray []alice.Constructor
-		mwAppendEnabled(&simpleArray, &IPWhiteListMiddleware{baseMid})
+		mwAppendEnabled(&simpleArray, &IPWhiteListMiddleware{BaseMiddleware: baseMid})
 		mwAppendEnabled(&simpleArray, &IPBlackListMiddleware{BaseMiddleware: baseMid})
+		mwAppendEnabled(&simpleArray, &GeoIPAccessCheck{BaseMiddleware: baseMid})
 		mwAppendEnabled(&simpleArray, &OrganizationMonitor{BaseMiddleware: baseMid})
 		mwAppendEnabled(&simpleArray, &VersionCheck{BaseMiddleware: baseMid})
 		simpleArray = append(simpleArray, authArray...)
@@ -632,6 +660,13 @@ func loadApps(specs []*APISpec, muxer *mux.Router) {
 	}
 
 	for i, spec := range specs {
+		// Layer 4 APIs are served on their own ports
+		if isTCPSpec(spec) {
+			tmpSpecRegister[spec.APIID] = spec
+			loadList[i] = &ChainObject{Skip: true}
+			continue
+		}
+
 		subrouter := hostRouters[spec.Domain]
 		if subrouter == nil {
 			mainLog.WithFields(logrus.Fields{
@@ -669,6 +704,14 @@ func loadApps(specs []*APISpec, muxer *mux.Router) {
 		fmt.Fprint(w, "Hello Tiki")
 	})
 
+	loadTCPServices(specs)
+
+	// Warm up certificates before the new APIs are served
+	usages := certificateUsages(specs)
+	if cacheConf := config.Global().Security.CertificateCache; cacheConf.AsyncRefresh || cacheConf.Preload {
+		preloadCertificates(usages)
+	}
+
 	// Swap in the new register
 	apisMu.Lock()
 
@@ -680,6 +723,8 @@ func loadApps(specs []*APISpec, muxer *mux.Router) {
 	apisByID = tmpSpecRegister
 	apisMu.Unlock()
 
+	CertificateManager.SetUsages(usages)
+
 	mainLog.Debug("Checker host list")
 
 	// Kick off our host checkers
@@ -0,0 +1,274 @@
+package gateway
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/apidef/importer"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
+)
+
+// oasVersion is the version of OpenAPI documents APIs are exported as.
+const oasVersion = "3.0.3"
+
+type oasDocument struct {
+	OpenAPI    string                              `json:"openapi"`
+	Info       oasInfo                             `json:"info"`
+	Servers    []oasServer                         `json:"servers"`
+	Paths      map[string]map[string]*oasOperation `json:"paths"`
+	Components oasComponents                       `json:"components"`
+	Security   []map[string][]string               `json:"security,omitempty"`
+}
+
+type oasInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type oasServer struct {
+	URL string `json:"url"`
+}
+
+type oasComponents struct {
+	Schemas         map[string]interface{}       `json:"schemas,omitempty"`
+	SecuritySchemes map[string]oasSecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type oasSecurityScheme struct {
+	Type         string `json:"type"`
+	Name         string `json:"name,omitempty"`
+	In           string `json:"in,omitempty"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+type oasOperation struct {
+	RequestBody *oasRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]oasResponse `json:"responses"`
+}
+
+type oasRequestBody struct {
+	Required bool                    `json:"required"`
+	Content  map[string]oasMediaType `json:"content"`
+}
+
+type oasMediaType struct {
+	Schema map[string]interface{} `json:"schema"`
+}
+
+type oasResponse struct {
+	Description string `json:"description"`
+}
+
+// apiOASImportHandler generates an API definition from an OpenAPI 3 or a
+// Swagger 2.0 document: its paths and methods, the security scheme it
+// requires and the validation of request bodies. The upstream defaults to the
+// first server of the document. With mock=true, endpoints answer with the
+// examples or schemas of their responses instead of proxying.
+func apiOASImportHandler(w http.ResponseWriter, r *http.Request) {
+	if config.Global().UseDBAppConfigs {
+		log.Error("Rejected new API Definition due to UseDBAppConfigs = true")
+		doJSONWrite(w, http.StatusInternalServerError, apiError("Due to enabled use_db_app_configs, please use the Dashboard API"))
+		return
+	}
+
+	imp, err := importer.GetImporterForSource(importer.SwaggerSource)
+	if err != nil {
+		doJSONWrite(w, http.StatusInternalServerError, apiError(err.Error()))
+		return
+	}
+	if err := imp.LoadFrom(r.Body); err != nil {
+		log.Error("Couldn't decode OpenAPI document: ", err)
+		doJSONWrite(w, http.StatusBadRequest, apiError("Request malformed"))
+		return
+	}
+
+	query := r.URL.Query()
+	def, err := imp.ToAPIDefinition(query.Get("org_id"), query.Get("upstream_url"), query.Get("mock") == "true")
+	if err != nil {
+		doJSONWrite(w, http.StatusBadRequest, apiError(err.Error()))
+		return
+	}
+	if apiID := query.Get("api_id"); apiID != "" {
+		def.APIID = apiID
+		def.Proxy.ListenPath = "/" + apiID + "/"
+	}
+	if listenPath := query.Get("listen_path"); listenPath != "" {
+		def.Proxy.ListenPath = listenPath
+	}
+	// Requests without a version get the only version of the document
+	for name := range def.VersionData.Versions {
+		def.VersionData.DefaultVersion = name
+	}
+
+	if obj, code := writeAPIDefinition(def); code != http.StatusOK {
+		doJSONWrite(w, code, obj)
+		return
+	}
+
+	doJSONWrite(w, http.StatusOK, apiModifyKeySuccess{
+		Key:    def.APIID,
+		Status: "ok",
+		Action: "added",
+	})
+}
+
+// apiOASExportHandler exports a loaded API as an OpenAPI 3 document. The
+// version query parameter picks the version to export, the default version
+// otherwise.
+func apiOASExportHandler(w http.ResponseWriter, r *http.Request) {
+	spec := getApiSpec(mux.Vars(r)["apiID"])
+	if spec == nil {
+		doJSONWrite(w, http.StatusNotFound, apiError("API not found"))
+		return
+	}
+
+	name := r.URL.Query().Get("version")
+	if name == "" {
+		name = spec.VersionData.DefaultVersion
+	}
+	if name == "" {
+		names := make([]string, 0, len(spec.VersionData.Versions))
+		for versionName := range spec.VersionData.Versions {
+			names = append(names, versionName)
+		}
+		sort.Strings(names)
+		if len(names) > 0 {
+			name = names[0]
+		}
+	}
+	version, ok := spec.VersionData.Versions[name]
+	if !ok {
+		doJSONWrite(w, http.StatusNotFound, apiError("Version not found"))
+		return
+	}
+
+	doJSONWrite(w, http.StatusOK, exportOAS(spec.APIDefinition, name, version))
+}
+
+// exportOAS describes a version of an API as an OpenAPI 3 document. Servers
+// are relative to the gateway, and auth methods OpenAPI can't describe, like
+// OAuth2 flows of the gateway or HMAC signatures, are left out.
+func exportOAS(def *apidef.APIDefinition, versionName string, version apidef.VersionInfo) *oasDocument {
+	doc := &oasDocument{
+		OpenAPI: oasVersion,
+		Info:    oasInfo{Title: def.Name, Version: versionName},
+		Servers: []oasServer{{URL: strings.TrimSuffix(def.Proxy.ListenPath, "/")}},
+		Paths:   make(map[string]map[string]*oasOperation),
+	}
+	if doc.Servers[0].URL == "" {
+		doc.Servers[0].URL = "/"
+	}
+
+	for _, endpoint := range version.ExtendedPaths.WhiteList {
+		for method := range endpoint.MethodActions {
+			doc.operation(endpoint.Path, method)
+		}
+	}
+	for _, endpoint := range version.ExtendedPaths.Ignored {
+		for method := range endpoint.MethodActions {
+			doc.operation(endpoint.Path, method)
+		}
+	}
+	for _, endpoint := range version.ExtendedPaths.TrackEndpoints {
+		doc.operation(endpoint.Path, endpoint.Method)
+	}
+	for _, validate := range version.ExtendedPaths.ValidateJSON {
+		op := doc.operation(validate.Path, validate.Method)
+		op.RequestBody = &oasRequestBody{
+			Required: true,
+			Content: map[string]oasMediaType{
+				"application/json": {Schema: doc.schema(validate.Schema)},
+			},
+		}
+	}
+
+	doc.setSecurity(def)
+	return doc
+}
+
+// operation returns the operation of a path and a method, adding it if new.
+func (d *oasDocument) operation(path, method string) *oasOperation {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	method = strings.ToLower(method)
+
+	if d.Paths[path] == nil {
+		d.Paths[path] = make(map[string]*oasOperation)
+	}
+	if d.Paths[path][method] == nil {
+		d.Paths[path][method] = &oasOperation{
+			Responses: map[string]oasResponse{"default": {Description: "Response of the upstream"}},
+		}
+	}
+	return d.Paths[path][method]
+}
+
+// schema returns the schema of a request body, moving the component schemas
+// it carries, as imported from OpenAPI 3 documents, to the document.
+func (d *oasDocument) schema(schema map[string]interface{}) map[string]interface{} {
+	components, _ := schema["components"].(map[string]interface{})
+	schemas, _ := components["schemas"].(map[string]interface{})
+	if len(schemas) == 0 {
+		return schema
+	}
+
+	if d.Components.Schemas == nil {
+		d.Components.Schemas = make(map[string]interface{})
+	}
+	for name, componentSchema := range schemas {
+		d.Components.Schemas[name] = componentSchema
+	}
+
+	bodySchema := make(map[string]interface{}, len(schema))
+	for key, value := range schema {
+		if key != "components" {
+			bodySchema[key] = value
+		}
+	}
+	return bodySchema
+}
+
+// setSecurity requires the security schemes of the auth methods an API
+// chains, all of them together.
+func (d *oasDocument) setSecurity(def *apidef.APIDefinition) {
+	if def.UseKeylessAccess {
+		return
+	}
+
+	schemes := make(map[string]oasSecurityScheme)
+	if def.UseBasicAuth {
+		schemes["basic"] = oasSecurityScheme{Type: "http", Scheme: "basic"}
+	}
+	if def.EnableJWT {
+		schemes["jwt"] = oasSecurityScheme{Type: "http", Scheme: "bearer", BearerFormat: "JWT"}
+	}
+
+	otherAuth := def.UseOauth2 || def.UseBasicAuth || def.EnableJWT || def.UseOpenID ||
+		def.EnableSignatureChecking || def.UseMutualTLSAuth || def.EnableCoProcessAuth || def.UseGoPluginAuth
+	if def.UseStandardAuth || !otherAuth {
+		// Keys are always accepted in the header, whether or not in a
+		// parameter or a cookie too
+		scheme := oasSecurityScheme{Type: "apiKey", In: "header", Name: def.Auth.AuthHeaderName}
+		if scheme.Name == "" {
+			scheme.Name = headers.Authorization
+		}
+		schemes["api_key"] = scheme
+	}
+
+	if len(schemes) == 0 {
+		return
+	}
+	requirement := make(map[string][]string, len(schemes))
+	for name := range schemes {
+		requirement[name] = []string{}
+	}
+	d.Components.SecuritySchemes = schemes
+	d.Security = []map[string][]string{requirement}
+}
@@ -0,0 +1,143 @@
+package gateway
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+const testOASDocument = `{
+  "openapi": "3.0.0",
+  "info": {"title": "Pets", "version": "1.0.0"},
+  "servers": [{"url": "http://pets.example.com/v1"}],
+  "security": [{"api_key": []}],
+  "paths": {
+    "/pets": {
+      "get": {"responses": {"200": {"description": "Pets"}}},
+      "post": {
+        "requestBody": {
+          "content": {
+            "application/json": {"schema": {"$ref": "#/components/schemas/Pet"}}
+          }
+        },
+        "responses": {"201": {"description": "Created pet"}}
+      }
+    }
+  },
+  "components": {
+    "schemas": {
+      "Pet": {
+        "type": "object",
+        "required": ["name"],
+        "properties": {"name": {"type": "string"}}
+      }
+    },
+    "securitySchemes": {
+      "api_key": {"type": "apiKey", "in": "header", "name": "X-API-Key"}
+    }
+  }
+}`
+
+func TestOASImport(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	ts.Run(t, []test.TestCase{
+		{Method: http.MethodPost, Path: "/tyk/apis/oas?api_id=pets&org_id=default", Data: testOASDocument, AdminAuth: true, Code: http.StatusOK, BodyMatch: `"key":"pets"`},
+		{Method: http.MethodPost, Path: "/tyk/apis/oas", Data: `{"openapi": "3.0.0"}`, AdminAuth: true, Code: http.StatusBadRequest},
+		{Method: http.MethodPost, Path: "/tyk/apis/oas", Data: `not json`, AdminAuth: true, Code: http.StatusBadRequest},
+	}...)
+
+	defFilePath := filepath.Join(config.Global().AppPath, "pets.json")
+	defer os.Remove(defFilePath)
+
+	data, err := ioutil.ReadFile(defFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	def := apidef.APIDefinition{}
+	if err := json.Unmarshal(data, &def); err != nil {
+		t.Fatal(err)
+	}
+
+	if def.Proxy.ListenPath != "/pets/" || def.Proxy.TargetURL != "http://pets.example.com/v1" {
+		t.Errorf("Expected the API to proxy /pets/ to the server, got %s to %s", def.Proxy.ListenPath, def.Proxy.TargetURL)
+	}
+	if def.UseKeylessAccess || !def.UseStandardAuth || def.Auth.AuthHeaderName != "X-API-Key" {
+		t.Errorf("Expected keys in X-API-Key, got %+v", def.Auth)
+	}
+	if def.VersionData.DefaultVersion != "1.0.0" {
+		t.Errorf("Expected the version of the document to be the default, got %q", def.VersionData.DefaultVersion)
+	}
+	version := def.VersionData.Versions["1.0.0"]
+	if len(version.ExtendedPaths.TrackEndpoints) != 2 || len(version.ExtendedPaths.ValidateJSON) != 1 {
+		t.Errorf("Expected 2 endpoints and 1 validated body, got %+v", version.ExtendedPaths)
+	}
+}
+
+func TestOASExport(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Name = "Pets"
+		spec.UseKeylessAccess = false
+		spec.Auth.AuthHeaderName = "X-API-Key"
+		spec.Proxy.ListenPath = "/pets/"
+		UpdateAPIVersion(spec, "v1", func(v *apidef.VersionInfo) {
+			v.ExtendedPaths.TrackEndpoints = []apidef.TrackEndpointMeta{{Path: "/pets", Method: "GET"}}
+			v.ExtendedPaths.ValidateJSON = []apidef.ValidatePathMeta{{
+				Path:   "/pets",
+				Method: "POST",
+				Schema: map[string]interface{}{
+					"$ref": "#/components/schemas/Pet",
+					"components": map[string]interface{}{
+						"schemas": map[string]interface{}{"Pet": map[string]interface{}{"type": "object"}},
+					},
+				},
+			}}
+		})
+	})
+
+	ts.Run(t, []test.TestCase{
+		{Path: "/tyk/apis/unknown/oas", AdminAuth: true, Code: http.StatusNotFound},
+		{Path: "/tyk/apis/test/oas?version=v2", AdminAuth: true, Code: http.StatusNotFound},
+		{Path: "/tyk/apis/test/oas", AdminAuth: true, Code: http.StatusOK, BodyMatchFunc: func(body []byte) bool {
+			var doc oasDocument
+			if err := json.Unmarshal(body, &doc); err != nil {
+				t.Fatal(err)
+			}
+
+			if doc.OpenAPI != oasVersion || doc.Info.Title != "Pets" || doc.Info.Version != "v1" ||
+				!reflect.DeepEqual(doc.Servers, []oasServer{{URL: "/pets"}}) {
+				t.Errorf("Unexpected document %+v", doc)
+			}
+			if doc.Paths["/pets"]["get"] == nil || doc.Paths["/pets"]["post"] == nil {
+				t.Errorf("Expected GET and POST /pets, got %+v", doc.Paths)
+			}
+			post := doc.Paths["/pets"]["post"]
+			if post == nil || post.RequestBody == nil ||
+				!reflect.DeepEqual(post.RequestBody.Content["application/json"].Schema, map[string]interface{}{"$ref": "#/components/schemas/Pet"}) {
+				t.Errorf("Expected the request body to refer to the Pet schema, got %+v", post)
+			}
+			if doc.Components.Schemas["Pet"] == nil {
+				t.Error("Expected the Pet schema in the components")
+			}
+
+			scheme := oasSecurityScheme{Type: "apiKey", In: "header", Name: "X-API-Key"}
+			if doc.Components.SecuritySchemes["api_key"] != scheme ||
+				!reflect.DeepEqual(doc.Security, []map[string][]string{{"api_key": {}}}) {
+				t.Errorf("Expected the API to require keys, got %+v, %+v", doc.Components.SecuritySchemes, doc.Security)
+			}
+			return true
+		}},
+	}...)
+}
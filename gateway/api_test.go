@@ -129,6 +129,43 @@ func TestApiHandlerPostDupPath(t *testing.T) {
 	})
 }
 
+func TestApiHandlerPostInvalid(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	spec := BuildAPI(func(spec *APISpec) {
+		spec.APIID = "invalid"
+		spec.Proxy.TargetURL = "upstream"
+		spec.AllowedIPs = []string{"localhost"}
+	})[0]
+	invalidJSON, _ := json.Marshal(spec.APIDefinition)
+
+	ts.Run(t, []test.TestCase{
+		{Method: "POST", Path: "/tyk/apis", Data: string(invalidJSON), AdminAuth: true, Code: http.StatusBadRequest,
+			BodyMatch: `"field":"proxy.target_url"`},
+		{Method: "POST", Path: "/tyk/apis", Data: string(invalidJSON), AdminAuth: true, Code: http.StatusBadRequest,
+			BodyMatch: `"field":"allowed_ips"`},
+	}...)
+
+	t.Run("Skip invalid definitions on load", func(t *testing.T) {
+		LoadAPI(BuildAPI(
+			func(spec *APISpec) { spec.APIID = "valid" },
+			func(spec *APISpec) {
+				spec.APIID = "invalid"
+				spec.Proxy.ListenPath = "/invalid"
+				spec.VersionData.Versions = nil
+			},
+		)...)
+
+		if getApiSpec("valid") == nil {
+			t.Error("Valid definition should be loaded")
+		}
+		if getApiSpec("invalid") != nil {
+			t.Error("Invalid definition should be skipped")
+		}
+	})
+}
+
 func TestKeyHandler(t *testing.T) {
 	ts := StartTest()
 	defer ts.Close()
@@ -328,6 +365,61 @@ func TestKeyHandler_UpdateKey(t *testing.T) {
 	})
 }
 
+func TestKeyHandler_Version(t *testing.T) {
+	const testAPIID = "testAPIID"
+
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = testAPIID
+		spec.UseKeylessAccess = false
+	})
+
+	session, key := ts.CreateSession(func(s *user.SessionState) {
+		s.AccessRights = map[string]user.AccessDefinition{testAPIID: {
+			APIID: testAPIID, Versions: []string{"v1"},
+		}}
+	})
+	path := "/tyk/keys/" + key
+	update := func(version int64) []byte {
+		session.Version = version
+		sessionData, _ := json.Marshal(session)
+		return sessionData
+	}
+
+	ts.Run(t, []test.TestCase{
+		{Method: http.MethodGet, Path: path, AdminAuth: true, Code: http.StatusOK, HeadersMatch: map[string]string{"ETag": `"1"`}},
+		{Method: http.MethodPut, Path: path, Data: update(0), Headers: map[string]string{"If-Match": `"1"`}, AdminAuth: true, Code: http.StatusOK},
+		// Another caller updating the version it read before
+		{Method: http.MethodPut, Path: path, Data: update(0), Headers: map[string]string{"If-Match": `"1"`}, AdminAuth: true, Code: http.StatusConflict},
+		{Method: http.MethodPut, Path: path, Data: update(1), AdminAuth: true, Code: http.StatusConflict, BodyMatch: "version is 2"},
+		{Method: http.MethodPut, Path: path, Data: update(2), AdminAuth: true, Code: http.StatusOK},
+		{Method: http.MethodPut, Path: path, Data: update(0), Headers: map[string]string{"If-Match": "latest"}, AdminAuth: true, Code: http.StatusBadRequest},
+		// Updates without version aren't checked
+		{Method: http.MethodPut, Path: path, Data: update(0), AdminAuth: true, Code: http.StatusOK},
+		{Method: http.MethodGet, Path: path, AdminAuth: true, Code: http.StatusOK, BodyMatch: `"version":4`, HeadersMatch: map[string]string{"ETag": `"4"`}},
+	}...)
+
+	// Another gateway writing the key between the check and the write
+	stored, _ := FallbackKeySesionManager.SessionDetail(key, false)
+	ok, err := FallbackKeySesionManager.Store().CompareAndSetKey(key, func(string, bool) bool {
+		stored.Version++
+		FallbackKeySesionManager.UpdateSession(key, &stored, 0, false)
+		return true
+	}, "{}", 0)
+	if ok || err != nil {
+		t.Errorf("Expected the write to be aborted, got %v, %v", ok, err)
+	}
+
+	stale := stored
+	stale.Version = 4
+	if err := FallbackKeySesionManager.UpdateSessionIfVersion(key, &stale, 4, 0, false); err != errSessionVersionConflict {
+		t.Errorf("Expected a conflict, got %v", err)
+	}
+	ts.Run(t, test.TestCase{Method: http.MethodGet, Path: path, AdminAuth: true, Code: http.StatusOK, HeadersMatch: map[string]string{"ETag": `"5"`}})
+}
+
 func TestHashKeyHandler(t *testing.T) {
 	globalConf := config.Global()
 	// make it to use hashes for Redis keys
@@ -791,6 +883,32 @@ func TestInvalidateCache(t *testing.T) {
 	}...)
 }
 
+func TestInvalidateCacheByPattern(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+	cache := storage.RedisCluster{KeyPrefix: "cache-"}
+	defer cache.DeleteScanMatch("*")
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.CacheOptions = apidef.CacheOptions{
+			CacheTimeout:         120,
+			EnableCache:          true,
+			CacheAllSafeRequests: true,
+		}
+	})
+
+	headerCache := map[string]string{"x-tyk-cached-response": "1"}
+
+	ts.Run(t, []test.TestCase{
+		{Path: "/users/1", HeadersNotMatch: headerCache},
+		{Path: "/orders/1", HeadersNotMatch: headerCache, Delay: 10 * time.Millisecond},
+		{Method: "DELETE", Path: "/tyk/cache/test?pattern=/users/*", AdminAuth: true, Code: 200},
+		{Path: "/users/1", HeadersNotMatch: headerCache},
+		{Path: "/orders/1", HeadersMatch: headerCache},
+	}...)
+}
+
 func TestGetOAuthClients(t *testing.T) {
 	ts := StartTest()
 	defer ts.Close()
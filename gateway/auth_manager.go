@@ -3,6 +3,7 @@ package gateway
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"strings"
 	"sync"
 	"time"
@@ -30,6 +31,7 @@ type AuthorisationHandler interface {
 type SessionHandler interface {
 	Init(store storage.Handler)
 	UpdateSession(keyName string, session *user.SessionState, resetTTLTo int64, hashed bool) error
+	UpdateSessionIfVersion(keyName string, session *user.SessionState, version, resetTTLTo int64, hashed bool) error
 	RemoveSession(keyName string, hashed bool) bool
 	SessionDetail(keyName string, hashed bool) (user.SessionState, bool)
 	Sessions(filter string) []string
@@ -204,6 +206,15 @@ func (b *DefaultSessionManager) ResetQuota(keyName string, session *user.Session
 		rawKey = QuotaKeyPrefix + apiID + "-" + keyName
 		go b.store.DeleteRawKey(rawKey)
 	}
+
+	// Counters of the current calendar period
+	if session.QuotaRules.Reset == user.QuotaResetMonthly {
+		suffix := "-" + time.Now().UTC().Format(quotaPeriodLayout)
+		go b.store.DeleteRawKey(QuotaKeyPrefix + keyName + suffix)
+		for apiID := range session.AccessRights {
+			go b.store.DeleteRawKey(QuotaKeyPrefix + apiID + "-" + keyName + suffix)
+		}
+	}
 }
 
 func (b *DefaultSessionManager) clearCacheForKey(keyName string, hashed bool) {
@@ -260,6 +271,50 @@ func (b *DefaultSessionManager) UpdateSession(keyName string, session *user.Sess
 	return err
 }
 
+// errSessionVersionConflict is returned for updates of sessions written by
+// another update since they were read.
+var errSessionVersionConflict = errors.New("key was modified by another update")
+
+// UpdateSessionIfVersion writes the session as UpdateSession does, but only
+// if the stored session is still at version. The check and the write are
+// atomic across gateways sharing the storage, so of the updates of a version
+// all but one fail with errSessionVersionConflict. Writes are never async.
+// Storages which can't check atomically are written unchecked.
+func (b *DefaultSessionManager) UpdateSessionIfVersion(keyName string, session *user.SessionState,
+	version, resetTTLTo int64, hashed bool) error {
+	defer b.clearCacheForKey(keyName, hashed)
+
+	v, err := json.Marshal(session)
+	if err != nil {
+		log.Error("Error marshalling session for sync update")
+		return err
+	}
+
+	check := func(value string, found bool) bool {
+		var stored user.SessionState
+		return found && json.Unmarshal([]byte(value), &stored) == nil && stored.Version == version
+	}
+	var ok bool
+	if hashed {
+		ok, err = b.store.CompareAndSetRawKey(b.store.GetKeyPrefix()+keyName, check, string(v), resetTTLTo)
+	} else {
+		ok, err = b.store.CompareAndSetKey(keyName, check, string(v), resetTTLTo)
+	}
+
+	switch {
+	case err == storage.ErrNotSupported:
+		if hashed {
+			return b.store.SetRawKey(b.store.GetKeyPrefix()+keyName, string(v), resetTTLTo)
+		}
+		return b.store.SetKey(keyName, string(v), resetTTLTo)
+	case err != nil:
+		return err
+	case !ok:
+		return errSessionVersionConflict
+	}
+	return nil
+}
+
 // RemoveSession removes session from storage
 func (b *DefaultSessionManager) RemoveSession(keyName string, hashed bool) bool {
 	defer b.clearCacheForKey(keyName, hashed)
@@ -0,0 +1,113 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/TykTechnologies/murmur3"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/request"
+)
+
+// variantStable is the variant of the requests not sent to the canary.
+const variantStable = "stable"
+
+// Canary routes the requests to a version it selects to an alternate
+// upstream.
+type Canary struct {
+	conf   apidef.CanaryMeta
+	target *url.URL
+}
+
+func NewCanary(conf apidef.CanaryMeta) (*Canary, error) {
+	target, err := url.Parse(conf.TargetURL)
+	if err != nil {
+		return nil, err
+	}
+	if conf.Name == "" {
+		conf.Name = "canary"
+	}
+	return &Canary{conf: conf, target: target}, nil
+}
+
+// Variant returns the variant r is routed to, the name of the canary or
+// "stable".
+func (c *Canary) Variant(r *http.Request) string {
+	if c.selects(r) {
+		return c.conf.Name
+	}
+	return variantStable
+}
+
+// canary returns the canary of the version r is to, if it has one.
+func (s *APISpec) canary(r *http.Request) *Canary {
+	if version := ctxGetVersionInfo(r); version != nil {
+		return s.Canaries[version.Name]
+	}
+	return nil
+}
+
+func (c *Canary) selects(r *http.Request) bool {
+	if c.conf.Header != "" {
+		if values, ok := r.Header[http.CanonicalHeaderKey(c.conf.Header)]; ok && matchesAny(values, c.conf.HeaderValues) {
+			return true
+		}
+	}
+
+	if c.conf.Claim != "" {
+		if claim, ok := ctxGetData(r)["jwt_claims_"+c.conf.Claim]; ok && matchesAny(claimValues(claim), c.conf.ClaimValues) {
+			return true
+		}
+	}
+
+	if session := ctxGetSession(r); session != nil && len(c.conf.KeyTags) > 0 {
+		for _, tag := range session.Tags {
+			if matchesAny([]string{tag}, c.conf.KeyTags) {
+				return true
+			}
+		}
+	}
+
+	if c.conf.Percentage <= 0 {
+		return false
+	}
+	// Hashing the key or IP keeps clients on the same variant
+	id := ctxGetAuthToken(r)
+	if id == "" {
+		id = request.RealIP(r)
+	}
+	return float64(murmur3.Sum32([]byte(id))%10000) < c.conf.Percentage*100
+}
+
+// matchesAny tells whether any of values is one of wanted, or whether there
+// is any value if nothing is wanted.
+func matchesAny(values, wanted []string) bool {
+	if len(wanted) == 0 {
+		return len(values) > 0
+	}
+	for _, value := range values {
+		for _, w := range wanted {
+			if value == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// claimValues returns the values of a claim, as strings.
+func claimValues(claim interface{}) []string {
+	switch x := claim.(type) {
+	case []interface{}:
+		values := make([]string, len(x))
+		for i, v := range x {
+			values[i] = fmt.Sprint(v)
+		}
+		return values
+	case nil:
+		return nil
+	}
+	return []string{fmt.Sprint(claim)}
+}
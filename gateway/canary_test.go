@@ -0,0 +1,86 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	msgpack "gopkg.in/vmihailenco/msgpack.v2"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestCanary(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	stable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("stable " + r.URL.Path))
+	}))
+	defer stable.Close()
+	canary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("canary " + r.URL.Path))
+	}))
+	defer canary.Close()
+
+	load := func(conf apidef.CanaryMeta) {
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.Proxy.ListenPath = "/"
+			spec.Proxy.TargetURL = stable.URL
+			spec.VersionData.NotVersioned = true
+			conf.Enabled = true
+			conf.TargetURL = canary.URL + "/next"
+			v := spec.VersionData.Versions["v1"]
+			v.Canary = conf
+			spec.VersionData.Versions["v1"] = v
+		})
+	}
+
+	t.Run("By header", func(t *testing.T) {
+		load(apidef.CanaryMeta{Header: "X-Canary", HeaderValues: []string{"yes"}})
+
+		ts.Run(t, []test.TestCase{
+			{Path: "/orders", BodyMatch: "stable /orders"},
+			{Path: "/orders", Headers: map[string]string{"X-Canary": "no"}, BodyMatch: "stable /orders"},
+			{Path: "/orders", Headers: map[string]string{"X-Canary": "yes"}, BodyMatch: "canary /next/orders"},
+		}...)
+	})
+
+	t.Run("By percentage", func(t *testing.T) {
+		load(apidef.CanaryMeta{Percentage: 100})
+		ts.Run(t, test.TestCase{Path: "/orders", BodyMatch: "canary /next/orders"})
+
+		load(apidef.CanaryMeta{Percentage: 0})
+		ts.Run(t, test.TestCase{Path: "/orders", BodyMatch: "stable /orders"})
+	})
+
+	t.Run("Tagged in analytics", func(t *testing.T) {
+		load(apidef.CanaryMeta{Name: "next", Header: "X-Canary"})
+
+		time.Sleep(recordsBufferFlushInterval + 50)
+		analytics.Store.GetAndDeleteSet(analyticsKeyName)
+
+		ts.Run(t, []test.TestCase{
+			{Path: "/orders"},
+			{Path: "/orders", Headers: map[string]string{"X-Canary": "1"}},
+		}...)
+
+		variants := map[string]int{}
+		for i, records := 0, 0; i < 10 && records < 2; i++ {
+			time.Sleep(recordsBufferFlushInterval + 50)
+			for _, v := range analytics.Store.GetAndDeleteSet(analyticsKeyName) {
+				var record AnalyticsRecord
+				msgpack.Unmarshal(v.([]byte), &record)
+				for _, tag := range record.Tags {
+					variants[tag]++
+				}
+				records++
+			}
+		}
+		if variants["variant-next"] != 1 || variants["variant-stable"] != 1 {
+			t.Errorf("Expected a request tagged with each variant, got tags %v", variants)
+		}
+	})
+}
@@ -1,18 +1,34 @@
 package gateway
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/TykTechnologies/tyk/certs"
 	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/ctx"
+	"github.com/TykTechnologies/tyk/headers"
 
 	"github.com/gorilla/mux"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 type APICertificateStatusMessage struct {
@@ -25,6 +41,27 @@ type APIAllCertificates struct {
 	CertIDs []string `json:"certs"`
 }
 
+// APIBatchCertificateResult is the result of adding one certificate of a batch.
+// Name is the archive file the certificate was read from.
+type APIBatchCertificateResult struct {
+	Name string `json:"name,omitempty"`
+	certs.BatchResult
+}
+
+type APIBatchCertificates struct {
+	Results []APIBatchCertificateResult `json:"results"`
+}
+
+// APICertificateRequest is a generated certificate signing request.
+type APICertificateRequest struct {
+	ID  string `json:"id"`
+	CSR string `json:"csr"`
+}
+
+type APIAllCRLs struct {
+	CRLIDs []string `json:"crls"`
+}
+
 var cipherSuites = map[string]uint16{
 	"TLS_RSA_WITH_RC4_128_SHA":                0x0005,
 	"TLS_RSA_WITH_3DES_EDE_CBC_SHA":           0x000a,
@@ -97,6 +134,27 @@ func getUpstreamCertificate(host string, spec *APISpec) (cert *tls.Certificate)
 	return certs[0]
 }
 
+// upstreamClientCertificate presents the client certificate mapped to the
+// upstream host, so each upstream gets its own certificate over the shared
+// transport. Host is the dialled one, or the server name set in handshake
+// context by the proxy. Certificates are listed on every handshake, so new
+// connections use rotated certificates.
+func upstreamClientCertificate(spec *APISpec, dialledHost string) func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return func(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		host := dialledHost
+		if host == "" {
+			host, _ = info.Context().Value(ctx.UpstreamHost).(string)
+		}
+
+		if cert := getUpstreamCertificate(host, spec); cert != nil {
+			return cert, nil
+		}
+
+		// Empty certificate is not sent
+		return &tls.Certificate{}, nil
+	}
+}
+
 func verifyPeerCertificatePinnedCheck(spec *APISpec, tlsConfig *tls.Config) func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
 	if (spec == nil || len(spec.PinnedPublicKeys) == 0) && len(config.Global().Security.PinnedPublicKeys) == 0 {
 		return nil
@@ -141,12 +199,16 @@ func dialTLSPinnedCheck(spec *APISpec, tc *tls.Config) func(network, addr string
 		clone := tc.Clone()
 		clone.InsecureSkipVerify = true
 
+		host, _, _ := net.SplitHostPort(addr)
+		if clone.GetClientCertificate != nil {
+			clone.GetClientCertificate = upstreamClientCertificate(spec, host)
+		}
+
 		c, err := tls.Dial(network, addr, clone)
 		if err != nil {
 			return c, err
 		}
 
-		host, _, _ := net.SplitHostPort(addr)
 		whitelist := getPinnedPublicKeys(host, spec)
 		if len(whitelist) == 0 {
 			return c, nil
@@ -217,8 +279,7 @@ func dummyGetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
 	return nil, nil
 }
 
-func getTLSConfigForClient(baseConfig *tls.Config, listenPort int) func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
-
+func loadServerCertificates(baseConfig *tls.Config) {
 	// Supporting legacy certificate configuration
 	serverCerts := []tls.Certificate{}
 	certNameMap := map[string]*tls.Certificate{}
@@ -243,9 +304,45 @@ func getTLSConfigForClient(baseConfig *tls.Config, listenPort int) func(hello *t
 	for name, cert := range certNameMap {
 		baseConfig.NameToCertificate[name] = cert
 	}
+}
+
+// serverCertificatesVersion is bumped when stored certificates are replaced,
+// so TLS listeners reload their server certificates on the next handshake.
+var serverCertificatesVersion int64
+
+// certificateLoadContext limits loading of certificates during TLS handshake
+// by the configured timeout.
+func certificateLoadContext() (context.Context, context.CancelFunc) {
+	if timeout := config.Global().Security.CertificateCache.LoadTimeout; timeout > 0 {
+		return context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	}
+
+	return context.WithCancel(context.Background())
+}
+
+func getTLSConfigForClient(baseConfig *tls.Config, listenPort int) func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+	var mu sync.Mutex
+	version := atomic.LoadInt64(&serverCertificatesVersion)
+	loadServerCertificates(baseConfig)
 
 	return func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		mu.Lock()
+		if v := atomic.LoadInt64(&serverCertificatesVersion); v != version {
+			loadServerCertificates(baseConfig)
+			version = v
+		}
 		newConfig := baseConfig.Clone()
+		mu.Unlock()
+
+		if SessionTicketKeys != nil {
+			if keys := SessionTicketKeys.Keys(); len(keys) > 0 {
+				newConfig.SetSessionTicketKeys(keys)
+			}
+		}
+
+		if policy, ok := portTLSPolicy(hello, listenPort); ok {
+			applyTLSPolicy(newConfig, policy)
+		}
 
 		isControlAPI := (listenPort != 0 && config.Global().ControlAPIPort == listenPort) || (config.Global().ControlAPIHostname == hello.ServerName)
 
@@ -256,13 +353,44 @@ func getTLSConfigForClient(baseConfig *tls.Config, listenPort int) func(hello *t
 			return newConfig, nil
 		}
 
+		ctx, cancel := certificateLoadContext()
+		defer cancel()
+
+		if ACMEManager != nil {
+			// Answer ACME TLS-SNI challenges with the validation certificates
+			if strings.HasSuffix(hello.ServerName, ".acme.invalid") {
+				newConfig.GetCertificate = LE_MANAGER.GetCertificate
+				return newConfig, nil
+			}
+
+			acmeCertIDs := ACMEManager.CertIDs(config.Global().HttpServerOptions.ACME.Hosts)
+			acmeCerts, err := CertificateManager.ListContext(ctx, acmeCertIDs, certs.CertificatePrivate)
+			if err != nil {
+				log.Warning("Can't load ACME certificates: ", err)
+			}
+			for _, cert := range acmeCerts {
+				if cert == nil {
+					continue
+				}
+
+				newConfig.Certificates = append(newConfig.Certificates, *cert)
+				for _, san := range cert.Leaf.DNSNames {
+					newConfig.NameToCertificate[san] = cert
+				}
+			}
+		}
+
 		apisMu.RLock()
 		defer apisMu.RUnlock()
 
 		// Dynamically add API specific certificates
 		for _, spec := range apiSpecs {
 			if len(spec.Certificates) != 0 {
-				for _, cert := range CertificateManager.List(spec.Certificates, certs.CertificatePrivate) {
+				apiCerts, err := CertificateManager.ListContext(ctx, spec.Certificates, certs.CertificatePrivate)
+				if err != nil {
+					log.Warning("Can't load certificates of API ", spec.APIID, ": ", err)
+				}
+				for _, cert := range apiCerts {
 					newConfig.Certificates = append(newConfig.Certificates, *cert)
 
 					if cert != nil {
@@ -277,33 +405,220 @@ func getTLSConfigForClient(baseConfig *tls.Config, listenPort int) func(hello *t
 			}
 		}
 
+		// Policies of APIs served on the domain, in order of loading
+		for _, spec := range apiSpecs {
+			if spec.Domain != "" && spec.Domain == hello.ServerName {
+				applyTLSPolicy(newConfig, spec.TLSPolicy)
+			}
+		}
+
 		for _, spec := range apiSpecs {
 			if spec.UseMutualTLSAuth && spec.Domain != "" && spec.Domain == hello.ServerName {
 				newConfig.ClientAuth = tls.RequireAndVerifyClientCert
 				certIDs := append(spec.ClientCertificates, config.Global().Security.Certificates.API...)
 				newConfig.ClientCAs = CertificateManager.CertPool(certIDs)
+				if len(spec.ClientCertificateValidation.SPIFFEIDs) > 0 && SPIFFESource != nil {
+					for _, cert := range SPIFFESource.Bundle() {
+						newConfig.ClientCAs.AddCert(cert)
+					}
+				}
 				break
 			}
 		}
 
+		// Layer 4 APIs without domain verify client certificates of all
+		// connections to their port
+		if newConfig.ClientAuth == tls.NoClientCert {
+			for _, spec := range apiSpecs {
+				if isTCPSpec(spec) && spec.ListenPort == listenPort && spec.Domain == "" && spec.UseMutualTLSAuth {
+					newConfig.ClientAuth = tls.RequireAndVerifyClientCert
+					certIDs := append([]string{}, spec.ClientCertificates...)
+					newConfig.ClientCAs = CertificateManager.CertPool(append(certIDs, config.Global().Security.Certificates.API...))
+					break
+				}
+			}
+		}
+
 		// No mutual tls APIs with matched domain found
 		// Check if one of APIs without domain, require asking client cert
 		if newConfig.ClientAuth == tls.NoClientCert {
 			for _, spec := range apiSpecs {
-				if spec.Auth.UseCertificate || (spec.Domain == "" && spec.UseMutualTLSAuth) {
+				if spec.Auth.UseCertificate || spec.CertificateBoundTokens || (spec.Domain == "" && spec.UseMutualTLSAuth && !isTCPSpec(spec)) {
 					newConfig.ClientAuth = tls.RequestClientCert
 					break
 				}
 			}
 		}
 
+		if config.Global().Security.OCSP.StapleServerCertificates {
+			stapleCertificates(newConfig)
+		}
+
+		if CertificateSelector != nil {
+			newConfig.GetCertificate = selectServerCertificate(newConfig.NameToCertificate)
+		}
+
 		return newConfig, nil
 	}
 }
 
+// selectServerCertificate serves certificates configured for the exact
+// server name first, and otherwise any stored certificate matching it.
+func selectServerCertificate(nameToCertificate map[string]*tls.Certificate) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if cert, ok := nameToCertificate[strings.ToLower(hello.ServerName)]; ok {
+			return cert, nil
+		}
+
+		cert, err := CertificateSelector.GetCertificate(hello)
+		if cert != nil && config.Global().Security.OCSP.StapleServerCertificates {
+			cert = OCSPManager.Staple(cert)
+		}
+
+		return cert, err
+	}
+}
+
+// stapleCertificates attaches OCSP responses to the server certificates.
+// Certificates are copied, since the config shares them with the base config.
+func stapleCertificates(tlsConfig *tls.Config) {
+	certificates := make([]tls.Certificate, len(tlsConfig.Certificates))
+	for i := range tlsConfig.Certificates {
+		certificates[i] = *OCSPManager.Staple(&tlsConfig.Certificates[i])
+	}
+	tlsConfig.Certificates = certificates
+
+	nameToCertificate := make(map[string]*tls.Certificate, len(tlsConfig.NameToCertificate))
+	for name, cert := range tlsConfig.NameToCertificate {
+		nameToCertificate[name] = OCSPManager.Staple(cert)
+	}
+	tlsConfig.NameToCertificate = nameToCertificate
+}
+
+func certificateValidationOptions(meta apidef.CertificateValidationMeta) certs.ValidationOptions {
+	opts := certs.ValidationOptions{
+		VerifyChain:          meta.VerifyChain,
+		Intermediates:        meta.Intermediates,
+		UsePeerIntermediates: meta.UsePeerIntermediates,
+		CheckExpiry:          meta.CheckExpiry,
+	}
+
+	if meta.SkipKeyUsageCheck {
+		opts.KeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageAny}
+	}
+
+	if len(meta.SPIFFEIDs) > 0 {
+		opts.SPIFFEIDs = meta.SPIFFEIDs
+		if SPIFFESource != nil {
+			opts.SPIFFEBundle = SPIFFESource.Bundle()
+		}
+	}
+
+	for _, rule := range meta.SubjectRules {
+		opts.SubjectRules = append(opts.SubjectRules, certs.SubjectRule{
+			CommonName:         rule.CommonName,
+			Organization:       rule.Organization,
+			OrganizationalUnit: rule.OrganizationalUnit,
+			SAN:                rule.SAN,
+		})
+	}
+
+	return opts
+}
+
+func setupCertificateExpiryMonitor(conf config.CertificateExpiryMonitorConfig) *certs.ExpiryWatcher {
+	var thresholds []time.Duration
+	for _, days := range conf.WarningThresholds {
+		thresholds = append(thresholds, time.Duration(days)*24*time.Hour)
+	}
+
+	watcher := certs.NewExpiryWatcher(CertificateManager, thresholds)
+	watcher.AddHandler(fireCertificateExpiryEvent)
+
+	return watcher
+}
+
+func fireCertificateExpiryEvent(meta *certs.CertificateMeta, threshold time.Duration) {
+	daysLeft := int(time.Until(meta.NotAfter).Hours() / 24)
+
+	// Stored certificate IDs are prefixed with org ID
+	orgID := strings.TrimSuffix(meta.ID, meta.Fingerprint)
+
+	event := EventCertificateExpiringSoon
+	message := "Certificate is about to expire"
+	if threshold == 0 {
+		event = EventCertificateExpired
+		message = "Certificate has expired"
+	}
+
+	certLog.WithField("cert_id", meta.ID).WithField("not_after", meta.NotAfter).Warning(message)
+
+	FireSystemEvent(event, EventCertificateExpiryMeta{
+		EventMetaDefault: EventMetaDefault{Message: message},
+		CertID:           meta.ID,
+		OrgID:            orgID,
+		NotAfter:         meta.NotAfter,
+		DaysLeft:         daysLeft,
+	})
+}
+
+// certificateOrg returns the organisation a request to the certificate API is
+// scoped to. Organisations are scoped to their own certificates, whatever the
+// org_id query parameter. Requests made with the secret of the gateway are
+// scoped to org_id, and to all organisations without it.
+func certificateOrg(r *http.Request) string {
+	if orgID := ctxGetCertificateOrg(r); orgID != "" {
+		return orgID
+	}
+	return r.URL.Query().Get("org_id")
+}
+
+// certificateOwned checks that the certificate belongs to the organisation the
+// request is scoped to.
+func certificateOwned(r *http.Request, certID string) bool {
+	if orgID := certificateOrg(r); orgID != "" {
+		return CertificateManager.ForOrg(orgID).Owns(certID)
+	}
+	return true
+}
+
+// certificateAdmin checks that the request is not scoped to an organisation
+// by its caller, for operations across organisations.
+func certificateAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if ctxGetCertificateOrg(r) != "" {
+		doJSONWrite(w, http.StatusForbidden, apiError("Attempted administrative access with invalid or missing key!"))
+		return false
+	}
+	return true
+}
+
+// certificateErrorCode maps errors of certificate operations to HTTP status
+// codes. Other errors are reported with the fallback code.
+func certificateErrorCode(err error, fallback int) int {
+	switch {
+	case errors.Is(err, certs.ErrCertExists), errors.Is(err, certs.ErrCertInUse):
+		return http.StatusConflict
+	case errors.Is(err, certs.ErrCertNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, certs.ErrKeyMismatch), errors.Is(err, certs.ErrUnsupportedKeyType):
+		return http.StatusBadRequest
+	default:
+		return fallback
+	}
+}
+
 func certHandler(w http.ResponseWriter, r *http.Request) {
 	certID := mux.Vars(r)["certID"]
 
+	if certID != "" && r.Method != "POST" {
+		for _, id := range strings.Split(certID, ",") {
+			if !certificateOwned(r, id) {
+				doJSONWrite(w, http.StatusNotFound, apiError("Certificate with given SHA256 fingerprint not found"))
+				return
+			}
+		}
+	}
+
 	switch r.Method {
 	case "POST":
 		content, err := ioutil.ReadAll(r.Body)
@@ -312,19 +627,43 @@ func certHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		orgID := r.URL.Query().Get("org_id")
+		orgID := certificateOrg(r)
 		var certID string
-		if certID, err = CertificateManager.Add(content, orgID); err != nil {
-			doJSONWrite(w, http.StatusForbidden, apiError(err.Error()))
+		if r.Header.Get(headers.ContentType) == headers.ApplicationP12 {
+			certID, err = CertificateManager.AuditedBy(r.RemoteAddr).AddPKCS12(content, r.Header.Get(headers.XTykCertPassphrase), orgID)
+		} else if keyURI := r.Header.Get(headers.XTykCertKeyURI); keyURI != "" {
+			certID, err = CertificateManager.AuditedBy(r.RemoteAddr).AddWithKeyURI(content, keyURI, orgID)
+		} else if passphrase := r.Header.Get(headers.XTykCertPassphrase); passphrase != "" {
+			certID, err = CertificateManager.AuditedBy(r.RemoteAddr).AddWithPassphrase(content, passphrase, orgID)
+		} else {
+			certID, err = CertificateManager.AuditedBy(r.RemoteAddr).Add(content, orgID)
+		}
+
+		if err != nil {
+			doJSONWrite(w, certificateErrorCode(err, http.StatusForbidden), apiError(err.Error()))
 			return
 		}
 
+		notifyCertificateChanged(certID)
 		doJSONWrite(w, http.StatusOK, &APICertificateStatusMessage{certID, "ok", "Certificate added"})
 	case "GET":
 		if certID == "" {
-			orgID := r.URL.Query().Get("org_id")
+			orgID := certificateOrg(r)
+
+			// Detailed mode returns pages of certificate meta information
+			if r.URL.Query().Get("mode") == "detailed" {
+				pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+				page := CertificateManager.ListPage(orgID, r.URL.Query().Get("cursor"), pageSize)
+				doJSONWrite(w, http.StatusOK, page)
+				return
+			}
 
-			certIds := CertificateManager.ListAllIds(orgID)
+			var certIds []string
+			if orgID != "" {
+				certIds = CertificateManager.ForOrg(orgID).ListAllIds()
+			} else {
+				certIds = CertificateManager.ListAllIds("")
+			}
 			doJSONWrite(w, http.StatusOK, &APIAllCertificates{certIds})
 			return
 		}
@@ -338,13 +677,13 @@ func certHandler(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
-			doJSONWrite(w, http.StatusOK, certs.ExtractCertificateMeta(certificates[0], certIDs[0]))
+			doJSONWrite(w, http.StatusOK, CertificateManager.CertificateMeta(certificates[0], certIDs[0]))
 			return
 		} else {
 			var meta []*certs.CertificateMeta
 			for ci, cert := range certificates {
 				if cert != nil {
-					meta = append(meta, certs.ExtractCertificateMeta(cert, certIDs[ci]))
+					meta = append(meta, CertificateManager.CertificateMeta(cert, certIDs[ci]))
 				} else {
 					meta = append(meta, nil)
 				}
@@ -353,8 +692,739 @@ func certHandler(w http.ResponseWriter, r *http.Request) {
 			doJSONWrite(w, http.StatusOK, meta)
 			return
 		}
+	case "PUT":
+		content, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			doJSONWrite(w, 405, apiError("Malformed request body"))
+			return
+		}
+
+		if r.Header.Get(headers.ContentType) == headers.ApplicationP12 {
+			content, err = certs.PKCS12ToPEM(content, r.Header.Get(headers.XTykCertPassphrase))
+			if err != nil {
+				doJSONWrite(w, http.StatusForbidden, apiError("Failed to decode PKCS#12 bundle: "+err.Error()))
+				return
+			}
+		}
+
+		if err := CertificateManager.Replace(certID, content); err != nil {
+			doJSONWrite(w, certificateErrorCode(err, http.StatusForbidden), apiError(err.Error()))
+			return
+		}
+
+		notifyCertificateChanged(certID)
+		doJSONWrite(w, http.StatusOK, &APICertificateStatusMessage{certID, "ok", "Certificate replaced"})
+	case "DELETE":
+		// Referenced certificates are removed only if forced
+		audited := CertificateManager.AuditedBy(r.RemoteAddr)
+		if r.URL.Query().Get("force") == "true" {
+			audited.Delete(certID)
+		} else if err := audited.DeleteUnused(certID); err != nil {
+			doJSONWrite(w, certificateErrorCode(err, http.StatusConflict), apiError(err.Error()))
+			return
+		}
+
+		notifyCertificateChanged(certID)
+		doJSONWrite(w, http.StatusOK, &apiStatusMessage{"ok", "removed"})
+	}
+}
+
+// certUsageHandler lists places where the certificate is referenced.
+func certUsageHandler(w http.ResponseWriter, r *http.Request) {
+	certID := mux.Vars(r)["certID"]
+	if !certificateOwned(r, certID) {
+		doJSONWrite(w, http.StatusNotFound, apiError("Certificate with given SHA256 fingerprint not found"))
+		return
+	}
+
+	doJSONWrite(w, http.StatusOK, CertificateManager.Usages(certID))
+}
+
+// certDeletedHandler lists soft deleted certificates which can be restored.
+func certDeletedHandler(w http.ResponseWriter, r *http.Request) {
+	deleted := CertificateManager.ListDeleted(certificateOrg(r))
+	if deleted == nil {
+		deleted = []certs.DeletedCertificate{}
+	}
+
+	doJSONWrite(w, http.StatusOK, deleted)
+}
+
+// certRestoreHandler restores soft deleted certificate.
+func certRestoreHandler(w http.ResponseWriter, r *http.Request) {
+	certID := mux.Vars(r)["certID"]
+	if !certificateOwned(r, certID) {
+		doJSONWrite(w, http.StatusNotFound, apiError("Certificate with given SHA256 fingerprint not found"))
+		return
+	}
+
+	if err := CertificateManager.AuditedBy(r.RemoteAddr).Restore(certID); err != nil {
+		doJSONWrite(w, certificateErrorCode(err, http.StatusInternalServerError), apiError(err.Error()))
+		return
+	}
+
+	notifyCertificateChanged(certID)
+	if len(CertificateManager.Usages(certID)) > 0 {
+		onCertificateReplaced(certID)
+	}
+
+	doJSONWrite(w, http.StatusOK, &APICertificateStatusMessage{certID, "ok", "Certificate restored"})
+}
+
+// certBundleContentTypes are content types and file extensions of certificate
+// bundle formats.
+var certBundleContentTypes = map[certs.BundleFormat][2]string{
+	certs.BundlePEM:   {"application/x-pem-file", "pem"},
+	certs.BundleDER:   {"application/pkix-cert", "der"},
+	certs.BundlePKCS7: {"application/x-pkcs7-certificates", "p7b"},
+}
+
+// certBundleHandler returns certificate chain in the format from the format
+// query parameter: pem (default), der or pkcs7. PEM bundle includes the
+// private key unless exclude_key=true.
+func certBundleHandler(w http.ResponseWriter, r *http.Request) {
+	certID := mux.Vars(r)["certID"]
+	if !certificateOwned(r, certID) {
+		doJSONWrite(w, http.StatusNotFound, apiError("Certificate with given SHA256 fingerprint not found"))
+		return
+	}
+
+	format := certs.BundleFormat(r.URL.Query().Get("format"))
+	if format == "" {
+		format = certs.BundlePEM
+	}
+
+	contentType, found := certBundleContentTypes[format]
+	if !found {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Unsupported bundle format: "+string(format)))
+		return
+	}
+
+	bundle, err := CertificateManager.GetBundle(certID, format, r.URL.Query().Get("exclude_key") == "true")
+	if err != nil {
+		doJSONWrite(w, certificateErrorCode(err, http.StatusBadRequest), apiError(err.Error()))
+		return
+	}
+
+	w.Header().Set(headers.ContentType, contentType[0])
+	w.Header().Set("Content-Disposition", `attachment; filename="`+certID+"."+contentType[1]+`"`)
+	w.Write(bundle)
+}
+
+// Limits of batch uploads, so that archives can't exhaust memory when
+// decompressed.
+const (
+	maxBatchCertificates    = 1000
+	maxBatchCertificateSize = 1 << 20
+)
+
+var errBatchTooLarge = errors.New("Batch is over the limit of " + strconv.Itoa(maxBatchCertificates) +
+	" certificates of up to " + strconv.Itoa(maxBatchCertificateSize) + " bytes each")
+
+// certBatchHandler adds all certificates from a PEM bundle, or from the files
+// of a zip archive. PKCS#12 files in the archive are decoded with the
+// passphrase from the X-Tyk-Certificate-Passphrase header.
+func certBatchHandler(w http.ResponseWriter, r *http.Request) {
+	content, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		doJSONWrite(w, 405, apiError("Malformed request body"))
+		return
+	}
+
+	orgID := certificateOrg(r)
+
+	var results []APIBatchCertificateResult
+	var certsData [][]byte
+
+	if r.Header.Get(headers.ContentType) == headers.ApplicationZip {
+		archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+		if err != nil {
+			doJSONWrite(w, http.StatusBadRequest, apiError("Failed to read zip archive: "+err.Error()))
+			return
+		}
+
+		if len(archive.File) > maxBatchCertificates {
+			doJSONWrite(w, http.StatusBadRequest, apiError(errBatchTooLarge.Error()))
+			return
+		}
+
+		for _, file := range archive.File {
+			if file.FileInfo().IsDir() {
+				continue
+			}
+
+			data, err := readZipFile(file)
+			if err == errBatchTooLarge {
+				doJSONWrite(w, http.StatusBadRequest, apiError(err.Error()))
+				return
+			}
+			if err == nil && isPKCS12File(file.Name) {
+				data, err = certs.PKCS12ToPEM(data, r.Header.Get(headers.XTykCertPassphrase))
+			}
+
+			if err != nil {
+				results = append(results, APIBatchCertificateResult{Name: file.Name})
+				results[len(results)-1].Error = err.Error()
+				certsData = append(certsData, nil)
+				continue
+			}
+
+			for _, entry := range certs.SplitPEMBundle(data) {
+				results = append(results, APIBatchCertificateResult{Name: file.Name})
+				certsData = append(certsData, entry)
+			}
+		}
+	} else {
+		certsData = certs.SplitPEMBundle(content)
+		results = make([]APIBatchCertificateResult, len(certsData))
+	}
+
+	if len(certsData) == 0 {
+		doJSONWrite(w, http.StatusBadRequest, apiError("No certificates found"))
+		return
+	}
+	if len(certsData) > maxBatchCertificates {
+		doJSONWrite(w, http.StatusBadRequest, apiError(errBatchTooLarge.Error()))
+		return
+	}
+
+	// Entries which failed to be read keep their error
+	var toAdd [][]byte
+	for _, data := range certsData {
+		if data != nil {
+			toAdd = append(toAdd, data)
+		}
+	}
+
+	added := CertificateManager.AuditedBy(r.RemoteAddr).AddBatch(toAdd, orgID)
+	for _, result := range added {
+		if result.Error == "" {
+			notifyCertificateChanged(result.CertID)
+		}
+	}
+
+	for i := range results {
+		if certsData[i] != nil {
+			results[i].BatchResult, added = added[0], added[1:]
+		}
+	}
+
+	doJSONWrite(w, http.StatusOK, &APIBatchCertificates{results})
+}
+
+// readZipFile reads the archive file, failing with errBatchTooLarge if it's
+// over the size limit, whatever size its header claims.
+func readZipFile(file *zip.File) ([]byte, error) {
+	if file.UncompressedSize64 > maxBatchCertificateSize {
+		return nil, errBatchTooLarge
+	}
+
+	rc, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(rc, maxBatchCertificateSize+1))
+	if len(data) > maxBatchCertificateSize {
+		return nil, errBatchTooLarge
+	}
+	return data, err
+}
+
+func isPKCS12File(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".p12" || ext == ".pfx"
+}
+
+// certExportHandler returns an archive of organisation certificates, encrypted
+// with the passphrase from the X-Tyk-Certificate-Passphrase header.
+func certExportHandler(w http.ResponseWriter, r *http.Request) {
+	archive, err := CertificateManager.Export(certificateOrg(r), r.Header.Get(headers.XTykCertPassphrase))
+	if err != nil {
+		doJSONWrite(w, http.StatusBadRequest, apiError(err.Error()))
+		return
+	}
+
+	w.Header().Set(headers.ContentType, "application/x-pem-file")
+	w.Write(archive)
+}
+
+// certImportHandler adds certificates from an archive created by
+// certExportHandler. With dry_run=true certificates are only validated.
+func certImportHandler(w http.ResponseWriter, r *http.Request) {
+	if !certificateAdmin(w, r) {
+		return
+	}
+
+	content, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		doJSONWrite(w, 405, apiError("Malformed request body"))
+		return
+	}
+
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	imported, err := CertificateManager.Import(content, r.Header.Get(headers.XTykCertPassphrase), dryRun)
+	if err != nil {
+		doJSONWrite(w, http.StatusBadRequest, apiError(err.Error()))
+		return
+	}
+
+	results := make([]APIBatchCertificateResult, len(imported))
+	for i, result := range imported {
+		if result.Error == "" && !dryRun {
+			notifyCertificateChanged(result.CertID)
+		}
+		results[i].BatchResult = result
+	}
+
+	doJSONWrite(w, http.StatusOK, &APIBatchCertificates{results})
+}
+
+// certSearchHandler lists meta information of certificates matching query
+// parameters: org_id, cn, dns, expires_after and expires_before in RFC 3339
+// format, and tag in key:value format, which can be repeated.
+func certSearchHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	query := certs.CertificateQuery{
+		OrgID:      certificateOrg(r),
+		CommonName: params.Get("cn"),
+		DNSName:    params.Get("dns"),
+	}
+
+	for _, tag := range params["tag"] {
+		kv := strings.SplitN(tag, ":", 2)
+		if len(kv) != 2 {
+			doJSONWrite(w, http.StatusBadRequest, apiError("Tag should be in key:value format"))
+			return
+		}
+
+		if query.Tags == nil {
+			query.Tags = make(map[string]string)
+		}
+		query.Tags[kv[0]] = kv[1]
+	}
+
+	for param, t := range map[string]*time.Time{"expires_after": &query.ExpiresAfter, "expires_before": &query.ExpiresBefore} {
+		if value := params.Get(param); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				doJSONWrite(w, http.StatusBadRequest, apiError("Malformed "+param+": "+err.Error()))
+				return
+			}
+			*t = parsed
+		}
+	}
+
+	doJSONWrite(w, http.StatusOK, CertificateManager.Search(query))
+}
+
+// certJWKSHandler returns public keys of certificates as JWKS document. The
+// certs parameter is a comma separated list of certificate IDs, by default
+// all certificates of the org_id organisation are published.
+func certJWKSHandler(w http.ResponseWriter, r *http.Request) {
+	orgID := certificateOrg(r)
+
+	var certIDs []string
+	if ids := r.URL.Query().Get("certs"); ids != "" {
+		for _, id := range strings.Split(ids, ",") {
+			if certificateOwned(r, id) {
+				certIDs = append(certIDs, id)
+			}
+		}
+	} else if orgID != "" {
+		certIDs = CertificateManager.ForOrg(orgID).ListAllIds()
+	} else {
+		certIDs = CertificateManager.ListAllIds("")
+	}
+
+	doJSONWrite(w, http.StatusOK, CertificateManager.JWKS(certIDs))
+}
+
+// publishedJWKSHandler serves public keys of configured certificates without
+// authentication, so services can validate tokens signed by them.
+func publishedJWKSHandler(w http.ResponseWriter, r *http.Request) {
+	jwks := CertificateManager.JWKS(config.Global().Security.PublishedJWKS.Certificates)
+
+	w.Header().Set(headers.ContentType, "application/jwk-set+json")
+	json.NewEncoder(w).Encode(jwks)
+}
+
+// certMetricsHandler returns certificate metrics in Prometheus text format.
+func certMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if !certificateAdmin(w, r) {
+		return
+	}
+
+	w.Header().Set(headers.ContentType, "text/plain; version=0.0.4")
+	CertificateManager.WritePrometheus(w)
+}
+
+// certTagsHandler sets certificate tags from JSON object in request body.
+func certTagsHandler(w http.ResponseWriter, r *http.Request) {
+	certID := mux.Vars(r)["certID"]
+
+	var tags map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&tags); err != nil {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Request malformed"))
+		return
+	}
+
+	if raw, _ := CertificateManager.GetRaw(certID); raw == "" || !certificateOwned(r, certID) {
+		doJSONWrite(w, http.StatusNotFound, apiError("Certificate with given SHA256 fingerprint not found"))
+		return
+	}
+
+	if err := CertificateManager.SetTags(certID, tags); err != nil {
+		doJSONWrite(w, http.StatusInternalServerError, apiError(err.Error()))
+		return
+	}
+
+	doJSONWrite(w, http.StatusOK, &APICertificateStatusMessage{certID, "ok", "Tags updated"})
+}
+
+// certIssueHandler requests a new certificate from the configured issuer.
+func certIssueHandler(w http.ResponseWriter, r *http.Request) {
+	commonName := r.URL.Query().Get("common_name")
+	if commonName == "" {
+		doJSONWrite(w, http.StatusBadRequest, apiError("common_name is required"))
+		return
+	}
+
+	certID, err := CertificateManager.Issue(commonName, certificateOrg(r))
+	if err != nil {
+		doJSONWrite(w, http.StatusBadRequest, apiError(err.Error()))
+		return
+	}
+
+	notifyCertificateChanged(certID)
+	doJSONWrite(w, http.StatusOK, &APICertificateStatusMessage{certID, "ok", "Certificate issued"})
+}
+
+// certGenerateHandler creates a key with self signed certificate.
+func certGenerateHandler(w http.ResponseWriter, r *http.Request) {
+	var opts certs.GenerateOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Request malformed"))
+		return
+	}
+
+	certID, err := CertificateManager.GenerateSelfSigned(opts, certificateOrg(r))
+	if err != nil {
+		doJSONWrite(w, http.StatusBadRequest, apiError(err.Error()))
+		return
+	}
+
+	notifyCertificateChanged(certID)
+	doJSONWrite(w, http.StatusOK, &APICertificateStatusMessage{certID, "ok", "Certificate generated"})
+}
+
+// certRequestHandler creates certificate signing requests, and adds
+// certificates signed for them.
+func certRequestHandler(w http.ResponseWriter, r *http.Request) {
+	csrID := mux.Vars(r)["csrID"]
+	if csrID != "" && !certificateOwned(r, csrID) {
+		doJSONWrite(w, http.StatusNotFound, apiError("Certificate request not found"))
+		return
+	}
+
+	switch {
+	case r.Method == "POST" && csrID == "":
+		var opts certs.GenerateOptions
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+			doJSONWrite(w, http.StatusBadRequest, apiError("Request malformed"))
+			return
+		}
+
+		csrID, csrPEM, err := CertificateManager.GenerateCSR(opts, certificateOrg(r))
+		if err != nil {
+			doJSONWrite(w, http.StatusBadRequest, apiError(err.Error()))
+			return
+		}
+
+		doJSONWrite(w, http.StatusOK, &APICertificateRequest{csrID, string(csrPEM)})
+	case r.Method == "POST":
+		content, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			doJSONWrite(w, 405, apiError("Malformed request body"))
+			return
+		}
+
+		certID, err := CertificateManager.AuditedBy(r.RemoteAddr).AddSignedCSR(csrID, content)
+		if err != nil {
+			doJSONWrite(w, certificateErrorCode(err, http.StatusForbidden), apiError(err.Error()))
+			return
+		}
+
+		notifyCertificateChanged(certID)
+		doJSONWrite(w, http.StatusOK, &APICertificateStatusMessage{certID, "ok", "Certificate added"})
+	case r.Method == "GET":
+		csrPEM, err := CertificateManager.GetCSR(csrID)
+		if err != nil {
+			doJSONWrite(w, http.StatusNotFound, apiError(err.Error()))
+			return
+		}
+
+		doJSONWrite(w, http.StatusOK, &APICertificateRequest{csrID, string(csrPEM)})
+	}
+}
+
+func certificateTransparencyPolicy(conf config.CertificateTransparencyConfig) *certs.CTPolicy {
+	policy := &certs.CTPolicy{Enforce: conf.Enforce, MinSCTs: conf.MinSCTs}
+
+	for _, encoded := range conf.Logs {
+		der, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			certLog.Error("Can't decode CT log key: ", err)
+			continue
+		}
+
+		key, err := x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			certLog.Error("Can't parse CT log key: ", err)
+			continue
+		}
+
+		policy.Logs = append(policy.Logs, key)
+	}
+
+	return policy
+}
+
+// setupCertificateAudit adds audit sinks enabled in config to the
+// certificate manager.
+func setupCertificateAudit(conf config.CertificateAuditConfig) {
+	if conf.File != "" {
+		sink, err := certs.NewFileAuditSink(conf.File)
+		if err != nil {
+			log.Error("Can't open certificate audit file: ", err)
+		} else {
+			CertificateManager.AddAuditSink(sink)
+		}
+	}
+
+	if conf.Syslog.Enabled {
+		sink, err := certs.NewSyslogAuditSink(conf.Syslog.Network, conf.Syslog.Address, conf.Syslog.Tag)
+		if err != nil {
+			log.Error("Can't connect to certificate audit syslog: ", err)
+		} else {
+			CertificateManager.AddAuditSink(sink)
+		}
+	}
+
+	if conf.WebhookURL != "" {
+		CertificateManager.AddAuditSink(certs.NewWebhookAuditSink(conf.WebhookURL, func(err error) {
+			log.Warning("Can't send certificate audit event: ", err)
+		}))
+	}
+}
+
+// setupCertificateKeyPolicy sets the default and organisation key policies.
+// Policy with all checks disabled is not set.
+func setupCertificateKeyPolicy(conf config.CertificateKeyPolicyConfig) {
+	keyPolicy := func(conf config.KeyPolicyConfig) *certs.KeyPolicy {
+		return &certs.KeyPolicy{
+			MinRSABits:      conf.MinRSABits,
+			RejectSHA1:      conf.RejectSHA1,
+			RejectExpired:   conf.RejectExpired,
+			MaxValidityDays: conf.MaxValidityDays,
+		}
+	}
+
+	if conf.KeyPolicyConfig != (config.KeyPolicyConfig{}) {
+		CertificateManager.SetKeyPolicy(keyPolicy(conf.KeyPolicyConfig))
+	}
+
+	for orgID, orgConf := range conf.Orgs {
+		CertificateManager.SetOrgKeyPolicy(orgID, keyPolicy(orgConf))
+	}
+}
+
+// startCertificateGRPC serves certificate management over gRPC, with the node
+// secret as the token.
+func startCertificateGRPC(conf config.CertificateGRPCConfig) (*grpc.Server, error) {
+	var opts []grpc.ServerOption
+	if conf.ServerCertificate != "" {
+		serverCerts := CertificateManager.List([]string{conf.ServerCertificate}, certs.CertificatePrivate)
+		if len(serverCerts) != 1 || serverCerts[0] == nil {
+			return nil, errors.New("Server certificate " + conf.ServerCertificate + " not found")
+		}
+		opts = append(opts, grpc.Creds(credentials.NewServerTLSFromCert(serverCerts[0])))
+	} else {
+		certLog.Warning("Certificate gRPC service is not using TLS")
+	}
+
+	ln, err := net.Listen("tcp", conf.ListenAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	server := certs.NewGRPCService(CertificateManager, config.Global().Secret).NewServer(opts...)
+	go func() {
+		if err := server.Serve(ln); err != nil {
+			certLog.Error("Certificate gRPC service stopped: ", err)
+		}
+	}()
+
+	certLog.Info("Certificate gRPC service listening on ", ln.Addr())
+	return server, nil
+}
+
+func getCertificateStorage(conf config.CertificateStorageConfig) certs.StorageHandler {
+	if conf.Type == "vault" {
+		certLog.Info("Using Vault certificate storage: ", conf.Vault.Address)
+		return certs.NewVaultStorage(conf.Vault.Address, conf.Vault.Token, conf.Vault.KVMount, conf.Vault.KVPath, log)
+	}
+
+	return getGlobalStorageHandler("cert-", false)
+}
+
+// certificateUsages builds index of certificates referenced by the API
+// definitions and the gateway configuration.
+func certificateUsages(specs []*APISpec) map[string][]certs.CertificateUsage {
+	usages := make(map[string][]certs.CertificateUsage)
+	add := func(certIDs []string, usage certs.CertificateUsage) {
+		for _, certID := range certIDs {
+			if certID = strings.TrimSpace(certID); certID != "" {
+				usages[certID] = append(usages[certID], usage)
+			}
+		}
+	}
+	// Pinned public keys and upstream certificates are mapped by host
+	addMap := func(m map[string]string, usage certs.CertificateUsage) {
+		for _, certIDs := range m {
+			add(strings.Split(certIDs, ","), usage)
+		}
+	}
+
+	global := config.Global()
+	globalUsage := func(field string) certs.CertificateUsage {
+		return certs.CertificateUsage{Type: "global", Field: field}
+	}
+	add(global.HttpServerOptions.SSLCertificates, globalUsage("http_server_options.ssl_certificates"))
+	add(global.Security.Certificates.API, globalUsage("security.certificates.apis"))
+	add(global.Security.Certificates.ControlAPI, globalUsage("security.certificates.control_api"))
+	add(global.Security.Certificates.Dashboard, globalUsage("security.certificates.dashboard_api"))
+	add(global.Security.Certificates.MDCB, globalUsage("security.certificates.mdcb_api"))
+	add(global.Security.ControlAPICertificateValidation.Intermediates, globalUsage("security.control_api_certificate_validation.intermediates"))
+	addMap(global.Security.Certificates.Upstream, globalUsage("security.certificates.upstream"))
+	addMap(global.Security.PinnedPublicKeys, globalUsage("security.pinned_public_keys"))
+
+	for _, spec := range specs {
+		apiUsage := func(field string) certs.CertificateUsage {
+			return certs.CertificateUsage{Type: "api", ID: spec.APIID, Field: field}
+		}
+		add(spec.Certificates, apiUsage("certificates"))
+		add(spec.ClientCertificates, apiUsage("client_certificates"))
+		add(spec.ClientCertificateValidation.Intermediates, apiUsage("client_certificate_validation.intermediates"))
+		addMap(spec.UpstreamCertificates, apiUsage("upstream_certificates"))
+		addMap(spec.PinnedPublicKeys, apiUsage("pinned_public_keys"))
+	}
+
+	return usages
+}
+
+// preloadCertificates loads referenced certificates into the certificate
+// cache, so the first requests using them don't wait for storage.
+func preloadCertificates(usages map[string][]certs.CertificateUsage) {
+	certIDs := make([]string, 0, len(usages))
+	for certID := range usages {
+		certIDs = append(certIDs, certID)
+	}
+
+	ctx := context.Background()
+	if timeout := config.Global().Security.CertificateCache.PreloadTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		defer cancel()
+	}
+
+	start := time.Now()
+	if err := CertificateManager.PreloadContext(ctx, certIDs); err != nil {
+		certLog.Warning("Certificate preload not finished, remaining certificates are loaded on first use: ", err)
+		return
+	}
+
+	certLog.Debugf("Preloaded %d certificates in %s", len(certIDs), time.Since(start))
+}
+
+// onCertificateReplaced makes TLS listeners and upstream transports pick up
+// the replaced certificate.
+func onCertificateReplaced(certID string) {
+	certLog.Info("Certificate replaced: ", certID)
+	atomic.AddInt64(&serverCertificatesVersion, 1)
+	reloadURLStructure(nil)
+}
+
+// certificateNotification is published to other gateways when a certificate
+// is added, replaced or removed.
+type certificateNotification struct {
+	CertID string `json:"cert_id"`
+	NodeID string `json:"node_id"`
+}
+
+func notifyCertificateChanged(certID string) {
+	payload, err := json.Marshal(certificateNotification{CertID: certID, NodeID: getNodeID()})
+	if err != nil {
+		certLog.Error("Failed to encode certificate notification: ", err)
+		return
+	}
+
+	MainNotifier.Notify(Notification{Command: NoticeCertificateChanged, Payload: string(payload)})
+}
+
+// handleCertificateChanged drops the cached copy of a certificate changed by
+// another gateway, and reloads if the certificate is in use.
+func handleCertificateChanged(payload string) {
+	var notif certificateNotification
+	if err := json.Unmarshal([]byte(payload), &notif); err != nil {
+		pubSubLog.Error("Failed to decode certificate notification: ", err)
+		return
+	}
+
+	// Changes made by this node are already applied
+	if notif.NodeID == getNodeID() {
+		return
+	}
+
+	CertificateManager.Invalidate(notif.CertID)
+
+	if len(CertificateManager.Usages(notif.CertID)) > 0 {
+		onCertificateReplaced(notif.CertID)
+	}
+}
+
+// onSVIDUpdate makes the gateway use SVIDs rotated by SPIFFE agent.
+func onSVIDUpdate() {
+	CertificateManager.InvalidateSource(SPIFFESource)
+	atomic.AddInt64(&serverCertificatesVersion, 1)
+	reloadURLStructure(nil)
+}
+
+func crlHandler(w http.ResponseWriter, r *http.Request) {
+	crlID := mux.Vars(r)["crlID"]
+
+	switch r.Method {
+	case "POST":
+		content, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			doJSONWrite(w, 405, apiError("Malformed request body"))
+			return
+		}
+
+		crlID, err := CRLManager.Add(content)
+		if err != nil {
+			doJSONWrite(w, http.StatusBadRequest, apiError(err.Error()))
+			return
+		}
+
+		doJSONWrite(w, http.StatusOK, &APICertificateStatusMessage{crlID, "ok", "CRL added"})
+	case "GET":
+		doJSONWrite(w, http.StatusOK, &APIAllCRLs{CRLManager.ListAllIds()})
 	case "DELETE":
-		CertificateManager.Delete(certID)
+		CRLManager.Delete(crlID)
 		doJSONWrite(w, http.StatusOK, &apiStatusMessage{"ok", "removed"})
 	}
 }
@@ -0,0 +1,106 @@
+package gateway
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/TykTechnologies/tyk/certs"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+// Certificate-bound access tokens, as of RFC 8705, may only be used over a
+// TLS connection authenticated with the client certificate they were issued
+// to, so that tokens leaked or replayed by anyone else are worthless.
+
+var (
+	errCertificateRequired = errors.New("client certificate required for certificate-bound token")
+	errCertificateMismatch = errors.New("client certificate does not match the certificate-bound token")
+)
+
+// clientCertificateFingerprint returns the fingerprint of the client
+// certificate of the connection, as certificates are identified by the
+// certificate manager, or empty if there is none.
+func clientCertificateFingerprint(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+	return certs.HexSHA256(r.TLS.PeerCertificates[0].Raw)
+}
+
+// checkCertificateBinding checks the client certificate matches the
+// fingerprint a token is bound to. Tokens without binding pass.
+func checkCertificateBinding(r *http.Request, fingerprint string) error {
+	if fingerprint == "" {
+		return nil
+	}
+
+	presented := clientCertificateFingerprint(r)
+	if presented == "" {
+		return errCertificateRequired
+	}
+	if subtle.ConstantTimeCompare([]byte(presented), []byte(fingerprint)) != 1 {
+		return errCertificateMismatch
+	}
+	return nil
+}
+
+// checkSessionBinding checks the request is made with the client certificate
+// and DPoP key the session is bound to, if any.
+func checkSessionBinding(r *http.Request, session *user.SessionState) error {
+	if err := checkCertificateBinding(r, session.CertificateBinding); err != nil {
+		return err
+	}
+	return checkProofKeyBinding(r, session.DPoPBinding)
+}
+
+// checkConfirmationClaim checks the request is made with the client
+// certificate (x5t#S256) or DPoP key (jkt) of the cnf claim of a JWT, if it
+// has one.
+func checkConfirmationClaim(r *http.Request, claims jwt.MapClaims) error {
+	cnf, ok := claims["cnf"]
+	if !ok {
+		return nil
+	}
+	confirmation, ok := cnf.(map[string]interface{})
+	if !ok {
+		return errors.New("cnf claim is not an object")
+	}
+
+	if jkt, ok := confirmation["jkt"]; ok {
+		thumbprint, _ := jkt.(string)
+		if thumbprint == "" {
+			return errors.New("jkt confirmation is empty")
+		}
+		if err := checkProofKeyBinding(r, thumbprint); err != nil {
+			return err
+		}
+	}
+
+	thumbprint, ok := confirmation["x5t#S256"].(string)
+	if !ok {
+		// Bound by some other confirmation method
+		return nil
+	}
+
+	sum, err := base64.RawURLEncoding.DecodeString(thumbprint)
+	if err != nil || len(sum) == 0 {
+		return errors.New("x5t#S256 confirmation is not base64url encoded")
+	}
+	return checkCertificateBinding(r, hex.EncodeToString(sum))
+}
+
+// tokenBindingFailure rejects a request made with a token away from the
+// certificate or key it is bound to.
+func tokenBindingFailure(m TykMiddleware, r *http.Request, token string, err error) (error, int) {
+	m.Logger().WithError(err).WithField("key", obfuscateKey(token)).Warning("Attempted access with bound token.")
+
+	AuthFailed(m, r, token)
+	reportHealthValue(m.Base().Spec, KeyFailure, "1")
+
+	return errors.New("Key not authorised: " + err.Error()), http.StatusUnauthorized
+}
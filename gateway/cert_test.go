@@ -1,12 +1,15 @@
 package gateway
 
 import (
+	"archive/zip"
 	"bytes"
 	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
 	"encoding/pem"
 	"fmt"
 	"io/ioutil"
@@ -17,9 +20,12 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/garyburd/redigo/redis"
+
 	"google.golang.org/grpc"
 	pb "google.golang.org/grpc/examples/helloworld/helloworld"
 
@@ -30,6 +36,7 @@ import (
 	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/TykTechnologies/tyk/certs"
 	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
 	"github.com/TykTechnologies/tyk/test"
 	"github.com/TykTechnologies/tyk/user"
 )
@@ -480,6 +487,132 @@ func TestUpstreamMutualTLS(t *testing.T) {
 	})
 }
 
+func TestUpstreamClientCertificateBySNI(t *testing.T) {
+	genClientCertificate := func(cn string) []byte {
+		priv, _ := rsa.GenerateKey(rand.Reader, 2048)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(time.Now().UnixNano()),
+			Subject:      pkix.Name{CommonName: cn},
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		der, _ := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+
+		return append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})...)
+	}
+
+	// Upstream accepts only the client certificate with the expected name
+	startUpstream := func(expectedCN string) *httptest.Server {
+		upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(r.TLS.PeerCertificates) == 0 || r.TLS.PeerCertificates[0].Subject.CommonName != expectedCN {
+				w.WriteHeader(http.StatusForbidden)
+			}
+		}))
+		upstream.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+		upstream.StartTLS()
+		return upstream
+	}
+
+	first := startUpstream("first")
+	defer first.Close()
+	second := startUpstream("second")
+	defer second.Close()
+
+	firstID, _ := CertificateManager.Add(genClientCertificate("first"), "")
+	defer CertificateManager.Delete(firstID)
+	secondID, _ := CertificateManager.Add(genClientCertificate("second"), "")
+	defer CertificateManager.Delete(secondID)
+
+	globalConf := config.Global()
+	globalConf.ProxySSLInsecureSkipVerify = true
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	// Both upstreams are served by the same transport, and are told apart by
+	// server name
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.EnableLoadBalancing = true
+		spec.Proxy.Targets = []string{
+			strings.Replace(first.URL, "127.0.0.1", "localhost", 1),
+			second.URL,
+		}
+		spec.UpstreamCertificates = map[string]string{
+			"localhost": firstID,
+			"127.0.0.1": secondID,
+		}
+	})
+
+	for i := 0; i < 4; i++ {
+		ts.Run(t, test.TestCase{Code: 200})
+	}
+}
+
+func TestDynamicServerCertificates(t *testing.T) {
+	genServerCertificate := func(cn string, names ...string) []byte {
+		priv, _ := rsa.GenerateKey(rand.Reader, 2048)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(time.Now().UnixNano()),
+			Subject:      pkix.Name{CommonName: cn},
+			DNSNames:     names,
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		der, _ := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+
+		return append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})...)
+	}
+
+	defaultID, _ := CertificateManager.Add(genServerCertificate("default"), "")
+	defer CertificateManager.Delete(defaultID)
+	wildcardID, _ := CertificateManager.Add(genServerCertificate("wildcard", "*.example.com"), "")
+	defer CertificateManager.Delete(wildcardID)
+
+	globalConf := config.Global()
+	globalConf.HttpServerOptions.UseSSL = true
+	globalConf.HttpServerOptions.DynamicCertificates.Enabled = true
+	globalConf.HttpServerOptions.DynamicCertificates.DefaultCertificate = defaultID
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	servedCertificate := func(serverName string) string {
+		conn, err := tls.Dial("tcp", strings.TrimPrefix(ts.URL, "https://"), &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+
+	if cn := servedCertificate("api.example.com"); cn != "wildcard" {
+		t.Error("Wildcard certificate should be served", cn)
+	}
+
+	if cn := servedCertificate("other.org"); cn != "default" {
+		t.Error("Default certificate should be served", cn)
+	}
+
+	// Certificates added later are served without restart
+	newID, _ := CertificateManager.Add(genServerCertificate("new", "new.org"), "")
+	defer CertificateManager.Delete(newID)
+
+	if cn := servedCertificate("new.org"); cn != "new" {
+		t.Error("New certificate should be served", cn)
+	}
+}
+
 func TestKeyWithCertificateTLS(t *testing.T) {
 	_, _, combinedPEM, _ := genServerCertificate()
 	serverCertID, _ := CertificateManager.Add(combinedPEM, "")
@@ -522,6 +655,55 @@ func TestKeyWithCertificateTLS(t *testing.T) {
 	})
 }
 
+func TestCertificateSessionMapping(t *testing.T) {
+	_, _, combinedPEM, _ := genServerCertificate()
+	serverCertID, _ := CertificateManager.Add(combinedPEM, "")
+	defer CertificateManager.Delete(serverCertID)
+
+	clientCertPEM, _, _, clientCert := genCertificate(&x509.Certificate{})
+	clientCertID, _ := CertificateManager.Add(clientCertPEM, "")
+	defer CertificateManager.Delete(clientCertID)
+
+	globalConf := config.Global()
+	globalConf.HttpServerOptions.UseSSL = true
+	globalConf.HttpServerOptions.SSLCertificates = []string{serverCertID}
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.UseKeylessAccess = false
+		spec.UseMutualTLSAuth = true
+		spec.ClientCertificates = []string{clientCertID}
+		spec.ClientCertificateValidation.SessionMapping = true
+		spec.Proxy.ListenPath = "/"
+	})
+
+	client := getTLSClient(&clientCert, nil)
+
+	t.Run("Certificate without key", func(t *testing.T) {
+		ts.Run(t, test.TestCase{Code: http.StatusForbidden, Client: client})
+	})
+
+	t.Run("Certificate with key", func(t *testing.T) {
+		CreateSession(func(s *user.SessionState) {
+			s.Certificate = clientCertID
+			s.QuotaMax = 1
+			s.QuotaRemaining = 1
+			s.AccessRights = map[string]user.AccessDefinition{"test": {
+				APIID: "test", Versions: []string{"v1"},
+			}}
+		})
+
+		ts.Run(t, []test.TestCase{
+			{Code: http.StatusOK, Client: client},
+			{Code: http.StatusForbidden, Client: client, BodyMatch: "Quota exceeded"},
+		}...)
+	})
+}
+
 func TestAPICertificate(t *testing.T) {
 	_, _, combinedPEM, _ := genServerCertificate()
 	serverCertID, _ := CertificateManager.Add(combinedPEM, "")
@@ -606,6 +788,75 @@ func TestCertificateHandlerTLS(t *testing.T) {
 		}...)
 	})
 
+	t.Run("Certificate replacement", func(t *testing.T) {
+		newClientPEM, _, _, newClientCert := genCertificate(&x509.Certificate{})
+		newClientCertMeta := fmt.Sprintf(certMetaTemplate, clientCertID, certs.HexSHA256(newClientCert.Certificate[0]), "false")
+
+		ts.Run(t, []test.TestCase{
+			{Method: "PUT", Path: "/tyk/certs/" + clientCertID, Data: string(newClientPEM), AdminAuth: true, Code: 200},
+			{Method: "GET", Path: "/tyk/certs/" + clientCertID, AdminAuth: true, Code: 200, BodyMatch: newClientCertMeta},
+			{Method: "PUT", Path: "/tyk/certs/unknown", Data: string(newClientPEM), AdminAuth: true, Code: 404},
+			{Method: "POST", Path: "/tyk/certs", Data: string(clientPEM), AdminAuth: true, Code: 409, BodyMatch: "already exists"},
+		}...)
+	})
+
+	t.Run("Certificate tags and search", func(t *testing.T) {
+		ts.Run(t, []test.TestCase{
+			{Method: "PUT", Path: "/tyk/certs/" + serverCertID + "/tags", Data: `{"env":"prod"}`, AdminAuth: true, Code: 200},
+			{Method: "PUT", Path: "/tyk/certs/unknown/tags", Data: `{"env":"prod"}`, AdminAuth: true, Code: 404},
+			{Method: "GET", Path: "/tyk/certs/" + serverCertID, AdminAuth: true, Code: 200, BodyMatch: `"tags":{"env":"prod"}`},
+			{Method: "GET", Path: "/tyk/certs/search?tag=env:prod", AdminAuth: true, Code: 200, BodyMatch: `[{"id":"` + serverCertID + `"`},
+			{Method: "GET", Path: "/tyk/certs/search?tag=env:prod", AdminAuth: true, Code: 200, BodyNotMatch: clientCertID},
+			{Method: "GET", Path: "/tyk/certs/search?tag=env", AdminAuth: true, Code: 400},
+			{Method: "GET", Path: "/tyk/certs/search?expires_before=tomorrow", AdminAuth: true, Code: 400},
+		}...)
+	})
+
+	t.Run("Certificate JWKS", func(t *testing.T) {
+		ts.Run(t, []test.TestCase{
+			{Method: "GET", Path: "/tyk/certs/jwks", AdminAuth: true, Code: 200, BodyMatch: `"kid":"` + serverCertID + `"`},
+			{Method: "GET", Path: "/tyk/certs/jwks?certs=" + clientCertID, AdminAuth: true, Code: 200, BodyMatch: `"x5c"`},
+			{Method: "GET", Path: "/tyk/certs/jwks?certs=" + clientCertID, AdminAuth: true, Code: 200, BodyNotMatch: serverCertID},
+			{Method: "GET", Path: "/tyk/certs/jwks?certs=unknown", AdminAuth: true, Code: 200, BodyMatch: `{"keys":[]}`},
+		}...)
+	})
+
+	t.Run("Certificate metrics", func(t *testing.T) {
+		ts.Run(t, test.TestCase{
+			Method: "GET", Path: "/tyk/certs/metrics", AdminAuth: true, Code: 200,
+			BodyMatch: `tyk_certificates_expiring{expires_in="7d"} 2`,
+		})
+	})
+
+	t.Run("Published JWKS", func(t *testing.T) {
+		globalConf := config.Global()
+		globalConf.Security.PublishedJWKS = config.PublishedJWKSConfig{Path: "/.well-known/jwks.json", Certificates: []string{serverCertID}}
+		config.SetGlobal(globalConf)
+		defer ResetTestConfig()
+
+		BuildAndLoadAPI()
+
+		ts.Run(t, test.TestCase{
+			Method: "GET", Path: "/.well-known/jwks.json", Code: 200, BodyMatch: `"kid":"` + serverCertID + `"`,
+		})
+	})
+
+	t.Run("Detailed certificate list", func(t *testing.T) {
+		firstID, secondID := serverCertID, clientCertID
+		if firstID > secondID {
+			firstID, secondID = secondID, firstID
+		}
+
+		ts.Run(t, []test.TestCase{
+			{Method: "GET", Path: "/tyk/certs?mode=detailed&page_size=1", AdminAuth: true, Code: 200,
+				BodyMatch: `"next_cursor":"` + firstID + `"`},
+			{Method: "GET", Path: "/tyk/certs?mode=detailed&page_size=1", AdminAuth: true, Code: 200,
+				BodyMatch: `{"certs":[{"id":"` + firstID + `"`},
+			{Method: "GET", Path: "/tyk/certs?mode=detailed&page_size=1&cursor=" + firstID, AdminAuth: true, Code: 200,
+				BodyMatch: `{"certs":[{"id":"` + secondID + `"`, BodyNotMatch: "next_cursor"},
+		}...)
+	})
+
 	t.Run("Certificate removal", func(t *testing.T) {
 		ts.Run(t, []test.TestCase{
 			{Method: "DELETE", Path: "/tyk/certs/" + serverCertID, AdminAuth: true, Code: 200},
@@ -615,6 +866,307 @@ func TestCertificateHandlerTLS(t *testing.T) {
 	})
 }
 
+func TestCertificateBatchHandler(t *testing.T) {
+	clientPEM, _, _, clientCert := genCertificate(&x509.Certificate{})
+	clientCertID := certs.HexSHA256(clientCert.Certificate[0])
+	_, _, combinedServerPEM, serverCert := genServerCertificate()
+	serverCertID := certs.HexSHA256(serverCert.Certificate[0])
+	defer CertificateManager.Delete(clientCertID)
+	defer CertificateManager.Delete(serverCertID)
+
+	ts := StartTest()
+	defer ts.Close()
+
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	f, _ := zw.Create("server.pem")
+	f.Write(combinedServerPEM)
+	f, _ = zw.Create("invalid.p12")
+	f.Write([]byte("invalid"))
+	zw.Close()
+
+	ts.Run(t, []test.TestCase{
+		{Method: "POST", Path: "/tyk/certs/batch", Data: string(clientPEM) + string(clientPEM), AdminAuth: true, Code: 200,
+			BodyMatch: `{"results":[{"id":"` + clientCertID + `"},{"error":"Certificate with ` + clientCertID + ` id already exists"}]}`},
+		{Method: "POST", Path: "/tyk/certs/batch", Data: archive.String(), Headers: map[string]string{headers.ContentType: headers.ApplicationZip}, AdminAuth: true, Code: 200,
+			BodyMatch: `{"results":[{"name":"server.pem","id":"` + serverCertID + `"},{"name":"invalid.p12","error":"pkcs12: `},
+		{Method: "POST", Path: "/tyk/certs/batch", Data: "invalid", AdminAuth: true, Code: 400},
+	}...)
+
+	t.Run("Limits", func(t *testing.T) {
+		var bomb bytes.Buffer
+		zw := zip.NewWriter(&bomb)
+		f, _ := zw.Create("bomb.pem")
+		f.Write(make([]byte, maxBatchCertificateSize+1))
+		zw.Close()
+
+		var many bytes.Buffer
+		zw = zip.NewWriter(&many)
+		for i := 0; i <= maxBatchCertificates; i++ {
+			zw.Create(fmt.Sprintf("%d.pem", i))
+		}
+		zw.Close()
+
+		zipHeaders := map[string]string{headers.ContentType: headers.ApplicationZip}
+		ts.Run(t, []test.TestCase{
+			{Method: "POST", Path: "/tyk/certs/batch", Data: bomb.String(), Headers: zipHeaders, AdminAuth: true, Code: 400,
+				BodyMatch: "Batch is over the limit"},
+			{Method: "POST", Path: "/tyk/certs/batch", Data: many.String(), Headers: zipHeaders, AdminAuth: true, Code: 400,
+				BodyMatch: "Batch is over the limit"},
+		}...)
+	})
+}
+
+func TestCertificateGenerate(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	t.Run("Self signed", func(t *testing.T) {
+		resp, _ := ts.Run(t, []test.TestCase{
+			{Method: "POST", Path: "/tyk/certs/generate", Data: `{"key_type":"dsa"}`, AdminAuth: true, Code: 400},
+			{Method: "POST", Path: "/tyk/certs/generate", Data: `{"common_name":"gateway","key_type":"ecdsa"}`, AdminAuth: true, Code: 200,
+				BodyMatch: `"message":"Certificate generated"`},
+		}...)
+
+		var status APICertificateStatusMessage
+		json.NewDecoder(resp.Body).Decode(&status)
+		defer CertificateManager.Delete(status.CertID)
+
+		ts.Run(t, test.TestCase{Method: "GET", Path: "/tyk/certs/" + status.CertID, AdminAuth: true, Code: 200,
+			BodyMatch: `"has_private":true`})
+	})
+
+	t.Run("Certificate request", func(t *testing.T) {
+		resp, _ := ts.Run(t, test.TestCase{Method: "POST", Path: "/tyk/certs/csr", Data: `{"common_name":"client"}`, AdminAuth: true, Code: 200,
+			BodyMatch: `BEGIN CERTIFICATE REQUEST`})
+
+		var csr APICertificateRequest
+		json.NewDecoder(resp.Body).Decode(&csr)
+
+		ts.Run(t, []test.TestCase{
+			{Method: "GET", Path: "/tyk/certs/csr/" + csr.ID, AdminAuth: true, Code: 200, BodyMatch: `"id":"` + csr.ID + `"`},
+			{Method: "GET", Path: "/tyk/certs/csr/unknown", AdminAuth: true, Code: 404},
+		}...)
+
+		// Self signed certificate doesn't match the request key
+		clientPEM, _, _, _ := genCertificate(&x509.Certificate{})
+		ts.Run(t, test.TestCase{Method: "POST", Path: "/tyk/certs/csr/" + csr.ID, Data: string(clientPEM), AdminAuth: true, Code: 400, BodyMatch: "does not match"})
+
+		getCertificateStorage(config.Global().Security.CertificateStorage).DeleteKey("csr-" + csr.ID)
+	})
+}
+
+func TestCertificateOrgIsolation(t *testing.T) {
+	_, _, certPEM, _ := genServerCertificate()
+	certID, _ := CertificateManager.Add(certPEM, "feed")
+	defer CertificateManager.Delete(certID)
+
+	ts := StartTest()
+	defer ts.Close()
+
+	ts.Run(t, []test.TestCase{
+		{Method: "GET", Path: "/tyk/certs?org_id=fe", AdminAuth: true, Code: 200, BodyNotMatch: certID},
+		{Method: "GET", Path: "/tyk/certs?org_id=feed", AdminAuth: true, Code: 200, BodyMatch: certID},
+		{Method: "GET", Path: "/tyk/certs/" + certID + "?org_id=fe", AdminAuth: true, Code: 404},
+		{Method: "PUT", Path: "/tyk/certs/" + certID + "/tags?org_id=fe", Data: `{"env":"prod"}`, AdminAuth: true, Code: 404},
+		{Method: "DELETE", Path: "/tyk/certs/" + certID + "?org_id=fe", AdminAuth: true, Code: 404},
+		{Method: "GET", Path: "/tyk/certs/" + certID + "?org_id=feed", AdminAuth: true, Code: 200},
+	}...)
+
+	t.Run("Organisation secrets", func(t *testing.T) {
+		globalConf := config.Global()
+		globalConf.Security.CertificateOrgSecrets = map[string]string{"fe": "fe-secret", "feed": "feed-secret"}
+		config.SetGlobal(globalConf)
+		defer ResetTestConfig()
+
+		fe := map[string]string{headers.XTykAuthorization: "fe-secret"}
+		feed := map[string]string{headers.XTykAuthorization: "feed-secret"}
+
+		// Organisations are scoped by their secret, not by org_id
+		ts.Run(t, []test.TestCase{
+			{Method: "GET", Path: "/tyk/certs", Headers: fe, Code: 200, BodyNotMatch: certID},
+			{Method: "GET", Path: "/tyk/certs?org_id=feed", Headers: fe, Code: 200, BodyNotMatch: certID},
+			{Method: "GET", Path: "/tyk/certs/" + certID, Headers: fe, Code: 404},
+			{Method: "GET", Path: "/tyk/certs/" + certID + "?org_id=feed", Headers: fe, Code: 404},
+			{Method: "DELETE", Path: "/tyk/certs/" + certID, Headers: fe, Code: 404},
+			{Method: "GET", Path: "/tyk/certs/metrics", Headers: fe, Code: 403},
+			{Method: "GET", Path: "/tyk/certs", Headers: feed, Code: 200, BodyMatch: certID},
+			{Method: "GET", Path: "/tyk/certs/" + certID, Headers: feed, Code: 200},
+			// Organisation secrets only open the certificate API
+			{Method: "GET", Path: "/tyk/apis", Headers: feed, Code: 403},
+		}...)
+	})
+}
+
+func TestCertificateExportImport(t *testing.T) {
+	_, _, combinedPEM, _ := genServerCertificate()
+	certID, _ := CertificateManager.Add(combinedPEM, "feed")
+
+	ts := StartTest()
+	defer ts.Close()
+
+	passphrase := map[string]string{headers.XTykCertPassphrase: "secret"}
+
+	ts.Run(t, test.TestCase{Method: "GET", Path: "/tyk/certs/export?org_id=feed", AdminAuth: true, Code: 400})
+	resp, _ := ts.Run(t, test.TestCase{Method: "GET", Path: "/tyk/certs/export?org_id=feed", Headers: passphrase, AdminAuth: true, Code: 200,
+		BodyMatch: "BEGIN TYK CERTIFICATE ARCHIVE"})
+
+	archive, _ := ioutil.ReadAll(resp.Body)
+	CertificateManager.Delete(certID)
+
+	ts.Run(t, []test.TestCase{
+		{Method: "POST", Path: "/tyk/certs/import", Data: string(archive), Headers: map[string]string{headers.XTykCertPassphrase: "wrong"}, AdminAuth: true, Code: 400},
+		{Method: "POST", Path: "/tyk/certs/import?dry_run=true", Data: string(archive), Headers: passphrase, AdminAuth: true, Code: 200,
+			BodyMatch: `"id":"` + certID + `"`},
+		{Method: "GET", Path: "/tyk/certs/" + certID, AdminAuth: true, Code: 404},
+		{Method: "POST", Path: "/tyk/certs/import", Data: string(archive), Headers: passphrase, AdminAuth: true, Code: 200,
+			BodyMatch: `"id":"` + certID + `"`},
+		{Method: "GET", Path: "/tyk/certs/" + certID, AdminAuth: true, Code: 200, BodyMatch: `"has_private":true`},
+	}...)
+
+	CertificateManager.Delete(certID)
+}
+
+func TestCertificateBundle(t *testing.T) {
+	_, _, combinedPEM, _ := genServerCertificate()
+	certID, _ := CertificateManager.Add(combinedPEM, "feed")
+	defer CertificateManager.Delete(certID)
+
+	ts := StartTest()
+	defer ts.Close()
+
+	bundlePath := "/tyk/certs/" + certID + "/bundle"
+
+	ts.Run(t, []test.TestCase{
+		{Method: "GET", Path: bundlePath, AdminAuth: true, Code: 200, BodyMatch: "BEGIN PRIVATE KEY",
+			HeadersMatch: map[string]string{"Content-Disposition": `attachment; filename="` + certID + `.pem"`}},
+		{Method: "GET", Path: bundlePath + "?exclude_key=true", AdminAuth: true, Code: 200, BodyNotMatch: "PRIVATE KEY"},
+		{Method: "GET", Path: bundlePath + "?format=pkcs7", AdminAuth: true, Code: 200,
+			HeadersMatch: map[string]string{headers.ContentType: "application/x-pkcs7-certificates"}},
+		{Method: "GET", Path: bundlePath + "?format=der", AdminAuth: true, Code: 200,
+			BodyMatchFunc: func(body []byte) bool {
+				certs, err := x509.ParseCertificates(body)
+				return err == nil && len(certs) == 1
+			}},
+		{Method: "GET", Path: bundlePath + "?format=jks", AdminAuth: true, Code: 400},
+		{Method: "GET", Path: bundlePath + "?org_id=fe", AdminAuth: true, Code: 404},
+		{Method: "GET", Path: "/tyk/certs/feed" + certs.HexSHA256([]byte("missing")) + "/bundle", AdminAuth: true, Code: 404},
+	}...)
+}
+
+func TestCertificateRestore(t *testing.T) {
+	globalConf := config.Global()
+	globalConf.Security.CertificateSoftDelete.Retention = 3600
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	_, _, combinedPEM, _ := genServerCertificate()
+	certID, _ := CertificateManager.Add(combinedPEM, "feed")
+	defer CertificateManager.Delete(certID)
+
+	ts.Run(t, []test.TestCase{
+		{Method: "POST", Path: "/tyk/certs/" + certID + "/restore", AdminAuth: true, Code: 404},
+		{Method: "DELETE", Path: "/tyk/certs/" + certID, AdminAuth: true, Code: 200},
+		{Method: "GET", Path: "/tyk/certs/" + certID, AdminAuth: true, Code: 404},
+		{Method: "GET", Path: "/tyk/certs/deleted?org_id=feed", AdminAuth: true, Code: 200, BodyMatch: `"id":"` + certID + `"`},
+		{Method: "GET", Path: "/tyk/certs/deleted?org_id=beef", AdminAuth: true, Code: 200, BodyMatch: `[]`},
+		{Method: "POST", Path: "/tyk/certs/" + certID + "/restore?org_id=beef", AdminAuth: true, Code: 404},
+		{Method: "POST", Path: "/tyk/certs/" + certID + "/restore", AdminAuth: true, Code: 200},
+		{Method: "GET", Path: "/tyk/certs/" + certID, AdminAuth: true, Code: 200},
+		{Method: "GET", Path: "/tyk/certs/deleted?org_id=feed", AdminAuth: true, Code: 200, BodyNotMatch: certID},
+	}...)
+
+	CertificateManager.Delete(certID)
+	CertificateManager.SetDeleteRetention(0)
+	CertificateManager.Purge()
+}
+
+func TestCertificateUsage(t *testing.T) {
+	_, _, combinedPEM, _ := genServerCertificate()
+	certID, _ := CertificateManager.Add(combinedPEM, "")
+	defer CertificateManager.Delete(certID)
+
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "test"
+		spec.Certificates = []string{certID}
+		spec.UpstreamCertificates = map[string]string{"*": certID}
+	})
+
+	ts.Run(t, []test.TestCase{
+		{Method: "GET", Path: "/tyk/certs/" + certID + "/usage", AdminAuth: true, Code: 200,
+			BodyMatch: `[{"type":"api","id":"test","field":"certificates"},{"type":"api","id":"test","field":"upstream_certificates"}]`},
+		{Method: "DELETE", Path: "/tyk/certs/" + certID, AdminAuth: true, Code: http.StatusConflict},
+		{Method: "DELETE", Path: "/tyk/certs/" + certID + "?force=true", AdminAuth: true, Code: 200},
+	}...)
+}
+
+type certAuditRecorder struct {
+	mu     sync.Mutex
+	events []certs.AuditEvent
+}
+
+func (r *certAuditRecorder) Audit(event *certs.AuditEvent) error {
+	r.mu.Lock()
+	r.events = append(r.events, *event)
+	r.mu.Unlock()
+	return nil
+}
+
+func TestCertificateUploadAudit(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	recorder := &certAuditRecorder{}
+	CertificateManager.AddAuditSink(recorder)
+
+	ts.Run(t, test.TestCase{Method: "POST", Path: "/tyk/certs", Data: "invalid", AdminAuth: true,
+		Headers: map[string]string{headers.ContentType: headers.ApplicationP12}, Code: http.StatusForbidden})
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	for _, event := range recorder.events {
+		if event.Action == certs.AuditAdd && strings.HasPrefix(event.Error, "Failed to decode PKCS#12 bundle") {
+			if event.Actor == "" {
+				t.Error("PKCS#12 upload should be audited with the caller address")
+			}
+			return
+		}
+	}
+	t.Error("PKCS#12 upload should be audited", recorder.events)
+}
+
+func TestCertificateChangedNotification(t *testing.T) {
+	_, _, combinedPEM, _ := genServerCertificate()
+	certID, _ := CertificateManager.Add(combinedPEM, "")
+	defer CertificateManager.Delete(certID)
+
+	// Populate cache, then remove the certificate as another node would
+	CertificateManager.List([]string{certID}, certs.CertificateAny)
+	getCertificateStorage(config.Global().Security.CertificateStorage).DeleteKey("raw-" + certID)
+
+	notify := func(nodeID string) {
+		payload, _ := json.Marshal(certificateNotification{CertID: certID, NodeID: nodeID})
+		data, _ := json.Marshal(Notification{Command: NoticeCertificateChanged, Payload: string(payload)})
+		handleRedisEvent(redis.Message{Data: data}, nil, nil)
+	}
+
+	notify(getNodeID())
+	if certificates := CertificateManager.List([]string{certID}, certs.CertificateAny); certificates[0] == nil {
+		t.Error("Notification from the same node should be ignored")
+	}
+
+	notify("other-node")
+	if certificates := CertificateManager.List([]string{certID}, certs.CertificateAny); certificates[0] != nil {
+		t.Error("Cached certificate should be dropped")
+	}
+}
+
 func TestCipherSuites(t *testing.T) {
 	//configure server so we can useSSL and utilize the logic, but skip verification in the clients
 	_, _, combinedPEM, _ := genServerCertificate()
@@ -658,6 +1210,63 @@ func TestCipherSuites(t *testing.T) {
 	})
 }
 
+func TestTLSPolicy(t *testing.T) {
+	_, _, combinedPEM, _ := genServerCertificate()
+	serverCertID, _ := CertificateManager.Add(combinedPEM, "")
+	defer CertificateManager.Delete(serverCertID)
+
+	globalConf := config.Global()
+	globalConf.EnableCustomDomains = true
+	globalConf.HttpServerOptions.UseSSL = true
+	globalConf.HttpServerOptions.SSLCertificates = []string{serverCertID}
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	tls12Client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		MaxVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: true,
+	}}}
+
+	t.Run("API policy", func(t *testing.T) {
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.Domain = "localhost"
+			spec.Proxy.ListenPath = "/"
+			spec.TLSPolicy.MinVersion = tls.VersionTLS13
+		})
+
+		ts.Run(t, []test.TestCase{
+			{Client: tls12Client, Domain: "localhost", ErrorMatch: "tls: protocol version not supported"},
+			{Client: tls12Client, Domain: "127.0.0.1", Code: http.StatusNotFound},
+		}...)
+	})
+
+	t.Run("Port policy", func(t *testing.T) {
+		globalConf := config.Global()
+		globalConf.HttpServerOptions.TLSPolicies = []config.PortTLSPolicyConfig{{
+			Port:          globalConf.ListenPort,
+			TLSPolicyMeta: apidef.TLSPolicyMeta{MaxVersion: tls.VersionTLS12, ALPNProtocols: []string{"http/1.1"}},
+		}}
+		config.SetGlobal(globalConf)
+
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.Proxy.ListenPath = "/"
+		})
+
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			MinVersion:         tls.VersionTLS13,
+			InsecureSkipVerify: true,
+		}}}
+
+		ts.Run(t, []test.TestCase{
+			{Client: client, ErrorMatch: "tls: protocol version not supported"},
+			{Client: tls12Client, Code: http.StatusOK},
+		}...)
+	})
+}
+
 func TestHTTP2(t *testing.T) {
 	expected := "HTTP/2.0"
 
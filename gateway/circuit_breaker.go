@@ -0,0 +1,225 @@
+package gateway
+
+import (
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+const defaultBreakerWindow = 10
+
+// BreakerEvent is a change in the state of a circuit breaker.
+type BreakerEvent int
+
+// BreakerTripped and BreakerReset keep the values they had with the previous
+// breaker implementation, which event handlers may match on.
+const (
+	BreakerTripped BreakerEvent = iota
+	BreakerReset
+	BreakerHalfOpen
+)
+
+func (e BreakerEvent) String() string {
+	switch e {
+	case BreakerTripped:
+		return "Tripped"
+	case BreakerReset:
+		return "Reset"
+	case BreakerHalfOpen:
+		return "Half-Open"
+	}
+	return "Unknown"
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// breakerBucket counts the requests of one second of the window.
+type breakerBucket struct {
+	second   int64
+	total    int64
+	failures int64
+	slow     int64
+}
+
+// hostBreaker is the state of a breaker for one upstream host.
+type hostBreaker struct {
+	state       breakerState
+	openedAt    time.Time
+	probes      int64
+	succeeded   int64
+	consecutive int64
+	buckets     []breakerBucket
+}
+
+// counts sums the requests of the buckets still in the window.
+func (hb *hostBreaker) counts(now int64) (total, failures, slow int64) {
+	window := int64(len(hb.buckets))
+	for _, bucket := range hb.buckets {
+		if now-bucket.second < window {
+			total += bucket.total
+			failures += bucket.failures
+			slow += bucket.slow
+		}
+	}
+	return
+}
+
+func (hb *hostBreaker) record(now int64, failed, slow bool) {
+	bucket := &hb.buckets[now%int64(len(hb.buckets))]
+	if bucket.second != now {
+		*bucket = breakerBucket{second: now}
+	}
+	bucket.total++
+	if failed {
+		bucket.failures++
+		hb.consecutive++
+	} else {
+		hb.consecutive = 0
+	}
+	if slow {
+		bucket.slow++
+	}
+}
+
+// Breaker trips once the requests to an upstream fail too often over a
+// rolling window, by error rate, by latency or by consecutive failures. After
+// ReturnToServiceAfter seconds open it lets probe requests through, and
+// closes again once they all succeed.
+type Breaker struct {
+	conf     apidef.CircuitBreakerMeta
+	onChange func(event BreakerEvent, host string)
+
+	mu    sync.Mutex
+	hosts map[string]*hostBreaker
+}
+
+// NewBreaker returns a closed breaker, calling onChange whenever it changes
+// state. Hosts are only told apart with PerHost enabled.
+func NewBreaker(conf apidef.CircuitBreakerMeta, onChange func(event BreakerEvent, host string)) *Breaker {
+	if conf.WindowSize <= 0 {
+		conf.WindowSize = defaultBreakerWindow
+	}
+	if conf.LatencyPercentile <= 0 || conf.LatencyPercentile > 1 {
+		conf.LatencyPercentile = 0.99
+	}
+	if conf.HalfOpenProbes <= 0 {
+		conf.HalfOpenProbes = 1
+	}
+	return &Breaker{
+		conf:     conf,
+		onChange: onChange,
+		hosts:    make(map[string]*hostBreaker),
+	}
+}
+
+func (b *Breaker) host(host string) *hostBreaker {
+	hb := b.hosts[host]
+	if hb == nil {
+		hb = &hostBreaker{buckets: make([]breakerBucket, b.conf.WindowSize)}
+		b.hosts[host] = hb
+	}
+	return hb
+}
+
+func (b *Breaker) hostKey(host string) string {
+	if !b.conf.PerHost {
+		return ""
+	}
+	return host
+}
+
+// Ready tells whether a request can be sent to host. Every request it lets
+// through must be reported with Done.
+func (b *Breaker) Ready(host string) bool {
+	host = b.hostKey(host)
+
+	b.mu.Lock()
+	hb := b.host(host)
+	ready, halfOpened := true, false
+	if hb.state == breakerOpen {
+		if time.Since(hb.openedAt) < time.Duration(b.conf.ReturnToServiceAfter)*time.Second {
+			ready = false
+		} else {
+			hb.state = breakerHalfOpen
+			hb.probes, hb.succeeded = 0, 0
+			halfOpened = true
+		}
+	}
+	if hb.state == breakerHalfOpen {
+		if hb.probes < b.conf.HalfOpenProbes {
+			hb.probes++
+		} else {
+			ready = false
+		}
+	}
+	b.mu.Unlock()
+
+	if halfOpened {
+		b.notify(BreakerHalfOpen, host)
+	}
+	return ready
+}
+
+// Done reports the outcome of a request sent to host.
+func (b *Breaker) Done(host string, failed bool, latency time.Duration) {
+	host = b.hostKey(host)
+	now := time.Now()
+
+	b.mu.Lock()
+	hb := b.host(host)
+	changed, event := false, BreakerTripped
+	// Requests sent before the breaker tripped are not counted while it is
+	// open
+	switch hb.state {
+	case breakerHalfOpen:
+		if failed {
+			hb.state, hb.openedAt = breakerOpen, now
+			changed = true
+		} else if hb.succeeded++; hb.succeeded >= b.conf.HalfOpenProbes {
+			*hb = hostBreaker{buckets: make([]breakerBucket, b.conf.WindowSize)}
+			changed, event = true, BreakerReset
+		}
+	case breakerClosed:
+		slow := b.conf.LatencyThreshold > 0 && latency > time.Duration(b.conf.LatencyThreshold)*time.Millisecond
+		hb.record(now.Unix(), failed, slow)
+		if b.shouldTrip(hb, now.Unix()) {
+			hb.state, hb.openedAt = breakerOpen, now
+			changed = true
+		}
+	}
+	b.mu.Unlock()
+
+	if changed {
+		b.notify(event, host)
+	}
+}
+
+func (b *Breaker) shouldTrip(hb *hostBreaker, now int64) bool {
+	if b.conf.ConsecutiveFailures > 0 && hb.consecutive >= b.conf.ConsecutiveFailures {
+		return true
+	}
+
+	total, failures, slow := hb.counts(now)
+	if total == 0 || total < b.conf.Samples {
+		return false
+	}
+	if b.conf.ThresholdPercent > 0 && float64(failures)/float64(total) >= b.conf.ThresholdPercent {
+		return true
+	}
+	// The percentile exceeds the threshold once fewer requests than the
+	// percentile are faster than it
+	return b.conf.LatencyThreshold > 0 && float64(total-slow) < b.conf.LatencyPercentile*float64(total)
+}
+
+func (b *Breaker) notify(event BreakerEvent, host string) {
+	if b.onChange != nil {
+		b.onChange(event, host)
+	}
+}
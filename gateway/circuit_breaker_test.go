@@ -0,0 +1,142 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestBreaker(t *testing.T) {
+	var events []BreakerEvent
+	record := func(e BreakerEvent, host string) {
+		events = append(events, e)
+	}
+	send := func(b *Breaker, host string, failed bool, latency time.Duration) bool {
+		if !b.Ready(host) {
+			return false
+		}
+		b.Done(host, failed, latency)
+		return true
+	}
+
+	t.Run("error rate", func(t *testing.T) {
+		events = nil
+		b := NewBreaker(apidef.CircuitBreakerMeta{ThresholdPercent: 0.5, Samples: 4, ReturnToServiceAfter: 60}, record)
+		send(b, "", true, 0)
+		send(b, "", true, 0)
+		send(b, "", true, 0)
+		if !b.Ready("") {
+			t.Fatal("Expected the breaker to wait for enough samples")
+		}
+		b.Done("", false, 0)
+		if b.Ready("") {
+			t.Fatal("Expected the breaker to trip")
+		}
+		if len(events) != 1 || events[0] != BreakerTripped {
+			t.Errorf("Expected a tripped event, got %v", events)
+		}
+	})
+
+	t.Run("consecutive failures", func(t *testing.T) {
+		b := NewBreaker(apidef.CircuitBreakerMeta{ConsecutiveFailures: 2, ReturnToServiceAfter: 60}, record)
+		send(b, "", true, 0)
+		send(b, "", false, 0)
+		send(b, "", true, 0)
+		if !b.Ready("") {
+			t.Fatal("Expected successes to reset the failures in a row")
+		}
+		b.Done("", true, 0)
+		if b.Ready("") {
+			t.Error("Expected the breaker to trip")
+		}
+	})
+
+	t.Run("latency", func(t *testing.T) {
+		b := NewBreaker(apidef.CircuitBreakerMeta{LatencyThreshold: 100, LatencyPercentile: 0.9, Samples: 10, ReturnToServiceAfter: 60}, record)
+		for i := 0; i < 9; i++ {
+			send(b, "", false, time.Millisecond)
+		}
+		send(b, "", false, time.Second)
+		if !b.Ready("") {
+			t.Fatal("Expected the 90th percentile to be under the threshold")
+		}
+		b.Done("", false, time.Second)
+		if b.Ready("") {
+			t.Error("Expected the breaker to trip")
+		}
+	})
+
+	t.Run("half-open probes", func(t *testing.T) {
+		events = nil
+		b := NewBreaker(apidef.CircuitBreakerMeta{ConsecutiveFailures: 1, HalfOpenProbes: 2}, record)
+		send(b, "", true, 0)
+
+		// Probes are let through as soon as the breaker returns to service
+		if !b.Ready("") || !b.Ready("") || b.Ready("") {
+			t.Fatal("Expected two probes to be let through")
+		}
+		b.Done("", false, 0)
+		b.Done("", true, 0)
+
+		if !send(b, "", false, 0) || !send(b, "", false, 0) {
+			t.Fatal("Expected probes after a failed one")
+		}
+		if !send(b, "", false, 0) || !send(b, "", false, 0) || !send(b, "", false, 0) {
+			t.Fatal("Expected the breaker to close")
+		}
+
+		want := []BreakerEvent{BreakerTripped, BreakerHalfOpen, BreakerTripped, BreakerHalfOpen, BreakerReset}
+		if len(events) != len(want) {
+			t.Fatalf("Expected events %v, got %v", want, events)
+		}
+		for i := range want {
+			if events[i] != want[i] {
+				t.Fatalf("Expected events %v, got %v", want, events)
+			}
+		}
+	})
+
+	t.Run("per host", func(t *testing.T) {
+		b := NewBreaker(apidef.CircuitBreakerMeta{ConsecutiveFailures: 1, ReturnToServiceAfter: 60, PerHost: true}, nil)
+		send(b, "a", true, 0)
+		if b.Ready("a") || !b.Ready("b") {
+			t.Error("Expected only the failing host to be out of service")
+		}
+	})
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer upstream.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.TargetURL = upstream.URL
+		UpdateAPIVersion(spec, "v1", func(v *apidef.VersionInfo) {
+			v.ExtendedPaths.CircuitBreaker = []apidef.CircuitBreakerMeta{{
+				Path:                 "/fail",
+				Method:               http.MethodGet,
+				ConsecutiveFailures:  2,
+				ReturnToServiceAfter: 60,
+			}}
+		})
+	})
+
+	ts.Run(t, []test.TestCase{
+		{Path: "/fail", Code: http.StatusInternalServerError},
+		{Path: "/fail", Code: http.StatusInternalServerError},
+		{Path: "/fail", Code: http.StatusServiceUnavailable},
+		{Path: "/", Code: http.StatusOK},
+	}...)
+}
@@ -8,7 +8,6 @@ import (
 	"time"
 
 	"github.com/Sirupsen/logrus"
-	circuit "github.com/rubyist/circuitbreaker"
 
 	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/TykTechnologies/tyk/config"
@@ -33,6 +32,10 @@ const (
 	EventTokenCreated         apidef.TykEvent = "TokenCreated"
 	EventTokenUpdated         apidef.TykEvent = "TokenUpdated"
 	EventTokenDeleted         apidef.TykEvent = "TokenDeleted"
+
+	EventCertificateExpiringSoon apidef.TykEvent = "CertificateExpiringSoon"
+	EventCertificateExpired      apidef.TykEvent = "CertificateExpired"
+	EventVersionSwitched         apidef.TykEvent = "VersionSwitched"
 )
 
 // EventMetaDefault is a standard embedded struct to be used with custom event metadata types, gives an interface for
@@ -61,7 +64,8 @@ type EventCurcuitBreakerMeta struct {
 	EventMetaDefault
 	Path         string
 	APIID        string
-	CircuitEvent circuit.BreakerEvent
+	Host         string
+	CircuitEvent BreakerEvent
 }
 
 // EventVersionFailureMeta is the metadata structure for an auth failure (EventKeyExpired)
@@ -73,6 +77,15 @@ type EventVersionFailureMeta struct {
 	Reason string
 }
 
+// EventVersionSwitchedMeta is the metadata structure for the default version
+// of an API switching, as its cutover was scheduled or rolled back.
+type EventVersionSwitchedMeta struct {
+	EventMetaDefault
+	APIID string
+	From  string
+	To    string
+}
+
 type EventTriggerExceededMeta struct {
 	EventMetaDefault
 	OrgID           string `json:"org_id"`
@@ -87,6 +100,16 @@ type EventTokenMeta struct {
 	Key string
 }
 
+// EventCertificateExpiryMeta is the metadata structure for certificate
+// expiry events fired by the certificate expiry monitor.
+type EventCertificateExpiryMeta struct {
+	EventMetaDefault
+	CertID   string    `json:"cert_id"`
+	OrgID    string    `json:"org_id"`
+	NotAfter time.Time `json:"not_after"`
+	DaysLeft int       `json:"days_left"`
+}
+
 // EncodeRequestToEvent will write the request out in wire protocol and
 // encode it to base64 and store it in an Event object
 func EncodeRequestToEvent(r *http.Request) string {
@@ -190,7 +213,7 @@ func (l *LogMessageEventHandler) HandleEvent(em config.EventMessage) {
 
 	if em.Type == EventBreakerTriggered {
 		msgConf := em.Meta.(EventCurcuitBreakerMeta)
-		logMsg = logMsg + ":" + msgConf.APIID + ":" + msgConf.Path + ": [STATUS] " + string(msgConf.CircuitEvent)
+		logMsg = logMsg + ":" + msgConf.APIID + ":" + msgConf.Path + ": [STATUS] " + msgConf.CircuitEvent.String()
 	}
 
 	l.logger.Warning(logMsg)
@@ -0,0 +1,87 @@
+package gateway
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/certs"
+	"github.com/TykTechnologies/tyk/headers"
+)
+
+const xfccAppendForward = "append_forward"
+
+// setForwardedClientCert sets X-Forwarded-Client-Cert header of the upstream
+// request to the client certificate of the original request. Header sent by
+// the client is dropped, unless it is appended to.
+func setForwardedClientCert(outreq, req *http.Request, conf apidef.ForwardedCertMeta) {
+	prior := outreq.Header.Get(headers.XForwardClientCert)
+	outreq.Header.Del(headers.XForwardClientCert)
+
+	var element string
+	if req.TLS != nil && len(req.TLS.PeerCertificates) > 0 {
+		element = forwardedClientCertElement(req.TLS.PeerCertificates, conf.Details)
+	}
+
+	value := element
+	if conf.Mode == xfccAppendForward && prior != "" {
+		value = prior
+		if element != "" {
+			value += "," + element
+		}
+	}
+
+	if value != "" {
+		outreq.Header.Set(headers.XForwardClientCert, value)
+	}
+}
+
+// forwardedClientCertElement formats details of the certificate chain as
+// one element of X-Forwarded-Client-Cert header.
+func forwardedClientCertElement(chain []*x509.Certificate, details []string) string {
+	leaf := chain[0]
+	pairs := []string{"Hash=" + certs.HexSHA256(leaf.Raw)}
+
+	for _, detail := range details {
+		switch detail {
+		case "cert":
+			pairs = append(pairs, "Cert="+xfccQuote(xfccEscapePEM(leaf)))
+		case "chain":
+			var chainPEM string
+			for _, cert := range chain {
+				chainPEM += xfccEscapePEM(cert)
+			}
+			pairs = append(pairs, "Chain="+xfccQuote(chainPEM))
+		case "subject":
+			pairs = append(pairs, "Subject="+xfccQuote(leaf.Subject.String()))
+		case "uri":
+			for _, uri := range leaf.URIs {
+				pairs = append(pairs, "URI="+xfccQuote(uri.String()))
+			}
+		case "dns":
+			for _, name := range leaf.DNSNames {
+				pairs = append(pairs, "DNS="+xfccQuote(name))
+			}
+		}
+	}
+
+	return strings.Join(pairs, ";")
+}
+
+// xfccEscapePEM URL encodes PEM of the certificate, as Envoy does.
+func xfccEscapePEM(cert *x509.Certificate) string {
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	return strings.Replace(url.QueryEscape(string(certPEM)), "+", "%20", -1)
+}
+
+// xfccQuote quotes values containing separators.
+func xfccQuote(value string) string {
+	if !strings.ContainsAny(value, `,;="`) {
+		return value
+	}
+
+	return `"` + strings.Replace(value, `"`, `\"`, -1) + `"`
+}
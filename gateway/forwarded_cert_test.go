@@ -0,0 +1,80 @@
+package gateway
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/certs"
+	"github.com/TykTechnologies/tyk/headers"
+)
+
+func TestForwardedClientCert(t *testing.T) {
+	spiffeID, _ := url.Parse("spiffe://example.org/client")
+	_, _, _, clientCert := genCertificate(&x509.Certificate{
+		Subject:  pkix.Name{CommonName: "client", Organization: []string{"Tyk, Inc"}},
+		DNSNames: []string{"client.example.org"},
+		URIs:     []*url.URL{spiffeID},
+	})
+	leaf, _ := x509.ParseCertificate(clientCert.Certificate[0])
+	hash := certs.HexSHA256(leaf.Raw)
+
+	forward := func(conf apidef.ForwardedCertMeta, withCert bool, prior string) string {
+		req := httptest.NewRequest("GET", "/", nil)
+		if withCert {
+			req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}}
+		}
+
+		outreq := req.Clone(req.Context())
+		if prior != "" {
+			outreq.Header.Set(headers.XForwardClientCert, prior)
+		}
+
+		setForwardedClientCert(outreq, req, conf)
+		return outreq.Header.Get(headers.XForwardClientCert)
+	}
+
+	t.Run("Hash", func(t *testing.T) {
+		if xfcc := forward(apidef.ForwardedCertMeta{Enabled: true}, true, "Hash=spoofed"); xfcc != "Hash="+hash {
+			t.Error("Header should contain only the certificate hash", xfcc)
+		}
+	})
+
+	t.Run("Details", func(t *testing.T) {
+		conf := apidef.ForwardedCertMeta{Enabled: true, Details: []string{"subject", "uri", "dns", "cert"}}
+		xfcc := forward(conf, true, "")
+
+		for _, part := range []string{
+			"Hash=" + hash,
+			`;Subject="CN=client,O=Tyk\, Inc"`,
+			";URI=spiffe://example.org/client",
+			";DNS=client.example.org",
+			";Cert=-----BEGIN%20CERTIFICATE-----%0A",
+		} {
+			if !strings.Contains(xfcc, part) {
+				t.Error("Header should contain", part, xfcc)
+			}
+		}
+	})
+
+	t.Run("Sanitize", func(t *testing.T) {
+		if xfcc := forward(apidef.ForwardedCertMeta{Enabled: true}, false, "Hash=spoofed"); xfcc != "" {
+			t.Error("Header sent by client should be dropped", xfcc)
+		}
+	})
+
+	t.Run("Append", func(t *testing.T) {
+		conf := apidef.ForwardedCertMeta{Enabled: true, Mode: "append_forward"}
+		if xfcc := forward(conf, true, "Hash=proxy"); xfcc != "Hash=proxy,Hash="+hash {
+			t.Error("Certificate should be appended", xfcc)
+		}
+		if xfcc := forward(conf, false, "Hash=proxy"); xfcc != "Hash=proxy" {
+			t.Error("Header should be forwarded without client certificate", xfcc)
+		}
+	})
+}
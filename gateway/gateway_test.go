@@ -668,6 +668,51 @@ func TestControlListener(t *testing.T) {
 	ts.RunExt(t, tests...)
 }
 
+func TestWarmUpListener(t *testing.T) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	ready := make(chan struct{})
+	wln := &warmUpListener{Listener: ln, ready: ready}
+	defer wln.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := wln.Accept()
+		accepted <- conn
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	select {
+	case <-accepted:
+		t.Fatal("Connection should not be accepted before warm-up")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(ready)
+	select {
+	case conn := <-accepted:
+		conn.Close()
+	case <-time.After(time.Second):
+		t.Fatal("Connection should be accepted after warm-up")
+	}
+
+	t.Run("Gateway", func(t *testing.T) {
+		globalConf := config.Global()
+		globalConf.Security.CertificateCache.Preload = true
+		config.SetGlobal(globalConf)
+		defer ResetTestConfig()
+
+		ts := StartTest()
+		defer ts.Close()
+
+		ts.Run(t, test.TestCase{Path: "/" + globalConf.HealthCheckEndpointName, Code: http.StatusOK})
+	})
+}
+
 func TestHttpPprof(t *testing.T) {
 	old := cli.HTTPProfile
 	defer func() { cli.HTTPProfile = old }()
@@ -790,7 +835,7 @@ func TestReloadGoroutineLeakWithCircuitBreaker(t *testing.T) {
 
 	after := runtime.NumGoroutine()
 
-	if before < after-1 { // -1 because there is one will be running until we fix circuitbreaker Subscribe() method
+	if before < after {
 		t.Errorf("Goroutine leak, was: %d, after reload: %d", before, after)
 	}
 }
@@ -1229,6 +1274,149 @@ func TestWebsocketsAndHTTPEndpointMatch(t *testing.T) {
 	})
 }
 
+func TestWebsocketsAuth(t *testing.T) {
+	globalConf := config.Global()
+	globalConf.HttpServerOptions.EnableWebSockets = true
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	DRLManager.CurrentTokenValue = 1
+	DRLManager.RequestTokenValue = 1
+	defer func() {
+		DRLManager.CurrentTokenValue = 0
+		DRLManager.RequestTokenValue = 0
+	}()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.UseKeylessAccess = false
+		spec.Proxy.ListenPath = "/"
+	})
+
+	key := CreateSession(func(s *user.SessionState) {
+		s.Rate = 1
+		s.Per = 60
+	})
+
+	baseURL := strings.Replace(ts.URL, "http://", "ws://", -1)
+
+	_, resp, err := websocket.DefaultDialer.Dial(baseURL+"/ws", nil)
+	if err != websocket.ErrBadHandshake || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatal("Upgrade without key should be rejected", err)
+	}
+
+	authHeader := http.Header{"Authorization": {key}}
+	conn, _, err := websocket.DefaultDialer.Dial(baseURL+"/ws", authHeader)
+	if err != nil {
+		t.Fatalf("cannot make websocket connection: %v", err)
+	}
+	conn.Close()
+
+	_, resp, err = websocket.DefaultDialer.Dial(baseURL+"/ws", authHeader)
+	if err != websocket.ErrBadHandshake || resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatal("Upgrade over rate limit should be rejected", err)
+	}
+}
+
+func TestWebsocketsMessagePolicies(t *testing.T) {
+	globalConf := config.Global()
+	globalConf.HttpServerOptions.EnableWebSockets = true
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	baseURL := strings.Replace(ts.URL, "http://", "ws://", -1)
+
+	dial := func(t *testing.T, header http.Header) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial(baseURL+"/ws", header)
+		if err != nil {
+			t.Fatalf("cannot make websocket connection: %v", err)
+		}
+		return conn
+	}
+
+	send := func(t *testing.T, conn *websocket.Conn, msg string) error {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+			t.Fatalf("cannot write message: %v", err)
+		}
+		_, p, err := conn.ReadMessage()
+		if err == nil && string(p) != "reply to message: "+msg {
+			t.Error("Unexpected reply:", string(p))
+		}
+		return err
+	}
+
+	closeCode := func(err error) int {
+		if closeErr, ok := err.(*websocket.CloseError); ok {
+			return closeErr.Code
+		}
+		return 0
+	}
+
+	t.Run("Message size", func(t *testing.T) {
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.Proxy.ListenPath = "/"
+			spec.WebSocket.MaxMessageSize = 10
+		})
+
+		conn := dial(t, nil)
+		defer conn.Close()
+
+		if err := send(t, conn, "short"); err != nil {
+			t.Fatal("Message should be proxied", err)
+		}
+		if err := send(t, conn, strings.Repeat("long", 10)); closeCode(err) != websocket.CloseMessageTooBig {
+			t.Error("Connection should be closed", err)
+		}
+	})
+
+	t.Run("Idle timeout", func(t *testing.T) {
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.Proxy.ListenPath = "/"
+			spec.WebSocket.IdleTimeout = 1
+		})
+
+		conn := dial(t, nil)
+		defer conn.Close()
+
+		if err := send(t, conn, "hello"); err != nil {
+			t.Fatal("Message should be proxied", err)
+		}
+		if _, _, err := conn.ReadMessage(); closeCode(err) != websocket.CloseGoingAway {
+			t.Error("Idle connection should be closed", err)
+		}
+	})
+
+	t.Run("Message quota", func(t *testing.T) {
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.UseKeylessAccess = false
+			spec.Proxy.ListenPath = "/"
+			spec.WebSocket.CountMessagesInQuota = true
+		})
+
+		key := CreateSession(func(s *user.SessionState) {
+			s.QuotaMax = 3
+		})
+
+		conn := dial(t, http.Header{"Authorization": {key}})
+		defer conn.Close()
+
+		// Upgrade request counts as well
+		for _, msg := range []string{"one", "two"} {
+			if err := send(t, conn, msg); err != nil {
+				t.Fatal("Message should be proxied", err)
+			}
+		}
+		if err := send(t, conn, "three"); closeCode(err) != websocket.ClosePolicyViolation {
+			t.Error("Connection should be closed", err)
+		}
+	})
+}
+
 func createTestUptream(t *testing.T, allowedConns int, readsPerConn int) net.Listener {
 	l, _ := net.Listen("tcp", "127.0.0.1:0")
 	go func() {
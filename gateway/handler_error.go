@@ -34,7 +34,9 @@ type ErrorHandler struct {
 func (e *ErrorHandler) HandleError(w http.ResponseWriter, r *http.Request, errMsg string, errCode int, writeResponse bool) {
 	defer e.Base().UpdateRequestSession(r)
 
-	if writeResponse {
+	if writeResponse && IsGRPC(r.Header) {
+		writeGRPCError(w, errMsg, errCode)
+	} else if writeResponse {
 		var templateExtension string
 		var contentType string
 
@@ -129,6 +131,10 @@ func (e *ErrorHandler) HandleError(w http.ResponseWriter, r *http.Request, errMs
 			tags = tagHeaders(r, e.Spec.TagHeaders, tags)
 		}
 
+		if variant := ctxGetVariant(r); variant != "" {
+			tags = append(tags, "variant-"+variant)
+		}
+
 		rawRequest := ""
 		rawResponse := ""
 		if recordDetail(r, e.Spec.GlobalConfig) {
@@ -177,6 +183,10 @@ func (e *ErrorHandler) HandleError(w http.ResponseWriter, r *http.Request, errMs
 			tags,
 			alias,
 			trackEP,
+			ctxGetGraphQLStats(r),
+			grpcStats(e.Spec, r, nil, errCode),
+			false,
+			ctxGetRetries(r),
 			t,
 		}
 
@@ -0,0 +1,57 @@
+package gateway
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/headers"
+)
+
+// IsSSE returns true if the headers are of a Server-Sent Events stream.
+func IsSSE(h http.Header) bool {
+	mediaType, _, _ := mime.ParseMediaType(h.Get(headers.ContentType))
+	return mediaType == "text/event-stream"
+}
+
+// streamSSE sends events to the client as soon as they are received. HTTP/1
+// connections are hijacked, so that the stream isn't cut by write timeout of
+// the server, and the response ends when the connection is closed.
+func (p *ReverseProxy) streamSSE(rw http.ResponseWriter, res *http.Response) {
+	hj, ok := rw.(http.Hijacker)
+	if !ok {
+		rw.WriteHeader(res.StatusCode)
+		if wf, ok := rw.(writeFlusher); ok {
+			p.copyBuffer(flushWriter{wf}, res.Body, nil)
+		} else {
+			p.CopyResponse(rw, res.Body)
+		}
+		return
+	}
+
+	conn, buf, err := hj.Hijack()
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix": "proxy",
+			"org_id": p.TykAPISpec.OrgID,
+			"api_id": p.TykAPISpec.APIID,
+		}).Error("Couldn't hijack connection for event stream: ", err)
+		return
+	}
+	defer conn.Close()
+
+	h := rw.Header()
+	h.Del(headers.ContentLength)
+	h.Set(headers.Connection, "close")
+
+	fmt.Fprintf(buf, "HTTP/1.1 %d %s\r\n", res.StatusCode, http.StatusText(res.StatusCode))
+	h.Write(buf)
+	buf.WriteString("\r\n")
+	if err := buf.Flush(); err != nil {
+		return
+	}
+
+	p.copyBuffer(conn, res.Body, nil)
+}
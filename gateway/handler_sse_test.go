@@ -0,0 +1,112 @@
+package gateway
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	msgpack "gopkg.in/vmihailenco/msgpack.v2"
+
+	"github.com/TykTechnologies/tyk/config"
+)
+
+func TestSSE(t *testing.T) {
+	globalConf := config.Global()
+	globalConf.HttpServerOptions.WriteTimeout = 1
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts := StartTest(TestConfig{
+		Delay: 20 * time.Millisecond,
+	})
+	defer ts.Close()
+
+	next := make(chan bool)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+
+		<-next
+		fmt.Fprint(w, "data: second\n\n")
+	}))
+	defer upstream.Close()
+
+	// readEvents checks that events are received one by one, even when the
+	// stream lasts longer than write timeout of the gateway
+	readEvents := func(t *testing.T) {
+		resp, err := http.Get(ts.URL + "/events")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		events := bufio.NewReader(resp.Body)
+		if line, _ := events.ReadString('\n'); line != "data: first\n" {
+			t.Fatal("First event should be received before the stream ends", line)
+		}
+
+		time.Sleep(1500 * time.Millisecond)
+		next <- true
+
+		events.ReadString('\n')
+		if line, _ := events.ReadString('\n'); line != "data: second\n" {
+			t.Error("Second event should be received", line)
+		}
+	}
+
+	t.Run("Streaming", func(t *testing.T) {
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.Proxy.ListenPath = "/"
+			spec.Proxy.TargetURL = upstream.URL
+		})
+
+		// Cleanup before test
+		time.Sleep(recordsBufferFlushInterval + 50)
+		analytics.Store.GetAndDeleteSet(analyticsKeyName)
+
+		readEvents(t)
+
+		time.Sleep(recordsBufferFlushInterval + 50)
+		results := analytics.Store.GetAndDeleteSet(analyticsKeyName)
+		if len(results) != 1 {
+			t.Fatal("Should return 1 record", len(results))
+		}
+
+		var record AnalyticsRecord
+		msgpack.Unmarshal(results[0].([]byte), &record)
+		if !record.Streamed || record.RequestTime < 1500 {
+			t.Error("Stream should be recorded with its duration", record.Streamed, record.RequestTime)
+		}
+	})
+
+	t.Run("Not cached", func(t *testing.T) {
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.Proxy.ListenPath = "/"
+			spec.Proxy.TargetURL = upstream.URL
+			spec.CacheOptions.EnableCache = true
+			spec.CacheOptions.CacheAllSafeRequests = true
+		})
+
+		readEvents(t)
+		// Cached response would end at once
+		readEvents(t)
+	})
+}
+
+func TestIsSSE(t *testing.T) {
+	for contentType, expected := range map[string]bool{
+		"text/event-stream":                true,
+		"text/event-stream; charset=utf-8": true,
+		"text/plain":                       false,
+		"":                                 false,
+	} {
+		h := http.Header{"Content-Type": {contentType}}
+		if IsSSE(h) != expected {
+			t.Errorf("%q should be detected as event stream: %v", contentType, expected)
+		}
+	}
+}
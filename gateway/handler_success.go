@@ -127,6 +127,8 @@ func (s *SuccessHandler) RecordHit(r *http.Request, timing int64, code int, resp
 		return
 	}
 
+	streamed := responseCopy != nil && IsSSE(responseCopy.Header)
+
 	ip := request.RealIP(r)
 	if s.Spec.GlobalConfig.StoreAnalytics(ip) {
 
@@ -156,6 +158,14 @@ func (s *SuccessHandler) RecordHit(r *http.Request, timing int64, code int, resp
 			tags = tagHeaders(r, s.Spec.TagHeaders, tags)
 		}
 
+		if variant := ctxGetVariant(r); variant != "" {
+			tags = append(tags, "variant-"+variant)
+		}
+
+		if ctxIsMirrored(r) {
+			tags = append(tags, s.Spec.Mirror.conf.Tag)
+		}
+
 		rawRequest := ""
 		rawResponse := ""
 
@@ -226,6 +236,10 @@ func (s *SuccessHandler) RecordHit(r *http.Request, timing int64, code int, resp
 			tags,
 			alias,
 			trackEP,
+			ctxGetGraphQLStats(r),
+			grpcStats(s.Spec, r, responseCopy, code),
+			streamed,
+			ctxGetRetries(r),
 			t,
 		}
 
@@ -251,8 +265,11 @@ func (s *SuccessHandler) RecordHit(r *http.Request, timing int64, code int, resp
 		analytics.RecordHit(&record)
 	}
 
-	// Report in health check
-	reportHealthValue(s.Spec, RequestLog, strconv.FormatInt(timing, 10))
+	// Report in health check, streams and mirrors would skew the request
+	// latency
+	if !streamed && !ctxIsMirrored(r) {
+		reportHealthValue(s.Spec, RequestLog, strconv.FormatInt(timing, 10))
+	}
 
 	if memProfFile != nil {
 		pprof.WriteHeapProfile(memProfFile)
@@ -303,6 +320,8 @@ func (s *SuccessHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) *http
 
 	addVersionHeader(w, r, s.Spec.GlobalConfig)
 
+	s.Spec.Mirror.Shadow(r, s.RecordHit)
+
 	t1 := time.Now()
 	resp := s.Proxy.ServeHTTP(w, r)
 	t2 := time.Now()
@@ -338,6 +357,8 @@ func (s *SuccessHandler) ServeHTTPWithCache(w http.ResponseWriter, r *http.Reque
 		r.URL.RawPath = strings.TrimPrefix(r.URL.RawPath, s.Spec.Proxy.ListenPath)
 	}
 
+	s.Spec.Mirror.Shadow(r, s.RecordHit)
+
 	t1 := time.Now()
 	inRes := s.Proxy.ServeHTTPForCache(w, r)
 	t2 := time.Now()
@@ -3,12 +3,14 @@ package gateway
 import (
 	"context"
 	"crypto/tls"
+	"encoding/binary"
 	"errors"
 	"io"
 	"net"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 
@@ -27,10 +29,18 @@ func canonicalAddr(url *url.URL) string {
 	return addr
 }
 
+// Status codes of WebSocket close frames, RFC 6455 section 7.4.1
+const (
+	wsCloseGoingAway       = 1001
+	wsClosePolicyViolation = 1008
+	wsCloseMessageTooBig   = 1009
+)
+
 type WSDialer struct {
 	*http.Transport
 	RW        http.ResponseWriter
 	TLSConfig *tls.Config
+	Spec      *APISpec
 }
 
 func (ws *WSDialer) RoundTrip(req *http.Request) (*http.Response, error) {
@@ -98,19 +108,62 @@ func (ws *WSDialer) RoundTrip(req *http.Request) (*http.Response, error) {
 		return nil, err
 	}
 
+	var clientReader, upstreamReader io.Reader = nc, d
+	policy := ws.Spec.WebSocket
+
+	if policy.IdleTimeout > 0 {
+		timeout := time.Duration(policy.IdleTimeout) * time.Second
+		touch := func() {
+			deadline := time.Now().Add(timeout)
+			nc.SetReadDeadline(deadline)
+			d.SetReadDeadline(deadline)
+		}
+		touch()
+		clientReader = &wsIdleReader{clientReader, touch}
+		upstreamReader = &wsIdleReader{upstreamReader, touch}
+	}
+
+	if policy.MaxMessageSize > 0 || policy.CountMessagesInQuota {
+		clientReader = &wsMessageReader{
+			r:         clientReader,
+			maxSize:   policy.MaxMessageSize,
+			onMessage: ws.countMessage(req),
+		}
+	}
+
 	errc := make(chan error, 2)
 	cp := func(dst io.Writer, src io.Reader) {
 		_, err := io.Copy(dst, src)
 		errc <- err
 	}
-	go cp(d, nc)
-	go cp(nc, d)
+	go cp(d, clientReader)
+	go cp(nc, upstreamReader)
 
+	var closeErr *wsCloseError
 	for i := 0; i < 2; i++ {
 		cerr := <-errc
-		if cerr == nil {
+		if cerr == nil || closeErr != nil {
 			continue
 		}
+
+		// Copying to connection wraps errors of the reader
+		if e, ok := cerr.(*net.OpError); ok && e.Op == "readfrom" {
+			cerr = e.Err
+		}
+
+		if e, ok := cerr.(*wsCloseError); ok {
+			closeErr = e
+			// Stop copying from upstream, so close frame is the last one
+			// sent to the client
+			d.Close()
+			continue
+		}
+
+		if e, ok := cerr.(net.Error); ok && e.Timeout() && policy.IdleTimeout > 0 {
+			closeErr = &wsCloseError{wsCloseGoingAway, "Idle timeout"}
+			continue
+		}
+
 		err = cerr
 		log.WithFields(logrus.Fields{
 			"path":   req.URL.Path,
@@ -118,19 +171,174 @@ func (ws *WSDialer) RoundTrip(req *http.Request) (*http.Response, error) {
 		}).Errorf("Error transmitting request: %v", err)
 	}
 
+	if closeErr != nil {
+		log.WithFields(logrus.Fields{
+			"path":   req.URL.Path,
+			"origin": ip,
+		}).Info("Closing websocket connection: ", closeErr.reason)
+
+		nc.SetWriteDeadline(time.Now().Add(time.Second))
+		nc.Write(closeErr.frame())
+		return nil, nil
+	}
+
 	return nil, err
 }
 
+// countMessage returns function which counts messages against the key quota,
+// if enabled for the API.
+func (ws *WSDialer) countMessage(req *http.Request) func() error {
+	session := ctxGetSession(req)
+	if !ws.Spec.WebSocket.CountMessagesInQuota || ws.Spec.DisableQuota || session == nil {
+		return nil
+	}
+
+	token := ctxGetAuthToken(req)
+	return func() error {
+		reason := sessionLimiter.ForwardMessage(req, session, token, ws.Spec.SessionManager.Store(),
+			false, true, &ws.Spec.GlobalConfig, ws.Spec.APIID, false)
+		if reason != sessionFailQuota {
+			return nil
+		}
+
+		ws.Spec.FireEvent(EventQuotaExceeded, EventKeyFailureMeta{
+			EventMetaDefault: EventMetaDefault{Message: "Key Quota Limit Exceeded by WebSocket message"},
+			Path:             req.URL.Path,
+			Origin:           request.RealIP(req),
+			Key:              token,
+		})
+		return &wsCloseError{wsClosePolicyViolation, "Quota exceeded"}
+	}
+}
+
+// wsCloseError stops proxying of a WebSocket connection, the client is sent
+// close frame with its code and reason.
+type wsCloseError struct {
+	code   int
+	reason string
+}
+
+func (e *wsCloseError) Error() string {
+	return e.reason
+}
+
+// frame returns close frame as sent by servers, which is not masked.
+func (e *wsCloseError) frame() []byte {
+	payload := append([]byte{byte(e.code >> 8), byte(e.code)}, e.reason...)
+	return append([]byte{0x88, byte(len(payload))}, payload...)
+}
+
+// wsIdleReader calls touch whenever data is read.
+type wsIdleReader struct {
+	io.Reader
+	touch func()
+}
+
+func (i *wsIdleReader) Read(p []byte) (int, error) {
+	n, err := i.Reader.Read(p)
+	if n > 0 {
+		i.touch()
+	}
+	return n, err
+}
+
+// wsMessageReader passes WebSocket frames sent by the client through as they
+// are, checking size of messages and calling onMessage before the first
+// frame of every message is passed.
+type wsMessageReader struct {
+	r         io.Reader
+	maxSize   int64
+	onMessage func() error
+
+	header    []byte // header of the current frame not passed yet
+	remaining int64  // payload of the current frame not passed yet
+	size      int64  // payload size of the current message so far
+}
+
+func (m *wsMessageReader) Read(p []byte) (int, error) {
+	if len(m.header) == 0 && m.remaining == 0 {
+		if err := m.readHeader(); err != nil {
+			return 0, err
+		}
+	}
+
+	if len(m.header) > 0 {
+		n := copy(p, m.header)
+		m.header = m.header[n:]
+		return n, nil
+	}
+
+	if int64(len(p)) > m.remaining {
+		p = p[:m.remaining]
+	}
+	n, err := m.r.Read(p)
+	m.remaining -= int64(n)
+	return n, err
+}
+
+// readHeader reads frame header, RFC 6455 section 5.2.
+func (m *wsMessageReader) readHeader() error {
+	header := make([]byte, 2, 14)
+	if _, err := io.ReadFull(m.r, header); err != nil {
+		return err
+	}
+
+	extra := 0
+	switch header[1] & 0x7F {
+	case 126:
+		extra = 2
+	case 127:
+		extra = 8
+	}
+	// Masking key
+	if header[1]&0x80 != 0 {
+		extra += 4
+	}
+
+	header = header[:2+extra]
+	if _, err := io.ReadFull(m.r, header[2:]); err != nil {
+		return err
+	}
+
+	length := int64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		length = int64(binary.BigEndian.Uint16(header[2:]))
+	case 127:
+		length = int64(binary.BigEndian.Uint64(header[2:]))
+		if length < 0 {
+			return &wsCloseError{wsCloseMessageTooBig, "Message is too big"}
+		}
+	}
+
+	// Control frames may be sent between frames of a message and aren't
+	// counted, continuation frames have opcode 0
+	if opcode := header[0] & 0x0F; opcode < 8 {
+		if opcode != 0 {
+			m.size = 0
+			if m.onMessage != nil {
+				if err := m.onMessage(); err != nil {
+					return err
+				}
+			}
+		}
+
+		m.size += length
+		if m.maxSize > 0 && m.size > m.maxSize {
+			return &wsCloseError{wsCloseMessageTooBig, "Message is too big"}
+		}
+	}
+
+	m.header = header
+	m.remaining = length
+	return nil
+}
+
 func IsWebsocket(req *http.Request) bool {
 	if !config.Global().HttpServerOptions.EnableWebSockets {
 		return false
 	}
 
-	contentType := strings.ToLower(strings.TrimSpace(req.Header.Get(headers.Accept)))
-	if contentType == "text/event-stream" {
-		return true
-	}
-
 	connection := strings.ToLower(strings.TrimSpace(req.Header.Get(headers.Connection)))
 	if connection != "upgrade" {
 		return false
@@ -0,0 +1,205 @@
+package gateway
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+const (
+	// hedgeSamples is how many of the latest response times are kept, and
+	// hedgeMinSamples how many are needed before hedging by percentile.
+	hedgeSamples    = 100
+	hedgeMinSamples = 10
+
+	defaultHedgePercentile = 0.95
+)
+
+// latencyTracker keeps the latest response times of the upstream of an API.
+type latencyTracker struct {
+	mu      sync.Mutex
+	samples [hedgeSamples]time.Duration
+	count   int
+	next    int
+}
+
+func (t *latencyTracker) add(d time.Duration) {
+	t.mu.Lock()
+	t.samples[t.next] = d
+	t.next = (t.next + 1) % hedgeSamples
+	if t.count < hedgeSamples {
+		t.count++
+	}
+	t.mu.Unlock()
+}
+
+// percentile returns the response time p of the latest responses are faster
+// than, if enough of them are known.
+func (t *latencyTracker) percentile(p float64) (time.Duration, bool) {
+	t.mu.Lock()
+	if t.count < hedgeMinSamples {
+		t.mu.Unlock()
+		return 0, false
+	}
+	samples := make([]time.Duration, t.count)
+	copy(samples, t.samples[:t.count])
+	t.mu.Unlock()
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	i := int(p*float64(len(samples))+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(samples) {
+		i = len(samples) - 1
+	}
+	return samples[i], true
+}
+
+// hedgeDelay is how long the first attempt of a request is waited for. Until
+// enough response times are known, requests are only hedged if a MinDelay is
+// set.
+func hedgeDelay(conf apidef.HedgingMeta, latencies *latencyTracker) (time.Duration, bool) {
+	delay := time.Duration(conf.MinDelay) * time.Millisecond
+	p := conf.Percentile
+	if p <= 0 || p > 1 {
+		p = defaultHedgePercentile
+	}
+	d, ok := latencies.percentile(p)
+	if !ok {
+		return delay, delay > 0
+	}
+	if d > delay {
+		delay = d
+	}
+	return delay, true
+}
+
+// shouldHedge tells whether a request may be sent twice: only idempotent
+// requests without a body are.
+func shouldHedge(spec *APISpec, outreq *http.Request) bool {
+	if !spec.Proxy.Hedging.Enabled || spec.hedgeLatency == nil {
+		return false
+	}
+	if outreq.Method != http.MethodGet && outreq.Method != http.MethodHead {
+		return false
+	}
+	return outreq.Body == nil && !IsWebsocket(outreq)
+}
+
+type hedgeResult struct {
+	attempt int
+	res     *http.Response
+	err     error
+}
+
+// cancelOnClose cancels the attempt a response body belongs to once it is
+// read.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// hedgedRoundTrip sends a request, and a second attempt of it if the upstream
+// has not answered it within the hedge delay. The first response is returned
+// and the other attempt is cancelled. Failed attempts wait for the other.
+func (p *ReverseProxy) hedgedRoundTrip(rt http.RoundTripper, outreq *http.Request) (*http.Response, error) {
+	start := time.Now()
+	results := make(chan hedgeResult, 2)
+	var cancels []context.CancelFunc
+	send := func(req *http.Request) {
+		attemptCtx, cancel := context.WithCancel(req.Context())
+		attempt := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			res, err := rt.RoundTrip(req.WithContext(attemptCtx))
+			results <- hedgeResult{attempt: attempt, res: res, err: err}
+		}()
+	}
+
+	send(outreq)
+	// Without a delay the request is only timed, not hedged
+	var hedge <-chan time.Time
+	if delay, ok := hedgeDelay(p.TykAPISpec.Proxy.Hedging, p.TykAPISpec.hedgeLatency); ok {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		hedge = timer.C
+	}
+
+	pending := 1
+	for {
+		select {
+		case <-hedge:
+			log.Debug("[PROXY] Upstream is slow to answer, hedging request")
+			send(p.hedgeRequest(outreq))
+			pending++
+		case result := <-results:
+			if pending--; result.err != nil && pending > 0 {
+				continue
+			}
+
+			for attempt, cancel := range cancels {
+				if attempt != result.attempt {
+					cancel()
+				}
+			}
+			// Responses to the cancelled attempt are discarded
+			for ; pending > 0; pending-- {
+				go func() {
+					if lost := <-results; lost.res != nil {
+						lost.res.Body.Close()
+					}
+				}()
+			}
+
+			if result.err != nil {
+				cancels[result.attempt]()
+				return nil, result.err
+			}
+			p.TykAPISpec.hedgeLatency.add(time.Since(start))
+			result.res.Body = cancelOnClose{ReadCloser: result.res.Body, cancel: cancels[result.attempt]}
+			return result.res, nil
+		}
+	}
+}
+
+// hedgeRequest returns the second attempt of a request, sent to the next
+// target of load balanced APIs. Requests routed to a canary are sent to it
+// again.
+func (p *ReverseProxy) hedgeRequest(outreq *http.Request) *http.Request {
+	hedge := outreq.Clone(outreq.Context())
+	spec := p.TykAPISpec
+	if canary := spec.canary(outreq); canary != nil && ctxGetVariant(outreq) == canary.conf.Name {
+		return hedge
+	}
+	if p.targets == nil && (!spec.Proxy.EnableLoadBalancing || spec.Proxy.ServiceDiscovery.UseDiscoveryService) {
+		return hedge
+	}
+
+	host, err := p.nextTarget(hedge, spec.Proxy.StructuredTargetList)
+	if err != nil {
+		return hedge
+	}
+	target, err := url.Parse(host)
+	if err != nil {
+		return hedge
+	}
+	hedge.URL.Scheme = target.Scheme
+	hedge.URL.Host = target.Host
+	if !spec.Proxy.PreserveHostHeader {
+		hedge.Host = target.Host
+	}
+	return hedge
+}
@@ -0,0 +1,170 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestLatencyTrackerPercentile(t *testing.T) {
+	var tracker latencyTracker
+	for i := 1; i < hedgeMinSamples; i++ {
+		tracker.add(time.Duration(i) * time.Millisecond)
+	}
+	if _, ok := tracker.percentile(0.5); ok {
+		t.Fatal("Expected no percentile before enough samples")
+	}
+
+	for i := hedgeMinSamples; i <= hedgeSamples+20; i++ {
+		tracker.add(time.Duration(i) * time.Millisecond)
+	}
+	// Only the latest samples, from 21ms to 120ms, are kept
+	if d, _ := tracker.percentile(0.95); d != 115*time.Millisecond {
+		t.Errorf("Expected 115ms, got %v", d)
+	}
+	if d, _ := tracker.percentile(0); d != 21*time.Millisecond {
+		t.Errorf("Expected 21ms, got %v", d)
+	}
+}
+
+func TestHedging(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	var slowHits, cancelled int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&slowHits, 1)
+		select {
+		case <-time.After(time.Second):
+			w.Write([]byte("slow"))
+		case <-r.Context().Done():
+			atomic.AddInt32(&cancelled, 1)
+		}
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fast"))
+	}))
+	defer fast.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.EnableLoadBalancing = true
+		spec.Proxy.Targets = []string{slow.URL, fast.URL}
+		spec.Proxy.Hedging = apidef.HedgingMeta{Enabled: true, MinDelay: 20}
+	})
+
+	// Requests sent to the slow target are answered by the other one
+	start := time.Now()
+	ts.Run(t, []test.TestCase{
+		{Path: "/", Code: http.StatusOK, BodyMatch: "fast"},
+		{Path: "/", Code: http.StatusOK, BodyMatch: "fast"},
+	}...)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected hedged requests not to wait for the slow target, took %v", elapsed)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if hits, n := atomic.LoadInt32(&slowHits), atomic.LoadInt32(&cancelled); hits == 0 || n != hits {
+		t.Errorf("Expected the %d slow attempts to be cancelled, %d were", hits, n)
+	}
+}
+
+func TestHedgingOnlyIdempotentRequests(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	var hits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer upstream.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.TargetURL = upstream.URL
+		spec.Proxy.Hedging = apidef.HedgingMeta{Enabled: true, MinDelay: 10}
+	})
+
+	ts.Run(t, test.TestCase{Method: http.MethodPost, Path: "/", Code: http.StatusOK})
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Errorf("Expected POST requests to be sent once, got %d attempts", n)
+	}
+
+	ts.Run(t, test.TestCase{Method: http.MethodGet, Path: "/", Code: http.StatusOK})
+	time.Sleep(10 * time.Millisecond)
+	if n := atomic.LoadInt32(&hits); n != 3 {
+		t.Errorf("Expected slow GET requests to be hedged, got %d attempts", n-1)
+	}
+}
+
+func TestHedgingWithoutResponseTimes(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	var hits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer upstream.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.TargetURL = upstream.URL
+		spec.Proxy.Hedging = apidef.HedgingMeta{Enabled: true}
+	})
+
+	// Without MinDelay, requests are not hedged until response times are
+	// known
+	ts.Run(t, test.TestCase{Path: "/", Code: http.StatusOK})
+	time.Sleep(10 * time.Millisecond)
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Errorf("Expected the request to be sent once, got %d attempts", n)
+	}
+}
+
+func TestHedgingCanary(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	stable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("stable"))
+	}))
+	defer stable.Close()
+	var canaryHits int32
+	canary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&canaryHits, 1) == 1 {
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		w.Write([]byte("canary"))
+	}))
+	defer canary.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.EnableLoadBalancing = true
+		spec.Proxy.Targets = []string{stable.URL}
+		spec.Proxy.Hedging = apidef.HedgingMeta{Enabled: true, MinDelay: 20}
+		spec.VersionData.NotVersioned = true
+		v := spec.VersionData.Versions["v1"]
+		v.Canary = apidef.CanaryMeta{Enabled: true, Header: "X-Canary", HeaderValues: []string{"yes"}, TargetURL: canary.URL}
+		spec.VersionData.Versions["v1"] = v
+	})
+
+	// Hedged canary requests are sent to the canary again
+	ts.Run(t, test.TestCase{Path: "/", Headers: map[string]string{"X-Canary": "yes"}, Code: http.StatusOK, BodyMatch: "canary"})
+	if n := atomic.LoadInt32(&canaryHits); n != 2 {
+		t.Errorf("Expected the canary to get both attempts, got %d", n)
+	}
+}
@@ -131,7 +131,7 @@ func TestHostChecker(t *testing.T) {
 	for i := 0; i < 10; i++ {
 		targetWG.Add(1)
 		go func() {
-			host, err := nextTarget(spec.Proxy.StructuredTargetList, spec)
+			host, err := nextTarget(nil, spec.Proxy.StructuredTargetList, spec)
 			if err != nil {
 				t.Error("Should return nil error, got", err)
 			}
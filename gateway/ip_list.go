@@ -0,0 +1,224 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/TykTechnologies/tyk/storage"
+)
+
+// ipListStore keeps IP lists which API definitions refer to by name, each
+// as its CIDR ranges, one per line.
+var ipListStore storage.Handler = &storage.RedisCluster{KeyPrefix: "ip-list-"}
+
+// ipTree is a binary radix tree of IP ranges, matching an IP in at most 128
+// steps whatever the number of ranges. IPv4 ranges are kept as IPv4-mapped
+// IPv6 ranges. Ranges are aggregated as they are inserted: ranges within
+// another are dropped, and two halves of a range are merged into it.
+type ipTree struct {
+	root ipNode
+}
+
+type ipNode struct {
+	children [2]*ipNode
+	// full is set when the whole range of the node is in the tree
+	full bool
+}
+
+// parseIPRange parses an IP or a CIDR range into its IPv6 address and prefix
+// length.
+func parseIPRange(entry string) (net.IP, int, error) {
+	if ip := net.ParseIP(entry); ip != nil {
+		return ip.To16(), 128, nil
+	}
+
+	_, network, err := net.ParseCIDR(entry)
+	if err != nil {
+		return nil, 0, errors.New(strconv.Quote(entry) + " is not an IP address or CIDR range")
+	}
+	ones, bits := network.Mask.Size()
+	return network.IP.To16(), ones + 128 - bits, nil
+}
+
+func ipBit(ip net.IP, i int) int {
+	return int(ip[i/8]>>uint(7-i%8)) & 1
+}
+
+func newIPTree(entries []string) (*ipTree, error) {
+	tree := &ipTree{}
+	for _, entry := range entries {
+		if err := tree.Insert(entry); err != nil {
+			return nil, err
+		}
+	}
+	return tree, nil
+}
+
+// Insert adds an IP or a CIDR range to the tree.
+func (t *ipTree) Insert(entry string) error {
+	ip, length, err := parseIPRange(entry)
+	if err != nil {
+		return err
+	}
+
+	path := make([]*ipNode, 0, length)
+	node := &t.root
+	for i := 0; i < length; i++ {
+		if node.full {
+			return nil
+		}
+		path = append(path, node)
+
+		bit := ipBit(ip, i)
+		if node.children[bit] == nil {
+			node.children[bit] = &ipNode{}
+		}
+		node = node.children[bit]
+	}
+	node.full = true
+	node.children = [2]*ipNode{}
+
+	// Merge full halves up the path
+	for i := len(path) - 1; i >= 0; i-- {
+		parent := path[i]
+		if parent.children[0] == nil || !parent.children[0].full ||
+			parent.children[1] == nil || !parent.children[1].full {
+			break
+		}
+		parent.full = true
+		parent.children = [2]*ipNode{}
+	}
+	return nil
+}
+
+// Contains tells whether the IP is in any range of the tree.
+func (t *ipTree) Contains(ip net.IP) bool {
+	ip = ip.To16()
+	if t == nil || ip == nil {
+		return false
+	}
+
+	node := &t.root
+	for i := 0; i < 128 && node != nil; i++ {
+		if node.full {
+			return true
+		}
+		node = node.children[ipBit(ip, i)]
+	}
+	return node != nil && node.full
+}
+
+// Ranges returns the aggregated ranges of the tree as CIDR ranges, IPv4
+// ranges in IPv4 notation.
+func (t *ipTree) Ranges() []string {
+	ranges := []string{}
+	var walk func(node *ipNode, ip net.IP, length int)
+	walk = func(node *ipNode, ip net.IP, length int) {
+		if node.full {
+			network := net.IPNet{IP: ip, Mask: net.CIDRMask(length, 128)}
+			if ip4 := ip.To4(); ip4 != nil && length >= 96 {
+				network = net.IPNet{IP: ip4, Mask: net.CIDRMask(length-96, 32)}
+			}
+			ranges = append(ranges, network.String())
+			return
+		}
+		for bit, child := range node.children {
+			if child == nil {
+				continue
+			}
+			next := make(net.IP, net.IPv6len)
+			copy(next, ip)
+			next[length/8] |= byte(bit) << uint(7-length%8)
+			walk(child, next, length+1)
+		}
+	}
+	walk(&t.root, make(net.IP, net.IPv6len), 0)
+	return ranges
+}
+
+func getIPList(name string) ([]string, error) {
+	value, err := ipListStore.GetKey(name)
+	if err != nil {
+		return nil, err
+	}
+	if value == "" {
+		return []string{}, nil
+	}
+	return strings.Split(value, "\n"), nil
+}
+
+// loadIPTree builds the tree of IPs and CIDR ranges of an API definition and
+// of the IP lists it refers to. Invalid IPs are skipped, as reported by API
+// definition validation, and lists which can't be loaded are logged.
+func loadIPTree(ips, lists []string) *ipTree {
+	tree := &ipTree{}
+	for _, ip := range ips {
+		tree.Insert(ip)
+	}
+
+	for _, name := range lists {
+		entries, err := getIPList(name)
+		if err != nil {
+			log.WithField("list", name).Error("Could not load IP list: ", err)
+			continue
+		}
+		for _, entry := range entries {
+			tree.Insert(entry)
+		}
+	}
+	return tree
+}
+
+type apiIPList struct {
+	Name   string   `json:"name"`
+	Ranges []string `json:"ranges"`
+}
+
+// ipListHandler manages IP lists. Lists are stored aggregated, and every
+// gateway of the group is reloaded as they change, for APIs referring to them
+// to enforce the new ranges.
+func ipListHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	switch r.Method {
+	case http.MethodGet:
+		ranges, err := getIPList(name)
+		if err != nil {
+			doJSONWrite(w, http.StatusNotFound, apiError("IP list not found"))
+			return
+		}
+		doJSONWrite(w, http.StatusOK, apiIPList{Name: name, Ranges: ranges})
+	case http.MethodPut:
+		var entries []string
+		if err := json.NewDecoder(r.Body).Decode(&entries); err != nil {
+			doJSONWrite(w, http.StatusBadRequest, apiError("Request malformed"))
+			return
+		}
+		tree, err := newIPTree(entries)
+		if err != nil {
+			doJSONWrite(w, http.StatusBadRequest, apiError(err.Error()))
+			return
+		}
+
+		ranges := tree.Ranges()
+		if err := ipListStore.SetKey(name, strings.Join(ranges, "\n"), 0); err != nil {
+			doJSONWrite(w, http.StatusInternalServerError, apiError("Could not store IP list"))
+			return
+		}
+		MainNotifier.Notify(Notification{Command: NoticeGroupReload})
+		doJSONWrite(w, http.StatusOK, apiIPList{Name: name, Ranges: ranges})
+	case http.MethodDelete:
+		if !ipListStore.DeleteKey(name) {
+			doJSONWrite(w, http.StatusNotFound, apiError("IP list not found"))
+			return
+		}
+		MainNotifier.Notify(Notification{Command: NoticeGroupReload})
+		doJSONWrite(w, http.StatusOK, apiOk("IP list deleted"))
+	}
+}
@@ -0,0 +1,125 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestIPTree(t *testing.T) {
+	tree, err := newIPTree([]string{
+		"10.0.0.0/25", "10.0.0.128/25", "10.0.0.7",
+		"192.168.1.1", "192.168.0.0/16",
+		"2001:db8::/33", "2001:db8:8000::/33",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for ip, contained := range map[string]bool{
+		"10.0.0.200":      true,
+		"10.0.1.1":        false,
+		"192.168.42.42":   true,
+		"2001:db8::1":     true,
+		"2001:db9::1":     false,
+		"::ffff:10.0.0.1": true,
+	} {
+		if tree.Contains(net.ParseIP(ip)) != contained {
+			t.Errorf("Expected %s to be contained: %v", ip, contained)
+		}
+	}
+
+	want := []string{"10.0.0.0/24", "192.168.0.0/16", "2001:db8::/32"}
+	if ranges := tree.Ranges(); !reflect.DeepEqual(ranges, want) {
+		t.Errorf("Ranges should be aggregated, expected %v, got %v", want, ranges)
+	}
+
+	if _, err := newIPTree([]string{"localhost"}); err == nil {
+		t.Error("Invalid IPs should be rejected")
+	}
+}
+
+func TestIPLists(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	// List changes queue a reload, let it run unless a tick is pending
+	waitReload := func() {
+		reloaded := make(chan struct{})
+		reloadURLStructure(func() { close(reloaded) })
+		select {
+		case ReloadTick <- time.Time{}:
+			<-reloaded
+		case <-reloaded:
+		}
+	}
+
+	ts.Run(t, []test.TestCase{
+		{Method: http.MethodPut, Path: "/tyk/ip-lists/offices", Data: `["10.0.0.0/25", "10.0.0.128/25"]`, AdminAuth: true, Code: http.StatusOK, BodyMatch: `"ranges":["10.0.0.0/24"]`},
+		{Method: http.MethodPut, Path: "/tyk/ip-lists/invalid", Data: `["10.0.0.0/33"]`, AdminAuth: true, Code: http.StatusBadRequest},
+		{Path: "/tyk/ip-lists/offices", AdminAuth: true, Code: http.StatusOK, BodyMatch: `10.0.0.0/24`},
+		{Path: "/tyk/ip-lists/unknown", AdminAuth: true, Code: http.StatusNotFound},
+	}...)
+	waitReload()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/allowed/"
+		spec.EnableIpWhiteListing = true
+		spec.AllowedIPLists = []string{"offices"}
+	}, func(spec *APISpec) {
+		spec.APIID = "blocked"
+		spec.Proxy.ListenPath = "/blocked/"
+		spec.EnableIpBlacklisting = true
+		spec.BlacklistedIPLists = []string{"offices", "unknown"}
+	})
+
+	from := func(ip string) map[string]string {
+		return map[string]string{"X-Forwarded-For": ip}
+	}
+	ts.Run(t, []test.TestCase{
+		{Path: "/allowed/", Headers: from("10.0.0.200"), Code: http.StatusOK},
+		{Path: "/allowed/", Headers: from("10.0.1.1"), Code: http.StatusForbidden},
+		{Path: "/blocked/", Headers: from("10.0.0.200"), Code: http.StatusForbidden},
+		{Path: "/blocked/", Headers: from("10.0.1.1"), Code: http.StatusOK},
+	}...)
+
+	ts.Run(t, []test.TestCase{
+		{Method: http.MethodDelete, Path: "/tyk/ip-lists/offices", AdminAuth: true, Code: http.StatusOK},
+		{Path: "/tyk/ip-lists/offices", AdminAuth: true, Code: http.StatusNotFound},
+	}...)
+	waitReload()
+}
+
+func TestKeyAllowedIPs(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	spec := BuildAndLoadAPI(func(spec *APISpec) {
+		spec.UseKeylessAccess = false
+		spec.Proxy.ListenPath = "/"
+	})[0]
+
+	key := CreateSession(func(s *user.SessionState) {
+		s.AllowedIPs = []string{"10.0.0.0/24"}
+	})
+	authorization := func(ip string) map[string]string {
+		return map[string]string{"Authorization": key, "X-Forwarded-For": ip}
+	}
+
+	session := CreateStandardSession()
+	session.AccessRights = map[string]user.AccessDefinition{spec.APIID: {APIID: spec.APIID}}
+	session.AllowedIPs = []string{"not an IP"}
+	invalid, _ := json.Marshal(session)
+
+	ts.Run(t, []test.TestCase{
+		{Headers: authorization("10.0.0.1"), Code: http.StatusOK},
+		{Headers: authorization("10.0.1.1"), Code: http.StatusForbidden},
+		{Method: http.MethodPost, Path: "/tyk/keys/create", Data: invalid, AdminAuth: true, Code: http.StatusBadRequest},
+	}...)
+}
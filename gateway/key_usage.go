@@ -0,0 +1,161 @@
+package gateway
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/storage"
+)
+
+const (
+	keyUsageLastUsed = "last-used"
+	keyUsageRequests = "requests"
+
+	defaultKeyUsageFlushInterval = 10
+)
+
+// keyUsageStore keeps the usage of keys in sorted sets by their hashes, one
+// scored by when they were last used, so stale keys are found by score, and
+// one by how many requests they made.
+var keyUsageStore storage.Handler = &storage.RedisCluster{KeyPrefix: "key-usage-"}
+
+var (
+	keyUsage     = newKeyUsageRecorder()
+	keyUsageOnce sync.Once
+)
+
+// keyUsageRecorder counts the usage of keys in memory until it is flushed to
+// storage, so that requests don't wait for it.
+type keyUsageRecorder struct {
+	mu       sync.Mutex
+	lastUsed map[string]float64
+	requests map[string]float64
+}
+
+func newKeyUsageRecorder() *keyUsageRecorder {
+	return &keyUsageRecorder{
+		lastUsed: make(map[string]float64),
+		requests: make(map[string]float64),
+	}
+}
+
+// Record counts a request made with the key of the hash.
+func (u *keyUsageRecorder) Record(keyHash string) {
+	now := float64(time.Now().Unix())
+
+	u.mu.Lock()
+	u.lastUsed[keyHash] = now
+	u.requests[keyHash]++
+	u.mu.Unlock()
+}
+
+// Flush writes the usage counted since the last flush to storage.
+func (u *keyUsageRecorder) Flush() {
+	u.mu.Lock()
+	lastUsed, requests := u.lastUsed, u.requests
+	u.lastUsed, u.requests = make(map[string]float64), make(map[string]float64)
+	u.mu.Unlock()
+
+	keyUsageStore.AddToSortedSetPipelined(keyUsageLastUsed, lastUsed)
+	keyUsageStore.IncrementSortedSetPipelined(keyUsageRequests, requests)
+}
+
+func (u *keyUsageRecorder) FlushLoop(ticker <-chan time.Time) {
+	for range ticker {
+		u.Flush()
+	}
+}
+
+func startKeyUsageFlush() {
+	interval := config.Global().KeyUsage.FlushInterval
+	if interval <= 0 {
+		interval = defaultKeyUsageFlushInterval
+	}
+
+	keyUsageOnce.Do(func() {
+		keyUsageStore.Connect()
+		go keyUsage.FlushLoop(time.Tick(time.Duration(interval) * time.Second))
+	})
+}
+
+// recordKeyUsage counts a request made with a key, if usage is tracked.
+func recordKeyUsage(key string) {
+	if !config.Global().KeyUsage.Enabled || key == "" {
+		return
+	}
+	keyUsage.Record(storage.HashKey(key))
+}
+
+type apiKeyUsage struct {
+	Key      string `json:"key"`
+	LastUsed int64  `json:"last_used"`
+	Requests int64  `json:"requests"`
+}
+
+type apiKeysUsage struct {
+	Keys []apiKeyUsage `json:"keys"`
+}
+
+func getKeyUsage(keyHash string) (apiKeyUsage, bool) {
+	lastUsed, err := keyUsageStore.GetSortedSetScore(keyUsageLastUsed, keyHash)
+	if err != nil {
+		return apiKeyUsage{}, false
+	}
+	requests, _ := keyUsageStore.GetSortedSetScore(keyUsageRequests, keyHash)
+
+	return apiKeyUsage{Key: keyHash, LastUsed: int64(lastUsed), Requests: int64(requests)}, true
+}
+
+// keyUsageHandler returns when a key was last used and how many requests it
+// made, as far as its usage was tracked.
+func keyUsageHandler(w http.ResponseWriter, r *http.Request) {
+	keyName := mux.Vars(r)["keyName"]
+	if r.URL.Query().Get("hashed") == "" {
+		keyName = storage.HashKey(keyName)
+	} else if !config.Global().HashKeys {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Key requested by hash but key hashing is not enabled"))
+		return
+	}
+
+	usage, found := getKeyUsage(keyName)
+	if !found {
+		doJSONWrite(w, http.StatusNotFound, apiError("Key usage not found"))
+		return
+	}
+	doJSONWrite(w, http.StatusOK, usage)
+}
+
+// staleKeysHandler lists the keys which haven't been used for the given
+// number of seconds, so that they can be revoked. Keys never used since usage
+// is tracked aren't known.
+func staleKeysHandler(w http.ResponseWriter, r *http.Request) {
+	unusedFor, err := strconv.ParseInt(r.URL.Query().Get("unused_for"), 10, 64)
+	if err != nil || unusedFor < 0 {
+		doJSONWrite(w, http.StatusBadRequest, apiError("unused_for must be a number of seconds"))
+		return
+	}
+
+	before := strconv.FormatInt(time.Now().Unix()-unusedFor, 10)
+	keys, _, err := keyUsageStore.GetSortedSetRange(keyUsageLastUsed, "-inf", "("+before)
+	if err != nil {
+		doJSONWrite(w, http.StatusInternalServerError, apiError("Could not read key usage"))
+		return
+	}
+
+	stale := apiKeysUsage{Keys: []apiKeyUsage{}}
+	for _, keyHash := range keys {
+		// Usage outlives deleted keys
+		if _, found := FallbackKeySesionManager.SessionDetail(keyHash, true); !found {
+			continue
+		}
+		if usage, found := getKeyUsage(keyHash); found {
+			stale.Keys = append(stale.Keys, usage)
+		}
+	}
+	doJSONWrite(w, http.StatusOK, stale)
+}
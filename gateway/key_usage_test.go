@@ -0,0 +1,75 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestKeyUsage(t *testing.T) {
+	globalConf := config.Global()
+	globalConf.HashKeys = true
+	globalConf.KeyUsage.Enabled = true
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.UseKeylessAccess = false
+		spec.Proxy.ListenPath = "/"
+	})
+
+	used, stale := CreateSession(), CreateSession()
+	authorization := map[string]string{"Authorization": used}
+	ts.Run(t, []test.TestCase{
+		{Headers: authorization, Code: http.StatusOK},
+		{Headers: authorization, Code: http.StatusOK},
+		{Headers: map[string]string{"Authorization": "unknown"}, Code: http.StatusForbidden},
+	}...)
+	keyUsage.Flush()
+
+	t.Run("Key usage", func(t *testing.T) {
+		resp, _ := ts.Run(t, []test.TestCase{
+			{Path: "/tyk/keys/unknown/usage", AdminAuth: true, Code: http.StatusNotFound},
+			{Path: "/tyk/keys/" + used + "/usage", AdminAuth: true, Code: http.StatusOK, BodyMatch: `"requests":2`},
+			{Path: "/tyk/keys/" + storage.HashKey(used) + "/usage?hashed=1", AdminAuth: true, Code: http.StatusOK, BodyMatch: `"requests":2`},
+		}...)
+
+		usage := apiKeyUsage{}
+		json.NewDecoder(resp.Body).Decode(&usage)
+		if time.Since(time.Unix(usage.LastUsed, 0)) > time.Minute {
+			t.Error("Key should have been used just now, got", usage.LastUsed)
+		}
+	})
+
+	t.Run("Stale keys", func(t *testing.T) {
+		keyUsageStore.AddToSortedSetPipelined(keyUsageLastUsed, map[string]float64{
+			storage.HashKey(stale): float64(time.Now().Add(-time.Hour).Unix()),
+		})
+
+		resp, _ := ts.Run(t, []test.TestCase{
+			{Path: "/tyk/keys/usage", AdminAuth: true, Code: http.StatusBadRequest},
+			{Path: "/tyk/keys/usage?unused_for=60", AdminAuth: true, Code: http.StatusOK},
+		}...)
+
+		usage := apiKeysUsage{}
+		json.NewDecoder(resp.Body).Decode(&usage)
+		found := map[string]bool{}
+		for _, key := range usage.Keys {
+			found[key.Key] = true
+		}
+		if !found[storage.HashKey(stale)] {
+			t.Error("Key unused for an hour should be stale")
+		}
+		if found[storage.HashKey(used)] {
+			t.Error("Key used just now shouldn't be stale")
+		}
+	})
+}
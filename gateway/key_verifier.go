@@ -0,0 +1,55 @@
+package gateway
+
+import (
+	"crypto/sha256"
+	"time"
+
+	cache "github.com/pmylund/go-cache"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+// Sessions are indexed by the fast hash of their keys, of which murmur hashes
+// are easily collided and any hash lets weak custom keys be brute-forced. With
+// hash_key_verifier set, sessions also keep a slow hash of their key, which
+// every key has to match. Keys stored before get it on first use.
+
+// keyVerifierCache remembers the keys which matched a slow hash, so that they
+// are hashed once a minute rather than on every request.
+var keyVerifierCache = cache.New(60*time.Second, 60*time.Minute)
+
+// setKeyVerifier stores the slow hash of a key with its session, unless it
+// has one already or keys aren't hashed at all.
+func setKeyVerifier(key string, session *user.SessionState) {
+	algorithm := config.Global().HashKeyVerifier
+	if algorithm == "" || !config.Global().HashKeys || session.KeyVerifier != "" {
+		return
+	}
+
+	verifier, err := storage.SlowHashStr(key, algorithm)
+	if err != nil {
+		log.WithError(err).Error("Could not hash key, storing it without slow hash")
+		return
+	}
+	session.KeyVerifier = verifier
+}
+
+// verifyKey checks a key matches the slow hash of its session, if any.
+func verifyKey(key string, session *user.SessionState) bool {
+	if session.KeyVerifier == "" {
+		return true
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	if verified, ok := keyVerifierCache.Get(session.KeyVerifier); ok && verified.(string) == string(sum[:]) {
+		return true
+	}
+
+	if err := storage.CompareSlowHash(session.KeyVerifier, key); err != nil {
+		return false
+	}
+	keyVerifierCache.Set(session.KeyVerifier, string(sum[:]), cache.DefaultExpiration)
+	return true
+}
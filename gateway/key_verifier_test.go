@@ -0,0 +1,69 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestKeyVerifier(t *testing.T) {
+	globalConf := config.Global()
+	globalConf.HashKeys = true
+	globalConf.HashKeyVerifier = storage.HashBcrypt
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	spec := BuildAndLoadAPI(func(spec *APISpec) {
+		spec.UseKeylessAccess = false
+		spec.Proxy.ListenPath = "/"
+	})[0]
+
+	t.Run("Created keys", func(t *testing.T) {
+		session := CreateStandardSession()
+		session.AccessRights = map[string]user.AccessDefinition{spec.APIID: {APIID: spec.APIID}}
+		session.KeyVerifier = "not a hash"
+		sessionJSON, _ := json.Marshal(session)
+
+		resp, _ := ts.Run(t, test.TestCase{Method: http.MethodPost, Path: "/tyk/keys/create", Data: sessionJSON, AdminAuth: true, Code: http.StatusOK})
+		created := apiModifyKeySuccess{}
+		json.NewDecoder(resp.Body).Decode(&created)
+
+		stored, _ := spec.SessionManager.SessionDetail(created.Key, false)
+		if err := storage.CompareSlowHash(stored.KeyVerifier, created.Key); err != nil {
+			t.Fatal("Key should be stored with its slow hash:", err)
+		}
+		ts.Run(t, test.TestCase{Headers: map[string]string{"Authorization": created.Key}, Code: http.StatusOK})
+	})
+
+	t.Run("Keys stored before", func(t *testing.T) {
+		key := CreateSession()
+		if stored, _ := spec.SessionManager.SessionDetail(key, false); stored.KeyVerifier != "" {
+			t.Fatal("Test keys shouldn't have a slow hash yet")
+		}
+
+		ts.Run(t, test.TestCase{Headers: map[string]string{"Authorization": key}, Code: http.StatusOK})
+
+		stored, _ := spec.SessionManager.SessionDetail(key, false)
+		if err := storage.CompareSlowHash(stored.KeyVerifier, key); err != nil {
+			t.Fatal("Key should be rehashed on first use:", err)
+		}
+		ts.Run(t, test.TestCase{Headers: map[string]string{"Authorization": key}, Code: http.StatusOK})
+	})
+
+	t.Run("Colliding keys", func(t *testing.T) {
+		// A key with the fast hash, but not the slow hash, of a stored key
+		key := CreateSession(func(s *user.SessionState) {
+			s.KeyVerifier, _ = storage.SlowHashStr("another key", storage.HashBcrypt)
+		})
+
+		ts.Run(t, test.TestCase{Headers: map[string]string{"Authorization": key}, Code: http.StatusForbidden})
+	})
+}
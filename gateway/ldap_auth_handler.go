@@ -5,6 +5,8 @@ import (
 	"strings"
 
 	"github.com/mavricknz/ldap"
+
+	"github.com/TykTechnologies/tyk/storage"
 )
 
 // LDAPStorageHandler implements storage.Handler, this is a read-only implementation to access keys from an LDAP service
@@ -133,6 +135,16 @@ func (l *LDAPStorageHandler) SetRawKey(cn, session string, timeout int64) error
 	return nil
 }
 
+func (l *LDAPStorageHandler) CompareAndSetKey(cn string, check func(string, bool) bool, session string, timeout int64) (bool, error) {
+	l.notifyReadOnly()
+	return false, storage.ErrNotSupported
+}
+
+func (l *LDAPStorageHandler) CompareAndSetRawKey(cn string, check func(string, bool) bool, session string, timeout int64) (bool, error) {
+	l.notifyReadOnly()
+	return false, storage.ErrNotSupported
+}
+
 func (l *LDAPStorageHandler) DeleteKey(cn string) bool {
 	return l.notifyReadOnly()
 }
@@ -169,6 +181,11 @@ func (l *LDAPStorageHandler) GetRollingWindow(keyName string, per int64, pipelin
 	return 0, nil
 }
 
+func (l *LDAPStorageHandler) SlidingWindow(keyName string, per float64, limit int, burstPer float64, burst int, dryRun bool) (int, bool, error) {
+	log.Warning("Not Implemented!")
+	return 0, false, storage.ErrNotSupported
+}
+
 func (l LDAPStorageHandler) GetSet(keyName string) (map[string]string, error) {
 	log.Error("Not implemented")
 	return nil, nil
@@ -209,6 +226,19 @@ func (l LDAPStorageHandler) AddToSortedSet(keyName, value string, score float64)
 	log.Error("Not implemented")
 }
 
+func (l LDAPStorageHandler) AddToSortedSetPipelined(keyName string, scores map[string]float64) {
+	log.Error("Not implemented")
+}
+
+func (l LDAPStorageHandler) IncrementSortedSetPipelined(keyName string, increments map[string]float64) {
+	log.Error("Not implemented")
+}
+
+func (l LDAPStorageHandler) GetSortedSetScore(keyName, value string) (float64, error) {
+	log.Error("Not implemented")
+	return 0, nil
+}
+
 func (l LDAPStorageHandler) GetSortedSetRange(keyName, scoreFrom, scoreTo string) ([]string, []float64, error) {
 	log.Error("Not implemented")
 	return nil, nil, nil
@@ -2,11 +2,13 @@ package gateway
 
 import (
 	"encoding/json"
+	"time"
 
 	"rsc.io/letsencrypt"
 
 	"github.com/Sirupsen/logrus"
 
+	"github.com/TykTechnologies/tyk/certs"
 	"github.com/TykTechnologies/tyk/config"
 	"github.com/TykTechnologies/tyk/storage"
 )
@@ -100,3 +102,22 @@ func StartPeriodicStateBackup(m *letsencrypt.Manager) {
 		LE_FIRSTRUN = true
 	}
 }
+
+// setupACME restores the Let's Encrypt account state and creates
+// ACMEManager, which stores issued certificates in CertificateManager.
+func setupACME(conf config.ACMEConfig) {
+	GetLEState(&LE_MANAGER)
+
+	if conf.Email != "" && !LE_MANAGER.Registered() {
+		if err := LE_MANAGER.Register(conf.Email, nil); err != nil {
+			log.Error("[SSL] --> ACME registration failed: ", err)
+		}
+	}
+
+	LE_MANAGER.SetHosts(conf.Hosts)
+
+	ACMEManager = certs.NewACMEManager(CertificateManager, &LE_MANAGER, "")
+	if conf.RenewBefore > 0 {
+		ACMEManager.RenewBefore = time.Duration(conf.RenewBefore) * 24 * time.Hour
+	}
+}
@@ -0,0 +1,244 @@
+package gateway
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/TykTechnologies/murmur3"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/request"
+)
+
+// hashRingReplicas is how many points of the ring each unit of weight of a
+// target gets.
+const hashRingReplicas = 100
+
+var (
+	errNoTargets      = errors.New("no targets to balance over")
+	errAllTargetsDown = errors.New("all hosts are down, uptime tests are failing")
+)
+
+// LoadBalancer picks the target of each request to a load balanced API, or
+// version, among the targets of the lowest priority that are up.
+type LoadBalancer struct {
+	conf apidef.LoadBalancingMeta
+	rr   RoundRobin
+
+	mu sync.Mutex
+	// current is the state of the smooth weighted round robin, as nginx
+	// does it, and active the requests in flight to each host.
+	current map[string]int
+	active  map[string]int64
+	ring    *hashRing
+
+	// health ejects the targets failing the health checks of the API.
+	health *UpstreamHealthChecker
+}
+
+func NewLoadBalancer(conf apidef.LoadBalancingMeta) *LoadBalancer {
+	return &LoadBalancer{
+		conf:    conf,
+		current: make(map[string]int),
+		active:  make(map[string]int64),
+	}
+}
+
+// Next returns the target of request r among targets, skipping those ejected
+// by the health checks, and those the host checker reports down if checkUp is
+// set.
+func (lb *LoadBalancer) Next(r *http.Request, targets *apidef.HostList, checkUp bool) (string, error) {
+	hosts, weights := targets.Weighted()
+	if len(hosts) == 0 {
+		return "", errNoTargets
+	}
+
+	// Keep the targets of the lowest priority that are up
+	var candidates []int
+	for i, host := range hosts {
+		if lb.health.Down(EnsureTransport(host)) {
+			continue
+		}
+		if checkUp && GlobalHostChecker.HostDown(EnsureTransport(host)) {
+			continue
+		}
+		if len(candidates) > 0 {
+			lowest := weights[candidates[0]].Priority
+			if weights[i].Priority > lowest {
+				continue
+			}
+			if weights[i].Priority < lowest {
+				candidates = candidates[:0]
+			}
+		}
+		candidates = append(candidates, i)
+	}
+	if len(candidates) == 0 {
+		return "", errAllTargetsDown
+	}
+
+	var pick int
+	switch lb.conf.Strategy {
+	case apidef.LoadBalancingWeighted:
+		pick = lb.weighted(hosts, weights, candidates)
+	case apidef.LoadBalancingLeastConnections:
+		pick = lb.leastConnections(hosts, weights, candidates)
+	case apidef.LoadBalancingConsistentHash:
+		if key := lb.hashKey(r); key != "" {
+			pick = lb.consistentHash(key, hosts, weights, candidates)
+			break
+		}
+		fallthrough
+	default:
+		pick = candidates[lb.rr.WithLen(len(candidates))]
+	}
+	return EnsureTransport(hosts[pick]), nil
+}
+
+func (lb *LoadBalancer) weighted(hosts []string, weights []apidef.HostWeight, candidates []int) int {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	best, total := -1, 0
+	for _, i := range candidates {
+		lb.current[hosts[i]] += weights[i].Weight
+		total += weights[i].Weight
+		if best < 0 || lb.current[hosts[i]] > lb.current[hosts[best]] {
+			best = i
+		}
+	}
+	lb.current[hosts[best]] -= total
+	return best
+}
+
+// leastConnections picks the target with the fewest requests in flight per
+// unit of weight, starting from the next in round robin to spread ties.
+func (lb *LoadBalancer) leastConnections(hosts []string, weights []apidef.HostWeight, candidates []int) int {
+	start := lb.rr.WithLen(len(candidates))
+
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	best := -1
+	var bestLoad float64
+	for n := range candidates {
+		i := candidates[(start+n)%len(candidates)]
+		load := float64(lb.active[targetHost(hosts[i])]) / float64(weights[i].Weight)
+		if best < 0 || load < bestLoad {
+			best, bestLoad = i, load
+		}
+	}
+	return best
+}
+
+// hashKey returns what request r is hashed by, or "" if it has none.
+func (lb *LoadBalancer) hashKey(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	switch lb.conf.HashOn {
+	case "key":
+		return ctxGetAuthToken(r)
+	case "header":
+		return r.Header.Get(lb.conf.HashKey)
+	case "cookie":
+		if cookie, err := r.Cookie(lb.conf.HashKey); err == nil {
+			return cookie.Value
+		}
+		return ""
+	}
+	return request.RealIP(r)
+}
+
+// hashRing places the targets at points of a ring, as many as their weight
+// allows. A key is served by the first target after its hash on the ring, so
+// that adding or removing a target only moves the keys of its points.
+type hashRing struct {
+	// id identifies the targets the ring was built of.
+	id     string
+	points []uint32
+	hosts  map[uint32]int
+}
+
+func newHashRing(id string, hosts []string, weights []apidef.HostWeight, candidates []int) *hashRing {
+	ring := &hashRing{id: id, hosts: make(map[uint32]int)}
+	for _, i := range candidates {
+		for n := 0; n < hashRingReplicas*weights[i].Weight; n++ {
+			point := murmur3.Sum32([]byte(hosts[i] + "#" + strconv.Itoa(n)))
+			if _, ok := ring.hosts[point]; ok {
+				continue
+			}
+			ring.hosts[point] = i
+			ring.points = append(ring.points, point)
+		}
+	}
+	sort.Slice(ring.points, func(i, j int) bool { return ring.points[i] < ring.points[j] })
+	return ring
+}
+
+func (ring *hashRing) get(key string) int {
+	hash := murmur3.Sum32([]byte(key))
+	n := sort.Search(len(ring.points), func(i int) bool { return ring.points[i] >= hash })
+	if n == len(ring.points) {
+		n = 0
+	}
+	return ring.hosts[ring.points[n]]
+}
+
+// consistentHash picks the target of key on the ring of the candidates,
+// built again only when they change.
+func (lb *LoadBalancer) consistentHash(key string, hosts []string, weights []apidef.HostWeight, candidates []int) int {
+	var id strings.Builder
+	for _, i := range candidates {
+		id.WriteString(hosts[i])
+		id.WriteByte('*')
+		id.WriteString(strconv.Itoa(weights[i].Weight))
+		id.WriteByte(' ')
+	}
+
+	lb.mu.Lock()
+	ring := lb.ring
+	if ring == nil || ring.id != id.String() {
+		ring = newHashRing(id.String(), hosts, weights, candidates)
+		lb.ring = ring
+	}
+	lb.mu.Unlock()
+
+	return ring.get(key)
+}
+
+// Acquire counts a request in flight to host, the host and port of a target,
+// until Release is called. Only the least connections strategy needs it.
+func (lb *LoadBalancer) Acquire(host string) bool {
+	if lb == nil || lb.conf.Strategy != apidef.LoadBalancingLeastConnections {
+		return false
+	}
+	lb.mu.Lock()
+	lb.active[host]++
+	lb.mu.Unlock()
+	return true
+}
+
+func (lb *LoadBalancer) Release(host string) {
+	lb.mu.Lock()
+	if lb.active[host]--; lb.active[host] <= 0 {
+		delete(lb.active, host)
+	}
+	lb.mu.Unlock()
+}
+
+// targetHost returns the host and port of a target, as requests to it have
+// in their URL.
+func targetHost(target string) string {
+	if i := strings.Index(target, "://"); i >= 0 {
+		target = target[i+3:]
+	}
+	if i := strings.IndexAny(target, "/?#"); i >= 0 {
+		target = target[:i]
+	}
+	return target
+}
@@ -0,0 +1,152 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestLoadBalancerWeighted(t *testing.T) {
+	lb := NewLoadBalancer(apidef.LoadBalancingMeta{Strategy: apidef.LoadBalancingWeighted})
+	targets := apidef.NewHostListFromTargets([]apidef.LoadBalancingTarget{
+		{URL: "http://a", Weight: 3},
+		{URL: "http://b"},
+		{URL: "http://c", Priority: 1},
+	})
+
+	var got []string
+	for i := 0; i < 8; i++ {
+		host, err := lb.Next(nil, targets, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, host)
+	}
+	// Smooth weighted round robin interleaves the hosts, and the failover
+	// tier is not used while the others are up
+	want := []string{"http://a", "http://a", "http://b", "http://a", "http://a", "http://a", "http://b", "http://a"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Expected %v, got %v", want, got)
+		}
+	}
+}
+
+func TestLoadBalancerLeastConnections(t *testing.T) {
+	lb := NewLoadBalancer(apidef.LoadBalancingMeta{Strategy: apidef.LoadBalancingLeastConnections})
+	targets := apidef.NewHostListFromTargets([]apidef.LoadBalancingTarget{
+		{URL: "http://a:8080/api"},
+		{URL: "http://b:8080/api", Weight: 2},
+	})
+
+	lb.Acquire("a:8080")
+	lb.Acquire("b:8080")
+	for i := 0; i < 3; i++ {
+		if host, _ := lb.Next(nil, targets, false); host != "http://b:8080/api" {
+			t.Fatalf("Expected the target with the least connections per weight, got %s", host)
+		}
+	}
+
+	lb.Acquire("b:8080")
+	lb.Acquire("b:8080")
+	if host, _ := lb.Next(nil, targets, false); host != "http://a:8080/api" {
+		t.Errorf("Expected the target with the least connections per weight, got %s", host)
+	}
+
+	lb.Release("b:8080")
+	lb.Release("b:8080")
+	lb.Release("b:8080")
+	if host, _ := lb.Next(nil, targets, false); host != "http://b:8080/api" {
+		t.Errorf("Expected released connections not to count, got %s", host)
+	}
+}
+
+func TestLoadBalancerConsistentHash(t *testing.T) {
+	lb := NewLoadBalancer(apidef.LoadBalancingMeta{
+		Strategy: apidef.LoadBalancingConsistentHash,
+		HashOn:   "header",
+		HashKey:  "X-User",
+	})
+	hosts := []string{"http://a", "http://b", "http://c", "http://d"}
+	targets := apidef.NewHostListFromList(hosts)
+
+	pick := func(targets *apidef.HostList, user string) string {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-User", user)
+		host, err := lb.Next(r, targets, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return host
+	}
+
+	before := map[string]string{}
+	spread := map[string]bool{}
+	for i := 0; i < 200; i++ {
+		user := strconv.Itoa(i)
+		before[user] = pick(targets, user)
+		spread[before[user]] = true
+		if again := pick(targets, user); again != before[user] {
+			t.Fatalf("Expected user %s to stick to %s, got %s", user, before[user], again)
+		}
+	}
+	if len(spread) != len(hosts) {
+		t.Errorf("Expected keys on all %d targets, got %v", len(hosts), spread)
+	}
+
+	// Only the keys of the removed target move
+	targets.Set([]string{"http://a", "http://b", "http://d"})
+	for user, host := range before {
+		if after := pick(targets, user); host != "http://c" && after != host {
+			t.Errorf("Expected user %s to stay on %s, moved to %s", user, host, after)
+		}
+	}
+}
+
+func TestLoadBalancerNoTargets(t *testing.T) {
+	lb := NewLoadBalancer(apidef.LoadBalancingMeta{})
+	if _, err := lb.Next(nil, apidef.NewHostList(), false); err != errNoTargets {
+		t.Errorf("Expected %v, got %v", errNoTargets, err)
+	}
+}
+
+func TestLoadBalancedVersion(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	upstream := func(body string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		}))
+	}
+	a, b := upstream("upstream a"), upstream("upstream b")
+	defer a.Close()
+	defer b.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.VersionData.NotVersioned = false
+		spec.VersionData.Versions["v2"] = apidef.VersionInfo{
+			Name: "v2",
+			LoadBalancing: apidef.LoadBalancingMeta{
+				Strategy: apidef.LoadBalancingWeighted,
+				Targets: []apidef.LoadBalancingTarget{
+					{URL: a.URL, Weight: 2},
+					{URL: b.URL},
+				},
+			},
+		}
+	})
+
+	v2 := map[string]string{"version": "v2"}
+	ts.Run(t, []test.TestCase{
+		{Path: "/", Headers: v2, Code: http.StatusOK, BodyMatch: "upstream a"},
+		{Path: "/", Headers: v2, Code: http.StatusOK, BodyMatch: "upstream b"},
+		{Path: "/", Headers: v2, Code: http.StatusOK, BodyMatch: "upstream a"},
+		{Path: "/", Headers: map[string]string{"version": "v1"}, Code: http.StatusOK, BodyNotMatch: "upstream"},
+	}...)
+}
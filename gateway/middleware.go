@@ -40,6 +40,12 @@ type TykMiddleware interface {
 	Name() string
 }
 
+// requestFinisher is implemented by middleware which has to act once the
+// rest of the chain is done with a request it let through.
+type requestFinisher interface {
+	FinishRequest(r *http.Request)
+}
+
 type TraceMiddleware struct {
 	TykMiddleware
 }
@@ -117,6 +123,9 @@ func createMiddleware(actualMW TykMiddleware) func(http.Handler) http.Handler {
 				return
 			}
 			err, errCode := mw.ProcessRequest(w, r, mwConf)
+			if finisher, ok := actualMW.(requestFinisher); ok && err == nil {
+				defer finisher.FinishRequest(r)
+			}
 			if err != nil {
 				// GoPluginMiddleware are expected to send response in case of error
 				// but we still want to record error
@@ -273,16 +282,20 @@ func (t BaseMiddleware) UpdateRequestSession(r *http.Request) bool {
 // ApplyPolicies will check if any policies are loaded. If any are, it
 // will overwrite the session state to use the policy values.
 func (t BaseMiddleware) ApplyPolicies(session *user.SessionState) error {
+	return t.applyPolicies(session, nil)
+}
+
+// applyPolicies applies the policies of the session, recording where its
+// limits came from in the explanation, if any.
+func (t BaseMiddleware) applyPolicies(session *user.SessionState, explanation *policyExplanation) error {
 	rights := session.AccessRights
 	if rights == nil {
 		rights = make(map[string]user.AccessDefinition)
 	}
 
-	tags := make(map[string]bool)
-	didQuota, didRateLimit, didACL := false, false, false
-	didPerAPI := make(map[string]bool)
-	policies := session.PolicyIDs()
-	for i, polID := range policies {
+	policyIDs := session.PolicyIDs()
+	policies := make([]user.Policy, 0, len(policyIDs))
+	for _, polID := range policyIDs {
 		policiesMu.RLock()
 		policy, ok := policiesByID[polID]
 		policiesMu.RUnlock()
@@ -291,6 +304,23 @@ func (t BaseMiddleware) ApplyPolicies(session *user.SessionState) error {
 			t.Logger().Error(err)
 			return err
 		}
+		policies = append(policies, policy)
+	}
+
+	// Policies setting the same limits are only merged with a strategy
+	strategy := config.Global().Policies.MergeStrategy
+	merging := len(policies) > 1 && isPolicyMergeStrategy(strategy)
+	if merging {
+		orderPolicies(policies, strategy)
+	}
+
+	now := time.Now()
+	tags := make(map[string]bool)
+	var geoIPAccess user.GeoIPAccess
+	didQuota, didRateLimit, didACL := false, false, false
+	didPerAPI := make(map[string]bool)
+	didQuotaRules := false
+	for i, policy := range policies {
 		// Check ownership, policy org owner must be the same as API,
 		// otherwise youcould overwrite a session key with a policy from a different org!
 		if t.Spec != nil && policy.OrgID != t.Spec.OrgID {
@@ -299,14 +329,20 @@ func (t BaseMiddleware) ApplyPolicies(session *user.SessionState) error {
 			return err
 		}
 
-		if policy.Partitions.PerAPI &&
-			(policy.Partitions.Quota || policy.Partitions.RateLimit || policy.Partitions.Acl) {
+		partitions := policy.Partitions
+		if partitions.PerAPI &&
+			(partitions.Quota || partitions.RateLimit || partitions.Acl) {
 			err := fmt.Errorf("cannot apply policy %s which has per_api and any of partitions set", policy.ID)
 			log.Error(err)
 			return err
 		}
 
-		if policy.Partitions.PerAPI {
+		// When merging, a non-partitioned policy is merged as a whole
+		if merging && partitions == (user.PolicyPartitions{}) {
+			partitions = user.PolicyPartitions{Quota: true, RateLimit: true, Acl: true}
+		}
+
+		if partitions.PerAPI {
 			// new logic when you can specify quota or rate in more than one policy but for different APIs
 			if didQuota || didRateLimit || didACL { // no other partitions allowed
 				err := fmt.Errorf("cannot apply multiple policies when some have per_api set and some are partitioned")
@@ -320,7 +356,7 @@ func (t BaseMiddleware) ApplyPolicies(session *user.SessionState) error {
 			}
 			for apiID, accessRights := range policy.AccessRights {
 				// check if limit was already set for this API by other policy assigned to key
-				if didPerAPI[apiID] {
+				if didPerAPI[apiID] && !merging {
 					err := fmt.Errorf("cannot apply multiple policies for API: %s", apiID)
 					log.Error(err)
 					return err
@@ -334,8 +370,12 @@ func (t BaseMiddleware) ApplyPolicies(session *user.SessionState) error {
 						QuotaRenewalRate:   policy.QuotaRenewalRate,
 						Rate:               policy.Rate,
 						Per:                policy.Per,
+						Burst:              policy.Burst,
 						ThrottleInterval:   policy.ThrottleInterval,
 						ThrottleRetryLimit: policy.ThrottleRetryLimit,
+						ThrottleQueueSize:  policy.ThrottleQueueSize,
+						ThrottleMaxWait:    policy.ThrottleMaxWait,
+						MaxConcurrent:      policy.MaxConcurrent,
 
 						SetByPolicy: true,
 					}
@@ -351,13 +391,38 @@ func (t BaseMiddleware) ApplyPolicies(session *user.SessionState) error {
 				accessRights.Limit.QuotaRemaining = limitQuotaRemaining
 				accessRights.Limit.QuotaRenews = limitQuotaRenews
 
-				// overwrite session access right for this API
-				rights[apiID] = accessRights
+				quotaWon := false
+				if didPerAPI[apiID] {
+					rights[apiID], quotaWon = mergeAPIAccess(strategy, rights[apiID], accessRights, policy.ID, explanation)
+				} else {
+					// overwrite session access right for this API
+					rights[apiID] = accessRights
+					explanation.set("api."+apiID+".acl", policy.ID)
+					explanation.set("api."+apiID+".quota", policy.ID)
+					explanation.set("api."+apiID+".rate_limit", policy.ID)
+
+					// identify that limit for that API is set (to allow set it only once)
+					didPerAPI[apiID] = true
+				}
 
-				// identify that limit for that API is set (to allow set it only once)
-				didPerAPI[apiID] = true
+				// Quota rules apply to quotas of all APIs of the key. When
+				// merging, they come from the first policy setting them, unless
+				// a later policy wins the quota of an API
+				if policy.QuotaRules != (user.QuotaRules{}) {
+					switch {
+					case !merging || !didQuotaRules:
+						session.QuotaRules = policy.QuotaRules
+						explanation.set("quota_rules", policy.ID)
+					case policy.QuotaRules != session.QuotaRules:
+						explanation.conflict("quota_rules", policy.ID, quotaWon)
+						if quotaWon {
+							session.QuotaRules = policy.QuotaRules
+						}
+					}
+					didQuotaRules = true
+				}
 			}
-		} else if policy.Partitions.Quota || policy.Partitions.RateLimit || policy.Partitions.Acl {
+		} else if partitions.Quota || partitions.RateLimit || partitions.Acl {
 			// This is a partitioned policy, only apply what is active
 			// legacy logic when you can specify quota or rate only in no more than one policy
 			if len(didPerAPI) > 0 { // no policies with per_api set allowed
@@ -365,37 +430,66 @@ func (t BaseMiddleware) ApplyPolicies(session *user.SessionState) error {
 				log.Error(err)
 				return err
 			}
-			if policy.Partitions.Quota {
+			if partitions.Quota {
+				apply := true
 				if didQuota {
-					err := fmt.Errorf("cannot apply multiple quota policies")
-					t.Logger().Error(err)
-					return err
+					if !merging {
+						err := fmt.Errorf("cannot apply multiple quota policies")
+						t.Logger().Error(err)
+						return err
+					}
+					apply = mergeWins(strategy,
+						quotaAllowance(session.QuotaMax, session.QuotaRenewalRate),
+						quotaAllowance(policy.QuotaMax, policy.QuotaRenewalRate))
+					explanation.conflict("quota", policy.ID, apply)
+				} else {
+					explanation.set("quota", policy.ID)
 				}
 				didQuota = true
-				// Quotas
-				session.QuotaMax = policy.QuotaMax
-				session.QuotaRenewalRate = policy.QuotaRenewalRate
+				if apply {
+					// Quotas, with the rules of the policy they come from
+					session.QuotaMax = policy.QuotaMax
+					session.QuotaRenewalRate = policy.QuotaRenewalRate
+					session.QuotaRules = policy.QuotaRules
+					explanation.set("quota_rules", policy.ID)
+				}
 			}
 
-			if policy.Partitions.RateLimit {
+			if partitions.RateLimit {
+				apply := true
 				if didRateLimit {
-					err := fmt.Errorf("cannot apply multiple rate limit policies")
-					t.Logger().Error(err)
-					return err
+					if !merging {
+						err := fmt.Errorf("cannot apply multiple rate limit policies")
+						t.Logger().Error(err)
+						return err
+					}
+					apply = mergeWins(strategy,
+						rateAllowance(session.Rate, session.Per),
+						rateAllowance(policy.Rate, policy.Per))
+					explanation.conflict("rate_limit", policy.ID, apply)
+				} else {
+					explanation.set("rate_limit", policy.ID)
 				}
 				didRateLimit = true
-				// Rate limiting
-				session.Allowance = policy.Rate // This is a legacy thing, merely to make sure output is consistent. Needs to be purged
-				session.Rate = policy.Rate
-				session.Per = policy.Per
-				session.ThrottleInterval = policy.ThrottleInterval
-				session.ThrottleRetryLimit = policy.ThrottleRetryLimit
-				if policy.LastUpdated != "" {
-					session.LastUpdated = policy.LastUpdated
+				if apply {
+					// Rate limiting
+					session.Allowance = policy.Rate // This is a legacy thing, merely to make sure output is consistent. Needs to be purged
+					session.Rate = policy.Rate
+					session.Per = policy.Per
+					session.Burst = policy.Burst
+					session.ThrottleInterval = policy.ThrottleInterval
+					session.ThrottleRetryLimit = policy.ThrottleRetryLimit
+					session.ThrottleQueueSize = policy.ThrottleQueueSize
+					session.ThrottleMaxWait = policy.ThrottleMaxWait
+					session.MaxConcurrent = policy.MaxConcurrent
+					session.GraphQLLimits = policy.GraphQLLimits
+					if policy.LastUpdated != "" {
+						session.LastUpdated = policy.LastUpdated
+					}
 				}
 			}
 
-			if policy.Partitions.Acl {
+			if partitions.Acl {
 				// ACL
 				if !didACL { // first, overwrite rights
 					rights = make(map[string]user.AccessDefinition)
@@ -403,7 +497,14 @@ func (t BaseMiddleware) ApplyPolicies(session *user.SessionState) error {
 				}
 				// Second or later, merge
 				for k, v := range policy.AccessRights {
+					// When merging, the first policy granting an API keeps its
+					// access whatever the strategy: only quotas and rate limits
+					// are resolved by restrictiveness
+					if _, granted := rights[k]; granted && merging {
+						continue
+					}
 					rights[k] = v
+					explanation.set("api."+k+".acl", policy.ID)
 				}
 				session.HMACEnabled = policy.HMACEnabled
 			}
@@ -417,13 +518,19 @@ func (t BaseMiddleware) ApplyPolicies(session *user.SessionState) error {
 			// Quotas
 			session.QuotaMax = policy.QuotaMax
 			session.QuotaRenewalRate = policy.QuotaRenewalRate
+			session.QuotaRules = policy.QuotaRules
 
 			// Rate limiting
 			session.Allowance = policy.Rate // This is a legacy thing, merely to make sure output is consistent. Needs to be purged
 			session.Rate = policy.Rate
 			session.Per = policy.Per
+			session.Burst = policy.Burst
 			session.ThrottleInterval = policy.ThrottleInterval
 			session.ThrottleRetryLimit = policy.ThrottleRetryLimit
+			session.ThrottleQueueSize = policy.ThrottleQueueSize
+			session.ThrottleMaxWait = policy.ThrottleMaxWait
+			session.MaxConcurrent = policy.MaxConcurrent
+			session.GraphQLLimits = policy.GraphQLLimits
 			if policy.LastUpdated != "" {
 				session.LastUpdated = policy.LastUpdated
 			}
@@ -431,17 +538,39 @@ func (t BaseMiddleware) ApplyPolicies(session *user.SessionState) error {
 			// ACL
 			rights = policy.AccessRights
 			session.HMACEnabled = policy.HMACEnabled
+
+			explanation.set("quota", policy.ID)
+			explanation.set("quota_rules", policy.ID)
+			explanation.set("rate_limit", policy.ID)
+			for apiID := range rights {
+				explanation.set("api."+apiID+".acl", policy.ID)
+			}
 		}
 
 		// Required for all
+		// Keys are inactive out of the schedule of any of their policies
+		scheduled, err := policy.Schedule.Active(now)
+		if err != nil {
+			err = fmt.Errorf("invalid schedule of policy %s: %v", policy.ID, err)
+			t.Logger().Error(err)
+			return err
+		}
+		inactive := policy.IsInactive || !scheduled
 		if i == 0 { // if any is true, key is inactive
-			session.IsInactive = policy.IsInactive
-		} else if policy.IsInactive {
+			session.IsInactive = inactive
+		} else if inactive {
 			session.IsInactive = true
 		}
 		for _, tag := range policy.Tags {
 			tags[tag] = true
 		}
+		geoIPAccess.Allowed = append(geoIPAccess.Allowed, policy.GeoIPAccess.Allowed...)
+		geoIPAccess.Blocked = append(geoIPAccess.Blocked, policy.GeoIPAccess.Blocked...)
+	}
+
+	// Locations allowed or blocked by any policy replace those of the key
+	if len(geoIPAccess.Allowed) > 0 || len(geoIPAccess.Blocked) > 0 {
+		session.GeoIPAccess = geoIPAccess
 	}
 
 	// set tags
@@ -482,6 +611,10 @@ func (t BaseMiddleware) CheckSessionAndIdentityForValidKey(key string, r *http.R
 		if found {
 			t.Logger().Debug("--> Key found in local cache")
 			session := cachedVal.(user.SessionState)
+			if !verifyKey(key, &session) {
+				t.Logger().Warning("Key does not match its slow hash")
+				return user.SessionState{IsInactive: true}, false
+			}
 			if err := t.ApplyPolicies(&session); err != nil {
 				t.Logger().Error(err)
 				return session, false
@@ -494,6 +627,14 @@ func (t BaseMiddleware) CheckSessionAndIdentityForValidKey(key string, r *http.R
 	t.Logger().Debug("Querying keystore")
 	session, found := t.Spec.SessionManager.SessionDetail(key, false)
 	if found {
+		if !verifyKey(key, &session) {
+			t.Logger().Warning("Key does not match its slow hash")
+			return user.SessionState{IsInactive: true}, false
+		}
+		if session.KeyVerifier == "" {
+			t.rehashKey(key, &session)
+		}
+
 		session.SetKeyHash(cacheKey)
 		// If exists, assume it has been authorized and pass on
 		// cache it
@@ -536,6 +677,20 @@ func (t BaseMiddleware) CheckSessionAndIdentityForValidKey(key string, r *http.R
 	return session, found
 }
 
+// rehashKey adds the slow hash to the session of a key stored before slow
+// hashes were enabled.
+func (t BaseMiddleware) rehashKey(key string, session *user.SessionState) {
+	setKeyVerifier(key, session)
+	if session.KeyVerifier == "" {
+		return
+	}
+
+	t.Logger().WithField("key", obfuscateKey(key)).Info("Storing slow hash of key.")
+	if err := t.Spec.SessionManager.UpdateSession(key, session, session.Lifetime(t.Spec.SessionLifetime), false); err != nil {
+		t.Logger().WithError(err).Error("Could not store slow hash of key")
+	}
+}
+
 // FireEvent is added to the BaseMiddleware object so it is available across the entire stack
 func (t BaseMiddleware) FireEvent(name apidef.TykEvent, meta interface{}) {
 	fireEvent(name, meta, t.Spec.EventPaths)
@@ -557,6 +712,10 @@ func responseProcessorByName(name string) TykResponseHandler {
 		return &ResponseTransformJQMiddleware{}
 	case "header_transform":
 		return &HeaderTransform{}
+	case "response_xml_to_json":
+		return &ResponseXMLConversionMiddleware{}
+	case "etag":
+		return &ResponseETagMiddleware{}
 	}
 	return nil
 }
@@ -0,0 +1,151 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/ctx"
+)
+
+// mirrorMaxInFlight bounds the requests in flight to a mirror, for a slow
+// one not to pile them up. Requests over it are not mirrored.
+const mirrorMaxInFlight = 100
+
+// Mirror copies a share of the requests to an API to a shadow upstream.
+type Mirror struct {
+	conf     apidef.MirrorMeta
+	target   *url.URL
+	client   *http.Client
+	inFlight chan struct{}
+}
+
+func NewMirror(spec *APISpec) (*Mirror, error) {
+	conf := spec.Proxy.Mirror
+	target, err := url.Parse(conf.TargetURL)
+	if err != nil {
+		return nil, err
+	}
+	if conf.Percentage <= 0 {
+		conf.Percentage = 100
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = 10
+	}
+	if conf.Tag == "" {
+		conf.Tag = "mirror"
+	}
+
+	return &Mirror{
+		conf:   conf,
+		target: target,
+		client: &http.Client{
+			Timeout: time.Duration(conf.Timeout) * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: spec.Proxy.Transport.SSLInsecureSkipVerify,
+				},
+			},
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		inFlight: make(chan struct{}, mirrorMaxInFlight),
+	}, nil
+}
+
+// Shadow sends a copy of r to the mirror in the background if r is sampled,
+// recording the mirrored request with record once answered. The body of r is
+// buffered, to be read again by the proxy. Its copy is held in the buffer of
+// the node until the mirror answers, and r isn't mirrored if it is full.
+func (m *Mirror) Shadow(r *http.Request, record func(r *http.Request, timing int64, code int, resp *http.Response)) {
+	if m == nil || rand.Float64()*100 >= m.conf.Percentage {
+		return
+	}
+	select {
+	case m.inFlight <- struct{}{}:
+	default:
+		log.WithField("prefix", "mirror").Debug("Too many requests in flight to the mirror, not mirroring")
+		return
+	}
+
+	var body []byte
+	if r.Body != nil {
+		copyRequest(r)
+		size := bufferedBodySize(r.Body)
+		if !reserveBodyBuffer(size) {
+			<-m.inFlight
+			log.WithField("prefix", "mirror").Debug("Request body buffer of the node is full, not mirroring")
+			return
+		}
+		body = make([]byte, size)
+		io.ReadFull(r.Body, body)
+		copyRequest(r)
+	}
+	done := func() {
+		releaseBodyBuffer(int64(len(body)))
+		<-m.inFlight
+	}
+
+	target := *m.target
+	target.Path = singleJoiningSlash(m.target.Path, r.URL.Path, false)
+	target.RawQuery = r.URL.RawQuery
+	outreq, err := http.NewRequest(r.Method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		done()
+		log.WithField("prefix", "mirror").WithError(err).Error("Could not mirror request")
+		return
+	}
+	outreq.Header = cloneHeader(r.Header)
+	for _, h := range hopHeaders {
+		outreq.Header.Del(h)
+	}
+
+	// Recorded with the values of r, once r is done with
+	recorded := r.WithContext(context.WithValue(r.Context(), ctx.Mirrored, true))
+	recorded.URL = outreq.URL
+	recorded.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	go func() {
+		defer done()
+
+		start := time.Now()
+		resp, err := m.client.Do(outreq)
+		timing := int64(time.Since(start) / time.Millisecond)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"prefix": "mirror",
+				"target": m.target.Host,
+			}).WithError(err).Debug("Mirrored request failed")
+			record(recorded, timing, http.StatusBadGateway, nil)
+			return
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		record(recorded, timing, resp.StatusCode, nil)
+	}()
+}
+
+// bufferedBodySize returns the size of a body buffered by copyBody.
+func bufferedBodySize(body io.ReadCloser) int64 {
+	switch b := body.(type) {
+	case nopCloser:
+		size, _ := b.Seek(0, io.SeekEnd)
+		b.Seek(0, io.SeekStart)
+		return size
+	case *lazyBody:
+		if b.buffered != nil {
+			return b.buffered.Size()
+		}
+	}
+	return 0
+}
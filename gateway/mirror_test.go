@@ -0,0 +1,116 @@
+package gateway
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	msgpack "gopkg.in/vmihailenco/msgpack.v2"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestMirror(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	mirrored := make(chan string, 10)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mirrored <- r.Method + " " + r.URL.RequestURI() + " " + string(body)
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("shadow"))
+	}))
+	defer shadow.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.Mirror = apidef.MirrorMeta{
+			Enabled:   true,
+			TargetURL: shadow.URL + "/v2",
+			Tag:       "shadow-v2",
+		}
+	})
+
+	time.Sleep(recordsBufferFlushInterval + 50)
+	analytics.Store.GetAndDeleteSet(analyticsKeyName)
+
+	ts.Run(t, test.TestCase{
+		Method:       http.MethodPost,
+		Path:         "/orders?id=1",
+		Data:         "order",
+		Code:         http.StatusOK,
+		BodyMatch:    `"Body":"order"`,
+		BodyNotMatch: "shadow",
+	})
+
+	select {
+	case got := <-mirrored:
+		if want := "POST /v2/orders?id=1 order"; got != want {
+			t.Errorf("Expected the mirror to get %q, got %q", want, got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the request to be mirrored")
+	}
+
+	// Both the request and its copy are recorded, the copy with its tag
+	var records []AnalyticsRecord
+	for i := 0; i < 10 && len(records) < 2; i++ {
+		time.Sleep(recordsBufferFlushInterval + 50)
+		for _, v := range analytics.Store.GetAndDeleteSet(analyticsKeyName) {
+			var record AnalyticsRecord
+			msgpack.Unmarshal(v.([]byte), &record)
+			records = append(records, record)
+		}
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 analytics records, got %d", len(records))
+	}
+	for _, record := range records {
+		mirror := record.ResponseCode == http.StatusTeapot
+		tagged := false
+		for _, tag := range record.Tags {
+			tagged = tagged || tag == "shadow-v2"
+		}
+		if mirror != tagged {
+			record, _ := json.Marshal(record)
+			t.Errorf("Expected only the mirrored request to be tagged, got %s", record)
+		}
+	}
+
+	// Copies of bodies count towards the buffer of the node
+	globalConf := config.Global()
+	globalConf.MaxBufferedRequestBytes = 10
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts.Run(t, []test.TestCase{
+		{Method: http.MethodPost, Path: "/orders", Data: "large", Code: http.StatusOK},
+		{Method: http.MethodPost, Path: "/orders", Data: "larger", Code: http.StatusOK, BodyMatch: `"Body":"larger"`},
+	}...)
+
+	select {
+	case got := <-mirrored:
+		if want := "POST /v2/orders large"; got != want {
+			t.Errorf("Expected the mirror to get %q, got %q", want, got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the request to be mirrored")
+	}
+	select {
+	case got := <-mirrored:
+		t.Errorf("Expected the request not to be mirrored with the buffer full, got %q", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt64(&bufferedBodyBytes); n != 0 {
+		t.Errorf("Expected mirrored bodies to be released, %d bytes are still counted", n)
+	}
+}
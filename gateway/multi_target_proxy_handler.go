@@ -6,6 +6,8 @@ import (
 	"net/url"
 
 	"github.com/Sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/apidef"
 )
 
 type MultiTargetProxy struct {
@@ -46,6 +48,13 @@ func NewMultiTargetProxy(spec *APISpec) *MultiTargetProxy {
 	m.defaultProxy = TykNewSingleHostReverseProxy(spec.target, spec)
 
 	for vname, vdata := range spec.VersionData.Versions {
+		if len(vdata.LoadBalancing.Targets) > 0 {
+			log.WithFields(logrus.Fields{
+				"prefix": "multi-target",
+			}).Info("----> Version ", vname, " has its own load balanced targets")
+			m.versionProxies[vname] = newLoadBalancedVersionProxy(spec, vdata.LoadBalancing)
+			continue
+		}
 		if vdata.OverrideTarget == "" {
 			log.WithFields(logrus.Fields{
 				"prefix": "multi-target",
@@ -72,3 +81,13 @@ func NewMultiTargetProxy(spec *APISpec) *MultiTargetProxy {
 	}
 	return m
 }
+
+// newLoadBalancedVersionProxy returns the proxy of a version balancing
+// requests over targets of its own.
+func newLoadBalancedVersionProxy(spec *APISpec, conf apidef.LoadBalancingMeta) *ReverseProxy {
+	proxy := TykNewSingleHostReverseProxy(spec.target, spec)
+	proxy.balancer = NewLoadBalancer(conf)
+	proxy.balancer.health = spec.UpstreamHealth
+	proxy.targets = apidef.NewHostListFromTargets(conf.Targets)
+	return proxy
+}
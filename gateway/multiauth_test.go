@@ -75,7 +75,7 @@ func getMultiAuthStandardAndBasicAuthChain(spec *APISpec) http.Handler {
 	proxyHandler := ProxyHandler(proxy, spec)
 	baseMid := BaseMiddleware{Spec: spec, Proxy: proxy}
 	chain := alice.New(mwList(
-		&IPWhiteListMiddleware{baseMid},
+		&IPWhiteListMiddleware{BaseMiddleware: baseMid},
 		&IPBlackListMiddleware{BaseMiddleware: baseMid},
 		&BasicAuthKeyIsValid{baseMid, nil, nil},
 		&AuthKey{baseMid},
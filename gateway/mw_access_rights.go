@@ -3,6 +3,8 @@ package gateway
 import (
 	"errors"
 	"net/http"
+
+	"github.com/TykTechnologies/tyk/request"
 )
 
 // AccessRightsCheck is a middleware that will check if the key bing used to access the API has
@@ -20,12 +22,23 @@ func (a *AccessRightsCheck) Name() string {
 func (a *AccessRightsCheck) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
 	accessingVersion := a.Spec.getVersionFromRequest(r)
 	if accessingVersion == "" {
-		if a.Spec.VersionData.DefaultVersion != "" {
-			accessingVersion = a.Spec.VersionData.DefaultVersion
-		}
+		accessingVersion = a.Spec.defaultVersion()
 	}
 	session := ctxGetSession(r)
 
+	// Keys restricted to some IPs can't be used from others, whatever the API
+	if len(session.AllowedIPs) > 0 && !request.MatchIP(request.RealIP(r), session.AllowedIPs) {
+		a.Logger().Info("Attempted access from an IP not allowed for the key")
+		return errors.New("access from this IP has been disallowed"), http.StatusForbidden
+	}
+
+	if access := session.GeoIPAccess; len(access.Allowed) > 0 || len(access.Blocked) > 0 {
+		if !geoIPAllowed(geoIPLocations(request.RealIP(r)), access.Allowed, access.Blocked) {
+			a.Logger().Info("Attempted access from a location not allowed for the key")
+			return errors.New("access from this location has been disallowed"), http.StatusForbidden
+		}
+	}
+
 	// If there's nothing in our profile, we let them through to the next phase
 	if len(session.AccessRights) > 0 {
 		// Otherwise, run auth checks
@@ -78,6 +78,23 @@ func (k *RateLimitForAPI) ProcessRequest(w http.ResponseWriter, r *http.Request,
 		false,
 	)
 
+	if reason == sessionFailRateLimit && k.Spec.GlobalRateLimit.QueueSize > 0 {
+		limit := k.Spec.GlobalRateLimit
+		maxWait := time.Duration(limit.MaxWait * float64(time.Second))
+		requestQueue.wait(r, k.keyName, limit.QueueSize, maxWait, queueInterval(limit.Rate, limit.Per), func() bool {
+			reason = sessionLimiter.ForwardMessage(r, k.apiSess,
+				k.keyName,
+				storeRef,
+				true,
+				false,
+				&k.Spec.GlobalConfig,
+				k.Spec.APIID,
+				false,
+			)
+			return reason != sessionFailRateLimit
+		})
+	}
+
 	if reason == sessionFailRateLimit {
 		return k.handleRateLimitFailure(r, k.keyName)
 	}
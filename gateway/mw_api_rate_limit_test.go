@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/TykTechnologies/tyk/config"
 	"github.com/TykTechnologies/tyk/test"
 	uuid "github.com/satori/go.uuid"
@@ -37,7 +38,7 @@ func getRLOpenChain(spec *APISpec) http.Handler {
 	proxyHandler := ProxyHandler(proxy, spec)
 	baseMid := BaseMiddleware{Spec: spec, Proxy: proxy}
 	chain := alice.New(mwList(
-		&IPWhiteListMiddleware{baseMid},
+		&IPWhiteListMiddleware{BaseMiddleware: baseMid},
 		&IPBlackListMiddleware{BaseMiddleware: baseMid},
 		&VersionCheck{BaseMiddleware: baseMid},
 		&RateLimitForAPI{BaseMiddleware: baseMid},
@@ -51,7 +52,7 @@ func getGlobalRLAuthKeyChain(spec *APISpec) http.Handler {
 	proxyHandler := ProxyHandler(proxy, spec)
 	baseMid := BaseMiddleware{Spec: spec, Proxy: proxy}
 	chain := alice.New(mwList(
-		&IPWhiteListMiddleware{baseMid},
+		&IPWhiteListMiddleware{BaseMiddleware: baseMid},
 		&IPBlackListMiddleware{BaseMiddleware: baseMid},
 		&AuthKey{baseMid},
 		&VersionCheck{BaseMiddleware: baseMid},
@@ -331,3 +332,78 @@ const closedRLDefSmall = `{
 		"per": 1
 	}
 }`
+
+func TestThrottleQueue(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	DRLManager.CurrentTokenValue = 1
+	DRLManager.RequestTokenValue = 1
+	defer func() {
+		DRLManager.CurrentTokenValue = 0
+		DRLManager.RequestTokenValue = 0
+	}()
+
+	t.Run("API", func(t *testing.T) {
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.APIID = "throttle-queue-api"
+			spec.Proxy.ListenPath = "/"
+			spec.GlobalRateLimit = apidef.GlobalRateLimit{Rate: 1, Per: 1, QueueSize: 1, MaxWait: 2}
+		})
+
+		// One request passes, the next waits in the queue and the last
+		// finds the queue full
+		codes := make(chan int, 3)
+		for i := 0; i < 3; i++ {
+			go func() {
+				resp, err := http.Get(ts.URL + "/")
+				if err != nil {
+					t.Error(err)
+					codes <- 0
+					return
+				}
+				resp.Body.Close()
+				codes <- resp.StatusCode
+			}()
+			time.Sleep(20 * time.Millisecond)
+		}
+
+		counts := map[int]int{}
+		for i := 0; i < 3; i++ {
+			counts[<-codes]++
+		}
+		if counts[http.StatusOK] != 2 || counts[http.StatusTooManyRequests] != 1 {
+			t.Error("Requests over the queue size should be rejected", counts)
+		}
+	})
+
+	t.Run("Key", func(t *testing.T) {
+		spec := BuildAndLoadAPI(func(spec *APISpec) {
+			spec.APIID = "throttle-queue-key"
+			spec.UseKeylessAccess = false
+			spec.Proxy.ListenPath = "/"
+		})[0]
+
+		policyID := CreatePolicy(func(p *user.Policy) {
+			p.Rate = 1
+			p.Per = 1
+			p.ThrottleQueueSize = 1
+			p.ThrottleMaxWait = 2
+			p.AccessRights = map[string]user.AccessDefinition{
+				spec.APIID: {APIID: spec.APIID},
+			}
+		})
+		key := CreateSession(func(s *user.SessionState) {
+			s.ApplyPolicies = []string{policyID}
+		})
+		authHeaders := map[string]string{"Authorization": key}
+
+		ts.Run(t, test.TestCase{Path: "/", Headers: authHeaders, Code: http.StatusOK})
+
+		start := time.Now()
+		ts.Run(t, test.TestCase{Path: "/", Headers: authHeaders, Code: http.StatusOK})
+		if waited := time.Since(start); waited < 500*time.Millisecond {
+			t.Error("Request over the rate should be delayed, waited", waited)
+		}
+	})
+}
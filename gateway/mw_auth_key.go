@@ -103,6 +103,10 @@ func (k *AuthKey) ProcessRequest(w http.ResponseWriter, r *http.Request, _ inter
 		return errors.New("Access to this API has been disallowed"), http.StatusForbidden
 	}
 
+	if err := checkSessionBinding(r, &session); err != nil {
+		return tokenBindingFailure(k, r, key, err)
+	}
+
 	// Set session state on context, we will need it later
 	switch k.Spec.BaseIdentityProvidedBy {
 	case apidef.AuthToken, apidef.UnsetAuth:
@@ -162,6 +166,10 @@ func stripBearer(token string) string {
 	if len(token) > 6 && strings.ToUpper(token[0:7]) == "BEARER " {
 		return token[7:]
 	}
+	// Tokens bound to DPoP proofs are sent with their own scheme
+	if len(token) > 4 && strings.ToUpper(token[0:5]) == "DPOP " {
+		return token[5:]
+	}
 	return token
 }
 
@@ -21,7 +21,8 @@ func (m *CertificateCheckMW) ProcessRequest(w http.ResponseWriter, r *http.Reque
 	if m.Spec.UseMutualTLSAuth {
 		certIDs := append(m.Spec.ClientCertificates, m.Spec.GlobalConfig.Security.Certificates.API...)
 
-		if err := CertificateManager.ValidateRequestCertificate(certIDs, r); err != nil {
+		opts := certificateValidationOptions(m.Spec.ClientCertificateValidation)
+		if err := CertificateManager.ValidateRequestCertificateWithOptions(certIDs, r, opts); err != nil {
 			return err, http.StatusForbidden
 		}
 	}
@@ -0,0 +1,50 @@
+package gateway
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/certs"
+)
+
+// CertificateSessionMW authenticates clients of mutual TLS APIs by their
+// client certificate, already validated by CertificateCheckMW. The session
+// is the key created for the certificate, so clients get rate limits,
+// quotas and policies of the key instead of plain allow or deny.
+type CertificateSessionMW struct {
+	BaseMiddleware
+}
+
+func (m *CertificateSessionMW) Name() string {
+	return "CertificateSessionMW"
+}
+
+func (m *CertificateSessionMW) EnabledForSpec() bool {
+	return m.Spec.UseMutualTLSAuth && m.Spec.ClientCertificateValidation.SessionMapping
+}
+
+func (m *CertificateSessionMW) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return errors.New("Client certificate required"), http.StatusUnauthorized
+	}
+
+	key := generateToken(m.Spec.OrgID, certs.HexSHA256(r.TLS.PeerCertificates[0].Raw))
+
+	session, keyExists := m.CheckSessionAndIdentityForValidKey(key, r)
+	if !keyExists {
+		m.Logger().WithField("key", obfuscateKey(key)).Info("Attempted access with certificate without key.")
+
+		AuthFailed(m, r, key)
+		reportHealthValue(m.Spec, KeyFailure, "1")
+
+		return errors.New("Access to this API has been disallowed"), http.StatusForbidden
+	}
+
+	switch m.Spec.BaseIdentityProvidedBy {
+	case apidef.ClientCert, apidef.UnsetAuth:
+		ctxSetSession(r, &session, key, false)
+	}
+
+	return nil, http.StatusOK
+}
@@ -0,0 +1,139 @@
+package gateway
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/tyk/ctx"
+	"github.com/TykTechnologies/tyk/request"
+)
+
+// concurrencyPollInterval is how often queued requests check for a free slot.
+const concurrencyPollInterval = 10 * time.Millisecond
+
+var inFlight = inFlightCounter{count: make(map[string]int)}
+
+// inFlightCounter counts requests in flight on this gateway.
+type inFlightCounter struct {
+	mu    sync.Mutex
+	count map[string]int
+}
+
+// acquire takes a slot of key unless max requests are in flight already.
+func (c *inFlightCounter) acquire(key string, max int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.count[key] >= max {
+		return false
+	}
+	c.count[key]++
+	return true
+}
+
+func (c *inFlightCounter) release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.count[key]--; c.count[key] <= 0 {
+		delete(c.count, key)
+	}
+}
+
+// ConcurrencyLimit caps the requests in flight to the API, and of each key,
+// protecting upstreams which can't take many requests at once.
+type ConcurrencyLimit struct {
+	BaseMiddleware
+}
+
+func (m *ConcurrencyLimit) Name() string {
+	return "ConcurrencyLimit"
+}
+
+func (m *ConcurrencyLimit) EnabledForSpec() bool {
+	// Keys may limit their requests to any API
+	return !m.Spec.UseKeylessAccess || m.Spec.ConcurrencyLimit.MaxRequests > 0
+}
+
+func (m *ConcurrencyLimit) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
+	if !ctxCheckLimits(r) {
+		return nil, http.StatusOK
+	}
+
+	var slots []string
+
+	if limit := m.Spec.ConcurrencyLimit; limit.MaxRequests > 0 {
+		key := "api-" + m.Spec.OrgID + m.Spec.APIID
+		if !m.acquire(r, key, limit.MaxRequests, limit.QueueSize, limit.MaxWait) {
+			return m.handleLimitFailure(r, "API Concurrency Limit Exceeded")
+		}
+		slots = append(slots, key)
+	}
+
+	if session := ctxGetSession(r); session != nil {
+		key := "key-" + session.KeyHash()
+		max, queueSize, maxWait := session.MaxConcurrent, session.ThrottleQueueSize, session.ThrottleMaxWait
+		if rights, ok := session.AccessRights[m.Spec.APIID]; ok && rights.Limit != nil {
+			key = "key-" + m.Spec.APIID + "-" + session.KeyHash()
+			max, queueSize, maxWait = rights.Limit.MaxConcurrent, rights.Limit.ThrottleQueueSize, rights.Limit.ThrottleMaxWait
+		}
+
+		if max > 0 {
+			if !m.acquire(r, key, max, queueSize, maxWait) {
+				for _, slot := range slots {
+					inFlight.release(slot)
+				}
+				return m.handleLimitFailure(r, "Key Concurrency Limit Exceeded")
+			}
+			slots = append(slots, key)
+		}
+	}
+
+	if len(slots) > 0 {
+		setCtxValue(r, ctx.ConcurrencySlots, slots)
+	}
+
+	return nil, http.StatusOK
+}
+
+// FinishRequest frees the slots taken by the request once it was served.
+func (m *ConcurrencyLimit) FinishRequest(r *http.Request) {
+	slots, _ := r.Context().Value(ctx.ConcurrencySlots).([]string)
+	for _, slot := range slots {
+		inFlight.release(slot)
+	}
+}
+
+// acquire takes a slot of key, waiting in a queue of queueSize for up to
+// maxWait seconds when all of them are taken.
+func (m *ConcurrencyLimit) acquire(r *http.Request, key string, max, queueSize int, maxWait float64) bool {
+	if inFlight.acquire(key, max) {
+		return true
+	}
+	if queueSize <= 0 {
+		return false
+	}
+
+	wait := time.Duration(maxWait * float64(time.Second))
+	return requestQueue.wait(r, "concurrency-"+key, queueSize, wait, concurrencyPollInterval, func() bool {
+		return inFlight.acquire(key, max)
+	})
+}
+
+func (m *ConcurrencyLimit) handleLimitFailure(r *http.Request, message string) (error, int) {
+	token := ctxGetAuthToken(r)
+	m.Logger().WithField("key", obfuscateKey(token)).Info(message)
+
+	m.FireEvent(EventRateLimitExceeded, EventKeyFailureMeta{
+		EventMetaDefault: EventMetaDefault{Message: message, OriginatingRequest: EncodeRequestToEvent(r)},
+		Path:             r.URL.Path,
+		Origin:           request.RealIP(r),
+		Key:              token,
+	})
+
+	reportHealthValue(m.Spec, Throttle, "-1")
+
+	return errors.New("Too many concurrent requests"), http.StatusTooManyRequests
+}
@@ -0,0 +1,129 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestConcurrencyLimit(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	// Requests to /slow are held until released
+	started, release := make(chan struct{}), make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			started <- struct{}{}
+			<-release
+		}
+	}))
+	defer upstream.Close()
+
+	slowRequest := func(headers map[string]string) chan int {
+		code := make(chan int, 1)
+		go func() {
+			req, _ := http.NewRequest("GET", ts.URL+"/slow", nil)
+			for k, v := range headers {
+				req.Header.Set(k, v)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Error(err)
+				code <- 0
+				return
+			}
+			resp.Body.Close()
+			code <- resp.StatusCode
+		}()
+		return code
+	}
+
+	t.Run("API", func(t *testing.T) {
+		loadAPI := func(queueSize int) *APISpec {
+			return BuildAndLoadAPI(func(spec *APISpec) {
+				spec.APIID = "concurrency-api"
+				spec.Proxy.ListenPath = "/"
+				spec.Proxy.TargetURL = upstream.URL
+				spec.ConcurrencyLimit = apidef.ConcurrencyLimit{MaxRequests: 1, QueueSize: queueSize}
+			})[0]
+		}
+		loadAPI(0)
+
+		first := slowRequest(nil)
+		<-started
+		ts.Run(t, test.TestCase{Path: "/", Code: http.StatusTooManyRequests})
+		release <- struct{}{}
+		if code := <-first; code != http.StatusOK {
+			t.Fatal("Request in flight should pass, got", code)
+		}
+		ts.Run(t, test.TestCase{Path: "/", Code: http.StatusOK})
+
+		t.Run("Queue", func(t *testing.T) {
+			spec := loadAPI(1)
+
+			first := slowRequest(nil)
+			<-started
+			queued := slowRequest(nil)
+			// Wait for the queued request to be held
+			for {
+				requestQueue.mu.Lock()
+				n := requestQueue.queued["concurrency-api-"+spec.OrgID+spec.APIID]
+				requestQueue.mu.Unlock()
+				if n == 1 {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+			ts.Run(t, test.TestCase{Path: "/", Code: http.StatusTooManyRequests})
+
+			release <- struct{}{}
+			<-started
+			release <- struct{}{}
+			if code1, code2 := <-first, <-queued; code1 != http.StatusOK || code2 != http.StatusOK {
+				t.Error("Queued request should pass once the first is served", code1, code2)
+			}
+		})
+	})
+
+	t.Run("Key", func(t *testing.T) {
+		spec := BuildAndLoadAPI(func(spec *APISpec) {
+			spec.APIID = "concurrency-key"
+			spec.UseKeylessAccess = false
+			spec.Proxy.ListenPath = "/"
+			spec.Proxy.TargetURL = upstream.URL
+		})[0]
+
+		policyID := CreatePolicy(func(p *user.Policy) {
+			p.MaxConcurrent = 1
+			p.AccessRights = map[string]user.AccessDefinition{
+				spec.APIID: {APIID: spec.APIID},
+			}
+		})
+		newKey := func() map[string]string {
+			key := CreateSession(func(s *user.SessionState) {
+				s.ApplyPolicies = []string{policyID}
+			})
+			return map[string]string{"Authorization": key}
+		}
+		key1, key2 := newKey(), newKey()
+
+		first := slowRequest(key1)
+		<-started
+		ts.Run(t, []test.TestCase{
+			{Path: "/", Headers: key1, Code: http.StatusTooManyRequests},
+			// Keys are counted apart
+			{Path: "/", Headers: key2, Code: http.StatusOK},
+		}...)
+		release <- struct{}{}
+		if code := <-first; code != http.StatusOK {
+			t.Fatal("Request in flight should pass, got", code)
+		}
+		ts.Run(t, test.TestCase{Path: "/", Headers: key1, Code: http.StatusOK})
+	})
+}
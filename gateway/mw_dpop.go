@@ -0,0 +1,218 @@
+package gateway
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+
+	"github.com/TykTechnologies/tyk/certs"
+	"github.com/TykTechnologies/tyk/ctx"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/storage"
+)
+
+const (
+	dpopProofType   = "dpop+jwt"
+	dpopTokenScheme = "DPoP"
+
+	// defaultDPoPProofLifetime is how long, in seconds, proofs are accepted
+	// after they were created unless the API says otherwise.
+	defaultDPoPProofLifetime = 60
+)
+
+var errDPoPProofRequired = errors.New("DPoP proof required")
+
+// dpopReplayCache remembers the proofs seen for as long as they are valid, so
+// that each of them is used only once across gateways.
+var dpopReplayCache storage.Handler = &storage.RedisCluster{KeyPrefix: "dpop-jti-"}
+
+// DPoPCheck validates DPoP proofs, with which clients demonstrate they hold
+// the private key their access tokens are bound to. Tokens stolen from the
+// client are worthless without the key.
+type DPoPCheck struct {
+	BaseMiddleware
+}
+
+func (m *DPoPCheck) Name() string {
+	return "DPoPCheck"
+}
+
+func (m *DPoPCheck) EnabledForSpec() bool {
+	return m.Spec.DPoP.Enabled
+}
+
+func (m *DPoPCheck) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
+	accessToken, scheme := dpopAccessToken(r)
+
+	proofs := r.Header[textproto.CanonicalMIMEHeaderKey(headers.DPoP)]
+	switch {
+	case len(proofs) == 0 && (m.Spec.DPoP.Required || scheme):
+		return m.proofFailure(w, r, errDPoPProofRequired)
+	case len(proofs) == 0:
+		return nil, http.StatusOK
+	case len(proofs) > 1:
+		return m.proofFailure(w, r, errors.New("only one DPoP proof is allowed"))
+	}
+
+	thumbprint, err := validateDPoPProof(r, m.Spec, proofs[0], accessToken)
+	if err != nil {
+		return m.proofFailure(w, r, err)
+	}
+
+	setCtxValue(r, ctx.DPoPThumbprint, thumbprint)
+	return nil, http.StatusOK
+}
+
+func (m *DPoPCheck) proofFailure(w http.ResponseWriter, r *http.Request, err error) (error, int) {
+	m.Logger().WithError(err).Info("Invalid DPoP proof.")
+
+	AuthFailed(m, r, "")
+	reportHealthValue(m.Spec, KeyFailure, "1")
+
+	w.Header().Set(headers.WWWAuthenticate, dpopTokenScheme+` error="invalid_dpop_proof"`)
+	return errors.New("Invalid DPoP proof: " + err.Error()), http.StatusUnauthorized
+}
+
+// dpopAccessToken returns the access token of the request and whether it was
+// sent with the DPoP authorization scheme. Only those tokens are bound to
+// proofs by the ath claim.
+func dpopAccessToken(r *http.Request) (string, bool) {
+	authorization := r.Header.Get(headers.Authorization)
+	prefix := dpopTokenScheme + " "
+	if len(authorization) > len(prefix) && strings.EqualFold(authorization[:len(prefix)], prefix) {
+		return authorization[len(prefix):], true
+	}
+	return "", false
+}
+
+// validateDPoPProof validates a DPoP proof for the request and returns the
+// thumbprint of its key. When given, the access token must be the one the
+// proof was made for.
+func validateDPoPProof(r *http.Request, spec *APISpec, proof, accessToken string) (string, error) {
+	var jwk certs.JSONWebKey
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	token, err := parser.Parse(proof, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); !strings.EqualFold(typ, dpopProofType) {
+			return nil, fmt.Errorf("typ must be %s", dpopProofType)
+		}
+
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS, *jwt.SigningMethodECDSA:
+		default:
+			return nil, fmt.Errorf("algorithm %v is not asymmetric", token.Header["alg"])
+		}
+
+		header, ok := token.Header["jwk"].(map[string]interface{})
+		if !ok {
+			return nil, errors.New("jwk header is missing")
+		}
+		if _, private := header["d"]; private {
+			return nil, errors.New("jwk header is a private key")
+		}
+		data, _ := json.Marshal(header)
+		if err := json.Unmarshal(data, &jwk); err != nil {
+			return nil, err
+		}
+		return jwk.PublicKey()
+	})
+	if err != nil {
+		return "", err
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+
+	if htm, _ := claims["htm"].(string); htm != r.Method {
+		return "", errors.New("htm does not match the request method")
+	}
+	if htu, _ := claims["htu"].(string); !dpopTargetMatches(r, htu) {
+		return "", errors.New("htu does not match the request URI")
+	}
+
+	lifetime := spec.DPoP.ProofLifetime
+	if lifetime <= 0 {
+		lifetime = defaultDPoPProofLifetime
+	}
+	iat, ok := claims["iat"].(float64)
+	if !ok {
+		return "", errors.New("iat is missing")
+	}
+	if age := time.Since(time.Unix(int64(iat), 0)); age > time.Duration(lifetime)*time.Second || -age > time.Duration(lifetime)*time.Second {
+		return "", errors.New("proof is too old or from the future")
+	}
+
+	if accessToken != "" {
+		sum := sha256.Sum256([]byte(accessToken))
+		ath, _ := claims["ath"].(string)
+		if subtle.ConstantTimeCompare([]byte(ath), []byte(base64.RawURLEncoding.EncodeToString(sum[:]))) != 1 {
+			return "", errors.New("ath does not match the access token")
+		}
+	}
+
+	thumbprint, err := jwk.Thumbprint()
+	if err != nil {
+		return "", err
+	}
+
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return "", errors.New("jti is missing")
+	}
+	// Proofs from the future are valid for twice the lifetime
+	if dpopReplayCache.IncrememntWithExpire(storage.HashStr(thumbprint+jti), 2*lifetime) > 1 {
+		return "", errors.New("proof was used already")
+	}
+
+	return thumbprint, nil
+}
+
+// dpopTargetMatches checks the htu claim of a proof is the URI of the request,
+// without query and fragment.
+func dpopTargetMatches(r *http.Request, htu string) bool {
+	target, err := url.Parse(htu)
+	if err != nil {
+		return false
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	} else if proto := r.Header.Get(headers.XForwardProto); proto != "" {
+		scheme = proto
+	}
+
+	path := target.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	return strings.EqualFold(target.Scheme, scheme) &&
+		strings.EqualFold(target.Host, r.Host) &&
+		path == r.URL.EscapedPath()
+}
+
+// checkProofKeyBinding checks the request came with a proof signed by the key
+// of the thumbprint a token is bound to.
+func checkProofKeyBinding(r *http.Request, thumbprint string) error {
+	if thumbprint == "" {
+		return nil
+	}
+
+	presented, _ := r.Context().Value(ctx.DPoPThumbprint).(string)
+	if presented == "" {
+		return errDPoPProofRequired
+	}
+	if subtle.ConstantTimeCompare([]byte(presented), []byte(thumbprint)) != 1 {
+		return errors.New("DPoP proof is signed by another key than the token is bound to")
+	}
+	return nil
+}
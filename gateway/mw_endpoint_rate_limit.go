@@ -0,0 +1,169 @@
+package gateway
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/regexp"
+	"github.com/TykTechnologies/tyk/request"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+// EndpointRateLimit enforces rate limits and quotas of endpoints, set by the
+// key or its policies, or by the API definition.
+type EndpointRateLimit struct {
+	BaseMiddleware
+}
+
+func (m *EndpointRateLimit) Name() string {
+	return "EndpointRateLimit"
+}
+
+// EnabledForSpec enables the middleware for APIs limiting endpoints, and for
+// keyed APIs whose endpoints a loaded policy limits. APIs are reloaded along
+// with policies. Limits set on keys directly only apply once it is enabled.
+func (m *EndpointRateLimit) EnabledForSpec() bool {
+	for _, version := range m.Spec.VersionData.Versions {
+		if len(version.ExtendedPaths.RateLimit) > 0 {
+			return true
+		}
+	}
+
+	if m.Spec.UseKeylessAccess {
+		return false
+	}
+
+	policiesMu.RLock()
+	defer policiesMu.RUnlock()
+	for _, policy := range policiesByID {
+		if len(policy.AccessRights[m.Spec.APIID].EndpointLimits) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *EndpointRateLimit) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
+	if !ctxCheckLimits(r) {
+		return nil, http.StatusOK
+	}
+
+	limit, found := m.endpointLimit(r)
+	if !found {
+		return nil, http.StatusOK
+	}
+
+	endpoint := limit.Method + " " + limit.Path
+	reason, endpointSession := m.forwardEndpointMessage(r, endpoint, limit.Rate, limit.Per, limit.QuotaMax, limit.QuotaRenewalRate)
+
+	if limit.QuotaMax > 0 {
+		remaining := endpointSession.QuotaRemaining
+		if reason == sessionFailQuota {
+			remaining = 0
+		}
+		w.Header().Set(XRateLimitEndpointLimit, strconv.FormatInt(limit.QuotaMax, 10))
+		w.Header().Set(XRateLimitEndpointRemaining, strconv.FormatInt(remaining, 10))
+	}
+
+	token := ctxGetAuthToken(r)
+	switch reason {
+	case sessionFailRateLimit:
+		m.Logger().WithField("key", obfuscateKey(token)).Info("Endpoint rate limit exceeded: ", endpoint)
+		m.FireEvent(EventRateLimitExceeded, EventKeyFailureMeta{
+			EventMetaDefault: EventMetaDefault{Message: "Endpoint Rate Limit Exceeded", OriginatingRequest: EncodeRequestToEvent(r)},
+			Path:             r.URL.Path,
+			Origin:           request.RealIP(r),
+			Key:              token,
+		})
+		return errors.New("Rate limit exceeded"), http.StatusTooManyRequests
+	case sessionFailQuota:
+		m.Logger().WithField("key", obfuscateKey(token)).Info("Endpoint quota exceeded: ", endpoint)
+		m.FireEvent(EventQuotaExceeded, EventKeyFailureMeta{
+			EventMetaDefault: EventMetaDefault{Message: "Endpoint Quota Exceeded", OriginatingRequest: EncodeRequestToEvent(r)},
+			Path:             r.URL.Path,
+			Origin:           request.RealIP(r),
+			Key:              token,
+		})
+		return errors.New("Quota exceeded"), http.StatusForbidden
+	}
+
+	return nil, http.StatusOK
+}
+
+// endpointLimit returns limit of the requested endpoint, set by the key, or
+// by the API definition.
+func (m *EndpointRateLimit) endpointLimit(r *http.Request) (user.EndpointLimit, bool) {
+	if session := ctxGetSession(r); session != nil {
+		for _, limit := range session.AccessRights[m.Spec.APIID].EndpointLimits {
+			if limit.Method != r.Method {
+				continue
+			}
+
+			rx, err := regexp.Compile(limit.Path)
+			if err != nil {
+				m.Logger().WithError(err).Error("Invalid path of endpoint limit: ", limit.Path)
+				continue
+			}
+			if rx.MatchString(r.URL.Path) {
+				return limit, true
+			}
+		}
+	}
+
+	_, versionPaths, _, _ := m.Spec.Version(r)
+	found, meta := m.Spec.CheckSpecMatchesStatus(r, versionPaths, EndpointRateLimited)
+	if !found {
+		return user.EndpointLimit{}, false
+	}
+
+	limit := meta.(*apidef.RateLimitMeta)
+	return user.EndpointLimit{
+		Path:             limit.Path,
+		Method:           limit.Method,
+		Rate:             limit.Rate,
+		Per:              limit.Per,
+		QuotaMax:         limit.QuotaMax,
+		QuotaRenewalRate: limit.QuotaRenewalRate,
+	}, true
+}
+
+// forwardEndpointMessage enforces rate limit and quota of the endpoint. They
+// are counted per key, or for all requests of keyless APIs, apart from other
+// endpoints. Returned session holds the remaining quota.
+func (t BaseMiddleware) forwardEndpointMessage(r *http.Request, endpoint string, rate, per float64, quotaMax, quotaRenewalRate int64) (sessionFailReason, *user.SessionState) {
+	key := "endpoint-" + t.Spec.OrgID + t.Spec.APIID
+	var lastUpdated string
+	if session := ctxGetSession(r); session != nil {
+		key = ctxGetAuthToken(r)
+		lastUpdated = session.LastUpdated
+	}
+
+	endpointSession := &user.SessionState{
+		Rate:             rate,
+		Per:              per,
+		QuotaMax:         quotaMax,
+		QuotaRenewalRate: quotaRenewalRate,
+		// Quota keys expire on renewal, so renewal date is always ahead
+		QuotaRenews: time.Now().Unix() + quotaRenewalRate,
+		LastUpdated: lastUpdated,
+	}
+	endpointSession.SetKeyHash(storage.HashKey(key + "-" + endpoint))
+
+	reason := sessionLimiter.ForwardMessage(
+		r,
+		endpointSession,
+		key+":"+endpoint,
+		t.Spec.SessionManager.Store(),
+		rate > 0,
+		quotaMax > 0,
+		&t.Spec.GlobalConfig,
+		t.Spec.APIID,
+		false,
+	)
+
+	return reason, endpointSession
+}
@@ -0,0 +1,131 @@
+package gateway
+
+import (
+	"testing"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+func TestEndpointRateLimit(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	DRLManager.CurrentTokenValue = 1
+	DRLManager.RequestTokenValue = 1
+	defer func() {
+		DRLManager.CurrentTokenValue = 0
+		DRLManager.RequestTokenValue = 0
+	}()
+
+	endpointLimits := func(spec *APISpec) {
+		UpdateAPIVersion(spec, "v1", func(v *apidef.VersionInfo) {
+			v.UseExtendedPaths = true
+			v.ExtendedPaths.RateLimit = []apidef.RateLimitMeta{
+				{Path: "/orders", Method: "POST", Rate: 1, Per: 60},
+				{Path: "/orders", Method: "GET", Rate: 3, Per: 60},
+				{Path: "/items", Method: "GET", QuotaMax: 2, QuotaRenewalRate: 60},
+			}
+		})
+	}
+
+	t.Run("API definition", func(t *testing.T) {
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.APIID = "endpoint-limits-keyless"
+			spec.Proxy.ListenPath = "/"
+			endpointLimits(spec)
+		})
+
+		ts.Run(t, []test.TestCase{
+			{Method: "POST", Path: "/orders", Code: 200},
+			{Method: "POST", Path: "/orders", Code: 429},
+			// Endpoints are counted apart
+			{Method: "GET", Path: "/orders", Code: 200},
+			{Method: "GET", Path: "/orders", Code: 200},
+			{Method: "GET", Path: "/other", Code: 200},
+			{Method: "GET", Path: "/other", Code: 200},
+			// Quota is reported per endpoint
+			{Method: "GET", Path: "/items", Code: 200, HeadersMatch: map[string]string{
+				XRateLimitEndpointLimit:     "2",
+				XRateLimitEndpointRemaining: "1",
+			}},
+			{Method: "GET", Path: "/items", Code: 200, HeadersMatch: map[string]string{
+				XRateLimitEndpointRemaining: "0",
+			}},
+			{Method: "GET", Path: "/items", Code: 403, HeadersMatch: map[string]string{
+				XRateLimitEndpointRemaining: "0",
+			}},
+		}...)
+	})
+
+	t.Run("Policy", func(t *testing.T) {
+		spec := BuildAndLoadAPI(func(spec *APISpec) {
+			spec.APIID = "endpoint-limits-keyed"
+			spec.UseKeylessAccess = false
+			spec.Proxy.ListenPath = "/"
+			endpointLimits(spec)
+		})[0]
+
+		policyID := CreatePolicy(func(p *user.Policy) {
+			p.AccessRights = map[string]user.AccessDefinition{
+				spec.APIID: {
+					APIID: spec.APIID,
+					EndpointLimits: []user.EndpointLimit{
+						{Path: "/orders$", Method: "POST", Rate: 2, Per: 60},
+					},
+				},
+			}
+		})
+
+		newKey := func() map[string]string {
+			key := CreateSession(func(s *user.SessionState) {
+				s.ApplyPolicies = []string{policyID}
+			})
+			return map[string]string{"Authorization": key}
+		}
+
+		key1, key2 := newKey(), newKey()
+		ts.Run(t, []test.TestCase{
+			// Limit of policy takes precedence over limit of API
+			{Method: "POST", Path: "/orders", Headers: key1, Code: 200},
+			{Method: "POST", Path: "/orders", Headers: key1, Code: 200},
+			{Method: "POST", Path: "/orders", Headers: key1, Code: 429},
+			// Keys are counted apart
+			{Method: "POST", Path: "/orders", Headers: key2, Code: 200},
+		}...)
+	})
+
+	t.Run("Policy only", func(t *testing.T) {
+		policyID := CreatePolicy(func(p *user.Policy) {
+			p.AccessRights = map[string]user.AccessDefinition{
+				"endpoint-limits-policy": {
+					APIID: "endpoint-limits-policy",
+					EndpointLimits: []user.EndpointLimit{
+						{Path: "/orders$", Method: "POST", Rate: 1, Per: 60},
+					},
+				},
+			}
+		})
+
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.APIID = "endpoint-limits-policy"
+			spec.UseKeylessAccess = false
+			spec.Proxy.ListenPath = "/"
+		})
+
+		key := CreateSession(func(s *user.SessionState) {
+			s.ApplyPolicies = []string{policyID}
+		})
+
+		ts.Run(t, []test.TestCase{
+			{Method: "POST", Path: "/orders", Headers: map[string]string{"Authorization": key}, Code: 200},
+			{Method: "POST", Path: "/orders", Headers: map[string]string{"Authorization": key}, Code: 429},
+		}...)
+
+		spec := &APISpec{APIDefinition: &apidef.APIDefinition{APIID: "endpoint-limits-none"}}
+		if (&EndpointRateLimit{BaseMiddleware: BaseMiddleware{Spec: spec}}).EnabledForSpec() {
+			t.Error("Should not be enabled for APIs without endpoint limits")
+		}
+	})
+}
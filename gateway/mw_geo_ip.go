@@ -0,0 +1,93 @@
+package gateway
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/TykTechnologies/tyk/request"
+)
+
+// GeoIPAccessCheck allows and blocks requests by their location in the GeoIP
+// database, as set by the geo_ip_access of the API.
+type GeoIPAccessCheck struct {
+	BaseMiddleware
+}
+
+func (g *GeoIPAccessCheck) Name() string {
+	return "GeoIPAccessCheck"
+}
+
+func (g *GeoIPAccessCheck) EnabledForSpec() bool {
+	access := g.Spec.GeoIPAccess
+	return access.Enabled && (len(access.Allowed) > 0 || len(access.Blocked) > 0)
+}
+
+func (g *GeoIPAccessCheck) Init() {
+	if analytics.GeoIPDB == nil {
+		g.Logger().Warning("GeoIP database is not loaded, requests to APIs allowing locations are denied")
+	}
+}
+
+// ProcessRequest will run any checks on the request on the way through the system, return an error to have the chain fail
+func (g *GeoIPAccessCheck) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
+	ip := request.RealIP(r)
+	if geoIPAllowed(geoIPLocations(ip), g.Spec.GeoIPAccess.Allowed, g.Spec.GeoIPAccess.Blocked) {
+		return nil, http.StatusOK
+	}
+
+	// Fire Authfailed Event
+	AuthFailed(g, r, ip)
+	// Report in health check
+	reportHealthValue(g.Spec, KeyFailure, "-1")
+
+	return errors.New("access from this location has been disallowed"), http.StatusForbidden
+}
+
+// geoIPLocations returns the locations of an IP which geo access lists match:
+// its country code, and the region codes of its subdivisions. Locations of
+// IPs which can't be looked up are unknown.
+func geoIPLocations(ip string) []string {
+	if analytics.GeoIPDB == nil {
+		return nil
+	}
+	record, err := geoIPLookup(ip)
+	if err != nil || record == nil || record.Country.ISOCode == "" {
+		return nil
+	}
+
+	locations := []string{record.Country.ISOCode}
+	for _, subdivision := range record.Subdivisions {
+		locations = append(locations, record.Country.ISOCode+"-"+subdivision.ISOCode)
+	}
+	return locations
+}
+
+// geoIPAllowed tells whether a request from the locations is allowed. When
+// some locations are allowed, requests from unknown locations are not.
+func geoIPAllowed(locations, allowed, blocked []string) bool {
+	for _, location := range locations {
+		if matchLocation(location, blocked) {
+			return false
+		}
+	}
+	if len(allowed) == 0 {
+		return true
+	}
+
+	for _, location := range locations {
+		if matchLocation(location, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchLocation(location string, list []string) bool {
+	for _, entry := range list {
+		if strings.EqualFold(location, entry) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,219 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"sort"
+	"testing"
+
+	maxminddb "github.com/oschwald/maxminddb-golang"
+
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+// mmdbEncode encodes strings, unsigned integers, arrays and maps in the
+// MaxMind DB data format.
+func mmdbEncode(v interface{}) []byte {
+	control := func(typ, size int) []byte {
+		if typ > 7 {
+			return []byte{byte(size), byte(typ - 7)}
+		}
+		return []byte{byte(typ<<5 | size)}
+	}
+	uint := func(typ int, n uint64) []byte {
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, n)
+		b = bytes.TrimLeft(b, "\x00")
+		return append(control(typ, len(b)), b...)
+	}
+
+	switch v := v.(type) {
+	case string:
+		return append(control(2, len(v)), v...)
+	case uint16:
+		return uint(5, uint64(v))
+	case uint32:
+		return uint(6, uint64(v))
+	case uint64:
+		return uint(9, v)
+	case []interface{}:
+		out := control(11, len(v))
+		for _, item := range v {
+			out = append(out, mmdbEncode(item)...)
+		}
+		return out
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		out := control(7, len(v))
+		for _, key := range keys {
+			out = append(out, mmdbEncode(key)...)
+			out = append(out, mmdbEncode(v[key])...)
+		}
+		return out
+	}
+	panic("unsupported type")
+}
+
+// testGeoIPDB builds an IPv4 MaxMind DB of records by CIDR range.
+func testGeoIPDB(t testing.TB, records map[string]map[string]interface{}) *maxminddb.Reader {
+	const empty = -1
+
+	cidrs := make([]string, 0, len(records))
+	for cidr := range records {
+		cidrs = append(cidrs, cidr)
+	}
+	sort.Strings(cidrs)
+
+	// Records of nodes are a node, empty, or data of the range -2 - i
+	nodes := [][2]int{{empty, empty}}
+	var data []byte
+	offsets := make([]int, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets[i] = len(data)
+		data = append(data, mmdbEncode(records[cidr])...)
+
+		ones, _ := network.Mask.Size()
+		ip, node := network.IP.To4(), 0
+		for b := 0; b < ones; b++ {
+			bit := int(ip[b/8]>>uint(7-b%8)) & 1
+			if b == ones-1 {
+				nodes[node][bit] = -2 - i
+				break
+			}
+			if nodes[node][bit] < 0 {
+				nodes = append(nodes, [2]int{empty, empty})
+				nodes[node][bit] = len(nodes) - 1
+			}
+			node = nodes[node][bit]
+		}
+	}
+
+	var db []byte
+	for _, node := range nodes {
+		for _, record := range node {
+			value := record
+			switch {
+			case record == empty:
+				value = len(nodes)
+			case record < empty:
+				value = len(nodes) + 16 + offsets[-2-record]
+			}
+			db = append(db, byte(value>>16), byte(value>>8), byte(value))
+		}
+	}
+	db = append(db, make([]byte, 16)...)
+	db = append(db, data...)
+	db = append(db, "\xAB\xCD\xEFMaxMind.com"...)
+	db = append(db, mmdbEncode(map[string]interface{}{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(0),
+		"database_type":               "Test",
+		"description":                 map[string]interface{}{},
+		"ip_version":                  uint16(4),
+		"languages":                   []interface{}{},
+		"node_count":                  uint32(len(nodes)),
+		"record_size":                 uint16(24),
+	})...)
+
+	reader, err := maxminddb.FromBytes(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reader
+}
+
+func withTestGeoIPDB(t testing.TB) func() {
+	old := analytics.GeoIPDB
+	analytics.GeoIPDB = testGeoIPDB(t, map[string]map[string]interface{}{
+		"10.0.1.0/24": {
+			"continent":    map[string]interface{}{"code": "NA"},
+			"country":      map[string]interface{}{"iso_code": "US"},
+			"subdivisions": []interface{}{map[string]interface{}{"iso_code": "CA"}},
+		},
+		"10.0.2.0/24": {
+			"continent":    map[string]interface{}{"code": "NA"},
+			"country":      map[string]interface{}{"iso_code": "US"},
+			"subdivisions": []interface{}{map[string]interface{}{"iso_code": "NY"}},
+		},
+		"10.0.3.0/24": {
+			"continent": map[string]interface{}{"code": "EU"},
+			"country":   map[string]interface{}{"iso_code": "FR"},
+		},
+	})
+	return func() {
+		analytics.GeoIPDB = old
+	}
+}
+
+func TestGeoIPAccess(t *testing.T) {
+	defer withTestGeoIPDB(t)()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/allowed/"
+		spec.GeoIPAccess.Enabled = true
+		spec.GeoIPAccess.Allowed = []string{"us"}
+		spec.GeoIPAccess.Blocked = []string{"US-NY"}
+	}, func(spec *APISpec) {
+		spec.APIID = "blocked"
+		spec.Proxy.ListenPath = "/blocked/"
+		spec.GeoIPAccess.Enabled = true
+		spec.GeoIPAccess.Blocked = []string{"FR"}
+	}, func(spec *APISpec) {
+		spec.APIID = "keys"
+		spec.Proxy.ListenPath = "/keys/"
+		spec.UseKeylessAccess = false
+	})
+
+	from := func(ip string) map[string]string {
+		return map[string]string{"X-Real-IP": ip}
+	}
+	ts.Run(t, []test.TestCase{
+		{Path: "/allowed/", Headers: from("10.0.1.1"), Code: http.StatusOK},
+		{Path: "/allowed/", Headers: from("10.0.2.1"), Code: http.StatusForbidden},
+		{Path: "/allowed/", Headers: from("10.0.3.1"), Code: http.StatusForbidden},
+		{Path: "/allowed/", Headers: from("10.0.4.1"), Code: http.StatusForbidden},
+		{Path: "/blocked/", Headers: from("10.0.3.1"), Code: http.StatusForbidden},
+		{Path: "/blocked/", Headers: from("10.0.4.1"), Code: http.StatusOK},
+	}...)
+
+	t.Run("Keys", func(t *testing.T) {
+		policyID := CreatePolicy(func(p *user.Policy) {
+			p.GeoIPAccess.Blocked = []string{"FR"}
+		})
+		key := CreateSession(func(s *user.SessionState) {
+			s.ApplyPolicies = []string{policyID}
+		})
+		authorization := func(ip string) map[string]string {
+			return map[string]string{"Authorization": key, "X-Real-IP": ip}
+		}
+
+		ts.Run(t, []test.TestCase{
+			{Path: "/keys/", Headers: authorization("10.0.1.1"), Code: http.StatusOK},
+			{Path: "/keys/", Headers: authorization("10.0.3.1"), Code: http.StatusForbidden},
+		}...)
+	})
+
+	t.Run("Analytics", func(t *testing.T) {
+		record := AnalyticsRecord{}
+		record.GetGeo("10.0.1.1")
+		if record.Geo.Continent.Code != "NA" || record.Geo.Country.ISOCode != "US" ||
+			len(record.Geo.Subdivisions) != 1 || record.Geo.Subdivisions[0].ISOCode != "CA" {
+			t.Errorf("Records should carry the location, got %+v", record.Geo)
+		}
+	})
+}
@@ -0,0 +1,133 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+
+	"github.com/TykTechnologies/tyk/graphql"
+	"github.com/TykTechnologies/tyk/headers"
+)
+
+// GraphQLMiddleware parses GraphQL queries and rejects queries deeper, more
+// complex or with more aliases than allowed for the key, or for the API.
+type GraphQLMiddleware struct {
+	BaseMiddleware
+}
+
+// graphQLRequest is a GraphQL request sent as JSON.
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+func (m *GraphQLMiddleware) Name() string {
+	return "GraphQLMiddleware"
+}
+
+func (m *GraphQLMiddleware) EnabledForSpec() bool {
+	return m.Spec.GraphQL.Enabled
+}
+
+func (m *GraphQLMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
+	req, err := readGraphQLRequest(r)
+	if err != nil {
+		return err, http.StatusBadRequest
+	}
+
+	doc, err := graphql.Parse(req.Query)
+	if err != nil {
+		return fmt.Errorf("Invalid GraphQL query: %v", err), http.StatusBadRequest
+	}
+
+	analysis, err := doc.Analyse(req.OperationName, req.Variables)
+	if err != nil {
+		return fmt.Errorf("Invalid GraphQL query: %v", err), http.StatusBadRequest
+	}
+
+	ctxSetGraphQLAnalysis(r, analysis)
+
+	if r.Method == http.MethodGet && analysis.Type != "query" {
+		return errors.New("GraphQL " + analysis.Type + " can't be sent with GET"), http.StatusMethodNotAllowed
+	}
+
+	depth, complexity, aliases := m.limits(r)
+	switch {
+	case depth > 0 && analysis.Depth > depth:
+		return fmt.Errorf("GraphQL query depth %d exceeds limit of %d", analysis.Depth, depth), http.StatusForbidden
+	case complexity > 0 && analysis.Complexity > complexity:
+		return fmt.Errorf("GraphQL query complexity %d exceeds limit of %d", analysis.Complexity, complexity), http.StatusForbidden
+	case aliases > 0 && analysis.Aliases > aliases:
+		return fmt.Errorf("GraphQL query has %d aliases, limit is %d", analysis.Aliases, aliases), http.StatusForbidden
+	}
+
+	return nil, http.StatusOK
+}
+
+// limits returns limits of the key, falling back to limits of the API. 0
+// means no limit.
+func (m *GraphQLMiddleware) limits(r *http.Request) (depth, complexity, aliases int) {
+	depth = m.Spec.GraphQL.MaxDepth
+	complexity = m.Spec.GraphQL.MaxComplexity
+	aliases = m.Spec.GraphQL.MaxAliases
+
+	session := ctxGetSession(r)
+	if session == nil {
+		return
+	}
+
+	keyLimit := func(limit, apiLimit int) int {
+		switch {
+		case limit < 0:
+			return 0
+		case limit > 0:
+			return limit
+		}
+		return apiLimit
+	}
+
+	limits := session.GraphQLLimits
+	return keyLimit(limits.MaxDepth, depth), keyLimit(limits.MaxComplexity, complexity), keyLimit(limits.MaxAliases, aliases)
+}
+
+// readGraphQLRequest reads the query from parameters of GET requests, or from
+// the body, which is either JSON or the query itself for application/graphql
+// content type. The body is kept for the upstream.
+func readGraphQLRequest(r *http.Request) (*graphQLRequest, error) {
+	req := &graphQLRequest{}
+
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+		req.Query = query.Get("query")
+		req.OperationName = query.Get("operationName")
+		if vars := query.Get("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+				return nil, errors.New("GraphQL variables should be JSON object")
+			}
+		}
+	} else {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get(headers.ContentType))
+		if mediaType == "application/graphql" {
+			req.Query = string(body)
+		} else if err := json.Unmarshal(body, req); err != nil {
+			return nil, errors.New("GraphQL request should be JSON object with query")
+		}
+	}
+
+	if req.Query == "" {
+		return nil, errors.New("GraphQL query is missing")
+	}
+
+	return req, nil
+}
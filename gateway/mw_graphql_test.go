@@ -0,0 +1,121 @@
+package gateway
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	msgpack "gopkg.in/vmihailenco/msgpack.v2"
+
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+const (
+	testGraphQLShallow = `{"query": "{ me { name } }"}`
+	testGraphQLDeep    = `{"query": "query Friends { me { friends(first: 2) { name } } }"}`
+	testGraphQLAliases = `{"query": "{ a: me { name } b: me { name } }"}`
+)
+
+func TestGraphQL(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.GraphQL.Enabled = true
+		spec.GraphQL.MaxDepth = 2
+		spec.GraphQL.MaxAliases = 1
+	})
+
+	getQuery := "/?query=" + url.QueryEscape("{ me { name } }")
+	getMutation := "/?query=" + url.QueryEscape("mutation { logout }")
+
+	ts.Run(t, []test.TestCase{
+		{Method: "POST", Path: "/", Data: testGraphQLShallow, Code: http.StatusOK, BodyMatch: `"Body":"{\"query\"`},
+		{Method: "POST", Path: "/", Data: "{ me { name } }", Headers: map[string]string{"Content-Type": "application/graphql"}, Code: http.StatusOK},
+		{Method: "GET", Path: getQuery, Code: http.StatusOK},
+		{Method: "GET", Path: getMutation, Code: http.StatusMethodNotAllowed},
+		{Method: "POST", Path: "/", Data: testGraphQLDeep, Code: http.StatusForbidden, BodyMatch: "depth 3 exceeds limit of 2"},
+		{Method: "POST", Path: "/", Data: testGraphQLAliases, Code: http.StatusForbidden, BodyMatch: "2 aliases, limit is 1"},
+		{Method: "POST", Path: "/", Data: `{"query": "{ me { name }"}`, Code: http.StatusBadRequest, BodyMatch: "Invalid GraphQL query"},
+		{Method: "POST", Path: "/", Data: `{}`, Code: http.StatusBadRequest, BodyMatch: "GraphQL query is missing"},
+	}...)
+}
+
+func TestGraphQLPolicyLimits(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.UseKeylessAccess = false
+		spec.Proxy.ListenPath = "/"
+		spec.GraphQL.Enabled = true
+		spec.GraphQL.MaxDepth = 2
+	})
+
+	deepPolicy := CreatePolicy(func(p *user.Policy) {
+		p.GraphQLLimits.MaxDepth = 3
+		p.GraphQLLimits.MaxComplexity = 3
+	})
+	unlimitedPolicy := CreatePolicy(func(p *user.Policy) {
+		p.GraphQLLimits.MaxDepth = -1
+	})
+
+	deepKey := CreateSession(func(s *user.SessionState) {
+		s.ApplyPolicies = []string{deepPolicy}
+	})
+	unlimitedKey := CreateSession(func(s *user.SessionState) {
+		s.ApplyPolicies = []string{unlimitedPolicy}
+	})
+	defaultKey := CreateSession()
+
+	ts.Run(t, []test.TestCase{
+		{Method: "POST", Path: "/", Data: testGraphQLDeep, Headers: map[string]string{"Authorization": defaultKey}, Code: http.StatusForbidden},
+		// 1 + me(1 + friends(1 + 2 * name))
+		{Method: "POST", Path: "/", Data: testGraphQLDeep, Headers: map[string]string{"Authorization": deepKey}, Code: http.StatusForbidden,
+			BodyMatch: "complexity 4 exceeds limit of 3"},
+		{Method: "POST", Path: "/", Data: testGraphQLShallow, Headers: map[string]string{"Authorization": deepKey}, Code: http.StatusOK},
+		{Method: "POST", Path: "/", Data: testGraphQLDeep, Headers: map[string]string{"Authorization": unlimitedKey}, Code: http.StatusOK},
+	}...)
+}
+
+func TestGraphQLAnalytics(t *testing.T) {
+	ts := StartTest(TestConfig{
+		Delay: 20 * time.Millisecond,
+	})
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.GraphQL.Enabled = true
+	})
+
+	// Cleanup before test
+	time.Sleep(recordsBufferFlushInterval + 50)
+	analytics.Store.GetAndDeleteSet(analyticsKeyName)
+
+	ts.Run(t, test.TestCase{Method: "POST", Path: "/", Data: testGraphQLDeep, Code: http.StatusOK})
+
+	time.Sleep(recordsBufferFlushInterval + 50)
+	results := analytics.Store.GetAndDeleteSet(analyticsKeyName)
+	if len(results) != 1 {
+		t.Fatal("Should return 1 record", len(results))
+	}
+
+	var record AnalyticsRecord
+	msgpack.Unmarshal(results[0].([]byte), &record)
+
+	expected := GraphQLStats{
+		OperationType: "query",
+		OperationName: "Friends",
+		Depth:         3,
+		Complexity:    4,
+		Fields:        []string{"me", "me.friends", "me.friends.name"},
+	}
+	if !reflect.DeepEqual(record.GraphQL, expected) {
+		t.Error("GraphQL operation should be recorded", record.GraphQL)
+	}
+}
@@ -0,0 +1,188 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/request"
+)
+
+const (
+	grpcContentType = "application/grpc"
+	grpcStatus      = "Grpc-Status"
+	grpcMessage     = "Grpc-Message"
+)
+
+// GRPCMiddleware only lets gRPC calls through, and enforces rate limits and
+// quotas of the called method, per key.
+type GRPCMiddleware struct {
+	BaseMiddleware
+}
+
+func (m *GRPCMiddleware) Name() string {
+	return "GRPCMiddleware"
+}
+
+func (m *GRPCMiddleware) EnabledForSpec() bool {
+	return m.Spec.GRPC.Enabled
+}
+
+func (m *GRPCMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
+	if !IsGRPC(r.Header) {
+		return errors.New("Only gRPC requests are accepted"), http.StatusUnsupportedMediaType
+	}
+
+	service, method := grpcMethod(r.URL.Path)
+	if service == "" {
+		return errors.New("Malformed gRPC method path"), http.StatusNotFound
+	}
+
+	limit, found := m.methodLimit(service, method)
+	if !found || !ctxCheckLimits(r) {
+		return nil, http.StatusOK
+	}
+
+	reason, _ := m.forwardEndpointMessage(r, service+"/"+method, limit.Rate, limit.Per, limit.QuotaMax, limit.QuotaRenewalRate)
+	key := ctxGetAuthToken(r)
+
+	switch reason {
+	case sessionFailRateLimit:
+		m.Logger().WithField("key", obfuscateKey(key)).Info("gRPC method rate limit exceeded: ", service, "/", method)
+		m.FireEvent(EventRateLimitExceeded, EventKeyFailureMeta{
+			EventMetaDefault: EventMetaDefault{Message: "gRPC Method Rate Limit Exceeded", OriginatingRequest: EncodeRequestToEvent(r)},
+			Path:             r.URL.Path,
+			Origin:           request.RealIP(r),
+			Key:              key,
+		})
+		return errors.New("Rate limit exceeded for " + service + "/" + method), http.StatusTooManyRequests
+	case sessionFailQuota:
+		m.Logger().WithField("key", obfuscateKey(key)).Info("gRPC method quota exceeded: ", service, "/", method)
+		m.FireEvent(EventQuotaExceeded, EventKeyFailureMeta{
+			EventMetaDefault: EventMetaDefault{Message: "gRPC Method Quota Exceeded", OriginatingRequest: EncodeRequestToEvent(r)},
+			Path:             r.URL.Path,
+			Origin:           request.RealIP(r),
+			Key:              key,
+		})
+		return errors.New("Quota exceeded for " + service + "/" + method), http.StatusForbidden
+	}
+
+	return nil, http.StatusOK
+}
+
+// methodLimit returns limits of the method, or of all methods of the service.
+func (m *GRPCMiddleware) methodLimit(service, method string) (apidef.GRPCMethodMeta, bool) {
+	if limit, found := m.Spec.GRPC.Methods[service+"/"+method]; found {
+		return limit, true
+	}
+
+	limit, found := m.Spec.GRPC.Methods[service+"/*"]
+	return limit, found
+}
+
+// IsGRPC returns true if the headers are of a gRPC request or response.
+func IsGRPC(h http.Header) bool {
+	return strings.HasPrefix(h.Get(headers.ContentType), grpcContentType)
+}
+
+// grpcMethod returns the service and method called, which are the last two
+// segments of the path: /package.Service/Method.
+func grpcMethod(path string) (service, method string) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 2 || parts[len(parts)-2] == "" || parts[len(parts)-1] == "" {
+		return "", ""
+	}
+
+	return parts[len(parts)-2], parts[len(parts)-1]
+}
+
+// grpcCode maps HTTP status of a gateway error to gRPC status code.
+func grpcCode(httpCode int) codes.Code {
+	switch httpCode {
+	case http.StatusOK:
+		return codes.OK
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusUnsupportedMediaType:
+		return codes.Unimplemented
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case 499:
+		return codes.Canceled
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusInternalServerError:
+		return codes.Internal
+	}
+
+	return codes.Unknown
+}
+
+// writeGRPCError writes a trailers-only gRPC response, as gRPC clients expect
+// errors in status and message headers of successful HTTP responses.
+func writeGRPCError(w http.ResponseWriter, errMsg string, errCode int) {
+	w.Header().Set(headers.ContentType, grpcContentType)
+	w.Header().Set(grpcStatus, strconv.Itoa(int(grpcCode(errCode))))
+	w.Header().Set(grpcMessage, grpcEncodeMessage(errMsg))
+	w.WriteHeader(http.StatusOK)
+}
+
+// grpcEncodeMessage percent-encodes the message as required for
+// grpc-message header.
+func grpcEncodeMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		if c := msg[i]; c >= ' ' && c <= '~' && c != '%' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+// grpcStats returns details of the gRPC call for analytics. Status is read
+// from the upstream response, or mapped from the gateway error code.
+func grpcStats(spec *APISpec, r *http.Request, res *http.Response, errCode int) GRPCStats {
+	if !spec.GRPC.Enabled {
+		return GRPCStats{}
+	}
+
+	service, method := grpcMethod(r.URL.Path)
+	if service == "" {
+		return GRPCStats{}
+	}
+
+	stats := GRPCStats{Service: service, Method: service + "/" + method}
+	if res == nil {
+		stats.Status = int(grpcCode(errCode))
+		return stats
+	}
+
+	// Errors may be sent in headers, with no trailers
+	status := res.Trailer.Get(grpcStatus)
+	if status == "" {
+		status = res.Header.Get(grpcStatus)
+	}
+
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		code = int(codes.Unknown)
+	}
+	stats.Status = code
+
+	return stats
+}
@@ -0,0 +1,269 @@
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	pb "google.golang.org/grpc/examples/helloworld/helloworld"
+	"google.golang.org/grpc/status"
+	msgpack "gopkg.in/vmihailenco/msgpack.v2"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+// startH2CUpstream starts a cleartext HTTP/2 server which replies to gRPC
+// calls with the HTTP protocol and status in trailers, as gRPC servers do.
+func startH2CUpstream(t *testing.T) (string, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Write([]byte(r.Proto + " " + r.URL.Path))
+		w.Header().Set("Grpc-Status", "5")
+	})
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go (&http2.Server{}).ServeConn(conn, &http2.ServeConnOpts{Handler: handler})
+		}
+	}()
+
+	return "http://" + l.Addr().String(), func() { l.Close() }
+}
+
+func TestGRPCProxy(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	upstream, stop := startH2CUpstream(t)
+	defer stop()
+
+	DRLManager.CurrentTokenValue = 1
+	DRLManager.RequestTokenValue = 1
+	defer func() {
+		DRLManager.CurrentTokenValue = 0
+		DRLManager.RequestTokenValue = 0
+	}()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.TargetURL = upstream
+		spec.GRPC.Enabled = true
+		spec.GRPC.Methods = map[string]apidef.GRPCMethodMeta{
+			"helloworld.Greeter/SayHello": {Rate: 1, Per: 60},
+			"helloworld.Greeter/*":        {QuotaMax: 1, QuotaRenewalRate: 60},
+		}
+	})
+
+	grpcHeaders := map[string]string{"Content-Type": "application/grpc"}
+
+	ts.Run(t, []test.TestCase{
+		{Method: "POST", Path: "/helloworld.Greeter/SayHello", Headers: grpcHeaders, Code: http.StatusOK,
+			BodyMatch: "HTTP/2.0 /helloworld.Greeter/SayHello"},
+		{Method: "POST", Path: "/helloworld.Greeter/SayHello", Headers: grpcHeaders, Code: http.StatusOK,
+			HeadersMatch: map[string]string{"Grpc-Status": "8", "Grpc-Message": "Rate limit exceeded for helloworld.Greeter/SayHello"}},
+		{Method: "POST", Path: "/helloworld.Greeter/SayBye", Headers: grpcHeaders, Code: http.StatusOK,
+			BodyMatch: "/helloworld.Greeter/SayBye"},
+		{Method: "POST", Path: "/helloworld.Greeter/SayBye", Headers: grpcHeaders, Code: http.StatusOK,
+			HeadersMatch: map[string]string{"Grpc-Status": "7"}},
+		{Method: "POST", Path: "/helloworld.Greeter", Headers: grpcHeaders, Code: http.StatusOK,
+			HeadersMatch: map[string]string{"Grpc-Status": "12"}},
+		{Method: "POST", Path: "/helloworld.Greeter/SayHello", Code: http.StatusUnsupportedMediaType},
+	}...)
+}
+
+func TestGRPCPerKeyLimits(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	upstream, stop := startH2CUpstream(t)
+	defer stop()
+
+	DRLManager.CurrentTokenValue = 1
+	DRLManager.RequestTokenValue = 1
+	defer func() {
+		DRLManager.CurrentTokenValue = 0
+		DRLManager.RequestTokenValue = 0
+	}()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.UseKeylessAccess = false
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.TargetURL = upstream
+		spec.GRPC.Enabled = true
+		spec.GRPC.Methods = map[string]apidef.GRPCMethodMeta{
+			"helloworld.Greeter/SayHello": {Rate: 1, Per: 60},
+		}
+	})
+
+	key1 := CreateSession()
+	key2 := CreateSession()
+
+	call := func(key string, status string) test.TestCase {
+		tc := test.TestCase{Method: "POST", Path: "/helloworld.Greeter/SayHello", Code: http.StatusOK,
+			Headers: map[string]string{"Content-Type": "application/grpc", "Authorization": key}}
+		if status != "" {
+			tc.HeadersMatch = map[string]string{"Grpc-Status": status}
+		}
+		return tc
+	}
+
+	ts.Run(t, []test.TestCase{
+		call(key1, ""),
+		call(key1, "8"),
+		call(key2, ""),
+		call("", "16"),
+	}...)
+}
+
+func TestGRPCAnalytics(t *testing.T) {
+	ts := StartTest(TestConfig{
+		Delay: 20 * time.Millisecond,
+	})
+	defer ts.Close()
+
+	upstream, stop := startH2CUpstream(t)
+	defer stop()
+
+	DRLManager.CurrentTokenValue = 1
+	DRLManager.RequestTokenValue = 1
+	defer func() {
+		DRLManager.CurrentTokenValue = 0
+		DRLManager.RequestTokenValue = 0
+	}()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "grpc-analytics"
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.TargetURL = upstream
+		spec.GRPC.Enabled = true
+		spec.GRPC.Methods = map[string]apidef.GRPCMethodMeta{
+			"helloworld.Greeter/SayHello": {Rate: 1, Per: 60},
+		}
+	})
+
+	// Cleanup before test
+	time.Sleep(recordsBufferFlushInterval + 50)
+	analytics.Store.GetAndDeleteSet(analyticsKeyName)
+
+	grpcHeaders := map[string]string{"Content-Type": "application/grpc"}
+	ts.Run(t, []test.TestCase{
+		{Method: "POST", Path: "/helloworld.Greeter/SayHello", Headers: grpcHeaders, Code: http.StatusOK},
+		{Method: "POST", Path: "/helloworld.Greeter/SayHello", Headers: grpcHeaders, Code: http.StatusOK},
+	}...)
+
+	time.Sleep(recordsBufferFlushInterval + 50)
+	results := analytics.Store.GetAndDeleteSet(analyticsKeyName)
+	if len(results) != 2 {
+		t.Fatal("Should return 2 records", len(results))
+	}
+
+	statuses := map[int]bool{}
+	for _, result := range results {
+		var record AnalyticsRecord
+		msgpack.Unmarshal(result.([]byte), &record)
+
+		if record.GRPC.Service != "helloworld.Greeter" || record.GRPC.Method != "helloworld.Greeter/SayHello" {
+			t.Error("gRPC method should be recorded", record.GRPC)
+		}
+		statuses[record.GRPC.Status] = true
+	}
+
+	// Upstream replies with NotFound, limited call gets ResourceExhausted
+	if !statuses[5] || !statuses[8] {
+		t.Error("gRPC status should be recorded", statuses)
+	}
+}
+
+func TestGRPCClient(t *testing.T) {
+	_, _, combinedPEM, _ := genServerCertificate()
+	certID, _ := CertificateManager.Add(combinedPEM, "")
+	defer CertificateManager.Delete(certID)
+
+	// Upstream gRPC server without TLS
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	pb.RegisterGreeterServer(s, &server{})
+	go s.Serve(l)
+	defer s.Stop()
+
+	DRLManager.CurrentTokenValue = 1
+	DRLManager.RequestTokenValue = 1
+	defer func() {
+		DRLManager.CurrentTokenValue = 0
+		DRLManager.RequestTokenValue = 0
+	}()
+
+	// Clients need HTTP/2, which is only served over TLS
+	globalConf := config.Global()
+	globalConf.HttpServerOptions.EnableHttp2 = true
+	globalConf.HttpServerOptions.SSLCertificates = []string{certID}
+	globalConf.HttpServerOptions.UseSSL = true
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "grpc-client"
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.TargetURL = "http://" + l.Addr().String()
+		spec.GRPC.Enabled = true
+		spec.GRPC.Methods = map[string]apidef.GRPCMethodMeta{
+			"helloworld.Greeter/SayHello": {Rate: 1, Per: 60},
+		}
+	})
+
+	creds := credentials.NewTLS(&tls.Config{InsecureSkipVerify: true})
+	conn, err := grpc.Dial(strings.TrimPrefix(ts.URL, "https://"), grpc.WithTransportCredentials(creds))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := pb.NewGreeterClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	reply, err := c.SayHello(ctx, &pb.HelloRequest{Name: "Tyk"})
+	if err != nil {
+		t.Fatal("Call should be proxied", err)
+	}
+	if reply.Message != "Hello Tyk" {
+		t.Error("Wrong reply", reply.Message)
+	}
+
+	_, err = c.SayHello(ctx, &pb.HelloRequest{Name: "Tyk"})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Error("Call over the limit should fail with ResourceExhausted", err)
+	}
+}
+
+func TestGRPCEncodeMessage(t *testing.T) {
+	if msg := grpcEncodeMessage("100% done\n"); msg != "100%25 done%0A" {
+		t.Error("Message should be percent-encoded", msg)
+	}
+}
@@ -44,6 +44,11 @@ func (hm *HMACMiddleware) Init() {
 }
 
 func (hm *HMACMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
+	// Messages signed as of RFC 9421, rather than the draft-cavage format
+	if r.Header.Get(headers.SignatureInput) != "" {
+		return hm.processMessageSignature(r)
+	}
+
 	token := r.Header.Get("Authorization")
 	if token == "" {
 		return hm.authorizationError(r)
@@ -76,18 +81,9 @@ func (hm *HMACMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request,
 		return hm.authorizationError(r)
 	}
 
-	if len(hm.Spec.HmacAllowedAlgorithms) > 0 {
-		algorithmAllowed := false
-		for _, alg := range hm.Spec.HmacAllowedAlgorithms {
-			if alg == fieldValues.Algorthm {
-				algorithmAllowed = true
-				break
-			}
-		}
-		if !algorithmAllowed {
-			logger.WithError(err).WithField("algorithm", fieldValues.Algorthm).Error("Algorithm not supported")
-			return hm.authorizationError(r)
-		}
+	if !hm.algorithmAllowed(fieldValues.Algorthm) {
+		logger.WithError(err).WithField("algorithm", fieldValues.Algorthm).Error("Algorithm not supported")
+		return hm.authorizationError(r)
 	}
 
 	// Create a signed string with the secret
@@ -124,15 +120,31 @@ func (hm *HMACMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request,
 		return hm.authorizationError(r)
 	}
 
-	// Set session state on context, we will need it later
+	hm.setSession(r, session, fieldValues.KeyID)
+
+	// Everything seems in order let the request through
+	return nil, http.StatusOK
+}
+
+// setSession sets session state on context, we will need it later
+func (hm *HMACMiddleware) setSession(r *http.Request, session user.SessionState, keyID string) {
 	switch hm.Spec.BaseIdentityProvidedBy {
 	case apidef.HMACKey, apidef.UnsetAuth:
-		ctxSetSession(r, &session, fieldValues.KeyID, false)
-		hm.setContextVars(r, fieldValues.KeyID)
+		ctxSetSession(r, &session, keyID, false)
+		hm.setContextVars(r, keyID)
 	}
+}
 
-	// Everything seems in order let the request through
-	return nil, http.StatusOK
+func (hm *HMACMiddleware) algorithmAllowed(algorithm string) bool {
+	if len(hm.Spec.HmacAllowedAlgorithms) == 0 {
+		return true
+	}
+	for _, alg := range hm.Spec.HmacAllowedAlgorithms {
+		if alg == algorithm {
+			return true
+		}
+	}
+	return false
 }
 
 func stripSignature(token string) string {
@@ -0,0 +1,314 @@
+package gateway
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/headers"
+)
+
+// messageSignatureAlgorithm is the only HMAC algorithm of RFC 9421.
+const messageSignatureAlgorithm = "hmac-sha256"
+
+// messageSignature is a signature of RFC 9421 HTTP Message Signatures, as
+// declared by a member of the Signature-Input header.
+type messageSignature struct {
+	Label      string
+	Components []string
+	Params     map[string]string
+	Signature  []byte
+
+	// rawParams is the member value, which is signed as it was sent
+	rawParams string
+}
+
+// processMessageSignature authenticates requests signed as of RFC 9421. The
+// signature has to cover the method and target of the request.
+func (hm *HMACMiddleware) processMessageSignature(r *http.Request) (error, int) {
+	sig, err := parseMessageSignature(r.Header.Get(headers.SignatureInput), r.Header.Get(headers.Signature))
+	if err != nil {
+		hm.Logger().WithError(err).Error("Message signature malformed")
+		return hm.authorizationError(r)
+	}
+
+	keyID := sig.Params["keyid"]
+	logger := hm.Logger().WithFields(logrus.Fields{"key": obfuscateKey(keyID), "label": sig.Label})
+
+	if !sig.covers("@method") || !(sig.covers("@target-uri") || sig.covers("@path") || sig.covers("@request-target")) {
+		logger.Error("Message signature must cover the method and target of the request")
+		return hm.authorizationError(r)
+	}
+
+	alg := sig.Params["alg"]
+	if alg == "" {
+		alg = messageSignatureAlgorithm
+	}
+	if alg != messageSignatureAlgorithm || !hm.algorithmAllowed(alg) {
+		logger.WithField("algorithm", alg).Error("Algorithm not supported")
+		return hm.authorizationError(r)
+	}
+
+	if err := hm.checkSignatureTimes(sig.Params); err != nil {
+		logger.WithError(err).Error("Message signature not valid at this time")
+		return hm.authorizationError(r)
+	}
+
+	base, err := signatureBase(r, sig)
+	if err != nil {
+		logger.WithError(err).Error("Signature base generation failed")
+		return hm.authorizationError(r)
+	}
+
+	secret, session, err := hm.getSecretAndSessionForKeyID(r, keyID)
+	if err != nil {
+		logger.WithError(err).Error("No HMAC secret for this key")
+		return hm.authorizationError(r)
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(base))
+	if !hmac.Equal(mac.Sum(nil), sig.Signature) {
+		logger.WithField("signature_base", base).Error("Message signature does not match!")
+		return hm.authorizationError(r)
+	}
+
+	hm.setSession(r, session, keyID)
+
+	return nil, http.StatusOK
+}
+
+// checkSignatureTimes checks the signature hasn't expired, and if clock skew
+// is limited, that it was created within it.
+func (hm *HMACMiddleware) checkSignatureTimes(params map[string]string) error {
+	now := time.Now()
+
+	if expires, ok := params["expires"]; ok {
+		sec, err := strconv.ParseInt(expires, 10, 64)
+		if err != nil {
+			return errors.New("expires is not a timestamp")
+		}
+		if now.After(time.Unix(sec, 0)) {
+			return errors.New("signature expired")
+		}
+	}
+
+	created, ok := params["created"]
+	if !ok {
+		if hm.Spec.HmacAllowedClockSkew > 0 {
+			return errors.New("created is required")
+		}
+		return nil
+	}
+	sec, err := strconv.ParseInt(created, 10, 64)
+	if err != nil {
+		return errors.New("created is not a timestamp")
+	}
+
+	skew := now.Sub(time.Unix(sec, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	if hm.Spec.HmacAllowedClockSkew > 0 && float64(skew/time.Millisecond) > hm.Spec.HmacAllowedClockSkew {
+		return errors.New("clock skew outside of acceptable bounds")
+	}
+	return nil
+}
+
+func (s *messageSignature) covers(component string) bool {
+	for _, c := range s.Components {
+		if c == `"`+component+`"` {
+			return true
+		}
+	}
+	return false
+}
+
+// signatureBase generates the string the signature was made of.
+func signatureBase(r *http.Request, sig *messageSignature) (string, error) {
+	var b strings.Builder
+	for _, component := range sig.Components {
+		value, err := componentValue(r, component)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(component + ": " + value + "\n")
+	}
+	b.WriteString(`"@signature-params": ` + sig.rawParams)
+	return b.String(), nil
+}
+
+// componentValue returns the value of a component identifier, such as
+// "@method" or "content-type".
+func componentValue(r *http.Request, component string) (string, error) {
+	name, params := splitParams(component)
+	name, err := strconv.Unquote(name)
+	if err != nil {
+		return "", fmt.Errorf("component %s is not a string", component)
+	}
+
+	if name == "@query-param" {
+		if len(params) != 1 || params["name"] == "" {
+			return "", errors.New("@query-param requires only the name parameter")
+		}
+		values, ok := r.URL.Query()[params["name"]]
+		if !ok || len(values) != 1 {
+			return "", fmt.Errorf("query parameter %s is missing or repeated", params["name"])
+		}
+		return url.QueryEscape(values[0]), nil
+	}
+	if len(params) > 0 {
+		return "", fmt.Errorf("parameters of component %s are not supported", component)
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	switch name {
+	case "@method":
+		return r.Method, nil
+	case "@target-uri":
+		return scheme + "://" + r.Host + r.URL.RequestURI(), nil
+	case "@authority":
+		return strings.ToLower(r.Host), nil
+	case "@scheme":
+		return scheme, nil
+	case "@request-target":
+		return r.URL.RequestURI(), nil
+	case "@path":
+		if path := r.URL.EscapedPath(); path != "" {
+			return path, nil
+		}
+		return "/", nil
+	case "@query":
+		return "?" + r.URL.RawQuery, nil
+	case "host":
+		return r.Host, nil
+	}
+
+	if strings.HasPrefix(name, "@") || name != strings.ToLower(name) {
+		return "", fmt.Errorf("component %s is not supported", component)
+	}
+
+	values, ok := r.Header[textproto.CanonicalMIMEHeaderKey(name)]
+	if !ok {
+		return "", fmt.Errorf("header %s is missing", name)
+	}
+	trimmed := make([]string, len(values))
+	for i, value := range values {
+		trimmed[i] = strings.TrimSpace(value)
+	}
+	return strings.Join(trimmed, ", "), nil
+}
+
+// parseMessageSignature reads the first signature declared by Signature-Input
+// out of both headers.
+func parseMessageSignature(input, signature string) (*messageSignature, error) {
+	inputs := splitOutside(input, ',')
+	if len(inputs) == 0 || strings.TrimSpace(inputs[0]) == "" {
+		return nil, errors.New("no signature input")
+	}
+
+	label, rawParams, err := splitMember(inputs[0])
+	if err != nil {
+		return nil, err
+	}
+	innerList, params := splitParams(rawParams)
+	if len(innerList) < 2 || innerList[0] != '(' || innerList[len(innerList)-1] != ')' {
+		return nil, errors.New("signature input is not an inner list")
+	}
+
+	sig := &messageSignature{Label: label, Params: params, rawParams: rawParams}
+	for _, component := range splitOutside(innerList[1:len(innerList)-1], ' ') {
+		if component != "" {
+			sig.Components = append(sig.Components, component)
+		}
+	}
+
+	for _, member := range splitOutside(signature, ',') {
+		sigLabel, value, err := splitMember(member)
+		if err != nil {
+			return nil, err
+		}
+		if sigLabel != label {
+			continue
+		}
+		if len(value) < 2 || value[0] != ':' || value[len(value)-1] != ':' {
+			return nil, errors.New("signature is not a byte sequence")
+		}
+		sig.Signature, err = base64.StdEncoding.DecodeString(value[1 : len(value)-1])
+		if err != nil {
+			return nil, err
+		}
+		return sig, nil
+	}
+
+	return nil, fmt.Errorf("no signature labelled %s", label)
+}
+
+// splitMember splits a member of a structured dictionary into its key and
+// value.
+func splitMember(member string) (string, string, error) {
+	member = strings.TrimSpace(member)
+	i := strings.Index(member, "=")
+	if i <= 0 {
+		return "", "", errors.New("dictionary member malformed")
+	}
+	return member[:i], member[i+1:], nil
+}
+
+// splitParams splits an item into its value and parameters, such as
+// `"@query-param";name="id"`. String parameters are unquoted.
+func splitParams(item string) (string, map[string]string) {
+	parts := splitOutside(item, ';')
+	params := make(map[string]string)
+	for _, param := range parts[1:] {
+		param = strings.TrimSpace(param)
+		i := strings.Index(param, "=")
+		if i < 0 {
+			params[param] = "?1"
+			continue
+		}
+		value := param[i+1:]
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		params[param[:i]] = value
+	}
+	return strings.TrimSpace(parts[0]), params
+}
+
+// splitOutside splits s around sep, except within strings and inner lists.
+func splitOutside(s string, sep byte) []string {
+	var parts []string
+	inString, depth, start := false, 0, 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case inString && c == '\\':
+			i++
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
@@ -3,6 +3,7 @@ package gateway
 import (
 	"crypto/hmac"
 	"crypto/sha1"
+	"crypto/sha256"
 	"crypto/sha512"
 	"encoding/base64"
 	"fmt"
@@ -63,7 +64,7 @@ func getHMACAuthChain(spec *APISpec) http.Handler {
 	proxyHandler := ProxyHandler(proxy, spec)
 	baseMid := BaseMiddleware{Spec: spec, Proxy: proxy}
 	chain := alice.New(mwList(
-		&IPWhiteListMiddleware{baseMid},
+		&IPWhiteListMiddleware{BaseMiddleware: baseMid},
 		&IPBlackListMiddleware{BaseMiddleware: baseMid},
 		&HMACMiddleware{BaseMiddleware: baseMid},
 		&VersionCheck{BaseMiddleware: baseMid},
@@ -543,3 +544,66 @@ func TestHMACAuthSessionPassWithHeaderFieldLowerCase(t *testing.T) {
 		t.Error("Request should not have generated an AuthFailure event!: \n")
 	}
 }
+
+func TestHMACMessageSignature(t *testing.T) {
+	spec := CreateSpecTest(t, hmacAuthDef)
+	session := createHMACAuthSession()
+	spec.SessionManager.UpdateSession("9876", session, 60, false)
+	chain := getHMACAuthChain(spec)
+
+	now := time.Now()
+	date := now.Format("Mon, 02 Jan 2006 15:04:05 MST")
+
+	sign := func(params, base string) string {
+		h := hmac.New(sha256.New, []byte(session.HmacSecret))
+		h.Write([]byte(base + `"@signature-params": ` + params))
+		return "sig1=:" + base64.StdEncoding.EncodeToString(h.Sum(nil)) + ":"
+	}
+
+	validParams := fmt.Sprintf(`("@method" "@path" "@query-param";name="q" "date" "x-test");created=%d;keyid="9876";alg="hmac-sha256"`, now.Unix())
+	validBase := "\"@method\": GET\n" +
+		"\"@path\": /orders\n" +
+		"\"@query-param\";name=\"q\": a%2Fb\n" +
+		"\"date\": " + date + "\n" +
+		"\"x-test\": hello, world\n"
+
+	for _, tc := range []struct {
+		name     string
+		method   string
+		params   string
+		base     string
+		expected int
+	}{
+		{"Valid", "GET", validParams, validBase, 200},
+		{"Tampered", "POST", validParams, validBase, 400},
+		{"Not covering the method", "GET",
+			fmt.Sprintf(`("@path");created=%d;keyid="9876"`, now.Unix()),
+			"\"@path\": /orders\n", 400},
+		{"Missing created", "GET", `("@method" "@path");keyid="9876"`,
+			"\"@method\": GET\n\"@path\": /orders\n", 400},
+		{"Expired", "GET",
+			fmt.Sprintf(`("@method" "@path");created=%d;expires=%d;keyid="9876"`, now.Unix()-10, now.Unix()-1),
+			"\"@method\": GET\n\"@path\": /orders\n", 400},
+		{"Unknown key", "GET",
+			fmt.Sprintf(`("@method" "@path");created=%d;keyid="1234"`, now.Unix()),
+			"\"@method\": GET\n\"@path\": /orders\n", 400},
+		{"Unsupported algorithm", "GET",
+			fmt.Sprintf(`("@method" "@path");created=%d;keyid="9876";alg="rsa-pss-sha512"`, now.Unix()),
+			"\"@method\": GET\n\"@path\": /orders\n", 400},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := TestReq(t, tc.method, "/orders?q=a/b", nil)
+			req.Header.Set("Date", date)
+			req.Header.Add("X-Test", "hello ")
+			req.Header.Add("X-Test", " world")
+			req.Header.Set("Signature-Input", "sig1="+tc.params)
+			req.Header.Set("Signature", sign(tc.params, tc.base))
+
+			recorder := httptest.NewRecorder()
+			chain.ServeHTTP(recorder, req)
+			if recorder.Code != tc.expected {
+				t.Errorf("Expected %d, got %d: %s", tc.expected, recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+}
@@ -11,6 +11,7 @@ import (
 // IPBlackListMiddleware lets you define a list of IPs to block from upstream
 type IPBlackListMiddleware struct {
 	BaseMiddleware
+	blocked *ipTree
 }
 
 func (i *IPBlackListMiddleware) Name() string {
@@ -18,7 +19,11 @@ func (i *IPBlackListMiddleware) Name() string {
 }
 
 func (i *IPBlackListMiddleware) EnabledForSpec() bool {
-	return i.Spec.EnableIpBlacklisting && len(i.Spec.BlacklistedIPs) > 0
+	return i.Spec.EnableIpBlacklisting && (len(i.Spec.BlacklistedIPs) > 0 || len(i.Spec.BlacklistedIPLists) > 0)
+}
+
+func (i *IPBlackListMiddleware) Init() {
+	i.blocked = loadIPTree(i.Spec.BlacklistedIPs, i.Spec.BlacklistedIPLists)
 }
 
 // ProcessRequest will run any checks on the request on the way through the system, return an error to have the chain fail
@@ -26,24 +31,8 @@ func (i *IPBlackListMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Re
 	remoteIP := net.ParseIP(request.RealIP(r))
 
 	// Enabled, check incoming IP address
-	for _, ip := range i.Spec.BlacklistedIPs {
-		// Might be CIDR, try this one first then fallback to IP parsing later
-		blockedIP, blockedNet, err := net.ParseCIDR(ip)
-		if err != nil {
-			blockedIP = net.ParseIP(ip)
-		}
-
-		// Check CIDR if possible
-		if blockedNet != nil && blockedNet.Contains(remoteIP) {
-
-			return i.handleError(r, remoteIP.String())
-		}
-
-		// We parse the IP to manage IPv4 and IPv6 easily
-		if blockedIP.Equal(remoteIP) {
-
-			return i.handleError(r, remoteIP.String())
-		}
+	if i.blocked.Contains(remoteIP) {
+		return i.handleError(r, remoteIP.String())
 	}
 
 	return nil, http.StatusOK
@@ -37,6 +37,7 @@ func TestIPBlacklistMiddleware(t *testing.T) {
 
 		mw := &IPBlackListMiddleware{}
 		mw.Spec = spec
+		mw.Init()
 		_, code := mw.ProcessRequest(rec, req, nil)
 
 		if code != tc.wantCode {
@@ -53,6 +54,7 @@ func BenchmarkIPBlacklistMiddleware(b *testing.B) {
 
 	mw := &IPBlackListMiddleware{}
 	mw.Spec = spec
+	mw.Init()
 
 	rec := httptest.NewRecorder()
 	for i := 0; i < b.N; i++ {
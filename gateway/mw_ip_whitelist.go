@@ -11,6 +11,7 @@ import (
 // IPWhiteListMiddleware lets you define a list of IPs to allow upstream
 type IPWhiteListMiddleware struct {
 	BaseMiddleware
+	allowed *ipTree
 }
 
 func (i *IPWhiteListMiddleware) Name() string {
@@ -18,7 +19,11 @@ func (i *IPWhiteListMiddleware) Name() string {
 }
 
 func (i *IPWhiteListMiddleware) EnabledForSpec() bool {
-	return i.Spec.EnableIpWhiteListing && len(i.Spec.AllowedIPs) > 0
+	return i.Spec.EnableIpWhiteListing && (len(i.Spec.AllowedIPs) > 0 || len(i.Spec.AllowedIPLists) > 0)
+}
+
+func (i *IPWhiteListMiddleware) Init() {
+	i.allowed = loadIPTree(i.Spec.AllowedIPs, i.Spec.AllowedIPLists)
 }
 
 // ProcessRequest will run any checks on the request on the way through the system, return an error to have the chain fail
@@ -26,24 +31,9 @@ func (i *IPWhiteListMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Re
 	remoteIP := net.ParseIP(request.RealIP(r))
 
 	// Enabled, check incoming IP address
-	for _, ip := range i.Spec.AllowedIPs {
-		// Might be CIDR, try this one first then fallback to IP parsing later
-		allowedIP, allowedNet, err := net.ParseCIDR(ip)
-		if err != nil {
-			allowedIP = net.ParseIP(ip)
-		}
-
-		// Check CIDR if possible
-		if allowedNet != nil && allowedNet.Contains(remoteIP) {
-			// matched, pass through
-			return nil, http.StatusOK
-		}
-
-		// We parse the IP to manage IPv4 and IPv6 easily
-		if allowedIP.Equal(remoteIP) {
-			// matched, pass through
-			return nil, http.StatusOK
-		}
+	if i.allowed.Contains(remoteIP) {
+		// matched, pass through
+		return nil, http.StatusOK
 	}
 
 	// Fire Authfailed Event
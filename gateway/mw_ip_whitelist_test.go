@@ -37,6 +37,7 @@ func TestIPMiddlewarePass(t *testing.T) {
 
 		mw := &IPWhiteListMiddleware{}
 		mw.Spec = spec
+		mw.Init()
 		_, code := mw.ProcessRequest(rec, req, nil)
 
 		if code != tc.wantCode {
@@ -52,6 +53,7 @@ func BenchmarkIPMiddlewarePass(b *testing.B) {
 	spec := testPrepareIPMiddlewarePass()
 	mw := &IPWhiteListMiddleware{}
 	mw.Spec = spec
+	mw.Init()
 
 	rec := httptest.NewRecorder()
 	for i := 0; i < b.N; i++ {
@@ -4,6 +4,7 @@ import (
 	"crypto/md5"
 	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"net/http"
@@ -14,6 +15,7 @@ import (
 	cache "github.com/pmylund/go-cache"
 
 	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/certs"
 	"github.com/TykTechnologies/tyk/user"
 )
 
@@ -55,14 +57,22 @@ type JWKs struct {
 }
 
 func (k *JWTMiddleware) getSecretFromURL(url, kid, keyType string) ([]byte, error) {
+	// Keys of imported JWKS are kept in the certificate storage
+	if jwks := CertificateManager.JWKSImport(url); jwks != nil {
+		return jwks.PublicKeyPEM(kid)
+	}
+
 	// Implement a cache
 	if JWKCache == nil {
 		k.Logger().Debug("Creating JWK Cache")
 		JWKCache = cache.New(240*time.Second, 30*time.Second)
 	}
 
+	// APIs may trust several issuers, each with its own JWKS
+	cacheKey := k.Spec.APIID + url
+
 	var jwkSet JWKs
-	cachedJWK, found := JWKCache.Get(k.Spec.APIID)
+	cachedJWK, found := JWKCache.Get(cacheKey)
 	if !found {
 		// Get the JWK
 		k.Logger().Debug("Pulling JWK")
@@ -81,7 +91,7 @@ func (k *JWTMiddleware) getSecretFromURL(url, kid, keyType string) ([]byte, erro
 
 		// Cache it
 		k.Logger().Debug("Caching JWK")
-		JWKCache.Set(k.Spec.APIID, jwkSet, cache.DefaultExpiration)
+		JWKCache.Set(cacheKey, jwkSet, cache.DefaultExpiration)
 	} else {
 		jwkSet = cachedJWK.(JWKs)
 	}
@@ -107,7 +117,87 @@ func (k *JWTMiddleware) getSecretFromURL(url, kid, keyType string) ([]byte, erro
 	return nil, errors.New("No matching KID could be found")
 }
 
-func (k *JWTMiddleware) getIdentityFromToken(token *jwt.Token) (string, error) {
+// defaultIssuer holds JWT settings of the API definition, used when the API
+// doesn't list issuers.
+func (k *JWTMiddleware) defaultIssuer() *apidef.JWTIssuer {
+	return &apidef.JWTIssuer{
+		Source:               k.Spec.JWTSource,
+		SigningMethod:        k.Spec.JWTSigningMethod,
+		IdentityBaseField:    k.Spec.JWTIdentityBaseField,
+		ClientIDBaseField:    k.Spec.JWTClientIDBaseField,
+		PolicyFieldName:      k.Spec.JWTPolicyFieldName,
+		DefaultPolicies:      k.Spec.JWTDefaultPolicies,
+		ScopeClaimName:       k.Spec.JWTScopeClaimName,
+		ScopeToPolicyMapping: k.Spec.JWTScopeToPolicyMapping,
+	}
+}
+
+// getIssuer returns settings of the issuer of the token, which must be one
+// of the issuers listed by the API, if any.
+func (k *JWTMiddleware) getIssuer(token *jwt.Token) (*apidef.JWTIssuer, error) {
+	if len(k.Spec.JWTIssuers) == 0 {
+		return k.defaultIssuer(), nil
+	}
+
+	iss, _ := token.Claims.(jwt.MapClaims)["iss"].(string)
+	for i := range k.Spec.JWTIssuers {
+		if k.Spec.JWTIssuers[i].Issuer == iss {
+			return &k.Spec.JWTIssuers[i], nil
+		}
+	}
+	return nil, fmt.Errorf("issuer %q is not trusted", iss)
+}
+
+// publicKeyPEM returns the public key or certificate stored as certID in PEM.
+func publicKeyPEM(certID string) ([]byte, error) {
+	list := CertificateManager.List([]string{certID}, certs.CertificateAny)
+	if len(list) == 0 || list[0] == nil {
+		return nil, errors.New("certificate not found: " + certID)
+	}
+
+	cert := list[0]
+	blockType := "CERTIFICATE"
+	if cert.Leaf != nil && strings.HasPrefix(cert.Leaf.Subject.CommonName, "Public Key: ") {
+		blockType = "PUBLIC KEY"
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: cert.Certificate[0]}), nil
+}
+
+// isCentralised tells if the issuer's tokens are checked against its keys,
+// rather than keys of sessions.
+func isCentralised(issuer *apidef.JWTIssuer) bool {
+	return issuer.Source != "" || issuer.CertificateID != ""
+}
+
+// validateAudience checks the token is meant for one of audiences, if any.
+func validateAudience(claims jwt.MapClaims, audiences []string) bool {
+	if len(audiences) == 0 {
+		return true
+	}
+
+	var tokenAudiences []string
+	switch aud := claims["aud"].(type) {
+	case string:
+		tokenAudiences = []string{aud}
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				tokenAudiences = append(tokenAudiences, s)
+			}
+		}
+	}
+
+	for _, aud := range tokenAudiences {
+		for _, accepted := range audiences {
+			if aud == accepted {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (k *JWTMiddleware) getIdentityFromToken(token *jwt.Token, issuer *apidef.JWTIssuer) (string, error) {
 	// Check which claim is used for the id - kid or sub header
 	// If is not supposed to ignore KID - will use this as ID if not empty
 	if !k.Spec.APIDefinition.JWTSkipKid {
@@ -117,17 +207,23 @@ func (k *JWTMiddleware) getIdentityFromToken(token *jwt.Token) (string, error) {
 		}
 	}
 	// In case KID was empty or was set to ignore KID ==> Will try to get the Id from JWTIdentityBaseField or fallback to 'sub'
-	tykId, err := k.getUserIdFromClaim(token.Claims.(jwt.MapClaims))
+	tykId, err := k.getUserIdFromClaim(token.Claims.(jwt.MapClaims), issuer)
 	return tykId, err
 }
 
-func (k *JWTMiddleware) getSecretToVerifySignature(r *http.Request, token *jwt.Token) ([]byte, error) {
-	config := k.Spec.APIDefinition
+func (k *JWTMiddleware) getSecretToVerifySignature(r *http.Request, token *jwt.Token, issuer *apidef.JWTIssuer) ([]byte, error) {
+	kid, _ := token.Header[KID].(string)
+
+	// Key of the issuer is kept in the certificate storage
+	if issuer.CertificateID != "" {
+		return publicKeyPEM(issuer.CertificateID)
+	}
+
 	// Check for central JWT source
-	if config.JWTSource != "" {
+	if issuer.Source != "" {
 		// Is it a URL?
-		if httpScheme.MatchString(config.JWTSource) {
-			secret, err := k.getSecretFromURL(config.JWTSource, token.Header[KID].(string), k.Spec.JWTSigningMethod)
+		if httpScheme.MatchString(issuer.Source) {
+			secret, err := k.getSecretFromURL(issuer.Source, kid, issuer.SigningMethod)
 			if err != nil {
 				return nil, err
 			}
@@ -136,14 +232,14 @@ func (k *JWTMiddleware) getSecretToVerifySignature(r *http.Request, token *jwt.T
 		}
 
 		// If not, return the actual value
-		decodedCert, err := base64.StdEncoding.DecodeString(config.JWTSource)
+		decodedCert, err := base64.StdEncoding.DecodeString(issuer.Source)
 		if err != nil {
 			return nil, err
 		}
 
 		// Is decoded url too?
 		if httpScheme.MatchString(string(decodedCert)) {
-			secret, err := k.getSecretFromURL(string(decodedCert), token.Header[KID].(string), k.Spec.JWTSigningMethod)
+			secret, err := k.getSecretFromURL(string(decodedCert), kid, issuer.SigningMethod)
 			if err != nil {
 				return nil, err
 			}
@@ -157,7 +253,7 @@ func (k *JWTMiddleware) getSecretToVerifySignature(r *http.Request, token *jwt.T
 	// If we are here, there's no central JWT source
 
 	// Get the ID from the token (in KID header or configured claim or SUB claim)
-	tykId, err := k.getIdentityFromToken(token)
+	tykId, err := k.getIdentityFromToken(token, issuer)
 	if err != nil {
 		return nil, err
 	}
@@ -171,8 +267,8 @@ func (k *JWTMiddleware) getSecretToVerifySignature(r *http.Request, token *jwt.T
 	return []byte(session.JWTData.Secret), nil
 }
 
-func (k *JWTMiddleware) getPolicyIDFromToken(claims jwt.MapClaims) (string, bool) {
-	policyID, foundPolicy := claims[k.Spec.JWTPolicyFieldName].(string)
+func (k *JWTMiddleware) getPolicyIDFromToken(claims jwt.MapClaims, issuer *apidef.JWTIssuer) (string, bool) {
+	policyID, foundPolicy := claims[issuer.PolicyFieldName].(string)
 	if !foundPolicy {
 		k.Logger().Error("Could not identify a policy to apply to this token from field")
 		return "", false
@@ -186,12 +282,12 @@ func (k *JWTMiddleware) getPolicyIDFromToken(claims jwt.MapClaims) (string, bool
 	return policyID, true
 }
 
-func (k *JWTMiddleware) getBasePolicyID(r *http.Request, claims jwt.MapClaims) (policyID string, found bool) {
-	if k.Spec.JWTPolicyFieldName != "" {
-		policyID, found = k.getPolicyIDFromToken(claims)
+func (k *JWTMiddleware) getBasePolicyID(r *http.Request, claims jwt.MapClaims, issuer *apidef.JWTIssuer) (policyID string, found bool) {
+	if issuer.PolicyFieldName != "" {
+		policyID, found = k.getPolicyIDFromToken(claims, issuer)
 		return
-	} else if k.Spec.JWTClientIDBaseField != "" {
-		clientID, clientIDFound := claims[k.Spec.JWTClientIDBaseField].(string)
+	} else if issuer.ClientIDBaseField != "" {
+		clientID, clientIDFound := claims[issuer.ClientIDBaseField].(string)
 		if !clientIDFound {
 			k.Logger().Error("Could not identify a policy to apply to this token from field")
 			return
@@ -215,23 +311,23 @@ func (k *JWTMiddleware) getBasePolicyID(r *http.Request, claims jwt.MapClaims) (
 	return
 }
 
-func (k *JWTMiddleware) getUserIdFromClaim(claims jwt.MapClaims) (string, error) {
+func (k *JWTMiddleware) getUserIdFromClaim(claims jwt.MapClaims, issuer *apidef.JWTIssuer) (string, error) {
 	var userId string
 	var found = false
 
-	if k.Spec.JWTIdentityBaseField != "" {
-		if userId, found = claims[k.Spec.JWTIdentityBaseField].(string); found {
+	if issuer.IdentityBaseField != "" {
+		if userId, found = claims[issuer.IdentityBaseField].(string); found {
 			if len(userId) > 0 {
 				k.Logger().WithField("userId", userId).Debug("Found User Id in Base Field")
 				return userId, nil
 			}
-			message := "found an empty user ID in predefined base field claim " + k.Spec.JWTIdentityBaseField
+			message := "found an empty user ID in predefined base field claim " + issuer.IdentityBaseField
 			k.Logger().Error(message)
 			return "", errors.New(message)
 		}
 
 		if !found {
-			k.Logger().WithField("Base Field", k.Spec.JWTIdentityBaseField).Warning("Base Field claim not found, trying to find user ID in 'sub' claim.")
+			k.Logger().WithField("Base Field", issuer.IdentityBaseField).Warning("Base Field claim not found, trying to find user ID in 'sub' claim.")
 		}
 	}
 
@@ -278,18 +374,18 @@ func mapScopeToPolicies(mapping map[string]string, scope []string) []string {
 }
 
 // processCentralisedJWT Will check a JWT token centrally against the secret stored in the API Definition.
-func (k *JWTMiddleware) processCentralisedJWT(r *http.Request, token *jwt.Token) (error, int) {
+func (k *JWTMiddleware) processCentralisedJWT(r *http.Request, token *jwt.Token, issuer *apidef.JWTIssuer) (error, int) {
 	k.Logger().Debug("JWT authority is centralised")
 
 	claims := token.Claims.(jwt.MapClaims)
-	baseFieldData, err := k.getUserIdFromClaim(claims)
+	baseFieldData, err := k.getUserIdFromClaim(claims, issuer)
 	if err != nil {
 		k.reportLoginFailure("[NOT FOUND]", r)
 		return err, http.StatusForbidden
 	}
 
-	// Generate a virtual token
-	data := []byte(baseFieldData)
+	// Generate a virtual token, users of issuers are told apart
+	data := []byte(issuer.Issuer + baseFieldData)
 	keyID := fmt.Sprintf("%x", md5.Sum(data))
 	sessionID := generateToken(k.Spec.OrgID, keyID)
 	updateSession := false
@@ -312,14 +408,14 @@ func (k *JWTMiddleware) processCentralisedJWT(r *http.Request, token *jwt.Token)
 		k.Logger().Debug("Key does not exist, creating")
 
 		// We need a base policy as a template, either get it from the token itself OR a proxy client ID within Tyk
-		basePolicyID, foundPolicy := k.getBasePolicyID(r, claims)
+		basePolicyID, foundPolicy := k.getBasePolicyID(r, claims, issuer)
 		if !foundPolicy {
-			if len(k.Spec.JWTDefaultPolicies) == 0 {
+			if len(issuer.DefaultPolicies) == 0 {
 				k.reportLoginFailure(baseFieldData, r)
 				return errors.New("key not authorized: no matching policy found"), http.StatusForbidden
 			} else {
 				isDefaultPol = true
-				basePolicyID = k.Spec.JWTDefaultPolicies[0]
+				basePolicyID = issuer.DefaultPolicies[0]
 			}
 		}
 
@@ -329,7 +425,7 @@ func (k *JWTMiddleware) processCentralisedJWT(r *http.Request, token *jwt.Token)
 
 		// If base policy is one of the defaults, apply other ones as well
 		if isDefaultPol {
-			for _, pol := range k.Spec.JWTDefaultPolicies {
+			for _, pol := range issuer.DefaultPolicies {
 				if !contains(session.ApplyPolicies, pol) {
 					session.ApplyPolicies = append(session.ApplyPolicies, pol)
 				}
@@ -341,8 +437,8 @@ func (k *JWTMiddleware) processCentralisedJWT(r *http.Request, token *jwt.Token)
 		}
 
 		// apply policies from scope if scope-to-policy mapping is specified for this API
-		if len(k.Spec.JWTScopeToPolicyMapping) != 0 {
-			scopeClaimName := k.Spec.JWTScopeClaimName
+		if len(issuer.ScopeToPolicyMapping) != 0 {
+			scopeClaimName := issuer.ScopeClaimName
 			if scopeClaimName == "" {
 				scopeClaimName = "scope"
 			}
@@ -353,7 +449,7 @@ func (k *JWTMiddleware) processCentralisedJWT(r *http.Request, token *jwt.Token)
 				}
 
 				// add all policies matched from scope-policy mapping
-				mappedPolIDs := mapScopeToPolicies(k.Spec.JWTScopeToPolicyMapping, scope)
+				mappedPolIDs := mapScopeToPolicies(issuer.ScopeToPolicyMapping, scope)
 
 				polIDs = append(polIDs, mappedPolIDs...)
 				session.SetPolicies(polIDs...)
@@ -388,14 +484,14 @@ func (k *JWTMiddleware) processCentralisedJWT(r *http.Request, token *jwt.Token)
 		k.Logger().Debug("Policy applied to key")
 	} else {
 		// extract policy ID from JWT token
-		policyID, foundPolicy := k.getBasePolicyID(r, claims)
+		policyID, foundPolicy := k.getBasePolicyID(r, claims, issuer)
 		if !foundPolicy {
-			if len(k.Spec.JWTDefaultPolicies) == 0 {
+			if len(issuer.DefaultPolicies) == 0 {
 				k.reportLoginFailure(baseFieldData, r)
 				return errors.New("key not authorized: no matching policy found"), http.StatusForbidden
 			} else {
 				isDefaultPol = true
-				policyID = k.Spec.JWTDefaultPolicies[0]
+				policyID = issuer.DefaultPolicies[0]
 			}
 		}
 		// check if we received a valid policy ID in claim
@@ -421,12 +517,12 @@ func (k *JWTMiddleware) processCentralisedJWT(r *http.Request, token *jwt.Token)
 			// check a policy is removed/added from/to default policies
 
 			for _, pol := range session.PolicyIDs() {
-				if !contains(k.Spec.JWTDefaultPolicies, pol) && policyID != pol {
+				if !contains(issuer.DefaultPolicies, pol) && policyID != pol {
 					defaultPolicyListChanged = true
 				}
 			}
 
-			for _, defPol := range k.Spec.JWTDefaultPolicies {
+			for _, defPol := range issuer.DefaultPolicies {
 				if !contains(session.PolicyIDs(), defPol) {
 					defaultPolicyListChanged = true
 				}
@@ -444,7 +540,7 @@ func (k *JWTMiddleware) processCentralisedJWT(r *http.Request, token *jwt.Token)
 			session.SetPolicies(policyID)
 
 			if isDefaultPol {
-				for _, pol := range k.Spec.JWTDefaultPolicies {
+				for _, pol := range issuer.DefaultPolicies {
 					if !contains(session.ApplyPolicies, pol) {
 						session.ApplyPolicies = append(session.ApplyPolicies, pol)
 					}
@@ -489,9 +585,9 @@ func (k *JWTMiddleware) reportLoginFailure(tykId string, r *http.Request) {
 	reportHealthValue(k.Spec, KeyFailure, "1")
 }
 
-func (k *JWTMiddleware) processOneToOneTokenMap(r *http.Request, token *jwt.Token) (error, int) {
+func (k *JWTMiddleware) processOneToOneTokenMap(r *http.Request, token *jwt.Token, issuer *apidef.JWTIssuer) (error, int) {
 	// Get the ID from the token
-	tykId, err := k.getIdentityFromToken(token)
+	tykId, err := k.getIdentityFromToken(token, issuer)
 	if err != nil {
 		k.reportLoginFailure(tykId, r)
 		return err, http.StatusNotFound
@@ -504,6 +600,10 @@ func (k *JWTMiddleware) processOneToOneTokenMap(r *http.Request, token *jwt.Toke
 		return errors.New("Key not authorized"), http.StatusForbidden
 	}
 
+	if err := checkSessionBinding(r, &session); err != nil {
+		return tokenBindingFailure(k, r, tykId, err)
+	}
+
 	k.Logger().Debug("Raw key ID found.")
 	ctxSetSession(r, &session, tykId, false)
 	ctxSetJWTContextVars(k.Spec, r, token)
@@ -550,9 +650,15 @@ func (k *JWTMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request, _
 	parser := &jwt.Parser{SkipClaimsValidation: true}
 
 	// Verify the token
+	var issuer *apidef.JWTIssuer
 	token, err := parser.Parse(rawJWT, func(token *jwt.Token) (interface{}, error) {
+		var err error
+		if issuer, err = k.getIssuer(token); err != nil {
+			return nil, err
+		}
+
 		// Don't forget to validate the alg is what you expect:
-		switch k.Spec.JWTSigningMethod {
+		switch issuer.SigningMethod {
 		case HMACSign:
 			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 				return nil, fmt.Errorf("Unexpected signing method: %v and not HMAC signature", token.Header["alg"])
@@ -572,13 +678,13 @@ func (k *JWTMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request, _
 			}
 		}
 
-		val, err := k.getSecretToVerifySignature(r, token)
+		val, err := k.getSecretToVerifySignature(r, token, issuer)
 		if err != nil {
 			k.Logger().WithError(err).Error("Couldn't get token")
 			return nil, err
 		}
 
-		if k.Spec.JWTSigningMethod == RSASign {
+		if issuer.SigningMethod == RSASign {
 			asRSA, err := jwt.ParseRSAPublicKeyFromPEM(val)
 			if err != nil {
 				logger.WithError(err).Error("Failed to decode JWT to RSA type")
@@ -595,15 +701,24 @@ func (k *JWTMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request, _
 			return errors.New("Key not authorized: " + jwtErr.Error()), http.StatusUnauthorized
 		}
 
+		if !validateAudience(token.Claims.(jwt.MapClaims), issuer.Audiences) {
+			k.reportLoginFailure(tykId, r)
+			return errors.New("Key not authorized: token audience is not accepted"), http.StatusForbidden
+		}
+
+		if err := checkConfirmationClaim(r, token.Claims.(jwt.MapClaims)); err != nil {
+			return tokenBindingFailure(k, r, tykId, err)
+		}
+
 		// Token is valid - let's move on
 
 		// Are we mapping to a central JWT Secret?
-		if k.Spec.JWTSource != "" {
-			return k.processCentralisedJWT(r, token)
+		if isCentralised(issuer) {
+			return k.processCentralisedJWT(r, token, issuer)
 		}
 
 		// No, let's try one-to-one mapping
-		return k.processOneToOneTokenMap(r, token)
+		return k.processOneToOneTokenMap(r, token, issuer)
 	}
 
 	logger.Info("Attempted JWT access with non-existent key.")
@@ -693,8 +808,12 @@ func generateSessionFromPolicy(policyID, orgID string, enforceOrg bool) (user.Se
 	session.Allowance = policy.Rate // This is a legacy thing, merely to make sure output is consistent. Needs to be purged
 	session.Rate = policy.Rate
 	session.Per = policy.Per
+	session.Burst = policy.Burst
 	session.ThrottleInterval = policy.ThrottleInterval
 	session.ThrottleRetryLimit = policy.ThrottleRetryLimit
+	session.ThrottleQueueSize = policy.ThrottleQueueSize
+	session.ThrottleMaxWait = policy.ThrottleMaxWait
+	session.MaxConcurrent = policy.MaxConcurrent
 	session.QuotaMax = policy.QuotaMax
 	session.QuotaRenewalRate = policy.QuotaRenewalRate
 	session.AccessRights = make(map[string]user.AccessDefinition)
@@ -2,10 +2,13 @@ package gateway
 
 import (
 	"crypto/md5"
+	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
 	"time"
@@ -13,6 +16,8 @@ import (
 	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/lonelycode/go-uuid/uuid"
 
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/certs"
 	"github.com/TykTechnologies/tyk/test"
 	"github.com/TykTechnologies/tyk/user"
 )
@@ -1181,6 +1186,47 @@ func TestJWTSessionRSAWithJWK(t *testing.T) {
 	})
 }
 
+func TestJWTSessionRSAWithImportedJWKS(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	block, _ := pem.Decode([]byte(jwtRSAPubKey))
+	key, _ := certs.NewJSONWebKey(&tls.Certificate{Certificate: [][]byte{block.Bytes}})
+	key.Kid = "imported"
+
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(certs.JSONWebKeySet{Keys: []certs.JSONWebKey{*key}})
+	}))
+	defer jwks.Close()
+
+	CertificateManager.ImportJWKS(jwks.URL, "", 0, 0)
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.UseKeylessAccess = false
+		spec.EnableJWT = true
+		spec.JWTSigningMethod = RSASign
+		spec.JWTSource = jwks.URL
+		spec.JWTIdentityBaseField = "user_id"
+		spec.JWTPolicyFieldName = "policy_id"
+		spec.Proxy.ListenPath = "/"
+	})
+
+	pID := CreatePolicy()
+	token := func(kid string) map[string]string {
+		return map[string]string{"authorization": CreateJWKToken(func(t *jwt.Token) {
+			t.Header["kid"] = kid
+			t.Claims.(jwt.MapClaims)["user_id"] = "user"
+			t.Claims.(jwt.MapClaims)["policy_id"] = pID
+			t.Claims.(jwt.MapClaims)["exp"] = time.Now().Add(time.Hour).Unix()
+		})}
+	}
+
+	ts.Run(t, []test.TestCase{
+		{Headers: token("imported"), Code: http.StatusOK},
+		{Headers: token("unknown"), Code: http.StatusForbidden},
+	}...)
+}
+
 func BenchmarkJWTSessionRSAWithJWK(b *testing.B) {
 	b.ReportAllocs()
 
@@ -1820,3 +1866,82 @@ func TestJWTExpOverride(t *testing.T) {
 	})
 
 }
+
+func TestJWTMultipleIssuers(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	const apiID = "jwt-issuers"
+
+	block, _ := pem.Decode([]byte(jwtRSAPubKey))
+	certID := certs.HexSHA256(block.Bytes)
+	CertificateManager.Add([]byte(jwtRSAPubKey), "")
+	defer CertificateManager.Delete(certID)
+
+	allowed := CreatePolicy(func(p *user.Policy) {
+		p.AccessRights = map[string]user.AccessDefinition{apiID: {APIID: apiID}}
+	})
+	other := CreatePolicy(func(p *user.Policy) {
+		p.AccessRights = map[string]user.AccessDefinition{"other": {APIID: "other"}}
+	})
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = apiID
+		spec.UseKeylessAccess = false
+		spec.EnableJWT = true
+		spec.Proxy.ListenPath = "/"
+		spec.JWTIssuers = []apidef.JWTIssuer{
+			{
+				Issuer:            "https://rsa.example.com",
+				CertificateID:     certID,
+				SigningMethod:     RSASign,
+				Audiences:         []string{"tyk"},
+				IdentityBaseField: "user_id",
+				PolicyFieldName:   "policy_id",
+			},
+			{
+				Issuer:          "https://hmac.example.com",
+				Source:          base64.StdEncoding.EncodeToString([]byte(jwtSecret)),
+				SigningMethod:   HMACSign,
+				DefaultPolicies: []string{allowed},
+			},
+			{
+				Issuer:          "https://other.example.com",
+				Source:          base64.StdEncoding.EncodeToString([]byte(jwtSecret)),
+				SigningMethod:   HMACSign,
+				DefaultPolicies: []string{other},
+			},
+		}
+	})
+
+	rsaToken := func(aud interface{}) map[string]string {
+		return map[string]string{"Authorization": CreateJWKToken(func(t *jwt.Token) {
+			t.Claims.(jwt.MapClaims)["iss"] = "https://rsa.example.com"
+			t.Claims.(jwt.MapClaims)["aud"] = aud
+			t.Claims.(jwt.MapClaims)["user_id"] = "user"
+			t.Claims.(jwt.MapClaims)["policy_id"] = allowed
+			t.Claims.(jwt.MapClaims)["exp"] = time.Now().Add(time.Hour).Unix()
+		})}
+	}
+	hmacToken := func(iss string) map[string]string {
+		return map[string]string{"Authorization": createJWKTokenHMAC(func(t *jwt.Token) {
+			t.Claims.(jwt.MapClaims)["iss"] = iss
+			t.Claims.(jwt.MapClaims)["sub"] = "user"
+			// Ignored, the issuer doesn't map claims to policies
+			t.Claims.(jwt.MapClaims)["policy_id"] = allowed
+			t.Claims.(jwt.MapClaims)["exp"] = time.Now().Add(time.Hour).Unix()
+		})}
+	}
+
+	ts.Run(t, []test.TestCase{
+		{Headers: rsaToken("tyk"), Code: http.StatusOK},
+		{Headers: rsaToken([]string{"other", "tyk"}), Code: http.StatusOK},
+		{Headers: rsaToken("other"), Code: http.StatusForbidden},
+		{Headers: hmacToken("https://hmac.example.com"), Code: http.StatusOK},
+		// Policies are mapped per issuer
+		{Headers: hmacToken("https://other.example.com"), Code: http.StatusForbidden},
+		// Signing method is checked per issuer
+		{Headers: hmacToken("https://rsa.example.com"), Code: http.StatusForbidden},
+		{Headers: hmacToken("https://unknown.example.com"), Code: http.StatusForbidden},
+	}...)
+}
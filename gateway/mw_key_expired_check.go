@@ -42,6 +42,7 @@ func (k *KeyExpired) ProcessRequest(w http.ResponseWriter, r *http.Request, _ in
 	}
 
 	if !k.Spec.AuthManager.KeyExpired(session) {
+		recordKeyUsage(token)
 		return nil, http.StatusOK
 	}
 	logger.Info("Attempted access from expired key.")
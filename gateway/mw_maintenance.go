@@ -0,0 +1,160 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/storage"
+)
+
+// maintenanceStore keeps the maintenance settings toggled through the API of
+// the gateway by API ID, for them to last across reloads. They override those
+// of the definitions.
+var maintenanceStore storage.Handler = &storage.RedisCluster{KeyPrefix: "maintenance-"}
+
+const defaultMaintenanceBody = `{"error": "API is under maintenance"}`
+
+// MaintenanceMode answers the requests to an API in maintenance, before any
+// other middleware runs. It is always in the chain, for maintenance to be
+// toggled without reloading.
+type MaintenanceMode struct {
+	BaseMiddleware
+}
+
+func (m *MaintenanceMode) Name() string {
+	return "MaintenanceMode"
+}
+
+func (m *MaintenanceMode) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
+	conf := m.Spec.maintenanceMode()
+	if !conf.Enabled {
+		return nil, http.StatusOK
+	}
+
+	body := conf.Body
+	if body == "" {
+		body = defaultMaintenanceBody
+		w.Header().Set(headers.ContentType, headers.ApplicationJSON)
+	}
+	for name, value := range conf.Headers {
+		w.Header().Set(name, value)
+	}
+	if conf.RetryAfter > 0 {
+		w.Header().Set(headers.RetryAfter, strconv.FormatInt(conf.RetryAfter, 10))
+	}
+	w.WriteHeader(conf.StatusCode)
+	w.Write([]byte(body))
+	return nil, mwStatusRespond
+}
+
+// maintenanceMode returns the maintenance settings in effect for the API.
+func (s *APISpec) maintenanceMode() apidef.MaintenanceMeta {
+	conf, _ := s.maintenance.Load().(apidef.MaintenanceMeta)
+	return conf
+}
+
+func (s *APISpec) setMaintenanceMode(conf apidef.MaintenanceMeta) {
+	if conf.StatusCode == 0 {
+		conf.StatusCode = http.StatusServiceUnavailable
+	}
+	s.maintenance.Store(conf)
+}
+
+// loadMaintenanceMode sets the maintenance settings of the API, as last
+// toggled or from its definition.
+func loadMaintenanceMode(spec *APISpec) {
+	conf := spec.Maintenance
+	if value, err := maintenanceStore.GetKey(spec.APIID); err == nil {
+		if err := json.Unmarshal([]byte(value), &conf); err != nil {
+			log.WithField("api_id", spec.APIID).WithError(err).Error("Could not load maintenance settings")
+			conf = spec.Maintenance
+		}
+	}
+	spec.setMaintenanceMode(conf)
+}
+
+// maintenanceHandler toggles an API in and out of maintenance. Settings put
+// are kept until deleted, to fall back to those of the definition.
+func maintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	apiID := mux.Vars(r)["apiID"]
+	spec := getApiSpec(apiID)
+	if spec == nil {
+		doJSONWrite(w, http.StatusNotFound, apiError("API not found"))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var conf apidef.MaintenanceMeta
+		if err := json.NewDecoder(r.Body).Decode(&conf); err != nil {
+			doJSONWrite(w, http.StatusBadRequest, apiError("Request malformed"))
+			return
+		}
+		if conf.StatusCode != 0 && (conf.StatusCode < 100 || conf.StatusCode > 599) {
+			doJSONWrite(w, http.StatusBadRequest, apiError("Invalid status code"))
+			return
+		}
+		value, _ := json.Marshal(conf)
+		if err := maintenanceStore.SetKey(apiID, string(value), 0); err != nil {
+			doJSONWrite(w, http.StatusInternalServerError, apiError("Could not store maintenance settings"))
+			return
+		}
+		spec.setMaintenanceMode(conf)
+		notifyMaintenanceChanged(apiID)
+	case http.MethodDelete:
+		maintenanceStore.DeleteKey(apiID)
+		spec.setMaintenanceMode(spec.Maintenance)
+		notifyMaintenanceChanged(apiID)
+	}
+
+	conf := spec.maintenanceMode()
+	if r.Method != http.MethodGet {
+		log.WithFields(logrus.Fields{
+			"prefix": "api",
+			"api_id": apiID,
+		}).Info("Maintenance mode set to ", conf.Enabled)
+	}
+	doJSONWrite(w, http.StatusOK, conf)
+}
+
+// maintenanceNotification is published to other gateways when maintenance of
+// an API is toggled, for them to load the stored settings.
+type maintenanceNotification struct {
+	APIID  string `json:"api_id"`
+	NodeID string `json:"node_id"`
+}
+
+func notifyMaintenanceChanged(apiID string) {
+	payload, err := json.Marshal(maintenanceNotification{APIID: apiID, NodeID: getNodeID()})
+	if err != nil {
+		log.Error("Failed to encode maintenance notification: ", err)
+		return
+	}
+
+	MainNotifier.Notify(Notification{Command: NoticeMaintenanceChanged, Payload: string(payload)})
+}
+
+// handleMaintenanceChanged applies maintenance settings toggled on another
+// gateway.
+func handleMaintenanceChanged(payload string) {
+	var notif maintenanceNotification
+	if err := json.Unmarshal([]byte(payload), &notif); err != nil {
+		pubSubLog.Error("Failed to decode maintenance notification: ", err)
+		return
+	}
+
+	// Changes made by this node are already applied
+	if notif.NodeID == getNodeID() {
+		return
+	}
+
+	if spec := getApiSpec(notif.APIID); spec != nil {
+		loadMaintenanceMode(spec)
+	}
+}
@@ -0,0 +1,90 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/garyburd/redigo/redis"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	maintenanceStore.DeleteKey("test")
+	defer maintenanceStore.DeleteKey("test")
+
+	t.Run("From definition", func(t *testing.T) {
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.Proxy.ListenPath = "/"
+			spec.Maintenance = apidef.MaintenanceMeta{Enabled: true, RetryAfter: 60}
+		})
+
+		ts.Run(t, test.TestCase{
+			Path:      "/",
+			Code:      http.StatusServiceUnavailable,
+			BodyMatch: "API is under maintenance",
+			HeadersMatch: map[string]string{
+				headers.RetryAfter:  "60",
+				headers.ContentType: headers.ApplicationJSON,
+			},
+		})
+	})
+
+	t.Run("Toggled", func(t *testing.T) {
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.Proxy.ListenPath = "/"
+		})
+
+		ts.Run(t, []test.TestCase{
+			{Path: "/", Code: http.StatusOK},
+			{Method: http.MethodPut, Path: "/tyk/apis/test/maintenance", AdminAuth: true,
+				Data: `{"enabled": true, "status_code": 999}`, Code: http.StatusBadRequest},
+			{Method: http.MethodPut, Path: "/tyk/apis/test/maintenance", AdminAuth: true,
+				Data: `{"enabled": true, "status_code": 502, "body": "back soon", "headers": {"X-Maintenance": "1"}}`,
+				Code: http.StatusOK},
+			{Path: "/", Code: http.StatusBadGateway, BodyMatch: "back soon",
+				HeadersMatch: map[string]string{"X-Maintenance": "1"}},
+			{Method: http.MethodGet, Path: "/tyk/apis/test/maintenance", AdminAuth: true,
+				Code: http.StatusOK, BodyMatch: `"enabled":true`},
+		}...)
+
+		// Toggled settings last across reloads, until deleted
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.Proxy.ListenPath = "/"
+		})
+
+		ts.Run(t, []test.TestCase{
+			{Path: "/", Code: http.StatusBadGateway},
+			{Method: http.MethodDelete, Path: "/tyk/apis/test/maintenance", AdminAuth: true, Code: http.StatusOK},
+			{Path: "/", Code: http.StatusOK},
+		}...)
+	})
+	t.Run("Toggled on another gateway", func(t *testing.T) {
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.Proxy.ListenPath = "/"
+		})
+
+		notify := func(nodeID string) {
+			payload, _ := json.Marshal(maintenanceNotification{APIID: "test", NodeID: nodeID})
+			data, _ := json.Marshal(Notification{Command: NoticeMaintenanceChanged, Payload: string(payload)})
+			handleRedisEvent(redis.Message{Data: data}, nil, nil)
+		}
+
+		maintenanceStore.SetKey("test", `{"enabled": true}`, 0)
+		notify(getNodeID())
+		ts.Run(t, test.TestCase{Path: "/", Code: http.StatusOK})
+
+		notify("other-node")
+		ts.Run(t, test.TestCase{Path: "/", Code: http.StatusServiceUnavailable})
+
+		maintenanceStore.DeleteKey("test")
+		notify("other-node")
+		ts.Run(t, test.TestCase{Path: "/", Code: http.StatusOK})
+	})
+}
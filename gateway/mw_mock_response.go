@@ -0,0 +1,318 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/regexp"
+)
+
+// mockSchemaMaxDepth bounds the nesting of bodies generated from schemas,
+// for recursive schemas to end.
+const mockSchemaMaxDepth = 8
+
+var mockPathParamsRegex = regexp.MustCompile(`{([^}]*)}`)
+
+// MockResponseSpec is a mock response with its body generated, or its
+// template parsed, once when the API is loaded.
+type MockResponseSpec struct {
+	apidef.MockResponseMeta
+	path     *regexp.Regexp
+	params   []string
+	body     []byte
+	template *template.Template
+}
+
+// newMockResponseSpec generates the body of a mock, parsing it as a template
+// if it is one.
+func newMockResponseSpec(meta apidef.MockResponseMeta, path *regexp.Regexp, funcs template.FuncMap) (MockResponseSpec, error) {
+	mock := MockResponseSpec{MockResponseMeta: meta, path: path}
+	if mock.Code == 0 {
+		mock.Code = http.StatusOK
+	}
+	for _, match := range mockPathParamsRegex.FindAllStringSubmatch(meta.Path, -1) {
+		mock.params = append(mock.params, match[1])
+	}
+
+	isJSON := true
+	switch example := meta.Example.(type) {
+	case nil:
+		if meta.Schema != nil {
+			mock.body, _ = json.Marshal(mockFromSchema(meta.Schema, meta.Schema, 0))
+		} else {
+			isJSON = false
+		}
+	case string:
+		mock.body = []byte(example)
+		isJSON = false
+	default:
+		var err error
+		if mock.body, err = json.Marshal(example); err != nil {
+			return mock, err
+		}
+	}
+	if isJSON && !mock.hasHeader(headers.ContentType) {
+		mock.Headers = make(map[string]string, len(meta.Headers)+1)
+		for name, value := range meta.Headers {
+			mock.Headers[name] = value
+		}
+		mock.Headers[headers.ContentType] = headers.ApplicationJSON
+	}
+
+	if meta.Template {
+		var err error
+		mock.template, err = template.New("").Funcs(funcs).Parse(string(mock.body))
+		return mock, err
+	}
+	return mock, nil
+}
+
+func (m *MockResponseSpec) hasHeader(name string) bool {
+	for header := range m.Headers {
+		if strings.EqualFold(header, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// mockRequest is what templates of mock responses are rendered with.
+type mockRequest struct {
+	Method  string
+	Path    string
+	Params  map[string]string
+	Query   map[string]string
+	Headers map[string]string
+	Body    interface{}
+}
+
+// render returns the body of the mock for r, matched on path.
+func (m *MockResponseSpec) render(r *http.Request, path string) ([]byte, error) {
+	if m.template == nil {
+		return m.body, nil
+	}
+
+	data := mockRequest{
+		Method:  r.Method,
+		Path:    path,
+		Params:  make(map[string]string, len(m.params)),
+		Query:   make(map[string]string, len(r.URL.Query())),
+		Headers: make(map[string]string, len(r.Header)),
+	}
+	if match := m.path.FindStringSubmatch(path); len(match) == len(m.params)+1 {
+		for i, name := range m.params {
+			data.Params[name] = match[i+1]
+		}
+	}
+	for name, values := range r.URL.Query() {
+		data.Query[name] = values[0]
+	}
+	for name, values := range r.Header {
+		data.Headers[name] = values[0]
+	}
+	if r.Body != nil {
+		copyRequest(r)
+		body, _ := ioutil.ReadAll(r.Body)
+		copyRequest(r)
+		json.Unmarshal(body, &data.Body)
+	}
+
+	var body bytes.Buffer
+	if err := m.template.Execute(&body, data); err != nil {
+		return nil, err
+	}
+	return body.Bytes(), nil
+}
+
+// latency returns how long to delay the response by.
+func (m *MockResponseSpec) latency() time.Duration {
+	latency := m.Latency
+	if m.LatencyJitter > 0 {
+		latency += rand.Int63n(m.LatencyJitter + 1)
+	}
+	return time.Duration(latency) * time.Millisecond
+}
+
+// mockFromSchema generates a value valid against schema, using its examples,
+// defaults or first allowed values where it has them. References are looked
+// up in root.
+func mockFromSchema(schema, root map[string]interface{}, depth int) interface{} {
+	if depth > mockSchemaMaxDepth {
+		return nil
+	}
+	if ref, ok := schema["$ref"].(string); ok {
+		resolved := resolveSchemaRef(root, ref)
+		if resolved == nil {
+			return nil
+		}
+		return mockFromSchema(resolved, root, depth+1)
+	}
+
+	if example, ok := schema["example"]; ok {
+		return example
+	}
+	if def, ok := schema["default"]; ok {
+		return def
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && len(enum) > 0 {
+		return enum[0]
+	}
+
+	if allOf, ok := schema["allOf"].([]interface{}); ok {
+		merged := map[string]interface{}{}
+		for _, sub := range allOf {
+			subSchema, _ := sub.(map[string]interface{})
+			if object, ok := mockFromSchema(subSchema, root, depth+1).(map[string]interface{}); ok {
+				for key, value := range object {
+					merged[key] = value
+				}
+			}
+		}
+		return merged
+	}
+	for _, key := range []string{"oneOf", "anyOf"} {
+		if alternatives, ok := schema[key].([]interface{}); ok && len(alternatives) > 0 {
+			alternative, _ := alternatives[0].(map[string]interface{})
+			return mockFromSchema(alternative, root, depth+1)
+		}
+	}
+
+	typ, _ := schema["type"].(string)
+	if types, ok := schema["type"].([]interface{}); ok && len(types) > 0 {
+		typ, _ = types[0].(string)
+	}
+	switch typ {
+	case "array":
+		items, _ := schema["items"].(map[string]interface{})
+		if items == nil {
+			return []interface{}{}
+		}
+		return []interface{}{mockFromSchema(items, root, depth+1)}
+	case "string":
+		return mockString(schema)
+	case "integer", "number":
+		if min, ok := schema["minimum"]; ok {
+			return min
+		}
+		return 0
+	case "boolean":
+		return true
+	case "null":
+		return nil
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	if typ != "object" && properties == nil {
+		return nil
+	}
+	object := make(map[string]interface{}, len(properties))
+	for name, property := range properties {
+		propertySchema, _ := property.(map[string]interface{})
+		object[name] = mockFromSchema(propertySchema, root, depth+1)
+	}
+	return object
+}
+
+// mockString returns a string of the format of schema.
+func mockString(schema map[string]interface{}) string {
+	switch format, _ := schema["format"].(string); format {
+	case "date-time":
+		return "2020-01-01T00:00:00Z"
+	case "date":
+		return "2020-01-01"
+	case "email":
+		return "user@example.com"
+	case "uuid":
+		return "00000000-0000-0000-0000-000000000000"
+	case "uri", "url":
+		return "https://example.com"
+	case "ipv4":
+		return "127.0.0.1"
+	case "ipv6":
+		return "::1"
+	}
+	return "string"
+}
+
+// resolveSchemaRef looks a local reference like #/components/schemas/Pet up
+// in root.
+func resolveSchemaRef(root map[string]interface{}, ref string) map[string]interface{} {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil
+	}
+	node := root
+	for _, key := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		key = strings.NewReplacer("~1", "/", "~0", "~").Replace(key)
+		next, ok := node[key].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		node = next
+	}
+	return node
+}
+
+// MockResponseMiddleware answers the requests to mocked endpoints, after the
+// checks of the API, as its upstream would.
+type MockResponseMiddleware struct {
+	BaseMiddleware
+	sh SuccessHandler
+}
+
+func (m *MockResponseMiddleware) Name() string {
+	return "MockResponseMiddleware"
+}
+
+func (m *MockResponseMiddleware) Init() {
+	m.sh = SuccessHandler{m.BaseMiddleware}
+}
+
+func (m *MockResponseMiddleware) EnabledForSpec() bool {
+	for _, version := range m.Spec.VersionData.Versions {
+		if len(version.ExtendedPaths.MockResponse) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MockResponseMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
+	_, versionPaths, _, _ := m.Spec.Version(r)
+	found, meta := m.Spec.CheckSpecMatchesStatus(r, versionPaths, MockResponded)
+	if !found {
+		return nil, http.StatusOK
+	}
+	mock := meta.(*MockResponseSpec)
+
+	body, err := mock.render(r, m.Spec.StripListenPath(r.URL.Path))
+	if err != nil {
+		m.Logger().WithError(err).Error("Failed to render mock response")
+		return errors.New("Could not render mock response"), http.StatusInternalServerError
+	}
+
+	latency := mock.latency()
+	select {
+	case <-time.After(latency):
+	case <-r.Context().Done():
+		return nil, mwStatusRespond
+	}
+
+	response := &VMResponseObject{Response: ResponseObject{
+		Body:    string(body),
+		Headers: mock.Headers,
+		Code:    mock.Code,
+	}}
+	if res := forceResponse(w, r, response, m.Spec, ctxGetSession(r), false, m.Logger()); res != nil {
+		m.sh.RecordHit(r, int64(latency/time.Millisecond), res.StatusCode, res)
+	}
+	return nil, mwStatusRespond
+}
@@ -0,0 +1,89 @@
+package gateway
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestMockResponse(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/pets/"
+		UpdateAPIVersion(spec, "v1", func(v *apidef.VersionInfo) {
+			v.UseExtendedPaths = true
+			v.ExtendedPaths.MockResponse = []apidef.MockResponseMeta{
+				{
+					Path:    "/list",
+					Method:  http.MethodGet,
+					Example: []interface{}{map[string]interface{}{"name": "Rex"}},
+				},
+				{
+					Path:   "/new",
+					Method: http.MethodPost,
+					Code:   http.StatusCreated,
+					Schema: map[string]interface{}{
+						"$ref": "#/definitions/Pet",
+						"definitions": map[string]interface{}{
+							"Pet": map[string]interface{}{
+								"type": "object",
+								"properties": map[string]interface{}{
+									"name":    map[string]interface{}{"type": "string", "example": "Rex"},
+									"created": map[string]interface{}{"type": "string", "format": "date-time"},
+								},
+							},
+						},
+					},
+				},
+				{
+					Path:     "/{id}",
+					Method:   http.MethodGet,
+					Headers:  map[string]string{"X-Mock": "true"},
+					Example:  `{"id": "{{.Params.id}}", "owner": "{{.Query.owner}}"}`,
+					Template: true,
+					Latency:  100,
+				},
+			}
+		})
+	})
+
+	ts.Run(t, []test.TestCase{
+		{Path: "/pets/list", Code: http.StatusOK, BodyMatch: `[{"name":"Rex"}]`,
+			HeadersMatch: map[string]string{headers.ContentType: headers.ApplicationJSON}},
+		{Method: http.MethodPost, Path: "/pets/new", Code: http.StatusCreated,
+			BodyMatch: `{"created":"2020-01-01T00:00:00Z","name":"Rex"}`},
+		// Not mocked methods are proxied
+		{Method: http.MethodPost, Path: "/pets/list", Code: http.StatusOK, BodyMatch: `"Url":"/pets/list"`},
+	}...)
+
+	start := time.Now()
+	ts.Run(t, test.TestCase{Path: "/pets/42?owner=alice", Code: http.StatusOK,
+		BodyMatch:    `{"id": "42", "owner": "alice"}`,
+		HeadersMatch: map[string]string{"X-Mock": "true"}})
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Expected the response to be delayed by 100ms, took %v", elapsed)
+	}
+
+	t.Run("Listen path with variables", func(t *testing.T) {
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.Proxy.ListenPath = "/{org}/pets/"
+			UpdateAPIVersion(spec, "v1", func(v *apidef.VersionInfo) {
+				v.UseExtendedPaths = true
+				v.ExtendedPaths.MockResponse = []apidef.MockResponseMeta{{
+					Path:     "/{id}",
+					Method:   http.MethodGet,
+					Example:  `{"id": "{{.Params.id}}"}`,
+					Template: true,
+				}}
+			})
+		})
+
+		ts.Run(t, test.TestCase{Path: "/acme/pets/42", Code: http.StatusOK, BodyMatch: `{"id": "42"}`})
+	})
+}
@@ -41,7 +41,7 @@ func (k *Oauth2KeyExists) ProcessRequest(w http.ResponseWriter, r *http.Request,
 		return errors.New("Authorization field missing"), http.StatusBadRequest
 	}
 
-	if strings.ToLower(parts[0]) != "bearer" {
+	if scheme := strings.ToLower(parts[0]); scheme != "bearer" && scheme != "dpop" {
 		logger.Info("Bearer token malformed")
 
 		return errors.New("Bearer token malformed"), http.StatusBadRequest
@@ -85,6 +85,10 @@ func (k *Oauth2KeyExists) ProcessRequest(w http.ResponseWriter, r *http.Request,
 		return errors.New("Key not authorised. OAuth client access was revoked"), http.StatusForbidden
 	}
 
+	if err := checkSessionBinding(r, &session); err != nil {
+		return tokenBindingFailure(k, r, accessToken, err)
+	}
+
 	// Set session state on context, we will need it later
 	switch k.Spec.BaseIdentityProvidedBy {
 	case apidef.OAuthKey, apidef.UnsetAuth:
@@ -2,11 +2,17 @@ package gateway
 
 import (
 	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"hash"
 	"net/http"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	jwt "github.com/dgrijalva/jwt-go"
@@ -23,6 +29,7 @@ type OpenIDMW struct {
 	providerConfiguration     *openid.Configuration
 	provider_client_policymap map[string]map[string]string
 	lock                      sync.RWMutex
+	configuredAt              time.Time
 }
 
 func (k *OpenIDMW) Name() string {
@@ -35,14 +42,45 @@ func (k *OpenIDMW) EnabledForSpec() bool {
 
 func (k *OpenIDMW) Init() {
 	k.provider_client_policymap = make(map[string]map[string]string)
-	// Create an OpenID Configuration and store
-	var err error
-	k.providerConfiguration, err = openid.NewConfiguration(openid.ProvidersGetter(k.getProviders),
+	k.configure()
+}
+
+// configure creates the OpenID configuration, which discovers the providers
+// and caches their signing keys as tokens come.
+func (k *OpenIDMW) configure() {
+	conf, err := openid.NewConfiguration(openid.ProvidersGetter(k.getProviders),
 		openid.ErrorHandler(k.dummyErrorHandler))
 
 	if err != nil {
 		k.Logger().WithError(err).Error("OpenID configuration error")
+		return
+	}
+
+	k.lock.Lock()
+	k.providerConfiguration = conf
+	k.configuredAt = time.Now()
+	k.lock.Unlock()
+}
+
+// configuration returns the OpenID configuration, starting over with a new
+// one once the signing keys are due to be refreshed, so that keys rotated out
+// by the providers stop being trusted.
+func (k *OpenIDMW) configuration() *openid.Configuration {
+	k.lock.RLock()
+	conf, configuredAt := k.providerConfiguration, k.configuredAt
+	k.lock.RUnlock()
+
+	interval := time.Duration(k.Spec.OpenIDOptions.JWKSRefreshInterval) * time.Second
+	if interval > 0 && time.Since(configuredAt) > interval {
+		k.Logger().Debug("Refreshing OpenID provider keys")
+		k.configure()
+
+		k.lock.RLock()
+		conf = k.providerConfiguration
+		k.lock.RUnlock()
 	}
+
+	return conf
 }
 
 func (k *OpenIDMW) getProviders() ([]openid.Provider, error) {
@@ -94,7 +132,7 @@ func (k *OpenIDMW) dummyErrorHandler(e error, w http.ResponseWriter, r *http.Req
 func (k *OpenIDMW) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
 	logger := k.Logger()
 	// 1. Validate the JWT
-	ouser, token, halt := openid.AuthenticateOIDWithUser(k.providerConfiguration, w, r)
+	ouser, token, halt := openid.AuthenticateOIDWithUser(k.configuration(), w, r)
 
 	// 2. Generate the internal representation for the key
 	if halt {
@@ -127,6 +165,7 @@ func (k *OpenIDMW) ProcessRequest(w http.ResponseWriter, r *http.Request, _ inte
 
 	policyID := ""
 	clientID := ""
+	azp, _ := token.Claims.(jwt.MapClaims)["azp"].(string)
 	switch v := clients.(type) {
 	case string:
 		k.lock.RLock()
@@ -146,6 +185,41 @@ func (k *OpenIDMW) ProcessRequest(w http.ResponseWriter, r *http.Request, _ inte
 		}
 	}
 
+	// The authorized party is the client the token was issued to, which
+	// decides the policy when the token is meant for several audiences
+	if multipleAudiences(clients) && azp == "" {
+		logger.Error("Token has several audiences but no authorized party!")
+		k.reportLoginFailure("[NOT GENERATED]", r)
+		return errors.New("Key not authorised"), http.StatusUnauthorized
+	}
+	if azp != "" {
+		k.lock.RLock()
+		policy, foundClient := clientSet[azp]
+		k.lock.RUnlock()
+		if !foundClient {
+			logger.WithField("azp", azp).Error("Authorized party is not a client of the provider!")
+			k.reportLoginFailure("[NOT GENERATED]", r)
+			return errors.New("Key not authorised"), http.StatusUnauthorized
+		}
+		clientID, policyID = azp, policy
+	}
+
+	if err := k.validateNonce(r, token); err != nil {
+		logger.WithError(err).Error("Nonce validation failed")
+		k.reportLoginFailure("[NOT GENERATED]", r)
+		return errors.New("Key not authorised"), http.StatusUnauthorized
+	}
+
+	if err := k.validateAccessTokenHash(r, token); err != nil {
+		logger.WithError(err).Error("Access token hash validation failed")
+		k.reportLoginFailure("[NOT GENERATED]", r)
+		return errors.New("Key not authorised"), http.StatusUnauthorized
+	}
+
+	if err := checkConfirmationClaim(r, token.Claims.(jwt.MapClaims)); err != nil {
+		return tokenBindingFailure(k, r, "[NOT GENERATED]", err)
+	}
+
 	if !useScope && policyID == "" {
 		logger.Error("No matching policy found!")
 		k.reportLoginFailure("[NOT GENERATED]", r)
@@ -235,3 +309,80 @@ func (k *OpenIDMW) reportLoginFailure(tykId string, r *http.Request) {
 	// Report in health check
 	reportHealthValue(k.Spec, KeyFailure, "1")
 }
+
+func multipleAudiences(aud interface{}) bool {
+	audiences, ok := aud.([]interface{})
+	return ok && len(audiences) > 1
+}
+
+// validateNonce checks the token carries the nonce the client sent along with
+// it, binding the token to the session of the client.
+func (k *OpenIDMW) validateNonce(r *http.Request, token *jwt.Token) error {
+	name := k.Spec.OpenIDOptions.NonceHeader
+	if name == "" {
+		return nil
+	}
+
+	expected := r.Header.Get(name)
+	if expected == "" {
+		if cookie, err := r.Cookie(name); err == nil {
+			expected = cookie.Value
+		}
+	}
+	if expected == "" {
+		return fmt.Errorf("no nonce in header or cookie %s", name)
+	}
+
+	nonce, _ := token.Claims.(jwt.MapClaims)["nonce"].(string)
+	if subtle.ConstantTimeCompare([]byte(nonce), []byte(expected)) != 1 {
+		return errors.New("nonce does not match")
+	}
+	return nil
+}
+
+// validateAccessTokenHash checks an access token sent along with the ID token
+// was issued with it, as of its at_hash claim.
+func (k *OpenIDMW) validateAccessTokenHash(r *http.Request, token *jwt.Token) error {
+	name := k.Spec.OpenIDOptions.AccessTokenHeader
+	if name == "" {
+		return nil
+	}
+	accessToken := r.Header.Get(name)
+	if accessToken == "" {
+		return nil
+	}
+
+	atHash, _ := token.Claims.(jwt.MapClaims)["at_hash"].(string)
+	if atHash == "" {
+		return errors.New("no at_hash claim")
+	}
+
+	expected, err := accessTokenHash(accessToken, token.Method.Alg())
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(atHash), []byte(expected)) != 1 {
+		return errors.New("at_hash does not match the access token")
+	}
+	return nil
+}
+
+// accessTokenHash returns the at_hash of an access token: the left half of
+// its hash with the hash function of the ID token algorithm, base64url encoded.
+func accessTokenHash(accessToken, alg string) (string, error) {
+	var h hash.Hash
+	switch {
+	case strings.HasSuffix(alg, "256"):
+		h = sha256.New()
+	case strings.HasSuffix(alg, "384"):
+		h = sha512.New384()
+	case strings.HasSuffix(alg, "512"):
+		h = sha512.New()
+	default:
+		return "", fmt.Errorf("no hash function for algorithm %s", alg)
+	}
+
+	h.Write([]byte(accessToken))
+	sum := h.Sum(nil)
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2]), nil
+}
@@ -0,0 +1,180 @@
+package gateway
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	jose "github.com/square/go-jose"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+// testOIDProvider serves the discovery document and signing keys of an
+// OpenID provider.
+type testOIDProvider struct {
+	*httptest.Server
+	mu   sync.Mutex
+	keys jose.JsonWebKeySet
+}
+
+func newTestOIDProvider() *testOIDProvider {
+	p := &testOIDProvider{}
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{"issuer": p.URL, "jwks_uri": p.URL + "/jwks"})
+		case "/jwks":
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			json.NewEncoder(w).Encode(p.keys)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return p
+}
+
+func (p *testOIDProvider) setKey(kid string, key *rsa.PrivateKey) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = jose.JsonWebKeySet{Keys: []jose.JsonWebKey{{Key: &key.PublicKey, KeyID: kid}}}
+}
+
+func createOIDToken(t *testing.T, kid string, key *rsa.PrivateKey, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestOpenID(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := newTestOIDProvider()
+	defer provider.Close()
+	provider.setKey("key-1", key)
+
+	policyWeb := CreatePolicy()
+	policyMobile := CreatePolicy()
+
+	loadAPI := func(options apidef.OpenIDOptions) {
+		options.Providers = []apidef.OIDProviderConfig{{
+			Issuer: provider.URL,
+			ClientIDs: map[string]string{
+				base64.StdEncoding.EncodeToString([]byte("web")):    policyWeb,
+				base64.StdEncoding.EncodeToString([]byte("mobile")): policyMobile,
+			},
+		}}
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.UseKeylessAccess = false
+			spec.UseOpenID = true
+			spec.OpenIDOptions = options
+			spec.Proxy.ListenPath = "/"
+		})
+	}
+
+	claims := func(extra jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"iss": provider.URL,
+			"sub": "user",
+			"aud": "web",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+	bearer := func(c jwt.MapClaims) map[string]string {
+		return map[string]string{"Authorization": "Bearer " + createOIDToken(t, "key-1", key, c)}
+	}
+
+	t.Run("Authorized party", func(t *testing.T) {
+		loadAPI(apidef.OpenIDOptions{})
+
+		ts.Run(t, []test.TestCase{
+			{Headers: bearer(claims(nil)), Code: http.StatusOK},
+			{Headers: bearer(claims(jwt.MapClaims{"aud": []interface{}{"web", "mobile"}})), Code: http.StatusUnauthorized},
+			{Headers: bearer(claims(jwt.MapClaims{"aud": []interface{}{"web", "mobile"}, "azp": "mobile"})), Code: http.StatusOK},
+			{Headers: bearer(claims(jwt.MapClaims{"azp": "unknown"})), Code: http.StatusUnauthorized},
+		}...)
+	})
+
+	t.Run("Nonce", func(t *testing.T) {
+		loadAPI(apidef.OpenIDOptions{NonceHeader: "X-Nonce"})
+
+		token := bearer(claims(jwt.MapClaims{"nonce": "n-0S6_WzA2Mj"}))
+		withNonce := func(nonce string) map[string]string {
+			return map[string]string{"Authorization": token["Authorization"], "X-Nonce": nonce}
+		}
+		ts.Run(t, []test.TestCase{
+			{Headers: token, Code: http.StatusUnauthorized},
+			{Headers: withNonce("other"), Code: http.StatusUnauthorized},
+			{Headers: withNonce("n-0S6_WzA2Mj"), Code: http.StatusOK},
+			{Headers: token, Cookies: []*http.Cookie{{Name: "X-Nonce", Value: "n-0S6_WzA2Mj"}}, Code: http.StatusOK},
+			{Headers: bearer(claims(nil)), Cookies: []*http.Cookie{{Name: "X-Nonce", Value: "n-0S6_WzA2Mj"}}, Code: http.StatusUnauthorized},
+		}...)
+	})
+
+	t.Run("Access token hash", func(t *testing.T) {
+		loadAPI(apidef.OpenIDOptions{AccessTokenHeader: "X-Access-Token"})
+
+		// Example of the OpenID Connect Core specification, section A.3
+		accessToken := "jHkWEdUXMU1BwAsC4vtUsZwnNvTIxEl0z9K3vx5KF0Y"
+		atHash, _ := accessTokenHash(accessToken, "RS256")
+		if atHash != "77QmUPtjPfzWtF2AnpK9RQ" {
+			t.Fatal("Wrong access token hash", atHash)
+		}
+
+		withAccessToken := func(c jwt.MapClaims, accessToken string) map[string]string {
+			headers := bearer(c)
+			headers["X-Access-Token"] = accessToken
+			return headers
+		}
+		ts.Run(t, []test.TestCase{
+			{Headers: withAccessToken(claims(jwt.MapClaims{"at_hash": atHash}), accessToken), Code: http.StatusOK},
+			{Headers: withAccessToken(claims(jwt.MapClaims{"at_hash": atHash}), "other"), Code: http.StatusUnauthorized},
+			{Headers: withAccessToken(claims(nil), accessToken), Code: http.StatusUnauthorized},
+			// Without an access token, there is nothing to check
+			{Headers: bearer(claims(nil)), Code: http.StatusOK},
+		}...)
+	})
+
+	t.Run("Key rotation", func(t *testing.T) {
+		loadAPI(apidef.OpenIDOptions{JWKSRefreshInterval: 1})
+		token := bearer(claims(nil))
+		ts.Run(t, test.TestCase{Headers: token, Code: http.StatusOK})
+
+		newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		provider.setKey("key-2", newKey)
+		defer provider.setKey("key-1", key)
+
+		// The old key is trusted until the keys are refreshed
+		ts.Run(t, test.TestCase{Headers: token, Code: http.StatusOK})
+		time.Sleep(1100 * time.Millisecond)
+		ts.Run(t, []test.TestCase{
+			{Headers: token, Code: http.StatusUnauthorized},
+			{Headers: map[string]string{"Authorization": "Bearer " + createOIDToken(t, "key-2", newKey, claims(nil))}, Code: http.StatusOK},
+		}...)
+	})
+}
@@ -84,16 +84,43 @@ func (k *RateLimitAndQuotaCheck) ProcessRequest(w http.ResponseWriter, r *http.R
 
 	throttleRetryLimit := session.ThrottleRetryLimit
 	throttleInterval := session.ThrottleInterval
+	throttleQueueSize := session.ThrottleQueueSize
+	throttleMaxWait := session.ThrottleMaxWait
+	rate, per := session.Rate, session.Per
 
 	if len(session.AccessRights) > 0 {
 		if rights, ok := session.AccessRights[k.Spec.APIID]; ok {
 			if rights.Limit != nil {
 				throttleInterval = rights.Limit.ThrottleInterval
 				throttleRetryLimit = rights.Limit.ThrottleRetryLimit
+				throttleQueueSize = rights.Limit.ThrottleQueueSize
+				throttleMaxWait = rights.Limit.ThrottleMaxWait
+				rate, per = rights.Limit.Rate, rights.Limit.Per
 			}
 		}
 	}
 
+	// Queue requests over the rate limit rather than rejecting them
+	if reason == sessionFailRateLimit && throttleQueueSize > 0 && rate > 0 {
+		maxWait := time.Duration(throttleMaxWait * float64(time.Second))
+		requestQueue.wait(r, k.Spec.APIID+":"+token, throttleQueueSize, maxWait, queueInterval(rate, per), func() bool {
+			reason = sessionLimiter.ForwardMessage(
+				r,
+				session,
+				token,
+				storeRef,
+				!k.Spec.DisableRateLimit,
+				!k.Spec.DisableQuota,
+				&k.Spec.GlobalConfig,
+				k.Spec.APIID,
+				false,
+			)
+			return reason != sessionFailRateLimit
+		})
+		// Queued requests have waited enough to not be retried
+		throttleRetryLimit = 0
+	}
+
 	switch reason {
 	case sessionFailNone:
 	case sessionFailRateLimit:
@@ -3,6 +3,7 @@ package gateway
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/base64"
 	"encoding/hex"
@@ -10,13 +11,18 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
 	"strconv"
 	"strings"
+	"text/template"
 	"time"
 
 	"golang.org/x/sync/singleflight"
 
 	"github.com/TykTechnologies/murmur3"
+	"github.com/TykTechnologies/tyk/headers"
 	"github.com/TykTechnologies/tyk/regexp"
 	"github.com/TykTechnologies/tyk/request"
 	"github.com/TykTechnologies/tyk/storage"
@@ -25,6 +31,11 @@ import (
 const (
 	upstreamCacheHeader    = "x-tyk-cache-action-set"
 	upstreamCacheTTLHeader = "x-tyk-cache-action-set-ttl"
+
+	// varyMarker prefixes the entries telling which request headers the
+	// responses of a request vary on. Payloads are base64, so never start
+	// with it.
+	varyMarker = "vary "
 )
 
 // RedisCacheMiddleware is a caching middleware that will pull data from Redis instead of the upstream proxy
@@ -33,6 +44,7 @@ type RedisCacheMiddleware struct {
 	CacheStore   storage.Handler
 	sh           SuccessHandler
 	singleFlight singleflight.Group
+	keyTemplate  *template.Template
 }
 
 func (m *RedisCacheMiddleware) Name() string {
@@ -41,17 +53,69 @@ func (m *RedisCacheMiddleware) Name() string {
 
 func (m *RedisCacheMiddleware) Init() {
 	m.sh = SuccessHandler{m.BaseMiddleware}
+	if text := m.Spec.CacheOptions.CacheKeyTemplate; text != "" {
+		tmpl, err := newCacheKeyTemplate(text)
+		if err != nil {
+			m.Logger().WithError(err).Error("Failed to parse cache key template")
+		}
+		m.keyTemplate = tmpl
+	}
 }
 
 func (m *RedisCacheMiddleware) EnabledForSpec() bool {
 	return m.Spec.CacheOptions.EnableCache
 }
 
-func (m *RedisCacheMiddleware) CreateCheckSum(req *http.Request, keyName string, regex string) (string, error) {
+// newCacheKeyTemplate parses a cache key template, with the same functions as
+// body transforms.
+func newCacheKeyTemplate(text string) (*template.Template, error) {
+	return template.New("cache_key").Funcs(APIDefinitionLoader{}.filterSprigFuncs()).Parse(text)
+}
+
+// cacheKeyData is what cache key templates are rendered with.
+type cacheKeyData struct {
+	Method  string
+	Path    string
+	Query   url.Values
+	Headers http.Header
+	Claims  map[string]interface{}
+	Token   string
+}
+
+func newCacheKeyData(req *http.Request, keyName string) cacheKeyData {
+	claims := make(map[string]interface{})
+	for name, value := range ctxGetData(req) {
+		if strings.HasPrefix(name, "jwt_claims_") {
+			claims[strings.TrimPrefix(name, "jwt_claims_")] = value
+		}
+	}
+	return cacheKeyData{
+		Method:  req.Method,
+		Path:    req.URL.Path,
+		Query:   req.URL.Query(),
+		Headers: req.Header,
+		Claims:  claims,
+		Token:   keyName,
+	}
+}
+
+// CreateCheckSum returns the cache key of a request. Requests are told apart
+// by their key name and URL, or by what keyTemplate renders if set, and by
+// their body. The path of the request ends the cache key, so that entries can
+// be invalidated by path.
+func (m *RedisCacheMiddleware) CreateCheckSum(req *http.Request, keyName string, regex string, keyTemplate *template.Template) (string, error) {
 	h := md5.New()
 	io.WriteString(h, req.Method)
 	io.WriteString(h, "-")
-	io.WriteString(h, req.URL.String())
+	if keyTemplate != nil {
+		if err := keyTemplate.Execute(h, newCacheKeyData(req, keyName)); err != nil {
+			return "", err
+		}
+	} else {
+		io.WriteString(h, keyName)
+		io.WriteString(h, "-")
+		io.WriteString(h, req.URL.String())
+	}
 	if req.Method == http.MethodPost {
 		if req.Body != nil {
 			bodyBytes, err := ioutil.ReadAll(req.Body)
@@ -84,7 +148,52 @@ func (m *RedisCacheMiddleware) CreateCheckSum(req *http.Request, keyName string,
 	}
 
 	reqChecksum := hex.EncodeToString(h.Sum(nil))
-	return m.Spec.APIID + keyName + reqChecksum, nil
+	return m.Spec.APIID + reqChecksum + req.URL.Path, nil
+}
+
+// variantKey returns the cache key of the response to a request varying on
+// the given request headers.
+func (m *RedisCacheMiddleware) variantKey(key, path string, req *http.Request, vary []string) string {
+	h := md5.New()
+	io.WriteString(h, key)
+	for _, name := range vary {
+		io.WriteString(h, "-")
+		io.WriteString(h, strings.Join(req.Header[http.CanonicalHeaderKey(name)], ","))
+	}
+	return m.Spec.APIID + hex.EncodeToString(h.Sum(nil)) + path
+}
+
+// cacheControl parses the directives of a Cache-Control header, mapped to
+// their value if they have one.
+func cacheControl(h http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, value := range h[headers.CacheControl] {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg := directive, ""
+			if i := strings.Index(directive, "="); i >= 0 {
+				name, arg = directive[:i], strings.Trim(strings.TrimSpace(directive[i+1:]), `"`)
+			}
+			if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+				directives[name] = arg
+			}
+		}
+	}
+	return directives
+}
+
+// varyHeaders returns the sorted request headers listed by the Vary header of
+// a response.
+func varyHeaders(h http.Header) []string {
+	var names []string
+	for _, value := range h[headers.Vary] {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
 }
 
 func (m *RedisCacheMiddleware) getTimeTTL(cacheTTL int64) string {
@@ -113,25 +222,51 @@ func (m *RedisCacheMiddleware) isTimeStampExpired(timestamp string) bool {
 	return false
 }
 
-func (m *RedisCacheMiddleware) encodePayload(payload, timestamp string) string {
+// encodePayload encodes a cached response with the time it expires at, and
+// the time it stops being served while it is revalidated.
+func (m *RedisCacheMiddleware) encodePayload(payload, timestamp, staleTimestamp string) string {
 	sEnc := base64.StdEncoding.EncodeToString([]byte(payload))
-	return sEnc + "|" + timestamp
+	return sEnc + "|" + timestamp + "|" + staleTimestamp
 }
 
-func (m *RedisCacheMiddleware) decodePayload(payload string) (string, string, error) {
+func (m *RedisCacheMiddleware) decodePayload(payload string) (string, string, string, error) {
 	data := strings.Split(payload, "|")
 	switch len(data) {
 	case 1:
-		return data[0], "", nil
-	case 2:
+		return data[0], "", "", nil
+	case 2, 3:
 		sDec, err := base64.StdEncoding.DecodeString(data[0])
 		if err != nil {
-			return "", "", err
+			return "", "", "", err
+		}
+
+		// Entries cached without a stale time are not served stale
+		staleTimestamp := data[1]
+		if len(data) == 3 {
+			staleTimestamp = data[2]
 		}
+		return string(sDec), data[1], staleTimestamp, nil
+	}
+	return "", "", "", errors.New("Decoding failed, array length wrong")
+}
 
-		return string(sDec), data[1], nil
+// getCached returns the cache entry of a request, following the entries of
+// responses varying on request headers. It returns the key of the entry.
+func (m *RedisCacheMiddleware) getCached(key, path string, r *http.Request) (string, string, error) {
+	v, err, _ := m.singleFlight.Do(key, func() (interface{}, error) {
+		return m.CacheStore.GetKey(key)
+	})
+	retBlob, _ := v.(string)
+	if err != nil || !strings.HasPrefix(retBlob, varyMarker) {
+		return retBlob, key, err
 	}
-	return "", "", errors.New("Decoding failed, array length wrong")
+
+	key = m.variantKey(key, path, r, strings.Split(strings.TrimPrefix(retBlob, varyMarker), ","))
+	v, err, _ = m.singleFlight.Do(key, func() (interface{}, error) {
+		return m.CacheStore.GetKey(key)
+	})
+	retBlob, _ = v.(string)
+	return retBlob, key, err
 }
 
 // ProcessRequest will run any checks on the request on the way through the system, return an error to have the chain fail
@@ -143,6 +278,7 @@ func (m *RedisCacheMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Req
 
 	var stat RequestStatus
 	var cacheKeyRegex string
+	keyTemplate := m.keyTemplate
 
 	_, versionPaths, _, _ := m.Spec.Version(r)
 	isVirtual, _ := m.Spec.CheckSpecMatchesStatus(r, versionPaths, VirtualPath)
@@ -151,13 +287,15 @@ func (m *RedisCacheMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Req
 	if m.Spec.CacheOptions.CacheAllSafeRequests && r.Method != "POST" {
 		stat = StatusCached
 	}
-	if stat != StatusCached {
-		// New request checker, more targeted, less likely to fail
-		found, meta := m.Spec.CheckSpecMatchesStatus(r, versionPaths, Cached)
-		if found {
-			cacheMeta := meta.(*EndPointCacheMeta)
-			stat = StatusCached
-			cacheKeyRegex = cacheMeta.CacheKeyRegex
+	// New request checker, more targeted, less likely to fail. Endpoints
+	// keep their own cache key when all safe requests are cached.
+	found, meta := m.Spec.CheckSpecMatchesStatus(r, versionPaths, Cached)
+	if found {
+		cacheMeta := meta.(*EndPointCacheMeta)
+		stat = StatusCached
+		cacheKeyRegex = cacheMeta.CacheKeyRegex
+		if cacheMeta.CacheKeyTemplate != nil {
+			keyTemplate = cacheMeta.CacheKeyTemplate
 		}
 	}
 
@@ -172,112 +310,56 @@ func (m *RedisCacheMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Req
 		token = request.RealIP(r)
 	}
 
-	var errCreatingChecksum bool
+	// The path is read before the request is proxied, which strips it
+	path := r.URL.Path
+	store := true
 	var retBlob string
-	key, err := m.CreateCheckSum(r, token, cacheKeyRegex)
+	baseKey, err := m.CreateCheckSum(r, token, cacheKeyRegex, keyTemplate)
+	key := baseKey
 	if err != nil {
 		log.Debug("Error creating checksum. Skipping cache check")
-		errCreatingChecksum = true
-	} else {
-		retBlob, err = m.CacheStore.GetKey(key)
-		v, sfErr, _ := m.singleFlight.Do(key, func() (interface{}, error) {
-			return m.CacheStore.GetKey(key)
-		})
-		retBlob = v.(string)
-		err = sfErr
+		store = false
+	} else if m.Spec.CacheOptions.HonorCacheControl {
+		directives := cacheControl(r.Header)
+		_, noCache := directives["no-cache"]
+		_, noStore := directives["no-store"]
+		if noCache || noStore {
+			log.Debug("Request asked not to be served from cache")
+			err = errors.New("cache bypassed")
+			store = !noStore
+		}
+	}
+	if err == nil {
+		retBlob, key, err = m.getCached(baseKey, path, r)
 	}
 
 	if err != nil {
-		if !errCreatingChecksum {
+		if store {
 			log.Debug("Cache enabled, but record not found")
 		}
 		// Pass through to proxy AND CACHE RESULT
-
-		var resVal *http.Response
-		if isVirtual {
-			log.Debug("This is a virtual function")
-			vp := VirtualEndpoint{BaseMiddleware: m.BaseMiddleware}
-			vp.Init()
-			resVal = vp.ServeHTTPForCache(w, r, nil)
-		} else {
-			// This passes through and will write the value to the writer, but spit out a copy for the cache
-			log.Debug("Not virtual, passing")
-			resVal = m.sh.ServeHTTPWithCache(w, r)
-		}
-
-		cacheThisRequest := true
-		cacheTTL := m.Spec.CacheOptions.CacheTimeout
-
-		if resVal == nil {
-			log.Warning("Upstream request must have failed, response is empty")
+		if resVal := m.fetchAndCache(w, r, baseKey, path, isVirtual, store); resVal == nil {
 			return nil, http.StatusOK
 		}
-
-		// make sure the status codes match if specified
-		if len(m.Spec.CacheOptions.CacheOnlyResponseCodes) > 0 {
-			foundCode := false
-			for _, code := range m.Spec.CacheOptions.CacheOnlyResponseCodes {
-				if code == resVal.StatusCode {
-					foundCode = true
-					break
-				}
-			}
-			if !foundCode {
-				cacheThisRequest = false
-			}
-		}
-
-		// Are we using upstream cache control?
-		if m.Spec.CacheOptions.EnableUpstreamCacheControl {
-			log.Debug("Upstream control enabled")
-			// Do we cache?
-			if resVal.Header.Get(upstreamCacheHeader) == "" {
-				log.Warning("Upstream cache action not found, not caching")
-				cacheThisRequest = false
-			}
-
-			cacheTTLHeader := upstreamCacheTTLHeader
-			if m.Spec.CacheOptions.CacheControlTTLHeader != "" {
-				cacheTTLHeader = m.Spec.CacheOptions.CacheControlTTLHeader
-			}
-
-			ttl := resVal.Header.Get(cacheTTLHeader)
-			if ttl != "" {
-				log.Debug("TTL Set upstream")
-				cacheAsInt, err := strconv.Atoi(ttl)
-				if err != nil {
-					log.Error("Failed to decode TTL cache value: ", err)
-					cacheTTL = m.Spec.CacheOptions.CacheTimeout
-				} else {
-					cacheTTL = int64(cacheAsInt)
-				}
-			}
-		}
-
-		if cacheThisRequest && !errCreatingChecksum {
-			log.Debug("Caching request to redis")
-			var wireFormatReq bytes.Buffer
-			resVal.Write(&wireFormatReq)
-			log.Debug("Cache TTL is:", cacheTTL)
-			ts := m.getTimeTTL(cacheTTL)
-			toStore := m.encodePayload(wireFormatReq.String(), ts)
-			go m.CacheStore.SetKey(key, toStore, cacheTTL)
-		}
-
 		return nil, mwStatusRespond
 	}
 
-	cachedData, timestamp, err := m.decodePayload(retBlob)
+	cachedData, timestamp, staleTimestamp, err := m.decodePayload(retBlob)
 	if err != nil {
 		// Tere was an issue with this cache entry - lets remove it:
 		m.CacheStore.DeleteKey(key)
 		return nil, http.StatusOK
 	}
 
-	if m.isTimeStampExpired(timestamp) || len(cachedData) == 0 {
+	// Expired responses of safe requests are served while they are revalidated
+	stale := m.isTimeStampExpired(timestamp)
+	if stale && (r.Method == "POST" || m.isTimeStampExpired(staleTimestamp)) || len(cachedData) == 0 {
 		m.CacheStore.DeleteKey(key)
 		return nil, http.StatusOK
 	}
+	if stale {
+		m.revalidate(r, baseKey, key, path, isVirtual)
+	}
 
 	log.Debug("Cache got: ", cachedData)
 	bufData := bufio.NewReader(strings.NewReader(cachedData))
@@ -303,13 +385,13 @@ func (m *RedisCacheMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Req
 		w.Header().Set(XRateLimitReset, strconv.Itoa(int(quotaRenews)))
 	}
 	w.Header().Set("x-tyk-cached-response", "1")
+	if stale {
+		w.Header().Set("Warning", `110 - "Response is Stale"`)
+	}
 
-	if reqEtag := r.Header.Get("If-None-Match"); reqEtag != "" {
-		if respEtag := newRes.Header.Get("Etag"); respEtag != "" {
-			if strings.Contains(reqEtag, respEtag) {
-				newRes.StatusCode = http.StatusNotModified
-			}
-		}
+	// Clients holding the cached response are answered without its body
+	if notModified(r, newRes.Header) {
+		newRes.StatusCode = http.StatusNotModified
 	}
 
 	w.WriteHeader(newRes.StatusCode)
@@ -325,3 +407,150 @@ func (m *RedisCacheMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Req
 	// Stop any further execution
 	return nil, mwStatusRespond
 }
+
+// fetchAndCache serves a request from the upstream, or the virtual endpoint,
+// and caches the response under key if store is set and the response allows
+// it. It returns nil if the upstream request failed.
+func (m *RedisCacheMiddleware) fetchAndCache(w http.ResponseWriter, r *http.Request, key, path string, isVirtual, store bool) *http.Response {
+	var resVal *http.Response
+	if isVirtual {
+		log.Debug("This is a virtual function")
+		vp := VirtualEndpoint{BaseMiddleware: m.BaseMiddleware}
+		vp.Init()
+		resVal = vp.ServeHTTPForCache(w, r, nil)
+	} else {
+		// This passes through and will write the value to the writer, but spit out a copy for the cache
+		log.Debug("Not virtual, passing")
+		resVal = m.sh.ServeHTTPWithCache(w, r)
+	}
+
+	cacheThisRequest := store
+	cacheTTL := m.Spec.CacheOptions.CacheTimeout
+	staleTTL := m.Spec.CacheOptions.StaleWhileRevalidate
+
+	if resVal == nil {
+		log.Warning("Upstream request must have failed, response is empty")
+		return nil
+	}
+
+	// Event streams are proxied as they are received
+	if IsSSE(resVal.Header) {
+		return resVal
+	}
+
+	// make sure the status codes match if specified
+	if len(m.Spec.CacheOptions.CacheOnlyResponseCodes) > 0 {
+		foundCode := false
+		for _, code := range m.Spec.CacheOptions.CacheOnlyResponseCodes {
+			if code == resVal.StatusCode {
+				foundCode = true
+				break
+			}
+		}
+		if !foundCode {
+			cacheThisRequest = false
+		}
+	}
+
+	// Are we using upstream cache control?
+	if m.Spec.CacheOptions.EnableUpstreamCacheControl {
+		log.Debug("Upstream control enabled")
+		// Do we cache?
+		if resVal.Header.Get(upstreamCacheHeader) == "" {
+			log.Warning("Upstream cache action not found, not caching")
+			cacheThisRequest = false
+		}
+
+		cacheTTLHeader := upstreamCacheTTLHeader
+		if m.Spec.CacheOptions.CacheControlTTLHeader != "" {
+			cacheTTLHeader = m.Spec.CacheOptions.CacheControlTTLHeader
+		}
+
+		ttl := resVal.Header.Get(cacheTTLHeader)
+		if ttl != "" {
+			log.Debug("TTL Set upstream")
+			cacheAsInt, err := strconv.Atoi(ttl)
+			if err != nil {
+				log.Error("Failed to decode TTL cache value: ", err)
+				cacheTTL = m.Spec.CacheOptions.CacheTimeout
+			} else {
+				cacheTTL = int64(cacheAsInt)
+			}
+		}
+	}
+
+	var vary []string
+	if m.Spec.CacheOptions.HonorCacheControl {
+		directives := cacheControl(resVal.Header)
+		for _, name := range []string{"no-store", "no-cache", "private"} {
+			if _, ok := directives[name]; ok {
+				cacheThisRequest = false
+			}
+		}
+
+		// Shared caches prefer s-maxage
+		maxAge, ok := directives["s-maxage"]
+		if !ok {
+			maxAge, ok = directives["max-age"]
+		}
+		if ok {
+			if age, err := strconv.ParseInt(maxAge, 10, 64); err == nil {
+				cacheTTL = age
+			}
+		}
+		if cacheTTL <= 0 {
+			cacheThisRequest = false
+		}
+		if swr, ok := directives["stale-while-revalidate"]; ok {
+			if age, err := strconv.ParseInt(swr, 10, 64); err == nil {
+				staleTTL = age
+			}
+		}
+
+		vary = varyHeaders(resVal.Header)
+		for _, name := range vary {
+			if name == "*" {
+				cacheThisRequest = false
+			}
+		}
+	}
+
+	if cacheThisRequest {
+		log.Debug("Caching request to redis")
+		var wireFormatReq bytes.Buffer
+		resVal.Write(&wireFormatReq)
+		log.Debug("Cache TTL is:", cacheTTL)
+		toStore := m.encodePayload(wireFormatReq.String(), m.getTimeTTL(cacheTTL), m.getTimeTTL(cacheTTL+staleTTL))
+		if len(vary) > 0 {
+			go m.CacheStore.SetKey(key, varyMarker+strings.Join(vary, ","), cacheTTL+staleTTL)
+			key = m.variantKey(key, path, r, vary)
+		}
+		go m.CacheStore.SetKey(key, toStore, cacheTTL+staleTTL)
+	}
+
+	return resVal
+}
+
+// revalidate refreshes the stale cache entry of a request in the background,
+// once at a time per entry.
+func (m *RedisCacheMiddleware) revalidate(r *http.Request, baseKey, key, path string, isVirtual bool) {
+	outreq := r.Clone(detachedContext{r.Context()})
+	go m.singleFlight.Do("revalidate-"+key, func() (interface{}, error) {
+		m.fetchAndCache(httptest.NewRecorder(), outreq, baseKey, path, isVirtual, true)
+		return nil, nil
+	})
+}
+
+// detachedContext keeps the values of a request context without being
+// cancelled with it, for work outliving the request.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (detachedContext) Done() <-chan struct{} { return nil }
+
+func (detachedContext) Err() error { return nil }
+
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
@@ -1,10 +1,17 @@
 package gateway
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/TykTechnologies/tyk/apidef"
 	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/storage"
 	"github.com/TykTechnologies/tyk/test"
 )
 
@@ -48,3 +55,135 @@ func TestRedisCacheMiddleware_WithCompressedResponse(t *testing.T) {
 	})
 
 }
+
+func TestRedisCacheMiddleware_KeyTemplate(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+	cache := storage.RedisCluster{KeyPrefix: "cache-"}
+	defer cache.DeleteScanMatch("*")
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.CacheOptions = apidef.CacheOptions{
+			CacheTimeout:         120,
+			EnableCache:          true,
+			CacheAllSafeRequests: true,
+			CacheKeyTemplate:     `{{.Path}}-{{index .Headers "X-Tenant"}}`,
+		}
+		UpdateAPIVersion(spec, "v1", func(v *apidef.VersionInfo) {
+			v.ExtendedPaths.AdvanceCacheConfig = []apidef.CacheMeta{{
+				Method:           http.MethodGet,
+				Path:             "/by-query",
+				CacheKeyTemplate: `{{.Query.Get "page"}}`,
+			}}
+		})
+	})
+
+	headerCache := map[string]string{"x-tyk-cached-response": "1"}
+	tenantA := map[string]string{"X-Tenant": "a"}
+	tenantB := map[string]string{"X-Tenant": "b"}
+
+	ts.Run(t, []test.TestCase{
+		{Path: "/", Headers: tenantA, HeadersNotMatch: headerCache, Delay: 10 * time.Millisecond},
+		// The query is not part of the key
+		{Path: "/?q=1", Headers: tenantA, HeadersMatch: headerCache},
+		{Path: "/", Headers: tenantB, HeadersNotMatch: headerCache, Delay: 10 * time.Millisecond},
+		{Path: "/", Headers: tenantB, HeadersMatch: headerCache},
+
+		// Endpoints have their own template
+		{Path: "/by-query?page=1", HeadersNotMatch: headerCache, Delay: 10 * time.Millisecond},
+		{Path: "/by-query?page=1&sort=asc", HeadersMatch: headerCache},
+		{Path: "/by-query?page=2", HeadersNotMatch: headerCache},
+	}...)
+}
+
+func TestRedisCacheMiddleware_CacheControl(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+	cache := storage.RedisCluster{KeyPrefix: "cache-"}
+	defer cache.DeleteScanMatch("*")
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/no-store":
+			w.Header().Set(headers.CacheControl, "no-store")
+		case "/expired":
+			w.Header().Set(headers.CacheControl, "public, max-age=0")
+		case "/vary":
+			w.Header().Set(headers.Vary, "Accept-Language")
+			w.Write([]byte("lang " + r.Header.Get("Accept-Language")))
+		case "/vary-all":
+			w.Header().Set(headers.Vary, "*")
+		}
+	}))
+	defer upstream.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.TargetURL = upstream.URL
+		spec.CacheOptions = apidef.CacheOptions{
+			CacheTimeout:         120,
+			EnableCache:          true,
+			CacheAllSafeRequests: true,
+			HonorCacheControl:    true,
+		}
+	})
+
+	headerCache := map[string]string{"x-tyk-cached-response": "1"}
+	english := map[string]string{"Accept-Language": "en"}
+	french := map[string]string{"Accept-Language": "fr"}
+
+	ts.Run(t, []test.TestCase{
+		{Path: "/", HeadersNotMatch: headerCache, Delay: 10 * time.Millisecond},
+		{Path: "/", HeadersMatch: headerCache},
+		// Clients can ask for a fresh response
+		{Path: "/", Headers: map[string]string{headers.CacheControl: "no-cache"}, HeadersNotMatch: headerCache},
+
+		{Path: "/no-store", HeadersNotMatch: headerCache, Delay: 10 * time.Millisecond},
+		{Path: "/no-store", HeadersNotMatch: headerCache},
+		{Path: "/expired", HeadersNotMatch: headerCache, Delay: 10 * time.Millisecond},
+		{Path: "/expired", HeadersNotMatch: headerCache},
+		{Path: "/vary-all", HeadersNotMatch: headerCache, Delay: 10 * time.Millisecond},
+		{Path: "/vary-all", HeadersNotMatch: headerCache},
+
+		{Path: "/vary", Headers: english, BodyMatch: "lang en", HeadersNotMatch: headerCache, Delay: 10 * time.Millisecond},
+		{Path: "/vary", Headers: english, BodyMatch: "lang en", HeadersMatch: headerCache},
+		{Path: "/vary", Headers: french, BodyMatch: "lang fr", HeadersNotMatch: headerCache, Delay: 10 * time.Millisecond},
+		{Path: "/vary", Headers: french, BodyMatch: "lang fr", HeadersMatch: headerCache},
+	}...)
+}
+
+func TestRedisCacheMiddleware_StaleWhileRevalidate(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+	cache := storage.RedisCluster{KeyPrefix: "cache-"}
+	defer cache.DeleteScanMatch("*")
+
+	var hits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hit " + strconv.Itoa(int(atomic.AddInt32(&hits, 1)))))
+	}))
+	defer upstream.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.TargetURL = upstream.URL
+		spec.CacheOptions = apidef.CacheOptions{
+			CacheTimeout:         1,
+			EnableCache:          true,
+			CacheAllSafeRequests: true,
+			StaleWhileRevalidate: 60,
+		}
+	})
+
+	headerCache := map[string]string{"x-tyk-cached-response": "1"}
+	headerStale := map[string]string{"Warning": `110 - "Response is Stale"`}
+
+	ts.Run(t, []test.TestCase{
+		{Path: "/", BodyMatch: "hit 1", HeadersNotMatch: headerCache, Delay: 10 * time.Millisecond},
+		{Path: "/", BodyMatch: "hit 1", HeadersMatch: headerCache, HeadersNotMatch: headerStale, Delay: 2 * time.Second},
+		// The expired response is served while it is refreshed
+		{Path: "/", BodyMatch: "hit 1", HeadersMatch: headerStale, Delay: 100 * time.Millisecond},
+		{Path: "/", BodyMatch: "hit 2", HeadersMatch: headerCache, HeadersNotMatch: headerStale},
+	}...)
+}
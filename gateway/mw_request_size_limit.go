@@ -22,7 +22,7 @@ func (t *RequestSizeLimitMiddleware) Name() string {
 
 func (t *RequestSizeLimitMiddleware) EnabledForSpec() bool {
 	for _, version := range t.Spec.VersionData.Versions {
-		if len(version.ExtendedPaths.SizeLimit) > 0 {
+		if len(version.ExtendedPaths.SizeLimit) > 0 || version.GlobalSizeLimit > 0 {
 			return true
 		}
 	}
@@ -30,18 +30,34 @@ func (t *RequestSizeLimitMiddleware) EnabledForSpec() bool {
 }
 
 func (t *RequestSizeLimitMiddleware) checkRequestLimit(r *http.Request, sizeLimit int64) (error, int) {
-	statedCL := r.Header.Get(headers.ContentLength)
-	if statedCL == "" {
-		return errors.New("Content length is required for this request"), 411
+	size := r.ContentLength
+	if statedCL := r.Header.Get(headers.ContentLength); statedCL != "" {
+		stated, err := strconv.ParseInt(statedCL, 0, 64)
+		if err != nil {
+			t.Logger().WithError(err).Error("String conversion for content length failed")
+			return errors.New("content length is not a valid Integer"), http.StatusBadRequest
+		}
+		if stated > size {
+			size = stated
+		}
 	}
 
-	size, err := strconv.ParseInt(statedCL, 0, 64)
-	if err != nil {
-		t.Logger().WithError(err).Error("String conversion for content length failed")
-		return errors.New("content length is not a valid Integer"), http.StatusBadRequest
-	}
-	if r.ContentLength > size {
-		size = r.ContentLength
+	if size < 0 {
+		// Bodies of unknown length, sent in chunks, are read up to the limit
+		body, ok := r.Body.(*lazyBody)
+		if !ok {
+			return errors.New("Content length is required for this request"), http.StatusLengthRequired
+		}
+		switch err := body.buffer(sizeLimit); err {
+		case nil:
+			size = body.buffered.Size()
+		case errBodyTooLarge:
+			size = sizeLimit + 1
+		case errBodyBufferFull:
+			return errors.New("Service temporarily unavailable."), http.StatusServiceUnavailable
+		default:
+			return errors.New("Failed to read the request body"), http.StatusBadRequest
+		}
 	}
 
 	// Check stated size
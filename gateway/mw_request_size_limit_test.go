@@ -0,0 +1,95 @@
+package gateway
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+// chunkedReader hides the length of a body, so that it is sent in chunks.
+type chunkedReader struct {
+	*strings.Reader
+}
+
+func TestRequestSizeLimit(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		UpdateAPIVersion(spec, "v1", func(v *apidef.VersionInfo) {
+			v.GlobalSizeLimit = 20
+			v.ExtendedPaths.SizeLimit = []apidef.RequestSizeMeta{{Path: "/small", Method: http.MethodPost, SizeLimit: 5}}
+		})
+	})
+
+	ts.Run(t, []test.TestCase{
+		{Method: http.MethodGet, Path: "/", Code: http.StatusOK},
+		{Method: http.MethodPost, Path: "/", Data: strings.Repeat("a", 20), Code: http.StatusOK},
+		{Method: http.MethodPost, Path: "/", Data: strings.Repeat("a", 21), Code: http.StatusBadRequest},
+		{Method: http.MethodPost, Path: "/small", Data: "aaaaa", Code: http.StatusOK},
+		{Method: http.MethodPost, Path: "/small", Data: "aaaaaa", Code: http.StatusBadRequest},
+	}...)
+
+	chunked := func(path, body string) int {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+path, chunkedReader{strings.NewReader(body)})
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := chunked("/small", "aaaaa"); code != http.StatusOK {
+		t.Errorf("Expected chunked bodies within the limit to be proxied, got %d", code)
+	}
+	if code := chunked("/small", strings.Repeat("a", 1000)); code != http.StatusBadRequest {
+		t.Errorf("Expected chunked bodies over the limit to be rejected, got %d", code)
+	}
+}
+
+func TestRequestBodyBufferLimit(t *testing.T) {
+	globalConf := config.Global()
+	globalConf.MaxBufferedRequestBytes = 10
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+	})
+
+	ts.Run(t, []test.TestCase{
+		{Method: http.MethodPost, Path: "/", Data: strings.Repeat("a", 10), Code: http.StatusOK, BodyMatch: `"Body":"aaaaaaaaaa"`},
+		{Method: http.MethodPost, Path: "/", Data: strings.Repeat("a", 11), Code: http.StatusServiceUnavailable},
+	}...)
+
+	// A client stating a large body which it never sends holds no room
+	conn, err := net.Dial("tcp", strings.TrimPrefix(ts.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprint(conn, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 10\r\n\r\na")
+	time.Sleep(50 * time.Millisecond)
+
+	ts.Run(t, test.TestCase{Method: http.MethodPost, Path: "/", Data: strings.Repeat("a", 9), Code: http.StatusOK})
+	conn.Close()
+
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt64(&bufferedBodyBytes); n != 0 {
+		t.Errorf("Expected buffered bodies to be released, %d bytes are still counted", n)
+	}
+}
@@ -54,6 +54,16 @@ func transformBody(r *http.Request, tmeta *TransformSpec, contextVars bool) erro
 	body, _ := ioutil.ReadAll(r.Body)
 	defer r.Body.Close()
 
+	if tmeta.Operations != nil {
+		transformed, err := tmeta.Operations.transformJSON(body, r, contextVars, tmeta.TemplateData.EnableSession)
+		if err != nil {
+			return fmt.Errorf("failed to apply operations to request: %v", err)
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(transformed))
+		r.ContentLength = int64(len(transformed))
+		return nil
+	}
+
 	// Put into an interface:
 	bodyData := make(map[string]interface{})
 
@@ -2,7 +2,10 @@ package gateway
 
 import (
 	"encoding/base64"
+	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"text/template"
@@ -10,6 +13,7 @@ import (
 	"github.com/TykTechnologies/tyk/test"
 
 	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/apidef/importer"
 )
 
 func testPrepareTransformNonAscii() (*TransformSpec, string) {
@@ -269,3 +273,67 @@ func TestBodyTransformCaseSensitivity(t *testing.T) {
 		assert("/Get", "/Get", `{"http_method":"GET"}`)
 	})
 }
+
+const testPriceWSDL = `<?xml version="1.0" encoding="utf-8"?>
+<wsdl:definitions xmlns:wsdl="http://schemas.xmlsoap.org/wsdl/" xmlns:soap="http://schemas.xmlsoap.org/wsdl/soap/"
+    xmlns:tns="http://example.com/prices" targetNamespace="http://example.com/prices">
+  <wsdl:binding name="PricesSoap" type="tns:PricesSoap">
+    <soap:binding transport="http://schemas.xmlsoap.org/soap/http"/>
+    <wsdl:operation name="GetPrice">
+      <soap:operation soapAction="http://example.com/prices/GetPrice" style="document"/>
+    </wsdl:operation>
+  </wsdl:binding>
+  <wsdl:service name="Prices">
+    <wsdl:port name="PricesSoap" binding="tns:PricesSoap">
+      <soap:address location="%s"/>
+    </wsdl:port>
+  </wsdl:service>
+</wsdl:definitions>`
+
+func TestWSDLRESTFacade(t *testing.T) {
+	var upstreamBody, upstreamAction string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		upstreamBody = string(body)
+		upstreamAction = r.Header.Get("SOAPAction")
+
+		w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		w.Write([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+			`<GetPriceResponse><GetPriceResult>1.5</GetPriceResult></GetPriceResponse></soap:Body></soap:Envelope>`))
+	}))
+	defer upstream.Close()
+
+	wsdl := &importer.WSDLDef{}
+	if err := wsdl.LoadFrom(strings.NewReader(fmt.Sprintf(testPriceWSDL, upstream.URL))); err != nil {
+		t.Fatal(err)
+	}
+	wsdl.SetRESTFacade(true)
+	def, err := wsdl.ToAPIDefinition("default", upstream.URL, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy = def.Proxy
+		spec.VersionDefinition = def.VersionDefinition
+		spec.VersionData = def.VersionData
+		spec.ResponseProcessors = def.ResponseProcessors
+	})
+
+	ts.Run(t, test.TestCase{
+		Method: http.MethodPost, Path: "/Prices/Prices/GetPrice", Data: `{"item":"apple & pear"}`,
+		Code: http.StatusOK, BodyMatch: `{"GetPriceResponse":{"GetPriceResult":"1.5"}}`,
+		HeadersMatch: map[string]string{"Content-Type": "application/json"},
+	})
+
+	want := `<soap:Body><GetPrice xmlns="http://example.com/prices"><item>apple &amp; pear</item></GetPrice></soap:Body>`
+	if !strings.Contains(upstreamBody, want) {
+		t.Errorf("Expected the parameters in a SOAP envelope, got %s", upstreamBody)
+	}
+	if upstreamAction != `"http://example.com/prices/GetPrice"` {
+		t.Errorf("Expected the SOAP action of the operation, got %s", upstreamAction)
+	}
+}
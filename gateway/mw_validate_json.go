@@ -1,6 +1,7 @@
 package gateway
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -8,8 +9,22 @@ import (
 
 	"github.com/TykTechnologies/gojsonschema"
 	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/headers"
 )
 
+// schemaValidationError is the body of responses to requests failing schema
+// validation, detailing the error of each invalid field of the payload.
+type schemaValidationError struct {
+	Error   string                  `json:"error"`
+	Details []validationErrorDetail `json:"details"`
+}
+
+type validationErrorDetail struct {
+	Field       string `json:"field"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+}
+
 type ValidateJSON struct {
 	BaseMiddleware
 }
@@ -68,13 +83,41 @@ func (k *ValidateJSON) ProcessRequest(w http.ResponseWriter, r *http.Request, _
 			vPathMeta.ErrorResponseCode = http.StatusUnprocessableEntity
 		}
 
-		return k.formatError(result.Errors()), vPathMeta.ErrorResponseCode
+		k.writeValidationError(w, r, result.Errors(), vPathMeta.ErrorResponseCode)
+		return nil, mwStatusRespond
 	}
 
 	// Handle Success
 	return nil, http.StatusOK
 }
 
+// writeValidationError rejects a request with the details of the schema
+// errors of its payload, recording it as an error in analytics.
+func (k *ValidateJSON) writeValidationError(w http.ResponseWriter, r *http.Request, schemaErrors []gojsonschema.ResultError, code int) {
+	err := k.formatError(schemaErrors)
+	handler := ErrorHandler{*k.Base()}
+	handler.HandleError(w, r, err.Error(), code, false)
+
+	body := schemaValidationError{
+		Error:   err.Error(),
+		Details: make([]validationErrorDetail, len(schemaErrors)),
+	}
+	for i, desc := range schemaErrors {
+		body.Details[i] = validationErrorDetail{
+			Field:       desc.Field(),
+			Type:        desc.Type(),
+			Description: desc.Description(),
+		}
+	}
+
+	w.Header().Set(headers.ContentType, headers.ApplicationJSON)
+	if !k.Spec.GlobalConfig.HideGeneratorHeader {
+		w.Header().Add(headers.XGenerator, "tyk.io")
+	}
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
+
 func (k *ValidateJSON) formatError(schemaErrors []gojsonschema.ResultError) error {
 	errStr := ""
 	for i, desc := range schemaErrors {
@@ -59,6 +59,34 @@ func TestValidateJSONSchema(t *testing.T) {
 	}...)
 }
 
+func TestValidateJSONSchemaErrorDetails(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	testPrepareValidateJSONSchema()
+
+	ts.Run(t, test.TestCase{
+		Method: "POST", Path: "/v", Data: `{"age":-1, "firstName": "Harry"}`, Code: http.StatusUnprocessableEntity,
+		BodyMatchFunc: func(body []byte) bool {
+			var resp schemaValidationError
+			if err := json.Unmarshal(body, &resp); err != nil {
+				t.Fatal(err)
+			}
+
+			want := map[string]string{"age": "number_gte", "lastName": "required"}
+			if len(resp.Details) != len(want) {
+				t.Fatalf("Expected %d errors, got %+v", len(want), resp.Details)
+			}
+			for _, detail := range resp.Details {
+				if want[detail.Field] != detail.Type || detail.Description == "" {
+					t.Errorf("Unexpected error detail %+v", detail)
+				}
+			}
+			return resp.Error != ""
+		},
+	})
+}
+
 func BenchmarkValidateJSONSchema(b *testing.B) {
 	b.ReportAllocs()
 
@@ -0,0 +1,215 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/clbanning/mxj"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/headers"
+)
+
+const (
+	soapEnvelopeNamespace = "http://schemas.xmlsoap.org/soap/envelope/"
+
+	// mxj maps attributes and the text of elements with attributes to these
+	// keys.
+	mxjAttributePrefix = "-"
+	mxjTextKey         = "#text"
+)
+
+// XMLConversionMiddleware converts JSON request bodies to XML for upstreams
+// which only accept XML.
+type XMLConversionMiddleware struct {
+	BaseMiddleware
+}
+
+func (m *XMLConversionMiddleware) Name() string {
+	return "XMLConversionMiddleware"
+}
+
+func (m *XMLConversionMiddleware) EnabledForSpec() bool {
+	for _, version := range m.Spec.VersionData.Versions {
+		if len(version.ExtendedPaths.ConvertXML) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ProcessRequest converts the body of requests sending JSON. Requests without
+// a body, or sending anything else, are proxied as they are.
+func (m *XMLConversionMiddleware) ProcessRequest(w http.ResponseWriter, r *http.Request, _ interface{}) (error, int) {
+	_, versionPaths, _, _ := m.Spec.Version(r)
+	found, meta := m.Spec.CheckSpecMatchesStatus(r, versionPaths, XMLConverted)
+	if !found || !isJSONContentType(r.Header.Get(headers.ContentType)) {
+		return nil, http.StatusOK
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if len(bytes.TrimSpace(body)) == 0 {
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		return nil, http.StatusOK
+	}
+
+	conversion := meta.(*apidef.XMLConversionMeta)
+	converted, err := jsonToXML(body, conversion)
+	if err != nil {
+		m.Logger().WithError(err).Error("Failed to convert request body to XML")
+		return errors.New("Request body is not valid JSON"), http.StatusBadRequest
+	}
+
+	r.Body = ioutil.NopCloser(bytes.NewReader(converted))
+	r.ContentLength = int64(len(converted))
+	r.Header.Set(headers.ContentLength, strconv.Itoa(len(converted)))
+	if conversion.SOAPEnvelope {
+		r.Header.Set(headers.ContentType, "text/xml; charset=utf-8")
+		if conversion.SOAPAction != "" {
+			r.Header.Set("SOAPAction", `"`+conversion.SOAPAction+`"`)
+		}
+	} else {
+		r.Header.Set(headers.ContentType, "application/xml")
+	}
+	return nil, http.StatusOK
+}
+
+// isJSONContentType tells whether a content type is JSON, including the
+// structured syntax suffix of types like application/problem+json.
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// isXMLContentType tells whether a content type is XML.
+func isXMLContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml")
+}
+
+// jsonToXML converts a JSON document to XML. Documents are rendered in the
+// root element of the conversion, their only key otherwise, and wrapped in a
+// SOAP envelope if enabled.
+func jsonToXML(body []byte, conversion *apidef.XMLConversionMeta) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	// Numbers are rendered as they were sent
+	dec.UseNumber()
+	var data interface{}
+	if err := dec.Decode(&data); err != nil {
+		return nil, err
+	}
+
+	data = renameXMLKeys(data, conversion.AttributePrefix, mxjAttributePrefix, conversion.TextKey, mxjTextKey)
+	doc, ok := data.(map[string]interface{})
+	if !ok {
+		doc = map[string]interface{}{"value": data}
+	}
+
+	var converted []byte
+	var err error
+	if conversion.RootElement != "" {
+		converted, err = mxj.Map(doc).Xml(conversion.RootElement)
+	} else {
+		converted, err = mxj.Map(doc).Xml()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	out.WriteString(xml.Header)
+	if conversion.SOAPEnvelope {
+		out.WriteString(`<soap:Envelope xmlns:soap="` + soapEnvelopeNamespace + `"><soap:Body>`)
+		out.Write(converted)
+		out.WriteString(`</soap:Body></soap:Envelope>`)
+	} else {
+		out.Write(converted)
+	}
+	return out.Bytes(), nil
+}
+
+// xmlToJSON converts an XML document to JSON, unwrapping the body of SOAP
+// envelopes if enabled.
+func xmlToJSON(body []byte, conversion *apidef.XMLConversionMeta) ([]byte, error) {
+	mxj.XmlCharsetReader = WrappedCharsetReader
+	doc, err := mxj.NewMapXml(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var data interface{} = map[string]interface{}(doc)
+	if conversion.SOAPEnvelope {
+		// Namespace prefixes are dropped from element names
+		envelope, _ := doc["Envelope"].(map[string]interface{})
+		if soapBody, ok := envelope["Body"].(map[string]interface{}); ok {
+			content := make(map[string]interface{}, len(soapBody))
+			for key, value := range soapBody {
+				if !strings.HasPrefix(key, mxjAttributePrefix) {
+					content[key] = value
+				}
+			}
+			data = content
+		}
+	}
+
+	data = renameXMLKeys(data, mxjAttributePrefix, conversion.AttributePrefix, mxjTextKey, conversion.TextKey)
+	return json.Marshal(data)
+}
+
+// renameXMLKeys renames the attribute and text keys of a document from one
+// mapping to another. Empty mappings stand for the mxj ones.
+func renameXMLKeys(data interface{}, fromPrefix, toPrefix, fromText, toText string) interface{} {
+	if fromPrefix == "" {
+		fromPrefix = mxjAttributePrefix
+	}
+	if toPrefix == "" {
+		toPrefix = mxjAttributePrefix
+	}
+	if fromText == "" {
+		fromText = mxjTextKey
+	}
+	if toText == "" {
+		toText = mxjTextKey
+	}
+	if fromPrefix == toPrefix && fromText == toText {
+		return data
+	}
+
+	var rename func(interface{}) interface{}
+	rename = func(value interface{}) interface{} {
+		switch value := value.(type) {
+		case map[string]interface{}:
+			renamed := make(map[string]interface{}, len(value))
+			for key, child := range value {
+				switch {
+				case key == fromText:
+					key = toText
+				case strings.HasPrefix(key, fromPrefix):
+					key = toPrefix + strings.TrimPrefix(key, fromPrefix)
+				}
+				renamed[key] = rename(child)
+			}
+			return renamed
+		case []interface{}:
+			for i, child := range value {
+				value[i] = rename(child)
+			}
+		}
+		return value
+	}
+	return rename(data)
+}
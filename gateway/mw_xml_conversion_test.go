@@ -0,0 +1,91 @@
+package gateway
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestJSONToXML(t *testing.T) {
+	conversion := &apidef.XMLConversionMeta{RootElement: "GetPrice", AttributePrefix: "@", TextKey: "value"}
+	xmlBody, err := jsonToXML([]byte(`{"item":{"@currency":"EUR","value":"apple"},"quantity":3}`), conversion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Converting back gives the same document
+	jsonBody, err := xmlToJSON(xmlBody, conversion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, want interface{}
+	json.Unmarshal(jsonBody, &got)
+	json.Unmarshal([]byte(`{"GetPrice":{"item":{"@currency":"EUR","value":"apple"},"quantity":"3"}}`), &want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v from %s", want, got, xmlBody)
+	}
+}
+
+func TestXMLConversion(t *testing.T) {
+	var upstreamBody, upstreamContentType, upstreamAction string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		upstreamBody = string(body)
+		upstreamContentType = r.Header.Get(headers.ContentType)
+		upstreamAction = r.Header.Get("SOAPAction")
+
+		w.Header().Set(headers.ContentType, "text/xml; charset=utf-8")
+		w.Write([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+			`<GetPriceResponse><Price currency="EUR">1.5</Price></GetPriceResponse></soap:Body></soap:Envelope>`))
+	}))
+	defer upstream.Close()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.TargetURL = upstream.URL
+		spec.ResponseProcessors = []apidef.ResponseProcessor{{Name: "response_xml_to_json"}}
+		UpdateAPIVersion(spec, "v1", func(v *apidef.VersionInfo) {
+			v.ExtendedPaths.ConvertXML = []apidef.XMLConversionMeta{{
+				Path:         "/price",
+				Method:       http.MethodPost,
+				RootElement:  "GetPrice",
+				SOAPEnvelope: true,
+				SOAPAction:   "urn:GetPrice",
+			}}
+		})
+	})
+
+	jsonHeaders := map[string]string{headers.ContentType: headers.ApplicationJSON}
+	ts.Run(t, []test.TestCase{
+		{Method: http.MethodPost, Path: "/price", Data: `{"item":"apple"}`, Headers: jsonHeaders, Code: http.StatusOK,
+			BodyMatch: `{"GetPriceResponse":{"Price":{"#text":"1.5","-currency":"EUR"}}}`, HeadersMatch: jsonHeaders},
+		{Method: http.MethodPost, Path: "/price", Data: `{"item":`, Headers: jsonHeaders, Code: http.StatusBadRequest},
+	}...)
+
+	if !strings.Contains(upstreamBody, `<soap:Body><GetPrice><item>apple</item></GetPrice></soap:Body>`) {
+		t.Errorf("Expected the request in a SOAP envelope, got %s", upstreamBody)
+	}
+	if upstreamContentType != "text/xml; charset=utf-8" || upstreamAction != `"urn:GetPrice"` {
+		t.Errorf("Expected a SOAP request, got %q with action %q", upstreamContentType, upstreamAction)
+	}
+
+	// Clients accepting XML get the response of the upstream
+	ts.Run(t, test.TestCase{
+		Method: http.MethodPost, Path: "/price", Data: `<GetPrice/>`, Headers: map[string]string{headers.Accept: "text/xml"},
+		Code: http.StatusOK, BodyMatch: `<soap:Envelope`,
+	})
+	if upstreamBody != `<GetPrice/>` {
+		t.Errorf("Expected XML requests to be proxied as they are, got %s", upstreamBody)
+	}
+}
@@ -284,6 +284,17 @@ func (o *OAuthManager) HandleAccess(r *http.Request) *osin.Response {
 	if err := JSONToFormValues(r); err != nil {
 		log.Errorf("trying to set url values decoded from json body :%v", err)
 	}
+
+	// Tokens requested with a DPoP proof are bound to its key
+	var dpopThumbprint string
+	if proof := r.Header.Get(headers.DPoP); proof != "" && o.API.DPoP.Enabled {
+		var err error
+		if dpopThumbprint, err = validateDPoPProof(r, o.API, proof, ""); err != nil {
+			resp.SetError("invalid_dpop_proof", err.Error())
+			return resp
+		}
+	}
+
 	var username string
 	if ar := o.OsinServer.HandleAccessRequest(resp, r); ar != nil {
 
@@ -350,6 +361,13 @@ func (o *OAuthManager) HandleAccess(r *http.Request) *osin.Response {
 		o.OsinServer.FinishAccessRequest(resp, r, ar)
 
 		new_token, foundNewToken := resp.Output["access_token"]
+		if foundNewToken {
+			o.bindAccessToken(r, new_token.(string), dpopThumbprint)
+			if dpopThumbprint != "" {
+				resp.Output["token_type"] = dpopTokenScheme
+			}
+		}
+
 		if username != "" && foundNewToken {
 			log.Debug("Updating token data in key")
 			if session.OauthKeys == nil {
@@ -393,6 +411,34 @@ func (o *OAuthManager) HandleAccess(r *http.Request) *osin.Response {
 	return resp
 }
 
+// bindAccessToken binds a new access token to the client certificate of the
+// token request and the key of its DPoP proof, so that it is only valid with
+// them.
+func (o *OAuthManager) bindAccessToken(r *http.Request, token, dpopThumbprint string) {
+	var fingerprint string
+	if o.API.CertificateBoundTokens {
+		if fingerprint = clientCertificateFingerprint(r); fingerprint == "" {
+			log.Warning("[OAuth] Access token requested without client certificate, token not bound to it")
+		}
+	}
+	if fingerprint == "" && dpopThumbprint == "" {
+		return
+	}
+
+	session, found := o.API.SessionManager.SessionDetail(token, false)
+	if !found {
+		log.Error("[OAuth] Could not find the session of the new access token to bind")
+		return
+	}
+
+	session.CertificateBinding = fingerprint
+	session.DPoPBinding = dpopThumbprint
+	lifetime := session.Expires - time.Now().Unix()
+	if err := o.API.SessionManager.UpdateSession(token, &session, lifetime, false); err != nil {
+		log.WithError(err).Error("[OAuth] Could not bind access token to client certificate")
+	}
+}
+
 // These enums fix the prefix to use when storing various OAuth keys and data, since we
 // delegate everything to the osin framework
 const (
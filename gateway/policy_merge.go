@@ -0,0 +1,198 @@
+package gateway
+
+import (
+	"math"
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/mux"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+// Strategies to merge the policies of a key, set by policies.merge_strategy.
+// Without one, policies setting the same limits can't be applied together.
+const (
+	policyMergePriority        = "priority"
+	policyMergeMostRestrictive = "most_restrictive"
+)
+
+// policyExplanation records which policies the limits of a session came from,
+// by field, and the conflicts between policies which were resolved. Fields
+// of an API are prefixed by "api.<api id>.". A nil explanation records
+// nothing.
+type policyExplanation struct {
+	Sources   map[string][]string `json:"sources"`
+	Conflicts []policyConflict    `json:"conflicts"`
+}
+
+type policyConflict struct {
+	Field    string   `json:"field"`
+	Policies []string `json:"policies"`
+	Winner   string   `json:"winner"`
+}
+
+func newPolicyExplanation() *policyExplanation {
+	return &policyExplanation{
+		Sources:   make(map[string][]string),
+		Conflicts: []policyConflict{},
+	}
+}
+
+func (e *policyExplanation) set(field, policyID string) {
+	if e == nil {
+		return
+	}
+	e.Sources[field] = []string{policyID}
+}
+
+// conflict records that a policy set a field which another policy had set,
+// and whether it took precedence.
+func (e *policyExplanation) conflict(field, policyID string, wins bool) {
+	if e == nil {
+		return
+	}
+
+	current := e.Sources[field]
+	winner := policyID
+	if !wins && len(current) > 0 {
+		winner = current[0]
+	}
+	e.Conflicts = append(e.Conflicts, policyConflict{
+		Field:    field,
+		Policies: append(append([]string{}, current...), policyID),
+		Winner:   winner,
+	})
+
+	if wins {
+		e.set(field, policyID)
+	}
+}
+
+func isPolicyMergeStrategy(strategy string) bool {
+	return strategy == policyMergePriority || strategy == policyMergeMostRestrictive
+}
+
+// orderPolicies sorts policies from the highest priority when merging them
+// by priority, so that the first policy setting a limit wins. Policies of the
+// same priority keep the order of the key.
+func orderPolicies(policies []user.Policy, strategy string) {
+	if strategy != policyMergePriority {
+		return
+	}
+	sort.SliceStable(policies, func(i, j int) bool {
+		return policies[i].Priority > policies[j].Priority
+	})
+}
+
+// mergeWins tells whether a limit allowing candidate requests per second takes
+// precedence over the current one, allowing current. Only the most
+// restrictive strategy lets later policies win, and only when stricter.
+func mergeWins(strategy string, current, candidate float64) bool {
+	return strategy == policyMergeMostRestrictive && candidate < current
+}
+
+// quotaAllowance is the number of requests per second a quota allows on
+// average. Quotas which don't renew allow their maximum.
+func quotaAllowance(max, renewalRate int64) float64 {
+	switch {
+	case max < 0:
+		return math.Inf(1)
+	case renewalRate <= 0:
+		return float64(max)
+	}
+	return float64(max) / float64(renewalRate)
+}
+
+// rateAllowance is the number of requests per second a rate limit allows.
+func rateAllowance(rate, per float64) float64 {
+	if per <= 0 {
+		return math.Inf(1)
+	}
+	return rate / per
+}
+
+// mergeAPIAccess resolves the limits of an API which two policies set, and
+// reports if the quota of the candidate policy won. Only the quota and the
+// rate limit are merged: the access of the current policy, like versions and
+// allowed URLs, is kept whatever the strategy.
+func mergeAPIAccess(strategy string, current, candidate user.AccessDefinition, policyID string, explanation *policyExplanation) (user.AccessDefinition, bool) {
+	field := "api." + current.APIID
+	limit := *current.Limit
+
+	quotaWins := mergeWins(strategy,
+		quotaAllowance(limit.QuotaMax, limit.QuotaRenewalRate),
+		quotaAllowance(candidate.Limit.QuotaMax, candidate.Limit.QuotaRenewalRate))
+	explanation.conflict(field+".quota", policyID, quotaWins)
+	if quotaWins {
+		limit.QuotaMax = candidate.Limit.QuotaMax
+		limit.QuotaRenewalRate = candidate.Limit.QuotaRenewalRate
+	}
+
+	rateWins := mergeWins(strategy,
+		rateAllowance(limit.Rate, limit.Per),
+		rateAllowance(candidate.Limit.Rate, candidate.Limit.Per))
+	explanation.conflict(field+".rate_limit", policyID, rateWins)
+	if rateWins {
+		limit.Rate = candidate.Limit.Rate
+		limit.Per = candidate.Limit.Per
+		limit.Burst = candidate.Limit.Burst
+		limit.ThrottleInterval = candidate.Limit.ThrottleInterval
+		limit.ThrottleRetryLimit = candidate.Limit.ThrottleRetryLimit
+		limit.ThrottleQueueSize = candidate.Limit.ThrottleQueueSize
+		limit.ThrottleMaxWait = candidate.Limit.ThrottleMaxWait
+		limit.MaxConcurrent = candidate.Limit.MaxConcurrent
+	}
+
+	current.Limit = &limit
+	return current, quotaWins
+}
+
+type apiKeyPolicies struct {
+	Policies         []string                         `json:"policies"`
+	MergeStrategy    string                           `json:"merge_strategy"`
+	QuotaMax         int64                            `json:"quota_max"`
+	QuotaRenewalRate int64                            `json:"quota_renewal_rate"`
+	Rate             float64                          `json:"rate"`
+	Per              float64                          `json:"per"`
+	AccessRights     map[string]user.AccessDefinition `json:"access_rights"`
+	policyExplanation
+}
+
+// keyPoliciesHandler explains the limits a key gets from its policies: which
+// policy each of them came from, and how conflicts between policies were
+// resolved.
+func keyPoliciesHandler(w http.ResponseWriter, r *http.Request) {
+	keyName := mux.Vars(r)["keyName"]
+	apiID := r.URL.Query().Get("api_id")
+	isHashed := r.URL.Query().Get("hashed") != ""
+	if isHashed && !config.Global().HashKeys {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Key requested by hash but key hashing is not enabled"))
+		return
+	}
+
+	session, found := getKeyDetail(keyName, apiID, isHashed)
+	if !found {
+		doJSONWrite(w, http.StatusNotFound, apiError("Key not found"))
+		return
+	}
+
+	explanation := newPolicyExplanation()
+	mw := BaseMiddleware{}
+	if err := mw.applyPolicies(&session, explanation); err != nil {
+		doJSONWrite(w, http.StatusBadRequest, apiError(err.Error()))
+		return
+	}
+
+	doJSONWrite(w, http.StatusOK, apiKeyPolicies{
+		Policies:          session.PolicyIDs(),
+		MergeStrategy:     config.Global().Policies.MergeStrategy,
+		QuotaMax:          session.QuotaMax,
+		QuotaRenewalRate:  session.QuotaRenewalRate,
+		Rate:              session.Rate,
+		Per:               session.Per,
+		AccessRights:      session.AccessRights,
+		policyExplanation: *explanation,
+	})
+}
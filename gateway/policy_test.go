@@ -8,6 +8,7 @@ import (
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/lonelycode/go-uuid/uuid"
 
@@ -824,3 +825,221 @@ func TestPerAPIPolicyUpdate(t *testing.T) {
 		},
 	}...)
 }
+
+func TestApplyPoliciesMergeStrategy(t *testing.T) {
+	policiesMu.Lock()
+	policiesByID = map[string]user.Policy{
+		"high": {
+			ID:               "high",
+			Priority:         10,
+			QuotaMax:         100,
+			QuotaRenewalRate: 60,
+			Rate:             10,
+			Per:              1,
+			AccessRights:     map[string]user.AccessDefinition{"a": {APIID: "a"}},
+		},
+		"low": {
+			ID:               "low",
+			Priority:         1,
+			Partitions:       user.PolicyPartitions{Quota: true, RateLimit: true, Acl: true},
+			QuotaMax:         5,
+			QuotaRenewalRate: 60,
+			Rate:             100,
+			Per:              1,
+			AccessRights: map[string]user.AccessDefinition{
+				"a": {APIID: "a", Versions: []string{"v2"}},
+				"b": {APIID: "b"},
+			},
+		},
+		"per_api_high": {
+			ID:         "per_api_high",
+			Priority:   2,
+			Partitions: user.PolicyPartitions{PerAPI: true},
+			QuotaRules: user.QuotaRules{Reset: user.QuotaResetMonthly, CarryOver: true},
+			AccessRights: map[string]user.AccessDefinition{"a": {
+				APIID: "a",
+				Limit: &user.APILimit{QuotaMax: 10, QuotaRenewalRate: 60, Rate: 1, Per: 1},
+			}},
+		},
+		"per_api_low": {
+			ID:         "per_api_low",
+			Partitions: user.PolicyPartitions{PerAPI: true},
+			QuotaRules: user.QuotaRules{Reset: user.QuotaResetMonthly},
+			AccessRights: map[string]user.AccessDefinition{"a": {
+				APIID: "a",
+				Limit: &user.APILimit{QuotaMax: 1, QuotaRenewalRate: 60, Rate: 50, Per: 1},
+			}},
+		},
+	}
+	policiesMu.Unlock()
+	defer ResetTestConfig()
+
+	apply := func(strategy string, policies ...string) (*user.SessionState, *policyExplanation, error) {
+		globalConf := config.Global()
+		globalConf.Policies.MergeStrategy = strategy
+		config.SetGlobal(globalConf)
+
+		session := &user.SessionState{}
+		session.SetPolicies(policies...)
+		explanation := newPolicyExplanation()
+		err := BaseMiddleware{}.applyPolicies(session, explanation)
+		return session, explanation, err
+	}
+
+	t.Run("Without strategy", func(t *testing.T) {
+		if _, _, err := apply("", "low", "high"); err == nil {
+			t.Error("Conflicting policies shouldn't apply without a merge strategy")
+		}
+	})
+
+	t.Run("Priority", func(t *testing.T) {
+		session, explanation, err := apply(policyMergePriority, "low", "high")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if session.QuotaMax != 100 || session.Rate != 10 {
+			t.Errorf("Limits should come from the highest priority, got quota %d and rate %v", session.QuotaMax, session.Rate)
+		}
+		if len(session.AccessRights["a"].Versions) != 0 || len(session.AccessRights) != 2 {
+			t.Errorf("Access should come from the highest priority granting it, got %+v", session.AccessRights)
+		}
+		if sources := explanation.Sources; sources["quota"][0] != "high" || sources["api.b.acl"][0] != "low" {
+			t.Errorf("Unexpected sources: %v", sources)
+		}
+		if len(explanation.Conflicts) != 2 || explanation.Conflicts[0].Winner != "high" {
+			t.Errorf("Unexpected conflicts: %+v", explanation.Conflicts)
+		}
+	})
+
+	t.Run("Most restrictive", func(t *testing.T) {
+		session, explanation, err := apply(policyMergeMostRestrictive, "low", "high")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if session.QuotaMax != 5 || session.Rate != 10 {
+			t.Errorf("The most restrictive limits should apply, got quota %d and rate %v", session.QuotaMax, session.Rate)
+		}
+		if sources := explanation.Sources; sources["quota"][0] != "low" || sources["rate_limit"][0] != "high" {
+			t.Errorf("Unexpected sources: %v", sources)
+		}
+	})
+
+	t.Run("Per API", func(t *testing.T) {
+		session, explanation, err := apply(policyMergeMostRestrictive, "per_api_high", "per_api_low")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if limit := session.AccessRights["a"].Limit; limit.QuotaMax != 1 || limit.Rate != 1 {
+			t.Errorf("The most restrictive limits of the API should apply, got %+v", limit)
+		}
+		if sources := explanation.Sources; sources["api.a.quota"][0] != "per_api_low" || sources["api.a.rate_limit"][0] != "per_api_high" {
+			t.Errorf("Unexpected sources: %v", sources)
+		}
+		if session.QuotaRules.CarryOver || explanation.Sources["quota_rules"][0] != "per_api_low" {
+			t.Errorf("Quota rules should come from the policy of the quota, got %+v", session.QuotaRules)
+		}
+
+		session, explanation, _ = apply(policyMergePriority, "per_api_low", "per_api_high")
+		if limit := session.AccessRights["a"].Limit; limit.QuotaMax != 10 || limit.Rate != 1 {
+			t.Errorf("The limits of the highest priority should apply, got %+v", limit)
+		}
+		if !session.QuotaRules.CarryOver || explanation.Sources["quota_rules"][0] != "per_api_high" {
+			t.Errorf("Quota rules should come from the policy of the quota, got %+v", session.QuotaRules)
+		}
+	})
+}
+
+func TestKeyPoliciesHandler(t *testing.T) {
+	globalConf := config.Global()
+	globalConf.Policies.MergeStrategy = policyMergePriority
+	config.SetGlobal(globalConf)
+	defer ResetTestConfig()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	low := CreatePolicy(func(p *user.Policy) {
+		p.Partitions = user.PolicyPartitions{Quota: true}
+		p.QuotaMax = 5
+	})
+	high := CreatePolicy(func(p *user.Policy) {
+		p.Partitions = user.PolicyPartitions{Quota: true}
+		p.Priority = 1
+		p.QuotaMax = 100
+	})
+	key := CreateSession(func(s *user.SessionState) {
+		s.ApplyPolicies = []string{low, high}
+	})
+
+	ts.Run(t, test.TestCase{Path: "/tyk/keys/unknown/policies", AdminAuth: true, Code: http.StatusNotFound})
+	resp, _ := ts.Run(t, test.TestCase{Path: "/tyk/keys/" + key + "/policies", AdminAuth: true, Code: http.StatusOK})
+
+	explained := apiKeyPolicies{}
+	json.NewDecoder(resp.Body).Decode(&explained)
+	if explained.QuotaMax != 100 || explained.Sources["quota"][0] != high {
+		t.Errorf("Quota should come from the policy of the highest priority: %+v", explained)
+	}
+	if len(explained.Conflicts) != 1 || explained.Conflicts[0].Winner != high {
+		t.Errorf("Unexpected conflicts: %+v", explained.Conflicts)
+	}
+}
+
+func TestPolicySchedule(t *testing.T) {
+	// Monday 8:30 in UTC, 10:30 in Paris
+	now := time.Date(2020, time.June, 1, 8, 30, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name     string
+		schedule user.PolicySchedule
+		active   bool
+		err      bool
+	}{
+		{"Unscheduled", user.PolicySchedule{}, true, false},
+		{"Not started", user.PolicySchedule{Start: now.Add(time.Hour).Unix()}, false, false},
+		{"Ended", user.PolicySchedule{Start: 1, End: now.Unix()}, false, false},
+		{"Within dates", user.PolicySchedule{Start: 1, End: now.Add(time.Hour).Unix()}, true, false},
+		{"Business hours", user.PolicySchedule{Windows: []string{"* 9-17 * * 1-5"}}, false, false},
+		{"Business hours in timezone", user.PolicySchedule{Timezone: "Europe/Paris", Windows: []string{"* 9-17 * * 1-5"}}, true, false},
+		{"Weekends", user.PolicySchedule{Windows: []string{"* * * * 6,7", "0-29 8 * * *"}}, false, false},
+		{"Steps", user.PolicySchedule{Windows: []string{"*/15 */4 1 6 *"}}, true, false},
+		{"Day of month or week", user.PolicySchedule{Windows: []string{"* * 15 * 1"}}, true, false},
+		{"Unknown timezone", user.PolicySchedule{Timezone: "Nowhere/Somewhere"}, false, true},
+		{"Invalid window", user.PolicySchedule{Windows: []string{"* 9-25 * * *"}}, false, true},
+		{"Missing fields", user.PolicySchedule{Windows: []string{"* 9-17"}}, false, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			active, err := tc.schedule.Active(now)
+			if (err != nil) != tc.err {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if active != tc.active {
+				t.Errorf("Expected active %v, got %v", tc.active, active)
+			}
+		})
+	}
+
+	t.Run("Keys of scheduled policies", func(t *testing.T) {
+		ts := StartTest()
+		defer ts.Close()
+
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.UseKeylessAccess = false
+			spec.Proxy.ListenPath = "/"
+		})
+
+		scheduledKey := func(schedule user.PolicySchedule) string {
+			policyID := CreatePolicy(func(p *user.Policy) {
+				p.Schedule = schedule
+			})
+			return CreateSession(func(s *user.SessionState) {
+				s.ApplyPolicies = []string{policyID}
+			})
+		}
+
+		ts.Run(t, []test.TestCase{
+			{Headers: map[string]string{"Authorization": scheduledKey(user.PolicySchedule{End: time.Now().Add(time.Hour).Unix()})}, Code: http.StatusOK},
+			{Headers: map[string]string{"Authorization": scheduledKey(user.PolicySchedule{End: time.Now().Unix()})}, Code: http.StatusForbidden},
+			{Headers: map[string]string{"Authorization": scheduledKey(user.PolicySchedule{Windows: []string{"invalid"}})}, Code: http.StatusForbidden},
+		}...)
+	})
+}
@@ -32,6 +32,9 @@ const (
 	NoticeGatewayDRLNotification NotificationCommand = "NoticeGatewayDRLNotification"
 	NoticeGatewayLENotification  NotificationCommand = "NoticeGatewayLENotification"
 	KeySpaceUpdateNotification   NotificationCommand = "KeySpaceUpdateNotification"
+	NoticeCertificateChanged     NotificationCommand = "CertificateChanged"
+	NoticeMaintenanceChanged     NotificationCommand = "MaintenanceChanged"
+	NoticeVersionRolledBack      NotificationCommand = "VersionRolledBack"
 )
 
 // Notification is a type that encodes a message published to a pub sub channel (shared between implementations)
@@ -103,6 +106,12 @@ func handleRedisEvent(v interface{}, handled func(NotificationCommand), reloaded
 		reloadURLStructure(reloaded)
 	case KeySpaceUpdateNotification:
 		handleKeySpaceEventCacheFlush(notif.Payload)
+	case NoticeCertificateChanged:
+		handleCertificateChanged(notif.Payload)
+	case NoticeMaintenanceChanged:
+		handleMaintenanceChanged(notif.Payload)
+	case NoticeVersionRolledBack:
+		handleVersionRolledBack(notif.Payload)
 	default:
 		pubSubLog.Warnf("Unknown notification command: %q", notif.Command)
 		return
@@ -134,7 +143,7 @@ var notificationVerifier goverify.Verifier
 func isPayloadSignatureValid(notification Notification) bool {
 
 	switch notification.Command {
-	case NoticeGatewayDRLNotification, NoticeGatewayLENotification:
+	case NoticeGatewayDRLNotification, NoticeGatewayLENotification, NoticeCertificateChanged, NoticeMaintenanceChanged, NoticeVersionRolledBack:
 		// Gateway to gateway
 		return true
 	}
@@ -0,0 +1,121 @@
+package gateway
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/TykTechnologies/tyk/config"
+)
+
+var (
+	errBodyTooLarge   = errors.New("request body is too large")
+	errBodyBufferFull = errors.New("request body buffer of the node is full")
+)
+
+// bufferedBodyBytes is the size of the request bodies the node holds in
+// memory.
+var bufferedBodyBytes int64
+
+// reserveBodyBuffer counts n more buffered bytes, unless they would exceed
+// the max_buffered_request_bytes of the node.
+func reserveBodyBuffer(n int64) bool {
+	max := config.Global().MaxBufferedRequestBytes
+	if atomic.AddInt64(&bufferedBodyBytes, n) > max && max > 0 {
+		atomic.AddInt64(&bufferedBodyBytes, -n)
+		return false
+	}
+	return true
+}
+
+func releaseBodyBuffer(n int64) {
+	atomic.AddInt64(&bufferedBodyBytes, -n)
+}
+
+// lazyBody buffers a request body the first time it is read, so that
+// requests rejected by their size are never held in memory. Once buffered,
+// the body is re-read from the start after each EOF, like nopCloser.
+type lazyBody struct {
+	body     io.ReadCloser
+	buffered *bytes.Reader
+	reserved int64
+	err      error
+}
+
+// newLazyBody wraps the body of a request. Room in the buffer of the node is
+// only reserved as the body is read, so that the length stated by a client
+// which never sends its body holds no memory.
+func newLazyBody(r *http.Request) *lazyBody {
+	return &lazyBody{body: r.Body}
+}
+
+// buffer reads the body in memory, failing with errBodyTooLarge once more
+// than limit bytes are read if limit is positive. Each chunk is reserved in
+// the buffer of the node as it is read, after being checked against limit.
+func (b *lazyBody) buffer(limit int64) error {
+	if b.buffered != nil || b.err != nil {
+		if b.err == nil && limit > 0 && b.buffered.Size() > limit {
+			return errBodyTooLarge
+		}
+		return b.err
+	}
+	defer b.body.Close()
+
+	var buf bytes.Buffer
+	chunk := make([]byte, 32*1024)
+	for {
+		n, err := b.body.Read(chunk)
+		if n > 0 {
+			if limit > 0 && int64(buf.Len()+n) > limit {
+				return b.fail(errBodyTooLarge)
+			}
+			if !reserveBodyBuffer(int64(n)) {
+				return b.fail(errBodyBufferFull)
+			}
+			b.reserved += int64(n)
+			buf.Write(chunk[:n])
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return b.fail(err)
+		}
+	}
+
+	b.buffered = bytes.NewReader(buf.Bytes())
+	return nil
+}
+
+// fail drops what was read of the body, which fails to be read again.
+func (b *lazyBody) fail(err error) error {
+	b.release()
+	b.err = err
+	return err
+}
+
+func (b *lazyBody) Read(p []byte) (int, error) {
+	if err := b.buffer(0); err != nil {
+		return 0, err
+	}
+
+	n, err := b.buffered.Read(p)
+	if err == io.EOF { // move to start to have it ready for next read cycle
+		b.buffered.Seek(0, io.SeekStart)
+	}
+	return n, err
+}
+
+// Close is a no-op, the body is closed once buffered.
+func (b *lazyBody) Close() error {
+	return nil
+}
+
+// release gives the bytes of the body back to the buffer of the node, once
+// the request is served.
+func (b *lazyBody) release() {
+	releaseBodyBuffer(b.reserved)
+	b.reserved = 0
+}
@@ -0,0 +1,115 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/TykTechnologies/murmur3"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+type ETagOptions struct {
+	// Weak generates weak ETags, for upstreams which only promise responses
+	// to be equivalent.
+	Weak bool `mapstructure:"weak" bson:"weak" json:"weak"`
+}
+
+// ResponseETagMiddleware adds an ETag, and a Last-Modified time, to successful
+// responses which lack them. Once cached, responses are validated with them
+// without hitting the upstream.
+type ResponseETagMiddleware struct {
+	Spec   *APISpec
+	config ETagOptions
+}
+
+func (ResponseETagMiddleware) Name() string {
+	return "ResponseETagMiddleware"
+}
+
+func (h *ResponseETagMiddleware) Init(c interface{}, spec *APISpec) error {
+	if err := mapstructure.Decode(c, &h.config); err != nil {
+		return err
+	}
+	h.Spec = spec
+	return nil
+}
+
+func (h *ResponseETagMiddleware) HandleResponse(rw http.ResponseWriter, res *http.Response, req *http.Request, ses *user.SessionState) error {
+	if res.StatusCode != http.StatusOK || IsSSE(res.Header) {
+		return nil
+	}
+
+	if res.Header.Get(headers.LastModified) == "" {
+		res.Header.Set(headers.LastModified, time.Now().UTC().Format(http.TimeFormat))
+	}
+	if res.Header.Get(headers.ETag) != "" {
+		return nil
+	}
+
+	// The ETag is computed from the body as it is sent, encoded or not
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	m := murmur3.New128()
+	m.Write(body)
+	etag := `"` + hex.EncodeToString(m.Sum(nil)) + `"`
+	if h.config.Weak {
+		etag = "W/" + etag
+	}
+	res.Header.Set(headers.ETag, etag)
+	return nil
+}
+
+// notModified tells whether the conditional headers of a request are met by
+// a response, which is then answered with a 304. If-None-Match takes
+// precedence over If-Modified-Since, as in RFC 7232.
+func notModified(req *http.Request, h http.Header) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+
+	if ifNoneMatch := req.Header.Get(headers.IfNoneMatch); ifNoneMatch != "" {
+		return etagMatches(ifNoneMatch, h.Get(headers.ETag))
+	}
+
+	ifModifiedSince := req.Header.Get(headers.IfModifiedSince)
+	if ifModifiedSince == "" {
+		return false
+	}
+	since, err := http.ParseTime(ifModifiedSince)
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(h.Get(headers.LastModified))
+	if err != nil {
+		return false
+	}
+	return !lastModified.After(since)
+}
+
+// etagMatches tells whether an ETag is in the list of an If-None-Match
+// header, comparing them weakly.
+func etagMatches(list, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
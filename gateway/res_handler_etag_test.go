@@ -0,0 +1,81 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestETagMatches(t *testing.T) {
+	tests := []struct {
+		list, etag string
+		match      bool
+	}{
+		{`"a"`, `"a"`, true},
+		{`"b", "a"`, `"a"`, true},
+		{`W/"a"`, `"a"`, true},
+		{`"a"`, `W/"a"`, true},
+		{`*`, `"a"`, true},
+		{`"b"`, `"a"`, false},
+		{`*`, ``, false},
+	}
+	for _, tc := range tests {
+		if got := etagMatches(tc.list, tc.etag); got != tc.match {
+			t.Errorf("etagMatches(%q, %q) = %v, want %v", tc.list, tc.etag, got, tc.match)
+		}
+	}
+}
+
+func TestResponseETagMiddleware(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+	cache := storage.RedisCluster{KeyPrefix: "cache-"}
+	defer cache.DeleteScanMatch("*")
+
+	var hits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Write([]byte("body"))
+	}))
+	defer upstream.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.TargetURL = upstream.URL
+		spec.ResponseProcessors = []apidef.ResponseProcessor{{Name: "etag"}}
+		spec.CacheOptions = apidef.CacheOptions{
+			CacheTimeout:         120,
+			EnableCache:          true,
+			CacheAllSafeRequests: true,
+		}
+	})
+
+	resp, _ := ts.Run(t, test.TestCase{Path: "/", Code: http.StatusOK, Delay: 10 * time.Millisecond})
+	etag := resp.Header.Get(headers.ETag)
+	lastModified := resp.Header.Get(headers.LastModified)
+	if etag == "" || lastModified == "" {
+		t.Fatalf("Expected an ETag and a Last-Modified time, got %q and %q", etag, lastModified)
+	}
+
+	future := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	past := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	ts.Run(t, []test.TestCase{
+		{Path: "/", Headers: map[string]string{headers.IfNoneMatch: etag}, Code: http.StatusNotModified, BodyNotMatch: "body"},
+		{Path: "/", Headers: map[string]string{headers.IfNoneMatch: `"other"`}, Code: http.StatusOK, BodyMatch: "body"},
+		{Path: "/", Headers: map[string]string{headers.IfModifiedSince: future}, Code: http.StatusNotModified},
+		{Path: "/", Headers: map[string]string{headers.IfModifiedSince: past}, Code: http.StatusOK, BodyMatch: "body"},
+		// If-None-Match takes precedence
+		{Path: "/", Headers: map[string]string{headers.IfNoneMatch: `"other"`, headers.IfModifiedSince: future}, Code: http.StatusOK},
+	}...)
+
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Errorf("Expected conditional requests to be answered from the cache, the upstream got %d requests", n)
+	}
+}
@@ -92,10 +92,25 @@ func (h *ResponseTransformMiddleware) HandleResponse(rw http.ResponseWriter, res
 	}
 	tmeta := meta.(*TransformSpec)
 
+	if tmeta.TemplateData.Streaming && tmeta.TemplateData.Input != apidef.RequestXML {
+		h.streamResponse(res, req, tmeta, logger)
+		return nil
+	}
+
 	respBody := respBodyReader(req, res)
 	body, _ := ioutil.ReadAll(respBody)
 	defer respBody.Close()
 
+	if tmeta.Operations != nil {
+		transformed, err := tmeta.Operations.transformJSON(body, req, h.Spec.EnableContextVars, tmeta.TemplateData.EnableSession)
+		if err != nil {
+			logger.WithError(err).Error("Failed to apply operations to response")
+			transformed = body
+		}
+		h.setBody(res, *bytes.NewBuffer(transformed))
+		return nil
+	}
+
 	// Put into an interface:
 	bodyData := make(map[string]interface{})
 	switch tmeta.TemplateData.Input {
@@ -136,17 +151,7 @@ func (h *ResponseTransformMiddleware) HandleResponse(rw http.ResponseWriter, res
 		}
 	}
 
-	if h.Spec.EnableContextVars {
-		bodyData["_tyk_context"] = ctxGetData(req)
-	}
-
-	if tmeta.TemplateData.EnableSession {
-		if session := ctxGetSession(req); session != nil {
-			bodyData["_tyk_meta"] = session.MetaData
-		} else {
-			logger.Error("Session context was enabled but not found.")
-		}
-	}
+	h.addTemplateMeta(bodyData, req, tmeta, logger)
 
 	// Apply to template
 	var bodyBuffer bytes.Buffer
@@ -154,6 +159,12 @@ func (h *ResponseTransformMiddleware) HandleResponse(rw http.ResponseWriter, res
 		logger.WithError(err).Error("Failed to apply template to request")
 	}
 
+	h.setBody(res, bodyBuffer)
+	return nil
+}
+
+// setBody replaces the body of a response with a transformed one.
+func (h *ResponseTransformMiddleware) setBody(res *http.Response, bodyBuffer bytes.Buffer) {
 	// Re-compress if original upstream response was compressed
 	encoding := res.Header.Get("Content-Encoding")
 	bodyBuffer = compressBuffer(bodyBuffer, encoding)
@@ -161,6 +172,20 @@ func (h *ResponseTransformMiddleware) HandleResponse(rw http.ResponseWriter, res
 	res.ContentLength = int64(bodyBuffer.Len())
 	res.Header.Set("Content-Length", strconv.Itoa(bodyBuffer.Len()))
 	res.Body = ioutil.NopCloser(&bodyBuffer)
+}
 
-	return nil
+// addTemplateMeta adds the context variables and the session metadata a
+// template uses to its data.
+func (h *ResponseTransformMiddleware) addTemplateMeta(bodyData map[string]interface{}, req *http.Request, tmeta *TransformSpec, logger *logrus.Entry) {
+	if h.Spec.EnableContextVars {
+		bodyData["_tyk_context"] = ctxGetData(req)
+	}
+
+	if tmeta.TemplateData.EnableSession {
+		if session := ctxGetSession(req); session != nil {
+			bodyData["_tyk_meta"] = session.MetaData
+		} else {
+			logger.Error("Session context was enabled but not found.")
+		}
+	}
 }
@@ -0,0 +1,265 @@
+package gateway
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/headers"
+)
+
+// streamResponse rewrites a JSON response as it is read from the upstream,
+// applying the template to each item of the array at the stream path of the
+// transform, the body itself if the path is empty. The rest of the body is
+// copied as it is, so that one item at a time is held in memory. Templates
+// are expected to render each item as a JSON value.
+func (h *ResponseTransformMiddleware) streamResponse(res *http.Response, req *http.Request, tmeta *TransformSpec, logger *logrus.Entry) {
+	upstream := res.Body
+	respBody := respBodyReader(req, res)
+	encoding := res.Header.Get(headers.ContentEncoding)
+	pr, pw := io.Pipe()
+
+	go func() {
+		defer upstream.Close()
+		defer respBody.Close()
+
+		out := compressWriter(pw, encoding)
+		w := bufio.NewWriterSize(out, 32*1024)
+		streamer := newJSONStreamer(respBody, w, tmeta.TemplateData.StreamPath, func(item interface{}) error {
+			if tmeta.Operations != nil {
+				meta := transformMeta(req, h.Spec.EnableContextVars, tmeta.TemplateData.EnableSession)
+				transformed, err := json.Marshal(tmeta.Operations.apply(item, meta))
+				if err != nil {
+					return err
+				}
+				_, err = w.Write(transformed)
+				return err
+			}
+
+			var bodyData map[string]interface{}
+			switch item := item.(type) {
+			case map[string]interface{}:
+				bodyData = item
+			case []interface{}:
+				bodyData = map[string]interface{}{"array": item}
+			default:
+				bodyData = map[string]interface{}{"value": item}
+			}
+			h.addTemplateMeta(bodyData, req, tmeta, logger)
+			return tmeta.Template.Execute(w, bodyData)
+		})
+
+		err := streamer.stream()
+		if err == nil {
+			err = w.Flush()
+		}
+		if err == nil {
+			err = out.Close()
+		}
+		if err != nil {
+			logger.WithError(err).Error("Failed to stream transformed response")
+		}
+		pw.CloseWithError(err)
+	}()
+
+	// The length of the body is only known once it is sent
+	res.ContentLength = -1
+	res.Header.Del(headers.ContentLength)
+	res.Body = pr
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// compressWriter compresses what is written to w with the content encoding.
+// Closing it flushes the compressor.
+func compressWriter(w io.Writer, encoding string) io.WriteCloser {
+	switch encoding {
+	case "gzip":
+		return gzip.NewWriter(w)
+	case "deflate":
+		zw, _ := flate.NewWriter(w, 1)
+		return zw
+	}
+	return nopWriteCloser{w}
+}
+
+// jsonStreamer copies a JSON document token by token, handing the items of
+// the array at a path to render instead. Values off the way to the path are
+// copied whole.
+type jsonStreamer struct {
+	dec    *json.Decoder
+	w      *bufio.Writer
+	path   []string
+	render func(item interface{}) error
+}
+
+// newJSONStreamer streams the items of the array at path, a dot separated
+// list of object keys and array indexes.
+func newJSONStreamer(r io.Reader, w *bufio.Writer, path string, render func(item interface{}) error) *jsonStreamer {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	var segments []string
+	if path != "" {
+		segments = strings.Split(path, ".")
+	}
+	return &jsonStreamer{dec: dec, w: w, path: segments, render: render}
+}
+
+func (s *jsonStreamer) stream() error {
+	err := s.value(nil)
+	if err == io.EOF {
+		// Empty bodies stay empty
+		return nil
+	}
+	return err
+}
+
+// onPath tells whether a value is at the stream path or on the way to it.
+func (s *jsonStreamer) onPath(path []string) bool {
+	if len(path) > len(s.path) {
+		return false
+	}
+	for i, segment := range path {
+		if s.path[i] != segment {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *jsonStreamer) value(path []string) error {
+	if !s.onPath(path) {
+		var raw json.RawMessage
+		if err := s.dec.Decode(&raw); err != nil {
+			return err
+		}
+		_, err := s.w.Write(raw)
+		return err
+	}
+
+	tok, err := s.dec.Token()
+	if err != nil {
+		return err
+	}
+	delim, isDelim := tok.(json.Delim)
+
+	if len(path) == len(s.path) {
+		if isDelim && delim == '[' {
+			return s.items()
+		}
+		// Values which aren't arrays are rendered as one item
+		item, err := s.rest(tok)
+		if err != nil {
+			return err
+		}
+		return s.render(item)
+	}
+
+	switch {
+	case isDelim && delim == '{':
+		s.w.WriteByte('{')
+		for i := 0; s.dec.More(); i++ {
+			keyTok, err := s.dec.Token()
+			if err != nil {
+				return err
+			}
+			key, _ := keyTok.(string)
+			if i > 0 {
+				s.w.WriteByte(',')
+			}
+			quoted, _ := json.Marshal(key)
+			s.w.Write(quoted)
+			s.w.WriteByte(':')
+			if err := s.value(append(path, key)); err != nil {
+				return err
+			}
+		}
+		if _, err := s.dec.Token(); err != nil {
+			return err
+		}
+		return s.w.WriteByte('}')
+	case isDelim && delim == '[':
+		s.w.WriteByte('[')
+		for i := 0; s.dec.More(); i++ {
+			if i > 0 {
+				s.w.WriteByte(',')
+			}
+			if err := s.value(append(path, strconv.Itoa(i))); err != nil {
+				return err
+			}
+		}
+		if _, err := s.dec.Token(); err != nil {
+			return err
+		}
+		return s.w.WriteByte(']')
+	}
+
+	// Scalars on the way to the stream path end it early
+	b, err := json.Marshal(tok)
+	if err != nil {
+		return err
+	}
+	_, err = s.w.Write(b)
+	return err
+}
+
+// items renders the items of the array which opening token was read.
+func (s *jsonStreamer) items() error {
+	s.w.WriteByte('[')
+	for i := 0; s.dec.More(); i++ {
+		var item interface{}
+		if err := s.dec.Decode(&item); err != nil {
+			return err
+		}
+		if i > 0 {
+			s.w.WriteByte(',')
+		}
+		if err := s.render(item); err != nil {
+			return err
+		}
+	}
+	if _, err := s.dec.Token(); err != nil {
+		return err
+	}
+	return s.w.WriteByte(']')
+}
+
+// rest decodes the rest of an object or a scalar which first token was read.
+func (s *jsonStreamer) rest(tok json.Token) (interface{}, error) {
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return tok, nil
+	}
+	if delim != '{' {
+		return nil, errors.New("unexpected JSON delimiter " + delim.String())
+	}
+
+	obj := make(map[string]interface{})
+	for s.dec.More() {
+		keyTok, err := s.dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := keyTok.(string)
+		var value interface{}
+		if err := s.dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		obj[key] = value
+	}
+	_, err := s.dec.Token()
+	return obj, err
+}
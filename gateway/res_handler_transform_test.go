@@ -2,6 +2,10 @@ package gateway
 
 import (
 	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/TykTechnologies/tyk/apidef"
@@ -176,3 +180,76 @@ func TestTransformResponse_WithCache(t *testing.T) {
 	}...)
 
 }
+
+func TestTransformResponse_Streaming(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/list" {
+			w.Write([]byte(`[{"id":1},{"id":2}]`))
+			return
+		}
+
+		w.Write([]byte(`{"total":1000,"items":[`))
+		for i := 0; i < 1000; i++ {
+			if i > 0 {
+				w.Write([]byte(","))
+			}
+			fmt.Fprintf(w, `{"id":%d,"name":"item %d"}`, i, i)
+		}
+		w.Write([]byte(`],"meta":{"page":1}}`))
+	}))
+	defer upstream.Close()
+
+	ts := StartTest()
+	defer ts.Close()
+
+	template := base64.StdEncoding.EncodeToString([]byte(`{"id":{{.id}}}`))
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.TargetURL = upstream.URL
+		spec.ResponseProcessors = []apidef.ResponseProcessor{{Name: "response_body_transform"}}
+		UpdateAPIVersion(spec, "v1", func(v *apidef.VersionInfo) {
+			v.ExtendedPaths.TransformResponse = []apidef.TemplateMeta{{
+				Path:   "/items",
+				Method: "GET",
+				TemplateData: apidef.TemplateData{
+					Mode:           "blob",
+					TemplateSource: template,
+					Streaming:      true,
+					StreamPath:     "items",
+				},
+			}, {
+				Path:   "/list",
+				Method: "GET",
+				TemplateData: apidef.TemplateData{
+					Mode:           "blob",
+					TemplateSource: template,
+					Streaming:      true,
+				},
+			}}
+		})
+	})
+
+	ts.Run(t, []test.TestCase{
+		{Path: "/list", Code: http.StatusOK, BodyMatch: `[{"id":1},{"id":2}]`},
+		{Path: "/items", Code: http.StatusOK, BodyMatchFunc: func(body []byte) bool {
+			var resp struct {
+				Total int                      `json:"total"`
+				Items []map[string]interface{} `json:"items"`
+				Meta  map[string]interface{}   `json:"meta"`
+			}
+			if err := json.Unmarshal(body, &resp); err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.Total != 1000 || len(resp.Items) != 1000 || resp.Meta["page"] != 1.0 {
+				t.Fatalf("Expected the rest of the body to be kept, got %d items of %d, meta %v", len(resp.Items), resp.Total, resp.Meta)
+			}
+			for i, item := range resp.Items {
+				if len(item) != 1 || item["id"] != float64(i) {
+					t.Fatalf("Expected item %d to be transformed, got %v", i, item)
+				}
+			}
+			return true
+		}},
+	}...)
+}
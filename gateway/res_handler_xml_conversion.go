@@ -0,0 +1,64 @@
+package gateway
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/headers"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+// ResponseXMLConversionMiddleware converts XML responses of the endpoints
+// converting requests to XML back to JSON.
+type ResponseXMLConversionMiddleware struct {
+	Spec *APISpec
+}
+
+func (ResponseXMLConversionMiddleware) Name() string {
+	return "ResponseXMLConversionMiddleware"
+}
+
+func (h *ResponseXMLConversionMiddleware) Init(c interface{}, spec *APISpec) error {
+	h.Spec = spec
+	return nil
+}
+
+// HandleResponse converts responses unless the client accepts XML, so that
+// clients asking for XML still get the response of the upstream.
+func (h *ResponseXMLConversionMiddleware) HandleResponse(rw http.ResponseWriter, res *http.Response, req *http.Request, ses *user.SessionState) error {
+	_, versionPaths, _, _ := h.Spec.Version(req)
+	found, meta := h.Spec.CheckSpecMatchesStatus(req, versionPaths, XMLConvertedResponse)
+	if !found || !isXMLContentType(res.Header.Get(headers.ContentType)) ||
+		strings.Contains(req.Header.Get(headers.Accept), "xml") {
+		return nil
+	}
+
+	respBody := respBodyReader(req, res)
+	body, _ := ioutil.ReadAll(respBody)
+	respBody.Close()
+
+	converted, err := xmlToJSON(body, meta.(*apidef.XMLConversionMeta))
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"prefix":      "outbound-xml-conversion",
+			"server_name": h.Spec.Proxy.TargetURL,
+			"api_id":      h.Spec.APIID,
+			"path":        req.URL.Path,
+		}).WithError(err).Error("Failed to convert response body to JSON")
+		converted = body
+	} else {
+		res.Header.Set(headers.ContentType, headers.ApplicationJSON)
+	}
+
+	bodyBuffer := compressBuffer(*bytes.NewBuffer(converted), res.Header.Get(headers.ContentEncoding))
+	res.ContentLength = int64(bodyBuffer.Len())
+	res.Header.Set(headers.ContentLength, strconv.Itoa(bodyBuffer.Len()))
+	res.Body = ioutil.NopCloser(&bodyBuffer)
+	return nil
+}
@@ -0,0 +1,245 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+const (
+	retryBudgetWindow       = 10
+	defaultRetryBudgetRatio = 0.2
+	defaultRetryBackoff     = 25
+	defaultRetryMaxBackoff  = 1000
+)
+
+var (
+	defaultRetryStatusCodes = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+	defaultRetryErrors      = []string{"connect", "reset"}
+
+	// errPerTryTimeout is reported like the hard timeout of the transport.
+	errPerTryTimeout = errors.New("per try timeout awaiting response headers")
+)
+
+// retryBudgetBucket counts the requests of one second of the window.
+type retryBudgetBucket struct {
+	second   int64
+	requests int64
+	retries  int64
+}
+
+// retryBudget allows retries as long as they stay within a ratio of the
+// requests proxied over a rolling window.
+type retryBudget struct {
+	ratio        float64
+	minPerSecond int64
+
+	mu      sync.Mutex
+	buckets [retryBudgetWindow]retryBudgetBucket
+}
+
+func newRetryBudget(conf apidef.RetryBudgetMeta) *retryBudget {
+	if conf.Ratio <= 0 {
+		conf.Ratio = defaultRetryBudgetRatio
+	}
+	return &retryBudget{ratio: conf.Ratio, minPerSecond: int64(conf.MinPerSecond)}
+}
+
+func (b *retryBudget) bucket(now int64) *retryBudgetBucket {
+	bucket := &b.buckets[now%retryBudgetWindow]
+	if bucket.second != now {
+		*bucket = retryBudgetBucket{second: now}
+	}
+	return bucket
+}
+
+// request counts a request proxied.
+func (b *retryBudget) request() {
+	now := time.Now().Unix()
+	b.mu.Lock()
+	b.bucket(now).requests++
+	b.mu.Unlock()
+}
+
+// withdraw tells whether a request may be retried, counting the retry if so.
+func (b *retryBudget) withdraw() bool {
+	now := time.Now().Unix()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var requests, retries int64
+	for _, bucket := range b.buckets {
+		if now-bucket.second < retryBudgetWindow {
+			requests += bucket.requests
+			retries += bucket.retries
+		}
+	}
+	allowed := int64(b.ratio * float64(requests))
+	if min := b.minPerSecond * retryBudgetWindow; allowed < min {
+		allowed = min
+	}
+	if retries >= allowed {
+		return false
+	}
+	b.bucket(now).retries++
+	return true
+}
+
+// retryBackoff is the delay before the given retry, counted from 0, with
+// half of it random.
+func retryBackoff(conf apidef.RetryMeta, retry int) time.Duration {
+	backoff, max := conf.Backoff, conf.MaxBackoff
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+	if max <= 0 {
+		max = defaultRetryMaxBackoff
+	}
+	for i := 0; i < retry && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	delay := time.Duration(backoff) * time.Millisecond
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// retryErrorKind classifies errors of round trips as listed in the errors of
+// RetryMeta, or returns "" for errors never retried.
+func retryErrorKind(err error) string {
+	if err == errPerTryTimeout {
+		return "timeout"
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return "connect"
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return "reset"
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "timeout"
+	}
+	if strings.Contains(err.Error(), "timeout awaiting response headers") {
+		return "timeout"
+	}
+	return ""
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// shouldRetry tells whether the outcome of an attempt is retried. Requests
+// that are not idempotent are only retried if they never reached the
+// upstream.
+func shouldRetry(conf apidef.RetryMeta, method string, res *http.Response, err error) bool {
+	if err != nil {
+		kind := retryErrorKind(err)
+		if kind == "" || (kind != "connect" && !isIdempotent(method)) {
+			return false
+		}
+		kinds := conf.Errors
+		if len(kinds) == 0 {
+			kinds = defaultRetryErrors
+		}
+		for _, k := range kinds {
+			if k == kind {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !isIdempotent(method) {
+		return false
+	}
+	codes := conf.StatusCodes
+	if len(codes) == 0 {
+		codes = defaultRetryStatusCodes
+	}
+	for _, code := range codes {
+		if code == res.StatusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// tryRoundTrip sends one attempt of a request, failing it with
+// errPerTryTimeout if the upstream does not answer within timeout.
+func tryRoundTrip(roundTrip func(*http.Request) (*http.Response, error), outreq *http.Request, timeout int64) (*http.Response, error) {
+	if timeout <= 0 {
+		return roundTrip(outreq)
+	}
+
+	attemptCtx, cancel := context.WithCancel(outreq.Context())
+	timer := time.AfterFunc(time.Duration(timeout)*time.Millisecond, cancel)
+	res, err := roundTrip(outreq.WithContext(attemptCtx))
+	if !timer.Stop() && err != nil && outreq.Context().Err() == nil {
+		err = errPerTryTimeout
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	res.Body = cancelOnClose{ReadCloser: res.Body, cancel: cancel}
+	return res, nil
+}
+
+// retryRoundTrip sends a request until it succeeds, or the attempts or the
+// retry budget of the API run out. It returns the last outcome and how many
+// times the request was retried.
+func (p *ReverseProxy) retryRoundTrip(roundTrip func(*http.Request) (*http.Response, error), outreq *http.Request) (*http.Response, int, error) {
+	conf := p.TykAPISpec.Proxy.Retry
+	attempts := conf.Attempts
+	if attempts <= 0 {
+		attempts = 1
+	}
+	budget := p.TykAPISpec.retryBudget
+	budget.request()
+
+	for retry := 0; ; retry++ {
+		if lb, ok := outreq.Body.(*lazyBody); ok {
+			if err := lb.buffer(0); err != nil {
+				return nil, retry, err
+			}
+		}
+		if outreq.Body != nil {
+			outreq.Body = copyBody(outreq.Body)
+		}
+		res, err := tryRoundTrip(roundTrip, outreq, conf.PerTryTimeout)
+		if retry >= attempts || !shouldRetry(conf, outreq.Method, res, err) {
+			return res, retry, err
+		}
+		if !budget.withdraw() {
+			log.Debug("[PROXY] Retry budget exhausted, not retrying request")
+			return res, retry, err
+		}
+		if res != nil {
+			res.Body.Close()
+		}
+
+		select {
+		case <-time.After(retryBackoff(conf, retry)):
+		case <-outreq.Context().Done():
+			return nil, retry, outreq.Context().Err()
+		}
+		log.Debug("[PROXY] Retrying request, attempt ", retry+2)
+	}
+}
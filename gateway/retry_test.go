@@ -0,0 +1,123 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestRetryBudget(t *testing.T) {
+	budget := newRetryBudget(apidef.RetryBudgetMeta{Ratio: 0.5})
+	for i := 0; i < 4; i++ {
+		budget.request()
+	}
+	for i := 0; i < 2; i++ {
+		if !budget.withdraw() {
+			t.Fatalf("Expected retry %d to be allowed", i+1)
+		}
+	}
+	if budget.withdraw() {
+		t.Error("Expected retries over the ratio of requests to be denied")
+	}
+
+	budget = newRetryBudget(apidef.RetryBudgetMeta{MinPerSecond: 1})
+	for i := 0; i < retryBudgetWindow; i++ {
+		if !budget.withdraw() {
+			t.Fatalf("Expected retry %d to be allowed by the minimum", i+1)
+		}
+	}
+	if budget.withdraw() {
+		t.Error("Expected retries over the minimum to be denied")
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	conf := apidef.RetryMeta{Backoff: 100, MaxBackoff: 300}
+	for retry, max := range []time.Duration{100, 200, 300, 300} {
+		max *= time.Millisecond
+		if d := retryBackoff(conf, retry); d < max/2 || d > max {
+			t.Errorf("Expected retry %d to wait between %v and %v, got %v", retry, max/2, max, d)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	var hits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1)%3 != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.TargetURL = upstream.URL
+		spec.Proxy.Retry = apidef.RetryMeta{
+			Enabled:  true,
+			Attempts: 2,
+			Backoff:  1,
+			Budget:   apidef.RetryBudgetMeta{MinPerSecond: 10},
+		}
+	})
+
+	t.Run("Retried until success", func(t *testing.T) {
+		ts.Run(t, test.TestCase{Path: "/", Code: http.StatusOK, BodyMatch: "ok"})
+		if n := atomic.LoadInt32(&hits); n != 3 {
+			t.Errorf("Expected 3 attempts, got %d", n)
+		}
+	})
+
+	t.Run("Not idempotent", func(t *testing.T) {
+		atomic.StoreInt32(&hits, 0)
+		ts.Run(t, test.TestCase{Method: http.MethodPost, Path: "/", Code: http.StatusServiceUnavailable})
+		if n := atomic.LoadInt32(&hits); n != 1 {
+			t.Errorf("Expected POST requests to be sent once, got %d attempts", n)
+		}
+	})
+}
+
+func TestRetryPerTryTimeout(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	var hits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 {
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+			}
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.TargetURL = upstream.URL
+		spec.Proxy.Retry = apidef.RetryMeta{
+			Enabled:       true,
+			Backoff:       1,
+			Errors:        []string{"timeout"},
+			PerTryTimeout: 50,
+			Budget:        apidef.RetryBudgetMeta{MinPerSecond: 10},
+		}
+	})
+
+	ts.Run(t, test.TestCase{Path: "/", Code: http.StatusOK, BodyMatch: "ok"})
+	if n := atomic.LoadInt32(&hits); n != 2 {
+		t.Errorf("Expected the timed out attempt to be retried, got %d attempts", n)
+	}
+}
@@ -13,9 +13,9 @@ package gateway
 
 import (
 	"bytes"
+	"container/list"
 	"context"
 	"crypto/tls"
-	"fmt"
 	"io"
 	"io/ioutil"
 	"net"
@@ -49,11 +49,18 @@ const (
 	XRateLimitLimit     = "X-RateLimit-Limit"
 	XRateLimitRemaining = "X-RateLimit-Remaining"
 	XRateLimitReset     = "X-RateLimit-Reset"
+
+	XRateLimitEndpointLimit     = "X-RateLimit-Endpoint-Limit"
+	XRateLimitEndpointRemaining = "X-RateLimit-Endpoint-Remaining"
 )
 
 var ServiceCache *cache.Cache
 
 func urlFromService(spec *APISpec) (*apidef.HostList, error) {
+	if spec.ServiceWatcher != nil {
+		// Watched targets are always up to date
+		return spec.ServiceWatcher.Targets(), nil
+	}
 
 	doCacheRefresh := func() (*apidef.HostList, error) {
 		log.Debug("--> Refreshing")
@@ -118,33 +125,10 @@ func EnsureTransport(host string) string {
 	return "http://" + host
 }
 
-func nextTarget(targetData *apidef.HostList, spec *APISpec) (string, error) {
+func nextTarget(r *http.Request, targetData *apidef.HostList, spec *APISpec) (string, error) {
 	if spec.Proxy.EnableLoadBalancing {
 		log.Debug("[PROXY] [LOAD BALANCING] Load balancer enabled, getting upstream target")
-		// Use a HostList
-		startPos := spec.RoundRobin.WithLen(targetData.Len())
-		pos := startPos
-		for {
-			gotHost, err := targetData.GetIndex(pos)
-			if err != nil {
-				return "", err
-			}
-
-			host := EnsureTransport(gotHost)
-
-			if !spec.Proxy.CheckHostAgainstUptimeTests {
-				return host, nil // we don't care if it's up
-			}
-			if !GlobalHostChecker.HostDown(host) {
-				return host, nil // we do care and it's up
-			}
-			// if the host is down, keep trying all the rest
-			// in order from where we started.
-			if pos = (pos + 1) % targetData.Len(); pos == startPos {
-				return "", fmt.Errorf("all hosts are down, uptime tests are failing")
-			}
-		}
-
+		return spec.LoadBalancer.Next(r, targetData, spec.Proxy.CheckHostAgainstUptimeTests)
 	}
 	// Use standard target - might still be service data
 	log.Debug("TARGET DATA:", targetData)
@@ -202,20 +186,22 @@ func TykNewSingleHostReverseProxy(target *url.URL, spec *APISpec) *ReverseProxy
 		}
 	}
 
+	var proxy *ReverseProxy
 	targetQuery := target.RawQuery
 	director := func(req *http.Request) {
 		hostList := spec.Proxy.StructuredTargetList
-		switch {
-		case spec.Proxy.ServiceDiscovery.UseDiscoveryService:
+		balanced := spec.Proxy.EnableLoadBalancing || proxy.targets != nil
+		if spec.Proxy.ServiceDiscovery.UseDiscoveryService && proxy.targets == nil {
 			var err error
 			hostList, err = urlFromService(spec)
 			if err != nil {
 				log.Error("[PROXY] [SERVICE DISCOVERY] Failed target lookup: ", err)
-				break
 			}
-			fallthrough // implies load balancing, with replaced host list
-		case spec.Proxy.EnableLoadBalancing:
-			host, err := nextTarget(hostList, spec)
+			// implies load balancing, with replaced host list
+			balanced = err == nil
+		}
+		if balanced {
+			host, err := proxy.nextTarget(req, hostList)
 			if err != nil {
 				log.Error("[PROXY] [LOAD BALANCING] ", err)
 				host = allHostsDownURL
@@ -230,7 +216,12 @@ func TykNewSingleHostReverseProxy(target *url.URL, spec *APISpec) *ReverseProxy
 			}
 		}
 
-		targetToUse := target
+		upstream, upstreamQuery := target, targetQuery
+		if canary := spec.canary(req); canary != nil && ctxGetVariant(req) == canary.conf.Name {
+			upstream, upstreamQuery = canary.target, canary.target.RawQuery
+		}
+
+		targetToUse := upstream
 
 		if spec.URLRewriteEnabled && req.Context().Value(ctx.RetainHost) == true {
 			log.Debug("Detected host rewrite, overriding target")
@@ -248,7 +239,7 @@ func TykNewSingleHostReverseProxy(target *url.URL, spec *APISpec) *ReverseProxy
 		// if this is false, there was an url rewrite, thus we
 		// don't want to do anything to the path - req.URL is
 		// already final.
-		if targetToUse == target {
+		if targetToUse == upstream {
 			req.URL.Scheme = targetToUse.Scheme
 			req.URL.Host = targetToUse.Host
 			req.URL.Path = singleJoiningSlash(targetToUse.Path, req.URL.Path, spec.Proxy.DisableStripSlash)
@@ -259,10 +250,10 @@ func TykNewSingleHostReverseProxy(target *url.URL, spec *APISpec) *ReverseProxy
 		if !spec.Proxy.PreserveHostHeader {
 			req.Host = targetToUse.Host
 		}
-		if targetQuery == "" || req.URL.RawQuery == "" {
-			req.URL.RawQuery = targetQuery + req.URL.RawQuery
+		if upstreamQuery == "" || req.URL.RawQuery == "" {
+			req.URL.RawQuery = upstreamQuery + req.URL.RawQuery
 		} else {
-			req.URL.RawQuery = targetQuery + "&" + req.URL.RawQuery
+			req.URL.RawQuery = upstreamQuery + "&" + req.URL.RawQuery
 		}
 		if _, ok := req.Header[headers.UserAgent]; !ok {
 			// Set Tyk's own default user agent. Without
@@ -282,7 +273,7 @@ func TykNewSingleHostReverseProxy(target *url.URL, spec *APISpec) *ReverseProxy
 		}
 	}
 
-	proxy := &ReverseProxy{
+	proxy = &ReverseProxy{
 		Director:      director,
 		TykAPISpec:    spec,
 		FlushInterval: time.Duration(spec.GlobalConfig.HttpServerOptions.FlushInterval) * time.Millisecond,
@@ -317,6 +308,20 @@ type ReverseProxy struct {
 
 	TykAPISpec   *APISpec
 	ErrorHandler ErrorHandler
+
+	// balancer and targets are those of the version the proxy serves, if
+	// it has targets of its own.
+	balancer *LoadBalancer
+	targets  *apidef.HostList
+}
+
+// nextTarget picks the target of request r among hostList, or among the
+// targets of the version the proxy serves if it has its own.
+func (p *ReverseProxy) nextTarget(r *http.Request, hostList *apidef.HostList) (string, error) {
+	if p.targets != nil {
+		return p.balancer.Next(r, p.targets, p.TykAPISpec.Proxy.CheckHostAgainstUptimeTests)
+	}
+	return nextTarget(r, hostList, p.TykAPISpec)
 }
 
 func defaultTransport(dialerTimeout float64) *http.Transport {
@@ -475,6 +480,7 @@ func proxyFromAPI(api *APISpec) func(*http.Request) (*url.URL, error) {
 func httpTransport(timeOut float64, rw http.ResponseWriter, req *http.Request, p *ReverseProxy) http.RoundTripper {
 	transport := defaultTransport(timeOut) // modifies a newly created transport
 	transport.TLSClientConfig = &tls.Config{}
+	transport.TLSClientConfig.GetClientCertificate = upstreamClientCertificate(p.TykAPISpec, "")
 	transport.Proxy = proxyFromAPI(p.TykAPISpec)
 
 	if config.Global().ProxySSLInsecureSkipVerify {
@@ -514,19 +520,177 @@ func httpTransport(timeOut float64, rw http.ResponseWriter, req *http.Request, p
 	}
 
 	transport.DisableKeepAlives = p.TykAPISpec.GlobalConfig.ProxyCloseConnections
+	configureTransport(transport, p.TykAPISpec)
 
 	if IsWebsocket(req) {
-		wsTransport := &WSDialer{transport, rw, p.TLSClientConfig}
+		wsTransport := &WSDialer{transport, rw, p.TLSClientConfig, p.TykAPISpec}
 		return wsTransport
 	}
 
-	if config.Global().ProxyEnableHttp2 {
+	conf := p.TykAPISpec.Proxy.Transport
+	if p.TykAPISpec.GRPC.Enabled || conf.HTTP2PriorKnowledge {
 		http2.ConfigureTransport(transport)
+		if len(conf.ALPN) > 0 {
+			transport.TLSClientConfig.NextProtos = conf.ALPN
+		}
+		h2 := &http2Transport{
+			tls: transport,
+			h2c: &http2.Transport{
+				AllowHTTP: true,
+				DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+					return transport.DialContext(context.Background(), network, addr)
+				},
+				MaxHeaderListSize: conf.HTTP2MaxHeaderListSize,
+			},
+		}
+		if conf.HTTP2PriorKnowledge {
+			h2.tls = priorKnowledgeTransport(transport, conf.HTTP2MaxHeaderListSize)
+		}
+		return h2
+	}
+
+	if config.Global().ProxyEnableHttp2 || conf.EnableHTTP2 {
+		http2.ConfigureTransport(transport)
+	}
+	if len(conf.ALPN) > 0 {
+		transport.TLSClientConfig.NextProtos = conf.ALPN
 	}
 
 	return transport
 }
 
+// priorKnowledgeTransport speaks HTTP/2 to https upstreams over the TLS
+// connections transport would make, failing with those not negotiating it.
+func priorKnowledgeTransport(transport *http.Transport, maxHeaderListSize uint32) *http2.Transport {
+	h2 := &http2.Transport{
+		TLSClientConfig:   transport.TLSClientConfig,
+		MaxHeaderListSize: maxHeaderListSize,
+	}
+	if transport.DialTLS != nil {
+		// Keep the checks of pinned public keys
+		h2.DialTLS = func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return transport.DialTLS(network, addr)
+		}
+	}
+	return h2
+}
+
+// configureTransport applies the connection pool settings of the API to
+// transport.
+func configureTransport(transport *http.Transport, spec *APISpec) {
+	conf := spec.Proxy.Transport
+	if conf.MaxIdleConns > 0 {
+		transport.MaxIdleConns = conf.MaxIdleConns
+	}
+	if conf.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = conf.MaxIdleConnsPerHost
+	}
+	if conf.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = conf.MaxConnsPerHost
+	}
+	if conf.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = time.Duration(conf.IdleConnTimeout) * time.Second
+	}
+	if conf.TLSHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = time.Duration(conf.TLSHandshakeTimeout) * time.Second
+	}
+	if conf.DisableKeepAlives {
+		transport.DisableKeepAlives = true
+	}
+}
+
+// maxUpstreamTransports caps the transports kept for an API, as upstream
+// hosts may change with service discovery. The least recently used one is
+// dropped over it.
+const maxUpstreamTransports = 100
+
+// upstreamTransports sends the requests to each upstream host over a
+// transport of its own, so that a slow upstream cannot take the connections
+// of the others.
+type upstreamTransports struct {
+	newTransport func() http.RoundTripper
+
+	mu         sync.Mutex
+	transports map[string]*list.Element
+	order      *list.List
+}
+
+type upstreamTransport struct {
+	host      string
+	transport http.RoundTripper
+}
+
+func newUpstreamTransports(newTransport func() http.RoundTripper) *upstreamTransports {
+	return &upstreamTransports{
+		newTransport: newTransport,
+		transports:   make(map[string]*list.Element),
+		order:        list.New(),
+	}
+}
+
+func (t *upstreamTransports) RoundTrip(req *http.Request) (*http.Response, error) {
+	var transport, evicted http.RoundTripper
+
+	t.mu.Lock()
+	if el, ok := t.transports[req.URL.Host]; ok {
+		t.order.MoveToFront(el)
+		transport = el.Value.(*upstreamTransport).transport
+	} else {
+		transport = t.newTransport()
+		t.transports[req.URL.Host] = t.order.PushFront(&upstreamTransport{host: req.URL.Host, transport: transport})
+		if t.order.Len() > maxUpstreamTransports {
+			oldest := t.order.Remove(t.order.Back()).(*upstreamTransport)
+			delete(t.transports, oldest.host)
+			evicted = oldest.transport
+		}
+	}
+	t.mu.Unlock()
+
+	if evicted != nil {
+		closeIdleConnections(evicted)
+	}
+
+	return transport.RoundTrip(req)
+}
+
+// CloseIdleConnections closes idle connections to all upstream hosts.
+func (t *upstreamTransports) CloseIdleConnections() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for el := t.order.Front(); el != nil; el = el.Next() {
+		closeIdleConnections(el.Value.(*upstreamTransport).transport)
+	}
+}
+
+// closeIdleConnections closes idle connections of the transport, if it keeps
+// any. Connections in use are closed once their requests are done.
+func closeIdleConnections(transport http.RoundTripper) {
+	if closer, ok := transport.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// http2Transport sends requests over HTTP/2, such as gRPC calls, using
+// cleartext HTTP/2 (h2c) for http upstreams.
+type http2Transport struct {
+	tls http.RoundTripper
+	h2c *http2.Transport
+}
+
+func (t *http2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "http" {
+		return t.h2c.RoundTrip(req)
+	}
+
+	return t.tls.RoundTrip(req)
+}
+
+func (t *http2Transport) CloseIdleConnections() {
+	closeIdleConnections(t.tls)
+	t.h2c.CloseIdleConnections()
+}
+
 func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Request, withCache bool) *http.Response {
 	if trace.IsEnabled() {
 		span, ctx := trace.Span(req.Context(), req.URL.Path)
@@ -549,7 +713,13 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 
 		if createTransport {
 			_, timeout := p.CheckHardTimeoutEnforced(p.TykAPISpec, req)
-			p.TykAPISpec.HTTPTransport = httpTransport(timeout, rw, req, p)
+			if p.TykAPISpec.Proxy.Transport.IsolateUpstreams {
+				p.TykAPISpec.HTTPTransport = newUpstreamTransports(func() http.RoundTripper {
+					return httpTransport(timeout, rw, req, p)
+				})
+			} else {
+				p.TykAPISpec.HTTPTransport = httpTransport(timeout, rw, req, p)
+			}
 			p.TykAPISpec.HTTPTransportCreated = time.Now()
 		}
 
@@ -577,6 +747,10 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 	}
 	p.TykAPISpec.Unlock()
 
+	if canary := p.TykAPISpec.canary(req); canary != nil {
+		ctxSetVariant(req, canary.Variant(req))
+	}
+
 	reqCtx := req.Context()
 	if cn, ok := rw.(http.CloseNotifier); ok {
 		var cancel context.CancelFunc
@@ -603,6 +777,10 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 	// remove context data from the copies
 	setContext(outreq, context.Background())
 	setContext(logreq, context.Background())
+	// Errors proxying are recorded under the variant too
+	if variant := ctxGetVariant(req); variant != "" {
+		ctxSetVariant(logreq, variant)
+	}
 
 	log.Debug("UPSTREAM REQUEST URL: ", req.URL)
 
@@ -625,6 +803,17 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 	p.Director(outreq)
 	outreq.Close = false
 
+	balancer := p.TykAPISpec.LoadBalancer
+	if p.balancer != nil {
+		balancer = p.balancer
+	}
+	if balancer.Acquire(outreq.URL.Host) {
+		defer balancer.Release(outreq.URL.Host)
+	}
+
+	// Client certificate is selected by upstream server name
+	setCtxValue(outreq, ctx.UpstreamHost, outreq.URL.Hostname())
+
 	log.Debug("Outbound Request: ", outreq.URL.String())
 
 	// Do not modify outbound request headers if they are WS
@@ -659,41 +848,74 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 		outreq.Header.Set(headers.XForwardFor, addrs)
 	}
 
+	if conf := p.TykAPISpec.ForwardClientCertificate; conf.Enabled {
+		setForwardedClientCert(outreq, req, conf)
+	}
+
 	// Circuit breaker
 	breakerEnforced, breakerConf := p.CheckCircuitBreakerEnforced(p.TykAPISpec, req)
 
-	// set up TLS certificates for upstream if needed
-	var tlsCertificates []tls.Certificate
-	if cert := getUpstreamCertificate(outreq.Host, p.TykAPISpec); cert != nil {
-		tlsCertificates = []tls.Certificate{*cert}
-	}
-
-	p.TykAPISpec.Lock()
+	// set up TLS certificates for websocket upstream, HTTP transport selects
+	// them on handshake
 	if outReqIsWebsocket {
+		var tlsCertificates []tls.Certificate
+		if cert := getUpstreamCertificate(outreq.Host, p.TykAPISpec); cert != nil {
+			tlsCertificates = []tls.Certificate{*cert}
+		}
+
+		p.TykAPISpec.Lock()
 		roundTripper.(*WSDialer).TLSClientConfig.Certificates = tlsCertificates
-	} else {
-		roundTripper.(*http.Transport).TLSClientConfig.Certificates = tlsCertificates
+		p.TykAPISpec.Unlock()
+	}
+
+	// Shed load the upstream can not keep up with
+	limiter := p.TykAPISpec.ConcurrencyLimiter
+	if limiter != nil && !limiter.Acquire(outreq.URL.Host) {
+		log.Debug("ON REQUEST: Upstream concurrency limit reached")
+		rw.Header().Set(headers.RetryAfter, strconv.FormatInt(limiter.RetryAfter(), 10))
+		p.ErrorHandler.HandleError(rw, logreq, "Service temporarily unavailable.", http.StatusServiceUnavailable, true)
+		return nil
 	}
-	p.TykAPISpec.Unlock()
 
 	// do request round trip
 	var res *http.Response
 	var err error
+	var retries int
+	roundTrip := roundTripper.RoundTrip
+	if shouldHedge(p.TykAPISpec, outreq) {
+		roundTrip = func(outreq *http.Request) (*http.Response, error) {
+			return p.hedgedRoundTrip(roundTripper, outreq)
+		}
+	}
+	if p.TykAPISpec.retryBudget != nil && !outReqIsWebsocket {
+		attempt := roundTrip
+		roundTrip = func(outreq *http.Request) (res *http.Response, err error) {
+			res, retries, err = p.retryRoundTrip(attempt, outreq)
+			return res, err
+		}
+	}
+	start := time.Now()
 	if breakerEnforced {
-		if !breakerConf.CB.Ready() {
+		if !breakerConf.CB.Ready(outreq.URL.Host) {
+			if limiter != nil {
+				limiter.Cancel(outreq.URL.Host)
+			}
 			log.Debug("ON REQUEST: Circuit Breaker is in OPEN state")
 			p.ErrorHandler.HandleError(rw, logreq, "Service temporarily unavailable.", 503, true)
 			return nil
 		}
 		log.Debug("ON REQUEST: Circuit Breaker is in CLOSED or HALF-OPEN state")
-		res, err = roundTripper.RoundTrip(outreq)
-		if err != nil || res.StatusCode == http.StatusInternalServerError {
-			breakerConf.CB.Fail()
-		} else {
-			breakerConf.CB.Success()
-		}
+		res, err = roundTrip(outreq)
+		breakerConf.CB.Done(outreq.URL.Host, err != nil || res.StatusCode == http.StatusInternalServerError, time.Since(start))
 	} else {
-		res, err = roundTripper.RoundTrip(outreq)
+		res, err = roundTrip(outreq)
+	}
+	if limiter != nil {
+		limiter.Done(outreq.URL.Host, err != nil || res.StatusCode >= http.StatusInternalServerError, time.Since(start))
+	}
+	if retries > 0 {
+		ctxSetRetries(req, retries)
+		ctxSetRetries(logreq, retries)
 	}
 
 	if err != nil {
@@ -732,6 +954,11 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 			return nil
 		}
 
+		if strings.Contains(err.Error(), errBodyBufferFull.Error()) {
+			p.ErrorHandler.HandleError(rw, logreq, "Service temporarily unavailable.", http.StatusServiceUnavailable, true)
+			return nil
+		}
+
 		if strings.Contains(err.Error(), "no such host") {
 			p.ErrorHandler.HandleError(rw, logreq, "Upstream host lookup failed", http.StatusInternalServerError, true)
 			return nil
@@ -758,7 +985,11 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 	}
 
 	inres := new(http.Response)
-	if withCache {
+	if withCache && IsSSE(res.Header) {
+		// Streams are passed through, and never cached
+		*inres = *res
+		inres.Body = http.NoBody
+	} else if withCache {
 		*inres = *res // includes shallow copies of maps, but okay
 
 		defer res.Body.Close()
@@ -779,6 +1010,17 @@ func (p *ReverseProxy) WrappedServeHTTP(rw http.ResponseWriter, req *http.Reques
 	inres.StatusCode = res.StatusCode
 	inres.ContentLength = res.ContentLength
 	p.HandleResponse(rw, res, ses)
+
+	// gRPC status is sent in trailers, which are only read with the body
+	if IsGRPC(res.Header) {
+		inres.Header = res.Header
+		inres.Trailer = res.Trailer
+	}
+
+	if IsSSE(res.Header) {
+		inres.Header = res.Header
+	}
+
 	return inres
 }
 
@@ -824,6 +1066,11 @@ func (p *ReverseProxy) HandleResponse(rw http.ResponseWriter, res *http.Response
 		rw.Header().Add("Trailer", strings.Join(trailerKeys, ", "))
 	}
 
+	if IsSSE(res.Header) {
+		p.streamSSE(rw, res)
+		return nil
+	}
+
 	rw.WriteHeader(res.StatusCode)
 
 	if len(res.Trailer) > 0 {
@@ -835,7 +1082,12 @@ func (p *ReverseProxy) HandleResponse(rw http.ResponseWriter, res *http.Response
 		}
 	}
 
-	p.CopyResponse(rw, res.Body)
+	if wf, ok := rw.(writeFlusher); ok && IsGRPC(res.Header) {
+		// Streamed gRPC messages are sent as soon as received
+		p.copyBuffer(flushWriter{wf}, res.Body, nil)
+	} else {
+		p.CopyResponse(rw, res.Body)
+	}
 
 	if len(res.Trailer) == announcedTrailers {
 		copyHeader(rw.Header(), res.Trailer)
@@ -905,6 +1157,17 @@ type writeFlusher interface {
 	http.Flusher
 }
 
+// flushWriter flushes after every write.
+type flushWriter struct {
+	writeFlusher
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.writeFlusher.Write(p)
+	f.Flush()
+	return n, err
+}
+
 type maxLatencyWriter struct {
 	dst     writeFlusher
 	latency time.Duration
@@ -978,6 +1241,10 @@ func copyBody(body io.ReadCloser) io.ReadCloser {
 		nc.Seek(0, io.SeekStart)
 		return body
 	}
+	if lb, ok := body.(*lazyBody); ok && lb.buffer(0) == nil {
+		lb.buffered.Seek(0, io.SeekStart)
+		return body
+	}
 
 	// body is http's io.ReadCloser - let's close it after we read data
 	defer body.Close()
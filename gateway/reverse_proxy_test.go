@@ -347,6 +347,144 @@ func TestWrappedServeHTTP(t *testing.T) {
 	proxy.WrappedServeHTTP(recorder, req, false)
 }
 
+func TestUpstreamTransports(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	upstream := func(body string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		}))
+	}
+	a, b := upstream("upstream a"), upstream("upstream b")
+	defer a.Close()
+	defer b.Close()
+
+	spec := BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.EnableLoadBalancing = true
+		spec.Proxy.Targets = []string{a.URL, b.URL}
+		spec.Proxy.Transport.MaxConnsPerHost = 5
+		spec.Proxy.Transport.TLSHandshakeTimeout = 3
+		spec.Proxy.Transport.DisableKeepAlives = true
+		spec.Proxy.Transport.IsolateUpstreams = true
+	})[0]
+
+	ts.Run(t, []test.TestCase{
+		{Path: "/", Code: http.StatusOK, BodyMatch: "upstream a"},
+		{Path: "/", Code: http.StatusOK, BodyMatch: "upstream b"},
+	}...)
+
+	transports, ok := spec.HTTPTransport.(*upstreamTransports)
+	if !ok {
+		t.Fatalf("Expected transports per upstream, got %T", spec.HTTPTransport)
+	}
+	if len(transports.transports) != 2 {
+		t.Fatalf("Expected a transport for each of the 2 upstreams, got %d", len(transports.transports))
+	}
+	for host, el := range transports.transports {
+		transport := el.Value.(*upstreamTransport).transport.(*http.Transport)
+		if transport.MaxConnsPerHost != 5 || transport.TLSHandshakeTimeout != 3*time.Second || !transport.DisableKeepAlives {
+			t.Errorf("Expected the settings of the API on the transport of %s", host)
+		}
+	}
+
+	t.Run("Least recently used dropped", func(t *testing.T) {
+		var created []*idleClosingTransport
+		transports := newUpstreamTransports(func() http.RoundTripper {
+			transport := &idleClosingTransport{}
+			created = append(created, transport)
+			return transport
+		})
+
+		for i := 0; i <= maxUpstreamTransports; i++ {
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("http://upstream-%d/", i), nil)
+			if i == maxUpstreamTransports {
+				// Use the first one again, for the second to be dropped
+				transports.RoundTrip(httptest.NewRequest(http.MethodGet, "http://upstream-0/", nil))
+			}
+			transports.RoundTrip(req)
+		}
+
+		if len(transports.transports) != maxUpstreamTransports {
+			t.Errorf("Expected %d transports, got %d", maxUpstreamTransports, len(transports.transports))
+		}
+		if _, ok := transports.transports["upstream-1"]; ok || !created[1].closed {
+			t.Error("Least recently used transport should be dropped with its idle connections closed")
+		}
+		if _, ok := transports.transports["upstream-0"]; !ok || created[0].closed {
+			t.Error("Recently used transport should be kept")
+		}
+	})
+}
+
+// idleClosingTransport answers requests without connecting, recording if its
+// idle connections were closed.
+type idleClosingTransport struct {
+	closed bool
+}
+
+func (t *idleClosingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("")), Request: req}, nil
+}
+
+func (t *idleClosingTransport) CloseIdleConnections() {
+	t.closed = true
+}
+
+func TestHTTP2Upstreams(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	h2c, stop := startH2CUpstream(t)
+	defer stop()
+
+	tlsUpstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	tlsUpstream.EnableHTTP2 = true
+	tlsUpstream.StartTLS()
+	defer tlsUpstream.Close()
+
+	load := func(target string, conf func(spec *APISpec)) {
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.Proxy.ListenPath = "/"
+			spec.Proxy.TargetURL = target
+			spec.Proxy.Transport.SSLInsecureSkipVerify = true
+			conf(spec)
+		})
+	}
+
+	t.Run("h2c with prior knowledge", func(t *testing.T) {
+		load(h2c, func(spec *APISpec) {
+			spec.Proxy.Transport.HTTP2PriorKnowledge = true
+		})
+		ts.Run(t, test.TestCase{Path: "/", Code: http.StatusOK, BodyMatch: "HTTP/2.0"})
+	})
+
+	t.Run("TLS with prior knowledge", func(t *testing.T) {
+		load(tlsUpstream.URL, func(spec *APISpec) {
+			spec.Proxy.Transport.HTTP2PriorKnowledge = true
+		})
+		ts.Run(t, test.TestCase{Path: "/", Code: http.StatusOK, BodyMatch: "HTTP/2.0"})
+	})
+
+	t.Run("Negotiated", func(t *testing.T) {
+		load(tlsUpstream.URL, func(spec *APISpec) {
+			spec.Proxy.Transport.EnableHTTP2 = true
+		})
+		ts.Run(t, test.TestCase{Path: "/", Code: http.StatusOK, BodyMatch: "HTTP/2.0"})
+	})
+
+	t.Run("HTTP/2 left out of ALPN", func(t *testing.T) {
+		load(tlsUpstream.URL, func(spec *APISpec) {
+			spec.Proxy.Transport.EnableHTTP2 = true
+			spec.Proxy.Transport.ALPN = []string{"http/1.1"}
+		})
+		ts.Run(t, test.TestCase{Path: "/", Code: http.StatusOK, BodyMatch: "HTTP/1.1"})
+	})
+}
+
 func TestSingleJoiningSlash(t *testing.T) {
 	testsFalse := []struct {
 		a, b, want string
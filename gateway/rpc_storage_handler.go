@@ -300,6 +300,16 @@ func (r *RPCStorageHandler) SetRawKey(keyName, session string, timeout int64) er
 	return nil
 }
 
+// CompareAndSetKey is not available over RPC, sessions are written by the
+// management layer instead.
+func (r *RPCStorageHandler) CompareAndSetKey(keyName string, check func(string, bool) bool, value string, timeout int64) (bool, error) {
+	return false, storage.ErrNotSupported
+}
+
+func (r *RPCStorageHandler) CompareAndSetRawKey(keyName string, check func(string, bool) bool, value string, timeout int64) (bool, error) {
+	return false, storage.ErrNotSupported
+}
+
 // Decrement will decrement a key in redis
 func (r *RPCStorageHandler) Decrement(keyName string) {
 	log.Warning("Decrement called")
@@ -601,6 +611,12 @@ func (r *RPCStorageHandler) GetRollingWindow(keyName string, per int64, pipeline
 	return 0, nil
 }
 
+// SlidingWindow is not available over RPC, rate limiters count requests
+// locally instead.
+func (r *RPCStorageHandler) SlidingWindow(keyName string, per float64, limit int, burstPer float64, burst int, dryRun bool) (int, bool, error) {
+	return 0, false, storage.ErrNotSupported
+}
+
 func (r RPCStorageHandler) GetSet(keyName string) (map[string]string, error) {
 	log.Error("RPCStorageHandler.GetSet - Not implemented")
 	return nil, nil
@@ -866,6 +882,19 @@ func (r *RPCStorageHandler) AddToSortedSet(keyName, value string, score float64)
 	log.Error("RPCStorageHandler.AddToSortedSet - Not implemented")
 }
 
+func (r *RPCStorageHandler) AddToSortedSetPipelined(keyName string, scores map[string]float64) {
+	log.Error("RPCStorageHandler.AddToSortedSetPipelined - Not implemented")
+}
+
+func (r *RPCStorageHandler) IncrementSortedSetPipelined(keyName string, increments map[string]float64) {
+	log.Error("RPCStorageHandler.IncrementSortedSetPipelined - Not implemented")
+}
+
+func (r *RPCStorageHandler) GetSortedSetScore(keyName, value string) (float64, error) {
+	log.Error("RPCStorageHandler.GetSortedSetScore - Not implemented")
+	return 0, nil
+}
+
 func (r *RPCStorageHandler) GetSortedSetRange(keyName, scoreFrom, scoreTo string) ([]string, []float64, error) {
 	log.Error("RPCStorageHandler.GetSortedSetRange - Not implemented")
 	return nil, nil, nil
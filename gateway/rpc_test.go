@@ -155,9 +155,9 @@ func TestSyncAPISpecsRPCFailure_CheckGlobals(t *testing.T) {
 	defer stopRPCMock(rpc)
 
 	// Three cases: 1 API, 2 APIs and Malformed data
-	exp := []int{1, 4, 6, 6, 2}
+	exp := []int{2, 5, 7, 7, 3}
 	if *cli.HTTPProfile {
-		exp = []int{4, 6, 8, 8, 4}
+		exp = []int{5, 7, 9, 9, 5}
 	}
 
 	for _, e := range exp {
@@ -69,6 +69,14 @@ var (
 	RPCListener              RPCStorageHandler
 	DashService              DashboardServiceSender
 	CertificateManager       *certs.CertificateManager
+	ACMEManager              *certs.ACMEManager
+	CertificateExpiryWatcher *certs.ExpiryWatcher
+	CRLManager               *certs.CRLManager
+	OCSPManager              *certs.OCSPManager
+	CertificateSelector      *certs.CertificateSelector
+	SessionTicketKeys        *certs.SessionTicketKeys
+	KubernetesSync           *certs.KubernetesSync
+	SPIFFESource             *certs.SPIFFESource
 	NewRelicApplication      newrelic.Application
 
 	apisMu   sync.RWMutex
@@ -169,6 +177,10 @@ func setupGlobals() {
 	redisStore := storage.RedisCluster{KeyPrefix: "apikey-", HashKeys: config.Global().HashKeys}
 	FallbackKeySesionManager.Init(&redisStore)
 
+	if config.Global().KeyUsage.Enabled {
+		startKeyUsageFlush()
+	}
+
 	if config.Global().EnableAnalytics && analytics.Store == nil {
 		globalConf := config.Global()
 		globalConf.LoadIgnoredIPs()
@@ -235,7 +247,94 @@ func setupGlobals() {
 		certificateSecret = config.Global().Security.PrivateCertificateEncodingSecret
 	}
 
-	CertificateManager = certs.NewCertificateManager(getGlobalStorageHandler("cert-", false), certificateSecret, log)
+	certStorage := getCertificateStorage(config.Global().Security.CertificateStorage)
+	CertificateManager = certs.NewCertificateManager(certStorage, certificateSecret, log)
+	CertificateManager.OnReplace(onCertificateReplaced)
+	if cacheConf := config.Global().Security.CertificateCache; cacheConf.MaxEntries > 0 || cacheConf.MaxBytes > 0 {
+		CertificateManager.SetCacheLimits(cacheConf.MaxEntries, cacheConf.MaxBytes)
+	}
+	CertificateManager.SetNegativeCacheTTL(time.Duration(config.Global().Security.CertificateCache.NegativeTTL) * time.Second)
+	CertificateManager.SetDeleteRetention(time.Duration(config.Global().Security.CertificateSoftDelete.Retention) * time.Second)
+	setupCertificateAudit(config.Global().Security.CertificateAudit)
+	if encryption := config.Global().Security.PrivateKeyEncryption; encryption != "" {
+		CertificateManager.SetKeyEncryption(certs.KeyEncryption(encryption))
+	}
+	CertificateManager.SetFetchIntermediates(config.Global().Security.FetchIntermediates)
+	setupCertificateKeyPolicy(config.Global().Security.CertificateKeyPolicy)
+
+	if vaultConf := config.Global().Security.CertificateStorage.Vault; vaultConf.Address != "" {
+		CertificateManager.AddSource(certs.NewVaultSource(vaultConf.Address, vaultConf.Token))
+	}
+
+	if vaultConf := config.Global().Security.CertificateStorage.Vault; vaultConf.PKIRole != "" {
+		CertificateManager.SetIssuer(certs.NewVaultPKI(vaultConf.Address, vaultConf.Token, vaultConf.PKIMount, vaultConf.PKIRole, time.Duration(vaultConf.PKITTL)*time.Second))
+	}
+
+	if awsConf := config.Global().Security.CertificateSources.AWS; awsConf.Enabled {
+		awsSource := certs.NewAWSSource(certs.AWSCredentials{
+			AccessKeyID:     awsConf.AccessKeyID,
+			SecretAccessKey: awsConf.SecretAccessKey,
+			SessionToken:    awsConf.SessionToken,
+		})
+		CertificateManager.AddSource(awsSource)
+		certs.RegisterKeyLoader("arn", awsSource.LoadKey)
+	}
+
+	if ctConf := config.Global().Security.CertificateTransparency; ctConf.Enabled {
+		if err := CertificateManager.SetCTPolicy(certificateTransparencyPolicy(ctConf)); err != nil {
+			certLog.Error("Can't set certificate transparency policy: ", err)
+		}
+	}
+
+	if SPIFFESource != nil {
+		SPIFFESource.Stop()
+		SPIFFESource = nil
+	}
+
+	if spiffeConf := config.Global().Security.SPIFFE; spiffeConf.Enabled {
+		SPIFFESource = certs.NewSPIFFESource(spiffeConf.WorkloadAPISocket, log)
+		SPIFFESource.OnUpdate(onSVIDUpdate)
+		CertificateManager.AddSource(SPIFFESource)
+	}
+
+	CRLManager = certs.NewCRLManager(certStorage, config.Global().Security.CRL.Sources, log)
+	CertificateManager.AddRevocationChecker(CRLManager)
+
+	if OCSPManager != nil {
+		OCSPManager.StopStapling()
+	}
+	OCSPManager = certs.NewOCSPManager(CertificateManager)
+	if config.Global().Security.OCSP.StapleServerCertificates {
+		OCSPManager.StartStapling(0)
+	}
+	if config.Global().Security.OCSP.CheckClientCertificates {
+		CertificateManager.AddRevocationChecker(OCSPManager)
+	}
+
+	if acmeConf := config.Global().HttpServerOptions.ACME; acmeConf.Enabled {
+		setupACME(acmeConf)
+	}
+
+	CertificateSelector = nil
+	if dynamicConf := config.Global().HttpServerOptions.DynamicCertificates; dynamicConf.Enabled {
+		CertificateSelector = certs.NewCertificateSelector(CertificateManager, dynamicConf.DefaultCertificate)
+	}
+
+	if SessionTicketKeys != nil {
+		SessionTicketKeys.Stop()
+		SessionTicketKeys = nil
+	}
+
+	if ticketConf := config.Global().HttpServerOptions.SessionTicketKeys; ticketConf.Enabled {
+		SessionTicketKeys = certs.NewSessionTicketKeys(CertificateManager, time.Duration(ticketConf.RotationInterval)*time.Second)
+		if err := SessionTicketKeys.Rotate(); err != nil {
+			certLog.Error("Can't load session ticket keys: ", err)
+		}
+	}
+
+	if monitorConf := config.Global().Security.CertificateExpiryMonitor; monitorConf.Enabled {
+		CertificateExpiryWatcher = setupCertificateExpiryMonitor(monitorConf)
+	}
 
 	if config.Global().NewRelic.AppName != "" {
 		NewRelicApplication = SetupNewRelic()
@@ -284,7 +383,9 @@ func syncAPISpecs() (int, error) {
 			return 0, err
 		}
 	} else {
-		apiSpecs = loader.FromDir(config.Global().AppPath)
+		// Definitions managed by Dashboard or RPC are validated before
+		// they reach the gateway
+		apiSpecs = filterInvalidSpecs(loader.FromDir(config.Global().AppPath))
 	}
 
 	mainLog.Printf("Detected %v APIs", len(apiSpecs))
@@ -304,6 +405,34 @@ func syncAPISpecs() (int, error) {
 	return len(apiSpecs), nil
 }
 
+// filterInvalidSpecs skips API definitions which don't pass validation, so a
+// broken definition doesn't break the gateway.
+func filterInvalidSpecs(specs []*APISpec) []*APISpec {
+	valid := specs[:0]
+	for _, spec := range specs {
+		if err := spec.APIDefinition.Validate(); err != nil {
+			logger := mainLog.WithFields(logrus.Fields{
+				"api_id":   spec.APIID,
+				"api_name": spec.Name,
+			})
+
+			if errs, ok := err.(apidef.ValidationErrors); ok {
+				for _, fieldErr := range errs {
+					logger.WithField("field", fieldErr.Field).Error("Invalid API definition: ", fieldErr.Message)
+				}
+			} else {
+				logger.Error("Invalid API definition: ", err)
+			}
+			logger.Error("Skipping invalid API definition")
+
+			continue
+		}
+		valid = append(valid, spec)
+	}
+
+	return valid
+}
+
 func syncPolicies() (count int, err error) {
 	var pols map[string]user.Policy
 
@@ -363,7 +492,8 @@ func stripSlashes(next http.Handler) http.Handler {
 func controlAPICheckClientCertificate(certLevel string, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if config.Global().Security.ControlAPIUseMutualTLS {
-			if err := CertificateManager.ValidateRequestCertificate(config.Global().Security.Certificates.ControlAPI, r); err != nil {
+			opts := certificateValidationOptions(config.Global().Security.ControlAPICertificateValidation)
+			if err := CertificateManager.ValidateRequestCertificateWithOptions(config.Global().Security.Certificates.ControlAPI, r, opts); err != nil {
 				doJSONWrite(w, http.StatusForbidden, apiError(err.Error()))
 				return
 			}
@@ -381,6 +511,9 @@ func loadAPIEndpoints(muxer *mux.Router) {
 	}
 
 	r := mux.NewRouter()
+	muxer.PathPrefix("/tyk/certs").Handler(http.StripPrefix("/tyk",
+		stripSlashes(checkIsCertificateOwner(controlAPICheckClientCertificate("/gateway/client", InstrumentationMW(r)))),
+	))
 	muxer.PathPrefix("/tyk/").Handler(http.StripPrefix("/tyk",
 		stripSlashes(checkIsAPIOwner(controlAPICheckClientCertificate("/gateway/client", InstrumentationMW(r)))),
 	))
@@ -395,6 +528,10 @@ func loadAPIEndpoints(muxer *mux.Router) {
 		muxer.HandleFunc("/debug/pprof/{_:.*}", pprof_http.Index)
 	}
 
+	if path := config.Global().Security.PublishedJWKS.Path; path != "" {
+		muxer.HandleFunc(path, publishedJWKSHandler).Methods("GET")
+	}
+
 	r.MethodNotAllowedHandler = MethodNotAllowedHandler{}
 
 	mainLog.Info("Initialising Tyk REST API Endpoints")
@@ -408,23 +545,50 @@ func loadAPIEndpoints(muxer *mux.Router) {
 		r.HandleFunc("/org/keys/{keyName:[^/]*}", orgHandler).Methods("POST", "PUT", "GET", "DELETE")
 		r.HandleFunc("/keys/policy/{keyName}", policyUpdateHandler).Methods("POST")
 		r.HandleFunc("/keys/create", createKeyHandler).Methods("POST")
+		r.HandleFunc("/keys/batch", keyBatchHandler).Methods("POST")
 		r.HandleFunc("/apis", apiHandler).Methods("GET", "POST", "PUT", "DELETE")
+		r.HandleFunc("/apis/oas", apiOASImportHandler).Methods("POST")
 		r.HandleFunc("/apis/{apiID}", apiHandler).Methods("GET", "POST", "PUT", "DELETE")
+		r.HandleFunc("/apis/{apiID}/oas", apiOASExportHandler).Methods("GET")
 		r.HandleFunc("/health", healthCheckhandler).Methods("GET")
 		r.HandleFunc("/oauth/clients/create", createOauthClient).Methods("POST")
 		r.HandleFunc("/oauth/clients/{apiID}/{keyName:[^/]*}", oAuthClientHandler).Methods("PUT")
 		r.HandleFunc("/oauth/refresh/{keyName}", invalidateOauthRefresh).Methods("DELETE")
 		r.HandleFunc("/cache/{apiID}", invalidateCacheHandler).Methods("DELETE")
+		r.HandleFunc("/ip-lists/{name}", ipListHandler).Methods("GET", "PUT", "DELETE")
 	} else {
 		mainLog.Info("Node is slaved, REST API minimised")
 	}
 
 	r.HandleFunc("/debug", traceHandler).Methods("POST")
+	r.HandleFunc("/apis/{apiID}/targets", upstreamHealthHandler).Methods("GET")
+	r.HandleFunc("/apis/{apiID}/versions/rollback", versionRollbackHandler).Methods("POST")
+	r.HandleFunc("/apis/{apiID}/maintenance", maintenanceHandler).Methods("GET", "PUT", "DELETE")
 
+	r.HandleFunc("/keys/usage", staleKeysHandler).Methods("GET")
+	r.HandleFunc("/keys/{keyName:[^/]*}/usage", keyUsageHandler).Methods("GET")
+	r.HandleFunc("/keys/{keyName:[^/]*}/policies", keyPoliciesHandler).Methods("GET")
 	r.HandleFunc("/keys", keyHandler).Methods("POST", "PUT", "GET", "DELETE")
 	r.HandleFunc("/keys/{keyName:[^/]*}", keyHandler).Methods("POST", "PUT", "GET", "DELETE")
 	r.HandleFunc("/certs", certHandler).Methods("POST", "GET")
-	r.HandleFunc("/certs/{certID:[^/]*}", certHandler).Methods("POST", "GET", "DELETE")
+	r.HandleFunc("/certs/batch", certBatchHandler).Methods("POST")
+	r.HandleFunc("/certs/issue", certIssueHandler).Methods("POST")
+	r.HandleFunc("/certs/search", certSearchHandler).Methods("GET")
+	r.HandleFunc("/certs/jwks", certJWKSHandler).Methods("GET")
+	r.HandleFunc("/certs/metrics", certMetricsHandler).Methods("GET")
+	r.HandleFunc("/certs/export", certExportHandler).Methods("GET")
+	r.HandleFunc("/certs/import", certImportHandler).Methods("POST")
+	r.HandleFunc("/certs/generate", certGenerateHandler).Methods("POST")
+	r.HandleFunc("/certs/csr", certRequestHandler).Methods("POST")
+	r.HandleFunc("/certs/deleted", certDeletedHandler).Methods("GET")
+	r.HandleFunc("/certs/csr/{csrID:[^/]*}", certRequestHandler).Methods("POST", "GET")
+	r.HandleFunc("/certs/{certID:[^/]*}", certHandler).Methods("POST", "GET", "PUT", "DELETE")
+	r.HandleFunc("/certs/{certID:[^/]*}/tags", certTagsHandler).Methods("PUT")
+	r.HandleFunc("/certs/{certID:[^/]*}/usage", certUsageHandler).Methods("GET")
+	r.HandleFunc("/certs/{certID:[^/]*}/bundle", certBundleHandler).Methods("GET")
+	r.HandleFunc("/certs/{certID:[^/]*}/restore", certRestoreHandler).Methods("POST")
+	r.HandleFunc("/crls", crlHandler).Methods("POST", "GET")
+	r.HandleFunc("/crls/{crlID:[^/]*}", crlHandler).Methods("DELETE")
 	r.HandleFunc("/oauth/clients/{apiID}", oAuthClientHandler).Methods("GET", "DELETE")
 	r.HandleFunc("/oauth/clients/{apiID}/{keyName:[^/]*}", oAuthClientHandler).Methods("GET", "DELETE")
 	r.HandleFunc("/oauth/clients/{apiID}/{keyName}/tokens", oAuthClientTokensHandler).Methods("GET")
@@ -451,6 +615,26 @@ func checkIsAPIOwner(next http.Handler) http.Handler {
 	})
 }
 
+// checkIsCertificateOwner lets organisations with their certificate org
+// secret use the certificate API, besides the accessors of the tyk API.
+// Requests of organisations are scoped to their own certificates.
+func checkIsCertificateOwner(next http.Handler) http.Handler {
+	owner := checkIsAPIOwner(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tykAuthKey := r.Header.Get(headers.XTykAuthorization)
+		if tykAuthKey != config.Global().Secret {
+			for orgID, secret := range config.Global().Security.CertificateOrgSecrets {
+				if orgID != "" && secret != "" && tykAuthKey == secret {
+					ctxSetCertificateOrg(r, orgID)
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+		owner.ServeHTTP(w, r)
+	})
+}
+
 func generateOAuthPrefix(apiID string) string {
 	return "oauth-data." + apiID + "."
 }
@@ -915,7 +1099,7 @@ func initialiseSystem() error {
 	getHostDetails()
 	setupInstrumentation()
 
-	if config.Global().HttpServerOptions.UseLE_SSL {
+	if config.Global().HttpServerOptions.UseLE_SSL || config.Global().HttpServerOptions.ACME.Enabled {
 		go StartPeriodicStateBackup(&LE_MANAGER)
 	}
 
@@ -1171,6 +1355,62 @@ func start() {
 		go RPCListener.StartRPCLoopCheck(slaveOptions.RPCKey)
 	}
 
+	if ACMEManager != nil {
+		acmeConf := config.Global().HttpServerOptions.ACME
+		ACMEManager.Start(acmeConf.Hosts, time.Duration(acmeConf.CheckInterval)*time.Second)
+	}
+
+	if CertificateExpiryWatcher != nil {
+		interval := time.Duration(config.Global().Security.CertificateExpiryMonitor.CheckInterval) * time.Second
+		CertificateExpiryWatcher.Start(interval)
+	}
+
+	CRLManager.Start(time.Duration(config.Global().Security.CRL.RefreshInterval) * time.Second)
+
+	if k8sConf := config.Global().Security.KubernetesSecrets; k8sConf.Enabled {
+		var err error
+		if KubernetesSync, err = certs.NewKubernetesSync(CertificateManager, k8sConf.Namespaces, k8sConf.WriteBackNamespace); err != nil {
+			certLog.Error("Can't start Kubernetes secrets sync: ", err)
+		} else {
+			CertificateManager.AddSource(KubernetesSync)
+			KubernetesSync.Start()
+		}
+	}
+
+	if grpcConf := config.Global().Security.CertificateGRPC; grpcConf.Enabled {
+		if _, err := startCertificateGRPC(grpcConf); err != nil {
+			certLog.Error("Can't start certificate gRPC service: ", err)
+		}
+	}
+
+	if SessionTicketKeys != nil {
+		SessionTicketKeys.Start(time.Duration(config.Global().HttpServerOptions.SessionTicketKeys.CheckInterval) * time.Second)
+	}
+
+	if SPIFFESource != nil {
+		SPIFFESource.Start()
+	}
+
+	for _, jwksConf := range config.Global().Security.JWKSImports {
+		CertificateManager.ImportJWKS(jwksConf.URL, jwksConf.OrgID,
+			time.Duration(jwksConf.RefreshInterval)*time.Second,
+			time.Duration(jwksConf.Retention)*time.Second).Start()
+	}
+
+	if cacheConf := config.Global().Security.CertificateCache; cacheConf.AsyncRefresh {
+		CertificateManager.StartRefresh(time.Duration(cacheConf.RefreshInterval) * time.Second)
+	}
+
+	if softDelete := config.Global().Security.CertificateSoftDelete; softDelete.Retention > 0 {
+		CertificateManager.StartPurge(time.Duration(softDelete.PurgeInterval) * time.Second)
+	}
+
+	if config.Global().Security.CertificateCache.WatchFiles {
+		if err := CertificateManager.StartFileWatch(); err != nil {
+			certLog.Error("Can't watch certificate files: ", err)
+		}
+	}
+
 	// 1s is the minimum amount of time between hot reloads. The
 	// interval counts from the start of one reload to the next.
 	go reloadLoop(time.Tick(time.Second))
@@ -1189,6 +1429,8 @@ func generateListener(listenPort int) (net.Listener, error) {
 			GetCertificate:     dummyGetCertificate,
 			ServerName:         httpServerOptions.ServerName,
 			MinVersion:         httpServerOptions.MinVersion,
+			MaxVersion:         httpServerOptions.MaxVersion,
+			CurvePreferences:   getCurves(httpServerOptions.Curves),
 			ClientAuth:         tls.NoClientCert,
 			InsecureSkipVerify: httpServerOptions.SSLInsecureSkipVerify,
 			CipherSuites:       getCipherAliases(httpServerOptions.Ciphers),
@@ -1263,8 +1505,13 @@ func (_ mainHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	AddNewRelicInstrumentation(NewRelicApplication, mainRouter)
 	reloadMu.Unlock()
 
-	// make request body to be nopCloser and re-readable before serve it through chain of middlewares
-	nopCloseRequestBody(r)
+	// make request body re-readable through the chain of middlewares, once
+	// they read it
+	if r.Body != nil {
+		body := newLazyBody(r)
+		defer body.release()
+		r.Body = body
+	}
 	mainRouter.ServeHTTP(w, r)
 }
 
@@ -1286,6 +1533,13 @@ func listen(listener, controlListener net.Listener, err error) {
 		loadAPIEndpoints(controlRouter)
 	}
 
+	// Hold connections until APIs and their certificates are loaded
+	var warmedUp chan struct{}
+	if config.Global().Security.CertificateCache.Preload {
+		warmedUp = make(chan struct{})
+		listener = &warmUpListener{Listener: listener, ready: warmedUp}
+	}
+
 	// Error not empty if handle reload when SIGUSR2 is received
 	if err != nil {
 		// Listen on a TCP or a UNIX domain socket (TCP here).
@@ -1424,4 +1678,21 @@ func listen(listener, controlListener net.Listener, err error) {
 	if !rpc.IsEmergencyMode() {
 		doReload()
 	}
+
+	if warmedUp != nil {
+		mainLog.Info("Warm-up complete, accepting connections")
+		close(warmedUp)
+	}
+}
+
+// warmUpListener doesn't accept connections until ready is closed. Clients
+// connecting meanwhile wait in the listen backlog.
+type warmUpListener struct {
+	net.Listener
+	ready chan struct{}
+}
+
+func (l *warmUpListener) Accept() (net.Conn, error) {
+	<-l.ready
+	return l.Listener.Accept()
 }
@@ -23,6 +23,10 @@ type ServiceDiscovery struct {
 	parentPath          string
 	portPath            string
 	targetPath          string
+	weightPath          string
+	priorityPath        string
+	// weights of the hosts of the last list parsed, if weighted.
+	weights []apidef.HostWeight
 }
 
 func (s *ServiceDiscovery) Init(spec *apidef.ServiceDiscoveryConfiguration) {
@@ -31,6 +35,8 @@ func (s *ServiceDiscovery) Init(spec *apidef.ServiceDiscoveryConfiguration) {
 	s.isTargetList = spec.UseTargetList
 	s.endpointReturnsList = spec.EndpointReturnsList
 	s.targetPath = spec.TargetPath
+	s.weightPath = spec.WeightDataPath
+	s.priorityPath = spec.PriorityDataPath
 
 	if spec.PortDataPath != "" {
 		s.portSeperate = true
@@ -97,6 +103,41 @@ func (s *ServiceDiscovery) addPortFromObject(host string, obj *gabs.Container) s
 	return host + ":" + portToUse
 }
 
+func (s *ServiceDiscovery) intFromObject(path string, obj *gabs.Container) int {
+	value := s.decodeToNameSpace(path, obj)
+	switch x := value.(type) {
+	case []interface{}:
+		if len(x) > 0 {
+			value = x[0]
+		}
+	}
+
+	switch x := value.(type) {
+	case string:
+		n, _ := strconv.Atoi(x)
+		return n
+	case float64:
+		return int(x)
+	}
+	return 0
+}
+
+// addWeightFromObject records the weight and priority of the host of obj,
+// if their paths are set.
+func (s *ServiceDiscovery) addWeightFromObject(obj *gabs.Container) {
+	if s.weightPath == "" && s.priorityPath == "" {
+		return
+	}
+	var weight apidef.HostWeight
+	if s.weightPath != "" {
+		weight.Weight = s.intFromObject(s.weightPath, obj)
+	}
+	if s.priorityPath != "" {
+		weight.Priority = s.intFromObject(s.priorityPath, obj)
+	}
+	s.weights = append(s.weights, weight)
+}
+
 func (s *ServiceDiscovery) NestedObject(item *gabs.Container) string {
 	parentData := s.decodeToNameSpace(s.parentPath, item)
 	// Get the data path from the decoded object
@@ -138,6 +179,7 @@ func (s *ServiceDiscovery) isList(val string) bool {
 }
 
 func (s *ServiceDiscovery) SubObjectFromList(objList *gabs.Container) []string {
+	s.weights = nil
 	hostList := []string{}
 	var hostname string
 	var set []*gabs.Container
@@ -169,6 +211,7 @@ func (s *ServiceDiscovery) SubObjectFromList(objList *gabs.Container) []string {
 				hostname = s.Object(item) + s.targetPath
 				// Add to list
 				hostList = append(hostList, hostname)
+				s.addWeightFromObject(item)
 			}
 			return hostList
 		}
@@ -185,6 +228,7 @@ func (s *ServiceDiscovery) SubObjectFromList(objList *gabs.Container) []string {
 		hostname = s.Hostname(item) + s.targetPath
 		// Add to list
 		hostList = append(hostList, hostname)
+		s.addWeightFromObject(item)
 	}
 	return hostList
 }
@@ -229,6 +273,7 @@ func (s *ServiceDiscovery) ProcessRawData(rawData string) (*apidef.HostList, err
 			asList := s.SubObjectFromList(&jsonParsed)
 			log.Debug("Host list:", asList)
 			hostlist.Set(asList)
+			hostlist.SetWeights(s.weights)
 			return hostlist, nil
 		}
 
@@ -253,6 +298,7 @@ func (s *ServiceDiscovery) ProcessRawData(rawData string) (*apidef.HostList, err
 
 		asList := s.SubObjectFromList(&jsonParsed)
 		hostlist.Set(asList)
+		hostlist.SetWeights(s.weights)
 		log.Debug("Got from object: ", hostlist)
 		return hostlist, nil
 	}
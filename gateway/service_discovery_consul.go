@@ -0,0 +1,130 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+// consulWait is how long Consul holds a blocking query before answering that
+// nothing changed.
+const consulWait = "5m"
+
+// consulDiscovery watches the healthy instances of a service with blocking
+// queries, answered as soon as they change.
+type consulDiscovery struct {
+	conf   apidef.ConsulDiscoveryMeta
+	client *http.Client
+}
+
+func newConsulDiscovery(conf apidef.ConsulDiscoveryMeta) *consulDiscovery {
+	if conf.Address == "" {
+		conf.Address = "http://127.0.0.1:8500"
+	}
+	if conf.Scheme == "" {
+		conf.Scheme = "http"
+	}
+	return &consulDiscovery{conf: conf, client: &http.Client{}}
+}
+
+type consulServiceEntry struct {
+	Node struct {
+		Address string
+	}
+	Service struct {
+		Address string
+		Port    int
+		Weights struct {
+			Passing int
+		}
+	}
+}
+
+// Watch queries the healthy instances again each time Consul answers, from
+// the index of the last answer.
+func (c *consulDiscovery) Watch(update func([]string, []apidef.HostWeight), stop <-chan struct{}) error {
+	ctx, cancel := stopContext(stop)
+	defer cancel()
+
+	var index uint64
+	for {
+		entries, next, err := c.query(ctx, index)
+		if err != nil {
+			return err
+		}
+		// Consul resets the index by taking it back, and only blocks
+		// on indexes from 1 on
+		if next < index {
+			next = 0
+		} else if next == index {
+			continue
+		}
+		update(c.targets(entries))
+		if index = next; index == 0 {
+			index = 1
+		}
+	}
+}
+
+func (c *consulDiscovery) query(ctx context.Context, index uint64) ([]consulServiceEntry, uint64, error) {
+	query := url.Values{}
+	query.Set("passing", "1")
+	if c.conf.Tag != "" {
+		query.Set("tag", c.conf.Tag)
+	}
+	if c.conf.Datacenter != "" {
+		query.Set("dc", c.conf.Datacenter)
+	}
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", consulWait)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(c.conf.Address, "/")+"/v1/health/service/"+url.PathEscape(c.conf.Service)+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req = req.WithContext(ctx)
+	if c.conf.Token != "" {
+		req.Header.Set("X-Consul-Token", c.conf.Token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("consul returned %s", resp.Status)
+	}
+
+	var entries []consulServiceEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, 0, err
+	}
+	next, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	return entries, next, nil
+}
+
+// targets returns the URLs of the instances, at the address of their node if
+// they registered none.
+func (c *consulDiscovery) targets(entries []consulServiceEntry) ([]string, []apidef.HostWeight) {
+	hosts := make([]string, 0, len(entries))
+	weights := make([]apidef.HostWeight, 0, len(entries))
+	for _, entry := range entries {
+		address := entry.Service.Address
+		if address == "" {
+			address = entry.Node.Address
+		}
+		hosts = append(hosts, c.conf.Scheme+"://"+net.JoinHostPort(address, strconv.Itoa(entry.Service.Port)))
+		weights = append(weights, apidef.HostWeight{Weight: entry.Service.Weights.Passing})
+	}
+	return hosts, weights
+}
@@ -0,0 +1,83 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+type testDiscoveryUpdate struct {
+	hosts   []string
+	weights []apidef.HostWeight
+}
+
+// watchTestDiscovery watches provider until stop is closed, sending its
+// updates.
+func watchTestDiscovery(provider discoveryProvider, stop <-chan struct{}) <-chan testDiscoveryUpdate {
+	updates := make(chan testDiscoveryUpdate, 10)
+	go provider.Watch(func(hosts []string, weights []apidef.HostWeight) {
+		updates <- testDiscoveryUpdate{hosts, weights}
+	}, stop)
+	return updates
+}
+
+func TestConsulDiscovery(t *testing.T) {
+	changed := make(chan struct{})
+	consul := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/health/service/web" || r.URL.Query().Get("passing") != "1" || r.URL.Query().Get("tag") != "v2" {
+			t.Errorf("Unexpected query %s", r.URL)
+		}
+		if r.Header.Get("X-Consul-Token") != "secret" {
+			t.Error("Expected the ACL token to be sent")
+		}
+
+		switch r.URL.Query().Get("index") {
+		case "":
+			w.Header().Set("X-Consul-Index", "5")
+			w.Write([]byte(`[
+				{"Node": {"Address": "10.0.0.1"}, "Service": {"Address": "", "Port": 8080, "Weights": {"Passing": 3}}},
+				{"Node": {"Address": "10.0.0.2"}, "Service": {"Address": "10.1.0.2", "Port": 8080, "Weights": {"Passing": 1}}}
+			]`))
+		case "5":
+			select {
+			case <-changed:
+			case <-r.Context().Done():
+				return
+			}
+			w.Header().Set("X-Consul-Index", "6")
+			w.Write([]byte(`[{"Node": {"Address": "10.0.0.1"}, "Service": {"Port": 8080, "Weights": {"Passing": 3}}}]`))
+		default:
+			<-r.Context().Done()
+		}
+	}))
+	defer consul.Close()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	updates := watchTestDiscovery(newConsulDiscovery(apidef.ConsulDiscoveryMeta{
+		Address: consul.URL,
+		Service: "web",
+		Tag:     "v2",
+		Token:   "secret",
+	}), stop)
+
+	want := testDiscoveryUpdate{
+		hosts:   []string{"http://10.0.0.1:8080", "http://10.1.0.2:8080"},
+		weights: []apidef.HostWeight{{Weight: 3}, {Weight: 1}},
+	}
+	if got := <-updates; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+
+	close(changed)
+	want = testDiscoveryUpdate{
+		hosts:   []string{"http://10.0.0.1:8080"},
+		weights: []apidef.HostWeight{{Weight: 3}},
+	}
+	if got := <-updates; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected the blocking query to update the targets to %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,125 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+// dnsSRVMinRefresh bounds how often the records are looked up again, however
+// short their TTL.
+const dnsSRVMinRefresh = time.Second
+
+// dnsSRVDiscovery looks the targets up in SRV records, again each time their
+// TTL expires.
+type dnsSRVDiscovery struct {
+	conf   apidef.DNSSRVDiscoveryMeta
+	client *dns.Client
+}
+
+func newDNSSRVDiscovery(conf apidef.DNSSRVDiscoveryMeta) *dnsSRVDiscovery {
+	if conf.Scheme == "" {
+		conf.Scheme = "http"
+	}
+	conf.Name = dns.Fqdn(conf.Name)
+	return &dnsSRVDiscovery{conf: conf, client: &dns.Client{Timeout: 5 * time.Second}}
+}
+
+func (d *dnsSRVDiscovery) nameserver() (string, error) {
+	if d.conf.Nameserver != "" {
+		return d.conf.Nameserver, nil
+	}
+	conf, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+	if err != nil {
+		return "", err
+	}
+	if len(conf.Servers) == 0 {
+		return "", errors.New("no nameserver in /etc/resolv.conf")
+	}
+	return net.JoinHostPort(conf.Servers[0], conf.Port), nil
+}
+
+func (d *dnsSRVDiscovery) Watch(update func([]string, []apidef.HostWeight), stop <-chan struct{}) error {
+	var last string
+	for {
+		records, ttl, err := d.lookup()
+		if err != nil {
+			return err
+		}
+
+		hosts, weights := d.targets(records)
+		if id := fmt.Sprint(hosts, weights); id != last {
+			last = id
+			update(hosts, weights)
+		}
+
+		if ttl < dnsSRVMinRefresh {
+			ttl = dnsSRVMinRefresh
+		}
+		select {
+		case <-time.After(ttl):
+		case <-stop:
+			return nil
+		}
+	}
+}
+
+// lookup returns the SRV records of the name, and the lowest of their TTLs.
+func (d *dnsSRVDiscovery) lookup() ([]*dns.SRV, time.Duration, error) {
+	server, err := d.nameserver()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(d.conf.Name, dns.TypeSRV)
+	resp, _, err := d.client.Exchange(msg, server)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		return nil, 0, errors.New("SRV lookup of " + d.conf.Name + " failed: " + dns.RcodeToString[resp.Rcode])
+	}
+
+	var records []*dns.SRV
+	var ttl uint32
+	for _, answer := range resp.Answer {
+		srv, ok := answer.(*dns.SRV)
+		if !ok {
+			continue
+		}
+		if len(records) == 0 || srv.Hdr.Ttl < ttl {
+			ttl = srv.Hdr.Ttl
+		}
+		records = append(records, srv)
+	}
+	return records, time.Duration(ttl) * time.Second, nil
+}
+
+// targets returns the URLs of the records, sorted as DNS servers shuffle
+// them.
+func (d *dnsSRVDiscovery) targets(records []*dns.SRV) ([]string, []apidef.HostWeight) {
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Target != records[j].Target {
+			return records[i].Target < records[j].Target
+		}
+		return records[i].Port < records[j].Port
+	})
+
+	hosts := make([]string, len(records))
+	weights := make([]apidef.HostWeight, len(records))
+	for i, srv := range records {
+		host := strings.TrimSuffix(srv.Target, ".")
+		hosts[i] = d.conf.Scheme + "://" + net.JoinHostPort(host, strconv.Itoa(int(srv.Port)))
+		weights[i] = apidef.HostWeight{Weight: int(srv.Weight), Priority: int(srv.Priority)}
+	}
+	return hosts, weights
+}
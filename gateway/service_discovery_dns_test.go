@@ -0,0 +1,70 @@
+package gateway
+
+import (
+	"net"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+func TestDNSSRVDiscovery(t *testing.T) {
+	var lookups int32
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	server := &dns.Server{
+		PacketConn:        conn,
+		NotifyStartedFunc: func() { close(started) },
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			msg := new(dns.Msg)
+			msg.SetReply(r)
+			srv := func(target string, port, weight, priority uint16) dns.RR {
+				return &dns.SRV{
+					Hdr:      dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: 1},
+					Target:   target,
+					Port:     port,
+					Weight:   weight,
+					Priority: priority,
+				}
+			}
+			msg.Answer = append(msg.Answer, srv("b.example.com.", 8080, 1, 0), srv("a.example.com.", 8080, 3, 0))
+			if atomic.AddInt32(&lookups, 1) > 1 {
+				msg.Answer = append(msg.Answer, srv("c.example.com.", 9090, 1, 1))
+			}
+			w.WriteMsg(msg)
+		}),
+	}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+	<-started
+
+	stop := make(chan struct{})
+	defer close(stop)
+	updates := watchTestDiscovery(newDNSSRVDiscovery(apidef.DNSSRVDiscoveryMeta{
+		Name:       "_http._tcp.web.example.com",
+		Nameserver: conn.LocalAddr().String(),
+	}), stop)
+
+	want := testDiscoveryUpdate{
+		hosts:   []string{"http://a.example.com:8080", "http://b.example.com:8080"},
+		weights: []apidef.HostWeight{{Weight: 3}, {Weight: 1}},
+	}
+	if got := <-updates; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+
+	// Looked up again once the TTL expires
+	want = testDiscoveryUpdate{
+		hosts:   []string{"http://a.example.com:8080", "http://b.example.com:8080", "http://c.example.com:9090"},
+		weights: []apidef.HostWeight{{Weight: 3}, {Weight: 1}, {Weight: 1, Priority: 1}},
+	}
+	if got := <-updates; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,149 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+// eurekaDiscovery fetches the instances of an application that are up every
+// refresh interval, as Eureka clients do, updating the targets only when they
+// change.
+type eurekaDiscovery struct {
+	conf   apidef.EurekaDiscoveryMeta
+	client *http.Client
+}
+
+func newEurekaDiscovery(conf apidef.EurekaDiscoveryMeta) *eurekaDiscovery {
+	if conf.Address == "" {
+		conf.Address = "http://127.0.0.1:8761/eureka"
+	}
+	if conf.RefreshInterval <= 0 {
+		conf.RefreshInterval = 30
+	}
+	return &eurekaDiscovery{
+		conf:   conf,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type eurekaPort struct {
+	Port    json.Number `json:"$"`
+	Enabled string      `json:"@enabled"`
+}
+
+type eurekaInstance struct {
+	HostName   string            `json:"hostName"`
+	IPAddr     string            `json:"ipAddr"`
+	Status     string            `json:"status"`
+	Port       eurekaPort        `json:"port"`
+	SecurePort eurekaPort        `json:"securePort"`
+	Metadata   map[string]string `json:"metadata"`
+}
+
+func (e *eurekaDiscovery) Watch(update func([]string, []apidef.HostWeight), stop <-chan struct{}) error {
+	ctx, cancel := stopContext(stop)
+	defer cancel()
+
+	ticker := time.NewTicker(time.Duration(e.conf.RefreshInterval) * time.Second)
+	defer ticker.Stop()
+
+	var last string
+	for {
+		req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(e.conf.Address, "/")+"/apps/"+url.PathEscape(e.conf.App), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/json")
+		instances, err := e.fetch(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+
+		hosts, weights := e.targets(instances)
+		if id := fmt.Sprint(hosts, weights); id != last {
+			last = id
+			update(hosts, weights)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return nil
+		}
+	}
+}
+
+func (e *eurekaDiscovery) fetch(req *http.Request) ([]eurekaInstance, error) {
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("eureka returned %s", resp.Status)
+	}
+
+	var app struct {
+		Application struct {
+			Instance json.RawMessage `json:"instance"`
+		} `json:"application"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&app); err != nil {
+		return nil, err
+	}
+
+	// A single instance is not in a list
+	var instances []eurekaInstance
+	if err := json.Unmarshal(app.Application.Instance, &instances); err == nil {
+		return instances, nil
+	}
+	var instance eurekaInstance
+	if err := json.Unmarshal(app.Application.Instance, &instance); err != nil {
+		return nil, err
+	}
+	return []eurekaInstance{instance}, nil
+}
+
+// targets returns the URLs of the instances that are up, sorted as Eureka
+// does not keep their order.
+func (e *eurekaDiscovery) targets(instances []eurekaInstance) ([]string, []apidef.HostWeight) {
+	var hosts []string
+	weights := map[string]apidef.HostWeight{}
+	for _, instance := range instances {
+		if instance.Status != "UP" {
+			continue
+		}
+		host := instance.IPAddr
+		if e.conf.UseHostName {
+			host = instance.HostName
+		}
+		scheme, port := "http", instance.Port
+		if e.conf.UseSecurePort {
+			scheme, port = "https", instance.SecurePort
+		}
+		if port.Enabled == "false" {
+			continue
+		}
+
+		target := scheme + "://" + net.JoinHostPort(host, port.Port.String())
+		weight, _ := strconv.Atoi(instance.Metadata["weight"])
+		hosts = append(hosts, target)
+		weights[target] = apidef.HostWeight{Weight: weight}
+	}
+
+	sort.Strings(hosts)
+	ordered := make([]apidef.HostWeight, len(hosts))
+	for i, host := range hosts {
+		ordered[i] = weights[host]
+	}
+	return hosts, ordered
+}
@@ -0,0 +1,32 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+func TestEurekaDiscovery(t *testing.T) {
+	eureka := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/eureka/apps/ROUTE" || r.Header.Get("Accept") != "application/json" {
+			t.Errorf("Unexpected request %s", r.URL)
+		}
+		w.Write([]byte(eureka_real))
+	}))
+	defer eureka.Close()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	updates := watchTestDiscovery(newEurekaDiscovery(apidef.EurekaDiscoveryMeta{
+		Address: eureka.URL + "/eureka",
+		App:     "ROUTE",
+	}), stop)
+
+	want := []string{"http://172.31.13.37:50045", "http://172.31.57.136:60565"}
+	if got := <-updates; !reflect.DeepEqual(got.hosts, want) {
+		t.Errorf("Expected %v, got %v", want, got.hosts)
+	}
+}
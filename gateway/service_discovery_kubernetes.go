@@ -0,0 +1,306 @@
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+// The service account files of pods, to talk to the API server of their
+// cluster.
+const (
+	kubernetesTokenFile     = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	kubernetesCAFile        = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+	kubernetesNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// errKubernetesGone is the watch ending because the version it started from
+// is too old, for the endpoints to be listed again.
+var errKubernetesGone = errors.New("watched resource version is gone")
+
+// kubernetesDiscovery lists the endpoints of a service, then watches them for
+// changes.
+type kubernetesDiscovery struct {
+	conf   apidef.KubernetesDiscoveryMeta
+	client *http.Client
+	token  string
+}
+
+func newKubernetesDiscovery(conf apidef.KubernetesDiscoveryMeta) *kubernetesDiscovery {
+	k := &kubernetesDiscovery{conf: conf, client: &http.Client{}}
+	if k.conf.Scheme == "" {
+		k.conf.Scheme = "http"
+	}
+	if k.conf.Namespace == "" {
+		k.conf.Namespace = "default"
+		if ns, err := ioutil.ReadFile(kubernetesNamespaceFile); err == nil {
+			k.conf.Namespace = strings.TrimSpace(string(ns))
+		}
+	}
+	if k.conf.APIServer == "" {
+		// In cluster, authenticated as the service account of the pod
+		k.conf.APIServer = "https://" + net.JoinHostPort(os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT"))
+		k.token = kubernetesTokenFile
+		if ca, err := ioutil.ReadFile(kubernetesCAFile); err == nil {
+			pool := x509.NewCertPool()
+			pool.AppendCertsFromPEM(ca)
+			k.client.Transport = &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: pool},
+			}
+		}
+	}
+	return k
+}
+
+// resourceURL returns the URL of the endpoints of the service, to list or to
+// watch from version if set.
+func (k *kubernetesDiscovery) resourceURL(version string) string {
+	path := "/apis/discovery.k8s.io/v1/namespaces/" + k.conf.Namespace + "/endpointslices"
+	if k.conf.UseEndpoints {
+		path = "/api/v1/namespaces/" + k.conf.Namespace + "/endpoints"
+	}
+
+	query := url.Values{}
+	var selectors []string
+	if k.conf.Service != "" {
+		if k.conf.UseEndpoints {
+			query.Set("fieldSelector", "metadata.name="+k.conf.Service)
+		} else {
+			selectors = append(selectors, "kubernetes.io/service-name="+k.conf.Service)
+		}
+	}
+	if k.conf.LabelSelector != "" {
+		selectors = append(selectors, k.conf.LabelSelector)
+	}
+	if len(selectors) > 0 {
+		query.Set("labelSelector", strings.Join(selectors, ","))
+	}
+	if version != "" {
+		query.Set("watch", "1")
+		query.Set("resourceVersion", version)
+		query.Set("allowWatchBookmarks", "true")
+	}
+	return strings.TrimSuffix(k.conf.APIServer, "/") + path + "?" + query.Encode()
+}
+
+func (k *kubernetesDiscovery) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if k.token != "" {
+		// Tokens are rotated, so they are read every time
+		token, err := ioutil.ReadFile(k.token)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusGone {
+			return nil, errKubernetesGone
+		}
+		return nil, fmt.Errorf("kubernetes API server returned %s", resp.Status)
+	}
+	return resp, nil
+}
+
+// Watch lists the endpoints, then applies the changes to them as they are
+// watched, listing them again if the version watched from is gone.
+func (k *kubernetesDiscovery) Watch(update func([]string, []apidef.HostWeight), stop <-chan struct{}) error {
+	ctx, cancel := stopContext(stop)
+	defer cancel()
+
+	for {
+		objects, version, err := k.list(ctx)
+		if err != nil {
+			return err
+		}
+		update(k.targets(objects), nil)
+
+		for err == nil {
+			version, err = k.watch(ctx, version, objects, update)
+		}
+		if err != errKubernetesGone {
+			return err
+		}
+	}
+}
+
+// list returns the endpoints by name, and the version they are at.
+func (k *kubernetesDiscovery) list(ctx context.Context) (map[string]kubernetesEndpoints, string, error) {
+	resp, err := k.get(ctx, k.resourceURL(""))
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	var list struct {
+		Metadata struct {
+			ResourceVersion string `json:"resourceVersion"`
+		} `json:"metadata"`
+		Items []kubernetesEndpoints `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, "", err
+	}
+
+	objects := make(map[string]kubernetesEndpoints, len(list.Items))
+	for _, item := range list.Items {
+		objects[item.Metadata.Name] = item
+	}
+	return objects, list.Metadata.ResourceVersion, nil
+}
+
+// watch applies the events from version on to objects, returning the last
+// version seen when the API server ends the watch.
+func (k *kubernetesDiscovery) watch(ctx context.Context, version string, objects map[string]kubernetesEndpoints, update func([]string, []apidef.HostWeight)) (string, error) {
+	resp, err := k.get(ctx, k.resourceURL(version))
+	if err != nil {
+		return version, err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var event struct {
+			Type   string          `json:"type"`
+			Object json.RawMessage `json:"object"`
+		}
+		if err := dec.Decode(&event); err != nil {
+			if ctx.Err() != nil {
+				return version, ctx.Err()
+			}
+			// The API server times watches out, to be started again
+			return version, nil
+		}
+
+		if event.Type == "ERROR" {
+			var status struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			}
+			json.Unmarshal(event.Object, &status)
+			if status.Code == http.StatusGone {
+				return version, errKubernetesGone
+			}
+			return version, errors.New("kubernetes watch failed: " + status.Message)
+		}
+
+		var object kubernetesEndpoints
+		if err := json.Unmarshal(event.Object, &object); err != nil {
+			return version, err
+		}
+		version = object.Metadata.ResourceVersion
+
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			objects[object.Metadata.Name] = object
+		case "DELETED":
+			delete(objects, object.Metadata.Name)
+		default:
+			continue
+		}
+		update(k.targets(objects), nil)
+	}
+}
+
+// kubernetesEndpoints holds the fields of both EndpointSlices and Endpoints
+// that targets are made of.
+type kubernetesEndpoints struct {
+	Metadata struct {
+		Name            string `json:"name"`
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+
+	// EndpointSlice
+	Endpoints []struct {
+		Addresses  []string `json:"addresses"`
+		Conditions struct {
+			Ready *bool `json:"ready"`
+		} `json:"conditions"`
+	} `json:"endpoints"`
+	Ports []kubernetesPort `json:"ports"`
+
+	// Endpoints, listing only ready addresses in Addresses
+	Subsets []struct {
+		Addresses []struct {
+			IP string `json:"ip"`
+		} `json:"addresses"`
+		Ports []kubernetesPort `json:"ports"`
+	} `json:"subsets"`
+}
+
+type kubernetesPort struct {
+	Name string `json:"name"`
+	Port int    `json:"port"`
+}
+
+// port returns the port of the targets among ports, or 0 if it has none.
+func (k *kubernetesDiscovery) port(ports []kubernetesPort) int {
+	for _, port := range ports {
+		if k.conf.PortName == "" || port.Name == k.conf.PortName {
+			return port.Port
+		}
+	}
+	return 0
+}
+
+// targets returns the sorted URLs of the ready endpoints of objects, sorted
+// for the list not to change with the order of the events.
+func (k *kubernetesDiscovery) targets(objects map[string]kubernetesEndpoints) []string {
+	seen := map[string]bool{}
+	add := func(ip string, port int) {
+		if port == 0 {
+			return
+		}
+		seen[k.conf.Scheme+"://"+net.JoinHostPort(ip, strconv.Itoa(port))] = true
+	}
+
+	for _, object := range objects {
+		port := k.port(object.Ports)
+		for _, endpoint := range object.Endpoints {
+			// An unknown condition is to be taken as ready
+			if ready := endpoint.Conditions.Ready; ready != nil && !*ready {
+				continue
+			}
+			for _, address := range endpoint.Addresses {
+				add(address, port)
+			}
+		}
+
+		for _, subset := range object.Subsets {
+			port := k.port(subset.Ports)
+			for _, address := range subset.Addresses {
+				add(address.IP, port)
+			}
+		}
+	}
+
+	targets := make([]string, 0, len(seen))
+	for target := range seen {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	return targets
+}
@@ -0,0 +1,102 @@
+package gateway
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+const testEndpointSlice = `{
+	"metadata": {"name": "web-abc", "resourceVersion": "%s"},
+	"endpoints": [
+		{"addresses": ["%s"], "conditions": {"ready": true}},
+		{"addresses": ["10.0.0.9"], "conditions": {"ready": false}}
+	],
+	"ports": [{"name": "metrics", "port": 9090}, {"name": "http", "port": %s}]
+}`
+
+// testKubernetesAPIServer lists a slice with an endpoint at host, and sends
+// the events of watches.
+func testKubernetesAPIServer(t *testing.T, host string, events <-chan string) *httptest.Server {
+	ip, port, _ := net.SplitHostPort(host)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/discovery.k8s.io/v1/namespaces/shop/endpointslices" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		if got := r.URL.Query().Get("labelSelector"); got != "kubernetes.io/service-name=web,tier=front" {
+			t.Errorf("Unexpected label selector %q", got)
+		}
+		if r.URL.Query().Get("watch") == "" {
+			fmt.Fprintf(w, `{"metadata": {"resourceVersion": "1"}, "items": [`+testEndpointSlice+`]}`, "1", ip, port)
+			return
+		}
+		for {
+			select {
+			case event := <-events:
+				fmt.Fprintln(w, event)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}))
+}
+
+func TestKubernetesDiscovery(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("upstream"))
+	}))
+	defer upstream.Close()
+	u, _ := url.Parse(upstream.URL)
+
+	events := make(chan string)
+	apiServer := testKubernetesAPIServer(t, u.Host, events)
+	defer apiServer.Close()
+
+	spec := BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.ServiceDiscovery = apidef.ServiceDiscoveryConfiguration{
+			UseDiscoveryService: true,
+			Provider:            apidef.ServiceDiscoveryKubernetes,
+			Kubernetes: apidef.KubernetesDiscoveryMeta{
+				APIServer:     apiServer.URL,
+				Namespace:     "shop",
+				Service:       "web",
+				LabelSelector: "tier=front",
+				PortName:      "http",
+			},
+		}
+	})[0]
+	defer spec.ServiceWatcher.Stop()
+
+	waitForTargets := func(want string) {
+		for i := 0; i < 100; i++ {
+			if got := strings.Join(spec.ServiceWatcher.Targets().All(), " "); got == want {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("Expected targets %q, got %v", want, spec.ServiceWatcher.Targets().All())
+	}
+
+	t.Run("Listed", func(t *testing.T) {
+		waitForTargets(upstream.URL)
+		ts.Run(t, test.TestCase{Path: "/", Code: http.StatusOK, BodyMatch: "upstream"})
+	})
+
+	t.Run("Watched", func(t *testing.T) {
+		events <- `{"type": "MODIFIED", "object": ` + fmt.Sprintf(testEndpointSlice, "2", "10.0.0.8", "80") + `}`
+		waitForTargets("http://10.0.0.8:80")
+	})
+}
@@ -2,6 +2,8 @@ package gateway
 
 import (
 	"testing"
+
+	"github.com/TykTechnologies/tyk/apidef"
 )
 
 const consul = `
@@ -259,6 +261,32 @@ func TestServiceDiscovery_CONSUL(t *testing.T) {
 
 }
 
+func TestServiceDiscovery_Weights(t *testing.T) {
+	sd := ServiceDiscovery{}
+	configureService("consul", &sd)
+	sd.weightPath = "Weights.Passing"
+	sd.priorityPath = "Meta.priority"
+	rawData := `[
+	{"Address": "10.1.10.12", "ServicePort": 8000, "Weights": {"Passing": 3}, "Meta": {"priority": "1"}},
+	{"Address": "10.1.10.13", "ServicePort": 8000}
+]`
+	data, err := sd.ProcessRawData(rawData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hosts, weights := data.Weighted()
+	if len(hosts) != 2 {
+		t.Fatal("Expected 2 hosts, got", hosts)
+	}
+	if weights[0] != (apidef.HostWeight{Weight: 3, Priority: 1}) {
+		t.Error("Wrong weight of the first host:", weights[0])
+	}
+	if weights[1] != (apidef.HostWeight{Weight: 1}) {
+		t.Error("Expected the default weight of the second host, got", weights[1])
+	}
+}
+
 func TestServiceDiscovery_NESTED_CONSUL(t *testing.T) {
 	sd := ServiceDiscovery{}
 	rawData := configureService("nested_consul", &sd)
@@ -0,0 +1,133 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+// discoveryProvider watches a service registry for the targets of an API.
+type discoveryProvider interface {
+	// Watch calls update with the targets each time they change, until stop
+	// is closed. It returns when the watch fails, to be watched again.
+	Watch(update func([]string, []apidef.HostWeight), stop <-chan struct{}) error
+}
+
+// ServiceWatcher keeps the targets of an API as its provider pushes changes
+// to them, instead of polling the query endpoint.
+type ServiceWatcher struct {
+	apiID    string
+	provider discoveryProvider
+
+	mu    sync.RWMutex
+	hosts *apidef.HostList
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewServiceWatcher returns the watcher of the provider configured in conf.
+func NewServiceWatcher(apiID string, conf apidef.ServiceDiscoveryConfiguration) (*ServiceWatcher, error) {
+	var provider discoveryProvider
+	switch conf.Provider {
+	case apidef.ServiceDiscoveryKubernetes:
+		provider = newKubernetesDiscovery(conf.Kubernetes)
+	case apidef.ServiceDiscoveryConsul:
+		provider = newConsulDiscovery(conf.Consul)
+	case apidef.ServiceDiscoveryEureka:
+		provider = newEurekaDiscovery(conf.Eureka)
+	case apidef.ServiceDiscoveryDNSSRV:
+		provider = newDNSSRVDiscovery(conf.DNSSRV)
+	default:
+		return nil, errors.New("unknown service discovery provider " + conf.Provider)
+	}
+	return &ServiceWatcher{
+		apiID:    apiID,
+		provider: provider,
+		hosts:    apidef.NewHostList(),
+		stop:     make(chan struct{}),
+	}, nil
+}
+
+// Start watches the provider until stopped, watching again after failures
+// with a backoff of up to 30 seconds.
+func (w *ServiceWatcher) Start() {
+	go func() {
+		backoff := time.Second
+		for {
+			started := time.Now()
+			err := w.provider.Watch(w.update, w.stop)
+			select {
+			case <-w.stop:
+				return
+			default:
+			}
+
+			if time.Since(started) > 2*backoff {
+				backoff = time.Second
+			}
+			log.WithFields(logrus.Fields{
+				"prefix": "service-discovery",
+				"api_id": w.apiID,
+			}).WithError(err).Warning("Watch of service targets failed, retrying in ", backoff)
+
+			select {
+			case <-time.After(backoff):
+			case <-w.stop:
+				return
+			}
+			if backoff *= 2; backoff > 30*time.Second {
+				backoff = 30 * time.Second
+			}
+		}
+	}()
+}
+
+func (w *ServiceWatcher) Stop() {
+	w.stopOnce.Do(func() { close(w.stop) })
+}
+
+// Targets returns the last targets the provider found.
+func (w *ServiceWatcher) Targets() *apidef.HostList {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.hosts
+}
+
+// update swaps in a new list, so that those already handed out to requests
+// are not changed under them.
+func (w *ServiceWatcher) update(hosts []string, weights []apidef.HostWeight) {
+	if len(hosts) == 0 {
+		log.WithFields(logrus.Fields{
+			"prefix": "service-discovery",
+			"api_id": w.apiID,
+		}).Warning("Service discovery returned empty host list! Keeping last good set.")
+		return
+	}
+
+	hl := apidef.NewHostListFromList(hosts)
+	hl.SetWeights(weights)
+
+	w.mu.Lock()
+	w.hosts = hl
+	w.mu.Unlock()
+}
+
+// stopContext returns a context canceled when stop is closed, for requests
+// to the registry not to outlive the watch.
+func stopContext(stop <-chan struct{}) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
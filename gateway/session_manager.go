@@ -1,7 +1,10 @@
 package gateway
 
 import (
+	"math"
 	"net/http"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/TykTechnologies/leakybucket"
@@ -28,6 +31,9 @@ const (
 	RateLimitKeyPrefix = "rate-limit-"
 )
 
+// quotaPeriodLayout suffixes quota counters of calendar periods
+const quotaPeriodLayout = "2006-01"
+
 // SessionLimiter is the rate limiter for the API, use ForwardMessage() to
 // check if a message should pass through or not
 type SessionLimiter struct {
@@ -85,6 +91,60 @@ func (l *SessionLimiter) doRollingWindowWrite(key, rateLimiterKey, rateLimiterSe
 	return false
 }
 
+// burstPer is the period of burst limits of keys, in seconds.
+const burstPer = 1
+
+// slidingWindowFallback is set while keys are limited locally, for the
+// fallback to be logged once per Redis outage.
+var slidingWindowFallback int32
+
+// limitSlidingWindow counts the request in the Redis window of the key, which
+// is shared by all gateways, returning true if the key is over its limit or
+// its burst limit. While Redis is unreachable requests are limited by token
+// buckets of this gateway instead.
+func (l *SessionLimiter) limitSlidingWindow(key string, rate, per float64, burst int, store storage.Handler, dryRun bool) bool {
+	subPer := math.Min(burstPer, per)
+	_, allowed, err := store.SlidingWindow(key, per, int(rate), subPer, burst, dryRun)
+	if err == nil {
+		if atomic.CompareAndSwapInt32(&slidingWindowFallback, 1, 0) {
+			log.Info("[RATELIMIT] Sliding window available again, limiting in Redis")
+		}
+		return !allowed
+	}
+
+	if err == storage.ErrNotSupported {
+		log.Debug("[RATELIMIT] Sliding window not supported by storage, limiting locally")
+	} else if atomic.CompareAndSwapInt32(&slidingWindowFallback, 0, 1) {
+		log.WithError(err).Warning("[RATELIMIT] Sliding window unavailable, limiting locally on each gateway")
+	}
+	if burst > 0 && l.limitBucket(key+":burst", uint(burst), subPer, 1, dryRun) {
+		return true
+	}
+	return l.limitBucket(key, uint(rate), per, 1, dryRun)
+}
+
+// limitBucket takes cost tokens from the in-memory bucket of the key, which
+// holds rate tokens per period, returning true if the bucket is empty.
+func (l *SessionLimiter) limitBucket(key string, rate uint, per float64, cost uint, dryRun bool) bool {
+	if l.bucketStore == nil {
+		l.bucketStore = memorycache.New()
+	}
+
+	userBucket, err := l.bucketStore.Create(key, rate, time.Duration(per)*time.Second)
+	if err != nil {
+		log.Error("Failed to create bucket!")
+		return true
+	}
+
+	if dryRun {
+		// if userBucket is empty and not expired.
+		return userBucket.Remaining() == 0 && time.Now().Before(userBucket.Reset())
+	}
+
+	_, err = userBucket.Add(cost)
+	return err != nil
+}
+
 type sessionFailReason uint
 
 const (
@@ -128,21 +188,17 @@ func (l *SessionLimiter) ForwardMessage(r *http.Request, currentSession *user.Se
 			}
 		} else if globalConf.EnableRedisRollingLimiter {
 			rateLimiterKey := RateLimitKeyPrefix + currentSession.KeyHash()
-			rateLimiterSentinelKey := RateLimitKeyPrefix + currentSession.KeyHash() + ".BLOCKED"
+			rate, per, burst := currentSession.Rate, currentSession.Per, currentSession.Burst
 			if apiLimit != nil {
 				rateLimiterKey = RateLimitKeyPrefix + apiID + "-" + currentSession.KeyHash()
-				rateLimiterSentinelKey = RateLimitKeyPrefix + apiID + "-" + currentSession.KeyHash() + ".BLOCKED"
+				rate, per, burst = apiLimit.Rate, apiLimit.Per, apiLimit.Burst
 			}
 
-			if l.doRollingWindowWrite(key, rateLimiterKey, rateLimiterSentinelKey, currentSession, store, globalConf, apiLimit, dryRun) {
+			if l.limitSlidingWindow(rateLimiterKey, rate, per, burst, store, dryRun) {
 				return sessionFailRateLimit
 			}
 		} else {
 			// In-memory limiter
-			if l.bucketStore == nil {
-				l.bucketStore = memorycache.New()
-			}
-
 			// If a token has been updated, we must ensure we don't use
 			// an old bucket an let the cache deal with it
 			bucketKey := ""
@@ -164,23 +220,9 @@ func (l *SessionLimiter) ForwardMessage(r *http.Request, currentSession *user.Se
 				rate = uint(DRLManager.CurrentTokenValue)
 			}
 
-			userBucket, err := l.bucketStore.Create(bucketKey, rate, time.Duration(per)*time.Second)
-			if err != nil {
-				log.Error("Failed to create bucket!")
+			if l.limitBucket(bucketKey, rate, per, uint(DRLManager.CurrentTokenValue), dryRun) {
 				return sessionFailRateLimit
 			}
-
-			if dryRun {
-				// if userBucket is empty and not expired.
-				if userBucket.Remaining() == 0 && time.Now().Before(userBucket.Reset()) {
-					return sessionFailRateLimit
-				}
-			} else {
-				_, errF := userBucket.Add(uint(DRLManager.CurrentTokenValue))
-				if errF != nil {
-					return sessionFailRateLimit
-				}
-			}
 		}
 	}
 
@@ -239,6 +281,13 @@ func (l *SessionLimiter) RedisQuotaExceeded(r *http.Request, currentSession *use
 		quotaMax = apiLimit.QuotaMax
 	}
 
+	// Calendar periods are counted apart, and renew at the end of period
+	calendar := currentSession.QuotaRules.Reset == user.QuotaResetMonthly
+	if calendar {
+		period := currentQuotaPeriod(currentSession.QuotaRules, rawKey, quotaMax, currentSession.DateCreated, store, time.Now())
+		rawKey, quotaMax, quotaRenews, quotaRenewalRate = period.key, period.max, period.renews, period.ttl
+	}
+
 	log.Debug("[QUOTA] Quota limiter key is: ", rawKey)
 	log.Debug("Renewing with TTL: ", quotaRenewalRate)
 	// INCR the key (If it equals 1 - set EXPIRE)
@@ -266,11 +315,14 @@ func (l *SessionLimiter) RedisQuotaExceeded(r *http.Request, currentSession *use
 
 	// If this is a new Quota period, ensure we let the end user know
 	if qInt == 1 {
-		current := time.Now().Unix()
+		renews := time.Now().Unix() + quotaRenewalRate
+		if calendar {
+			renews = quotaRenews
+		}
 		if apiLimit == nil {
-			currentSession.QuotaRenews = current + quotaRenewalRate
+			currentSession.QuotaRenews = renews
 		} else {
-			apiLimit.QuotaRenews = current + quotaRenewalRate
+			apiLimit.QuotaRenews = renews
 		}
 		ctxScheduleSessionUpdate(r)
 	}
@@ -289,3 +341,94 @@ func (l *SessionLimiter) RedisQuotaExceeded(r *http.Request, currentSession *use
 
 	return false
 }
+
+// quotaPeriod is the quota of a calendar period. Its counter expires at the
+// end of the next period, so that unused quota can be carried over.
+type quotaPeriod struct {
+	key    string
+	max    int64
+	renews int64
+	ttl    int64
+}
+
+// currentQuotaPeriod returns quota of the month now is in, for the counter
+// rawKey of quota quotaMax of a key created at created.
+func currentQuotaPeriod(rules user.QuotaRules, rawKey string, quotaMax int64, created time.Time, store storage.Handler, now time.Time) quotaPeriod {
+	now = now.UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+	prevStart := start.AddDate(0, -1, 0)
+
+	period := quotaPeriod{
+		key:    rawKey + "-" + start.Format(quotaPeriodLayout),
+		max:    quotaMax,
+		renews: end.Unix(),
+		ttl:    int64(end.AddDate(0, 1, 0).Sub(now) / time.Second),
+	}
+	if rules.Prorate {
+		period.max = proratedQuota(quotaMax, created, start, end)
+	}
+
+	if rules.CarryOver && created.Before(start) {
+		prevMax := quotaMax
+		if rules.Prorate {
+			prevMax = proratedQuota(quotaMax, created, prevStart, start)
+		}
+
+		var prevUsed int64
+		if used, err := store.GetRawKey(rawKey + "-" + prevStart.Format(quotaPeriodLayout)); err == nil {
+			prevUsed, _ = strconv.ParseInt(used, 10, 64)
+		}
+
+		if unused := prevMax - prevUsed; unused > quotaMax {
+			period.max += quotaMax
+		} else if unused > 0 {
+			period.max += unused
+		}
+	}
+
+	return period
+}
+
+// setPeriodQuotas reports remaining quotas and renewal of the current period
+// in the session, for the key and its limits per API.
+func setPeriodQuotas(session *user.SessionState, keyHash string, store storage.Handler) {
+	remaining := func(rawKey string, quotaMax int64) (int64, int64) {
+		period := currentQuotaPeriod(session.QuotaRules, rawKey, quotaMax, session.DateCreated, store, time.Now())
+
+		var used int64
+		if v, err := store.GetRawKey(period.key); err == nil {
+			used, _ = strconv.ParseInt(v, 10, 64)
+		}
+		if used > period.max {
+			used = period.max
+		}
+		return period.max - used, period.renews
+	}
+
+	if session.QuotaMax != -1 {
+		session.QuotaRemaining, session.QuotaRenews = remaining(QuotaKeyPrefix+keyHash, session.QuotaMax)
+	}
+
+	for id, access := range session.AccessRights {
+		if access.Limit == nil || access.Limit.QuotaMax == -1 {
+			continue
+		}
+
+		access.Limit.QuotaRemaining, access.Limit.QuotaRenews = remaining(QuotaKeyPrefix+id+"-"+keyHash, access.Limit.QuotaMax)
+		session.AccessRights[id] = access
+	}
+}
+
+// proratedQuota returns part of quota for the part of period from start to
+// end the key existed for.
+func proratedQuota(quota int64, created, start, end time.Time) int64 {
+	if !created.After(start) {
+		return quota
+	}
+	if !created.Before(end) {
+		return 0
+	}
+
+	return int64(math.Ceil(float64(quota) * float64(end.Sub(created)) / float64(end.Sub(start))))
+}
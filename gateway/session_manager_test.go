@@ -0,0 +1,155 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/storage"
+	"github.com/TykTechnologies/tyk/test"
+	"github.com/TykTechnologies/tyk/user"
+)
+
+// unreachableStore fails as Redis does when it can't be reached.
+type unreachableStore struct {
+	storage.Handler
+}
+
+func (unreachableStore) SlidingWindow(string, float64, int, float64, int, bool) (int, bool, error) {
+	return 0, false, errors.New("Redis connection failed")
+}
+
+func TestSlidingWindowLimiter(t *testing.T) {
+	globalConf := config.Global()
+	globalConf.EnableRedisRollingLimiter = true
+
+	session := &user.SessionState{Rate: 3, Per: 60, Burst: 2}
+	session.SetKeyHash(uuid.NewV4().String())
+
+	r := httptest.NewRequest("GET", "/", nil)
+	store := &storage.RedisCluster{KeyPrefix: "apikey-"}
+
+	// Gateways share windows of keys
+	gw1, gw2 := &SessionLimiter{}, &SessionLimiter{}
+	forward := func(l *SessionLimiter, store storage.Handler, dryRun bool) sessionFailReason {
+		return l.ForwardMessage(r, session, "key", store, true, false, &globalConf, "", dryRun)
+	}
+
+	for i, l := range []*SessionLimiter{gw1, gw2} {
+		if reason := forward(l, store, false); reason != sessionFailNone {
+			t.Fatalf("Request %d within rate and burst should pass: %v", i+1, reason)
+		}
+	}
+	if reason := forward(gw1, store, true); reason != sessionFailRateLimit {
+		t.Error("Dry run should report the key over its burst limit", reason)
+	}
+	if reason := forward(gw1, store, false); reason != sessionFailRateLimit {
+		t.Error("Request over burst should be limited", reason)
+	}
+
+	time.Sleep(burstPer*time.Second + 100*time.Millisecond)
+	if reason := forward(gw2, store, false); reason != sessionFailNone {
+		t.Error("Request within rate after the burst should pass", reason)
+	}
+	if reason := forward(gw1, store, false); reason != sessionFailRateLimit {
+		t.Error("Request over rate should be limited", reason)
+	}
+
+	t.Run("Redis unreachable", func(t *testing.T) {
+		session := &user.SessionState{Rate: 2, Per: 60}
+		session.SetKeyHash(uuid.NewV4().String())
+		store := unreachableStore{}
+		forward := func(l *SessionLimiter) sessionFailReason {
+			return l.ForwardMessage(r, session, "key", store, true, false, &globalConf, "", false)
+		}
+
+		for i := 0; i < 2; i++ {
+			if reason := forward(gw1); reason != sessionFailNone {
+				t.Fatalf("Request %d should be limited locally and pass: %v", i+1, reason)
+			}
+		}
+		if reason := forward(gw1); reason != sessionFailRateLimit {
+			t.Error("Local bucket should limit the key", reason)
+		}
+
+		session.Burst = 1
+		session.SetKeyHash(uuid.NewV4().String())
+		if reason := forward(gw1); reason != sessionFailNone {
+			t.Fatal("Request within burst should pass", reason)
+		}
+		if reason := forward(gw1); reason != sessionFailRateLimit {
+			t.Error("Local bucket should limit bursts of the key", reason)
+		}
+	})
+}
+
+func TestQuotaRules(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	spec := BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "quota-rules"
+		spec.UseKeylessAccess = false
+		spec.Proxy.ListenPath = "/"
+	})[0]
+
+	now := time.Now().UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	prevPeriod := start.AddDate(0, -1, 0).Format(quotaPeriodLayout)
+
+	key := CreateSession(func(s *user.SessionState) {
+		s.DateCreated = start.AddDate(0, -2, 0)
+		s.QuotaMax = 3
+		s.QuotaRules = user.QuotaRules{Reset: user.QuotaResetMonthly, CarryOver: true}
+		s.AccessRights = map[string]user.AccessDefinition{spec.APIID: {APIID: spec.APIID}}
+	})
+	authHeaders := map[string]string{"Authorization": key}
+
+	// 2 requests of the previous period were left unused
+	store := &storage.RedisCluster{KeyPrefix: "apikey-"}
+	store.SetRawKey(QuotaKeyPrefix+storage.HashKey(key)+"-"+prevPeriod, "1", 60)
+
+	ts.Run(t, []test.TestCase{
+		{Path: "/", Headers: authHeaders, Code: 200},
+		{Path: "/", Headers: authHeaders, Code: 200},
+		{Path: "/", Headers: authHeaders, Code: 200},
+		{Path: "/", Headers: authHeaders, Code: 200},
+		{Path: "/", Headers: authHeaders, Code: 200},
+		{Path: "/", Headers: authHeaders, Code: 403},
+		{Path: "/tyk/keys/" + key, AdminAuth: true, Code: 200,
+			BodyMatch: fmt.Sprintf(`"quota_renews":%d,"quota_remaining":0`, start.AddDate(0, 1, 0).Unix())},
+		{Method: "POST", Path: "/tyk/keys/create", AdminAuth: true, Code: 400,
+			Data: `{"quota_rules":{"reset":"weekly"},"access_rights":{"quota-rules":{"api_id":"quota-rules"}}}`},
+	}...)
+}
+
+func TestCurrentQuotaPeriod(t *testing.T) {
+	now := time.Date(2026, time.October, 16, 12, 0, 0, 0, time.UTC)
+	rules := user.QuotaRules{Reset: user.QuotaResetMonthly, Prorate: true}
+
+	for _, tc := range []struct {
+		created  time.Time
+		expected int64
+	}{
+		{time.Time{}, 310},
+		{time.Date(2026, time.September, 20, 0, 0, 0, 0, time.UTC), 310},
+		// 16 of 31 days left
+		{time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC), 160},
+	} {
+		period := currentQuotaPeriod(rules, "quota-key", 310, tc.created, nil, now)
+		if period.max != tc.expected {
+			t.Errorf("Key created at %v should have quota %d, got %d", tc.created, tc.expected, period.max)
+		}
+		if period.key != "quota-key-2026-10" {
+			t.Error("Counter should be of the month", period.key)
+		}
+		if period.renews != time.Date(2026, time.November, 1, 0, 0, 0, 0, time.UTC).Unix() {
+			t.Error("Quota should renew on the 1st", time.Unix(period.renews, 0))
+		}
+	}
+}
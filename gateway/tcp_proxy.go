@@ -0,0 +1,139 @@
+package gateway
+
+import (
+	"crypto/tls"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/tcp"
+)
+
+// tcpListener serves layer 4 APIs of a port. Listeners are kept over
+// reloads, only their routes are replaced.
+type tcpListener struct {
+	listener net.Listener
+	proxy    *tcp.Proxy
+	tls      bool
+}
+
+var (
+	tcpListenersMu sync.Mutex
+	tcpListeners   = map[int]*tcpListener{}
+)
+
+func isTCPSpec(spec *APISpec) bool {
+	return spec.Protocol == apidef.ProtocolTCP || spec.Protocol == apidef.ProtocolTLS
+}
+
+// loadTCPServices listens on ports of layer 4 APIs and routes connections to
+// their upstreams. Listeners of ports no longer used are closed.
+func loadTCPServices(specs []*APISpec) {
+	proxies := map[int]*tcp.Proxy{}
+	useTLS := map[int]bool{}
+
+	for _, spec := range specs {
+		if !isTCPSpec(spec) {
+			continue
+		}
+
+		port := spec.ListenPort
+		isTLS := spec.Protocol == apidef.ProtocolTLS
+		logger := mainLog.WithFields(logrus.Fields{
+			"api_id": spec.APIID,
+			"port":   port,
+		})
+
+		if port == config.Global().ListenPort || port == config.Global().ControlAPIPort {
+			logger.Error("Layer 4 API can't listen on port of HTTP APIs")
+			continue
+		}
+
+		p := proxies[port]
+		if p == nil {
+			p = &tcp.Proxy{}
+			proxies[port] = p
+			useTLS[port] = isTLS
+		} else if useTLS[port] != isTLS {
+			logger.Error("Port is already used by API of other protocol")
+			continue
+		}
+
+		if err := p.AddDomainHandler(spec.Domain, spec.Proxy.TargetURL, tcpUpstreamTLSConfig(spec)); err != nil {
+			logger.Error("Can't load layer 4 API: ", err)
+			continue
+		}
+
+		logger.WithField("domain", spec.Domain).Info("Proxying ", spec.Protocol, " connections to ", spec.Proxy.TargetURL)
+	}
+
+	tcpListenersMu.Lock()
+	defer tcpListenersMu.Unlock()
+
+	for port, l := range tcpListeners {
+		if p, ok := proxies[port]; ok && useTLS[port] == l.tls {
+			l.proxy.Swap(p)
+			delete(proxies, port)
+			continue
+		}
+
+		mainLog.WithField("port", port).Info("Closing listener of layer 4 APIs")
+		l.listener.Close()
+		delete(tcpListeners, port)
+	}
+
+	for port, p := range proxies {
+		listener, err := generateTCPListener(port, useTLS[port])
+		if err != nil {
+			mainLog.WithField("port", port).Error("Can't listen for layer 4 APIs: ", err)
+			continue
+		}
+
+		tcpListeners[port] = &tcpListener{listener: listener, proxy: p, tls: useTLS[port]}
+		go p.Serve(listener)
+	}
+}
+
+// generateTCPListener listens for layer 4 APIs. TLS listeners serve
+// certificates and verify client certificates as HTTPS listeners do.
+func generateTCPListener(port int, useTLS bool) (net.Listener, error) {
+	addr := config.Global().ListenAddress + ":" + strconv.Itoa(port)
+	if !useTLS {
+		return net.Listen("tcp", addr)
+	}
+
+	httpServerOptions := config.Global().HttpServerOptions
+	tlsConfig := tls.Config{
+		GetCertificate:   dummyGetCertificate,
+		MinVersion:       httpServerOptions.MinVersion,
+		MaxVersion:       httpServerOptions.MaxVersion,
+		CurvePreferences: getCurves(httpServerOptions.Curves),
+		CipherSuites:     getCipherAliases(httpServerOptions.Ciphers),
+	}
+	tlsConfig.GetConfigForClient = getTLSConfigForClient(&tlsConfig, port)
+
+	return tls.Listen("tcp", addr, &tlsConfig)
+}
+
+// tcpUpstreamTLSConfig returns config for tls:// upstreams of the API.
+func tcpUpstreamTLSConfig(spec *APISpec) *tls.Config {
+	u, err := url.Parse(spec.Proxy.TargetURL)
+	if err != nil || u.Scheme != apidef.ProtocolTLS {
+		return nil
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify:   config.Global().ProxySSLInsecureSkipVerify || spec.Proxy.Transport.SSLInsecureSkipVerify,
+		GetClientCertificate: upstreamClientCertificate(spec, u.Hostname()),
+	}
+	if spec.Proxy.Transport.SSLMinVersion > 0 {
+		tlsConfig.MinVersion = spec.Proxy.Transport.SSLMinVersion
+	}
+
+	return tlsConfig
+}
@@ -0,0 +1,164 @@
+package gateway
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+// startTCPEcho starts upstream which replies to every line with the line.
+func startTCPEcho(t *testing.T) (string, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					conn.Write([]byte("echo: " + line))
+				}
+			}()
+		}
+	}()
+
+	return l.Addr().String(), func() { l.Close() }
+}
+
+func freeTCPPort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func tcpRoundTrip(conn net.Conn, msg string) string {
+	conn.SetDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Write([]byte(msg + "\n")); err != nil {
+		return ""
+	}
+
+	reply, _ := bufio.NewReader(conn).ReadString('\n')
+	return reply
+}
+
+func TestTCPProxy(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+	defer loadTCPServices(nil)
+
+	upstream, stop := startTCPEcho(t)
+	defer stop()
+
+	port := freeTCPPort(t)
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Protocol = apidef.ProtocolTCP
+		spec.ListenPort = port
+		spec.Proxy.TargetURL = "tcp://" + upstream
+	})
+
+	conn, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if reply := tcpRoundTrip(conn, "ping"); reply != "echo: ping\n" {
+		t.Error("Connection should be proxied", reply)
+	}
+
+	// Listener is closed once no API uses the port
+	BuildAndLoadAPI()
+	if _, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(port)); err == nil {
+		t.Error("Listener should be closed")
+	}
+}
+
+func TestTLSProxy(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+	defer loadTCPServices(nil)
+
+	upstream, stop := startTCPEcho(t)
+	defer stop()
+
+	_, _, combinedPEM, _ := genServerCertificate()
+	serverCertID, _ := CertificateManager.Add(combinedPEM, "")
+	defer CertificateManager.Delete(serverCertID)
+
+	clientCertPem, _, _, clientCert := genCertificate(&x509.Certificate{})
+	clientCertID, _ := CertificateManager.Add(clientCertPem, "")
+	defer CertificateManager.Delete(clientCertID)
+
+	port := freeTCPPort(t)
+	addr := "127.0.0.1:" + strconv.Itoa(port)
+	load := func(mutualTLS bool) {
+		BuildAndLoadAPI(func(spec *APISpec) {
+			spec.Protocol = apidef.ProtocolTLS
+			spec.ListenPort = port
+			spec.Proxy.TargetURL = "tcp://" + upstream
+			spec.Certificates = []string{serverCertID}
+			spec.UseMutualTLSAuth = mutualTLS
+			spec.ClientCertificates = []string{clientCertID}
+		})
+	}
+
+	t.Run("Terminate TLS", func(t *testing.T) {
+		load(false)
+
+		conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		if reply := tcpRoundTrip(conn, "ping"); reply != "echo: ping\n" {
+			t.Error("Connection should be proxied", reply)
+		}
+	})
+
+	t.Run("Mutual TLS", func(t *testing.T) {
+		load(true)
+
+		conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+		if err == nil {
+			if reply := tcpRoundTrip(conn, "ping"); reply != "" {
+				t.Error("Connection without client certificate should be rejected", reply)
+			}
+			conn.Close()
+		}
+
+		conn, err = tls.Dial("tcp", addr, &tls.Config{
+			Certificates:       []tls.Certificate{clientCert},
+			InsecureSkipVerify: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		if reply := tcpRoundTrip(conn, "ping"); reply != "echo: ping\n" {
+			t.Error("Connection with client certificate should be proxied", reply)
+		}
+	})
+}
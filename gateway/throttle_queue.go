@@ -0,0 +1,70 @@
+package gateway
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+var requestQueue = throttleQueue{queued: make(map[string]int)}
+
+// throttleQueue holds requests over their rate limit until the limit lets
+// them through, so that spikes are spread over time instead of rejected.
+type throttleQueue struct {
+	mu     sync.Mutex
+	queued map[string]int
+}
+
+// queueInterval returns the time the limit of rate requests per period
+// takes to let one more request through.
+func queueInterval(rate, per float64) time.Duration {
+	interval := time.Duration(per / rate * float64(time.Second))
+	if interval < time.Millisecond {
+		return time.Millisecond
+	}
+	return interval
+}
+
+// wait queues the request under key and calls retry every interval until it
+// reports the request went through. It gives up if size requests are queued
+// already, after maxWait or when the client goes away. A zero maxWait waits
+// for as long as the client does.
+func (q *throttleQueue) wait(r *http.Request, key string, size int, maxWait, interval time.Duration, retry func() bool) bool {
+	q.mu.Lock()
+	if q.queued[key] >= size {
+		q.mu.Unlock()
+		return false
+	}
+	q.queued[key]++
+	q.mu.Unlock()
+
+	defer func() {
+		q.mu.Lock()
+		if q.queued[key]--; q.queued[key] == 0 {
+			delete(q.queued, key)
+		}
+		q.mu.Unlock()
+	}()
+
+	var deadline <-chan time.Time
+	if maxWait > 0 {
+		timer := time.NewTimer(maxWait)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if retry() {
+				return true
+			}
+		case <-deadline:
+			return false
+		case <-r.Context().Done():
+			return false
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package gateway
+
+import (
+	"crypto/tls"
+	"net"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+)
+
+var curveIDs = map[string]tls.CurveID{
+	"X25519": tls.X25519,
+	"P-256":  tls.CurveP256,
+	"P-384":  tls.CurveP384,
+	"P-521":  tls.CurveP521,
+}
+
+// getCurves returns IDs of the named curves in the same order, skipping
+// unknown names.
+func getCurves(names []string) (curves []tls.CurveID) {
+	for _, name := range names {
+		if id, ok := curveIDs[name]; ok {
+			curves = append(curves, id)
+		} else {
+			log.Warning("Unknown TLS curve: ", name)
+		}
+	}
+
+	return curves
+}
+
+// applyTLSPolicy overrides parameters of the TLS config set by the policy.
+func applyTLSPolicy(tlsConfig *tls.Config, policy apidef.TLSPolicyMeta) {
+	if policy.MinVersion > 0 {
+		tlsConfig.MinVersion = policy.MinVersion
+	}
+	if policy.MaxVersion > 0 {
+		tlsConfig.MaxVersion = policy.MaxVersion
+	}
+	if len(policy.Ciphers) > 0 {
+		tlsConfig.CipherSuites = getCipherAliases(policy.Ciphers)
+	}
+	if len(policy.Curves) > 0 {
+		tlsConfig.CurvePreferences = getCurves(policy.Curves)
+	}
+	if len(policy.ALPNProtocols) > 0 {
+		tlsConfig.NextProtos = policy.ALPNProtocols
+	}
+}
+
+// portTLSPolicy returns TLS policy configured for the port the client
+// connected to, falling back to the listen port.
+func portTLSPolicy(hello *tls.ClientHelloInfo, listenPort int) (apidef.TLSPolicyMeta, bool) {
+	if hello.Conn != nil {
+		if addr, ok := hello.Conn.LocalAddr().(*net.TCPAddr); ok {
+			listenPort = addr.Port
+		}
+	}
+
+	for _, policy := range config.Global().HttpServerOptions.TLSPolicies {
+		if policy.Port == listenPort {
+			return policy.TLSPolicyMeta, true
+		}
+	}
+
+	return apidef.TLSPolicyMeta{}, false
+}
@@ -0,0 +1,229 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+// transformOperation is a compiled step of a declarative JSON transform.
+type transformOperation struct {
+	apidef.TransformOperation
+	path, from []string
+	ifPath     []string
+}
+
+// transformOperations transform JSON bodies without templates, by adding,
+// copying, moving, renaming and removing their values. Paths of conditions
+// and copies may also point into the context variables and the session
+// metadata, under _tyk_context and _tyk_meta as in templates.
+type transformOperations []transformOperation
+
+func splitTransformPath(path string) []string {
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, ".")
+}
+
+func compileTransformOperations(ops []apidef.TransformOperation) (transformOperations, error) {
+	if len(ops) == 0 {
+		return nil, errors.New("no operations defined")
+	}
+
+	compiled := make(transformOperations, len(ops))
+	for i, op := range ops {
+		switch op.Op {
+		case "add", "copy", "move", "rename", "remove":
+		default:
+			return nil, errors.New("unknown transform operation " + strconv.Quote(op.Op))
+		}
+
+		compiled[i] = transformOperation{
+			TransformOperation: op,
+			path:               splitTransformPath(op.Path),
+			from:               splitTransformPath(op.From),
+		}
+		if op.If != nil {
+			compiled[i].ifPath = splitTransformPath(op.If.Path)
+		}
+	}
+	return compiled, nil
+}
+
+// transformJSON applies the operations to a JSON body. Empty bodies are
+// transformed as empty objects.
+func (ops transformOperations) transformJSON(body []byte, r *http.Request, contextVars, enableSession bool) ([]byte, error) {
+	if len(body) == 0 {
+		body = []byte("{}")
+	}
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(ops.apply(data, transformMeta(r, contextVars, enableSession)))
+}
+
+// transformMeta is the request data operations can refer to besides the
+// body.
+func transformMeta(r *http.Request, contextVars, enableSession bool) map[string]interface{} {
+	meta := make(map[string]interface{})
+	if contextVars {
+		meta["_tyk_context"] = ctxGetData(r)
+	}
+	if enableSession {
+		if session := ctxGetSession(r); session != nil {
+			meta["_tyk_meta"] = session.MetaData
+		}
+	}
+	return meta
+}
+
+// apply runs the operations on a decoded JSON value in order, returning the
+// transformed value.
+func (ops transformOperations) apply(data interface{}, meta map[string]interface{}) interface{} {
+	lookup := func(path []string) (interface{}, bool) {
+		if len(path) > 0 {
+			if root, ok := meta[path[0]]; ok {
+				return getTransformPath(root, path[1:])
+			}
+		}
+		return getTransformPath(data, path)
+	}
+
+	for _, op := range ops {
+		if op.If != nil {
+			value, found := lookup(op.ifPath)
+			if op.If.Exists != nil && found != *op.If.Exists {
+				continue
+			}
+			if op.If.Equals != nil && (!found || !reflect.DeepEqual(value, op.If.Equals)) {
+				continue
+			}
+		}
+
+		switch op.Op {
+		case "add":
+			data = setTransformPath(data, op.path, copyJSONValue(op.Value))
+		case "copy", "move":
+			value, found := lookup(op.from)
+			if !found {
+				continue
+			}
+			if op.Op == "move" {
+				data = removeTransformPath(data, op.from)
+			} else {
+				value = copyJSONValue(value)
+			}
+			data = setTransformPath(data, op.path, value)
+		case "rename":
+			value, found := getTransformPath(data, op.path)
+			if !found || len(op.path) == 0 {
+				continue
+			}
+			data = removeTransformPath(data, op.path)
+			renamed := append(append([]string{}, op.path[:len(op.path)-1]...), op.To)
+			data = setTransformPath(data, renamed, value)
+		case "remove":
+			data = removeTransformPath(data, op.path)
+		}
+	}
+	return data
+}
+
+// copyJSONValue deeply copies a decoded JSON value, so that values set by
+// operations aren't shared.
+func copyJSONValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		obj := make(map[string]interface{}, len(value))
+		for k, v := range value {
+			obj[k] = copyJSONValue(v)
+		}
+		return obj
+	case []interface{}:
+		list := make([]interface{}, len(value))
+		for i, v := range value {
+			list[i] = copyJSONValue(v)
+		}
+		return list
+	}
+	return value
+}
+
+func getTransformPath(data interface{}, path []string) (interface{}, bool) {
+	for _, segment := range path {
+		switch node := data.(type) {
+		case map[string]interface{}:
+			value, ok := node[segment]
+			if !ok {
+				return nil, false
+			}
+			data = value
+		case []interface{}:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			data = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return data, true
+}
+
+// setTransformPath sets the value at path, adding the objects missing on the
+// way. Values on the way which are neither objects nor arrays are kept.
+func setTransformPath(data interface{}, path []string, value interface{}) interface{} {
+	if len(path) == 0 {
+		return value
+	}
+
+	switch node := data.(type) {
+	case map[string]interface{}:
+		node[path[0]] = setTransformPath(node[path[0]], path[1:], value)
+		return node
+	case []interface{}:
+		if i, err := strconv.Atoi(path[0]); err == nil && i >= 0 && i < len(node) {
+			node[i] = setTransformPath(node[i], path[1:], value)
+		}
+		return node
+	case nil:
+		return map[string]interface{}{path[0]: setTransformPath(nil, path[1:], value)}
+	}
+	return data
+}
+
+func removeTransformPath(data interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		return data
+	}
+
+	switch node := data.(type) {
+	case map[string]interface{}:
+		if len(path) == 1 {
+			delete(node, path[0])
+		} else if child, ok := node[path[0]]; ok {
+			node[path[0]] = removeTransformPath(child, path[1:])
+		}
+		return node
+	case []interface{}:
+		i, err := strconv.Atoi(path[0])
+		if err != nil || i < 0 || i >= len(node) {
+			return node
+		}
+		if len(path) == 1 {
+			return append(node[:i:i], node[i+1:]...)
+		}
+		node[i] = removeTransformPath(node[i], path[1:])
+		return node
+	}
+	return data
+}
@@ -0,0 +1,85 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestTransformOperations(t *testing.T) {
+	yes, no := true, false
+	ops, err := compileTransformOperations([]apidef.TransformOperation{
+		{Op: "add", Path: "meta.source", Value: "gateway"},
+		{Op: "rename", Path: "user.fullName", To: "name"},
+		{Op: "move", From: "user.email", Path: "contact.email"},
+		{Op: "copy", From: "_tyk_context.request_id", Path: "meta.request_id"},
+		{Op: "remove", Path: "user.password"},
+		{Op: "remove", Path: "items.0"},
+		{Op: "add", Path: "vip", Value: true, If: &apidef.TransformCondition{Path: "user.tier", Equals: "gold"}},
+		{Op: "add", Path: "guest", Value: true, If: &apidef.TransformCondition{Path: "user.tier", Equals: "silver"}},
+		{Op: "add", Path: "phone", Value: "unknown", If: &apidef.TransformCondition{Path: "contact.phone", Exists: &no}},
+		{Op: "remove", Path: "contact.fax", If: &apidef.TransformCondition{Path: "contact.fax", Exists: &yes}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var data interface{}
+	json.Unmarshal([]byte(`{
+		"user": {"fullName": "Jane", "email": "jane@example.com", "password": "secret", "tier": "gold"},
+		"items": [1, 2, 3]
+	}`), &data)
+	got := ops.apply(data, map[string]interface{}{"_tyk_context": map[string]interface{}{"request_id": "abc"}})
+
+	var want interface{}
+	json.Unmarshal([]byte(`{
+		"user": {"name": "Jane", "tier": "gold"},
+		"contact": {"email": "jane@example.com"},
+		"items": [2, 3],
+		"meta": {"source": "gateway", "request_id": "abc"},
+		"vip": true,
+		"phone": "unknown"
+	}`), &want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	if _, err := compileTransformOperations([]apidef.TransformOperation{{Op: "replace", Path: "a"}}); err == nil {
+		t.Error("Unknown operations should be rejected")
+	}
+}
+
+func TestTransformOperationsMiddleware(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	ops := apidef.TemplateData{
+		Mode:       apidef.UseOperations,
+		Operations: []apidef.TransformOperation{{Op: "rename", Path: "Method", To: "method"}, {Op: "add", Path: "transformed", Value: true}},
+	}
+	BuildAndLoadAPI(func(spec *APISpec) {
+		spec.Proxy.ListenPath = "/"
+		spec.ResponseProcessors = []apidef.ResponseProcessor{{Name: "response_body_transform"}}
+		UpdateAPIVersion(spec, "v1", func(v *apidef.VersionInfo) {
+			v.ExtendedPaths.Transform = []apidef.TemplateMeta{{
+				Path:   "/request",
+				Method: http.MethodPost,
+				TemplateData: apidef.TemplateData{
+					Mode:       apidef.UseOperations,
+					Operations: []apidef.TransformOperation{{Op: "move", From: "a", Path: "b.c"}},
+				},
+			}}
+			v.ExtendedPaths.TransformResponse = []apidef.TemplateMeta{{Path: "/response", Method: http.MethodGet, TemplateData: ops}}
+		})
+	})
+
+	ts.Run(t, []test.TestCase{
+		{Method: http.MethodPost, Path: "/request", Data: `{"a":1}`, Code: http.StatusOK, BodyMatch: `"Body":"{\"b\":{\"c\":1}}"`},
+		{Path: "/response", Code: http.StatusOK, BodyMatch: `"method":"GET"`},
+		{Path: "/response", Code: http.StatusOK, BodyMatch: `"transformed":true`},
+	}...)
+}
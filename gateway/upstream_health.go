@@ -0,0 +1,301 @@
+package gateway
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+
+	"github.com/TykTechnologies/tyk/apidef"
+)
+
+// TargetHealth is the state of a load balanced target, as the health checks
+// of its API probe it.
+type TargetHealth struct {
+	Target    string    `json:"target"`
+	Healthy   bool      `json:"healthy"`
+	Successes int       `json:"consecutive_successes"`
+	Failures  int       `json:"consecutive_failures"`
+	LastCheck time.Time `json:"last_check"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// UpstreamHealthChecker probes the load balanced targets of an API, for its
+// balancers to skip those that are unhealthy. Targets are healthy until
+// probed otherwise.
+type UpstreamHealthChecker struct {
+	spec   *APISpec
+	conf   apidef.UpstreamHealthCheckMeta
+	client *http.Client
+
+	mu      sync.RWMutex
+	targets map[string]*TargetHealth
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewUpstreamHealthChecker(spec *APISpec, conf apidef.UpstreamHealthCheckMeta) *UpstreamHealthChecker {
+	if conf.Interval <= 0 {
+		conf.Interval = 10
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = 5
+	}
+	if conf.HealthyThreshold <= 0 {
+		conf.HealthyThreshold = 2
+	}
+	if conf.UnhealthyThreshold <= 0 {
+		conf.UnhealthyThreshold = 3
+	}
+	return &UpstreamHealthChecker{
+		spec: spec,
+		conf: conf,
+		client: &http.Client{
+			Timeout: time.Duration(conf.Timeout) * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: spec.Proxy.Transport.SSLInsecureSkipVerify,
+				},
+			},
+			// The target answering is what matters, not where it sends to
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		targets: make(map[string]*TargetHealth),
+		stop:    make(chan struct{}),
+	}
+}
+
+// Start probes the targets every interval, until stopped.
+func (h *UpstreamHealthChecker) Start() {
+	go func() {
+		ticker := time.NewTicker(time.Duration(h.conf.Interval) * time.Second)
+		defer ticker.Stop()
+		for {
+			h.checkAll()
+			select {
+			case <-ticker.C:
+			case <-h.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (h *UpstreamHealthChecker) Stop() {
+	h.stopOnce.Do(func() { close(h.stop) })
+}
+
+// Down tells whether target was ejected by failing its probes.
+func (h *UpstreamHealthChecker) Down(target string) bool {
+	if h == nil {
+		return false
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	health := h.targets[target]
+	return health != nil && !health.Healthy
+}
+
+// Status returns the health of all targets, by target.
+func (h *UpstreamHealthChecker) Status() []TargetHealth {
+	h.mu.RLock()
+	status := make([]TargetHealth, 0, len(h.targets))
+	for _, health := range h.targets {
+		status = append(status, *health)
+	}
+	h.mu.RUnlock()
+
+	sort.Slice(status, func(i, j int) bool { return status[i].Target < status[j].Target })
+	return status
+}
+
+// balancedTargets returns the targets of the API and of its versions, or
+// those service discovery last found.
+func (h *UpstreamHealthChecker) balancedTargets() []string {
+	var targets []string
+	add := func(hosts []string) {
+		for _, host := range hosts {
+			targets = append(targets, EnsureTransport(host))
+		}
+	}
+
+	if h.spec.Proxy.ServiceDiscovery.UseDiscoveryService {
+		hl := h.spec.LastGoodHostList
+		if h.spec.ServiceWatcher != nil {
+			hl = h.spec.ServiceWatcher.Targets()
+		}
+		if hl != nil {
+			hosts, _ := hl.Weighted()
+			add(hosts)
+		}
+	} else if hl := h.spec.Proxy.StructuredTargetList; h.spec.Proxy.EnableLoadBalancing && hl != nil {
+		hosts, _ := hl.Weighted()
+		add(hosts)
+	}
+	for _, version := range h.spec.VersionData.Versions {
+		for _, target := range version.LoadBalancing.Targets {
+			add([]string{target.URL})
+		}
+	}
+	return targets
+}
+
+// checkAll probes all targets at once, forgetting those no longer balanced
+// over.
+func (h *UpstreamHealthChecker) checkAll() {
+	targets := h.balancedTargets()
+
+	var wg sync.WaitGroup
+	results := make([]error, len(targets))
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target string) {
+			defer wg.Done()
+			results[i] = h.probe(target)
+		}(i, target)
+	}
+	wg.Wait()
+
+	h.mu.Lock()
+	seen := make(map[string]bool, len(targets))
+	for i, target := range targets {
+		if seen[target] {
+			continue
+		}
+		seen[target] = true
+
+		health := h.targets[target]
+		if health == nil {
+			health = &TargetHealth{Target: target, Healthy: true}
+			h.targets[target] = health
+		}
+		if event, changed := h.record(health, results[i]); changed {
+			defer h.notify(event, target, results[i])
+		}
+	}
+	for target := range h.targets {
+		if !seen[target] {
+			delete(h.targets, target)
+		}
+	}
+	h.mu.Unlock()
+}
+
+// record counts the outcome of a probe, telling whether the target was
+// ejected or admitted back by it.
+func (h *UpstreamHealthChecker) record(health *TargetHealth, err error) (apidef.TykEvent, bool) {
+	health.LastCheck = time.Now()
+	if err != nil {
+		health.LastError = err.Error()
+		health.Successes = 0
+		health.Failures++
+		if health.Healthy && health.Failures >= h.conf.UnhealthyThreshold {
+			health.Healthy = false
+			return EventHOSTDOWN, true
+		}
+		return "", false
+	}
+
+	health.LastError = ""
+	health.Failures = 0
+	health.Successes++
+	if !health.Healthy && health.Successes >= h.conf.HealthyThreshold {
+		health.Healthy = true
+		return EventHOSTUP, true
+	}
+	return "", false
+}
+
+func (h *UpstreamHealthChecker) notify(event apidef.TykEvent, target string, err error) {
+	message := "Upstream health check succeeded"
+	if event == EventHOSTDOWN {
+		message = "Upstream health check failed: " + err.Error()
+		log.WithFields(logrus.Fields{
+			"prefix": "health-check",
+			"api_id": h.spec.APIID,
+		}).Warning("Target ejected from load balancing: ", target)
+	} else {
+		log.WithFields(logrus.Fields{
+			"prefix": "health-check",
+			"api_id": h.spec.APIID,
+		}).Info("Target admitted back to load balancing: ", target)
+	}
+
+	h.spec.FireEvent(event, EventHostStatusMeta{
+		EventMetaDefault: EventMetaDefault{Message: message},
+		HostInfo: HostHealthReport{
+			HostData: HostData{CheckURL: target},
+		},
+	})
+}
+
+func (h *UpstreamHealthChecker) probe(target string) error {
+	if h.conf.Type == "tcp" {
+		u, err := url.Parse(target)
+		if err != nil {
+			return err
+		}
+		host := u.Host
+		if u.Port() == "" {
+			port := "80"
+			if u.Scheme == "https" {
+				port = "443"
+			}
+			host = net.JoinHostPort(u.Hostname(), port)
+		}
+		conn, err := net.DialTimeout("tcp", host, time.Duration(h.conf.Timeout)*time.Second)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	u.Path = singleJoiningSlash(u.Path, h.conf.Path, false)
+	resp, err := h.client.Get(u.String())
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if len(h.conf.StatusCodes) == 0 {
+		if resp.StatusCode < http.StatusBadRequest {
+			return nil
+		}
+	}
+	for _, code := range h.conf.StatusCodes {
+		if code == resp.StatusCode {
+			return nil
+		}
+	}
+	return fmt.Errorf("unhealthy status %d", resp.StatusCode)
+}
+
+// upstreamHealthHandler reports the health of the load balanced targets of an
+// API, as probed by this node.
+func upstreamHealthHandler(w http.ResponseWriter, r *http.Request) {
+	apiID := mux.Vars(r)["apiID"]
+	spec := getApiSpec(apiID)
+	if spec == nil {
+		doJSONWrite(w, http.StatusNotFound, apiError("API not found"))
+		return
+	}
+	if spec.UpstreamHealth == nil {
+		doJSONWrite(w, http.StatusBadRequest, apiError("Health checks are not enabled for this API"))
+		return
+	}
+	doJSONWrite(w, http.StatusOK, spec.UpstreamHealth.Status())
+}
@@ -0,0 +1,95 @@
+package gateway
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestUpstreamHealthThresholds(t *testing.T) {
+	h := NewUpstreamHealthChecker(&APISpec{APIDefinition: &apidef.APIDefinition{}}, apidef.UpstreamHealthCheckMeta{})
+	health := &TargetHealth{Target: "http://a", Healthy: true}
+	failed := errors.New("connection refused")
+
+	for i := 1; i < 3; i++ {
+		if _, changed := h.record(health, failed); changed {
+			t.Fatalf("Expected the target to stay up after %d failures", i)
+		}
+	}
+	if event, changed := h.record(health, failed); !changed || event != EventHOSTDOWN || health.Healthy {
+		t.Fatal("Expected the target to be ejected after 3 failures")
+	}
+
+	if _, changed := h.record(health, nil); changed {
+		t.Fatal("Expected the target to stay down after 1 success")
+	}
+	if event, changed := h.record(health, nil); !changed || event != EventHOSTUP || !health.Healthy {
+		t.Fatal("Expected the target to be admitted back after 2 successes")
+	}
+}
+
+func TestUpstreamHealthCheck(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	var failing int32
+	upstream := func(body string, check func() bool) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/healthz" && !check() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(body))
+		}))
+	}
+	a := upstream("upstream a", func() bool { return true })
+	b := upstream("upstream b", func() bool { return atomic.LoadInt32(&failing) == 0 })
+	defer a.Close()
+	defer b.Close()
+
+	spec := BuildAndLoadAPI(func(spec *APISpec) {
+		spec.APIID = "health"
+		spec.Proxy.ListenPath = "/"
+		spec.Proxy.EnableLoadBalancing = true
+		spec.Proxy.Targets = []string{a.URL, b.URL}
+		spec.Proxy.HealthCheck = apidef.UpstreamHealthCheckMeta{
+			Enabled:            true,
+			Path:               "/healthz",
+			UnhealthyThreshold: 1,
+			HealthyThreshold:   1,
+		}
+	})[0]
+
+	atomic.StoreInt32(&failing, 1)
+	spec.UpstreamHealth.checkAll()
+
+	t.Run("Unhealthy target ejected", func(t *testing.T) {
+		ts.Run(t, []test.TestCase{
+			{Path: "/", Code: http.StatusOK, BodyMatch: "upstream a"},
+			{Path: "/", Code: http.StatusOK, BodyMatch: "upstream a"},
+		}...)
+	})
+
+	t.Run("Status in the control API", func(t *testing.T) {
+		ts.Run(t, []test.TestCase{
+			{Path: "/tyk/apis/health/targets", AdminAuth: true, Code: http.StatusOK, BodyMatch: `"healthy":false`},
+			{Path: "/tyk/apis/unknown/targets", AdminAuth: true, Code: http.StatusNotFound},
+		}...)
+	})
+
+	atomic.StoreInt32(&failing, 0)
+	spec.UpstreamHealth.checkAll()
+
+	t.Run("Recovered target admitted back", func(t *testing.T) {
+		ts.Run(t, []test.TestCase{
+			{Path: "/", Code: http.StatusOK, BodyMatch: "upstream"},
+			{Path: "/", Code: http.StatusOK, BodyMatch: "upstream"},
+			{Path: "/tyk/apis/health/targets", AdminAuth: true, Code: http.StatusOK, BodyNotMatch: `"healthy":false`},
+		}...)
+	})
+}
@@ -0,0 +1,227 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+
+	"github.com/TykTechnologies/tyk/storage"
+)
+
+// versionRollbackStore keeps the cutovers rolled back by API ID, for them
+// to stay rolled back across reloads and nodes. Each is kept as its version
+// and time, so that scheduling another cutover is not rolled back too.
+var versionRollbackStore storage.Handler = &storage.RedisCluster{KeyPrefix: "version-rollback-"}
+
+var errNoCutover = errors.New("the default version has not been switched")
+
+// VersionCutover switches the default version of an API at the time its
+// cutover is scheduled, and back to the default version of its definition
+// on rollback.
+type VersionCutover struct {
+	spec *APISpec
+	at   time.Time
+
+	mu       sync.RWMutex
+	active   string
+	switched bool
+	timer    *time.Timer
+}
+
+func NewVersionCutover(spec *APISpec) (*VersionCutover, error) {
+	at, err := time.Parse(expiredTimeFormat, spec.VersionCutover.At)
+	if err != nil {
+		return nil, err
+	}
+	return &VersionCutover{
+		spec:   spec,
+		at:     at,
+		active: spec.VersionData.DefaultVersion,
+	}, nil
+}
+
+// rollbackKey identifies the cutover, to tell whether it was rolled back.
+func (c *VersionCutover) rollbackKey() string {
+	return c.spec.VersionCutover.Version + "@" + c.spec.VersionCutover.At
+}
+
+// rolledBack tells whether the cutover was rolled back, on any node.
+func (c *VersionCutover) rolledBack() bool {
+	rolledBack, err := versionRollbackStore.GetKey(c.spec.APIID)
+	return err == nil && rolledBack == c.rollbackKey()
+}
+
+// Start switches the version if it is time already, or schedules the switch
+// otherwise, unless the cutover was rolled back.
+func (c *VersionCutover) Start() {
+	if c.rolledBack() {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if wait := time.Until(c.at); wait > 0 {
+		c.timer = time.AfterFunc(wait, func() {
+			c.switchTo(c.spec.VersionCutover.Version, true, "Scheduled cutover")
+		})
+		return
+	}
+	// The switch happened before the API was loaded, there is nothing to
+	// notify
+	c.active = c.spec.VersionCutover.Version
+	c.switched = true
+}
+
+func (c *VersionCutover) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+}
+
+// Active returns the version requests without one are sent to.
+func (c *VersionCutover) Active() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.active
+}
+
+// Rollback switches back to the default version of the definition, for the
+// cutover not to happen again until another one is scheduled.
+func (c *VersionCutover) Rollback() error {
+	c.mu.RLock()
+	switched := c.switched
+	c.mu.RUnlock()
+	if !switched {
+		return errNoCutover
+	}
+
+	if err := versionRollbackStore.SetKey(c.spec.APIID, c.rollbackKey(), 0); err != nil {
+		return err
+	}
+	c.switchTo(c.spec.VersionData.DefaultVersion, false, "Rollback")
+	notifyVersionRolledBack(c.spec.APIID)
+	return nil
+}
+
+// loadRollback switches back to the default version of the definition if
+// the cutover was rolled back on another node.
+func (c *VersionCutover) loadRollback() {
+	if !c.rolledBack() {
+		return
+	}
+
+	c.mu.Lock()
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	switched := c.switched
+	c.mu.Unlock()
+
+	if switched {
+		c.switchTo(c.spec.VersionData.DefaultVersion, false, "Rollback")
+	}
+}
+
+func (c *VersionCutover) switchTo(version string, switched bool, reason string) {
+	c.mu.Lock()
+	from := c.active
+	c.active = version
+	c.switched = switched
+	c.mu.Unlock()
+
+	log.WithFields(logrus.Fields{
+		"prefix": "versions",
+		"api_id": c.spec.APIID,
+	}).Infof("%s: default version switched from %q to %q", reason, from, version)
+
+	c.spec.FireEvent(EventVersionSwitched, EventVersionSwitchedMeta{
+		EventMetaDefault: EventMetaDefault{Message: reason},
+		APIID:            c.spec.APIID,
+		From:             from,
+		To:               version,
+	})
+}
+
+// versionRollbackNotification is published to other gateways when a cutover
+// is rolled back, for them to roll it back too.
+type versionRollbackNotification struct {
+	APIID  string `json:"api_id"`
+	NodeID string `json:"node_id"`
+}
+
+func notifyVersionRolledBack(apiID string) {
+	payload, err := json.Marshal(versionRollbackNotification{APIID: apiID, NodeID: getNodeID()})
+	if err != nil {
+		log.Error("Failed to encode version rollback notification: ", err)
+		return
+	}
+
+	MainNotifier.Notify(Notification{Command: NoticeVersionRolledBack, Payload: string(payload)})
+}
+
+// handleVersionRolledBack applies a rollback made on another gateway.
+func handleVersionRolledBack(payload string) {
+	var notif versionRollbackNotification
+	if err := json.Unmarshal([]byte(payload), &notif); err != nil {
+		pubSubLog.Error("Failed to decode version rollback notification: ", err)
+		return
+	}
+
+	// Rollbacks made by this node are already applied
+	if notif.NodeID == getNodeID() {
+		return
+	}
+
+	if spec := getApiSpec(notif.APIID); spec != nil && spec.Cutover != nil {
+		spec.Cutover.loadRollback()
+	}
+}
+
+// defaultVersion returns the version requests without one are sent to, as
+// the cutover of the API switched it.
+func (s *APISpec) defaultVersion() string {
+	if s.Cutover != nil {
+		return s.Cutover.Active()
+	}
+	return s.VersionData.DefaultVersion
+}
+
+type apiActiveVersion struct {
+	Active  string `json:"active_version"`
+	Default string `json:"default_version"`
+}
+
+// versionRollbackHandler rolls the default version of an API back from its
+// cutover, without reloading it.
+func versionRollbackHandler(w http.ResponseWriter, r *http.Request) {
+	apiID := mux.Vars(r)["apiID"]
+	spec := getApiSpec(apiID)
+	if spec == nil {
+		doJSONWrite(w, http.StatusNotFound, apiError("API not found"))
+		return
+	}
+	if spec.Cutover == nil {
+		doJSONWrite(w, http.StatusBadRequest, apiError("No version cutover is scheduled for this API"))
+		return
+	}
+
+	if err := spec.Cutover.Rollback(); err != nil {
+		status := http.StatusInternalServerError
+		if err == errNoCutover {
+			status = http.StatusBadRequest
+		}
+		doJSONWrite(w, status, apiError("Could not roll back: "+err.Error()))
+		return
+	}
+	doJSONWrite(w, http.StatusOK, apiActiveVersion{
+		Active:  spec.Cutover.Active(),
+		Default: spec.VersionData.DefaultVersion,
+	})
+}
@@ -0,0 +1,111 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+
+	"github.com/TykTechnologies/tyk/apidef"
+	"github.com/TykTechnologies/tyk/config"
+	"github.com/TykTechnologies/tyk/test"
+)
+
+func TestVersionCutover(t *testing.T) {
+	ts := StartTest()
+	defer ts.Close()
+
+	versionRollbackStore.DeleteKey("test")
+	defer versionRollbackStore.DeleteKey("test")
+
+	load := func(at time.Time) *APISpec {
+		return BuildAndLoadAPI(func(spec *APISpec) {
+			blue := apidef.VersionInfo{Name: "blue"}
+			blue.Paths.WhiteList = []string{"/blue"}
+			green := apidef.VersionInfo{Name: "green"}
+			green.Paths.WhiteList = []string{"/green"}
+
+			spec.Proxy.ListenPath = "/"
+			spec.VersionDefinition.Location = urlParamLocation
+			spec.VersionDefinition.Key = "v"
+			spec.VersionData.NotVersioned = false
+			spec.VersionData.Versions = map[string]apidef.VersionInfo{"blue": blue, "green": green}
+			spec.VersionData.DefaultVersion = "blue"
+			spec.VersionCutover = apidef.VersionCutoverMeta{
+				Enabled: true,
+				Version: "green",
+				At:      at.UTC().Format(expiredTimeFormat),
+			}
+		})[0]
+	}
+
+	t.Run("Scheduled", func(t *testing.T) {
+		load(time.Now().Add(time.Hour))
+
+		ts.Run(t, []test.TestCase{
+			{Path: "/blue", Code: http.StatusOK},
+			{Path: "/green", Code: http.StatusForbidden},
+			{Method: http.MethodPost, Path: "/tyk/apis/test/versions/rollback", AdminAuth: true, Code: http.StatusBadRequest},
+		}...)
+	})
+
+	t.Run("Switched and rolled back", func(t *testing.T) {
+		past := time.Now().Add(-time.Hour)
+		spec := load(past)
+
+		events := make(chan EventVersionSwitchedMeta, 1)
+		spec.EventPaths = map[apidef.TykEvent][]config.TykEventHandler{
+			EventVersionSwitched: {&testEventHandler{func(em config.EventMessage) {
+				events <- em.Meta.(EventVersionSwitchedMeta)
+			}}},
+		}
+
+		ts.Run(t, []test.TestCase{
+			{Path: "/green", Code: http.StatusOK},
+			{Path: "/blue", Code: http.StatusForbidden},
+			{Path: "/blue?v=blue", Code: http.StatusOK},
+			{Method: http.MethodPost, Path: "/tyk/apis/test/versions/rollback", AdminAuth: true,
+				Code: http.StatusOK, BodyMatch: `"active_version":"blue"`},
+			{Path: "/blue", Code: http.StatusOK},
+			{Path: "/green", Code: http.StatusForbidden},
+			{Method: http.MethodPost, Path: "/tyk/apis/test/versions/rollback", AdminAuth: true, Code: http.StatusBadRequest},
+		}...)
+
+		select {
+		case event := <-events:
+			if event.From != "green" || event.To != "blue" {
+				t.Errorf("Expected a switch from green to blue, got %+v", event)
+			}
+		case <-time.After(time.Second):
+			t.Error("Expected the switch to fire an event")
+		}
+
+		// The rollback sticks once reloaded
+		load(past)
+		ts.Run(t, test.TestCase{Path: "/blue", Code: http.StatusOK})
+	})
+
+	t.Run("Rolled back on another node", func(t *testing.T) {
+		versionRollbackStore.DeleteKey("test")
+		past := time.Now().Add(-time.Hour)
+		spec := load(past)
+
+		notify := func(nodeID string) {
+			payload, _ := json.Marshal(versionRollbackNotification{APIID: "test", NodeID: nodeID})
+			data, _ := json.Marshal(Notification{Command: NoticeVersionRolledBack, Payload: string(payload)})
+			handleRedisEvent(redis.Message{Data: data}, nil, nil)
+		}
+
+		versionRollbackStore.SetKey("test", spec.Cutover.rollbackKey(), 0)
+		notify(getNodeID())
+		ts.Run(t, test.TestCase{Path: "/green", Code: http.StatusOK})
+
+		notify("other-node")
+		ts.Run(t, []test.TestCase{
+			{Path: "/blue", Code: http.StatusOK},
+			{Path: "/green", Code: http.StatusForbidden},
+		}...)
+	})
+}
@@ -0,0 +1,208 @@
+package graphql
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// listArguments are arguments limiting size of returned lists. Complexity of
+// fields selected under a list is multiplied by its size.
+var listArguments = []string{"first", "last", "limit"}
+
+// maxSelections limits work done analysing a query, as fragments spread
+// repeatedly expand to exponentially many fields.
+const maxSelections = 100000
+
+// Analysis describes cost of an operation.
+type Analysis struct {
+	// Type is "query", "mutation" or "subscription".
+	Type string
+	Name string
+
+	// Depth is the deepest level of nested fields, where fields of the
+	// operation are on level 1.
+	Depth int
+	// Complexity is the number of fields, where fields selected under lists
+	// are counted once per requested list item.
+	Complexity int
+	// Aliases is the number of aliased fields.
+	Aliases int
+	// Fields are paths of all selected fields, like "user.friends.name",
+	// sorted and without duplicates.
+	Fields []string
+}
+
+// Analyse returns the cost of the operation with the name, which may be empty
+// if the document has a single operation. Variables are used to read list
+// sizes passed as variables. Fragments are expanded where they are spread.
+func (d *Document) Analyse(operationName string, variables map[string]interface{}) (*Analysis, error) {
+	operation, err := d.operation(operationName)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &analyser{
+		doc:       d,
+		variables: variables,
+		visiting:  map[string]bool{},
+		fields:    map[string]bool{},
+	}
+
+	complexity, err := a.selections(operation.Selections, "", 1)
+	if err != nil {
+		return nil, err
+	}
+
+	analysis := &Analysis{
+		Type:       operation.Type,
+		Name:       operation.Name,
+		Depth:      a.depth,
+		Complexity: complexity,
+		Aliases:    a.aliases,
+	}
+	for field := range a.fields {
+		analysis.Fields = append(analysis.Fields, field)
+	}
+	sort.Strings(analysis.Fields)
+
+	return analysis, nil
+}
+
+func (d *Document) operation(name string) (*Operation, error) {
+	if name == "" {
+		if len(d.Operations) > 1 {
+			return nil, fmt.Errorf("operation name is required for document with multiple operations")
+		}
+		return d.Operations[0], nil
+	}
+
+	for _, operation := range d.Operations {
+		if operation.Name == name {
+			return operation, nil
+		}
+	}
+
+	return nil, fmt.Errorf("operation %q not found", name)
+}
+
+type analyser struct {
+	doc       *Document
+	variables map[string]interface{}
+
+	// visiting are fragments being expanded, to detect cycles
+	visiting map[string]bool
+
+	depth   int
+	aliases int
+	fields  map[string]bool
+	visited int
+}
+
+func (a *analyser) selections(selections []Selection, path string, depth int) (complexity int, err error) {
+	for _, sel := range selections {
+		if a.visited++; a.visited > maxSelections {
+			return 0, fmt.Errorf("query has more than %d selections", maxSelections)
+		}
+
+		cost, err := a.selection(sel, path, depth)
+		if err != nil {
+			return 0, err
+		}
+		complexity = saturatingAdd(complexity, cost)
+	}
+
+	return complexity, nil
+}
+
+func (a *analyser) selection(sel Selection, path string, depth int) (int, error) {
+	switch {
+	case sel.FragmentName != "":
+		fragment, found := a.doc.Fragments[sel.FragmentName]
+		if !found {
+			return 0, fmt.Errorf("fragment %q is not defined", sel.FragmentName)
+		}
+		if a.visiting[sel.FragmentName] {
+			return 0, fmt.Errorf("fragment %q spreads itself", sel.FragmentName)
+		}
+
+		a.visiting[sel.FragmentName] = true
+		defer delete(a.visiting, sel.FragmentName)
+
+		return a.selections(fragment.Selections, path, depth)
+	case !sel.IsField():
+		return a.selections(sel.Selections, path, depth)
+	}
+
+	// Typename is resolved by the server itself
+	if sel.Name == "__typename" {
+		return 0, nil
+	}
+
+	if sel.Alias != "" {
+		a.aliases++
+	}
+	if depth > a.depth {
+		a.depth = depth
+	}
+
+	fieldPath := sel.Name
+	if path != "" {
+		fieldPath = path + "." + sel.Name
+	}
+	a.fields[fieldPath] = true
+
+	children, err := a.selections(sel.Selections, fieldPath, depth+1)
+	if err != nil {
+		return 0, err
+	}
+
+	size := a.listSize(sel.Arguments)
+	if children > 0 && size > math.MaxInt32/children {
+		return math.MaxInt32, nil
+	}
+
+	return saturatingAdd(1, size*children), nil
+}
+
+// saturatingAdd keeps complexity of huge queries from overflowing.
+func saturatingAdd(a, b int) int {
+	if a > math.MaxInt32-b {
+		return math.MaxInt32
+	}
+
+	return a + b
+}
+
+// listSize returns requested number of list items, or 1 if the field has no
+// list arguments.
+func (a *analyser) listSize(args map[string]interface{}) int {
+	for _, name := range listArguments {
+		val, found := args[name]
+		if !found {
+			continue
+		}
+
+		if variable, ok := val.(Variable); ok {
+			val = a.variables[string(variable)]
+		}
+
+		var size float64
+		switch v := val.(type) {
+		case int64:
+			size = float64(v)
+		case float64:
+			// Variables decoded from JSON are floats
+			size = v
+		}
+
+		switch {
+		case size >= math.MaxInt32:
+			return math.MaxInt32
+		case size >= 1:
+			return int(size)
+		}
+	}
+
+	return 1
+}
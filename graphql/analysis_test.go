@@ -0,0 +1,146 @@
+package graphql
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAnalyse(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		operation string
+		variables map[string]interface{}
+
+		depth, complexity, aliases int
+		fields                     []string
+	}{
+		{
+			name:       "Flat",
+			query:      `{ me { name email } }`,
+			depth:      2,
+			complexity: 3,
+			fields:     []string{"me", "me.email", "me.name"},
+		},
+		{
+			name:       "Aliases",
+			query:      `{ a: user(id: 1) { name } b: user(id: 2) { name } }`,
+			depth:      2,
+			complexity: 4,
+			aliases:    2,
+			fields:     []string{"user", "user.name"},
+		},
+		{
+			name:       "Lists",
+			query:      `{ users(first: 10) { name friends(last: 5) { name } } }`,
+			depth:      3,
+			complexity: 1 + 10*(1+1+5*1),
+			fields:     []string{"users", "users.friends", "users.friends.name", "users.name"},
+		},
+		{
+			name:       "List size from variable",
+			query:      `query Users($n: Int) { users(limit: $n) { name } }`,
+			variables:  map[string]interface{}{"n": 20.0},
+			depth:      2,
+			complexity: 21,
+			fields:     []string{"users", "users.name"},
+		},
+		{
+			name: "Fragments",
+			query: `{ me { ...user ... on Admin { permissions { name } } } }
+				fragment user on User { name __typename friends { ...friend } }
+				fragment friend on User { name }`,
+			depth:      3,
+			complexity: 6,
+			fields:     []string{"me", "me.friends", "me.friends.name", "me.name", "me.permissions", "me.permissions.name"},
+		},
+		{
+			name:       "Named operation",
+			query:      `query A { a } mutation B { b { c } }`,
+			operation:  "B",
+			depth:      2,
+			complexity: 2,
+			fields:     []string{"b", "b.c"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := Parse(tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			a, err := doc.Analyse(tc.operation, tc.variables)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if a.Depth != tc.depth || a.Complexity != tc.complexity || a.Aliases != tc.aliases {
+				t.Errorf("Expected depth %d, complexity %d, aliases %d, got %d, %d, %d",
+					tc.depth, tc.complexity, tc.aliases, a.Depth, a.Complexity, a.Aliases)
+			}
+			if !reflect.DeepEqual(a.Fields, tc.fields) {
+				t.Error("Wrong fields", a.Fields)
+			}
+		})
+	}
+}
+
+func TestAnalyseErrors(t *testing.T) {
+	tests := []struct {
+		name, query, operation, err string
+	}{
+		{"Missing operation name", `query A { a } query B { b }`, "", "operation name is required"},
+		{"Unknown operation", `query A { a }`, "B", `operation "B" not found`},
+		{"Unknown fragment", `{ ...user }`, "", `fragment "user" is not defined`},
+		{"Fragment cycle", `{ ...a } fragment a on A { x ...b } fragment b on B { ...a }`, "", `fragment "a" spreads itself`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := Parse(tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = doc.Analyse(tc.operation, nil)
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("Expected error %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestAnalyseLimits(t *testing.T) {
+	t.Run("Complexity overflow", func(t *testing.T) {
+		doc, _ := Parse(`{ a(first: 100000) { b(first: 100000) { c(first: 100000) { d } } } }`)
+		a, err := doc.Analyse("", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Complexity != math.MaxInt32 {
+			t.Error("Complexity should saturate", a.Complexity)
+		}
+	})
+
+	t.Run("Fragment expansion", func(t *testing.T) {
+		// Every fragment spreads the next one twice
+		var fragments []string
+		for i := 0; i < 20; i++ {
+			next := "f" + strconv.Itoa(i+1)
+			fragments = append(fragments, "fragment f"+strconv.Itoa(i)+" on T { x ..."+next+" ..."+next+" }")
+		}
+		doc, err := Parse(`{ ...f0 } ` + strings.Join(fragments, " ") + ` fragment f20 on T { x }`)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := doc.Analyse("", nil); err == nil || !strings.Contains(err.Error(), "selections") {
+			t.Error("Expansion should be limited", err)
+		}
+	})
+}
@@ -0,0 +1,447 @@
+/*
+Package graphql parses GraphQL queries, to analyse them before they are
+proxied to GraphQL upstreams. Only executable documents are supported: type
+system definitions are rejected.
+*/
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Document is a parsed GraphQL request document.
+type Document struct {
+	Operations []*Operation
+	Fragments  map[string]*Fragment
+}
+
+// Operation is a query, mutation or subscription.
+type Operation struct {
+	// Type is "query", "mutation" or "subscription".
+	Type       string
+	Name       string
+	Selections []Selection
+}
+
+// Fragment is a named fragment definition.
+type Fragment struct {
+	Name          string
+	TypeCondition string
+	Selections    []Selection
+}
+
+// Selection is a field, a fragment spread or an inline fragment. Fragment
+// spreads only have FragmentName set, inline fragments have no Name.
+type Selection struct {
+	Alias     string
+	Name      string
+	Arguments map[string]interface{}
+
+	FragmentName  string
+	TypeCondition string
+
+	Selections []Selection
+}
+
+// IsField returns true if the selection is a field, not a fragment.
+func (s *Selection) IsField() bool {
+	return s.Name != ""
+}
+
+// Variable is a reference to a query variable in argument values.
+type Variable string
+
+// Parse parses a GraphQL document.
+func Parse(query string) (*Document, error) {
+	p := &parser{lexer: lexer{src: query}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	doc := &Document{Fragments: map[string]*Fragment{}}
+	for p.tok.kind != tokenEOF {
+		if p.peekName("fragment") {
+			fragment, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, found := doc.Fragments[fragment.Name]; found {
+				return nil, fmt.Errorf("fragment %q is defined more than once", fragment.Name)
+			}
+			doc.Fragments[fragment.Name] = fragment
+			continue
+		}
+
+		operation, err := p.operation()
+		if err != nil {
+			return nil, err
+		}
+		doc.Operations = append(doc.Operations, operation)
+	}
+
+	if len(doc.Operations) == 0 {
+		return nil, fmt.Errorf("document has no operations")
+	}
+
+	return doc, nil
+}
+
+type parser struct {
+	lexer
+	tok token
+}
+
+func (p *parser) advance() (err error) {
+	p.tok, err = p.next()
+	return err
+}
+
+func (p *parser) peek(punct string) bool {
+	return p.tok.kind == tokenPunct && p.tok.value == punct
+}
+
+func (p *parser) peekName(name string) bool {
+	return p.tok.kind == tokenName && p.tok.value == name
+}
+
+func (p *parser) unexpected() error {
+	if p.tok.kind == tokenEOF {
+		return p.errorf(p.tok.pos, "unexpected end of document")
+	}
+
+	return p.errorf(p.tok.pos, "unexpected %q", p.tok.value)
+}
+
+func (p *parser) expect(punct string) error {
+	if !p.peek(punct) {
+		return p.unexpected()
+	}
+
+	return p.advance()
+}
+
+func (p *parser) name() (string, error) {
+	if p.tok.kind != tokenName {
+		return "", p.unexpected()
+	}
+
+	name := p.tok.value
+	return name, p.advance()
+}
+
+func (p *parser) operation() (*Operation, error) {
+	operation := &Operation{Type: "query"}
+
+	if !p.peek("{") {
+		switch {
+		case p.peekName("query"), p.peekName("mutation"), p.peekName("subscription"):
+			operation.Type = p.tok.value
+		default:
+			return nil, p.unexpected()
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+
+		if p.tok.kind == tokenName {
+			operation.Name = p.tok.value
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := p.variableDefinitions(); err != nil {
+			return nil, err
+		}
+		if err := p.directives(); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	operation.Selections, err = p.selectionSet()
+	return operation, err
+}
+
+func (p *parser) fragment() (*Fragment, error) {
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	fragment := &Fragment{}
+
+	var err error
+	if fragment.Name, err = p.name(); err != nil {
+		return nil, err
+	}
+	if fragment.Name == "on" {
+		return nil, p.errorf(p.tok.pos, "fragment can't be named \"on\"")
+	}
+
+	if !p.peekName("on") {
+		return nil, p.unexpected()
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if fragment.TypeCondition, err = p.name(); err != nil {
+		return nil, err
+	}
+
+	if err := p.directives(); err != nil {
+		return nil, err
+	}
+
+	fragment.Selections, err = p.selectionSet()
+	return fragment, err
+}
+
+func (p *parser) selectionSet() ([]Selection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	var selections []Selection
+	for !p.peek("}") {
+		selection, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, selection)
+	}
+
+	if len(selections) == 0 {
+		return nil, p.errorf(p.tok.pos, "selection set is empty")
+	}
+
+	return selections, p.advance()
+}
+
+func (p *parser) selection() (sel Selection, err error) {
+	if p.peek("...") {
+		if err := p.advance(); err != nil {
+			return sel, err
+		}
+
+		// Fragment spread
+		if p.tok.kind == tokenName && p.tok.value != "on" {
+			sel.FragmentName = p.tok.value
+			if err := p.advance(); err != nil {
+				return sel, err
+			}
+			return sel, p.directives()
+		}
+
+		// Inline fragment
+		if p.peekName("on") {
+			if err := p.advance(); err != nil {
+				return sel, err
+			}
+			if sel.TypeCondition, err = p.name(); err != nil {
+				return sel, err
+			}
+		}
+		if err := p.directives(); err != nil {
+			return sel, err
+		}
+
+		sel.Selections, err = p.selectionSet()
+		return sel, err
+	}
+
+	if sel.Name, err = p.name(); err != nil {
+		return sel, err
+	}
+	if p.peek(":") {
+		if err := p.advance(); err != nil {
+			return sel, err
+		}
+		sel.Alias = sel.Name
+		if sel.Name, err = p.name(); err != nil {
+			return sel, err
+		}
+	}
+
+	if sel.Arguments, err = p.arguments(); err != nil {
+		return sel, err
+	}
+	if err := p.directives(); err != nil {
+		return sel, err
+	}
+
+	if p.peek("{") {
+		sel.Selections, err = p.selectionSet()
+	}
+
+	return sel, err
+}
+
+func (p *parser) arguments() (map[string]interface{}, error) {
+	if !p.peek("(") {
+		return nil, nil
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+
+	args := map[string]interface{}{}
+	for !p.peek(")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		if args[name], err = p.value(); err != nil {
+			return nil, err
+		}
+	}
+
+	return args, p.advance()
+}
+
+func (p *parser) directives() error {
+	for p.peek("@") {
+		if err := p.advance(); err != nil {
+			return err
+		}
+		if _, err := p.name(); err != nil {
+			return err
+		}
+		if _, err := p.arguments(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *parser) variableDefinitions() error {
+	if !p.peek("(") {
+		return nil
+	}
+	if err := p.advance(); err != nil {
+		return err
+	}
+
+	for !p.peek(")") {
+		if err := p.expect("$"); err != nil {
+			return err
+		}
+		if _, err := p.name(); err != nil {
+			return err
+		}
+		if err := p.expect(":"); err != nil {
+			return err
+		}
+		if err := p.typeRef(); err != nil {
+			return err
+		}
+		if p.peek("=") {
+			if err := p.advance(); err != nil {
+				return err
+			}
+			if _, err := p.value(); err != nil {
+				return err
+			}
+		}
+		if err := p.directives(); err != nil {
+			return err
+		}
+	}
+
+	return p.advance()
+}
+
+func (p *parser) typeRef() error {
+	if p.peek("[") {
+		if err := p.advance(); err != nil {
+			return err
+		}
+		if err := p.typeRef(); err != nil {
+			return err
+		}
+		if err := p.expect("]"); err != nil {
+			return err
+		}
+	} else if _, err := p.name(); err != nil {
+		return err
+	}
+
+	if p.peek("!") {
+		return p.advance()
+	}
+
+	return nil
+}
+
+// value parses an argument value. Numbers are returned as int64 or float64,
+// enum values as strings, and variables as Variable.
+func (p *parser) value() (val interface{}, err error) {
+	tok := p.tok
+
+	switch {
+	case p.peek("$"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		return Variable(name), err
+	case p.peek("["):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		list := []interface{}{}
+		for !p.peek("]") {
+			item, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		return list, p.advance()
+	case p.peek("{"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		object := map[string]interface{}{}
+		for !p.peek("}") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			if object[name], err = p.value(); err != nil {
+				return nil, err
+			}
+		}
+		return object, p.advance()
+	case tok.kind == tokenInt:
+		val, err = strconv.ParseInt(tok.value, 10, 64)
+	case tok.kind == tokenFloat:
+		val, err = strconv.ParseFloat(tok.value, 64)
+	case tok.kind == tokenString:
+		val = tok.value
+	case tok.kind == tokenName:
+		switch tok.value {
+		case "true", "false":
+			val = tok.value == "true"
+		case "null":
+			val = nil
+		default:
+			val = tok.value
+		}
+	default:
+		return nil, p.unexpected()
+	}
+
+	if err != nil {
+		return nil, p.errorf(tok.pos, "invalid number %q", tok.value)
+	}
+
+	return val, p.advance()
+}
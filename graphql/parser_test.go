@@ -0,0 +1,108 @@
+package graphql
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	doc, err := Parse(`
+		# Comments and commas are ignored
+		query Hero($episode: Episode = JEDI, $first: Int!) @cached {
+			hero(episode: $episode, filter: {name: "R2", tags: ["a", "b"]}) {
+				friendsOf: friends(first: 10, ratio: 0.5e1, active: true, after: null) {
+					...friend
+					... on Droid @include(if: true) { primaryFunction }
+				}
+			}
+		}
+
+		fragment friend on Character {
+			name
+			description(format: """block "quoted" \""" string""")
+		}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(doc.Operations) != 1 || len(doc.Fragments) != 1 {
+		t.Fatal("Operation and fragment should be parsed", doc)
+	}
+
+	op := doc.Operations[0]
+	if op.Type != "query" || op.Name != "Hero" {
+		t.Error("Wrong operation", op.Type, op.Name)
+	}
+
+	hero := op.Selections[0]
+	if hero.Arguments["episode"] != Variable("episode") {
+		t.Error("Variable argument should be parsed", hero.Arguments)
+	}
+	filter := map[string]interface{}{"name": "R2", "tags": []interface{}{"a", "b"}}
+	if !reflect.DeepEqual(hero.Arguments["filter"], filter) {
+		t.Error("Object argument should be parsed", hero.Arguments["filter"])
+	}
+
+	friends := hero.Selections[0]
+	if friends.Alias != "friendsOf" || friends.Name != "friends" {
+		t.Error("Alias should be parsed", friends.Alias, friends.Name)
+	}
+	args := map[string]interface{}{"first": int64(10), "ratio": 5.0, "active": true, "after": nil}
+	if !reflect.DeepEqual(friends.Arguments, args) {
+		t.Error("Scalar arguments should be parsed", friends.Arguments)
+	}
+
+	if spread := friends.Selections[0]; spread.FragmentName != "friend" || spread.IsField() {
+		t.Error("Fragment spread should be parsed", spread)
+	}
+	if inline := friends.Selections[1]; inline.TypeCondition != "Droid" || len(inline.Selections) != 1 {
+		t.Error("Inline fragment should be parsed", inline)
+	}
+
+	fragment := doc.Fragments["friend"]
+	if fragment.TypeCondition != "Character" || len(fragment.Selections) != 2 {
+		t.Error("Fragment should be parsed", fragment)
+	}
+	if format := fragment.Selections[1].Arguments["format"]; format != `block "quoted" \""" string` {
+		t.Error("Block string should be parsed", format)
+	}
+}
+
+func TestParseShorthand(t *testing.T) {
+	doc, err := Parse(`{ me { name } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if op := doc.Operations[0]; op.Type != "query" || op.Name != "" || op.Selections[0].Name != "me" {
+		t.Error("Query shorthand should be parsed", op)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name, query, err string
+	}{
+		{"Empty", ``, "document has no operations"},
+		{"Only fragment", `fragment f on User { name }`, "document has no operations"},
+		{"Type definition", `type User { name: String }`, `unexpected "type"`},
+		{"Unclosed selection", `{ me { name }`, "unexpected end of document"},
+		{"Empty selection", `{ me { } }`, "selection set is empty"},
+		{"Unterminated string", `{ me(name: "x) { id } }`, "unterminated string"},
+		{"Invalid character", `{ me ^ }`, `unexpected character '^'`},
+		{"Invalid number", `{ me(first: 1.) { id } }`, "invalid number"},
+		{"Duplicate fragment", `{ me } fragment f on A { a } fragment f on A { a }`, `fragment "f" is defined more than once`},
+		{"Position", "{\n  me(: 1) }", "syntax error at 2:6"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(tc.query)
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("Expected error %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
@@ -14,12 +14,24 @@ const (
 	Expires                 = "Expires"
 	Connection              = "Connection"
 	WWWAuthenticate         = "WWW-Authenticate"
+	Signature               = "Signature"
+	SignatureInput          = "Signature-Input"
+	DPoP                    = "DPoP"
+	ETag                    = "ETag"
+	IfMatch                 = "If-Match"
+	IfNoneMatch             = "If-None-Match"
+	IfModifiedSince         = "If-Modified-Since"
+	LastModified            = "Last-Modified"
+	Vary                    = "Vary"
+	RetryAfter              = "Retry-After"
 )
 
 const (
 	TykHookshot     = "Tyk-Hookshot"
 	ApplicationJSON = "application/json"
 	ApplicationXML  = "application/xml"
+	ApplicationP12  = "application/x-pkcs12"
+	ApplicationZip  = "application/zip"
 )
 
 const (
@@ -29,6 +41,7 @@ const (
 	XSessionAlias       = "X-Session-Alias"
 	XInitialURI         = "X-Initial-URI"
 	XForwardProto       = "X-Forwarded-Proto"
+	XForwardClientCert  = "X-Forwarded-Client-Cert"
 	XContentTypeOptions = "X-Content-Type-Options"
 	XXSSProtection      = "X-XSS-Protection"
 	XFrameOptions       = "X-Frame-Options"
@@ -37,4 +50,6 @@ const (
 	XTykHostname        = "x-tyk-hostname"
 	XGenerator          = "X-Generator"
 	XTykAuthorization   = "X-Tyk-Authorization"
+	XTykCertPassphrase  = "X-Tyk-Certificate-Passphrase"
+	XTykCertKeyURI      = "X-Tyk-Certificate-Key-URI"
 )
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/TykTechnologies/tyk/config"
 	"github.com/TykTechnologies/tyk/headers"
 )
 
@@ -15,6 +16,10 @@ func RealIP(r *http.Request) string {
 		return contextIp.(string)
 	}
 
+	if proxies, ok := trustedProxies(r); ok {
+		return trustedRealIP(r, proxies)
+	}
+
 	if realIP := r.Header.Get(headers.XRealIP); realIP != "" {
 		return realIP
 	}
@@ -29,6 +34,10 @@ func RealIP(r *http.Request) string {
 		return fw
 	}
 
+	return remoteHost(r)
+}
+
+func remoteHost(r *http.Request) string {
 	// From net/http.Request.RemoteAddr:
 	//   The HTTP server in this package sets RemoteAddr to an
 	//   "IP:port" address before invoking a handler.
@@ -36,3 +45,70 @@ func RealIP(r *http.Request) string {
 	host, _, _ := net.SplitHostPort(r.RemoteAddr)
 	return host
 }
+
+// trustedProxies returns the proxies trusted with forwarding headers of
+// requests to the port the request was received on, if set for the port.
+func trustedProxies(r *http.Request) ([]string, bool) {
+	byPort := config.Global().TrustedProxies
+	if len(byPort) == 0 {
+		return nil, false
+	}
+
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok {
+		return nil, false
+	}
+	_, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil, false
+	}
+
+	proxies, ok := byPort[port]
+	return proxies, ok
+}
+
+// trustedRealIP ignores forwarding headers unless the peer is a trusted
+// proxy. The client is then the last address forwarded through, skipping
+// other trusted proxies, as those before could have been set by the client.
+func trustedRealIP(r *http.Request, proxies []string) string {
+	host := remoteHost(r)
+	if !MatchIP(host, proxies) {
+		return host
+	}
+
+	if realIP := r.Header.Get(headers.XRealIP); realIP != "" {
+		return realIP
+	}
+
+	hops := strings.Split(r.Header.Get(headers.XForwardFor), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if i == 0 || !MatchIP(hop, proxies) {
+			return hop
+		}
+	}
+	return host
+}
+
+// MatchIP tells whether the IP is one of the IPs, or in one of the CIDR
+// ranges, listed.
+func MatchIP(ip string, list []string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, entry := range list {
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(parsed) {
+				return true
+			}
+		} else if parsed.Equal(net.ParseIP(entry)) {
+			return true
+		}
+	}
+	return false
+}
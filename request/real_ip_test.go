@@ -2,8 +2,11 @@ package request
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"testing"
+
+	"github.com/TykTechnologies/tyk/config"
 )
 
 var ipHeaderTests = []struct {
@@ -47,6 +50,46 @@ func TestRealIP(t *testing.T) {
 	}
 }
 
+func TestRealIP_TrustedProxies(t *testing.T) {
+	globalConf := config.Global()
+	defer config.SetGlobal(globalConf)
+	trustingConf := globalConf
+	trustingConf.TrustedProxies = map[string][]string{"8080": {"10.0.0.0/24", "192.168.0.1"}}
+	config.SetGlobal(trustingConf)
+
+	for _, test := range []struct {
+		port       int
+		remoteAddr string
+		realIP     string
+		forwarded  string
+		expected   string
+		comment    string
+	}{
+		{8080, "172.16.0.1:1234", "", "10.0.0.3", "172.16.0.1", "Untrusted peer"},
+		{8080, "10.0.0.1:1234", "", "172.16.0.3, 172.16.0.2, 192.168.0.1", "172.16.0.2", "Trusted proxies"},
+		{8080, "10.0.0.1:1234", "", "192.168.0.1", "192.168.0.1", "Only trusted proxies"},
+		{8080, "10.0.0.1:1234", "172.16.0.4", "", "172.16.0.4", "X-Real-IP from trusted proxy"},
+		{8080, "10.0.0.1:1234", "", "", "10.0.0.1", "No forwarding headers"},
+		{8081, "172.16.0.1:1234", "", "10.0.0.3, 10.0.0.2", "10.0.0.3", "Port without trust set"},
+	} {
+		t.Log(test.comment)
+
+		r, _ := http.NewRequest(http.MethodGet, "http://abc.com:8080", nil)
+		r = r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: test.port}))
+		r.RemoteAddr = test.remoteAddr
+		if test.realIP != "" {
+			r.Header.Set("X-Real-IP", test.realIP)
+		}
+		if test.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", test.forwarded)
+		}
+
+		if ip := RealIP(r); ip != test.expected {
+			t.Errorf("\texpected %s got %s", test.expected, ip)
+		}
+	}
+}
+
 func BenchmarkRealIP_RemoteAddr(b *testing.B) {
 	b.ReportAllocs()
 
@@ -229,12 +229,27 @@ func (r *RedisCluster) GetKey(keyName string) (string, error) {
 
 	if err != nil {
 		log.Debug("Error trying to get value:", err)
-		return "", ErrKeyNotFound
+		return "", keyReadError(err)
 	}
 
 	return value, nil
 }
 
+// keyReadError is ErrKeyNotFound for keys not set, and err for failures to
+// read them, so that outages aren't taken for missing keys.
+func keyReadError(err error) error {
+	if err == redis.ErrNil {
+		return ErrKeyNotFound
+	}
+	return err
+}
+
+// IsKeyNotFound reports if GetKey or GetRawKey failed for the key not being
+// set.
+func (r *RedisCluster) IsKeyNotFound(err error) bool {
+	return err == ErrKeyNotFound
+}
+
 func (r *RedisCluster) GetKeyTTL(keyName string) (ttl int64, err error) {
 	r.ensureConnection()
 	return redis.Int64(r.singleton().Do("TTL", r.fixKey(keyName)))
@@ -245,7 +260,7 @@ func (r *RedisCluster) GetRawKey(keyName string) (string, error) {
 	value, err := redis.String(r.singleton().Do("GET", keyName))
 	if err != nil {
 		log.Debug("Error trying to get value:", err)
-		return "", ErrKeyNotFound
+		return "", keyReadError(err)
 	}
 
 	return value, nil
@@ -794,6 +809,56 @@ func (r *RedisCluster) AddToSortedSet(keyName, value string, score float64) {
 	}
 }
 
+// AddToSortedSetPipelined adds values with given scores to sorted set identified by keyName
+func (r *RedisCluster) AddToSortedSetPipelined(keyName string, scores map[string]float64) {
+	if len(scores) == 0 {
+		return
+	}
+
+	fixedKey := r.fixKey(keyName)
+	args := make([]interface{}, 0, 1+2*len(scores))
+	args = append(args, fixedKey)
+	for value, score := range scores {
+		args = append(args, score, value)
+	}
+
+	r.ensureConnection()
+	if _, err := r.singleton().Do("ZADD", args...); err != nil {
+		log.WithField("fixedKey", fixedKey).WithError(err).Error("ZADD command failed")
+	}
+}
+
+// IncrementSortedSetPipelined increments scores of values in sorted set identified by keyName
+func (r *RedisCluster) IncrementSortedSetPipelined(keyName string, increments map[string]float64) {
+	if len(increments) == 0 {
+		return
+	}
+
+	fixedKey := r.fixKey(keyName)
+	pipeLine := make([]rediscluster.ClusterTransaction, 0, len(increments))
+	for value, increment := range increments {
+		pipeLine = append(pipeLine, rediscluster.ClusterTransaction{
+			Cmd:  "ZINCRBY",
+			Args: []interface{}{fixedKey, increment, value},
+		})
+	}
+
+	r.ensureConnection()
+	if _, err := r.singleton().DoPipeline(pipeLine); err != nil {
+		log.WithField("fixedKey", fixedKey).WithError(err).Error("ZINCRBY command failed")
+	}
+}
+
+// GetSortedSetScore gets score of value in sorted set identified by keyName
+func (r *RedisCluster) GetSortedSetScore(keyName, value string) (float64, error) {
+	r.ensureConnection()
+	score, err := redis.Float64(r.singleton().Do("ZSCORE", r.fixKey(keyName), value))
+	if err == redis.ErrNil {
+		return 0, ErrKeyNotFound
+	}
+	return score, err
+}
+
 // GetSortedSetRange gets range of elements of sorted set identified by keyName
 func (r *RedisCluster) GetSortedSetRange(keyName, scoreFrom, scoreTo string) ([]string, []float64, error) {
 	fixedKey := r.fixKey(keyName)
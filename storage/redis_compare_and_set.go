@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"errors"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// CompareAndSetKey sets the key to value if check accepts the value it holds,
+// and if the key isn't written by anyone else in between, on any gateway
+// sharing the storage. It returns false, without setting the key, otherwise.
+func (r *RedisCluster) CompareAndSetKey(keyName string, check func(value string, found bool) bool, value string, timeout int64) (bool, error) {
+	return r.compareAndSet(r.fixKey(keyName), check, value, timeout)
+}
+
+// CompareAndSetRawKey is CompareAndSetKey for keys already prefixed and hashed.
+func (r *RedisCluster) CompareAndSetRawKey(keyName string, check func(value string, found bool) bool, value string, timeout int64) (bool, error) {
+	return r.compareAndSet(keyName, check, value, timeout)
+}
+
+// compareAndSet watches the key for the time of the check, for the set to be
+// aborted by Redis if the key is written meanwhile. The connection is taken
+// from the handle of the key, as the transaction must run on a single one.
+func (r *RedisCluster) compareAndSet(keyName string, check func(string, bool) bool, value string, timeout int64) (bool, error) {
+	r.ensureConnection()
+	cluster := r.singleton()
+	if cluster == nil {
+		return false, errors.New("Redis connection failed")
+	}
+	handle := cluster.HandleForKey(keyName)
+	if handle == nil {
+		return false, errors.New("Redis connection failed. Handle is nil")
+	}
+
+	conn := handle.GetRedisConn()
+	defer conn.Close()
+
+	if _, err := conn.Do("WATCH", keyName); err != nil {
+		log.Error("Could not WATCH key: ", err)
+		return false, err
+	}
+	current, err := redis.String(conn.Do("GET", keyName))
+	found := err == nil
+	if err != nil && err != redis.ErrNil {
+		conn.Do("UNWATCH")
+		log.Error("Error trying to get value: ", err)
+		return false, err
+	}
+	if !check(current, found) {
+		conn.Do("UNWATCH")
+		return false, nil
+	}
+
+	conn.Send("MULTI")
+	if timeout > 0 {
+		conn.Send("SET", keyName, value, "EX", timeout)
+	} else {
+		conn.Send("SET", keyName, value)
+	}
+	// EXEC replies nil when the key was written since WATCH
+	if _, err := redis.Values(conn.Do("EXEC")); err != nil {
+		if err == redis.ErrNil {
+			return false, nil
+		}
+		log.Error("Error trying to set value: ", err)
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"errors"
+
+	"github.com/gomodule/redigo/redis"
+	uuid "github.com/satori/go.uuid"
+)
+
+// slidingWindowScript counts requests of the last ARGV[1] seconds, and adds
+// the request ARGV[3] unless the window holds ARGV[2] requests already, the
+// last ARGV[5] seconds of it hold ARGV[6] requests if that is set, or ARGV[4]
+// is set. Time of Redis is used, so that windows are the same for all
+// gateways sharing the key. It's a script of the redigo package of cluster
+// connections, which loads it on NOSCRIPT errors of that package.
+var slidingWindowScript = redis.NewScript(1, `
+local key = KEYS[1]
+local per = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+
+if redis.replicate_commands then
+	redis.replicate_commands()
+end
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - per * 1000000)
+local count = redis.call('ZCARD', key)
+if count >= limit then
+	return {count, 0}
+end
+
+local burst = tonumber(ARGV[6])
+if burst > 0 and redis.call('ZCOUNT', key, now - tonumber(ARGV[5]) * 1000000, '+inf') >= burst then
+	return {count, 0}
+end
+
+if ARGV[4] ~= '1' then
+	redis.call('ZADD', key, now, ARGV[3])
+	redis.call('PEXPIRE', key, math.ceil(per * 1000))
+	count = count + 1
+end
+return {count, 1}
+`)
+
+// SlidingWindow atomically checks and records a request in the window of
+// the key, returning the number of requests in the window and whether the
+// request fits the limit, and the burst limit of the last burstPer seconds
+// unless burst is 0. Rejected and dry run requests are not recorded.
+func (r *RedisCluster) SlidingWindow(keyName string, per float64, limit int, burstPer float64, burst int, dryRun bool) (int, bool, error) {
+	cluster := r.singleton()
+	if cluster == nil {
+		return 0, false, errors.New("Redis connection failed")
+	}
+	handle := cluster.HandleForKey(keyName)
+	if handle == nil {
+		return 0, false, errors.New("Redis connection failed. Handle is nil")
+	}
+
+	conn := handle.GetRedisConn()
+	defer conn.Close()
+
+	dry := "0"
+	if dryRun {
+		dry = "1"
+	}
+	res, err := redis.Ints(slidingWindowScript.Do(conn, keyName, per, limit, uuid.NewV4().String(), dry, burstPer, burst))
+	if err != nil {
+		log.Error("Sliding window script failed: ", err)
+		return 0, false, err
+	}
+	if len(res) < 2 {
+		return 0, false, errors.New("sliding window script returned unexpected reply")
+	}
+
+	return res[0], res[1] == 1, nil
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/buger/jsonparser"
 	uuid "github.com/satori/go.uuid"
+	"golang.org/x/crypto/bcrypt"
 
 	"github.com/TykTechnologies/murmur3"
 	"github.com/TykTechnologies/tyk/config"
@@ -22,6 +23,9 @@ var log = logger.Get()
 // ErrKeyNotFound is a standard error for when a key is not found in the storage engine
 var ErrKeyNotFound = errors.New("key not found")
 
+// ErrNotSupported is returned by storages for operations they don't implement
+var ErrNotSupported = errors.New("not supported by storage")
+
 // Handler is a standard interface to a storage backend, used by
 // AuthorisationManager to read and write key values to the backend
 type Handler interface {
@@ -29,6 +33,10 @@ type Handler interface {
 	GetRawKey(string) (string, error)
 	SetKey(string, string, int64) error // Second input string is expected to be a JSON object (user.SessionState)
 	SetRawKey(string, string, int64) error
+	// CompareAndSetKey and CompareAndSetRawKey set a key if check accepts its
+	// value, and no one writes it in between
+	CompareAndSetKey(key string, check func(value string, found bool) bool, value string, timeout int64) (bool, error)
+	CompareAndSetRawKey(key string, check func(value string, found bool) bool, value string, timeout int64) (bool, error)
 	SetExp(string, int64) error   // Set key expiration
 	GetExp(string) (int64, error) // Returns expiry of a key
 	GetKeys(string) []string
@@ -42,6 +50,7 @@ type Handler interface {
 	IncrememntWithExpire(string, int64) int64
 	SetRollingWindow(key string, per int64, val string, pipeline bool) (int, []interface{})
 	GetRollingWindow(key string, per int64, pipeline bool) (int, []interface{})
+	SlidingWindow(key string, per float64, limit int, burstPer float64, burst int, dryRun bool) (int, bool, error)
 	GetSet(string) (map[string]string, error)
 	AddToSet(string, string)
 	AppendToSet(string, string)
@@ -51,6 +60,9 @@ type Handler interface {
 	DeleteScanMatch(string) bool
 	GetKeyPrefix() string
 	AddToSortedSet(string, string, float64)
+	AddToSortedSetPipelined(string, map[string]float64)
+	IncrementSortedSetPipelined(string, map[string]float64)
+	GetSortedSetScore(string, string) (float64, error)
 	GetSortedSetRange(string, string, string) ([]string, []float64, error)
 	RemoveSortedSetRange(string, string, string) error
 }
@@ -145,3 +157,31 @@ func HashKey(in string) string {
 	}
 	return HashStr(in)
 }
+
+// HashBcrypt is the slow hash function keys may be stored with in addition to
+// their fast hash, which still indexes the sessions so lookups stay O(1).
+var HashBcrypt = "bcrypt"
+
+// SlowHashStr hashes a key with a salted and costly hash function, so that
+// keys can be neither recovered nor forged from leaked hashes.
+func SlowHashStr(in, algorithm string) (string, error) {
+	switch algorithm {
+	case HashBcrypt:
+		hashed, err := bcrypt.GenerateFromPassword(preHash(in), bcrypt.DefaultCost)
+		return string(hashed), err
+	default:
+		return "", fmt.Errorf("Unknown slow key hash function: %s", algorithm)
+	}
+}
+
+// CompareSlowHash checks a key matches its slow hash.
+func CompareSlowHash(hashed, in string) error {
+	return bcrypt.CompareHashAndPassword([]byte(hashed), preHash(in))
+}
+
+// bcrypt ignores everything after the first 72 bytes, which for generated
+// keys would leave the key ID out.
+func preHash(in string) []byte {
+	sum := sha256.Sum256([]byte(in))
+	return []byte(base64.StdEncoding.EncodeToString(sum[:]))
+}
@@ -0,0 +1,169 @@
+// Package tcp proxies raw TCP connections to upstream services. TLS
+// connections are terminated by the listener, and routed to upstreams by the
+// server name (SNI) sent by clients.
+package tcp
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/TykTechnologies/tyk/log"
+)
+
+var logger = log.Get().WithField("prefix", "tcp-proxy")
+
+// ErrNoTarget is returned for connections to domains without upstream.
+var ErrNoTarget = errors.New("no upstream for domain")
+
+const dialTimeout = 30 * time.Second
+
+// target is an upstream service, TLSConfig is set for tls:// upstreams.
+type target struct {
+	addr      string
+	tlsConfig *tls.Config
+}
+
+// Proxy forwards connections accepted on a listener to upstreams of their
+// domains. Upstream of empty domain receives connections to any other domain,
+// and all connections of plain TCP listeners.
+type Proxy struct {
+	mu      sync.RWMutex
+	targets map[string]target
+}
+
+// AddDomainHandler routes connections of the domain to the upstream at
+// tcp://host:port or tls://host:port. tlsConfig is used to connect to tls
+// upstreams, and may be nil.
+func (p *Proxy) AddDomainHandler(domain, upstream string, tlsConfig *tls.Config) error {
+	u, err := url.Parse(upstream)
+	if err != nil {
+		return err
+	}
+
+	t := target{addr: u.Host}
+	switch u.Scheme {
+	case "tcp":
+	case "tls":
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		} else {
+			tlsConfig = tlsConfig.Clone()
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = u.Hostname()
+		}
+		t.tlsConfig = tlsConfig
+	default:
+		return fmt.Errorf("unsupported upstream scheme %q, should be tcp or tls", u.Scheme)
+	}
+	if u.Port() == "" {
+		return fmt.Errorf("upstream %q has no port", upstream)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.targets == nil {
+		p.targets = make(map[string]target)
+	}
+	p.targets[domain] = t
+	return nil
+}
+
+// Swap replaces upstreams with upstreams of the other proxy, connections
+// already proxied are kept.
+func (p *Proxy) Swap(other *Proxy) {
+	other.mu.RLock()
+	targets := other.targets
+	other.mu.RUnlock()
+
+	p.mu.Lock()
+	p.targets = targets
+	p.mu.Unlock()
+}
+
+// Serve proxies connections accepted by the listener until it is closed.
+func (p *Proxy) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+
+		go func() {
+			if err := p.handleConn(conn); err != nil {
+				logger.WithField("remote", conn.RemoteAddr().String()).Warning("Connection not proxied: ", err)
+			}
+		}()
+	}
+}
+
+func (p *Proxy) target(domain string) (target, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if t, ok := p.targets[domain]; ok {
+		return t, nil
+	}
+	if t, ok := p.targets[""]; ok {
+		return t, nil
+	}
+	return target{}, ErrNoTarget
+}
+
+func (p *Proxy) handleConn(conn net.Conn) error {
+	defer conn.Close()
+
+	var domain string
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		// Client certificates are verified during handshake
+		if err := tlsConn.Handshake(); err != nil {
+			return err
+		}
+		domain = tlsConn.ConnectionState().ServerName
+	}
+
+	t, err := p.target(domain)
+	if err != nil {
+		return fmt.Errorf("%v %q", err, domain)
+	}
+
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	var upstream net.Conn
+	if t.tlsConfig != nil {
+		upstream, err = tls.DialWithDialer(dialer, "tcp", t.addr, t.tlsConfig)
+	} else {
+		upstream, err = dialer.Dial("tcp", t.addr)
+	}
+	if err != nil {
+		return err
+	}
+	defer upstream.Close()
+
+	pipe(conn, upstream)
+	return nil
+}
+
+// pipe copies data both ways. Connections are closed by the caller once
+// either side closes its connection.
+func pipe(client, upstream net.Conn) {
+	done := make(chan struct{}, 2)
+	cp := func(dst, src net.Conn) {
+		io.Copy(dst, src)
+		done <- struct{}{}
+	}
+	go cp(upstream, client)
+	go cp(client, upstream)
+
+	<-done
+}
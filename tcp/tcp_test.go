@@ -0,0 +1,187 @@
+package tcp
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+func genCertificate(t *testing.T, names ...string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// startEcho starts upstream which replies to every line with its name and the
+// line, over TLS if cert is given.
+func startEcho(t *testing.T, name string, cert *tls.Certificate) (string, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert != nil {
+		l = tls.NewListener(l, &tls.Config{Certificates: []tls.Certificate{*cert}})
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					conn.Write([]byte(name + ": " + line))
+				}
+			}()
+		}
+	}()
+
+	return l.Addr().String(), func() { l.Close() }
+}
+
+func startProxy(t *testing.T, p *Proxy, tlsConfig *tls.Config) (string, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsConfig != nil {
+		l = tls.NewListener(l, tlsConfig)
+	}
+
+	go p.Serve(l)
+	return l.Addr().String(), func() { l.Close() }
+}
+
+func roundTrip(t *testing.T, conn net.Conn, msg string) string {
+	conn.SetDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Write([]byte(msg + "\n")); err != nil {
+		return ""
+	}
+
+	reply, _ := bufio.NewReader(conn).ReadString('\n')
+	return reply
+}
+
+func TestProxyTCP(t *testing.T) {
+	upstream, stop := startEcho(t, "db", nil)
+	defer stop()
+
+	p := &Proxy{}
+	if err := p.AddDomainHandler("", "tcp://"+upstream, nil); err != nil {
+		t.Fatal(err)
+	}
+	addr, stopProxy := startProxy(t, p, nil)
+	defer stopProxy()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if reply := roundTrip(t, conn, "ping"); reply != "db: ping\n" {
+		t.Error("Data should be proxied", reply)
+	}
+	if reply := roundTrip(t, conn, "pong"); reply != "db: pong\n" {
+		t.Error("Connection should be kept open", reply)
+	}
+}
+
+func TestProxyTLS(t *testing.T) {
+	upstreamCert := genCertificate(t, "localhost")
+	mqtt, stopMQTT := startEcho(t, "mqtt", &upstreamCert)
+	defer stopMQTT()
+	db, stopDB := startEcho(t, "db", nil)
+	defer stopDB()
+
+	pool := x509.NewCertPool()
+	leaf, _ := x509.ParseCertificate(upstreamCert.Certificate[0])
+	pool.AddCert(leaf)
+
+	p := &Proxy{}
+	if err := p.AddDomainHandler("mqtt.example.com", "tls://localhost:"+portOf(mqtt), &tls.Config{RootCAs: pool}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AddDomainHandler("db.example.com", "tcp://"+db, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	serverCert := genCertificate(t, "mqtt.example.com", "db.example.com", "other.example.com")
+	addr, stopProxy := startProxy(t, p, &tls.Config{Certificates: []tls.Certificate{serverCert}})
+	defer stopProxy()
+
+	dial := func(domain string) net.Conn {
+		conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: domain, InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+
+	for domain, expected := range map[string]string{
+		"mqtt.example.com":  "mqtt: hi\n",
+		"db.example.com":    "db: hi\n",
+		"other.example.com": "",
+	} {
+		conn := dial(domain)
+		if reply := roundTrip(t, conn, "hi"); reply != expected {
+			t.Errorf("Connection to %s should be routed by SNI, got %q", domain, reply)
+		}
+		conn.Close()
+	}
+
+	// Routes are replaced on reload
+	p2 := &Proxy{}
+	p2.AddDomainHandler("", "tcp://"+db, nil)
+	p.Swap(p2)
+
+	conn := dial("other.example.com")
+	defer conn.Close()
+	if reply := roundTrip(t, conn, "hi"); reply != "db: hi\n" {
+		t.Error("Default upstream should be used", reply)
+	}
+}
+
+func TestAddDomainHandler(t *testing.T) {
+	p := &Proxy{}
+	for _, upstream := range []string{"http://localhost:80", "tcp://localhost", "localhost:5432"} {
+		if err := p.AddDomainHandler("", upstream, nil); err == nil {
+			t.Error("Upstream should be rejected", upstream)
+		}
+	}
+}
+
+func portOf(addr string) string {
+	_, port, _ := net.SplitHostPort(addr)
+	return port
+}
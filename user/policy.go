@@ -8,10 +8,15 @@ type Policy struct {
 	OrgID              string                      `bson:"org_id" json:"org_id"`
 	Rate               float64                     `bson:"rate" json:"rate"`
 	Per                float64                     `bson:"per" json:"per"`
+	Burst              int                         `bson:"burst" json:"burst"`
 	QuotaMax           int64                       `bson:"quota_max" json:"quota_max"`
 	QuotaRenewalRate   int64                       `bson:"quota_renewal_rate" json:"quota_renewal_rate"`
+	QuotaRules         QuotaRules                  `bson:"quota_rules" json:"quota_rules"`
 	ThrottleInterval   float64                     `bson:"throttle_interval" json:"throttle_interval"`
 	ThrottleRetryLimit int                         `bson:"throttle_retry_limit" json:"throttle_retry_limit"`
+	ThrottleQueueSize  int                         `bson:"throttle_queue_size" json:"throttle_queue_size"`
+	ThrottleMaxWait    float64                     `bson:"throttle_max_wait" json:"throttle_max_wait"`
+	MaxConcurrent      int                         `bson:"max_concurrent_requests" json:"max_concurrent_requests"`
 	AccessRights       map[string]AccessDefinition `bson:"access_rights" json:"access_rights"`
 	HMACEnabled        bool                        `bson:"hmac_enabled" json:"hmac_enabled"`
 	Active             bool                        `bson:"active" json:"active"`
@@ -20,6 +25,10 @@ type Policy struct {
 	KeyExpiresIn       int64                       `bson:"key_expires_in" json:"key_expires_in"`
 	Partitions         PolicyPartitions            `bson:"partitions" json:"partitions"`
 	LastUpdated        string                      `bson:"last_updated" json:"last_updated"`
+	GraphQLLimits      GraphQLLimits               `bson:"graphql_limits" json:"graphql_limits"`
+	Priority           int                         `bson:"priority" json:"priority"`
+	Schedule           PolicySchedule              `bson:"schedule" json:"schedule"`
+	GeoIPAccess        GeoIPAccess                 `bson:"geo_ip_access" json:"geo_ip_access"`
 }
 
 type PolicyPartitions struct {
@@ -0,0 +1,152 @@
+package user
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PolicySchedule limits when a policy grants access, keys of a policy out of
+// its schedule being inactive. Start and End are unix timestamps, 0 leaving
+// the period open. Windows are cron expressions of the minutes the policy is
+// active in, evaluated in Timezone, UTC by default. Without windows the
+// policy is active at any time of its period.
+type PolicySchedule struct {
+	Start    int64    `bson:"start" json:"start"`
+	End      int64    `bson:"end" json:"end"`
+	Timezone string   `bson:"timezone" json:"timezone"`
+	Windows  []string `bson:"windows" json:"windows"`
+}
+
+// Active tells whether the schedule is active at the time. It returns an
+// error for an unknown timezone or an invalid window.
+func (s PolicySchedule) Active(now time.Time) (bool, error) {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return false, err
+	}
+	windows := make([]cronExpr, len(s.Windows))
+	for i, window := range s.Windows {
+		if windows[i], err = parseCronExpr(window); err != nil {
+			return false, err
+		}
+	}
+
+	if s.Start > 0 && now.Unix() < s.Start {
+		return false, nil
+	}
+	if s.End > 0 && now.Unix() >= s.End {
+		return false, nil
+	}
+	if len(windows) == 0 {
+		return true, nil
+	}
+
+	now = now.In(loc)
+	for _, window := range windows {
+		if window.matches(now) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// cronExpr is a parsed cron expression of five fields: minute, hour, day of
+// month, month and day of week. Fields are sets of the values they match.
+type cronExpr struct {
+	minute, hour, dom, month, dow uint64
+	// As with cron, when both days are restricted either of them matches
+	domAny, dowAny bool
+}
+
+var cronBounds = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+func parseCronExpr(expr string) (cronExpr, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronBounds) {
+		return cronExpr{}, fmt.Errorf("cron expression %q should have %d fields", expr, len(cronBounds))
+	}
+
+	var sets [5]uint64
+	for i, field := range fields {
+		set, err := parseCronField(field, cronBounds[i][0], cronBounds[i][1])
+		if err != nil {
+			return cronExpr{}, fmt.Errorf("cron expression %q: %v", expr, err)
+		}
+		sets[i] = set
+	}
+	// Sunday is either 0 or 7
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+
+	return cronExpr{
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		domAny: fields[2] == "*",
+		dowAny: fields[4] == "*",
+	}, nil
+}
+
+// parseCronField parses a comma separated list of values, ranges and "*",
+// each with an optional step.
+func parseCronField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		values, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			values = part[:i]
+		}
+
+		from, to := min, max
+		if values != "*" {
+			bounds := strings.SplitN(values, "-", 2)
+			var err error
+			if from, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value in %q", part)
+			}
+			switch {
+			case len(bounds) == 2:
+				if to, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid value in %q", part)
+				}
+			case step == 1:
+				to = from
+			}
+		}
+		if from < min || to > max || from > to {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+
+		for v := from; v <= to; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+func (c cronExpr) matches(t time.Time) bool {
+	if c.minute&(1<<uint(t.Minute())) == 0 ||
+		c.hour&(1<<uint(t.Hour())) == 0 ||
+		c.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	}
+	return dom || dow
+}
@@ -24,12 +24,28 @@ type AccessSpec struct {
 	Methods []string `json:"methods" msg:"methods"`
 }
 
+// EndpointLimit limits requests of a key to an endpoint of the API, and
+// takes precedence over the limit of the endpoint in the API definition. Path
+// is a regex matched against request path, as URL of AccessSpec.
+type EndpointLimit struct {
+	Path             string  `json:"path" msg:"path"`
+	Method           string  `json:"method" msg:"method"`
+	Rate             float64 `json:"rate" msg:"rate"`
+	Per              float64 `json:"per" msg:"per"`
+	QuotaMax         int64   `json:"quota_max" msg:"quota_max"`
+	QuotaRenewalRate int64   `json:"quota_renewal_rate" msg:"quota_renewal_rate"`
+}
+
 // APILimit stores quota and rate limit on ACL level (per API)
 type APILimit struct {
 	Rate               float64 `json:"rate" msg:"rate"`
 	Per                float64 `json:"per" msg:"per"`
+	Burst              int     `json:"burst" msg:"burst"`
 	ThrottleInterval   float64 `json:"throttle_interval" msg:"throttle_interval"`
 	ThrottleRetryLimit int     `json:"throttle_retry_limit" msg:"throttle_retry_limit"`
+	ThrottleQueueSize  int     `json:"throttle_queue_size" msg:"throttle_queue_size"`
+	ThrottleMaxWait    float64 `json:"throttle_max_wait" msg:"throttle_max_wait"`
+	MaxConcurrent      int     `json:"max_concurrent_requests" msg:"max_concurrent_requests"`
 	QuotaMax           int64   `json:"quota_max" msg:"quota_max"`
 	QuotaRenews        int64   `json:"quota_renews" msg:"quota_renews"`
 	QuotaRemaining     int64   `json:"quota_remaining" msg:"quota_remaining"`
@@ -37,6 +53,46 @@ type APILimit struct {
 	SetByPolicy        bool    `json:"set_by_policy" msg:"set_by_policy"`
 }
 
+// QuotaResetMonthly renews quotas at the start of the 1st of each month, UTC.
+const QuotaResetMonthly = "monthly"
+
+// QuotaRules change when quotas renew and how much of them is allowed per
+// period. Prorate and CarryOver apply to calendar periods only.
+type QuotaRules struct {
+	// Reset aligns quota periods to calendar. Empty renews quota renewal
+	// rate seconds after the first request of a period.
+	Reset string `json:"reset" msg:"reset"`
+	// Prorate reduces quota of the period the key is created in, in
+	// proportion to the part of the period left.
+	Prorate bool `json:"prorate" msg:"prorate"`
+	// CarryOver adds quota left unused in the previous period, up to the
+	// quota of a period.
+	CarryOver bool `json:"carry_over" msg:"carry_over"`
+}
+
+// Validate returns an error for unknown Reset.
+func (q QuotaRules) Validate() error {
+	if q.Reset != "" && q.Reset != QuotaResetMonthly {
+		return fmt.Errorf("unknown quota reset %q, should be empty or %q", q.Reset, QuotaResetMonthly)
+	}
+	return nil
+}
+
+// GeoIPAccess allows and blocks the locations a key can be used from, as the
+// geo_ip_access of API definitions does.
+type GeoIPAccess struct {
+	Allowed []string `bson:"allowed" json:"allowed" msg:"allowed"`
+	Blocked []string `bson:"blocked" json:"blocked" msg:"blocked"`
+}
+
+// GraphQLLimits limit cost of GraphQL queries sent with a key. 0 keeps the
+// API default, -1 means no limit.
+type GraphQLLimits struct {
+	MaxDepth      int `json:"max_depth" msg:"max_depth"`
+	MaxComplexity int `json:"max_complexity" msg:"max_complexity"`
+	MaxAliases    int `json:"max_aliases" msg:"max_aliases"`
+}
+
 // AccessDefinition defines which versions of an API a key has access to
 type AccessDefinition struct {
 	APIName     string       `json:"api_name" msg:"api_name"`
@@ -44,6 +100,8 @@ type AccessDefinition struct {
 	Versions    []string     `json:"versions" msg:"versions"`
 	AllowedURLs []AccessSpec `bson:"allowed_urls" json:"allowed_urls" msg:"allowed_urls"` // mapped string MUST be a valid regex
 	Limit       *APILimit    `json:"limit" msg:"limit"`
+
+	EndpointLimits []EndpointLimit `json:"endpoint_limits,omitempty" msg:"endpoint_limits"`
 }
 
 // SessionState objects represent a current API session, mainly used for rate limiting.
@@ -55,19 +113,29 @@ type SessionState struct {
 	Allowance          float64                     `json:"allowance" msg:"allowance"`
 	Rate               float64                     `json:"rate" msg:"rate"`
 	Per                float64                     `json:"per" msg:"per"`
+	Burst              int                         `json:"burst" msg:"burst"`
 	ThrottleInterval   float64                     `json:"throttle_interval" msg:"throttle_interval"`
 	ThrottleRetryLimit int                         `json:"throttle_retry_limit" msg:"throttle_retry_limit"`
+	ThrottleQueueSize  int                         `json:"throttle_queue_size" msg:"throttle_queue_size"`
+	ThrottleMaxWait    float64                     `json:"throttle_max_wait" msg:"throttle_max_wait"`
+	MaxConcurrent      int                         `json:"max_concurrent_requests" msg:"max_concurrent_requests"`
 	DateCreated        time.Time                   `json:"date_created" msg:"date_created"`
 	Expires            int64                       `json:"expires" msg:"expires"`
 	QuotaMax           int64                       `json:"quota_max" msg:"quota_max"`
 	QuotaRenews        int64                       `json:"quota_renews" msg:"quota_renews"`
 	QuotaRemaining     int64                       `json:"quota_remaining" msg:"quota_remaining"`
 	QuotaRenewalRate   int64                       `json:"quota_renewal_rate" msg:"quota_renewal_rate"`
+	QuotaRules         QuotaRules                  `json:"quota_rules" msg:"quota_rules"`
 	AccessRights       map[string]AccessDefinition `json:"access_rights" msg:"access_rights"`
 	OrgID              string                      `json:"org_id" msg:"org_id"`
 	OauthClientID      string                      `json:"oauth_client_id" msg:"oauth_client_id"`
 	OauthKeys          map[string]string           `json:"oauth_keys" msg:"oauth_keys"`
 	Certificate        string                      `json:"certificate" msg:"certificate"`
+	CertificateBinding string                      `json:"certificate_binding" msg:"certificate_binding"`
+	DPoPBinding        string                      `json:"dpop_binding" msg:"dpop_binding"`
+	KeyVerifier        string                      `json:"key_verifier" msg:"key_verifier"`
+	AllowedIPs         []string                    `json:"allowed_ips" msg:"allowed_ips"`
+	GeoIPAccess        GeoIPAccess                 `json:"geo_ip_access" msg:"geo_ip_access"`
 	BasicAuthData      struct {
 		Password string   `json:"password" msg:"password"`
 		Hash     HashType `json:"hash_type" msg:"hash_type"`
@@ -89,8 +157,10 @@ type SessionState struct {
 	Tags                    []string               `json:"tags" msg:"tags"`
 	Alias                   string                 `json:"alias" msg:"alias"`
 	LastUpdated             string                 `json:"last_updated" msg:"last_updated"`
+	Version                 int64                  `json:"version" msg:"version"`
 	IdExtractorDeadline     int64                  `json:"id_extractor_deadline" msg:"id_extractor_deadline"`
 	SessionLifetime         int64                  `bson:"session_lifetime" json:"session_lifetime"`
+	GraphQLLimits           GraphQLLimits          `json:"graphql_limits" msg:"graphql_limits"`
 
 	// Used to store token hash
 	keyHash string